@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+const (
+	// alarmPollInterval is how often the state of the run's alarms is checked
+	alarmPollInterval     = 30 * time.Second
+	defaultAlarmPeriod    = time.Minute
+	defaultAlarmStatistic = "Maximum"
+)
+
+var (
+	// onAlarmActions are what a run does once one of its alarms fires
+	onAlarmActions = []string{"abort", "notify"}
+	// extendedStatistic matches the percentile statistics CloudWatch alarms accept, e.g. p99 or p99.9
+	extendedStatistic = regexp.MustCompile(`^p\d{1,2}(\.\d+)?$`)
+)
+
+// AlarmSpec is a CloudWatch alarm created for the duration of a run on any metric, e.g. the lag of a consumer of the
+// zone's changes. Zero values fall back to a 1 minute period, the Maximum statistic, 1 evaluation period, and
+// GreaterThanThreshold.
+type AlarmSpec struct {
+	Name              string            `yaml:"name"`
+	Namespace         string            `yaml:"namespace"`
+	Metric            string            `yaml:"metric"`
+	Dimensions        map[string]string `yaml:"dimensions"`
+	Statistic         string            `yaml:"statistic"`
+	Comparison        string            `yaml:"comparison"`
+	Threshold         float64           `yaml:"threshold"`
+	Period            time.Duration     `yaml:"period"`
+	EvaluationPeriods int               `yaml:"evaluation-periods"`
+}
+
+// alarmError is the cause of a run aborted by one of its alarms. It wraps context.Canceled so the run is reported as
+// aborted.
+type alarmError struct {
+	alarm  string
+	reason string
+}
+
+func (e *alarmError) Error() string {
+	return fmt.Sprintf("alarm %s fired: %s", e.alarm, e.reason)
+}
+
+func (e *alarmError) Unwrap() error {
+	return context.Canceled
+}
+
+// RunAlarms are CloudWatch alarms that only exist for the duration of a run, so an unattended flood stops itself or
+// notifies the SNS topic when something downstream can't keep up. A nil RunAlarms is a no-op.
+type RunAlarms struct {
+	mu        sync.Mutex
+	client    *cloudwatch.Client
+	prefix    string
+	namespace string
+	throttles int
+	actions   []string
+	abort     bool
+	names     []string
+	firing    map[string]bool
+	cancel    context.CancelCauseFunc
+	// polling is canceled by Close, which stops checking the alarms including the check in flight
+	polling     context.Context
+	stopPolling context.CancelFunc
+	stopped     chan struct{}
+}
+
+// NewRunAlarms creates the alarms of the config file, the throttling alarm of each zone is created once it's added
+func NewRunAlarms(ctx context.Context, client *cloudwatch.Client, opts Options) (*RunAlarms, error) {
+	a := &RunAlarms{
+		client:    client,
+		prefix:    "floodzone-" + opts.RunID + "-",
+		namespace: opts.CloudWatchNamespace,
+		throttles: opts.AlarmThrottles,
+		abort:     opts.OnAlarm == "abort",
+		firing:    map[string]bool{},
+		stopped:   make(chan struct{}),
+	}
+	a.polling, a.stopPolling = context.WithCancel(context.Background())
+	if opts.SNSTopicARN != "" {
+		a.actions = []string{opts.SNSTopicARN}
+	}
+	for _, spec := range opts.Alarms {
+		if err := a.put(ctx, spec); err != nil {
+			a.Close(ctx)
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// AddZone creates the throttling alarm of a hosted zone, on the Throttles metric floodzone publishes
+func (a *RunAlarms) AddZone(ctx context.Context, hostedZone *types.HostedZone) error {
+	if a == nil || a.throttles == 0 {
+		return nil
+	}
+	id := aws.ToString(hostedZone.Id)
+	return a.put(ctx, AlarmSpec{
+		Name:       "throttles-" + strings.TrimPrefix(id, "/hostedzone/"),
+		Namespace:  a.namespace,
+		Metric:     "Throttles",
+		Dimensions: map[string]string{"HostedZoneId": id},
+		Statistic:  "Sum",
+		Comparison: string(cwtypes.ComparisonOperatorGreaterThanOrEqualToThreshold),
+		Threshold:  float64(a.throttles),
+	})
+}
+
+func (a *RunAlarms) put(ctx context.Context, spec AlarmSpec) error {
+	name := a.prefix + spec.Name
+	if spec.Name == "" {
+		name = a.prefix + spec.Metric
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if slices.Contains(a.names, name) {
+		return nil
+	}
+	input := &cloudwatch.PutMetricAlarmInput{
+		AlarmName:          aws.String(name),
+		AlarmDescription:   aws.String("Created by floodzone for the duration of a run, deleted when the run finishes"),
+		Namespace:          aws.String(spec.Namespace),
+		MetricName:         aws.String(spec.Metric),
+		ComparisonOperator: cwtypes.ComparisonOperatorGreaterThanThreshold,
+		Threshold:          aws.Float64(spec.Threshold),
+		Period:             aws.Int32(int32(defaultAlarmPeriod.Seconds())),
+		EvaluationPeriods:  aws.Int32(1),
+		Statistic:          defaultAlarmStatistic,
+		// a downstream metric going quiet isn't a reason to stop the flood
+		TreatMissingData: aws.String("notBreaching"),
+		AlarmActions:     a.actions,
+	}
+	for dimension, value := range spec.Dimensions {
+		input.Dimensions = append(input.Dimensions, cwtypes.Dimension{Name: aws.String(dimension), Value: aws.String(value)})
+	}
+	if spec.Comparison != "" {
+		input.ComparisonOperator = cwtypes.ComparisonOperator(spec.Comparison)
+	}
+	if spec.Period != 0 {
+		input.Period = aws.Int32(int32(spec.Period.Seconds()))
+	}
+	if spec.EvaluationPeriods != 0 {
+		input.EvaluationPeriods = aws.Int32(int32(spec.EvaluationPeriods))
+	}
+	if extendedStatistic.MatchString(spec.Statistic) {
+		input.Statistic, input.ExtendedStatistic = "", aws.String(spec.Statistic)
+	} else if spec.Statistic != "" {
+		input.Statistic = cwtypes.Statistic(spec.Statistic)
+	}
+	if _, err := a.client.PutMetricAlarm(ctx, input); err != nil {
+		return fmt.Errorf("unable to create alarm %s: %w", name, err)
+	}
+	a.names = append(a.names, name)
+	slog.Info("⏰ Created CloudWatch alarm for the run", "alarm", name, "metric", spec.Namespace+"/"+spec.Metric, "threshold", spec.Threshold)
+	return nil
+}
+
+// Watch checks the state of the alarms until Close is called. When aborting on alarms, the returned context is
+// canceled with an alarmError once any of them fires.
+func (a *RunAlarms) Watch(ctx context.Context) context.Context {
+	if a == nil {
+		return ctx
+	}
+	ctx, a.cancel = context.WithCancelCause(ctx)
+	go func() {
+		defer close(a.stopped)
+		ticker := time.NewTicker(alarmPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				a.check(a.polling)
+			case <-a.polling.Done():
+				return
+			}
+		}
+	}()
+	return ctx
+}
+
+// check logs the alarms that started or stopped firing since the last check, canceling the run if it aborts on alarms
+func (a *RunAlarms) check(ctx context.Context) {
+	a.mu.Lock()
+	names := slices.Clone(a.names)
+	a.mu.Unlock()
+	if len(names) == 0 {
+		return
+	}
+	out, err := a.client.DescribeAlarms(ctx, &cloudwatch.DescribeAlarmsInput{AlarmNames: names})
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Warn("unable to check the state of the run's alarms", "error", err)
+		}
+		return
+	}
+	for _, alarm := range out.MetricAlarms {
+		name := aws.ToString(alarm.AlarmName)
+		firing := alarm.StateValue == cwtypes.StateValueAlarm
+		if firing == a.firing[name] {
+			continue
+		}
+		a.firing[name] = firing
+		if !firing {
+			slog.Info("Alarm stopped firing", "alarm", name)
+			continue
+		}
+		slog.Warn("🚨 Alarm fired", "alarm", name, "reason", aws.ToString(alarm.StateReason))
+		if a.abort {
+			a.cancel(&alarmError{alarm: name, reason: aws.ToString(alarm.StateReason)})
+		}
+	}
+}
+
+// Close stops checking the alarms and deletes them
+func (a *RunAlarms) Close(ctx context.Context) {
+	if a == nil {
+		return
+	}
+	a.stopPolling()
+	if a.cancel != nil {
+		<-a.stopped
+		a.cancel(nil)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.names) == 0 {
+		return
+	}
+	if _, err := a.client.DeleteAlarms(ctx, &cloudwatch.DeleteAlarmsInput{AlarmNames: a.names}); err != nil {
+		slog.Warn("unable to delete the run's alarms", "alarms", a.names, "error", err)
+		return
+	}
+	slog.Info("🧹 Deleted the run's CloudWatch alarms", "alarms", len(a.names))
+}
+
+// validateAlarms validates the alarms of a run before any of them are created
+func validateAlarms(opts Options) error {
+	var errs []error
+	if !slices.Contains(onAlarmActions, opts.OnAlarm) {
+		errs = append(errs, fmt.Errorf("--on-alarm must be one of %s, got %q", strings.Join(onAlarmActions, ", "), opts.OnAlarm))
+	}
+	if opts.AlarmThrottles < 0 {
+		errs = append(errs, fmt.Errorf("--alarm-throttles must not be negative, got %d", opts.AlarmThrottles))
+	}
+	for i, spec := range opts.Alarms {
+		name := fmt.Sprintf("alarm %d", i+1)
+		if spec.Namespace == "" || spec.Metric == "" {
+			errs = append(errs, fmt.Errorf("%s must have a namespace and a metric", name))
+		}
+		if spec.Statistic != "" && !extendedStatistic.MatchString(spec.Statistic) && !slices.Contains(cwtypes.Statistic("").Values(), cwtypes.Statistic(spec.Statistic)) {
+			errs = append(errs, fmt.Errorf("statistic of %s must be a CloudWatch statistic or percentile like p99, got %q", name, spec.Statistic))
+		}
+		if spec.Comparison != "" && !slices.Contains(cwtypes.ComparisonOperator("").Values(), cwtypes.ComparisonOperator(spec.Comparison)) {
+			errs = append(errs, fmt.Errorf("comparison of %s must be a CloudWatch comparison operator like GreaterThanThreshold, got %q", name, spec.Comparison))
+		}
+		if spec.Period != 0 && spec.Period != 10*time.Second && spec.Period != 30*time.Second && spec.Period%time.Minute != 0 {
+			errs = append(errs, fmt.Errorf("period of %s must be 10s, 30s, or a multiple of 1m, got %s", name, spec.Period))
+		}
+		if spec.EvaluationPeriods < 0 {
+			errs = append(errs, fmt.Errorf("evaluation-periods of %s must not be negative", name))
+		}
+	}
+	return errors.Join(errs...)
+}
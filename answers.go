@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// correctnessInterval is the length of the intervals the correctness of the answers is reported over
+const correctnessInterval = 10 * time.Second
+
+// correctnessResult is how many of the queries for the record sets of a manifest were answered with the values the
+// record sets were last written with, with --check-answers
+type correctnessResult struct {
+	Checked int `json:"checked" yaml:"checked"`
+	Correct int `json:"correct" yaml:"correct"`
+	// Stale answers have values the record set was written with before its last write, e.g. because the change hasn't
+	// propagated yet or the resolver answered from its cache
+	Stale int `json:"stale" yaml:"stale"`
+	// Wrong answers have values the record set was never written with
+	Wrong           int     `json:"wrong" yaml:"wrong"`
+	CorrectnessRate float64 `json:"correctnessRate" yaml:"correctnessRate"`
+	// Lag is how long the record sets that were written during the run took from their write to the first answer with
+	// the new values, if any were
+	Lag *latencyStats `json:"lag,omitempty" yaml:"lag,omitempty"`
+	// Intervals are the correctness of every 10 seconds of the run
+	Intervals []correctnessBucket `json:"intervals" yaml:"intervals"`
+	// StaleWindows are the runs of intervals with stale answers
+	StaleWindows []staleWindow `json:"staleWindows" yaml:"staleWindows"`
+}
+
+// correctnessBucket is the correctness of the answers in an interval of the run
+type correctnessBucket struct {
+	// Offset is the number of seconds from the start of the run to the start of the interval
+	Offset          int     `json:"offset" yaml:"offset"`
+	Checked         int     `json:"checked" yaml:"checked"`
+	Correct         int     `json:"correct" yaml:"correct"`
+	Stale           int     `json:"stale" yaml:"stale"`
+	Wrong           int     `json:"wrong" yaml:"wrong"`
+	CorrectnessRate float64 `json:"correctnessRate" yaml:"correctnessRate"`
+}
+
+// staleWindow is a stretch of the run in which resolvers answered with stale values
+type staleWindow struct {
+	// From and To are the number of seconds from the start of the run the window started and ended at
+	From  int `json:"from" yaml:"from"`
+	To    int `json:"to" yaml:"to"`
+	Stale int `json:"stale" yaml:"stale"`
+}
+
+func (r correctnessResult) writeTable(w io.Writer) {
+	fmt.Fprintln(w, "CHECKED ANSWERS\tCORRECT\tSTALE\tWRONG\tCORRECTNESS")
+	fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%.2f%%\n", r.Checked, r.Correct, r.Stale, r.Wrong, r.CorrectnessRate)
+	if l := r.Lag; l != nil {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "LAG\tMIN\tMEAN\tP50\tP90\tP99\tMAX")
+		fmt.Fprintf(w, "Write to correct answer\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%.1fms\n", l.Min, l.Mean, l.P50, l.P90, l.P99, l.Max)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "INTERVAL\tCHECKED\tCORRECT\tSTALE\tWRONG\tCORRECTNESS")
+	for _, b := range r.Intervals {
+		fmt.Fprintf(w, "%ds\t%d\t%d\t%d\t%d\t%.2f%%\n", b.Offset, b.Checked, b.Correct, b.Stale, b.Wrong, b.CorrectnessRate)
+	}
+	if len(r.StaleWindows) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "STALE WINDOW\tSTALE ANSWERS")
+	for _, window := range r.StaleWindows {
+		fmt.Fprintf(w, "%ds-%ds\t%d\n", window.From, window.To, window.Stale)
+	}
+}
+
+// expectedAnswer is the values a record set of the manifest was last written with, and the values it had before
+type expectedAnswer struct {
+	values    string
+	previous  []string
+	writtenAt time.Time
+	// pending is set from a write until the first answer with its values, to measure the lag
+	pending bool
+}
+
+// AnswerChecker compares the answers of a query run with the values the record sets of a manifest were last written
+// with, reading the manifest again every refresh interval to follow the values a churn run writes to it. A nil
+// AnswerChecker doesn't check anything.
+type AnswerChecker struct {
+	mu        sync.Mutex
+	artifacts *Artifacts
+	src       string
+	start     time.Time
+	expected  map[queryTarget]*expectedAnswer
+	result    correctnessResult
+	intervals []correctnessBucket
+	lags      []time.Duration
+}
+
+// NewAnswerChecker returns an AnswerChecker of the values of the manifest at src
+func NewAnswerChecker(ctx context.Context, artifacts *Artifacts, src string) (*AnswerChecker, error) {
+	c := &AnswerChecker{artifacts: artifacts, src: src, start: time.Now(), expected: map[queryTarget]*expectedAnswer{}}
+	if err := c.refresh(ctx); err != nil {
+		return nil, err
+	}
+	if len(c.expected) == 0 {
+		return nil, fmt.Errorf("the record manifest %s has no values to check the answers against, write it again with this version of floodzone", src)
+	}
+	return c, nil
+}
+
+// Follow reads the manifest again every interval until ctx is done. The manifest is only read once when it was
+// written by a run that's over, but a churn run with --manifest-interval keeps writing new values to it.
+func (c *AnswerChecker) Follow(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// the manifest can be briefly unreadable while it's replaced, the values are checked against the last read
+			if err := c.refresh(ctx); err != nil && ctx.Err() == nil {
+				slog.Debug("unable to read the record manifest again", "src", c.src, "error", err)
+			}
+		}
+	}
+}
+
+// refresh reads the manifest and remembers the values the record sets had before when they changed
+func (c *AnswerChecker) refresh(ctx context.Context) error {
+	manifest, err := readManifest(ctx, c.artifacts, c.src)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for _, record := range manifest.Records {
+		if len(record.Values) == 0 {
+			continue
+		}
+		values := make([]string, 0, len(record.Values))
+		for _, value := range record.Values {
+			values = append(values, normalizeAnswer(value))
+		}
+		writtenAt := now
+		if record.WrittenAt != nil {
+			writtenAt = *record.WrittenAt
+		}
+		key := answerKey(record.Name, types.RRType(record.Type))
+		expected, ok := c.expected[key]
+		switch {
+		case !ok:
+			c.expected[key] = &expectedAnswer{values: joinAnswers(values), writtenAt: writtenAt}
+		case expected.values != joinAnswers(values):
+			expected.previous = append(expected.previous, expected.values)
+			expected.values = joinAnswers(values)
+			expected.writtenAt = writtenAt
+			expected.pending = true
+		}
+	}
+	return nil
+}
+
+// Check records whether the answers of a query for the target have the values its record set was last written with,
+// and returns why they don't, or "" if they do or the record set has no values to check
+func (c *AnswerChecker) Check(target queryTarget, answers []string) string {
+	if c == nil {
+		return ""
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expected, ok := c.expected[answerKey(target.name, target.rrType)]
+	if !ok {
+		return ""
+	}
+	now := time.Now()
+	i := int(now.Sub(c.start) / correctnessInterval)
+	for len(c.intervals) <= i {
+		c.intervals = append(c.intervals, correctnessBucket{Offset: len(c.intervals) * int(correctnessInterval.Seconds())})
+	}
+	bucket := &c.intervals[i]
+	bucket.Checked++
+	c.result.Checked++
+	normalized := make([]string, 0, len(answers))
+	for _, answer := range answers {
+		normalized = append(normalized, normalizeAnswer(answer))
+	}
+	got := joinAnswers(normalized)
+	switch {
+	case got == expected.values:
+		bucket.Correct++
+		c.result.Correct++
+		if expected.pending {
+			expected.pending = false
+			c.lags = append(c.lags, now.Sub(expected.writtenAt))
+		}
+		return ""
+	case slices.Contains(expected.previous, got):
+		bucket.Stale++
+		c.result.Stale++
+		return "stale answer"
+	default:
+		bucket.Wrong++
+		c.result.Wrong++
+		return "wrong answer"
+	}
+}
+
+// Result returns the correctness of the answers checked so far
+func (c *AnswerChecker) Result() *correctnessResult {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result := c.result
+	result.Intervals = []correctnessBucket{}
+	result.StaleWindows = []staleWindow{}
+	if result.Checked > 0 {
+		result.CorrectnessRate = float64(result.Correct) / float64(result.Checked) * 100
+	}
+	if len(c.lags) > 0 {
+		lag := newLatencyStats(c.lags)
+		result.Lag = &lag
+	}
+	var window *staleWindow
+	for _, bucket := range c.intervals {
+		if bucket.Checked > 0 {
+			bucket.CorrectnessRate = float64(bucket.Correct) / float64(bucket.Checked) * 100
+		}
+		result.Intervals = append(result.Intervals, bucket)
+		end := bucket.Offset + int(correctnessInterval.Seconds())
+		switch {
+		case bucket.Stale > 0 && window != nil:
+			window.To = end
+			window.Stale += bucket.Stale
+		case bucket.Stale > 0:
+			window = &staleWindow{From: bucket.Offset, To: end, Stale: bucket.Stale}
+		case window != nil:
+			result.StaleWindows = append(result.StaleWindows, *window)
+			window = nil
+		}
+	}
+	if window != nil {
+		result.StaleWindows = append(result.StaleWindows, *window)
+	}
+	return &result
+}
+
+// answerKey identifies the record set a query is for regardless of the case of its name
+func answerKey(name string, rrType types.RRType) queryTarget {
+	return queryTarget{name: normalizeName(name), rrType: rrType}
+}
+
+// joinAnswers returns the sorted answers joined by commas, so that they compare regardless of order
+func joinAnswers(answers []string) string {
+	answers = slices.Clone(answers)
+	slices.Sort(answers)
+	return strings.Join(answers, ",")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Artifacts reads and writes the files a run keeps, like its summary, record manifest, and checkpoint, at local paths
+// or s3://bucket/key URIs, so that they survive runs on ephemeral containers. Objects are written with the server-side
+// encryption of --s3-sse.
+type Artifacts struct {
+	client   *s3.Client
+	sse      s3types.ServerSideEncryption
+	kmsKeyID string
+}
+
+// NewArtifacts returns Artifacts that write objects with the S3 client and the server-side encryption, if it's set
+func NewArtifacts(client *s3.Client, sse string, kmsKeyID string) *Artifacts {
+	return &Artifacts{client: client, sse: s3types.ServerSideEncryption(sse), kmsKeyID: kmsKeyID}
+}
+
+// Write writes data to dest. A local file is replaced with a rename so that a reader never sees half of it.
+func (a *Artifacts) Write(ctx context.Context, dest string, data []byte, contentType string) error {
+	if bucket, key, ok := parseS3URI(dest); ok {
+		input := &s3.PutObjectInput{
+			Bucket:      aws.String(bucket),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(data),
+			ContentType: aws.String(contentType),
+		}
+		if a.sse != "" {
+			input.ServerSideEncryption = a.sse
+		}
+		if a.kmsKeyID != "" {
+			input.SSEKMSKeyId = aws.String(a.kmsKeyID)
+		}
+		if _, err := a.client.PutObject(ctx, input); err != nil {
+			return fmt.Errorf("unable to upload %s: %w", dest, err)
+		}
+		return nil
+	}
+	tmp := dest + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+// Read reads src. The error wraps fs.ErrNotExist if there's no file or object at src.
+func (a *Artifacts) Read(ctx context.Context, src string) ([]byte, error) {
+	bucket, key, ok := parseS3URI(src)
+	if !ok {
+		return os.ReadFile(src)
+	}
+	out, err := a.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, fmt.Errorf("unable to download %s: %w", src, fs.ErrNotExist)
+		}
+		return nil, fmt.Errorf("unable to download %s: %w", src, err)
+	}
+	defer out.Body.Close()
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to download %s: %w", src, err)
+	}
+	return data, nil
+}
+
+// runArtifact returns where the artifact of a run is kept under the --artifacts prefix, in a folder per run ID
+func runArtifact(prefix string, runID string, name string) string {
+	if _, _, ok := parseS3URI(prefix); ok {
+		return strings.TrimSuffix(prefix, "/") + "/" + path.Join(runID, name)
+	}
+	return filepath.Join(prefix, runID, name)
+}
+
+// applyArtifacts defaults the summary file, and the manifest and checkpoint of the commands that have them, to the
+// --artifacts prefix of the run. Runs of the zones of a config file don't have a checkpoint.
+func (o *Options) applyArtifacts(flags *flag.FlagSet) error {
+	if o.Artifacts == "" {
+		return nil
+	}
+	if _, _, ok := parseS3URI(o.Artifacts); !ok {
+		if err := os.MkdirAll(filepath.Join(o.Artifacts, o.RunID), 0o755); err != nil {
+			return fmt.Errorf("unable to create the artifacts folder of the run: %w", err)
+		}
+	}
+	if o.SummaryFile == "" {
+		o.SummaryFile = runArtifact(o.Artifacts, o.RunID, "summary.json")
+	}
+	if o.Manifest == "" && flags.Lookup("manifest") != nil {
+		o.Manifest = runArtifact(o.Artifacts, o.RunID, "manifest.json")
+	}
+	if o.Checkpoint == "" && flags.Lookup("checkpoint") != nil && len(o.Zones) == 0 {
+		o.Checkpoint = runArtifact(o.Artifacts, o.RunID, "checkpoint.json")
+	}
+	return nil
+}
+
+// validateArtifacts validates the --artifacts prefix and the server-side encryption of the objects
+func validateArtifacts(opts Options) error {
+	var errs []error
+	if bucket, _, ok := parseS3URI(opts.Artifacts); ok && bucket == "" {
+		errs = append(errs, fmt.Errorf("--artifacts must be a local directory or an s3://bucket/prefix URI, got %q", opts.Artifacts))
+	}
+	errs = append(errs, validateManifestURI("--summary-file", opts.SummaryFile), validateManifestURI("--checkpoint", opts.Checkpoint))
+	if opts.Checkpoint != "" && len(opts.Zones) != 0 {
+		errs = append(errs, errors.New("--checkpoint can't be used with the zones of the config file"))
+	}
+	sses := []string{string(s3types.ServerSideEncryptionAes256), string(s3types.ServerSideEncryptionAwsKms), string(s3types.ServerSideEncryptionAwsKmsDsse)}
+	if opts.S3SSE != "" && !slices.Contains(sses, opts.S3SSE) {
+		errs = append(errs, fmt.Errorf("--s3-sse must be one of %s, got %q", strings.Join(sses, ", "), opts.S3SSE))
+	}
+	if opts.S3KMSKeyID != "" && !strings.HasPrefix(opts.S3SSE, "aws:kms") {
+		errs = append(errs, errors.New("--s3-kms-key-id needs --s3-sse aws:kms or aws:kms:dsse"))
+	}
+	return errors.Join(errs...)
+}
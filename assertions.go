@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// assertionExpression matches an assertion like "latency-p99 < 2s"
+	assertionExpression = regexp.MustCompile(`^\s*([a-z0-9.-]+)\s*(<=|>=|==|!=|<|>)\s*(\S+)\s*$`)
+	// percentileMetric matches a percentile of the batch latency, propagation time, or time to resolvable, e.g.
+	// latency-p99 or propagation-p95
+	percentileMetric = regexp.MustCompile(`^(latency|propagation|resolvable)-p(\d{1,2}(\.\d+)?)$`)
+	// durationMetrics are compared to a duration like 2s, every other metric to a number
+	durationMetrics = []string{"latency-min", "latency-mean", "latency-max", "propagation-min", "propagation-mean", "propagation-max",
+		"resolvable-min", "resolvable-mean", "resolvable-max", "duration"}
+	// countMetrics are the metrics that aren't durations
+	countMetrics = []string{"throttles", "errors", "error-rate", "throughput", "unresolved", "stale"}
+)
+
+// assertion is a pass/fail criterion of a run parsed from the assertions of the config file
+type assertion struct {
+	metric   string
+	operator string
+	// value is in milliseconds for duration metrics
+	value    float64
+	duration bool
+}
+
+// assertionResult is the outcome of an assertion once the run finished
+type assertionResult struct {
+	Assertion string `json:"assertion" yaml:"assertion"`
+	Actual    string `json:"actual" yaml:"actual"`
+	Passed    bool   `json:"passed" yaml:"passed"`
+}
+
+// assertionError fails a run that finished but violated some of its assertions
+type assertionError struct {
+	failed []string
+}
+
+func (e *assertionError) Error() string {
+	return fmt.Sprintf("%d assertions failed: %s", len(e.failed), strings.Join(e.failed, ", "))
+}
+
+// parseAssertion parses an assertion like "latency-p99 < 2s" or "throttles == 0"
+func parseAssertion(expression string) (assertion, error) {
+	match := assertionExpression.FindStringSubmatch(expression)
+	if match == nil {
+		return assertion{}, fmt.Errorf("assertion %q must be <metric> <operator> <value>, e.g. latency-p99 < 2s", expression)
+	}
+	a := assertion{metric: match[1], operator: match[2]}
+	switch {
+	case percentileMetric.MatchString(a.metric) || slices.Contains(durationMetrics, a.metric):
+		d, err := time.ParseDuration(match[3])
+		if err != nil {
+			return assertion{}, fmt.Errorf("value of assertion %q must be a duration like 2s: %w", expression, err)
+		}
+		a.value = milliseconds(d)
+		a.duration = true
+	case slices.Contains(countMetrics, a.metric):
+		value, err := strconv.ParseFloat(match[3], 64)
+		if err != nil {
+			return assertion{}, fmt.Errorf("value of assertion %q must be a number: %w", expression, err)
+		}
+		a.value = value
+	default:
+		return assertion{}, fmt.Errorf("unknown metric %q in assertion %q, must be latency-<pNN|min|mean|max>, propagation-<pNN|min|mean|max>, resolvable-<pNN|min|mean|max>, duration, or one of %s",
+			a.metric, expression, strings.Join(countMetrics, ", "))
+	}
+	return a, nil
+}
+
+// validateAssertions parses the assertions of a run before it starts
+func validateAssertions(opts Options) error {
+	var errs []error
+	for _, expression := range opts.Assertions {
+		a, err := parseAssertion(expression)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if strings.HasPrefix(a.metric, "propagation-") && !opts.MeasurePropagation {
+			errs = append(errs, fmt.Errorf("assertion %q needs --measure-propagation", expression))
+		}
+		if strings.HasPrefix(a.metric, "resolvable-") && !opts.MeasureResolvable {
+			errs = append(errs, fmt.Errorf("assertion %q needs --measure-resolvable", expression))
+		}
+		if a.metric == "unresolved" && opts.VerifyResolver == "" && !opts.VerifyTestDNSAnswer {
+			errs = append(errs, fmt.Errorf("assertion %q needs --verify-resolver or --verify-test-dns-answer", expression))
+		}
+		if a.metric == "stale" && !opts.VerifyList {
+			errs = append(errs, fmt.Errorf("assertion %q needs --verify-list", expression))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CheckAssertions evaluates the assertions against the run so far and keeps the results for the summary. An
+// assertionError is returned if any of them failed.
+func (s *RunStats) CheckAssertions(expressions []string) error {
+	if s == nil || len(expressions) == 0 {
+		return nil
+	}
+	summary := s.Summary("")
+	s.mu.Lock()
+	batchLatencies := latencies(s.timeline)
+	propagations := append([]time.Duration{}, s.propagations...)
+	resolvables := append([]time.Duration{}, s.resolvables...)
+	s.mu.Unlock()
+
+	var results []assertionResult
+	var failed []string
+	for _, expression := range expressions {
+		result := assertionResult{Assertion: expression, Actual: "unknown"}
+		a, err := parseAssertion(expression)
+		if err == nil {
+			if actual, ok := a.actual(summary, batchLatencies, propagations, resolvables); ok {
+				result.Passed = a.holds(actual)
+				result.Actual = a.format(actual)
+			}
+		}
+		if !result.Passed {
+			failed = append(failed, expression)
+		}
+		results = append(results, result)
+	}
+	s.mu.Lock()
+	s.assertions = results
+	s.mu.Unlock()
+	if len(failed) > 0 {
+		return &assertionError{failed: failed}
+	}
+	return nil
+}
+
+// actual returns the value of the metric of the assertion, it's not ok if the run has no value for it
+func (a assertion) actual(summary runSummary, batchLatencies []time.Duration, propagations []time.Duration, resolvables []time.Duration) (float64, bool) {
+	if match := percentileMetric.FindStringSubmatch(a.metric); match != nil {
+		durations := batchLatencies
+		switch match[1] {
+		case "propagation":
+			durations = propagations
+		case "resolvable":
+			durations = resolvables
+		}
+		if len(durations) == 0 {
+			return 0, false
+		}
+		p, _ := strconv.ParseFloat(match[2], 64)
+		sorted := append([]time.Duration{}, durations...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		return percentile(sorted, p/100), true
+	}
+	switch a.metric {
+	case "latency-min", "latency-mean", "latency-max":
+		return durationStat(a.metric, summary.Latency), len(batchLatencies) > 0
+	case "propagation-min", "propagation-mean", "propagation-max":
+		if summary.Propagation == nil {
+			return 0, false
+		}
+		return durationStat(a.metric, *summary.Propagation), true
+	case "resolvable-min", "resolvable-mean", "resolvable-max":
+		if summary.Resolvable == nil {
+			return 0, false
+		}
+		return durationStat(a.metric, *summary.Resolvable), true
+	case "duration":
+		return summary.DurationSeconds * 1000, true
+	case "throttles":
+		return float64(summary.ErrorClasses[errorClassThrottling].Count), true
+	case "errors":
+		return float64(summary.Errors), true
+	case "error-rate":
+		return errorRate(summary), true
+	case "throughput":
+		return throughput(summary), true
+	case "unresolved":
+		if summary.Resolution == nil {
+			return 0, false
+		}
+		return float64(summary.Resolution.Mismatched + summary.Resolution.Unresolved), true
+	case "stale":
+		if summary.Stale == nil {
+			return 0, false
+		}
+		return float64(summary.Stale.Stale + summary.Stale.Missing), true
+	}
+	return 0, false
+}
+
+func durationStat(metric string, stats latencyStats) float64 {
+	switch {
+	case strings.HasSuffix(metric, "-min"):
+		return stats.Min
+	case strings.HasSuffix(metric, "-max"):
+		return stats.Max
+	default:
+		return stats.Mean
+	}
+}
+
+func (a assertion) holds(actual float64) bool {
+	switch a.operator {
+	case "<":
+		return actual < a.value
+	case "<=":
+		return actual <= a.value
+	case "==":
+		return actual == a.value
+	case "!=":
+		return actual != a.value
+	case ">=":
+		return actual >= a.value
+	case ">":
+		return actual > a.value
+	}
+	return false
+}
+
+func (a assertion) format(actual float64) string {
+	if a.duration {
+		return time.Duration(actual * float64(time.Millisecond)).Round(time.Millisecond).String()
+	}
+	return strconv.FormatFloat(math.Round(actual*100)/100, 'f', -1, 64)
+}
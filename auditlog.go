@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// auditRecord is a line of the audit log
+type auditRecord struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	// ParamsSHA256 identifies the request parameters without logging every record set in a batch
+	ParamsSHA256 string  `json:"paramsSha256"`
+	RequestID    string  `json:"requestId,omitempty"`
+	Status       int     `json:"status,omitempty"`
+	LatencyMs    float64 `json:"latencyMs"`
+	Attempts     int     `json:"attempts,omitempty"`
+	ErrorCode    string  `json:"errorCode,omitempty"`
+	Error        string  `json:"error,omitempty"`
+}
+
+// AuditLog writes a JSON line per Route 53 API call, including its request ID, HTTP status, and retries, for
+// post-incident review and support cases. A nil AuditLog is a no-op.
+type AuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewAuditLog creates the audit log at path, truncating it if it already exists
+func NewAuditLog(path string) (*AuditLog, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create audit log: %w", err)
+	}
+	return &AuditLog{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+// route53Option adds the audit middleware to the Route 53 client
+func (a *AuditLog) route53Option(o *route53.Options) {
+	if a == nil {
+		return
+	}
+	o.APIOptions = append(o.APIOptions, a.middleware)
+}
+
+// middleware records every API call once it finished, after all of its retries
+func (a *AuditLog) middleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("FloodzoneAuditLog", func(ctx context.Context, in middleware.InitializeInput,
+		next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		start := time.Now()
+		out, metadata, err := next.HandleInitialize(ctx, in)
+		record := auditRecord{
+			Time:         start.UTC(),
+			Operation:    awsmiddleware.GetOperationName(ctx),
+			ParamsSHA256: paramsDigest(in.Parameters),
+			LatencyMs:    milliseconds(time.Since(start)),
+		}
+		record.RequestID, _ = awsmiddleware.GetRequestIDMetadata(metadata)
+		if resp, ok := awsmiddleware.GetRawResponse(metadata).(*smithyhttp.Response); ok {
+			record.Status = resp.StatusCode
+		}
+		if results, ok := retry.GetAttemptResults(metadata); ok {
+			record.Attempts = len(results.Results)
+		}
+		if err != nil {
+			record.Error = err.Error()
+			var apiErr smithy.APIError
+			if errors.As(err, &apiErr) {
+				record.ErrorCode = apiErr.ErrorCode()
+			}
+			var respErr interface{ HTTPStatusCode() int }
+			if errors.As(err, &respErr) {
+				record.Status = respErr.HTTPStatusCode()
+			}
+		}
+		a.write(record)
+		return out, metadata, err
+	}), middleware.After)
+}
+
+func paramsDigest(params any) string {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (a *AuditLog) write(record auditRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.enc.Encode(record); err != nil {
+		slog.Warn("unable to write audit log", "file", a.file.Name(), "error", err)
+	}
+}
+
+// Close closes the audit log file
+func (a *AuditLog) Close(_ context.Context) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.file.Close(); err != nil {
+		slog.Warn("unable to close audit log", "file", a.file.Name(), "error", err)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// maxAppIDLength is the longest app ID the SDK accepts in the User-Agent
+const maxAppIDLength = 50
+
+// loadAWSConfig loads the shared AWS config with the profile, region, endpoint, and HTTP client settings from the flags
+func loadAWSConfig(ctx context.Context, opts Options, global globalFlags) (aws.Config, error) {
+	var loadOpts []func(*config.LoadOptions) error
+	if global.profile != "" {
+		loadOpts = append(loadOpts, config.WithSharedConfigProfile(global.profile))
+	}
+	if global.region != "" {
+		loadOpts = append(loadOpts, config.WithRegion(global.region))
+	}
+	// FIPS and dual-stack are left unset rather than disabled when the flags aren't passed, so that they can still be
+	// enabled in the shared config or with AWS_USE_FIPS_ENDPOINT and AWS_USE_DUALSTACK_ENDPOINT
+	if opts.UseFIPS {
+		loadOpts = append(loadOpts, config.WithUseFIPSEndpoint(aws.FIPSEndpointStateEnabled))
+	}
+	if opts.UseDualStack {
+		loadOpts = append(loadOpts, config.WithUseDualStackEndpoint(aws.DualStackEndpointStateEnabled))
+	}
+	if opts.AppID != "" {
+		if len(opts.AppID) > maxAppIDLength {
+			return aws.Config{}, fmt.Errorf("--app-id must be at most %d characters", maxAppIDLength)
+		}
+		loadOpts = append(loadOpts, config.WithAppID(opts.AppID))
+	}
+	if opts.LocalStack {
+		if provider := localStackCredentials(global); provider != nil {
+			loadOpts = append(loadOpts, config.WithCredentialsProvider(provider))
+		}
+	}
+	httpClient, err := newHTTPClient(opts)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	loadOpts = append(loadOpts, config.WithHTTPClient(httpClient))
+	cfg, err := config.LoadDefaultConfig(ctx, loadOpts...)
+	if err != nil {
+		return cfg, err
+	}
+	// every AWS client calls LocalStack, not only Route 53
+	if opts.LocalStack {
+		cfg.BaseEndpoint = aws.String(opts.Endpoint)
+		if cfg.Region == "" {
+			cfg.Region = localStackRegion
+		}
+	}
+	// the run ID in the User-Agent attributes the burst of calls in CloudTrail to a single run
+	cfg.APIOptions = append(cfg.APIOptions, awsmiddleware.AddUserAgentKeyValue("floodzone-run", opts.RunID))
+	return cfg, nil
+}
+
+// newHTTPClient builds the HTTP client used by every AWS client. Zero values keep the SDK defaults.
+func newHTTPClient(opts Options) (*awshttp.BuildableClient, error) {
+	if opts.HTTPTimeout < 0 || opts.MaxIdleConns < 0 {
+		return nil, fmt.Errorf("--http-timeout and --max-idle-conns must not be negative")
+	}
+	client := awshttp.NewBuildableClient()
+	if opts.HTTPTimeout != 0 {
+		client = client.WithTimeout(opts.HTTPTimeout)
+	}
+	var proxyURL *url.URL
+	if opts.ProxyURL != "" {
+		u, err := url.Parse(opts.ProxyURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q, expected e.g. http://proxy.example.com:3128", opts.ProxyURL)
+		}
+		proxyURL = u
+	}
+	return client.WithTransportOptions(func(tr *http.Transport) {
+		if proxyURL != nil {
+			tr.Proxy = http.ProxyURL(proxyURL)
+		}
+		if opts.MaxIdleConns != 0 {
+			tr.MaxIdleConns = opts.MaxIdleConns
+			// every call goes to the same Route 53 endpoint, so the per host limit is what actually limits reuse
+			tr.MaxIdleConnsPerHost = opts.MaxIdleConns
+		}
+		// LocalStack's certificate is only valid for localhost.localstack.cloud, not e.g. the host name of its container
+		if opts.LocalStack {
+			if tr.TLSClientConfig == nil {
+				tr.TLSClientConfig = &tls.Config{}
+			}
+			tr.TLSClientConfig.InsecureSkipVerify = true
+		}
+	}), nil
+}
+
+// route53Options applies the Route 53 specific flags to the Route 53 client only, so that e.g. --endpoint isn't used
+// for STS or EC2 unless it's LocalStack
+func route53Options(opts Options) func(*route53.Options) {
+	return func(o *route53.Options) {
+		if opts.Endpoint != "" {
+			o.BaseEndpoint = aws.String(opts.Endpoint)
+		}
+	}
+}
+
+// s3Options applies the flags to the S3 client. LocalStack serves buckets on the path of its endpoint, since the
+// virtual host names of buckets don't resolve to it.
+func s3Options(opts Options) func(*s3.Options) {
+	return func(o *s3.Options) {
+		if opts.LocalStack {
+			o.UsePathStyle = true
+		}
+	}
+}
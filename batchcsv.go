@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// batchCSVHeader is the first row of the batch CSV
+var batchCSVHeader = []string{"timestamp", "zone", "batch_size", "action", "latency_ms", "change_id", "status", "error"}
+
+// BatchCSV writes a row per change batch to a CSV file for offline analysis. A nil BatchCSV is a no-op.
+type BatchCSV struct {
+	mu   sync.Mutex
+	file *os.File
+	w    *csv.Writer
+}
+
+// NewBatchCSV creates the CSV file at path, truncating it if it already exists, and writes the header
+func NewBatchCSV(path string) (*BatchCSV, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create batch CSV: %w", err)
+	}
+	b := &BatchCSV{file: file, w: csv.NewWriter(file)}
+	if err := b.w.Write(batchCSVHeader); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("unable to write batch CSV header: %w", err)
+	}
+	return b, nil
+}
+
+// RecordBatch writes a row for a change batch that started at start. The change ID and status come from the response
+// of a successful batch, failed batches have a status of ERROR and the error message instead.
+func (b *BatchCSV) RecordBatch(start time.Time, hostedZoneID string, changes []types.Change, latency time.Duration, out *route53.ChangeResourceRecordSetsOutput, err error) {
+	if b == nil {
+		return
+	}
+	action := ""
+	if len(changes) > 0 {
+		action = string(changes[0].Action)
+	}
+	var changeID, status, errMsg string
+	if err != nil {
+		status, errMsg = "ERROR", err.Error()
+	} else if out != nil && out.ChangeInfo != nil {
+		changeID, status = aws.ToString(out.ChangeInfo.Id), string(out.ChangeInfo.Status)
+	}
+	row := []string{
+		start.UTC().Format(time.RFC3339Nano),
+		hostedZoneID,
+		strconv.Itoa(len(changes)),
+		action,
+		strconv.FormatFloat(milliseconds(latency), 'f', 3, 64),
+		changeID,
+		status,
+		errMsg,
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.w.Write(row); err != nil {
+		slog.Warn("unable to write batch CSV row", "file", b.file.Name(), "error", err)
+	}
+	// flush every row so the file is usable while the run is still going and survives a crash
+	b.w.Flush()
+}
+
+// Close flushes and closes the CSV file
+func (b *BatchCSV) Close(_ context.Context) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.w.Flush()
+	if err := b.w.Error(); err != nil {
+		slog.Warn("unable to write batch CSV", "file", b.file.Name(), "error", err)
+	}
+	if err := b.file.Close(); err != nil {
+		slog.Warn("unable to close batch CSV", "file", b.file.Name(), "error", err)
+	}
+}
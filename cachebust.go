@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/google/uuid"
+)
+
+const (
+	// cacheBustNXDomain queries random names under the record sets, which don't exist
+	cacheBustNXDomain = "nxdomain"
+	// cacheBustWildcard queries random names under the wildcard record sets, which are answered with their values
+	cacheBustWildcard = "wildcard"
+	// cacheBustValue is the value of the wildcard record set created for --cache-bust-mode wildcard, from TEST-NET-1
+	cacheBustValue = "192.0.2.1"
+	// cacheBustTimeout is how long the created wildcard record set has to be INSYNC
+	cacheBustTimeout = 5 * time.Minute
+)
+
+// wildcardPrefixes are how wildcard names are written, Route 53 lists them with the * escaped
+var wildcardPrefixes = []string{`\052.`, "*."}
+
+// wildcardTargets returns the domains of the wildcard record sets among the targets, with the wildcard label removed
+func wildcardTargets(targets []queryTarget) []queryTarget {
+	var wildcards []queryTarget
+	for _, target := range targets {
+		if domain, ok := wildcardDomain(target.name); ok {
+			wildcards = append(wildcards, queryTarget{name: domain, rrType: target.rrType})
+		}
+	}
+	return wildcards
+}
+
+// queriedWildcards returns the targets with the wildcard names replaced by a name under them, since a query for the
+// wildcard name itself isn't what clients send. The name is the same for every query so that it can be cached.
+func queriedWildcards(targets []queryTarget) []queryTarget {
+	queried := make([]queryTarget, 0, len(targets))
+	for _, target := range targets {
+		if domain, ok := wildcardDomain(target.name); ok {
+			target.name = "floodzone-wildcard." + domain
+		}
+		queried = append(queried, target)
+	}
+	return queried
+}
+
+// wildcardDomain returns the domain of a wildcard name, ok is false if the name isn't a wildcard
+func wildcardDomain(name string) (string, bool) {
+	for _, prefix := range wildcardPrefixes {
+		if domain, ok := strings.CutPrefix(name, prefix); ok {
+			return domain, true
+		}
+	}
+	return "", false
+}
+
+// cacheBustTarget returns a name no resolver has seen before, so that its query has to be answered by Route 53: a
+// random label under the target for nxdomain, or under one of the wildcards for wildcard
+func cacheBustTarget(target queryTarget, mode string, wildcards []queryTarget) queryTarget {
+	if mode == cacheBustWildcard {
+		target = wildcards[rand.Intn(len(wildcards))]
+	}
+	return queryTarget{name: fmt.Sprintf("floodzone-bust-%s.%s", uuid.NewString(), target.name), rrType: target.rrType}
+}
+
+// CreateCacheBustWildcard creates an A wildcard record set under the zone for --cache-bust-mode wildcard to query random
+// names under, and waits until it's INSYNC. The record set is returned also when waiting failed, so that it can be
+// deleted.
+func (z Zone) CreateCacheBustWildcard(ctx context.Context, hostedZoneID string, runID string) (*types.ResourceRecordSet, error) {
+	// the wildcard of a run is found by its run ID, so that concurrent runs don't share one
+	if runID == "" {
+		return nil, errors.New("the cache busting wildcard record set needs the ID of the run")
+	}
+	hz, err := z.R53.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: &hostedZoneID})
+	if err != nil {
+		return nil, fmt.Errorf("unable to describe hosted zone: %w", err)
+	}
+	// a DNS label is at most 63 characters
+	label := "floodzone-cache-bust-" + runID
+	rr := &types.ResourceRecordSet{
+		Name:            aws.String(fmt.Sprintf("*.%s.%s", label[:min(len(label), 63)], aws.ToString(hz.HostedZone.Name))),
+		Type:            types.RRTypeA,
+		TTL:             aws.Int64(60),
+		ResourceRecords: []types.ResourceRecord{{Value: aws.String(cacheBustValue)}},
+	}
+	out, err := z.R53.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: &hostedZoneID,
+		ChangeBatch:  &types.ChangeBatch{Changes: []types.Change{{Action: types.ChangeActionCreate, ResourceRecordSet: rr}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the cache busting wildcard record set: %w", err)
+	}
+	slog.Info("⏳ Waiting for the cache busting wildcard record set to be INSYNC", "name", aws.ToString(rr.Name))
+	waiter := route53.NewResourceRecordSetsChangedWaiter(z.R53)
+	if err := waiter.Wait(ctx, &route53.GetChangeInput{Id: out.ChangeInfo.Id}, cacheBustTimeout); err != nil {
+		return rr, fmt.Errorf("the cache busting wildcard record set wasn't INSYNC: %w", err)
+	}
+	return rr, nil
+}
+
+// DeleteCacheBustWildcard deletes the wildcard record set created by CreateCacheBustWildcard
+func (z Zone) DeleteCacheBustWildcard(ctx context.Context, hostedZoneID string, rr *types.ResourceRecordSet) error {
+	_, err := z.R53.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: &hostedZoneID,
+		ChangeBatch:  &types.ChangeBatch{Changes: []types.Change{{Action: types.ChangeActionDelete, ResourceRecordSet: rr}}},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to delete the cache busting wildcard record set: %w", err)
+	}
+	slog.Info("✅ Successfully deleted the cache busting wildcard record set", "name", aws.ToString(rr.Name))
+	return nil
+}
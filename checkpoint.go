@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwagner5/floodzone/pkg/floodzone"
+)
+
+// checkpointInterval is how often the checkpoint is written while the run goes on
+const checkpointInterval = 5 * time.Second
+
+// runCheckpoint is how far a run got, so that a run restarted with the same --checkpoint resumes it
+type runCheckpoint struct {
+	RunID   string `json:"runId"`
+	Command string `json:"command"`
+	// HostedZoneID is the zone the run changes, including one it created
+	HostedZoneID string `json:"hostedZoneId,omitempty"`
+	// Records is how many record sets a flood filled the zone up to, Deleted how many record sets a delete deleted, and
+	// Iterations how many iterations a churn finished
+	Records    int       `json:"records,omitempty"`
+	Deleted    int       `json:"deleted,omitempty"`
+	Iterations int       `json:"iterations,omitempty"`
+	Completed  bool      `json:"completed"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// Checkpoint keeps the progress of a flood, churn, or delete at a local path or s3:// URI while the run goes on, so
+// that a run on an ephemeral container that's restarted with the same checkpoint resumes where it stopped instead of
+// creating another zone or changing more record sets than asked for. A nil Checkpoint is a no-op.
+type Checkpoint struct {
+	mu        sync.Mutex
+	artifacts *Artifacts
+	dest      string
+	state     runCheckpoint
+	// resumed is the checkpoint of the previous run, and deleted and iterations what it had done before this run
+	resumed    *runCheckpoint
+	deleted    int
+	iterations int
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// LoadCheckpoint returns the Checkpoint at dest, resuming the checkpoint already there if it's of the same command
+func LoadCheckpoint(ctx context.Context, artifacts *Artifacts, dest string, command string, runID string) (*Checkpoint, error) {
+	c := &Checkpoint{artifacts: artifacts, dest: dest, state: runCheckpoint{RunID: runID, Command: command}}
+	data, err := artifacts.Read(ctx, dest)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("unable to read the checkpoint: %w", err)
+	default:
+		var previous runCheckpoint
+		if err := json.Unmarshal(data, &previous); err != nil {
+			return nil, fmt.Errorf("unable to parse the checkpoint %s: %w", dest, err)
+		}
+		if previous.Command != command {
+			return nil, fmt.Errorf("the checkpoint %s is of a %s run, not %s", dest, previous.Command, command)
+		}
+		c.resumed = &previous
+		c.state.HostedZoneID, c.state.Records, c.state.Completed = previous.HostedZoneID, previous.Records, previous.Completed
+		c.state.Deleted, c.state.Iterations = previous.Deleted, previous.Iterations
+		c.deleted, c.iterations = previous.Deleted, previous.Iterations
+	}
+	c.stop, c.done = make(chan struct{}), make(chan struct{})
+	go c.writeEvery(checkpointInterval)
+	return c, nil
+}
+
+// Resume returns the options that continue the run of the checkpoint, and whether it had already completed
+func (c *Checkpoint) Resume(opts Options) (Options, bool) {
+	if c == nil || c.resumed == nil {
+		return opts, false
+	}
+	previous := c.resumed
+	if previous.Completed {
+		slog.Info("✅ The checkpoint's run already completed, there's nothing to resume", "checkpoint", c.dest, "runId", previous.RunID)
+		return opts, true
+	}
+	if opts.HostedZoneID == "" {
+		opts.HostedZoneID = previous.HostedZoneID
+	}
+	switch previous.Command {
+	case "delete":
+		opts.TotalRecords = max(opts.TotalRecords-previous.Deleted, 0)
+	case "churn":
+		opts.Iterations = max(opts.Iterations-previous.Iterations, 0)
+	}
+	slog.Info("🔁 Resuming the run of the checkpoint", "checkpoint", c.dest, "runId", previous.RunID, "zone", opts.HostedZoneID,
+		"records", previous.Records, "deleted", previous.Deleted, "iterations", previous.Iterations)
+	return opts, false
+}
+
+// Resumed returns whether the run resumes the run of a checkpoint
+func (c *Checkpoint) Resumed() bool {
+	return c != nil && c.resumed != nil
+}
+
+// RecordZone records the zone of the run and writes the checkpoint right away, so that a zone the run created isn't
+// created again when it's resumed
+func (c *Checkpoint) RecordZone(ctx context.Context, hostedZoneID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.state.HostedZoneID = strings.TrimPrefix(hostedZoneID, "/hostedzone/")
+	c.mu.Unlock()
+	if err := c.write(ctx); err != nil {
+		slog.Warn("unable to write the checkpoint", "dest", c.dest, "error", err)
+	}
+}
+
+// Batched records the progress of a successful batch
+func (c *Checkpoint) Batched(batch floodzone.Batch) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state.HostedZoneID = strings.TrimPrefix(batch.HostedZoneID, "/hostedzone/")
+	switch batch.Action {
+	case "Create":
+		c.state.Records = batch.Done
+	case "Delete":
+		c.state.Deleted = c.deleted + batch.Done
+	case "Upsert":
+		done := batch.Iteration - 1
+		if batch.Done == batch.Total {
+			done++
+		}
+		c.state.Iterations = c.iterations + done
+	}
+}
+
+// Complete records that the run completed, so that it isn't resumed
+func (c *Checkpoint) Complete() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state.Completed = true
+}
+
+// writeEvery writes the checkpoint every interval until the checkpoint is closed
+func (c *Checkpoint) writeEvery(interval time.Duration) {
+	defer close(c.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			if err := c.write(context.Background()); err != nil {
+				slog.Warn("unable to write the checkpoint", "dest", c.dest, "error", err)
+			}
+		}
+	}
+}
+
+// Close writes the checkpoint. Failures are only logged so that a failed run still reports its own error.
+func (c *Checkpoint) Close(ctx context.Context) {
+	if c == nil {
+		return
+	}
+	close(c.stop)
+	<-c.done
+	if err := c.write(ctx); err != nil {
+		slog.Error("unable to write the checkpoint", "dest", c.dest, "error", err)
+	}
+}
+
+func (c *Checkpoint) write(ctx context.Context) error {
+	c.mu.Lock()
+	c.state.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(c.state, "", "    ")
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("unable to marshal the checkpoint: %w", err)
+	}
+	return c.artifacts.Write(ctx, c.dest, append(data, '\n'), "application/json")
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/google/uuid"
+)
+
+const (
+	// cidrCollectionPrefix prefixes the name of every CIDR collection floodzone creates, which is how they're found to be
+	// deleted
+	cidrCollectionPrefix = "floodzone-"
+	// defaultCidrCollectionRate is how many CIDR collections are created or changed per second by default, the Route 53
+	// API rate limit of an account
+	defaultCidrCollectionRate = 5
+	// maxCidrCollectionChanges is the most locations a ChangeCidrCollection call can change, and the most CIDR blocks a
+	// location can be changed with at once
+	maxCidrCollectionChanges = 1000
+	// maxCidrBlocks is how many distinct /24 blocks floodzone generates for the locations of a collection
+	maxCidrBlocks = 1 << 16
+	// maxCidrVersionAttempts is how many times a change is tried with the current version of its collection before
+	// giving up, when --collection-version makes concurrent changes conflict
+	maxCidrVersionAttempts = 20
+)
+
+// cidrCollectionsResult is the output of the cidr-collections command
+type cidrCollectionsResult struct {
+	Action      string `json:"action" yaml:"action"`
+	Collections int    `json:"collections" yaml:"collections"`
+	Locations   int    `json:"locations" yaml:"locations"`
+	Blocks      int    `json:"blocks" yaml:"blocks"`
+	// Changes is how many ChangeCidrCollection calls succeeded, every one of them a new version of its collection
+	Changes int `json:"changes" yaml:"changes"`
+	// Mismatches is how many changes Route 53 rejected since the version of their collection had changed, which were
+	// retried with the current version
+	Mismatches int `json:"mismatches" yaml:"mismatches"`
+	// InUse is how many collections couldn't be deleted since record sets still refer to them
+	InUse int `json:"inUse,omitempty" yaml:"inUse,omitempty"`
+	// Throttled is how many attempts Route 53 throttled, which the SDK retried
+	Throttled int           `json:"throttled" yaml:"throttled"`
+	Duration  time.Duration `json:"duration" yaml:"duration"`
+	Rate      float64       `json:"rate" yaml:"rate"`
+}
+
+func (r cidrCollectionsResult) writeTable(w io.Writer) {
+	fmt.Fprintln(w, "ACTION\tCOLLECTIONS\tLOCATIONS\tBLOCKS\tCHANGES\tMISMATCHES\tIN USE\tTHROTTLED\tDURATION\tPER SECOND")
+	fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t%.2f\n", r.Action, r.Collections, r.Locations, r.Blocks, r.Changes, r.Mismatches, r.InUse, r.Throttled,
+		r.Duration.Round(time.Millisecond), r.Rate)
+}
+
+// cidrCollection is a collection being filled, with the version its next change is expected to find
+type cidrCollection struct {
+	id      string
+	version atomic.Int64
+}
+
+// runCidrCollections creates CIDR collections and fills them with --locations locations of --blocks-per-location CIDR
+// blocks each at a controlled rate, without any record set referring to them, to test the CIDR collection quotas of the
+// account and how changes to a collection conflict. With --delete, it empties and deletes the CIDR collections floodzone
+// created instead.
+func runCidrCollections(ctx context.Context, zone Zone, opts Options) error {
+	var throttles throttleCounter
+	throttled := func(o *route53.Options) { o.APIOptions = append(o.APIOptions, throttles.middleware) }
+	start := time.Now()
+	if opts.Delete {
+		result, err := zone.DeleteCidrCollections(ctx, cidrCollectionPrefix, opts.CreateRate, opts.CidrLocationsPerChange, throttled)
+		if err != nil {
+			return err
+		}
+		if result.InUse != 0 {
+			slog.Warn("some CIDR collections are still referred to by record sets, delete the record sets first", "inUse", result.InUse)
+		}
+		result.Action, result.Throttled = "deleted", throttles.Count()
+		return printOutput(opts.Output, newCidrCollectionsResult(result, start))
+	}
+	prefix := cidrCollectionPrefix + strings.Split(uuid.NewString(), "-")[0]
+	collections := make([]*cidrCollection, opts.CidrCollections)
+	slog.Info("🗺️ Creating CIDR collections", "collections", opts.CidrCollections, "locations", opts.CidrLocations, "blocksPerLocation", opts.CidrBlocksPerLocation, "rate", opts.CreateRate)
+	err := paceCalls(ctx, opts.CidrCollections, opts.CreateRate, func(ctx context.Context, i int) error {
+		out, err := zone.R53.CreateCidrCollection(ctx, &route53.CreateCidrCollectionInput{
+			Name:            aws.String(fmt.Sprintf("%s-%d", prefix, i)),
+			CallerReference: aws.String(fmt.Sprintf("%s-%d", prefix, i)),
+		}, throttled)
+		if err != nil {
+			return fmt.Errorf("unable to create CIDR collection %d: %w", i, err)
+		}
+		collections[i] = &cidrCollection{id: *out.Collection.Id}
+		collections[i].version.Store(aws.ToInt64(out.Collection.Version))
+		return nil
+	})
+	result := cidrCollectionsResult{Action: "created"}
+	for _, collection := range collections {
+		if collection != nil {
+			result.Collections++
+		}
+	}
+	if err != nil {
+		if result.Collections != 0 {
+			slog.Error("some CIDR collections were created before the run failed, delete them with cidr-collections --delete", "collections", result.Collections)
+		}
+		return err
+	}
+	// every call changes the next locations of a collection, taking turns between the collections
+	batches := (opts.CidrLocations + opts.CidrLocationsPerChange - 1) / opts.CidrLocationsPerChange
+	var changes, mismatches, locations atomic.Int64
+	err = paceCalls(ctx, batches*len(collections), opts.CreateRate, func(ctx context.Context, i int) error {
+		collection, batch := collections[i%len(collections)], i/len(collections)
+		input := &route53.ChangeCidrCollectionInput{Id: &collection.id}
+		for location := batch * opts.CidrLocationsPerChange; location < min((batch+1)*opts.CidrLocationsPerChange, opts.CidrLocations); location++ {
+			input.Changes = append(input.Changes, types.CidrCollectionChange{
+				Action:       types.CidrCollectionChangeActionPut,
+				LocationName: aws.String(cidrLocationName(location)),
+				CidrList:     cidrBlocks(location, opts.CidrBlocksPerLocation),
+			})
+		}
+		for attempt := 1; ; attempt++ {
+			version := collection.version.Load()
+			if opts.CidrCollectionVersion {
+				input.CollectionVersion = aws.Int64(version)
+			}
+			_, err := zone.R53.ChangeCidrCollection(ctx, input, throttled)
+			var mismatch *types.CidrCollectionVersionMismatchException
+			if errors.As(err, &mismatch) && attempt < maxCidrVersionAttempts {
+				// another change got the version first, so try again with the version it made, after a random wait that
+				// grows with every attempt so that the changes that conflicted don't conflict again
+				mismatches.Add(1)
+				if err := sleep(ctx, time.Duration(rand.Int63n(int64(attempt)*int64(float64(time.Second)/opts.CreateRate)))); err != nil {
+					return err
+				}
+				current, err := zone.cidrCollectionVersion(ctx, collection.id, throttled)
+				if err != nil {
+					return err
+				}
+				collection.version.Store(current)
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("unable to change CIDR collection %s: %w", collection.id, err)
+			}
+			collection.version.CompareAndSwap(version, version+1)
+			changes.Add(1)
+			locations.Add(int64(len(input.Changes)))
+			return nil
+		}
+	})
+	result.Changes, result.Mismatches, result.Locations = int(changes.Load()), int(mismatches.Load()), int(locations.Load())
+	result.Blocks = result.Locations * opts.CidrBlocksPerLocation
+	if err != nil {
+		slog.Error("some CIDR collections were created before the run failed, delete them with cidr-collections --delete", "collections", result.Collections, "locations", result.Locations)
+		return err
+	}
+	slog.Info("✅ Successfully filled the CIDR collections", "collections", result.Collections, "locations", result.Locations, "blocks", result.Blocks, "mismatches", result.Mismatches)
+	result.Throttled = throttles.Count()
+	return printOutput(opts.Output, newCidrCollectionsResult(result, start))
+}
+
+// newCidrCollectionsResult returns the result with its duration and rate of changes since start
+func newCidrCollectionsResult(result cidrCollectionsResult, start time.Time) cidrCollectionsResult {
+	result.Duration = time.Since(start)
+	if seconds := result.Duration.Seconds(); seconds > 0 {
+		result.Rate = float64(result.Changes) / seconds
+	}
+	return result
+}
+
+// cidrLocationName returns the name of location i of every collection, within the 16 characters Route 53 allows
+func cidrLocationName(i int) string {
+	return fmt.Sprintf("loc-%d", i)
+}
+
+// cidrBlocks returns the CIDR blocks of location i, /24 blocks of 10.0.0.0/8 that no other location of the collection has
+func cidrBlocks(location int, blocksPerLocation int) []string {
+	blocks := make([]string, blocksPerLocation)
+	for j := range blocks {
+		k := location*blocksPerLocation + j
+		blocks[j] = fmt.Sprintf("10.%d.%d.0/24", k/256, k%256)
+	}
+	return blocks
+}
+
+// DeleteCidrCollections empties the CIDR collections whose name starts with the prefix, changing up to
+// locationsPerChange locations at rate calls per second, and deletes them. The result has how many collections,
+// locations, and CIDR blocks it deleted and how many collections it couldn't since record sets still refer to them.
+func (z Zone) DeleteCidrCollections(ctx context.Context, prefix string, rate float64, locationsPerChange int, optFns ...func(*route53.Options)) (cidrCollectionsResult, error) {
+	var result cidrCollectionsResult
+	collections, err := z.cidrCollections(ctx, prefix, optFns...)
+	if err != nil || len(collections) == 0 {
+		return result, err
+	}
+	slog.Info("🧹 Deleting CIDR collections", "collections", len(collections))
+	for _, collection := range collections {
+		blocks, err := z.cidrBlocks(ctx, *collection.Id, optFns...)
+		if err != nil {
+			return result, err
+		}
+		// a location is deleted once its last CIDR block is
+		byLocation := map[string][]string{}
+		var names []string
+		for _, block := range blocks {
+			name := aws.ToString(block.LocationName)
+			if _, ok := byLocation[name]; !ok {
+				names = append(names, name)
+			}
+			byLocation[name] = append(byLocation[name], aws.ToString(block.CidrBlock))
+		}
+		batches := chunks(names, locationsPerChange)
+		var changes atomic.Int64
+		err = paceCalls(ctx, len(batches), rate, func(ctx context.Context, i int) error {
+			input := &route53.ChangeCidrCollectionInput{Id: collection.Id}
+			for _, name := range batches[i] {
+				for _, cidrs := range chunks(byLocation[name], maxCidrCollectionChanges) {
+					input.Changes = append(input.Changes, types.CidrCollectionChange{
+						Action:       types.CidrCollectionChangeActionDeleteIfExists,
+						LocationName: aws.String(name),
+						CidrList:     cidrs,
+					})
+				}
+			}
+			if _, err := z.R53.ChangeCidrCollection(ctx, input, optFns...); err != nil {
+				return fmt.Errorf("unable to delete the locations of CIDR collection %s: %w", *collection.Id, err)
+			}
+			changes.Add(1)
+			return nil
+		})
+		result.Changes += int(changes.Load())
+		if err != nil {
+			return result, err
+		}
+		result.Locations += len(names)
+		result.Blocks += len(blocks)
+		_, err = z.R53.DeleteCidrCollection(ctx, &route53.DeleteCidrCollectionInput{Id: collection.Id}, optFns...)
+		var inUse *types.CidrCollectionInUseException
+		switch {
+		case errors.As(err, &inUse):
+			result.InUse++
+		case err != nil:
+			return result, fmt.Errorf("unable to delete CIDR collection %s: %w", *collection.Id, err)
+		default:
+			result.Collections++
+		}
+	}
+	slog.Info("✅ Successfully deleted the CIDR collections", "collections", result.Collections, "locations", result.Locations, "blocks", result.Blocks)
+	return result, nil
+}
+
+// cidrCollections returns the CIDR collections whose name starts with the prefix
+func (z Zone) cidrCollections(ctx context.Context, prefix string, optFns ...func(*route53.Options)) ([]types.CollectionSummary, error) {
+	var collections []types.CollectionSummary
+	input := &route53.ListCidrCollectionsInput{}
+	for {
+		out, err := z.R53.ListCidrCollections(ctx, input, optFns...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list CIDR collections: %w", err)
+		}
+		for _, collection := range out.CidrCollections {
+			if strings.HasPrefix(aws.ToString(collection.Name), prefix) {
+				collections = append(collections, collection)
+			}
+		}
+		if out.NextToken == nil {
+			return collections, nil
+		}
+		input.NextToken = out.NextToken
+	}
+}
+
+// cidrCollectionVersion returns the current version of a CIDR collection, which only listing the collections returns
+func (z Zone) cidrCollectionVersion(ctx context.Context, id string, optFns ...func(*route53.Options)) (int64, error) {
+	collections, err := z.cidrCollections(ctx, cidrCollectionPrefix, optFns...)
+	if err != nil {
+		return 0, err
+	}
+	for _, collection := range collections {
+		if aws.ToString(collection.Id) == id {
+			return aws.ToInt64(collection.Version), nil
+		}
+	}
+	return 0, fmt.Errorf("CIDR collection %s doesn't exist anymore", id)
+}
+
+// cidrBlocks returns every CIDR block of the locations of a CIDR collection
+func (z Zone) cidrBlocks(ctx context.Context, id string, optFns ...func(*route53.Options)) ([]types.CidrBlockSummary, error) {
+	var blocks []types.CidrBlockSummary
+	input := &route53.ListCidrBlocksInput{CollectionId: &id}
+	for {
+		out, err := z.R53.ListCidrBlocks(ctx, input, optFns...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list the CIDR blocks of CIDR collection %s: %w", id, err)
+		}
+		blocks = append(blocks, out.CidrBlocks...)
+		if out.NextToken == nil {
+			return blocks, nil
+		}
+		input.NextToken = out.NextToken
+	}
+}
+
+// validateCidrCollections validates the flags of the cidr-collections command
+func validateCidrCollections(opts Options) error {
+	var errs []error
+	if opts.CreateRate <= 0 {
+		errs = append(errs, errors.New("--create-rate must be greater than 0"))
+	}
+	if opts.CidrLocationsPerChange <= 0 || opts.CidrLocationsPerChange > maxCidrCollectionChanges {
+		errs = append(errs, fmt.Errorf("--locations-per-change must be between 1 and %d", maxCidrCollectionChanges))
+	}
+	if opts.Delete {
+		return errors.Join(errs...)
+	}
+	if opts.CidrCollections <= 0 {
+		errs = append(errs, errors.New("--collections must be greater than 0"))
+	}
+	if opts.CidrLocations <= 0 {
+		errs = append(errs, errors.New("--locations must be greater than 0"))
+	}
+	if opts.CidrBlocksPerLocation <= 0 || opts.CidrBlocksPerLocation > maxCidrCollectionChanges {
+		errs = append(errs, fmt.Errorf("--blocks-per-location must be between 1 and %d", maxCidrCollectionChanges))
+	}
+	if opts.CidrLocations*opts.CidrBlocksPerLocation > maxCidrBlocks {
+		errs = append(errs, fmt.Errorf("--locations and --blocks-per-location make %d CIDR blocks, floodzone generates at most %d", opts.CidrLocations*opts.CidrBlocksPerLocation, maxCidrBlocks))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/aws/aws-sdk-go-v2/service/servicediscovery"
+	sdtypes "github.com/aws/aws-sdk-go-v2/service/servicediscovery/types"
+	"github.com/google/uuid"
+)
+
+const (
+	// cloudMapServicePrincipal is the service principal of the hosted zones Cloud Map private DNS namespaces create
+	cloudMapServicePrincipal = "servicediscovery.amazonaws.com"
+	// cloudMapPollInterval is how often the operations of a namespace and the record set count of its zone are polled
+	cloudMapPollInterval = 5 * time.Second
+	// cloudMapTTL is the TTL of the record sets of the services
+	cloudMapTTL = 60
+	// defaultCloudMapRegisterRate is how many RegisterInstance calls are made per second by default, and how many
+	// DeregisterInstance calls cleanup makes per second
+	defaultCloudMapRegisterRate = 10
+)
+
+// cloudMapRecordTypes are the record types --dns-record-types can give the services, in the combinations Cloud Map allows
+// for instances with an IP address
+var cloudMapRecordTypes = []string{string(sdtypes.RecordTypeA), string(sdtypes.RecordTypeAaaa), string(sdtypes.RecordTypeSrv)}
+
+// cloudMapResult is the output of the cloud-map command
+type cloudMapResult struct {
+	Namespace string `json:"namespace" yaml:"namespace"`
+	Zone      string `json:"zone" yaml:"zone"`
+	Services  int    `json:"services" yaml:"services"`
+	Instances int    `json:"instances" yaml:"instances"`
+	// Throttled is how many RegisterInstance attempts Cloud Map throttled, which the SDK retried
+	Throttled int `json:"throttled" yaml:"throttled"`
+	// FailedOperations is how many registrations Cloud Map accepted but failed to apply to the zone
+	FailedOperations int `json:"failedOperations" yaml:"failedOperations"`
+	RecordSets       int `json:"recordSets" yaml:"recordSets"`
+	// RegisterDuration is how long the RegisterInstance calls took to be accepted, OperationsDuration until every
+	// registration succeeded, and RecordsDuration until the zone had the record sets of every instance, all from the first call
+	RegisterDuration   time.Duration `json:"registerDuration" yaml:"registerDuration"`
+	OperationsDuration time.Duration `json:"operationsDuration" yaml:"operationsDuration"`
+	RecordsDuration    time.Duration `json:"recordsDuration" yaml:"recordsDuration"`
+}
+
+func (r cloudMapResult) writeTable(w io.Writer) {
+	fmt.Fprintln(w, "NAMESPACE\tZONE\tSERVICES\tINSTANCES\tTHROTTLED\tFAILED\tRECORD SETS\tREGISTERED IN\tAPPLIED IN\tIN ZONE IN")
+	fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%s\t%s\t%s\n", r.Namespace, r.Zone, r.Services, r.Instances, r.Throttled, r.FailedOperations,
+		r.RecordSets, r.RegisterDuration.Round(time.Millisecond), r.OperationsDuration.Round(time.Millisecond), r.RecordsDuration.Round(time.Millisecond))
+}
+
+// runCloudMap floods a Cloud Map private DNS namespace with service instances, which Cloud Map turns into record sets of
+// the namespace's hosted zone, and measures how long the registrations take to show up in the zone. Cloud Map has its own
+// API rate limits and quotas of instances per service and per namespace, so this exercises the path most record sets
+// of ECS and App Mesh services take instead of ChangeResourceRecordSets. cleanup deletes the namespace with its zone.
+func runCloudMap(ctx context.Context, zone Zone, opts Options) error {
+	namespaceID := opts.CloudMapNamespace
+	if namespaceID == "" {
+		var err error
+		if namespaceID, err = createCloudMapNamespace(ctx, zone, opts); err != nil {
+			return err
+		}
+	}
+	nsOut, err := zone.CloudMap.GetNamespace(ctx, &servicediscovery.GetNamespaceInput{Id: &namespaceID})
+	if err != nil {
+		return fmt.Errorf("unable to describe namespace %s: %w", namespaceID, err)
+	}
+	if nsOut.Namespace.Properties == nil || nsOut.Namespace.Properties.DnsProperties == nil || nsOut.Namespace.Properties.DnsProperties.HostedZoneId == nil {
+		return fmt.Errorf("namespace %s isn't a DNS namespace", namespaceID)
+	}
+	opts.HostedZoneID = *nsOut.Namespace.Properties.DnsProperties.HostedZoneId
+	hz, err := describeZone(ctx, zone, opts)
+	if err != nil {
+		return err
+	}
+	startCount := int(aws.ToInt64(hz.HostedZone.ResourceRecordSetCount))
+
+	serviceIDs, err := zone.createCloudMapServices(ctx, namespaceID, opts)
+	if err != nil {
+		return err
+	}
+	var throttles throttleCounter
+	start := time.Now()
+	slog.Info("🌊 Registering service instances", "namespace", namespaceID, "services", len(serviceIDs), "instances", opts.CloudMapInstances,
+		"rate", opts.CloudMapRegisterRate)
+	err = paceCalls(ctx, opts.CloudMapInstances, opts.CloudMapRegisterRate, func(ctx context.Context, i int) error {
+		_, err := zone.CloudMap.RegisterInstance(ctx, &servicediscovery.RegisterInstanceInput{
+			ServiceId:        aws.String(serviceIDs[i/opts.CloudMapInstancesPerService]),
+			InstanceId:       aws.String(fmt.Sprintf("instance-%d", i)),
+			CreatorRequestId: aws.String(uuid.NewString()),
+			Attributes:       cloudMapInstanceAttributes(i),
+		}, func(o *servicediscovery.Options) { o.APIOptions = append(o.APIOptions, throttles.middleware) })
+		if err != nil {
+			return fmt.Errorf("unable to register instance %d: %w", i, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	result := cloudMapResult{
+		Namespace:        namespaceID,
+		Zone:             strings.TrimPrefix(opts.HostedZoneID, "/hostedzone/"),
+		Services:         len(serviceIDs),
+		Instances:        opts.CloudMapInstances,
+		RegisterDuration: time.Since(start),
+	}
+	slog.Info("✅ Cloud Map accepted every registration", "instances", opts.CloudMapInstances, "duration", result.RegisterDuration)
+
+	ctx, cancel := context.WithTimeout(ctx, opts.CloudMapTimeout)
+	defer cancel()
+	if err := zone.waitForCloudMapOperations(ctx, namespaceID); err != nil {
+		return err
+	}
+	result.OperationsDuration = time.Since(start)
+	if result.FailedOperations, err = zone.countCloudMapOperations(ctx, namespaceID, sdtypes.OperationStatusFail, start); err != nil {
+		return err
+	}
+	if result.FailedOperations != 0 {
+		slog.Warn("some registrations failed, their record sets won't be in the zone", "failed", result.FailedOperations)
+	}
+	// every instance gets a record set of each type of its service, the SRV record sets may add more
+	want := startCount + (opts.CloudMapInstances-result.FailedOperations)*len(splitList(opts.CloudMapRecordTypes))
+	count, err := zone.waitForRecordSetCount(ctx, opts.HostedZoneID, want)
+	if err != nil {
+		return err
+	}
+	result.RecordsDuration = time.Since(start)
+	result.RecordSets = count - startCount
+	result.Throttled = throttles.Count()
+	slog.Info("✅ The record sets of every instance are in the zone", "zone", result.Zone, "recordSets", result.RecordSets, "duration", result.RecordsDuration)
+	return printOutput(opts.Output, result)
+}
+
+// createCloudMapNamespace creates a private DNS namespace, and an ephemeral VPC for it if requested, and waits for it to
+// be created. The namespace ID is returned.
+func createCloudMapNamespace(ctx context.Context, zone Zone, opts Options) (string, error) {
+	if opts.CreateVPC {
+		vpcID, err := zone.CreateEphemeralVPC(ctx)
+		if err != nil {
+			if vpcID != "" {
+				zone.cleanupEphemeralVPC(ctx, vpcID)
+			}
+			return "", fmt.Errorf("unable to create VPC: %w", err)
+		}
+		opts.VPCID = vpcID
+		slog.Info("✅ Successfully Created ephemeral VPC for the namespace", "vpc", vpcID)
+	}
+	out, err := zone.CloudMap.CreatePrivateDnsNamespace(ctx, &servicediscovery.CreatePrivateDnsNamespaceInput{
+		Name:             aws.String(fmt.Sprintf("floodzone-test-%s.aws", uuid.NewString())),
+		Vpc:              aws.String(opts.VPCID),
+		CreatorRequestId: aws.String(uuid.NewString()),
+		Description:      aws.String(fmt.Sprintf("Created by floodzone at %s", time.Now().UTC())),
+	})
+	if err == nil {
+		var operation *sdtypes.Operation
+		if operation, err = zone.waitForCloudMapOperation(ctx, *out.OperationId); err == nil {
+			namespaceID := operation.Targets[string(sdtypes.OperationTargetTypeNamespace)]
+			slog.Info("✅ Successfully Created Cloud Map namespace to flood 🌊!", "namespace", namespaceID)
+			return namespaceID, nil
+		}
+	}
+	if opts.CreateVPC {
+		zone.cleanupEphemeralVPC(ctx, opts.VPCID)
+	}
+	return "", fmt.Errorf("unable to create namespace: %w", err)
+}
+
+// createCloudMapServices creates the MULTIVALUE services the instances are registered to, with up to
+// --instances-per-service instances each. The service names are unique to the run so that runs can share a namespace.
+func (z Zone) createCloudMapServices(ctx context.Context, namespaceID string, opts Options) ([]string, error) {
+	var records []sdtypes.DnsRecord
+	for _, recordType := range splitList(opts.CloudMapRecordTypes) {
+		records = append(records, sdtypes.DnsRecord{Type: sdtypes.RecordType(strings.ToUpper(recordType)), TTL: aws.Int64(cloudMapTTL)})
+	}
+	services := (opts.CloudMapInstances + opts.CloudMapInstancesPerService - 1) / opts.CloudMapInstancesPerService
+	prefix := strings.Split(uuid.NewString(), "-")[0]
+	serviceIDs := make([]string, 0, services)
+	for i := 0; i < services; i++ {
+		out, err := z.CloudMap.CreateService(ctx, &servicediscovery.CreateServiceInput{
+			Name:             aws.String(fmt.Sprintf("svc-%s-%d", prefix, i)),
+			NamespaceId:      aws.String(namespaceID),
+			CreatorRequestId: aws.String(uuid.NewString()),
+			DnsConfig:        &sdtypes.DnsConfig{DnsRecords: records, RoutingPolicy: sdtypes.RoutingPolicyMultivalue},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to create service %d of namespace %s: %w", i, namespaceID, err)
+		}
+		serviceIDs = append(serviceIDs, *out.Service.Id)
+	}
+	return serviceIDs, nil
+}
+
+// cloudMapInstanceAttributes returns the attributes of instance i, with an IP address of its own so that its record
+// sets have unique values
+func cloudMapInstanceAttributes(i int) map[string]string {
+	return map[string]string{
+		"AWS_INSTANCE_IPV4": sequentialIPv4(i),
+		"AWS_INSTANCE_IPV6": fmt.Sprintf("fd00::%x", i),
+		"AWS_INSTANCE_PORT": "80",
+	}
+}
+
+// sequentialIPv4 returns the i-th address of 10.0.0.0/8
+func sequentialIPv4(i int) string {
+	return fmt.Sprintf("10.%d.%d.%d", (i>>16)&0xff, (i>>8)&0xff, i&0xff)
+}
+
+// waitForCloudMapOperation waits for an operation to succeed and returns it
+func (z Zone) waitForCloudMapOperation(ctx context.Context, operationID string) (*sdtypes.Operation, error) {
+	for {
+		out, err := z.CloudMap.GetOperation(ctx, &servicediscovery.GetOperationInput{OperationId: &operationID})
+		if err != nil {
+			return nil, fmt.Errorf("unable to describe operation %s: %w", operationID, err)
+		}
+		switch out.Operation.Status {
+		case sdtypes.OperationStatusSuccess:
+			return out.Operation, nil
+		case sdtypes.OperationStatusFail:
+			return nil, fmt.Errorf("operation %s failed: %s", operationID, aws.ToString(out.Operation.ErrorMessage))
+		}
+		if err := sleep(ctx, cloudMapPollInterval); err != nil {
+			return nil, fmt.Errorf("operation %s didn't finish: %w", operationID, err)
+		}
+	}
+}
+
+// waitForCloudMapOperations waits until the namespace has no operations waiting to be applied
+func (z Zone) waitForCloudMapOperations(ctx context.Context, namespaceID string) error {
+	slog.Info("⏳ Waiting for Cloud Map to apply the operations to the zone", "namespace", namespaceID)
+	for {
+		pending, err := z.countCloudMapOperations(ctx, namespaceID, "", time.Time{})
+		if err != nil {
+			return err
+		}
+		if pending == 0 {
+			return nil
+		}
+		slog.Debug("Cloud Map operations are pending", "namespace", namespaceID, "operations", pending)
+		if err := sleep(ctx, cloudMapPollInterval); err != nil {
+			return fmt.Errorf("the operations of namespace %s didn't finish: %w", namespaceID, err)
+		}
+	}
+}
+
+// countCloudMapOperations counts the operations of the namespace in the status updated since the time, or the submitted
+// and pending operations if the status is empty
+func (z Zone) countCloudMapOperations(ctx context.Context, namespaceID string, status sdtypes.OperationStatus, since time.Time) (int, error) {
+	filters := []sdtypes.OperationFilter{{Name: sdtypes.OperationFilterNameNamespaceId, Values: []string{namespaceID}, Condition: sdtypes.FilterConditionEq}}
+	if status == "" {
+		filters = append(filters, sdtypes.OperationFilter{Name: sdtypes.OperationFilterNameStatus,
+			Values: []string{string(sdtypes.OperationStatusSubmitted), string(sdtypes.OperationStatusPending)}, Condition: sdtypes.FilterConditionIn})
+	} else {
+		filters = append(filters, sdtypes.OperationFilter{Name: sdtypes.OperationFilterNameStatus, Values: []string{string(status)}, Condition: sdtypes.FilterConditionEq})
+	}
+	if !since.IsZero() {
+		filters = append(filters, sdtypes.OperationFilter{Name: sdtypes.OperationFilterNameUpdateDate,
+			Values: []string{fmt.Sprint(since.Unix()), fmt.Sprint(time.Now().Add(time.Minute).Unix())}, Condition: sdtypes.FilterConditionBetween})
+	}
+	count := 0
+	var nextToken *string
+	for {
+		out, err := z.CloudMap.ListOperations(ctx, &servicediscovery.ListOperationsInput{Filters: filters, NextToken: nextToken})
+		if err != nil {
+			return 0, fmt.Errorf("unable to list the operations of namespace %s: %w", namespaceID, err)
+		}
+		count += len(out.Operations)
+		if out.NextToken == nil {
+			return count, nil
+		}
+		nextToken = out.NextToken
+	}
+}
+
+// waitForRecordSetCount waits until the zone has at least want record sets and returns how many it has
+func (z Zone) waitForRecordSetCount(ctx context.Context, hostedZoneID string, want int) (int, error) {
+	for {
+		out, err := z.R53.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: &hostedZoneID})
+		if err != nil {
+			return 0, fmt.Errorf("unable to describe hosted zone: %w", err)
+		}
+		if count := int(aws.ToInt64(out.HostedZone.ResourceRecordSetCount)); count >= want {
+			return count, nil
+		}
+		if err := sleep(ctx, cloudMapPollInterval); err != nil {
+			return 0, fmt.Errorf("the zone %s didn't get %d record sets: %w", hostedZoneID, want, err)
+		}
+	}
+}
+
+// isCloudMapZone returns whether the hosted zone was created by a Cloud Map namespace, which only Cloud Map can change
+func isCloudMapZone(hostedZone *types.HostedZone) bool {
+	return hostedZone.LinkedService != nil && aws.ToString(hostedZone.LinkedService.ServicePrincipal) == cloudMapServicePrincipal
+}
+
+// DeleteCloudMapNamespace deregisters the instances and deletes the services of the namespace that created the hosted
+// zone, then deletes the namespace, which deletes the zone, along with any ephemeral VPCs floodzone created for it
+func (z Zone) DeleteCloudMapNamespace(ctx context.Context, hostedZone *types.HostedZone, vpcs []types.VPC, rate float64) error {
+	if err := z.Coordinator.Lock(ctx, *hostedZone.Id); err != nil {
+		return err
+	}
+	namespaceID, err := z.cloudMapNamespaceOfZone(ctx, *hostedZone.Id)
+	if err != nil {
+		return err
+	}
+	serviceIDs, err := z.cloudMapServices(ctx, namespaceID)
+	if err != nil {
+		return err
+	}
+	for _, serviceID := range serviceIDs {
+		instanceIDs, err := z.cloudMapInstances(ctx, serviceID)
+		if err != nil {
+			return err
+		}
+		slog.Info("🧹 Deregistering service instances", "service", serviceID, "instances", len(instanceIDs))
+		err = paceCalls(ctx, len(instanceIDs), rate, func(ctx context.Context, i int) error {
+			if _, err := z.CloudMap.DeregisterInstance(ctx, &servicediscovery.DeregisterInstanceInput{ServiceId: &serviceID, InstanceId: &instanceIDs[i]}); err != nil {
+				return fmt.Errorf("unable to deregister instance %s of service %s: %w", instanceIDs[i], serviceID, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := z.waitForCloudMapOperations(ctx, namespaceID); err != nil {
+		return err
+	}
+	for _, serviceID := range serviceIDs {
+		if _, err := z.CloudMap.DeleteService(ctx, &servicediscovery.DeleteServiceInput{Id: aws.String(serviceID)}); err != nil {
+			return fmt.Errorf("unable to delete service %s: %w", serviceID, err)
+		}
+	}
+	out, err := z.CloudMap.DeleteNamespace(ctx, &servicediscovery.DeleteNamespaceInput{Id: &namespaceID})
+	if err != nil {
+		return fmt.Errorf("unable to delete namespace %s: %w", namespaceID, err)
+	}
+	if _, err := z.waitForCloudMapOperation(ctx, *out.OperationId); err != nil {
+		return fmt.Errorf("unable to delete namespace %s: %w", namespaceID, err)
+	}
+	slog.Info("✅ Successfully deleted the Cloud Map namespace and its private hosted zone", "namespace", namespaceID, "zone", *hostedZone.Id)
+	if err := z.DeleteEphemeralEndpoints(ctx, vpcs, z.Region); err != nil {
+		return err
+	}
+	return z.DeleteEphemeralVPCs(ctx, vpcs, z.Region)
+}
+
+// cloudMapNamespaceOfZone returns the ID of the private DNS namespace that created the hosted zone
+func (z Zone) cloudMapNamespaceOfZone(ctx context.Context, hostedZoneID string) (string, error) {
+	hostedZoneID = strings.TrimPrefix(hostedZoneID, "/hostedzone/")
+	input := &servicediscovery.ListNamespacesInput{
+		Filters: []sdtypes.NamespaceFilter{{Name: sdtypes.NamespaceFilterNameType, Values: []string{"DNS_PRIVATE"}, Condition: sdtypes.FilterConditionEq}},
+	}
+	for {
+		out, err := z.CloudMap.ListNamespaces(ctx, input)
+		if err != nil {
+			return "", fmt.Errorf("unable to list Cloud Map namespaces: %w", err)
+		}
+		for _, namespace := range out.Namespaces {
+			if namespace.Properties != nil && namespace.Properties.DnsProperties != nil &&
+				aws.ToString(namespace.Properties.DnsProperties.HostedZoneId) == hostedZoneID {
+				return *namespace.Id, nil
+			}
+		}
+		if out.NextToken == nil {
+			return "", fmt.Errorf("no Cloud Map namespace in %s has the zone %s", z.Region, hostedZoneID)
+		}
+		input.NextToken = out.NextToken
+	}
+}
+
+// cloudMapServices returns the IDs of the services of the namespace
+func (z Zone) cloudMapServices(ctx context.Context, namespaceID string) ([]string, error) {
+	input := &servicediscovery.ListServicesInput{
+		Filters: []sdtypes.ServiceFilter{{Name: sdtypes.ServiceFilterNameNamespaceId, Values: []string{namespaceID}, Condition: sdtypes.FilterConditionEq}},
+	}
+	var serviceIDs []string
+	for {
+		out, err := z.CloudMap.ListServices(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list the services of namespace %s: %w", namespaceID, err)
+		}
+		for _, service := range out.Services {
+			serviceIDs = append(serviceIDs, *service.Id)
+		}
+		if out.NextToken == nil {
+			return serviceIDs, nil
+		}
+		input.NextToken = out.NextToken
+	}
+}
+
+// cloudMapInstances returns the IDs of the instances of the service
+func (z Zone) cloudMapInstances(ctx context.Context, serviceID string) ([]string, error) {
+	input := &servicediscovery.ListInstancesInput{ServiceId: &serviceID}
+	var instanceIDs []string
+	for {
+		out, err := z.CloudMap.ListInstances(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list the instances of service %s: %w", serviceID, err)
+		}
+		for _, instance := range out.Instances {
+			instanceIDs = append(instanceIDs, *instance.Id)
+		}
+		if out.NextToken == nil {
+			return instanceIDs, nil
+		}
+		input.NextToken = out.NextToken
+	}
+}
+
+// validateCloudMap validates the flags of the cloud-map command
+func validateCloudMap(opts Options) error {
+	var errs []error
+	if opts.VPCID != "" && opts.CreateVPC {
+		errs = append(errs, errors.New("--vpc-id and --create-vpc are mutually exclusive"))
+	}
+	if opts.CloudMapNamespace == "" && opts.VPCID == "" && !opts.CreateVPC {
+		errs = append(errs, errors.New("--vpc-id or --create-vpc is required when --namespace-id is not provided"))
+	}
+	if opts.CloudMapInstances <= 0 {
+		errs = append(errs, errors.New("--instances must be greater than 0"))
+	}
+	if opts.CloudMapInstancesPerService <= 0 {
+		errs = append(errs, errors.New("--instances-per-service must be greater than 0"))
+	}
+	if opts.CloudMapRegisterRate <= 0 {
+		errs = append(errs, errors.New("--register-rate must be greater than 0"))
+	}
+	recordTypes := splitList(opts.CloudMapRecordTypes)
+	if len(recordTypes) == 0 {
+		errs = append(errs, errors.New("--dns-record-types is required"))
+	}
+	for _, recordType := range recordTypes {
+		if !slices.Contains(cloudMapRecordTypes, strings.ToUpper(recordType)) {
+			errs = append(errs, fmt.Errorf("--dns-record-types must be some of %s, got %q", strings.Join(cloudMapRecordTypes, ", "), recordType))
+		}
+	}
+	if opts.CloudMapTimeout <= 0 {
+		errs = append(errs, errors.New("--wait-timeout must be greater than 0"))
+	}
+	return errors.Join(errs...)
+}
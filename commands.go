@@ -0,0 +1,660 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/bwagner5/floodzone/pkg/floodzone"
+)
+
+var commands = []command{
+	{
+		name:        "create",
+		description: "Create a new private hosted zone",
+		flags:       vpcFlags,
+		validate:    validateZoneCreation,
+		run:         runCreate,
+		plan:        planCreate,
+	},
+	{
+		name:        "flood",
+		description: "Fill a hosted zone with resource record sets, creating the zone if no ID is provided",
+		flags: func(fs *flag.FlagSet, opts *Options) {
+			zoneIDFlag(fs, opts)
+			vpcFlags(fs, opts)
+			batchFlags(fs, opts)
+			fs.IntVar(&opts.TotalRecords, "total-records", 1_000, "Total resource record sets in the hosted zone (max is 10,000)")
+			fs.StringVar(&opts.RecordGenerator, "record-generator", floodzone.GeneratorUUID, fmt.Sprintf("How the names and values of the created record sets are generated: %s", strings.Join(floodzone.Generators(), ", ")))
+			fs.StringVar(&opts.Manifest, "manifest", "", "Local path or s3://bucket/key URI to write the names, types, and values of the created record sets to")
+			manifestIntervalFlag(fs, opts)
+			checkpointFlag(fs, opts)
+			fs.StringVar(&opts.Terraform, "terraform", "", "Path to write Terraform resource and import blocks for the created zone and record sets to, to adopt them into Terraform")
+			fs.StringVar(&opts.ExternalDNS, "external-dns", "", "Path to write the created record sets to as Kubernetes objects for external-dns to reconcile, as JSON if it ends with .json and YAML otherwise")
+			fs.StringVar(&opts.ExternalDNSKind, "external-dns-kind", "dnsendpoint", fmt.Sprintf("Kind of objects to write to --external-dns: %s", strings.Join(externalDNSKinds, ", ")))
+			verifyFlags(fs, opts)
+			fs.StringVar(&opts.QueryLogging, "query-logging", "", fmt.Sprintf("Create a Route 53 query logging config for every public zone of the run, which cleanup deletes, logging to a log group %s or %s by every zone", queryLoggingPerZone, queryLoggingShared))
+		},
+		validate: validateFlood,
+		run:      runFlood,
+		plan:     planFlood,
+		summary:  true,
+	},
+	{
+		name:        "delete",
+		description: "Delete resource record sets from a hosted zone, deleting the zone once it's empty",
+		flags: func(fs *flag.FlagSet, opts *Options) {
+			zoneIDFlag(fs, opts)
+			batchFlags(fs, opts)
+			fs.IntVar(&opts.TotalRecords, "total-records", 1_000, "Total resource record sets to delete")
+			checkpointFlag(fs, opts)
+		},
+		validate: validateDelete,
+		run:      runDelete,
+		plan:     planDelete,
+		summary:  true,
+	},
+	{
+		name:        "churn",
+		description: "UPSERT new values into the A record sets of a hosted zone",
+		flags: func(fs *flag.FlagSet, opts *Options) {
+			zoneIDFlag(fs, opts)
+			batchFlags(fs, opts)
+			fs.IntVar(&opts.TotalRecords, "total-records", 1_000, "Total resource record sets to update per iteration")
+			fs.IntVar(&opts.Iterations, "iterations", 1, "Number of times to update the resource record sets")
+			verifyFlags(fs, opts)
+			fs.BoolVar(&opts.VerifyList, "verify-list", false, "List the zone once the run is done to check every upserted record set has the value it was last written with")
+			fs.StringVar(&opts.Manifest, "manifest", "", "Local path or s3://bucket/key URI to write the names, types, and last written values of the upserted record sets to, for query --check-answers")
+			manifestIntervalFlag(fs, opts)
+			checkpointFlag(fs, opts)
+		},
+		validate: validateChurn,
+		run:      runChurn,
+		plan:     planChurn,
+		summary:  true,
+	},
+	{
+		name:        "list",
+		description: "List the resource record sets in a hosted zone",
+		flags: func(fs *flag.FlagSet, opts *Options) {
+			zoneIDFlag(fs, opts)
+			fs.IntVar(&opts.MaxBatchSize, "max-batch-size", 300, "Max resource record sets to list in one API call (max is 300)")
+			fs.StringVar(&opts.ListTypes, "types", "", "Comma separated record types to list, e.g. A,TXT, defaults to all of them")
+			fs.StringVar(&opts.ListName, "name", "", "Only list the record sets whose name matches the shell pattern, e.g. 'record-*.example.com'")
+		},
+		validate: validateListRecords,
+		run:      runList,
+	},
+	{
+		name:        "cleanup",
+		description: "Delete all resource record sets, the hosted zone, and any health check, query logging config, VPC, or resolver endpoint floodzone created for it",
+		flags: func(fs *flag.FlagSet, opts *Options) {
+			zoneIDFlag(fs, opts)
+			batchFlags(fs, opts)
+		},
+		validate: validateCleanup,
+		run:      runCleanup,
+		plan:     planCleanup,
+		summary:  true,
+	},
+	{
+		name:        "report",
+		description: "Describe a hosted zone, its VPC associations, and its resource record sets by type, or compare a past run with a baseline",
+		flags: func(fs *flag.FlagSet, opts *Options) {
+			zoneIDFlag(fs, opts)
+			fs.IntVar(&opts.MaxBatchSize, "max-batch-size", 300, "Max resource record sets to list in one API call (max is 300)")
+			fs.StringVar(&opts.Compare, "compare", "", "Run ID of a baseline run in --history-db to compare the latency, throughput, and errors of --compare-run with instead of describing a zone")
+			fs.StringVar(&opts.CompareRun, "compare-run", "", "Run ID to compare with the --compare baseline, defaults to the most recent run")
+			fs.Float64Var(&opts.RegressionThreshold, "regression-threshold", 10, "Percent a metric can get worse than the --compare baseline before it's a regression")
+			historyDBFlag(fs, opts)
+		},
+		validate: validateReport,
+		run:      runReport,
+	},
+	{
+		name:        "query",
+		description: "Query the resource record sets of a hosted zone or a manifest at a sustained rate and measure the DNS latency and success rate",
+		flags: func(fs *flag.FlagSet, opts *Options) {
+			zoneIDFlag(fs, opts)
+			fs.StringVar(&opts.FromManifest, "from-manifest", "", "Local path or s3://bucket/key URI of a flood --manifest to query the record sets of instead of listing the zone")
+			fs.StringVar(&opts.Resolver, "resolver", "", "Comma-separated DNS resolvers to query round robin, e.g. 10.0.0.2 for a VPC's Route 53 Resolver, defaults to the system's resolvers")
+			fs.StringVar(&opts.QueryProtocol, "protocol", dnsProtocolUDP, "Protocol to query over: udp, retried over TCP when an answer is truncated like real clients do, udp-only, which fails truncated answers, tcp, tls for DNS-over-TLS on port 853, or https for DNS-over-HTTPS, which takes --resolver URLs and defaults to https://<resolver>/dns-query")
+			fs.StringVar(&opts.ResolverEndpointID, "resolver-endpoint-id", "", "ID of a Route 53 Resolver inbound endpoint to query the IP addresses of round robin")
+			fs.BoolVar(&opts.CreateEndpoint, "create-inbound-endpoint", false, "Create a Route 53 Resolver inbound endpoint to query, deleted when the run finishes")
+			fs.StringVar(&opts.EndpointSubnets, "inbound-endpoint-subnet-ids", "", "Comma-separated subnets, at least 2, to give the --create-inbound-endpoint an IP address in")
+			fs.StringVar(&opts.EndpointSecGroups, "inbound-endpoint-security-group-ids", "", "Comma-separated security groups of the --create-inbound-endpoint, they must allow DNS from this host")
+			fs.StringVar(&opts.ForwardTargets, "forward-targets", "", "Comma-separated ip[:port] DNS servers to create a Route 53 Resolver rule forwarding the zone's domain to, deleted when the run finishes")
+			fs.StringVar(&opts.ForwardDomain, "forward-domain", "", "Domain for the --forward-targets rule to forward, defaults to the name of the zone")
+			fs.StringVar(&opts.ForwardVPCIDs, "forward-vpc-ids", "", "Comma-separated VPCs to associate the --forward-targets rule with")
+			fs.StringVar(&opts.OutboundEndpoint, "outbound-endpoint-id", "", "ID of the Route 53 Resolver outbound endpoint the --forward-targets rule forwards queries through")
+			fs.IntVar(&opts.QPS, "qps", 100, "Queries to send per second")
+			fs.IntVar(&opts.Concurrency, "concurrency", 10, "Most queries waiting for an answer at the same time")
+			fs.DurationVar(&opts.QueryDuration, "duration", time.Minute, "How long to send queries for")
+			fs.Float64Var(&opts.MissPercent, "miss-percent", 0, "Percent of the queries to send for random names in the zone that don't exist, to exercise negative caching")
+			fs.IntVar(&opts.MissNames, "miss-names", 0, "Names that don't exist to query over and over with --miss-percent so the resolver answers from its negative cache, 0 for a new name every query")
+			fs.StringVar(&opts.QueryTypeMix, "query-type-mix", "", "Relative weight of each record type to query as TYPE=WEIGHT pairs, e.g. A=80,AAAA=15,TXT=5, defaults to how many record sets of each type there are")
+			fs.StringVar(&opts.Popularity, "popularity", popularityUniform, "How often each record set is queried: uniform round robin, or zipf for a few popular names and a long tail like production traffic")
+			fs.Float64Var(&opts.ZipfExponent, "zipf-exponent", 1.2, "Skew of --popularity zipf, greater than 1, higher values query the most popular names more")
+			fs.StringVar(&opts.EDNSSubnets, "edns-subnets", "", "Comma-separated EDNS client subnets for the queries to carry round robin as CIDR[=ANSWER], the queries from a subnet fail unless they get its ANSWER, e.g. 203.0.113.0/24=192.0.2.10")
+			fs.BoolVar(&opts.DNSSEC, "dnssec", false, "Ask for DNSSEC records and authenticated answers, the queries fail unless a validating --resolver answers them with the AD bit set")
+			fs.BoolVar(&opts.RandomizeCase, "randomize-case", false, "Send the names in random case like stub resolvers with DNS 0x20 encoding do, the queries fail when they're answered in another case")
+			fs.IntVar(&opts.QueryAttempts, "attempts", 1, "Times to send a query that timed out, got SERVFAIL, or a network error before it fails, like the attempts option of resolv.conf")
+			fs.DurationVar(&opts.QueryTimeout, "query-timeout", queryTimeout, "How long each attempt of a query waits for an answer")
+			fs.StringVar(&opts.LambdaRegions, "lambda-regions", "", "Comma-separated regions to deploy query worker Lambda functions to and send the queries from, split evenly between the workers, deleted when the run finishes")
+			fs.IntVar(&opts.LambdaWorkers, "lambda-workers-per-region", 1, "Query workers to invoke in each of the --lambda-regions")
+			fs.StringVar(&opts.SSMInstanceIDs, "ssm-instance-ids", "", "Comma-separated EC2 instances to send the queries from with SSM Run Command, split evenly between them, to query private hosted zones from inside their VPCs")
+			fs.StringVar(&opts.SSMInstanceTags, "ssm-instance-tags", "", "Comma-separated Key=Value tags of the running EC2 instances to send the queries from with SSM Run Command, instead of --ssm-instance-ids")
+			fs.StringVar(&opts.SSMS3URI, "ssm-s3-uri", "", "S3 URI, e.g. s3://bucket/prefix, to exchange floodzone and the results with the --ssm-instance-ids instances through, deleted when the run finishes")
+			fs.StringVar(&opts.WorkerBinary, "worker-binary", "", "Linux amd64 or arm64 floodzone binary to run as the --lambda-regions or --ssm-instance-ids workers, defaults to the running binary")
+			fs.Float64Var(&opts.CacheBustPercent, "cache-bust-percent", 0, "Percent of the queries to send for unique random names that no resolver has cached, so that Route 53 has to answer them, the rest can be answered from cache")
+			fs.StringVar(&opts.CacheBustMode, "cache-bust-mode", cacheBustNXDomain, "Names to query with --cache-bust-percent: nxdomain for random names under the record sets, which don't exist, or wildcard for random names under the wildcard record sets, creating one for the run if the zone has none")
+			fs.BoolVar(&opts.CheckAnswers, "check-answers", false, "Check the answers against the values of the --from-manifest record sets and report the correctness over time, the queries fail with stale or wrong answers")
+			fs.DurationVar(&opts.ManifestRefresh, "manifest-refresh", 10*time.Second, "How often to read --from-manifest again with --check-answers to follow the values a churn --manifest-interval run writes")
+			fs.DurationVar(&opts.RampUp, "ramp-up", 0, "Grow the rate linearly from 1 query per second to --qps over this long at the start of --duration")
+		},
+		validate: validateQuery,
+		run:      runQuery,
+		plan:     planQuery,
+	},
+	{
+		name:        "outbound-endpoint",
+		description: "Create a Route 53 Resolver outbound endpoint in a VPC of a hosted zone for query --forward-targets, deleted by cleanup with the zone",
+		flags: func(fs *flag.FlagSet, opts *Options) {
+			zoneIDFlag(fs, opts)
+			fs.StringVar(&opts.OutboundSubnets, "outbound-endpoint-subnet-ids", "", "Comma-separated subnets, at least 2, in a VPC associated with the zone to give the endpoint an IP address in")
+			fs.StringVar(&opts.OutboundSecGroups, "outbound-endpoint-security-group-ids", "", "Comma-separated security groups of the endpoint, they must allow DNS to the forwarding targets")
+		},
+		validate: validateOutboundEndpoint,
+		run:      runOutboundEndpoint,
+	},
+	{
+		name:        "cloud-map",
+		description: "Register service instances in a Cloud Map private DNS namespace, creating it if no ID is provided, and measure how long their record sets take to show up in its hosted zone",
+		flags: func(fs *flag.FlagSet, opts *Options) {
+			vpcFlags(fs, opts)
+			fs.StringVar(&opts.CloudMapNamespace, "namespace-id", "", "ID of a Cloud Map private DNS namespace to register the instances in instead of creating one, cleanup deletes it with its zone either way")
+			fs.IntVar(&opts.CloudMapInstances, "instances", 1_000, "Total service instances to register (Cloud Map allows 2,000 per namespace by default)")
+			fs.IntVar(&opts.CloudMapInstancesPerService, "instances-per-service", 1_000, "Most instances to register in each service created for the run (Cloud Map allows 1,000 by default)")
+			fs.StringVar(&opts.CloudMapRecordTypes, "dns-record-types", "A", fmt.Sprintf("Comma-separated record types Cloud Map creates for every instance: %s", strings.Join(cloudMapRecordTypes, ", ")))
+			fs.Float64Var(&opts.CloudMapRegisterRate, "register-rate", defaultCloudMapRegisterRate, "RegisterInstance calls to make per second")
+			fs.DurationVar(&opts.CloudMapTimeout, "wait-timeout", 15*time.Minute, "How long to wait for Cloud Map to apply the registrations and for their record sets to show up in the zone")
+		},
+		validate: validateCloudMap,
+		run:      runCloudMap,
+	},
+	{
+		name:        "health-checks",
+		description: "Create Route 53 health checks at a controlled rate to test how the account scales with them, or delete the ones floodzone created",
+		flags: func(fs *flag.FlagSet, opts *Options) {
+			fs.StringVar(&opts.HostedZoneID, "hosted-zone-id", "", "Hosted Zone ID to create a MULTIVALUE record set referring to every health check in, cleanup of the zone deletes the health checks with it")
+			fs.IntVar(&opts.HealthChecks, "health-checks", 100, "Health checks to create (Route 53 allows 200 per account by default)")
+			fs.StringVar(&opts.HealthCheckTypes, "health-check-types", "HTTP,HTTPS,HTTP_STR_MATCH,TCP", fmt.Sprintf("Comma-separated types of health checks to create round robin, or TYPE=WEIGHT pairs to create them in proportion, e.g. HTTP=3,TCP=1: %s", strings.Join(healthCheckTypes, ", ")))
+			fs.StringVar(&opts.HealthCheckIntervals, "request-intervals", "30", "Comma-separated seconds between the checks of the health checks, 10 or 30")
+			fs.StringVar(&opts.HealthCheckThresholds, "failure-thresholds", "3", "Comma-separated numbers of consecutive failed checks, 1 to 10, for a health check to change status")
+			fs.StringVar(&opts.HealthCheckRegions, "health-check-regions", "", "Semicolon-separated sets of at least 3 comma-separated regions for the health checks to check from, defaults to the Route 53 default regions")
+			fs.StringVar(&opts.HealthCheckAlarmName, "alarm-name", "", "CloudWatch alarm the CLOUDWATCH_METRIC health checks follow")
+			fs.StringVar(&opts.HealthCheckAlarmRegion, "alarm-region", "", "Region of --alarm-name, defaults to the region of the run")
+			fs.StringVar(&opts.HealthCheckInsufficientData, "insufficient-data-statuses", "LastKnownStatus", "Comma-separated statuses of the CLOUDWATCH_METRIC health checks while their alarm has insufficient data: Healthy, Unhealthy, LastKnownStatus")
+			fs.StringVar(&opts.HealthCheckTarget, "health-check-target", "", "Public IP address or domain name for the health checks to check")
+			fs.IntVar(&opts.HealthCheckPort, "health-check-port", 0, "Port for the health checks to check, defaults to 443 for HTTPS health checks and 80 for the others")
+			fs.StringVar(&opts.HealthCheckSearchString, "search-string", "ok", "String the responses of the string matching health checks must contain")
+			fs.Float64Var(&opts.HealthCheckLatencyPercent, "measure-latency-percent", 0, "Percent of the health checks to measure the latency of, which can't be changed once they're created")
+			fs.Float64Var(&opts.CreateRate, "create-rate", defaultHealthCheckRate, "Health checks to create, or delete with --delete, per second")
+			fs.BoolVar(&opts.Delete, "delete", false, "Delete every health check floodzone created that no record set refers to instead of creating health checks")
+			fs.IntVar(&opts.CalculatedChildren, "calculated-children", 0, fmt.Sprintf("Build a tree of calculated health checks over the health checks, every one aggregating up to this many children (at most %d) until a single one is the root, 0 to disable", maxChildHealthChecks))
+			fs.Float64Var(&opts.HealthThresholdPercent, "health-threshold-percent", 50, "Percent of its children that must be healthy for a calculated health check to be healthy")
+			fs.DurationVar(&opts.HealthCheckWatch, "watch", 0, "Watch the status of the health checks in CloudWatch for this long once they're created, and report how long every level of the tree took to get a status and how often it flapped, 0 to disable")
+		},
+		validate: validateHealthChecks,
+		run:      runHealthChecks,
+		plan:     planHealthChecks,
+	},
+	{
+		name:        "traffic-policies",
+		description: "Create Route 53 traffic policies and versions of generated documents at a controlled rate to test the account's traffic policy quotas, or delete every version of the ones floodzone created",
+		flags: func(fs *flag.FlagSet, opts *Options) {
+			fs.IntVar(&opts.TrafficPolicies, "traffic-policies", 10, "Traffic policies to create (Route 53 allows 50 per account by default)")
+			fs.IntVar(&opts.TrafficPolicyVersions, "versions", 1, "Versions of every traffic policy to create (Route 53 allows 1,000 per traffic policy)")
+			fs.IntVar(&opts.TrafficPolicyRules, "rules", 3, "Weighted rules in the document of every version, as a binary tree")
+			fs.IntVar(&opts.TrafficPolicyEndpoints, "endpoints-per-rule", 2, "Endpoints every rule weighs besides its child rules")
+			fs.IntVar(&opts.TrafficPolicyInstances, "policy-instances", 0, "Traffic policy instances of the latest versions to create across the zones of --hosted-zone-id, which are billed monthly (Route 53 allows 5 per account by default)")
+			fs.StringVar(&opts.HostedZoneID, "hosted-zone-id", "", "Comma-separated Hosted Zone IDs to spread the traffic policy instances across, cleanup of a zone deletes its instances")
+			fs.Float64Var(&opts.CreateRate, "create-rate", defaultTrafficPolicyRate, "Traffic policies or versions to create, or versions to delete with --delete, per second")
+			fs.BoolVar(&opts.Delete, "delete", false, "Delete the traffic policy instances and every version of every traffic policy floodzone created instead of creating traffic policies")
+		},
+		validate: validateTrafficPolicies,
+		run:      runTrafficPolicies,
+		plan:     planTrafficPolicies,
+	},
+	{
+		name:        "cidr-collections",
+		description: "Create Route 53 CIDR collections and fill them with locations of CIDR blocks at a controlled rate to test the account's CIDR collection quotas, or delete the ones floodzone created",
+		flags: func(fs *flag.FlagSet, opts *Options) {
+			fs.IntVar(&opts.CidrCollections, "collections", 1, "CIDR collections to create (Route 53 allows 5 per account by default)")
+			fs.IntVar(&opts.CidrLocations, "locations", 100, "Locations to create in every CIDR collection")
+			fs.IntVar(&opts.CidrBlocksPerLocation, "blocks-per-location", 10, "CIDR blocks of every location, distinct /24 blocks of 10.0.0.0/8 (Route 53 allows 1,000 per collection by default)")
+			fs.IntVar(&opts.CidrLocationsPerChange, "locations-per-change", 10, "Locations every ChangeCidrCollection call creates, or deletes with --delete")
+			fs.BoolVar(&opts.CidrCollectionVersion, "collection-version", false, "Pass the version of the collection every change expects, so that concurrent changes of a collection conflict and are retried with its new version")
+			fs.Float64Var(&opts.CreateRate, "create-rate", defaultCidrCollectionRate, "CIDR collections to create or ChangeCidrCollection calls per second")
+			fs.BoolVar(&opts.Delete, "delete", false, "Empty and delete every CIDR collection floodzone created instead of creating CIDR collections")
+		},
+		validate: validateCidrCollections,
+		run:      runCidrCollections,
+	},
+	{
+		name:        "vpc-associations",
+		description: "Associate a private hosted zone with many VPCs at a controlled rate to probe its VPC association quota and the latency of the associations, then disassociate them",
+		flags: func(fs *flag.FlagSet, opts *Options) {
+			zoneIDFlag(fs, opts)
+			fs.StringVar(&opts.VPCIDs, "vpc-ids", "", "Comma-separated VPC IDs to associate with the zone, every one in the region of the run or the one after its colon, e.g. vpc-1234:us-west-2")
+			fs.IntVar(&opts.CreateVPCs, "create-vpcs", 0, "Ephemeral VPCs to create in the region of the run and associate with the zone (EC2 allows 5 VPCs per region by default)")
+			fs.Float64Var(&opts.CreateRate, "create-rate", defaultVPCAssociationRate, "VPCs to create, associate, or disassociate per second")
+			fs.BoolVar(&opts.KeepAssociations, "keep-associations", false, "Keep the VPCs associated with the zone instead of disassociating them, the VPCs the run created are deleted along with the zone")
+		},
+		validate: validateVPCAssociations,
+		run:      runVPCAssociations,
+	},
+	{
+		name:        "set-identifiers",
+		description: "Create weighted, latency, or multivalue record sets under a single name of a hosted zone to find where Route 53 starts rejecting set identifiers, then delete them",
+		flags: func(fs *flag.FlagSet, opts *Options) {
+			zoneIDFlag(fs, opts)
+			fs.StringVar(&opts.RoutingPolicy, "routing-policy", "weighted", "Routing policy of the record sets: "+strings.Join(routingPolicies, ", "))
+			fs.IntVar(&opts.SetIdentifiers, "set-identifiers", maxSetIdentifiers+10, fmt.Sprintf("Record sets to create under the name, one change batch each (Route 53 allows %d per name and type)", maxSetIdentifiers))
+			fs.Float64Var(&opts.CreateRate, "create-rate", defaultSetIdentifierRate, "Record sets to create per second")
+			fs.BoolVar(&opts.KeepRecordSets, "keep-record-sets", false, "Keep the record sets instead of deleting them once every set identifier was tried, cleanup of the zone deletes them")
+		},
+		validate: validateSetIdentifiers,
+		run:      runSetIdentifiers,
+	},
+	{
+		name:        "dns-firewall",
+		description: "Create Route 53 Resolver DNS Firewall domain lists filled with generated domains and rule groups with a rule for every list to test firewall rule evaluation at scale, or delete the ones floodzone created",
+		flags: func(fs *flag.FlagSet, opts *Options) {
+			fs.IntVar(&opts.FirewallDomainLists, "domain-lists", 1, "DNS Firewall domain lists to create (Route 53 Resolver allows 1,000 per account by default)")
+			fs.IntVar(&opts.FirewallDomains, "domains-per-list", 10000, "Generated domains to fill every domain list with (Route 53 Resolver allows 100,000 per domain list by default)")
+			fs.IntVar(&opts.FirewallRuleGroups, "rule-groups", 1, "DNS Firewall rule groups to create")
+			fs.IntVar(&opts.FirewallRulesPerGroup, "rules-per-group", 0, "Rules of every rule group, each for its own domain list, the rule groups share the domain lists when there are more rules than domain lists. Defaults to a rule for every domain list spread across the rule groups")
+			fs.StringVar(&opts.FirewallAction, "firewall-action", "ALERT", "Action of the rules: ALERT, BLOCK, or ALLOW. BLOCK answers NXDOMAIN")
+			fs.StringVar(&opts.FirewallDomainsURI, "domains-s3-uri", "", fmt.Sprintf("s3://bucket/prefix to upload a file of the domains of every domain list to and import it from, instead of adding them %d at a time", maxFirewallDomainsPerUpdate))
+			fs.StringVar(&opts.HostedZoneID, "hosted-zone-id", "", "Hosted Zone ID whose record set names to put in the domain lists ahead of the generated domains, with --manifest recording which ones the rules block for query --from-manifest to check")
+			fs.StringVar(&opts.Manifest, "manifest", "", "Local path or s3://bucket/key URI to write the record sets of --hosted-zone-id to, marking the ones the rules block")
+			fs.StringVar(&opts.VPCIDs, "vpc-ids", "", "Comma-separated VPCs to associate every rule group with, so that their queries are evaluated against the rules")
+			fs.IntVar(&opts.FirewallPriorityStep, "priority-step", defaultFirewallPriorityStep, "Gap between the priorities of the rule groups associated with a VPC, the order of the rule groups is rotated by one for every VPC")
+			fs.Float64Var(&opts.CreateRate, "create-rate", defaultDNSFirewallRate, "Route 53 Resolver calls per second to create the firewall, or to delete it with --delete")
+			fs.BoolVar(&opts.Delete, "delete", false, "Disassociate and delete every DNS Firewall rule group and domain list floodzone created instead of creating them")
+		},
+		validate: validateDNSFirewall,
+		run:      runDNSFirewall,
+	},
+	{
+		name:        "analyze-query-logs",
+		description: "Report the QPS over time, response codes, and record sets queried from the query logs of a hosted zone, to check what a query run looked like from the zone's side",
+		flags: func(fs *flag.FlagSet, opts *Options) {
+			zoneIDFlag(fs, opts)
+			fs.StringVar(&opts.QueryLogGroup, "query-log-group", "", "CloudWatch Logs group the zone's queries are logged to, required for private zones, whose queries Resolver query logging logs. Defaults to the group of the zone's query logging config")
+			fs.StringVar(&opts.FromManifest, "from-manifest", "", "Local path or s3://bucket/key URI of a flood --manifest to measure the coverage of instead of every record set in the zone")
+			fs.DurationVar(&opts.LogsSince, "since", time.Hour, "How far back to read the query logs")
+			fs.DurationVar(&opts.LogsInterval, "interval", time.Minute, "Length of the intervals to report the QPS of")
+		},
+		validate: validateAnalyzeQueryLogs,
+		run:      runAnalyzeQueryLogs,
+	},
+}
+
+func zoneIDFlag(fs *flag.FlagSet, opts *Options) {
+	fs.StringVar(&opts.HostedZoneID, "hosted-zone-id", "", "Hosted Zone ID")
+}
+
+// verifyFlags registers the flags to resolve a sample of the record sets a run wrote once it wrote them
+func verifyFlags(fs *flag.FlagSet, opts *Options) {
+	fs.StringVar(&opts.VerifyResolver, "verify-resolver", "", "DNS resolver to resolve a sample of the written record sets against once they're written, e.g. 10.0.0.2 for a VPC's Route 53 Resolver")
+	fs.BoolVar(&opts.VerifyTestDNSAnswer, "verify-test-dns-answer", false, "Check the authoritative answer for a sample of the written record sets with the TestDNSAnswer API once they're written, public zones only")
+	fs.StringVar(&opts.VerifyEDNSSubnets, "verify-edns-subnets", "", "Comma-separated EDNS client subnets to check every record set from with --verify-test-dns-answer, e.g. 203.0.113.0/24")
+	fs.IntVar(&opts.VerifySample, "verify-sample", defaultVerifySample, "Written record sets to verify with --verify-resolver or --verify-test-dns-answer, 0 for all of them")
+	fs.DurationVar(&opts.VerifyTimeout, "verify-timeout", defaultVerifyTimeout, "How long to keep verifying record sets until they return their last written value")
+}
+
+func manifestIntervalFlag(fs *flag.FlagSet, opts *Options) {
+	fs.DurationVar(&opts.ManifestInterval, "manifest-interval", 0, "Also write the --manifest this often during the run, so that a query --check-answers run can follow the values it writes, 0 to only write it at the end")
+}
+
+func checkpointFlag(fs *flag.FlagSet, opts *Options) {
+	fs.StringVar(&opts.Checkpoint, "checkpoint", "", "Local path or s3://bucket/key URI of a checkpoint to resume the run from if it exists, kept up to date while the run goes on")
+}
+
+func vpcFlags(fs *flag.FlagSet, opts *Options) {
+	fs.StringVar(&opts.VPCID, "vpc-id", "", "VPC ID to associate the PHZ with if it doesn't already exist")
+	fs.BoolVar(&opts.CreateVPC, "create-vpc", false, "Create an ephemeral VPC to associate the PHZ with if it doesn't already exist (deleted along with the zone)")
+}
+
+func batchFlags(fs *flag.FlagSet, opts *Options) {
+	fs.IntVar(&opts.MaxBatchSize, "max-batch-size", 100, "Max batch size of resource record set changes in one API call (max is 1,000)")
+	fs.DurationVar(&opts.BatchDelay, "batch-delay-duration", 10*time.Second, "Duration of time between batch executions")
+	fs.BoolVar(&opts.CloudWatchMetrics, "cloudwatch-metrics", false, "Publish the changes, errors, and latency of every batch as CloudWatch metrics")
+	fs.StringVar(&opts.CloudWatchNamespace, "cloudwatch-namespace", defaultMetricsNamespace, "CloudWatch namespace to publish metrics to")
+	fs.BoolVar(&opts.CloudWatchDashboard, "cloudwatch-dashboard", false, "Create a CloudWatch dashboard of the run's metrics and the zone's query metrics, deleted when the run finishes. Implies --cloudwatch-metrics")
+	fs.StringVar(&opts.QueryLogGroup, "query-log-group", "", "CloudWatch Logs group the zone's queries are logged to, for the dashboard. Defaults to /aws/route53/<zone name> for public zones")
+	fs.StringVar(&opts.BatchCSV, "batch-csv", "", "Path to write a CSV row with the timing, change ID, and status or error of every batch to")
+	fs.StringVar(&opts.HTMLReport, "html-report", "", "Path to write a self-contained HTML report with charts of the run to, even if the run fails")
+	fs.StringVar(&opts.JUnitReport, "junit-report", "", "Path to write the outcome of the run and its assertions to as JUnit XML, even if the run fails")
+	historyDBFlag(fs, opts)
+	fs.BoolVar(&opts.NoHistory, "no-history", false, "Don't record the configuration and summary of the run in --history-db")
+	fs.StringVar(&opts.SNSTopicARN, "sns-topic-arn", "", "SNS topic to publish a message to when the run completes, fails, or is interrupted")
+	fs.StringVar(&opts.WebhookURL, "webhook-url", "", "URL to POST run start, milestone, and completion or failure events to")
+	fs.StringVar(&opts.WebhookFormat, "webhook-format", "json", fmt.Sprintf("Payload of --webhook-url: %s", strings.Join(webhookFormats, ", ")))
+	fs.IntVar(&opts.WebhookMilestone, "webhook-milestone-percent", 25, "Post a milestone event to --webhook-url every N percent of records done, 0 to disable")
+	fs.StringVar(&opts.BatchWebhookURL, "batch-webhook-url", "", "URL to POST the zone, action, size, latency, and change ID of every batch to as soon as it's answered")
+	fs.StringVar(&opts.OnRunStart, "on-run-start", "", "Shell command to run when the run starts, with the run event as JSON on stdin")
+	fs.StringVar(&opts.OnBatchSubmitted, "on-batch-submitted", "", "Shell command to run right before every change batch is submitted, with the batch as JSON on stdin")
+	fs.StringVar(&opts.OnBatchComplete, "on-batch-complete", "", "Shell command to run when every change batch is accepted, with the batch, latency, and change ID as JSON on stdin")
+	fs.StringVar(&opts.OnError, "on-error", "", "Shell command to run when a change batch or the run fails, with the batch or run event as JSON on stdin")
+	fs.StringVar(&opts.OnRunComplete, "on-run-complete", "", "Shell command to run when the run completes, fails, or is interrupted, with the run event and summary as JSON on stdin")
+	fs.DurationVar(&opts.HookTimeout, "hook-timeout", defaultHookTimeout, "How long to wait for each --on-* hook command before killing it")
+	fs.StringVar(&opts.EventBridgeBus, "eventbridge-bus", "", "Name or ARN of an EventBridge event bus to put run and per-batch events on")
+	fs.BoolVar(&opts.MeasurePropagation, "measure-propagation", false, "Poll GetChange for every batch and report how long the changes took to be INSYNC")
+	fs.DurationVar(&opts.PropagationInterval, "propagation-poll-interval", defaultPropagationPollInterval, "How often to poll GetChange for each pending batch with --measure-propagation")
+	fs.BoolVar(&opts.MeasureResolvable, "measure-resolvable", false, "Resolve a sample of the created and updated record sets from when their batch is submitted and report how long they took to return the new value")
+	fs.StringVar(&opts.ResolvableResolver, "resolvable-resolver", "", "Comma-separated DNS resolvers to resolve record sets against with --measure-resolvable, defaults to the system's resolvers")
+	fs.Float64Var(&opts.ResolvablePercent, "resolvable-sample-percent", defaultResolvableSamplePercent, "Percent of the created and updated record sets to resolve with --measure-resolvable")
+	fs.DurationVar(&opts.ResolvableInterval, "resolvable-poll-interval", defaultResolvablePollInterval, "How often to resolve each pending record set with --measure-resolvable")
+	fs.IntVar(&opts.AlarmThrottles, "alarm-throttles", 0, "Create a CloudWatch alarm for the run on this many throttled change batch requests per minute, 0 to disable. Implies --cloudwatch-metrics")
+	fs.StringVar(&opts.OnAlarm, "on-alarm", "abort", fmt.Sprintf("What to do when an alarm of the run fires, %s. Alarms also notify --sns-topic-arn", strings.Join(onAlarmActions, ", ")))
+	fs.IntVar(&opts.MaxErrors, "max-errors", 0, "Send an error-budget event to --sns-topic-arn, --webhook-url, and --eventbridge-bus once this many change batch attempts were throttled or failed, including the ones retried, 0 for no error budget")
+	fs.StringVar(&opts.OnErrorBudget, "on-error-budget", "notify", fmt.Sprintf("What to do once the run reaches --max-errors, %s", strings.Join(onAlarmActions, ", ")))
+	fs.BoolVar(&opts.Progress, "progress", false, "Show a progress bar with the rate and ETA instead of per-batch logs (plain logs when not attached to a terminal)")
+	fs.StringVar(&opts.WebDashboard, "web-dashboard", "", "Address to serve a live dashboard of the run on with controls to pause, resume, and abort it, e.g. localhost:8080, a bare :port serves it on every interface")
+	fs.BoolVar(&opts.TUI, "tui", false, "Show a full-screen dashboard of the run with a throughput graph, batch queue, zone stats, and recent errors instead of logs")
+}
+
+func runCreate(ctx context.Context, zone Zone, opts Options) error {
+	zoneID, err := createZone(ctx, zone, opts)
+	if err != nil {
+		return err
+	}
+	opts.HostedZoneID = zoneID
+	_, err = describeZone(ctx, zone, opts)
+	return err
+}
+
+func runFlood(ctx context.Context, zone Zone, opts Options) error {
+	opts, done := zone.Checkpoint.Resume(opts)
+	if done {
+		return nil
+	}
+	// Create a hosted zone if no hosted zone ID passed in by user
+	createdZone := opts.HostedZoneID == ""
+	if !createdZone {
+		// lock the zone before reading it, so that another run waiting for it floods from where this one left it
+		if err := zone.Coordinator.Lock(ctx, opts.HostedZoneID); err != nil {
+			return err
+		}
+		if err := validateRecordSetLimit(ctx, zone, opts); err != nil {
+			return err
+		}
+	} else {
+		zoneID, err := createZone(ctx, zone, opts)
+		if err != nil {
+			return err
+		}
+		opts.HostedZoneID = zoneID
+		zone.Checkpoint.RecordZone(ctx, zoneID)
+	}
+	hz, err := describeZone(ctx, zone, opts)
+	if err != nil {
+		return err
+	}
+	if createdZone {
+		zone.Terraform.AdoptZone(hz.HostedZone, hz.VPCs)
+	}
+	if opts.QueryLogging != "" {
+		if err := zone.EnableQueryLogging(ctx, hz.HostedZone, opts); err != nil {
+			return err
+		}
+	}
+	// Catch misconfigured associations before flooding rather than when queries from the VPC fail
+	if hz.HostedZone.Config != nil && hz.HostedZone.Config.PrivateZone {
+		if opts.VerifyTestDNSAnswer {
+			return errors.New("--verify-test-dns-answer only supports public hosted zones, use --verify-resolver for private ones")
+		}
+		if err := zone.VerifyVPCAssociations(ctx, hz.HostedZone, hz.VPCs); err != nil {
+			return fmt.Errorf("unable to verify VPC associations: %w", err)
+		}
+	}
+	rrCount := int(*hz.HostedZone.ResourceRecordSetCount)
+	start := rrCount
+	if opts.RecordGenerator == floodzone.GeneratorSequential {
+		if start, err = zone.SequentialStart(ctx, hz.HostedZone, opts.MaxBatchSize); err != nil {
+			return fmt.Errorf("unable to find where the sequential generator starts: %w", err)
+		}
+	}
+	generator, err := floodzone.NewGenerator(opts.RecordGenerator, floodzone.GeneratorOptions{ZoneName: *hz.HostedZone.Name, TypeMix: opts.TypeMix, Start: start})
+	if err != nil {
+		return err
+	}
+	zone.Generator = generator
+	if err := zone.GrowResourceRecordSets(ctx, hz.HostedZone, rrCount, opts.loadStages(), opts.TypeMix); err != nil {
+		return fmt.Errorf("unable to create resource record sets: %w", err)
+	}
+	zone.Resolution.Verify(ctx)
+	return nil
+}
+
+func runDelete(ctx context.Context, zone Zone, opts Options) error {
+	opts, done := zone.Checkpoint.Resume(opts)
+	if done {
+		return nil
+	}
+	if err := requireZoneID(opts); err != nil {
+		return err
+	}
+	if err := zone.Coordinator.Lock(ctx, opts.HostedZoneID); err != nil {
+		return err
+	}
+	hz, err := describeZone(ctx, zone, opts)
+	if err != nil {
+		return err
+	}
+	remainingRRS, err := zone.DeleteResourceRecordSets(ctx, hz.HostedZone, opts.MaxBatchSize, opts.TotalRecords, opts.BatchDelay)
+	if err != nil {
+		return fmt.Errorf("unable to delete resource record sets: %w", err)
+	}
+	// if there are no remaining resource record sets, delete the zone too
+	if remainingRRS == 0 {
+		return zone.DeleteHostedZone(ctx, hz.HostedZone, hz.VPCs)
+	}
+	return nil
+}
+
+func runChurn(ctx context.Context, zone Zone, opts Options) error {
+	opts, done := zone.Checkpoint.Resume(opts)
+	if done {
+		return nil
+	}
+	if err := requireZoneID(opts); err != nil {
+		return err
+	}
+	if err := zone.Coordinator.Lock(ctx, opts.HostedZoneID); err != nil {
+		return err
+	}
+	hz, err := describeZone(ctx, zone, opts)
+	if err != nil {
+		return err
+	}
+	if opts.VerifyTestDNSAnswer && hz.HostedZone.Config != nil && hz.HostedZone.Config.PrivateZone {
+		return errors.New("--verify-test-dns-answer only supports public hosted zones, use --verify-resolver for private ones")
+	}
+	if err := zone.ChurnResourceRecordSets(ctx, hz.HostedZone, opts.TotalRecords, opts.Iterations, opts.MaxBatchSize, opts.BatchDelay); err != nil {
+		return fmt.Errorf("unable to churn resource record sets: %w", err)
+	}
+	zone.Resolution.Verify(ctx)
+	return zone.Writes.Verify(ctx, zone, hz.HostedZone)
+}
+
+func runList(ctx context.Context, zone Zone, opts Options) error {
+	if err := requireZoneID(opts); err != nil {
+		return err
+	}
+	hz, err := zone.R53.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: &opts.HostedZoneID})
+	if err != nil {
+		return fmt.Errorf("unable to describe hosted zone: %w", err)
+	}
+	zone.Stats.RecordZone(opts.HostedZoneID)
+	// the record sets are printed page by page, so that zones with tens of thousands of them aren't held in memory
+	stream := newRecordStream(opts.Output, opts.MaxBatchSize)
+	if err := zone.WalkResourceRecordSets(ctx, hz.HostedZone, opts.MaxBatchSize, listFilter(opts), stream.Write); err != nil {
+		_ = stream.Close()
+		return fmt.Errorf("unable to list resource record sets: %w", err)
+	}
+	return stream.Close()
+}
+
+// listFilter returns the record sets the list command selects
+func listFilter(opts Options) floodzone.RecordSetFilter {
+	filter := floodzone.RecordSetFilter{Name: opts.ListName}
+	for _, rrType := range splitList(opts.ListTypes) {
+		filter.Types = append(filter.Types, types.RRType(strings.ToUpper(rrType)))
+	}
+	return filter
+}
+
+func runCleanup(ctx context.Context, zone Zone, opts Options) error {
+	if err := requireZoneID(opts); err != nil {
+		return err
+	}
+	if err := zone.Coordinator.Lock(ctx, opts.HostedZoneID); err != nil {
+		return err
+	}
+	hz, err := describeZone(ctx, zone, opts)
+	if err != nil {
+		return err
+	}
+	// only Cloud Map can change the record sets of the zones of its namespaces
+	if isCloudMapZone(hz.HostedZone) {
+		return zone.DeleteCloudMapNamespace(ctx, hz.HostedZone, hz.VPCs, defaultCloudMapRegisterRate)
+	}
+	// the record sets of traffic policy instances can only be deleted with their instance
+	keepAll := func(types.TrafficPolicyInstance) bool { return true }
+	if _, err := zone.DeleteTrafficPolicyInstances(ctx, *hz.HostedZone.Id, defaultTrafficPolicyRate, keepAll); err != nil {
+		return err
+	}
+	rrCount := int(*hz.HostedZone.ResourceRecordSetCount)
+	if _, err := zone.DeleteResourceRecordSets(ctx, hz.HostedZone, opts.MaxBatchSize, rrCount, opts.BatchDelay); err != nil {
+		return fmt.Errorf("unable to delete resource record sets: %w", err)
+	}
+	// the record sets referring to the health checks of the zone are gone, so they can be deleted too
+	if _, _, err := zone.DeleteHealthChecks(ctx, healthCheckZonePrefix(*hz.HostedZone.Id), defaultHealthCheckRate); err != nil {
+		return err
+	}
+	if err := zone.DeleteQueryLogging(ctx, opts.HostedZoneID); err != nil {
+		return err
+	}
+	return zone.DeleteHostedZone(ctx, hz.HostedZone, hz.VPCs)
+}
+
+func runReport(ctx context.Context, zone Zone, opts Options) error {
+	if opts.Compare != "" {
+		return runCompare(opts)
+	}
+	if err := requireZoneID(opts); err != nil {
+		return err
+	}
+	hz, err := describeZone(ctx, zone, opts)
+	if err != nil {
+		return err
+	}
+	if err := zone.VerifyVPCAssociations(ctx, hz.HostedZone, hz.VPCs); err != nil {
+		slog.Warn("unable to verify VPC associations", "error", err)
+	}
+	rrs, err := zone.ListResourceRecordSets(ctx, hz.HostedZone, opts.MaxBatchSize)
+	if err != nil {
+		return fmt.Errorf("unable to list resource record sets: %w", err)
+	}
+	countByType := map[types.RRType]int{}
+	for _, rr := range rrs {
+		countByType[rr.Type]++
+	}
+	rrTypes := make([]string, 0, len(countByType))
+	for rrType := range countByType {
+		rrTypes = append(rrTypes, string(rrType))
+	}
+	sort.Strings(rrTypes)
+	report := reportResult{Zone: opts.HostedZoneID, Types: []typeCount{}, Total: len(rrs)}
+	for _, rrType := range rrTypes {
+		report.Types = append(report.Types, typeCount{Type: rrType, RecordSets: countByType[types.RRType(rrType)]})
+	}
+	return printOutput(opts.Output, report)
+}
+
+// createZone creates a private hosted zone, and an ephemeral VPC for it if requested. The hosted zone ID is returned.
+func createZone(ctx context.Context, zone Zone, opts Options) (string, error) {
+	if err := validateZoneCreation(opts); err != nil {
+		return "", err
+	}
+	if opts.CreateVPC {
+		vpcID, err := zone.CreateEphemeralVPC(ctx)
+		if err != nil {
+			if vpcID != "" {
+				zone.cleanupEphemeralVPC(ctx, vpcID)
+			}
+			return "", fmt.Errorf("unable to create VPC: %w", err)
+		}
+		opts.VPCID = vpcID
+		slog.Info("✅ Successfully Created ephemeral VPC for the hosted zone", "vpc", vpcID)
+	}
+	zoneID, err := zone.CreatePrivateHostedZone(ctx, opts.VPCID, zone.Region)
+	if err != nil {
+		if opts.CreateVPC {
+			zone.cleanupEphemeralVPC(ctx, opts.VPCID)
+		}
+		return "", fmt.Errorf("unable to create hosted zone: %w", err)
+	}
+	slog.Info("✅ Successfully Created Hosted Zone to flood 🌊!", "zone", zoneID)
+	return zoneID, nil
+}
+
+func validateZoneCreation(opts Options) error {
+	if opts.VPCID != "" && opts.CreateVPC {
+		return errors.New("--vpc-id and --create-vpc are mutually exclusive")
+	}
+	if opts.VPCID == "" && !opts.CreateVPC {
+		return errors.New("--vpc-id or --create-vpc is required when --hosted-zone-id is not provided")
+	}
+	return nil
+}
+
+// describeZone describes and prints the hosted zone to stdout in the output format unless in quiet mode
+func describeZone(ctx context.Context, zone Zone, opts Options) (*route53.GetHostedZoneOutput, error) {
+	hz, err := zone.R53.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: &opts.HostedZoneID})
+	if err != nil {
+		return nil, fmt.Errorf("unable to describe hosted zone: %w", err)
+	}
+	zone.Stats.RecordZone(opts.HostedZoneID)
+	zone.Dashboard.AddZone(ctx, hz.HostedZone)
+	zone.TUI.AddZone(hz.HostedZone)
+	if err := zone.Alarms.AddZone(ctx, hz.HostedZone); err != nil {
+		return nil, err
+	}
+	// the dashboard shows the zone instead
+	if opts.Quiet || zone.TUI != nil {
+		return hz, nil
+	}
+	if err := printOutput(opts.Output, newZoneResult(hz)); err != nil {
+		return nil, err
+	}
+	return hz, nil
+}
+
+func requireZoneID(opts Options) error {
+	if opts.HostedZoneID == "" {
+		return errors.New("--hosted-zone-id is required")
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// regressionError is returned by report --compare when a metric of the run regressed beyond the threshold
+type regressionError struct {
+	metrics []string
+}
+
+func (e *regressionError) Error() string {
+	return fmt.Sprintf("%d metrics regressed beyond the threshold: %s", len(e.metrics), strings.Join(e.metrics, ", "))
+}
+
+// metricComparison is a metric of a run next to the same metric of the baseline run
+type metricComparison struct {
+	Metric   string  `json:"metric" yaml:"metric"`
+	Baseline float64 `json:"baseline" yaml:"baseline"`
+	Run      float64 `json:"run" yaml:"run"`
+	// ChangePercent is how much the metric changed relative to the baseline, it's not set when the baseline is 0
+	ChangePercent *float64 `json:"changePercent,omitempty" yaml:"changePercent,omitempty"`
+	Regression    bool     `json:"regression" yaml:"regression"`
+}
+
+// comparisonResult is the output of report --compare
+type comparisonResult struct {
+	Baseline         string             `json:"baseline" yaml:"baseline"`
+	Run              string             `json:"run" yaml:"run"`
+	ThresholdPercent float64            `json:"thresholdPercent" yaml:"thresholdPercent"`
+	Metrics          []metricComparison `json:"metrics" yaml:"metrics"`
+	Regressions      int                `json:"regressions" yaml:"regressions"`
+}
+
+// compareRuns compares the latency, throughput, and errors of a run with a baseline run. A metric regressed when it got
+// worse by more than thresholdPercent of the baseline.
+func compareRuns(baseline runSummary, run runSummary, thresholdPercent float64) comparisonResult {
+	result := comparisonResult{Baseline: baseline.RunID, Run: run.RunID, ThresholdPercent: thresholdPercent, Metrics: []metricComparison{}}
+	// higherIsWorse is false for metrics that regress by going down
+	add := func(metric string, baselineValue float64, runValue float64, higherIsWorse bool) {
+		comparison := metricComparison{Metric: metric, Baseline: baselineValue, Run: runValue}
+		worse := runValue - baselineValue
+		if !higherIsWorse {
+			worse = -worse
+		}
+		if baselineValue != 0 {
+			change := (runValue - baselineValue) / baselineValue * 100
+			comparison.ChangePercent = &change
+			comparison.Regression = worse/baselineValue*100 > thresholdPercent
+		} else {
+			// any amount is infinitely worse than none
+			comparison.Regression = worse > 0
+		}
+		if comparison.Regression {
+			result.Regressions++
+		}
+		result.Metrics = append(result.Metrics, comparison)
+	}
+	add("Throughput (changes/s)", throughput(baseline), throughput(run), false)
+	add("Latency mean (ms)", baseline.Latency.Mean, run.Latency.Mean, true)
+	add("Latency p50 (ms)", baseline.Latency.P50, run.Latency.P50, true)
+	add("Latency p90 (ms)", baseline.Latency.P90, run.Latency.P90, true)
+	add("Latency p99 (ms)", baseline.Latency.P99, run.Latency.P99, true)
+	add("Latency max (ms)", baseline.Latency.Max, run.Latency.Max, true)
+	add("Error rate (%)", errorRate(baseline), errorRate(run), true)
+	if baseline.Propagation != nil && run.Propagation != nil {
+		add("Propagation p50 (ms)", baseline.Propagation.P50, run.Propagation.P50, true)
+		add("Propagation p99 (ms)", baseline.Propagation.P99, run.Propagation.P99, true)
+	}
+	if baseline.Resolvable != nil && run.Resolvable != nil {
+		add("Resolvable p50 (ms)", baseline.Resolvable.P50, run.Resolvable.P50, true)
+		add("Resolvable p99 (ms)", baseline.Resolvable.P99, run.Resolvable.P99, true)
+	}
+	return result
+}
+
+// throughput is the changes made per second over the whole run
+func throughput(summary runSummary) float64 {
+	if summary.DurationSeconds <= 0 {
+		return 0
+	}
+	return float64(summary.Created+summary.Deleted+summary.Upserted) / summary.DurationSeconds
+}
+
+// errorRate is the percent of the change batches that failed
+func errorRate(summary runSummary) float64 {
+	if summary.Batches+summary.Errors == 0 {
+		return 0
+	}
+	return float64(summary.Errors) / float64(summary.Batches+summary.Errors) * 100
+}
+
+// err returns a regressionError naming the metrics that regressed, if any did
+func (r comparisonResult) err() error {
+	if r.Regressions == 0 {
+		return nil
+	}
+	var metrics []string
+	for _, m := range r.Metrics {
+		if m.Regression {
+			metrics = append(metrics, m.Metric)
+		}
+	}
+	return &regressionError{metrics: metrics}
+}
+
+func (r comparisonResult) writeTable(w io.Writer) {
+	fmt.Fprintf(w, "METRIC\tBASELINE %s\tRUN %s\tCHANGE\tREGRESSION\n", r.Baseline, r.Run)
+	for _, m := range r.Metrics {
+		change := "n/a"
+		if m.ChangePercent != nil {
+			change = fmt.Sprintf("%+.1f%%", *m.ChangePercent)
+		}
+		regression := ""
+		switch {
+		case m.Regression && m.ChangePercent == nil:
+			regression = "yes, none in baseline"
+		case m.Regression:
+			regression = fmt.Sprintf("yes, over %g%%", r.ThresholdPercent)
+		}
+		fmt.Fprintf(w, "%s\t%.2f\t%.2f\t%s\t%s\n", m.Metric, m.Baseline, m.Run, change, regression)
+	}
+}
+
+// runCompare compares the run with --compare-run, or the most recent run other than the baseline, with the baseline
+// run from the history
+func runCompare(opts Options) error {
+	path, err := historyDB(opts)
+	if err != nil {
+		return err
+	}
+	history, err := OpenHistory(path)
+	if err != nil {
+		return err
+	}
+	defer history.Close()
+	baseline, err := history.Get(opts.Compare)
+	if err != nil {
+		return err
+	}
+	runID := opts.CompareRun
+	if runID == "" {
+		recent, err := history.List(2)
+		if err != nil {
+			return err
+		}
+		for _, summary := range recent {
+			if summary.RunID != opts.Compare {
+				runID = summary.RunID
+				break
+			}
+		}
+		if runID == "" {
+			return errors.New("there is no run other than the baseline in the history to compare, set --compare-run")
+		}
+	}
+	run, err := history.Get(runID)
+	if err != nil {
+		return err
+	}
+	result := compareRuns(baseline.Summary, run.Summary, opts.RegressionThreshold)
+	if err := printOutput(opts.Output, result); err != nil {
+		return err
+	}
+	return result.err()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var completionShells = []string{"bash", "zsh", "fish"}
+
+func init() {
+	// registered in init since the completion scripts are generated from the commands list itself
+	commands = append(commands, command{
+		name:        "completion",
+		description: fmt.Sprintf("Print a shell completion script (%s)", strings.Join(completionShells, ", ")),
+		runLocal:    runCompletion,
+	})
+}
+
+// completionFlag is the subset of a flag needed to generate completions
+type completionFlag struct {
+	name        string
+	description string
+	takesValue  bool
+}
+
+func runCompletion(_ context.Context, _ Options, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected one shell argument, one of: %s", strings.Join(completionShells, ", "))
+	}
+	var script string
+	switch args[0] {
+	case "bash":
+		script = bashCompletion()
+	case "zsh":
+		script = zshCompletion()
+	case "fish":
+		script = fishCompletion()
+	default:
+		return errors.New("unsupported shell " + args[0])
+	}
+	_, err := fmt.Fprint(os.Stdout, script)
+	return err
+}
+
+// commandFlags returns the flags of a command, including the global flags
+func commandFlags(cmd command) []completionFlag {
+	fs := newFlagSet(cmd, &Options{}, &globalFlags{})
+	var flags []completionFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flags = append(flags, completionFlag{
+			name:        f.Name,
+			description: f.Usage,
+			takesValue:  !ok || !boolFlag.IsBoolFlag(),
+		})
+	})
+	return flags
+}
+
+func commandNames() []string {
+	var names []string
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+	}
+	return names
+}
+
+func bashCompletion() string {
+	var b strings.Builder
+	b.WriteString("# bash completion for floodzone\n")
+	b.WriteString("_floodzone() {\n")
+	b.WriteString("    local cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	b.WriteString("    if [[ ${COMP_CWORD} -eq 1 ]]; then\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W \"%s\" -- \"${cur}\"))\n", strings.Join(commandNames(), " "))
+	b.WriteString("        return\n")
+	b.WriteString("    fi\n")
+	b.WriteString("    case \"${COMP_WORDS[1]}\" in\n")
+	for _, cmd := range commands {
+		var words []string
+		for _, f := range commandFlags(cmd) {
+			words = append(words, "--"+f.name)
+		}
+		if cmd.name == "completion" {
+			words = completionShells
+		}
+		fmt.Fprintf(&b, "    %s)\n        COMPREPLY=($(compgen -W \"%s\" -- \"${cur}\"))\n        ;;\n", cmd.name, strings.Join(words, " "))
+	}
+	b.WriteString("    esac\n")
+	b.WriteString("}\n")
+	b.WriteString("complete -o default -F _floodzone floodzone\n")
+	return b.String()
+}
+
+func zshCompletion() string {
+	escape := strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`)
+	var b strings.Builder
+	b.WriteString("#compdef floodzone\n\n")
+	b.WriteString("_floodzone() {\n")
+	b.WriteString("    local -a commands\n")
+	b.WriteString("    commands=(\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&b, "        '%s:%s'\n", cmd.name, escape.Replace(cmd.description))
+	}
+	b.WriteString("    )\n")
+	b.WriteString("    if (( CURRENT == 2 )); then\n")
+	b.WriteString("        _describe 'command' commands\n")
+	b.WriteString("        return\n")
+	b.WriteString("    fi\n")
+	b.WriteString("    case ${words[2]} in\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&b, "    %s)\n        _arguments", cmd.name)
+		if cmd.name == "completion" {
+			fmt.Fprintf(&b, " '2:shell:(%s)'", strings.Join(completionShells, " "))
+		}
+		for _, f := range commandFlags(cmd) {
+			spec := fmt.Sprintf("--%s[%s]", f.name, escape.Replace(f.description))
+			if f.takesValue {
+				spec += ":" + f.name + ":"
+			}
+			fmt.Fprintf(&b, " \\\n            '%s'", spec)
+		}
+		b.WriteString("\n        ;;\n")
+	}
+	b.WriteString("    esac\n")
+	b.WriteString("}\n\n")
+	b.WriteString("_floodzone \"$@\"\n")
+	return b.String()
+}
+
+func fishCompletion() string {
+	escape := strings.NewReplacer("'", `\'`)
+	var b strings.Builder
+	b.WriteString("# fish completion for floodzone\n")
+	b.WriteString("complete -c floodzone -f\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&b, "complete -c floodzone -n __fish_use_subcommand -a %s -d '%s'\n", cmd.name, escape.Replace(cmd.description))
+	}
+	for _, cmd := range commands {
+		condition := fmt.Sprintf("'__fish_seen_subcommand_from %s'", cmd.name)
+		if cmd.name == "completion" {
+			fmt.Fprintf(&b, "complete -c floodzone -n %s -a '%s'\n", condition, strings.Join(completionShells, " "))
+		}
+		for _, f := range commandFlags(cmd) {
+			line := fmt.Sprintf("complete -c floodzone -n %s -l %s -d '%s'", condition, f.name, escape.Replace(f.description))
+			if f.takesValue {
+				line += " -r"
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/bwagner5/floodzone/pkg/floodzone"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the config file representation of the command line flags. JSON files are parsed as YAML.
+type Config struct {
+	Options         `yaml:",inline"`
+	Region          string `yaml:"region"`
+	Profile         string `yaml:"profile"`
+	AssumeRoleARN   string `yaml:"assume-role-arn"`
+	ExternalID      string `yaml:"external-id"`
+	RoleSessionName string `yaml:"role-session-name"`
+}
+
+// LoadStage is one step of a load profile which grows the zone to TotalRecords with its own pacing. Zero values fall
+// back to the top-level options.
+type LoadStage = floodzone.LoadStage
+
+// ZoneOptions overrides the top-level options for one of multiple zones in a config file
+type ZoneOptions struct {
+	HostedZoneID string               `yaml:"hosted-zone-id"`
+	VPCID        string               `yaml:"vpc-id"`
+	CreateVPC    bool                 `yaml:"create-vpc"`
+	TotalRecords int                  `yaml:"total-records"`
+	TypeMix      map[types.RRType]int `yaml:"type-mix"`
+	LoadProfile  []LoadStage          `yaml:"load-profile"`
+}
+
+// loadConfig reads the config file at path on top of opts and the global flags. Values not set in the file are left
+// untouched.
+func loadConfig(path string, opts *Options, global *globalFlags) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := parseConfig(data, opts, global); err != nil {
+		return fmt.Errorf("unable to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// parseConfig reads a YAML or JSON config on top of opts and the global flags
+func parseConfig(data []byte, opts *Options, global *globalFlags) error {
+	cfg := Config{
+		Options:         *opts,
+		Region:          global.region,
+		Profile:         global.profile,
+		AssumeRoleARN:   global.assumeRoleARN,
+		ExternalID:      global.externalID,
+		RoleSessionName: global.roleSessionName,
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+	for rrType := range cfg.TypeMix {
+		if !floodzone.SupportedRecordType(rrType) {
+			return fmt.Errorf("unsupported record type %q in type-mix", rrType)
+		}
+	}
+	for _, zone := range cfg.Zones {
+		for rrType := range zone.TypeMix {
+			if !floodzone.SupportedRecordType(rrType) {
+				return fmt.Errorf("unsupported record type %q in type-mix of zone %q", rrType, zone.HostedZoneID)
+			}
+		}
+	}
+	*opts = cfg.Options
+	global.region = cfg.Region
+	global.profile = cfg.Profile
+	global.assumeRoleARN = cfg.AssumeRoleARN
+	global.externalID = cfg.ExternalID
+	global.roleSessionName = cfg.RoleSessionName
+	return nil
+}
+
+// forZone returns a copy of the options with the zone specific overrides applied
+func (o Options) forZone(zone ZoneOptions) Options {
+	o.Zones = nil
+	o.HostedZoneID = zone.HostedZoneID
+	if zone.VPCID != "" || zone.CreateVPC {
+		o.VPCID = zone.VPCID
+		o.CreateVPC = zone.CreateVPC
+	}
+	if zone.TotalRecords != 0 {
+		o.TotalRecords = zone.TotalRecords
+	}
+	if len(zone.TypeMix) != 0 {
+		o.TypeMix = zone.TypeMix
+	}
+	if len(zone.LoadProfile) != 0 {
+		o.LoadProfile = zone.LoadProfile
+	}
+	return o
+}
+
+// loadStages returns the load profile with zero values defaulted, or a single stage built from the options when no
+// load profile is configured
+func (o Options) loadStages() []LoadStage {
+	if len(o.LoadProfile) == 0 {
+		return []LoadStage{{TotalRecords: o.TotalRecords, MaxBatchSize: o.MaxBatchSize, BatchDelay: o.BatchDelay}}
+	}
+	var stages []LoadStage
+	for _, stage := range o.LoadProfile {
+		if stage.TotalRecords == 0 {
+			stage.TotalRecords = o.TotalRecords
+		}
+		if stage.MaxBatchSize == 0 {
+			stage.MaxBatchSize = o.MaxBatchSize
+		}
+		if stage.BatchDelay == 0 {
+			stage.BatchDelay = o.BatchDelay
+		}
+		stages = append(stages, stage)
+	}
+	return stages
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/smithy-go/middleware"
+)
+
+const (
+	// lockLease is how long a zone lock is held without being renewed, so that the lock of a run that was killed
+	// expires, and lockRenewInterval how often the run renews it
+	lockLease         = time.Minute
+	lockRenewInterval = lockLease / 3
+	// lockRetryInterval is how often a locked zone is tried again with --lock-wait
+	lockRetryInterval = 5 * time.Second
+	// rateWindowTTL is how long the counter of a second of the shared rate limit is kept before DynamoDB expires it
+	rateWindowTTL = time.Minute
+)
+
+// Coordinator coordinates the runs that share a DynamoDB table: it locks every zone a run changes so that two runs
+// never change the same zone at the same time, and keeps a ledger of the Route 53 API calls of every second so that
+// all the runs and workers together make at most the shared rate limit of calls. The table needs a string partition
+// key named pk, and expiresAt as its TTL attribute to clean up expired items. A nil Coordinator is a no-op.
+type Coordinator struct {
+	client  *dynamodb.Client
+	table   string
+	runID   string
+	command string
+	host    string
+	wait    time.Duration
+	rate    int
+	mu      sync.Mutex
+	// locks are the zones the run holds, and lost the error of a zone whose lock couldn't be renewed
+	locks map[string]bool
+	lost  map[string]error
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewCoordinator returns a Coordinator of the run on the table, that waits up to wait for a locked zone and allows
+// rate Route 53 API calls per second, 0 for no shared limit
+func NewCoordinator(client *dynamodb.Client, table string, runID string, command string, wait time.Duration, rate int) *Coordinator {
+	host, _ := os.Hostname()
+	c := &Coordinator{
+		client:  client,
+		table:   table,
+		runID:   runID,
+		command: command,
+		host:    host,
+		wait:    wait,
+		rate:    rate,
+		locks:   map[string]bool{},
+		lost:    map[string]error{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go c.renewEvery(lockRenewInterval)
+	return c
+}
+
+// Lock locks the zone for the run if it doesn't hold it yet, waiting up to --lock-wait while another run holds it. It
+// fails if the run lost the lock since it took it.
+func (c *Coordinator) Lock(ctx context.Context, hostedZoneID string) error {
+	if c == nil {
+		return nil
+	}
+	hostedZoneID = strings.TrimPrefix(hostedZoneID, "/hostedzone/")
+	c.mu.Lock()
+	held, lost := c.locks[hostedZoneID], c.lost[hostedZoneID]
+	c.mu.Unlock()
+	if lost != nil {
+		return lost
+	}
+	if held {
+		return nil
+	}
+	deadline := time.Now().Add(c.wait)
+	for {
+		err := c.acquire(ctx, hostedZoneID)
+		if err == nil {
+			break
+		}
+		var locked *zoneLockedError
+		if !errors.As(err, &locked) || time.Now().Add(lockRetryInterval).After(deadline) {
+			return err
+		}
+		slog.Info("🔒 Waiting for another run to release the zone", "zone", hostedZoneID, "runId", locked.RunID, "command", locked.Command, "host", locked.Host)
+		if err := sleep(ctx, lockRetryInterval); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	c.locks[hostedZoneID] = true
+	c.mu.Unlock()
+	slog.Info("🔒 Locked the zone for the run", "zone", hostedZoneID, "table", c.table)
+	return nil
+}
+
+// zoneLockedError is returned when another run holds the lock of a zone
+type zoneLockedError struct {
+	HostedZoneID string
+	RunID        string
+	Command      string
+	Host         string
+	ExpiresAt    time.Time
+}
+
+func (e *zoneLockedError) Error() string {
+	return fmt.Sprintf("the zone %s is locked by the %s run %s on %s until %s", e.HostedZoneID, e.Command, e.RunID, e.Host, e.ExpiresAt.Format(time.RFC3339))
+}
+
+// acquire puts the lock of the zone if nobody holds it, its lease expired, or the run already holds it, e.g. when an
+// earlier step of the same run took it
+func (c *Coordinator) acquire(ctx context.Context, hostedZoneID string) error {
+	now := time.Now()
+	_, err := c.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(c.table),
+		Item: map[string]dynamodbtypes.AttributeValue{
+			"pk":         &dynamodbtypes.AttributeValueMemberS{Value: lockKey(hostedZoneID)},
+			"runId":      &dynamodbtypes.AttributeValueMemberS{Value: c.runID},
+			"command":    &dynamodbtypes.AttributeValueMemberS{Value: c.command},
+			"host":       &dynamodbtypes.AttributeValueMemberS{Value: c.host},
+			"acquiredAt": &dynamodbtypes.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339)},
+			"expiresAt":  epochValue(now.Add(lockLease)),
+		},
+		ConditionExpression: aws.String("attribute_not_exists(pk) OR expiresAt < :now OR runId = :runId"),
+		ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+			":now":   epochValue(now),
+			":runId": &dynamodbtypes.AttributeValueMemberS{Value: c.runID},
+		},
+	})
+	var failed *dynamodbtypes.ConditionalCheckFailedException
+	if errors.As(err, &failed) {
+		return c.holder(ctx, hostedZoneID)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to lock the zone %s: %w", hostedZoneID, err)
+	}
+	return nil
+}
+
+// holder returns the error describing the run that holds the lock of the zone
+func (c *Coordinator) holder(ctx context.Context, hostedZoneID string) error {
+	out, err := c.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(c.table),
+		Key:            map[string]dynamodbtypes.AttributeValue{"pk": &dynamodbtypes.AttributeValueMemberS{Value: lockKey(hostedZoneID)}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to describe the lock of the zone %s: %w", hostedZoneID, err)
+	}
+	locked := &zoneLockedError{HostedZoneID: hostedZoneID}
+	if value, ok := out.Item["runId"].(*dynamodbtypes.AttributeValueMemberS); ok {
+		locked.RunID = value.Value
+	}
+	if value, ok := out.Item["command"].(*dynamodbtypes.AttributeValueMemberS); ok {
+		locked.Command = value.Value
+	}
+	if value, ok := out.Item["host"].(*dynamodbtypes.AttributeValueMemberS); ok {
+		locked.Host = value.Value
+	}
+	if value, ok := out.Item["expiresAt"].(*dynamodbtypes.AttributeValueMemberN); ok {
+		if seconds, err := strconv.ParseInt(value.Value, 10, 64); err == nil {
+			locked.ExpiresAt = time.Unix(seconds, 0)
+		}
+	}
+	return locked
+}
+
+// renewEvery renews the leases of the locks the run holds every interval until the coordinator is closed
+func (c *Coordinator) renewEvery(interval time.Duration) {
+	defer close(c.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.renew(context.Background())
+		}
+	}
+}
+
+// renew extends the lease of every lock the run holds. A lock another run took over, because the lease expired while
+// e.g. the run's host was suspended, is lost and the next change batch of its zone fails.
+func (c *Coordinator) renew(ctx context.Context) {
+	for _, hostedZoneID := range c.held() {
+		_, err := c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:           aws.String(c.table),
+			Key:                 map[string]dynamodbtypes.AttributeValue{"pk": &dynamodbtypes.AttributeValueMemberS{Value: lockKey(hostedZoneID)}},
+			UpdateExpression:    aws.String("SET expiresAt = :expiresAt"),
+			ConditionExpression: aws.String("runId = :runId"),
+			ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+				":expiresAt": epochValue(time.Now().Add(lockLease)),
+				":runId":     &dynamodbtypes.AttributeValueMemberS{Value: c.runID},
+			},
+		})
+		var failed *dynamodbtypes.ConditionalCheckFailedException
+		switch {
+		case errors.As(err, &failed):
+			lost := fmt.Errorf("lost the lock of the zone %s: %w", hostedZoneID, c.holder(ctx, hostedZoneID))
+			slog.Error("unable to renew the zone lock", "zone", hostedZoneID, "error", lost)
+			c.mu.Lock()
+			delete(c.locks, hostedZoneID)
+			c.lost[hostedZoneID] = lost
+			c.mu.Unlock()
+		case err != nil:
+			slog.Warn("unable to renew the zone lock", "zone", hostedZoneID, "error", err)
+		}
+	}
+}
+
+func (c *Coordinator) held() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	zones := make([]string, 0, len(c.locks))
+	for hostedZoneID := range c.locks {
+		zones = append(zones, hostedZoneID)
+	}
+	return zones
+}
+
+// Close releases the locks the run holds. Failures are only logged since the leases expire anyway.
+func (c *Coordinator) Close(ctx context.Context) {
+	if c == nil {
+		return
+	}
+	close(c.stop)
+	<-c.done
+	for _, hostedZoneID := range c.held() {
+		_, err := c.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName:           aws.String(c.table),
+			Key:                 map[string]dynamodbtypes.AttributeValue{"pk": &dynamodbtypes.AttributeValueMemberS{Value: lockKey(hostedZoneID)}},
+			ConditionExpression: aws.String("runId = :runId"),
+			ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+				":runId": &dynamodbtypes.AttributeValueMemberS{Value: c.runID},
+			},
+		})
+		var failed *dynamodbtypes.ConditionalCheckFailedException
+		if err != nil && !errors.As(err, &failed) {
+			slog.Warn("unable to release the zone lock", "zone", hostedZoneID, "error", err)
+			continue
+		}
+		slog.Debug("Released the zone lock", "zone", hostedZoneID)
+	}
+}
+
+// Wait takes a Route 53 API call from the shared rate limit, waiting for the next second while the runs sharing the
+// table already made the limit's calls in this one. The seconds are those of the clocks of the runs, so the limit is
+// only as precise as they're in sync.
+func (c *Coordinator) Wait(ctx context.Context) error {
+	if c == nil || c.rate == 0 {
+		return nil
+	}
+	for {
+		window := time.Now().Unix()
+		_, err := c.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:           aws.String(c.table),
+			Key:                 map[string]dynamodbtypes.AttributeValue{"pk": &dynamodbtypes.AttributeValueMemberS{Value: "rate#" + strconv.FormatInt(window, 10)}},
+			UpdateExpression:    aws.String("ADD calls :one SET expiresAt = :expiresAt"),
+			ConditionExpression: aws.String("attribute_not_exists(calls) OR calls < :rate"),
+			ExpressionAttributeValues: map[string]dynamodbtypes.AttributeValue{
+				":one":       &dynamodbtypes.AttributeValueMemberN{Value: "1"},
+				":rate":      &dynamodbtypes.AttributeValueMemberN{Value: strconv.Itoa(c.rate)},
+				":expiresAt": epochValue(time.Unix(window, 0).Add(rateWindowTTL)),
+			},
+		})
+		var failed *dynamodbtypes.ConditionalCheckFailedException
+		if !errors.As(err, &failed) {
+			if err != nil {
+				return fmt.Errorf("unable to take a call from the shared rate limit: %w", err)
+			}
+			return nil
+		}
+		if err := sleep(ctx, time.Until(time.Unix(window+1, 0))); err != nil {
+			return err
+		}
+	}
+}
+
+// route53Option adds a middleware to the Route 53 client that takes every attempt of every call from the shared rate
+// limit, so that retries count too
+func (c *Coordinator) route53Option(o *route53.Options) {
+	if c == nil || c.rate == 0 {
+		return
+	}
+	o.APIOptions = append(o.APIOptions, c.middleware)
+}
+
+func (c *Coordinator) middleware(stack *middleware.Stack) error {
+	return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("FloodzoneSharedRateLimit", func(ctx context.Context, in middleware.FinalizeInput,
+		next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		// the ledger's own call mustn't see the stack values of the Route 53 call, like its operation name
+		if err := c.Wait(middleware.ClearStackValues(ctx)); err != nil {
+			return middleware.FinalizeOutput{}, middleware.Metadata{}, err
+		}
+		return next.HandleFinalize(ctx, in)
+	}), middleware.After)
+}
+
+func lockKey(hostedZoneID string) string {
+	return "zone#" + hostedZoneID
+}
+
+func epochValue(t time.Time) dynamodbtypes.AttributeValue {
+	return &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(t.Unix(), 10)}
+}
+
+// sleep waits for d, or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// pacedCallConcurrency is the most calls of paceCalls waiting for an answer at the same time
+const pacedCallConcurrency = 50
+
+// paceCalls calls fn for 0 through n-1 at rate calls per second, with up to pacedCallConcurrency calls at the same time.
+// The first error stops the calls that haven't started and is returned once the started ones finish.
+func paceCalls(ctx context.Context, n int, rate float64, fn func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	defer ticker.Stop()
+	sem := make(chan struct{}, pacedCallConcurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+			case <-ticker.C:
+			}
+		}
+		select {
+		case <-ctx.Done():
+		case sem <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(ctx, i); err != nil {
+				cancel(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	return context.Cause(ctx)
+}
+
+// validateCoordination validates the flags of the coordination table
+func validateCoordination(opts Options) error {
+	var errs []error
+	if opts.SharedRateLimit < 0 {
+		errs = append(errs, fmt.Errorf("--shared-rate-limit must be 0 or more, got %d", opts.SharedRateLimit))
+	}
+	if opts.LockWait < 0 {
+		errs = append(errs, fmt.Errorf("--lock-wait must be 0 or more, got %s", opts.LockWait))
+	}
+	if opts.CoordinationTable == "" && (opts.SharedRateLimit != 0 || opts.LockWait != 0) {
+		errs = append(errs, errors.New("--shared-rate-limit and --lock-wait need --coordination-table"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// The Route 53 prices the --dry-run cost estimate uses, those of the first tier of us-east-1 in USD
+const (
+	// hoursPerMonth is how many hours AWS prorates monthly charges over
+	hoursPerMonth = 730
+	// defaultCostLifetime is how long the resources of a run are expected to exist by default, until they're cleaned up
+	defaultCostLifetime = 24 * time.Hour
+	// hostedZoneMonthlyPrice is charged for every hosted zone in full for the month it's created in, unless it's deleted
+	// within hostedZoneFreeLifetime
+	hostedZoneMonthlyPrice = 0.50
+	hostedZoneFreeLifetime = 12 * time.Hour
+	// standardQueryPrice is charged for every million queries Route 53 answers for the record sets of a zone
+	standardQueryPrice = 0.40
+	// basicHealthCheckPrice is charged monthly for every health check of an endpoint outside of AWS, and
+	// healthCheckFeaturePrice for every optional feature it has: HTTPS, string matching, fast interval, and latency
+	// measurement. Calculated and CLOUDWATCH_METRIC health checks are charged derivedHealthCheckPrice.
+	basicHealthCheckPrice   = 0.75
+	healthCheckFeaturePrice = 2.00
+	derivedHealthCheckPrice = 0.50
+	// trafficPolicyRecordPrice is charged monthly for every traffic policy instance, the traffic policies themselves
+	// are free
+	trafficPolicyRecordPrice = 50.00
+)
+
+// costEstimate is what the resources a run creates and the queries it sends are expected to cost
+type costEstimate struct {
+	// LifetimeHours is how long the resources are expected to exist, to prorate their monthly charges
+	LifetimeHours float64    `json:"lifetimeHours" yaml:"lifetimeHours"`
+	Items         []costItem `json:"items" yaml:"items"`
+	TotalUSD      float64    `json:"totalUSD" yaml:"totalUSD"`
+	// queriesUSD is the part of the total that the queries cost, which a CostBudget charges as they're sent
+	queriesUSD float64
+}
+
+// costItem is the cost of some resources of the same price, or of the queries
+type costItem struct {
+	Resource string  `json:"resource" yaml:"resource"`
+	Quantity int     `json:"quantity" yaml:"quantity"`
+	Price    string  `json:"price" yaml:"price"`
+	USD      float64 `json:"usd" yaml:"usd"`
+}
+
+func newCostEstimate(opts Options) *costEstimate {
+	return &costEstimate{LifetimeHours: opts.CostLifetime.Hours(), Items: []costItem{}}
+}
+
+func (c *costEstimate) add(item costItem) {
+	if item.Quantity <= 0 {
+		return
+	}
+	c.Items = append(c.Items, item)
+	c.TotalUSD += item.USD
+}
+
+// prorate returns the charge for quantity resources of a monthly price over the lifetime of the estimate
+func (c *costEstimate) prorate(quantity int, monthlyPrice float64) float64 {
+	return float64(quantity) * monthlyPrice * c.LifetimeHours / hoursPerMonth
+}
+
+// addHostedZones adds the charge of new hosted zones, which AWS doesn't prorate
+func (c *costEstimate) addHostedZones(zones int) {
+	item := costItem{Resource: "Hosted zones", Quantity: zones, Price: fmt.Sprintf("$%.2f/month, free if deleted within %.0f hours", hostedZoneMonthlyPrice, hostedZoneFreeLifetime.Hours())}
+	if c.LifetimeHours > hostedZoneFreeLifetime.Hours() {
+		item.USD = float64(zones) * hostedZoneMonthlyPrice
+	}
+	c.add(item)
+}
+
+// addQueries adds the charge of the queries, an upper bound since the queries resolvers answer from their cache don't
+// reach Route 53
+func (c *costEstimate) addQueries(queries int) {
+	item := costItem{Resource: "Standard queries", Quantity: queries, Price: fmt.Sprintf("$%.2f/million", standardQueryPrice),
+		USD: queriesCost(int64(queries))}
+	c.add(item)
+	c.queriesUSD += item.USD
+}
+
+func queriesCost(queries int64) float64 {
+	return float64(queries) * standardQueryPrice / 1_000_000
+}
+
+// addHealthChecks adds the charge of the health checks of the matrix and of the calculated health checks over them,
+// grouped by their features. The targets are assumed to be outside of AWS, whose health checks cost more.
+func (c *costEstimate) addHealthChecks(matrix healthCheckMatrix, opts Options, calculated int) {
+	var resources []string
+	quantities := map[string]int{}
+	prices := map[string]float64{}
+	for i := range opts.HealthChecks {
+		config := matrix.config(opts, i)
+		resource, price := string(config.Type)+" health checks", derivedHealthCheckPrice
+		if config.Type != types.HealthCheckTypeCloudwatchMetric {
+			// HTTPS and string matching are features of the type, the others are named after it
+			typeFeatures := 0
+			if config.Type == types.HealthCheckTypeHttps || config.Type == types.HealthCheckTypeHttpsStrMatch {
+				typeFeatures++
+			}
+			if config.SearchString != nil {
+				typeFeatures++
+			}
+			var features []string
+			if *config.RequestInterval == 10 {
+				features = append(features, "fast interval")
+			}
+			if *config.MeasureLatency {
+				features = append(features, "latency")
+			}
+			price = basicHealthCheckPrice + float64(typeFeatures+len(features))*healthCheckFeaturePrice
+			if len(features) > 0 {
+				resource += " (" + strings.Join(features, ", ") + ")"
+			}
+		}
+		if quantities[resource] == 0 {
+			resources = append(resources, resource)
+		}
+		quantities[resource]++
+		prices[resource] = price
+	}
+	slices.Sort(resources)
+	for _, resource := range resources {
+		c.add(costItem{Resource: resource, Quantity: quantities[resource], Price: fmt.Sprintf("$%.2f/month", prices[resource]),
+			USD: c.prorate(quantities[resource], prices[resource])})
+	}
+	c.add(costItem{Resource: "CALCULATED health checks", Quantity: calculated, Price: fmt.Sprintf("$%.2f/month", derivedHealthCheckPrice),
+		USD: c.prorate(calculated, derivedHealthCheckPrice)})
+}
+
+// addTrafficPolicyRecords adds the charge of traffic policy instances
+func (c *costEstimate) addTrafficPolicyRecords(instances int) {
+	c.add(costItem{Resource: "Traffic policy records", Quantity: instances, Price: fmt.Sprintf("$%.2f/month", trafficPolicyRecordPrice),
+		USD: c.prorate(instances, trafficPolicyRecordPrice)})
+}
+
+func (c costEstimate) writeTable(w io.Writer) {
+	fmt.Fprintf(w, "Estimated cost with the resources kept for %s:\n\n", time.Duration(c.LifetimeHours*float64(time.Hour)))
+	fmt.Fprintln(w, "RESOURCE\tQUANTITY\tPRICE\tUSD")
+	for _, item := range c.Items {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", item.Resource, item.Quantity, item.Price, usd(item.USD))
+	}
+	fmt.Fprintf(w, "TOTAL\t\t\t%s\n", usd(c.TotalUSD))
+}
+
+// usd formats an amount of dollars to the cent
+func usd(amount float64) string {
+	return fmt.Sprintf("$%.2f", amount)
+}
+
+// budgetUSD formats an amount of dollars compared with a --max-cost of maxUSD, to the cent unless the budget is more
+// precise, so that e.g. a budget of $0.0001 isn't shown as $0.00
+func budgetUSD(amount float64, maxUSD float64) string {
+	if maxUSD == math.Round(maxUSD*100)/100 {
+		return usd(amount)
+	}
+	return fmt.Sprintf("$%.4g", amount)
+}
+
+// budgetError is the cause of a run stopped by --max-cost. It wraps context.Canceled so the run is reported as aborted.
+type budgetError struct {
+	spentUSD float64
+	maxUSD   float64
+}
+
+func (e *budgetError) Error() string {
+	return fmt.Sprintf("the run cost %s, over the --max-cost of %s", budgetUSD(e.spentUSD, e.maxUSD), budgetUSD(e.maxUSD, e.maxUSD))
+}
+
+func (e *budgetError) Unwrap() error {
+	return context.Canceled
+}
+
+// CostBudget stops the run once what it cost goes over --max-cost: the charges of the resources it creates, estimated
+// before it starts, the queries it sends from this host as they're sent, and those of its query workers as every worker
+// reports back. Route 53 doesn't charge for changes, so flood, churn, and delete runs only spend on the queries that
+// measure them. A nil CostBudget is a no-op.
+type CostBudget struct {
+	maxUSD       float64
+	resourcesUSD float64
+	queries      atomic.Int64
+	cancel       context.CancelCauseFunc
+	once         sync.Once
+}
+
+// NewCostBudget returns a budget of maxUSD for the runs of the plans, refusing to start them if their estimated cost is
+// already over it
+func NewCostBudget(maxUSD float64, plans []executionPlan) (*CostBudget, error) {
+	b := &CostBudget{maxUSD: maxUSD}
+	estimatedUSD := 0.0
+	for _, plan := range plans {
+		estimatedUSD += plan.Cost.TotalUSD
+		b.resourcesUSD += plan.Cost.TotalUSD - plan.Cost.queriesUSD
+	}
+	if estimatedUSD > maxUSD {
+		return nil, fmt.Errorf("the estimated cost of the run is %s, over the --max-cost of %s, preview it with --dry-run", budgetUSD(estimatedUSD, maxUSD), budgetUSD(maxUSD, maxUSD))
+	}
+	slog.Info("💰 The estimated cost of the run is within its budget", "estimated", budgetUSD(estimatedUSD, maxUSD), "maxCost", budgetUSD(maxUSD, maxUSD))
+	return b, nil
+}
+
+// Watch returns a context that is canceled with a budgetError once the run goes over its budget
+func (b *CostBudget) Watch(ctx context.Context) context.Context {
+	if b == nil {
+		return ctx
+	}
+	ctx, b.cancel = context.WithCancelCause(ctx)
+	return ctx
+}
+
+// AddQueries charges the budget for queries sent, stopping the run if it goes over
+func (b *CostBudget) AddQueries(queries int) {
+	if b == nil {
+		return
+	}
+	spent := b.resourcesUSD + queriesCost(b.queries.Add(int64(queries)))
+	if spent <= b.maxUSD || b.cancel == nil {
+		return
+	}
+	b.once.Do(func() {
+		slog.Warn("💸 The run went over its budget, stopping it", "spent", budgetUSD(spent, b.maxUSD), "maxCost", budgetUSD(b.maxUSD, b.maxUSD))
+		b.cancel(&budgetError{spentUSD: spent, maxUSD: b.maxUSD})
+	})
+}
+
+// budgetCause returns the budgetError that stopped the run of the context, nil if its budget didn't stop it
+func budgetCause(ctx context.Context) error {
+	var budgetErr *budgetError
+	if errors.As(context.Cause(ctx), &budgetErr) {
+		return budgetErr
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+const defaultRoleSessionName = "floodzone"
+
+// assumeRole replaces the credentials of cfg with ones for the role, so that floodzone can operate on zones in a
+// different account than the one it runs in. The role is assumed upfront so that a misconfigured role fails before any
+// resources are touched.
+func assumeRole(ctx context.Context, cfg *aws.Config, roleARN string, externalID string, sessionName string) error {
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(*cfg), roleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = sessionName
+		if externalID != "" {
+			o.ExternalID = aws.String(externalID)
+		}
+	})
+	cfg.Credentials = aws.NewCredentialsCache(provider)
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		return fmt.Errorf("unable to assume role %s: %w", roleARN, err)
+	}
+	return nil
+}
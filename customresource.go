@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// customResourceFailedPrefix is the physical ID of a resource whose Create failed before it had a hosted zone, which
+// its Delete ignores when the stack rolls back
+const customResourceFailedPrefix = "floodzone-failed-"
+
+// customResourceEvent is a CloudFormation custom resource request, see
+// https://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/crpg-ref-requests.html
+type customResourceEvent struct {
+	RequestType           string         `json:"RequestType"`
+	ResponseURL           string         `json:"ResponseURL"`
+	StackID               string         `json:"StackId"`
+	RequestID             string         `json:"RequestId"`
+	LogicalResourceID     string         `json:"LogicalResourceId"`
+	PhysicalResourceID    string         `json:"PhysicalResourceId"`
+	ResourceProperties    map[string]any `json:"ResourceProperties"`
+	OldResourceProperties map[string]any `json:"OldResourceProperties"`
+}
+
+// customResourceResponse is the answer to a custom resource request that's put to its ResponseURL
+type customResourceResponse struct {
+	Status             string            `json:"Status"`
+	Reason             string            `json:"Reason,omitempty"`
+	PhysicalResourceID string            `json:"PhysicalResourceId"`
+	StackID            string            `json:"StackId"`
+	RequestID          string            `json:"RequestId"`
+	LogicalResourceID  string            `json:"LogicalResourceId"`
+	Data               map[string]string `json:"Data,omitempty"`
+}
+
+// isCustomResourceEvent returns whether the payload of an invocation is a CloudFormation custom resource request
+func isCustomResourceEvent(payload []byte) bool {
+	var event customResourceEvent
+	return json.Unmarshal(payload, &event) == nil && event.RequestType != "" && event.ResponseURL != "" && event.StackID != ""
+}
+
+// handleCustomResource serves a CloudFormation custom resource, so that a test stack can declare a zone filled with
+// record sets. The properties of the resource are a config file with PascalCase keys, e.g. TotalRecords. Create floods
+// the zone, creating it if HostedZoneId isn't set, and its ID is the physical ID of the resource. Update floods the
+// zone up to the new TotalRecords, or replaces the resource when the zone or its VPC changed. Delete cleans up a zone
+// the resource created, and drains a zone it was given by deleting TotalRecords record sets, which deletes the zone
+// too once it's empty. The result is put to the ResponseURL, and the steps are interrupted before the invocation
+// times out so that the stack doesn't wait for an answer that never comes.
+func handleCustomResource(ctx context.Context, requestID string, deadline time.Time, payload []byte) ([]byte, error) {
+	var event customResourceEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("unable to parse custom resource request: %w", err)
+	}
+	response := customResourceResponse{
+		Status:             "SUCCESS",
+		PhysicalResourceID: event.PhysicalResourceID,
+		StackID:            event.StackID,
+		RequestID:          event.RequestID,
+		LogicalResourceID:  event.LogicalResourceID,
+	}
+	slog.Info("☁️ Custom resource request", "requestType", event.RequestType, "stack", event.StackID, "resource", event.LogicalResourceID, "physicalId", event.PhysicalResourceID)
+	zoneID, err := customResourceRequest(ctx, requestID, deadline, event)
+	if zoneID != "" {
+		response.PhysicalResourceID = zoneID
+		response.Data = map[string]string{"HostedZoneId": zoneID}
+	}
+	if response.PhysicalResourceID == "" {
+		response.PhysicalResourceID = customResourceFailedPrefix + event.RequestID
+	}
+	if err != nil {
+		response.Status, response.Reason = "FAILED", err.Error()
+	}
+	answer, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	// the response URL is presigned for an empty content type
+	req, err := http.NewRequestWithContext(context.WithoutCancel(ctx), http.MethodPut, event.ResponseURL, bytes.NewReader(answer))
+	if err != nil {
+		return nil, fmt.Errorf("invalid response URL: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to respond to CloudFormation: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to respond to CloudFormation: %s", resp.Status)
+	}
+	return answer, nil
+}
+
+// customResourceRequest runs the steps of the request and returns the hosted zone of the resource, if it has one
+func customResourceRequest(ctx context.Context, requestID string, deadline time.Time, event customResourceEvent) (string, error) {
+	config, err := customResourceConfig(event.ResourceProperties)
+	if err != nil {
+		return "", err
+	}
+	opts, err := validateRunConfig("flood", config)
+	if err != nil && event.RequestType != "Delete" {
+		return "", fmt.Errorf("invalid properties: %w", err)
+	}
+	switch event.RequestType {
+	case "Create":
+		return customResourceStep(ctx, requestID, deadline, "flood", config)
+	case "Update":
+		old, err := customResourceConfig(event.OldResourceProperties)
+		if err != nil {
+			return "", err
+		}
+		oldOpts, _ := validateRunConfig("flood", old)
+		// a new zone replaces the resource, and CloudFormation deletes the old one once the stack is updated
+		if opts.HostedZoneID != oldOpts.HostedZoneID || (opts.HostedZoneID == "" && (opts.VPCID != oldOpts.VPCID || opts.CreateVPC != oldOpts.CreateVPC)) {
+			return customResourceStep(ctx, requestID, deadline, "flood", config)
+		}
+		return customResourceStep(ctx, requestID, deadline, "flood", config, "--hosted-zone-id", event.PhysicalResourceID)
+	case "Delete":
+		if strings.HasPrefix(event.PhysicalResourceID, customResourceFailedPrefix) {
+			return "", nil
+		}
+		if opts.HostedZoneID == "" {
+			return customResourceStep(ctx, requestID, deadline, "cleanup", config, "--hosted-zone-id", event.PhysicalResourceID)
+		}
+		return customResourceStep(ctx, requestID, deadline, "delete", config, "--hosted-zone-id", event.PhysicalResourceID)
+	default:
+		return "", fmt.Errorf("unknown request type %q", event.RequestType)
+	}
+}
+
+// customResourceStep runs a step of the resource and returns the hosted zone it ran on
+func customResourceStep(ctx context.Context, requestID string, deadline time.Time, command string, config []byte, flags ...string) (string, error) {
+	summary, err := runLambdaStep(ctx, requestID, deadline, lambdaStepEvent{Command: command}, config, flags...)
+	var result runSummary
+	if summary != nil && json.Unmarshal(summary, &result) == nil && len(result.Zones) > 0 {
+		return result.Zones[0], err
+	}
+	return "", err
+}
+
+// customResourceConfig returns the config file of the properties of a resource. CloudFormation passes every value as a
+// string, so they're written as plain YAML values that are typed by the options they set, e.g. "500" for an int.
+func customResourceConfig(properties map[string]any) ([]byte, error) {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	keys := make([]string, 0, len(properties))
+	for key := range properties {
+		if key != "ServiceToken" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: kebabCase(key)}, customResourceNode(properties[key]))
+	}
+	config, err := yaml.Marshal(root)
+	if err != nil {
+		return nil, fmt.Errorf("unable to convert properties to a config file: %w", err)
+	}
+	return config, nil
+}
+
+// customResourceNode returns the YAML node of a property value, keeping the keys of maps like TypeMix as they are
+func customResourceNode(value any) *yaml.Node {
+	switch value := value.(type) {
+	case map[string]any:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, customResourceNode(value[key]))
+		}
+		return node
+	case []any:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range value {
+			node.Content = append(node.Content, customResourceNode(item))
+		}
+		return node
+	default:
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: fmt.Sprint(value)}
+	}
+}
+
+// kebabCase converts a PascalCase property name to the key of the config file, e.g. HostedZoneId to hosted-zone-id
+// and VPCId to vpc-id. Keys that are already lower case are kept.
+func kebabCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('-')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+const (
+	// route53MetricsRegion is where Route 53 publishes the metrics and query logs of public hosted zones
+	route53MetricsRegion = "us-east-1"
+	// dashboardPeriod is the period in seconds of every graph, the resolution floodzone publishes metrics at
+	dashboardPeriod = 60
+)
+
+// invalidDashboardChars are the characters CloudWatch doesn't accept in a dashboard name
+var invalidDashboardChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+type dashboardBody struct {
+	Start   string            `json:"start"`
+	Widgets []dashboardWidget `json:"widgets"`
+}
+
+type dashboardWidget struct {
+	Type       string         `json:"type"`
+	X          int            `json:"x"`
+	Y          int            `json:"y"`
+	Width      int            `json:"width"`
+	Height     int            `json:"height"`
+	Properties map[string]any `json:"properties"`
+}
+
+// Dashboard is a CloudWatch dashboard for a run that graphs floodzone's metrics next to the Route 53 and query
+// logging metrics of the flooded zones. It's put once a zone is described and deleted when the run finishes.
+// A nil Dashboard is a no-op.
+type Dashboard struct {
+	mu            sync.Mutex
+	client        *cloudwatch.Client
+	name          string
+	namespace     string
+	region        string
+	queryLogGroup string
+	command       string
+	runID         string
+	zones         []types.HostedZone
+	created       bool
+}
+
+// NewDashboard returns a Dashboard named after the run. queryLogGroup is the log group the zone's queries are logged
+// to, it defaults to the one Route 53 query logging uses for public zones.
+func NewDashboard(client *cloudwatch.Client, namespace string, region string, queryLogGroup string, command string, runID string) *Dashboard {
+	name := "floodzone-" + invalidDashboardChars.ReplaceAllString(runID, "-")
+	return &Dashboard{
+		client:        client,
+		name:          name[:min(len(name), 255)],
+		namespace:     namespace,
+		region:        region,
+		queryLogGroup: queryLogGroup,
+		command:       command,
+		runID:         runID,
+	}
+}
+
+// AddZone puts the dashboard with graphs for the hosted zone. Failures are only logged since a missing dashboard
+// shouldn't fail the run.
+func (d *Dashboard) AddZone(ctx context.Context, hostedZone *types.HostedZone) {
+	if d == nil || hostedZone == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, zone := range d.zones {
+		if aws.ToString(zone.Id) == aws.ToString(hostedZone.Id) {
+			return
+		}
+	}
+	d.zones = append(d.zones, *hostedZone)
+	body, err := json.Marshal(d.body())
+	if err != nil {
+		slog.Warn("unable to marshal CloudWatch dashboard", "dashboard", d.name, "error", err)
+		return
+	}
+	out, err := d.client.PutDashboard(ctx, &cloudwatch.PutDashboardInput{
+		DashboardName: aws.String(d.name),
+		DashboardBody: aws.String(string(body)),
+	})
+	if err != nil {
+		slog.Warn("unable to put CloudWatch dashboard", "dashboard", d.name, "error", err)
+		return
+	}
+	for _, msg := range out.DashboardValidationMessages {
+		slog.Warn("CloudWatch dashboard validation", "dashboard", d.name, "path", aws.ToString(msg.DataPath), "message", aws.ToString(msg.Message))
+	}
+	if !d.created {
+		slog.Info("📊 Created CloudWatch dashboard for the run", "dashboard", d.name, "url", d.url())
+	}
+	d.created = true
+}
+
+// Close deletes the dashboard
+func (d *Dashboard) Close(ctx context.Context) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.created {
+		return
+	}
+	if _, err := d.client.DeleteDashboards(ctx, &cloudwatch.DeleteDashboardsInput{DashboardNames: []string{d.name}}); err != nil {
+		slog.Warn("unable to delete CloudWatch dashboard", "dashboard", d.name, "error", err)
+		return
+	}
+	slog.Info("🧹 Deleted CloudWatch dashboard", "dashboard", d.name)
+}
+
+func (d *Dashboard) url() string {
+	return fmt.Sprintf("https://%s.console.aws.amazon.com/cloudwatch/home?region=%s#dashboards/dashboard/%s", d.region, d.region, d.name)
+}
+
+// body lays out a row of graphs per zone under a heading for the run
+func (d *Dashboard) body() dashboardBody {
+	body := dashboardBody{Start: "-PT3H"}
+	body.Widgets = append(body.Widgets, dashboardWidget{
+		Type: "text", Width: 24, Height: 2,
+		Properties: map[string]any{"markdown": fmt.Sprintf("# floodzone %s\nRun `%s`", d.command, d.runID)},
+	})
+	y := 2
+	for _, zone := range d.zones {
+		// floodzone's metrics use the zone ID as Route 53 returns it, Route 53's own metrics use the bare ID
+		id := aws.ToString(zone.Id)
+		bareID := strings.TrimPrefix(id, "/hostedzone/")
+		zoneName := strings.TrimSuffix(aws.ToString(zone.Name), ".")
+		private := zone.Config != nil && zone.Config.PrivateZone
+		body.Widgets = append(body.Widgets, dashboardWidget{
+			Type: "text", Y: y, Width: 24, Height: 1,
+			Properties: map[string]any{"markdown": fmt.Sprintf("## %s (%s)", zoneName, bareID)},
+		})
+		y++
+		body.Widgets = append(body.Widgets,
+			metricWidget(0, y, 8, "Changes", d.region, "Sum",
+				[]any{d.namespace, "Changes", "HostedZoneId", id, "Action", "CREATE", map[string]any{"label": "CREATE"}},
+				[]any{d.namespace, "Changes", "HostedZoneId", id, "Action", "UPSERT", map[string]any{"label": "UPSERT"}},
+				[]any{d.namespace, "Changes", "HostedZoneId", id, "Action", "DELETE", map[string]any{"label": "DELETE"}},
+			),
+			metricWidget(8, y, 8, "Change batch latency (ms)", d.region, "p50",
+				[]any{d.namespace, "BatchLatency", "HostedZoneId", id, map[string]any{"stat": "p50", "label": "p50"}},
+				[]any{d.namespace, "BatchLatency", "HostedZoneId", id, map[string]any{"stat": "p99", "label": "p99"}},
+				[]any{d.namespace, "BatchLatency", "HostedZoneId", id, map[string]any{"stat": "Maximum", "label": "Max"}},
+			),
+			metricWidget(16, y, 8, "Batch error rate", d.region, "Average",
+				[]any{d.namespace, "Errors", "HostedZoneId", id, map[string]any{"label": "Errors"}},
+			),
+		)
+		y += 6
+		// Route 53 only publishes query metrics and query logs for public zones, the queries of private zones are
+		// logged by Resolver query logging in the region of the VPC
+		logGroup, logRegion := d.queryLogGroup, d.region
+		x := 0
+		if !private {
+			body.Widgets = append(body.Widgets, metricWidget(x, y, 12, "DNS queries", route53MetricsRegion, "Sum",
+				[]any{"AWS/Route53", "DNSQueries", "HostedZoneId", bareID},
+			))
+			x += 12
+			if logGroup == "" {
+				logGroup, logRegion = "/aws/route53/"+zoneName, route53MetricsRegion
+			}
+		}
+		if logGroup != "" {
+			body.Widgets = append(body.Widgets, metricWidget(x, y, 12, "Query log events", logRegion, "Sum",
+				[]any{"AWS/Logs", "IncomingLogEvents", "LogGroupName", logGroup},
+			))
+			x += 12
+		}
+		if x > 0 {
+			y += 6
+		}
+	}
+	return body
+}
+
+// metricWidget is a 6 high time series graph of the metrics, each a CloudWatch metric array
+func metricWidget(x int, y int, width int, title string, region string, stat string, metrics ...[]any) dashboardWidget {
+	return dashboardWidget{
+		Type: "metric", X: x, Y: y, Width: width, Height: 6,
+		Properties: map[string]any{
+			"title":   title,
+			"region":  region,
+			"stat":    stat,
+			"period":  dashboardPeriod,
+			"view":    "timeSeries",
+			"stacked": false,
+			"metrics": metrics,
+		},
+	}
+}
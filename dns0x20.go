@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type randomCaseContextKey struct{}
+
+// withRandomCase returns a context whose DNS queries have the letters of their name in random case, the DNS 0x20
+// encoding some stub resolvers use to make spoofed answers harder, for resolvers from newProtocolResolver. The answers
+// that don't echo the name in the same case are traced, see withQueryTrace.
+func withRandomCase(ctx context.Context) context.Context {
+	return context.WithValue(ctx, randomCaseContextKey{}, true)
+}
+
+// randomizeCase returns the query with the letters of its question name in random case, and the name it asks for
+func randomizeCase(query []byte) ([]byte, string, error) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil {
+		return nil, "", fmt.Errorf("unable to parse DNS query to randomize its case: %w", err)
+	}
+	if len(msg.Questions) == 0 {
+		return query, "", nil
+	}
+	name := &msg.Questions[0].Name
+	for i := 0; i < int(name.Length); i++ {
+		if c := name.Data[i]; ('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') && rand.Intn(2) == 0 {
+			name.Data[i] ^= 0x20
+		}
+	}
+	packed, err := msg.Pack()
+	return packed, name.String(), err
+}
+
+// questionName returns the question name of a DNS answer as it was echoed, case included
+func questionName(answer []byte) (string, bool) {
+	var p dnsmessage.Parser
+	if _, err := p.Start(answer); err != nil {
+		return "", false
+	}
+	question, err := p.Question()
+	if err != nil {
+		return "", false
+	}
+	return question.Name.String(), true
+}
@@ -0,0 +1,697 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53resolver"
+	resolvertypes "github.com/aws/aws-sdk-go-v2/service/route53resolver/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+)
+
+const (
+	// dnsFirewallPrefix prefixes the name of every DNS Firewall domain list and rule group floodzone creates, which is
+	// how they're found to be deleted
+	dnsFirewallPrefix = "floodzone-firewall-"
+	// defaultDNSFirewallRate is how many Route 53 Resolver calls are made per second by default
+	defaultDNSFirewallRate = 5
+	// maxFirewallDomainsPerUpdate is the most domains an UpdateFirewallDomains call can add
+	maxFirewallDomainsPerUpdate = 1000
+	// maxFirewallUpdateAttempts is how many times domains are added to a domain list while another update of the list is
+	// in progress before giving up
+	maxFirewallUpdateAttempts = 20
+	// dnsFirewallPollInterval is how often the domain lists and rule group associations are described until they're
+	// complete or deleted
+	dnsFirewallPollInterval = 5 * time.Second
+	// firewallAssociationPollInterval is how often the rule group associations of the VPCs are listed to measure how
+	// long every association takes to complete
+	firewallAssociationPollInterval = 2 * time.Second
+	// dnsFirewallTimeout is how long the domain lists have to import their domains, and the rule groups to be
+	// associated or disassociated
+	dnsFirewallTimeout = 30 * time.Minute
+	// firstFirewallAssociationPriority and maxFirewallAssociationPriority bound the priorities of the associations of
+	// the rule groups with a VPC, Route 53 Resolver takes priorities between 100 and 9900 exclusive
+	firstFirewallAssociationPriority = 101
+	maxFirewallAssociationPriority   = 9899
+	// defaultFirewallPriorityStep is the gap between the priorities of the rule groups associated with a VPC by default
+	defaultFirewallPriorityStep = 100
+)
+
+// dnsFirewallResult is the output of the dns-firewall command
+type dnsFirewallResult struct {
+	Action      string `json:"action" yaml:"action"`
+	DomainLists int    `json:"domainLists" yaml:"domainLists"`
+	Domains     int    `json:"domains" yaml:"domains"`
+	// ZoneNames is how many names of the zone of --hosted-zone-id the domain lists have
+	ZoneNames int `json:"zoneNames" yaml:"zoneNames"`
+	// ImportFailed is how many domain lists Route 53 Resolver failed to import the domains of, and ImportDuration how
+	// long it took to import the domains of every domain list
+	ImportFailed   int           `json:"importFailed" yaml:"importFailed"`
+	ImportDuration time.Duration `json:"importDuration" yaml:"importDuration"`
+	RuleGroups     int           `json:"ruleGroups" yaml:"ruleGroups"`
+	Rules          int           `json:"rules" yaml:"rules"`
+	VPCs           int           `json:"vpcs" yaml:"vpcs"`
+	// Associations is how many rule groups are associated with the VPCs of --vpc-ids, or were disassociated with
+	// --delete, and AssociationLatency how long the associations took from the call until they were complete
+	Associations       int           `json:"associations" yaml:"associations"`
+	AssociationLatency *latencyStats `json:"associationLatency,omitempty" yaml:"associationLatency,omitempty"`
+	// Throttled is how many attempts Route 53 Resolver throttled, which the SDK retried
+	Throttled int           `json:"throttled" yaml:"throttled"`
+	Duration  time.Duration `json:"duration" yaml:"duration"`
+}
+
+func (r dnsFirewallResult) writeTable(w io.Writer) {
+	fmt.Fprintln(w, "ACTION\tDOMAIN LISTS\tDOMAINS\tZONE NAMES\tIMPORT FAILED\tIMPORT DURATION\tRULE GROUPS\tRULES\tVPCS\tASSOCIATIONS\tTHROTTLED\tDURATION")
+	fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\t%d\t%d\t%d\t%d\t%d\t%s\n", r.Action, r.DomainLists, r.Domains, r.ZoneNames, r.ImportFailed, r.ImportDuration.Round(time.Second),
+		r.RuleGroups, r.Rules, r.VPCs, r.Associations, r.Throttled, r.Duration.Round(time.Millisecond))
+	if l := r.AssociationLatency; l != nil {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "LATENCY\tMIN\tMEAN\tP50\tP90\tP99\tMAX")
+		fmt.Fprintf(w, "Rule group association\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%.1fms\n", l.Min, l.Mean, l.P50, l.P90, l.P99, l.Max)
+	}
+}
+
+// runDNSFirewall creates Route 53 Resolver DNS Firewall domain lists filled with --domains-per-list domains, imported
+// from files uploaded under --domains-s3-uri or added in batches, and rule groups with rules for the domain lists,
+// associated with the VPCs of --vpc-ids if it's set, to test how DNS Firewall evaluates rules at scale. With --delete,
+// it disassociates and deletes the rule groups and domain lists floodzone created instead.
+func runDNSFirewall(ctx context.Context, zone Zone, opts Options) error {
+	var throttles throttleCounter
+	throttled := func(o *route53resolver.Options) { o.APIOptions = append(o.APIOptions, throttles.middleware) }
+	start := time.Now()
+	if opts.Delete {
+		result, err := zone.DeleteDNSFirewall(ctx, dnsFirewallPrefix, opts.CreateRate, throttled)
+		if err != nil {
+			return err
+		}
+		result.Action, result.Throttled, result.Duration = "deleted", throttles.Count(), time.Since(start)
+		return printOutput(opts.Output, result)
+	}
+	prefix := dnsFirewallPrefix + strings.Split(uuid.NewString(), "-")[0]
+	result := dnsFirewallResult{Action: "created"}
+	err := zone.createDNSFirewall(ctx, prefix, opts, &result, throttled)
+	if err != nil {
+		if result.DomainLists != 0 {
+			slog.Error("some DNS Firewall resources were created before the run failed, delete them with dns-firewall --delete", "domainLists", result.DomainLists,
+				"ruleGroups", result.RuleGroups)
+		}
+		return err
+	}
+	result.Throttled, result.Duration = throttles.Count(), time.Since(start)
+	return printOutput(opts.Output, result)
+}
+
+// createDNSFirewall creates the domain lists, fills them, and creates and associates the rule groups, counting what it
+// created in the result as it goes
+func (z Zone) createDNSFirewall(ctx context.Context, prefix string, opts Options, result *dnsFirewallResult, optFns ...func(*route53resolver.Options)) error {
+	source := firewallDomainSource{prefix: prefix, lists: opts.FirewallDomainLists, perList: opts.FirewallDomains}
+	var hostedZoneID string
+	var recordSets []types.ResourceRecordSet
+	// zoneNames is the position of every name of the zone in the domains of the source
+	zoneNames := map[string]int{}
+	if opts.HostedZoneID != "" {
+		out, err := z.R53.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: &opts.HostedZoneID})
+		if err != nil {
+			return fmt.Errorf("unable to get hosted zone %s: %w", opts.HostedZoneID, err)
+		}
+		rrs, err := z.ListResourceRecordSets(ctx, out.HostedZone, maxListItems)
+		if err != nil {
+			return fmt.Errorf("unable to list resource record sets: %w", err)
+		}
+		hostedZoneID = aws.ToString(out.HostedZone.Id)
+		for _, rr := range rrs {
+			// only the record sets a query run queries are filtered
+			if rr.AliasTarget == nil && slices.Contains(resolvableTypes, rr.Type) {
+				recordSets = append(recordSets, rr)
+				name := firewallDomainName(aws.ToString(rr.Name))
+				if _, ok := zoneNames[name]; name != "" && !ok {
+					zoneNames[name] = len(source.zoneNames)
+					source.zoneNames = append(source.zoneNames, name)
+				}
+			}
+		}
+		result.ZoneNames = min(len(source.zoneNames), source.lists*source.perList)
+		slog.Info("🎯 Filling the domain lists with the names of the zone first", "hostedZone", hostedZoneID, "names", len(source.zoneNames), "listed", result.ZoneNames)
+	}
+	tags := []resolvertypes.Tag{{Key: aws.String(ephemeralVPCTagKey), Value: aws.String("true")}}
+	slog.Info("🧱 Creating DNS Firewall domain lists", "domainLists", opts.FirewallDomainLists, "domainsPerList", opts.FirewallDomains, "rate", opts.CreateRate)
+	domainListIDs := make([]string, opts.FirewallDomainLists)
+	err := paceCalls(ctx, opts.FirewallDomainLists, opts.CreateRate, func(ctx context.Context, i int) error {
+		out, err := z.R53Resolver.CreateFirewallDomainList(ctx, &route53resolver.CreateFirewallDomainListInput{
+			CreatorRequestId: aws.String(fmt.Sprintf("%s-list-%d", prefix, i)),
+			Name:             aws.String(fmt.Sprintf("%s-list-%d", prefix, i)),
+			Tags:             tags,
+		}, optFns...)
+		if err != nil {
+			return fmt.Errorf("unable to create DNS Firewall domain list %d: %w", i, err)
+		}
+		domainListIDs[i] = *out.FirewallDomainList.Id
+		return nil
+	})
+	domainListIDs = slices.DeleteFunc(domainListIDs, func(id string) bool { return id == "" })
+	result.DomainLists = len(domainListIDs)
+	if err != nil {
+		return err
+	}
+	importStart := time.Now()
+	if opts.FirewallDomainsURI != "" {
+		err = z.importFirewallDomains(ctx, source, domainListIDs, opts, optFns...)
+	} else {
+		err = z.updateFirewallDomains(ctx, source, domainListIDs, opts, optFns...)
+	}
+	if err != nil {
+		return err
+	}
+	if result.Domains, result.ImportFailed, err = z.waitForFirewallDomainLists(ctx, domainListIDs, optFns...); err != nil {
+		return err
+	}
+	result.ImportDuration = time.Since(importStart)
+	slog.Info("✅ Route 53 Resolver imported the domains of the domain lists", "domains", result.Domains, "failed", result.ImportFailed, "duration", result.ImportDuration)
+
+	rules := firewallRules{lists: len(domainListIDs), groups: opts.FirewallRuleGroups, perGroup: opts.FirewallRulesPerGroup}
+	slog.Info("🧱 Creating DNS Firewall rule groups", "ruleGroups", opts.FirewallRuleGroups, "rules", rules.count(), "action", opts.FirewallAction)
+	ruleGroupIDs := make([]string, opts.FirewallRuleGroups)
+	err = paceCalls(ctx, opts.FirewallRuleGroups, opts.CreateRate, func(ctx context.Context, i int) error {
+		out, err := z.R53Resolver.CreateFirewallRuleGroup(ctx, &route53resolver.CreateFirewallRuleGroupInput{
+			CreatorRequestId: aws.String(fmt.Sprintf("%s-group-%d", prefix, i)),
+			Name:             aws.String(fmt.Sprintf("%s-group-%d", prefix, i)),
+			Tags:             tags,
+		}, optFns...)
+		if err != nil {
+			return fmt.Errorf("unable to create DNS Firewall rule group %d: %w", i, err)
+		}
+		ruleGroupIDs[i] = *out.FirewallRuleGroup.Id
+		return nil
+	})
+	ruleGroupIDs = slices.DeleteFunc(ruleGroupIDs, func(id string) bool { return id == "" })
+	result.RuleGroups = len(ruleGroupIDs)
+	if err != nil {
+		return err
+	}
+	var created atomic.Int64
+	err = paceCalls(ctx, rules.count(), opts.CreateRate, func(ctx context.Context, n int) error {
+		group, list, priority := rules.rule(n)
+		input := &route53resolver.CreateFirewallRuleInput{
+			CreatorRequestId:     aws.String(fmt.Sprintf("%s-rule-%d", prefix, n)),
+			FirewallRuleGroupId:  &ruleGroupIDs[group],
+			FirewallDomainListId: &domainListIDs[list],
+			Name:                 aws.String(fmt.Sprintf("%s-rule-%d", prefix, n)),
+			Priority:             aws.Int32(int32(priority)),
+			Action:               resolvertypes.Action(opts.FirewallAction),
+		}
+		if input.Action == resolvertypes.ActionBlock {
+			input.BlockResponse = resolvertypes.BlockResponseNxdomain
+		}
+		if _, err := z.R53Resolver.CreateFirewallRule(ctx, input, optFns...); err != nil {
+			return fmt.Errorf("unable to create DNS Firewall rule %d: %w", n, err)
+		}
+		created.Add(1)
+		return nil
+	})
+	result.Rules = int(created.Load())
+	if err != nil {
+		return err
+	}
+	if opts.VPCIDs != "" {
+		if err := z.associateFirewallRuleGroups(ctx, prefix, ruleGroupIDs, opts, result, optFns...); err != nil {
+			return err
+		}
+	}
+	// every domain list has a rule, so the names the domain lists have are filtered by the action of the rules
+	blocked := opts.FirewallAction == string(resolvertypes.ActionBlock)
+	for _, rr := range recordSets {
+		i, ok := zoneNames[firewallDomainName(aws.ToString(rr.Name))]
+		z.Manifest.RecordFirewall(hostedZoneID, rr, blocked && ok && i < result.ZoneNames)
+	}
+	return nil
+}
+
+// associateFirewallRuleGroups associates every rule group with every VPC of --vpc-ids, --priority-step apart. The
+// order of the rule groups is rotated by one for every VPC, so that every VPC evaluates them at different priorities.
+// It waits until the associations are complete, measuring how long each one took.
+func (z Zone) associateFirewallRuleGroups(ctx context.Context, prefix string, ruleGroupIDs []string, opts Options, result *dnsFirewallResult, optFns ...func(*route53resolver.Options)) error {
+	vpcs := splitList(opts.VPCIDs)
+	result.VPCs = len(vpcs)
+	slog.Info("🔗 Associating the DNS Firewall rule groups with the VPCs", "vpcs", len(vpcs), "ruleGroups", len(ruleGroupIDs), "priorityStep", opts.FirewallPriorityStep)
+	tags := []resolvertypes.Tag{{Key: aws.String(ephemeralVPCTagKey), Value: aws.String("true")}}
+	associationIDs := make([]string, len(vpcs)*len(ruleGroupIDs))
+	started := make([]time.Time, len(associationIDs))
+	err := paceCalls(ctx, len(associationIDs), opts.CreateRate, func(ctx context.Context, n int) error {
+		v, i := n/len(ruleGroupIDs), n%len(ruleGroupIDs)
+		started[n] = time.Now()
+		out, err := z.R53Resolver.AssociateFirewallRuleGroup(ctx, &route53resolver.AssociateFirewallRuleGroupInput{
+			CreatorRequestId:    aws.String(fmt.Sprintf("%s-association-%d", prefix, n)),
+			FirewallRuleGroupId: &ruleGroupIDs[i],
+			Name:                aws.String(fmt.Sprintf("%s-association-%d", prefix, n)),
+			Priority:            aws.Int32(int32(firstFirewallAssociationPriority + (i+v)%len(ruleGroupIDs)*opts.FirewallPriorityStep)),
+			VpcId:               &vpcs[v],
+			Tags:                tags,
+		}, optFns...)
+		if err != nil {
+			return fmt.Errorf("unable to associate DNS Firewall rule group %s with VPC %s: %w", ruleGroupIDs[i], vpcs[v], err)
+		}
+		associationIDs[n] = *out.FirewallRuleGroupAssociation.Id
+		return nil
+	})
+	pending := map[string]time.Time{}
+	for n, id := range associationIDs {
+		if id != "" {
+			pending[id] = started[n]
+		}
+	}
+	result.Associations = len(pending)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, dnsFirewallTimeout)
+	defer cancel()
+	var latencies []time.Duration
+	for len(pending) != 0 {
+		if err := sleep(ctx, firewallAssociationPollInterval); err != nil {
+			return fmt.Errorf("%d DNS Firewall rule group associations weren't complete within %s: %w", len(pending), dnsFirewallTimeout, err)
+		}
+		for _, vpc := range vpcs {
+			input := &route53resolver.ListFirewallRuleGroupAssociationsInput{VpcId: aws.String(vpc)}
+			for {
+				out, err := z.R53Resolver.ListFirewallRuleGroupAssociations(ctx, input, optFns...)
+				if err != nil {
+					return fmt.Errorf("unable to list the DNS Firewall rule group associations of VPC %s: %w", vpc, err)
+				}
+				for _, association := range out.FirewallRuleGroupAssociations {
+					start, ok := pending[aws.ToString(association.Id)]
+					if ok && association.Status == resolvertypes.FirewallRuleGroupAssociationStatusComplete {
+						latencies = append(latencies, time.Since(start))
+						delete(pending, aws.ToString(association.Id))
+					}
+				}
+				if out.NextToken == nil {
+					break
+				}
+				input.NextToken = out.NextToken
+			}
+		}
+		slog.Info("DNS Firewall rule group associations are still in progress", "complete", len(latencies), "pending", len(pending))
+	}
+	latency := newLatencyStats(latencies)
+	result.AssociationLatency = &latency
+	slog.Info("✅ Associated the DNS Firewall rule groups with the VPCs", "vpcs", len(vpcs), "associations", len(latencies), "p50", latency.P50, "max", latency.Max)
+	return nil
+}
+
+// firewallRules lays out the rules of the rule groups. Without a number of rules per group, every domain list gets a
+// rule and the rules are spread round robin across the rule groups. With one, every rule group gets rules for that many
+// consecutive domain lists, continuing where the previous rule group stopped and wrapping around to the first domain
+// list, so that rule groups share domain lists when there are more rules than domain lists.
+type firewallRules struct {
+	lists    int
+	groups   int
+	perGroup int
+}
+
+func (r firewallRules) count() int {
+	if r.perGroup == 0 {
+		return r.lists
+	}
+	return r.groups * r.perGroup
+}
+
+// rule returns the rule group, domain list, and priority in the rule group of rule n
+func (r firewallRules) rule(n int) (group int, list int, priority int) {
+	if r.perGroup == 0 {
+		return n % r.groups, n, n/r.groups + 1
+	}
+	return n / r.perGroup, n % r.lists, n%r.perGroup + 1
+}
+
+// firewallDomainSource generates the domains of the domain lists: the names of the zone of --hosted-zone-id, spread
+// round robin across the domain lists, then domains under floodzone.test that don't exist up to --domains-per-list
+type firewallDomainSource struct {
+	prefix    string
+	lists     int
+	perList   int
+	zoneNames []string
+}
+
+// zoneNamesOf returns how many names of the zone domain list i has, they're the first of its domains
+func (s firewallDomainSource) zoneNamesOf(i int) int {
+	if i >= len(s.zoneNames) {
+		return 0
+	}
+	return min(s.perList, (len(s.zoneNames)-i+s.lists-1)/s.lists)
+}
+
+// domain returns domain j of domain list i
+func (s firewallDomainSource) domain(i int, j int) string {
+	if j < s.zoneNamesOf(i) {
+		return s.zoneNames[i+j*s.lists]
+	}
+	return fmt.Sprintf("d%d.l%d.%s.floodzone.test", j, i, strings.TrimPrefix(s.prefix, dnsFirewallPrefix))
+}
+
+// domains returns the domains from..to of domain list i
+func (s firewallDomainSource) domains(i int, from int, to int) []string {
+	domains := make([]string, 0, to-from)
+	for j := from; j < to; j++ {
+		domains = append(domains, s.domain(i, j))
+	}
+	return domains
+}
+
+// firewallDomainName returns the name of a record set as DNS Firewall takes it in a domain list, or "" if it has an
+// escaped character other than the asterisk of a wildcard
+func firewallDomainName(name string) string {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	if domain, ok := strings.CutPrefix(name, `\052.`); ok {
+		name = "*." + domain
+	}
+	if strings.Contains(name, `\`) {
+		return ""
+	}
+	return name
+}
+
+// importFirewallDomains uploads a file of the domains of every domain list under --domains-s3-uri and has Route 53
+// Resolver import it, deleting the files once the domain lists imported them
+func (z Zone) importFirewallDomains(ctx context.Context, source firewallDomainSource, domainListIDs []string, opts Options, optFns ...func(*route53resolver.Options)) error {
+	bucket, keyPrefix, _ := parseS3URI(opts.FirewallDomainsURI)
+	uris := make([]string, len(domainListIDs))
+	for i := range domainListIDs {
+		key := strings.TrimPrefix(strings.TrimSuffix(keyPrefix, "/")+"/"+fmt.Sprintf("%s-list-%d.txt", source.prefix, i), "/")
+		uris[i] = fmt.Sprintf("s3://%s/%s", bucket, key)
+		data := strings.Join(source.domains(i, 0, opts.FirewallDomains), "\n") + "\n"
+		if err := z.Artifacts.Write(ctx, uris[i], []byte(data), "text/plain"); err != nil {
+			return err
+		}
+	}
+	slog.Info("📤 Uploaded the domains of the domain lists, importing them", "domainLists", len(domainListIDs), "uri", opts.FirewallDomainsURI)
+	defer func() {
+		for _, uri := range uris {
+			_, key, _ := parseS3URI(uri)
+			if _, err := z.S3.DeleteObject(context.WithoutCancel(ctx), &s3.DeleteObjectInput{Bucket: &bucket, Key: aws.String(key)}); err != nil {
+				slog.Error("unable to clean up domain file, it must be deleted manually", "uri", uri, "error", err)
+			}
+		}
+	}()
+	err := paceCalls(ctx, len(domainListIDs), opts.CreateRate, func(ctx context.Context, i int) error {
+		_, err := z.R53Resolver.ImportFirewallDomains(ctx, &route53resolver.ImportFirewallDomainsInput{
+			FirewallDomainListId: &domainListIDs[i],
+			Operation:            resolvertypes.FirewallDomainImportOperationReplace,
+			DomainFileUrl:        aws.String(uris[i]),
+		}, optFns...)
+		if err != nil {
+			return fmt.Errorf("unable to import %s into DNS Firewall domain list %s: %w", uris[i], domainListIDs[i], err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// the files are read asynchronously, so they're kept until every domain list imported them
+	_, _, err = z.waitForFirewallDomainLists(ctx, domainListIDs, optFns...)
+	return err
+}
+
+// updateFirewallDomains adds the domains of every domain list in batches of maxFirewallDomainsPerUpdate, taking turns
+// between the domain lists. A domain list takes one update at a time, so an update is tried again after
+// dnsFirewallPollInterval while the previous one is in progress.
+func (z Zone) updateFirewallDomains(ctx context.Context, source firewallDomainSource, domainListIDs []string, opts Options, optFns ...func(*route53resolver.Options)) error {
+	batches := (opts.FirewallDomains + maxFirewallDomainsPerUpdate - 1) / maxFirewallDomainsPerUpdate
+	slog.Info("➕ Adding the domains of the domain lists", "domainLists", len(domainListIDs), "updates", batches*len(domainListIDs), "rate", opts.CreateRate)
+	return paceCalls(ctx, batches*len(domainListIDs), opts.CreateRate, func(ctx context.Context, n int) error {
+		i, batch := n%len(domainListIDs), n/len(domainListIDs)
+		input := &route53resolver.UpdateFirewallDomainsInput{
+			FirewallDomainListId: &domainListIDs[i],
+			Operation:            resolvertypes.FirewallDomainUpdateOperationAdd,
+			Domains:              source.domains(i, batch*maxFirewallDomainsPerUpdate, min((batch+1)*maxFirewallDomainsPerUpdate, opts.FirewallDomains)),
+		}
+		for attempt := 1; ; attempt++ {
+			_, err := z.R53Resolver.UpdateFirewallDomains(ctx, input, optFns...)
+			var conflict *resolvertypes.ConflictException
+			if errors.As(err, &conflict) && attempt < maxFirewallUpdateAttempts {
+				if err := sleep(ctx, dnsFirewallPollInterval); err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("unable to add domains to DNS Firewall domain list %s: %w", domainListIDs[i], err)
+			}
+			return nil
+		}
+	})
+}
+
+// waitForFirewallDomainLists waits until Route 53 Resolver is done with the domains of the domain lists, and returns
+// how many domains they have and how many domain lists failed to import theirs
+func (z Zone) waitForFirewallDomainLists(ctx context.Context, domainListIDs []string, optFns ...func(*route53resolver.Options)) (int, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, dnsFirewallTimeout)
+	defer cancel()
+	for {
+		domains, failed, pending := 0, 0, 0
+		for _, id := range domainListIDs {
+			out, err := z.R53Resolver.GetFirewallDomainList(ctx, &route53resolver.GetFirewallDomainListInput{FirewallDomainListId: aws.String(id)}, optFns...)
+			if err != nil {
+				return 0, 0, fmt.Errorf("unable to describe DNS Firewall domain list %s: %w", id, err)
+			}
+			list := out.FirewallDomainList
+			switch list.Status {
+			case resolvertypes.FirewallDomainListStatusComplete:
+			case resolvertypes.FirewallDomainListStatusCompleteImportFailed:
+				failed++
+				slog.Warn("Route 53 Resolver failed to import the domains of a domain list", "domainList", id, "message", aws.ToString(list.StatusMessage))
+			default:
+				pending++
+			}
+			domains += int(aws.ToInt32(list.DomainCount))
+		}
+		if pending == 0 {
+			return domains, failed, nil
+		}
+		slog.Info("DNS Firewall domain lists are still being updated", "pending", pending, "domains", domains)
+		if err := sleep(ctx, dnsFirewallPollInterval); err != nil {
+			return 0, 0, fmt.Errorf("DNS Firewall domain lists weren't updated within %s: %w", dnsFirewallTimeout, err)
+		}
+	}
+}
+
+// DeleteDNSFirewall disassociates the DNS Firewall rule groups whose name starts with the prefix from their VPCs, deletes
+// their rules and them, and deletes the domain lists whose name starts with the prefix, at rate calls per second. The
+// result has how many of each it deleted.
+func (z Zone) DeleteDNSFirewall(ctx context.Context, prefix string, rate float64, optFns ...func(*route53resolver.Options)) (dnsFirewallResult, error) {
+	var result dnsFirewallResult
+	var notFound *resolvertypes.ResourceNotFoundException
+	ruleGroups, err := z.firewallRuleGroups(ctx, prefix, optFns...)
+	if err != nil {
+		return result, err
+	}
+	var associations []resolvertypes.FirewallRuleGroupAssociation
+	for _, ruleGroup := range ruleGroups {
+		input := &route53resolver.ListFirewallRuleGroupAssociationsInput{FirewallRuleGroupId: ruleGroup.Id}
+		for {
+			out, err := z.R53Resolver.ListFirewallRuleGroupAssociations(ctx, input, optFns...)
+			if err != nil {
+				return result, fmt.Errorf("unable to list the associations of DNS Firewall rule group %s: %w", aws.ToString(ruleGroup.Id), err)
+			}
+			associations = append(associations, out.FirewallRuleGroupAssociations...)
+			if out.NextToken == nil {
+				break
+			}
+			input.NextToken = out.NextToken
+		}
+	}
+	if len(associations) != 0 {
+		slog.Info("🧹 Disassociating DNS Firewall rule groups", "associations", len(associations))
+		var disassociated atomic.Int64
+		err = paceCalls(ctx, len(associations), rate, func(ctx context.Context, i int) error {
+			_, err := z.R53Resolver.DisassociateFirewallRuleGroup(ctx, &route53resolver.DisassociateFirewallRuleGroupInput{FirewallRuleGroupAssociationId: associations[i].Id}, optFns...)
+			switch {
+			case errors.As(err, &notFound):
+			case err != nil:
+				return fmt.Errorf("unable to disassociate DNS Firewall rule group %s from VPC %s: %w", aws.ToString(associations[i].FirewallRuleGroupId), aws.ToString(associations[i].VpcId), err)
+			default:
+				disassociated.Add(1)
+			}
+			return nil
+		})
+		result.Associations = int(disassociated.Load())
+		if err != nil {
+			return result, err
+		}
+		// a rule group can't be deleted until it's disassociated, which happens in the background
+		waitCtx, cancel := context.WithTimeout(ctx, dnsFirewallTimeout)
+		defer cancel()
+		for _, association := range associations {
+			for {
+				_, err := z.R53Resolver.GetFirewallRuleGroupAssociation(waitCtx, &route53resolver.GetFirewallRuleGroupAssociationInput{FirewallRuleGroupAssociationId: association.Id}, optFns...)
+				if errors.As(err, &notFound) {
+					break
+				}
+				if err != nil {
+					return result, fmt.Errorf("unable to describe DNS Firewall rule group association %s: %w", aws.ToString(association.Id), err)
+				}
+				if err := sleep(waitCtx, dnsFirewallPollInterval); err != nil {
+					return result, fmt.Errorf("DNS Firewall rule group association %s wasn't deleted within %s: %w", aws.ToString(association.Id), dnsFirewallTimeout, err)
+				}
+			}
+		}
+	}
+	var rules, deletedGroups atomic.Int64
+	if len(ruleGroups) != 0 {
+		slog.Info("🧹 Deleting DNS Firewall rule groups", "ruleGroups", len(ruleGroups))
+	}
+	err = paceCalls(ctx, len(ruleGroups), rate, func(ctx context.Context, i int) error {
+		ruleGroupID := ruleGroups[i].Id
+		input := &route53resolver.ListFirewallRulesInput{FirewallRuleGroupId: ruleGroupID}
+		for {
+			out, err := z.R53Resolver.ListFirewallRules(ctx, input, optFns...)
+			if err != nil {
+				return fmt.Errorf("unable to list the rules of DNS Firewall rule group %s: %w", aws.ToString(ruleGroupID), err)
+			}
+			for _, rule := range out.FirewallRules {
+				_, err := z.R53Resolver.DeleteFirewallRule(ctx, &route53resolver.DeleteFirewallRuleInput{FirewallRuleGroupId: ruleGroupID, FirewallDomainListId: rule.FirewallDomainListId}, optFns...)
+				if err != nil && !errors.As(err, &notFound) {
+					return fmt.Errorf("unable to delete a rule of DNS Firewall rule group %s: %w", aws.ToString(ruleGroupID), err)
+				}
+				rules.Add(1)
+			}
+			if out.NextToken == nil {
+				break
+			}
+			input.NextToken = out.NextToken
+		}
+		_, err := z.R53Resolver.DeleteFirewallRuleGroup(ctx, &route53resolver.DeleteFirewallRuleGroupInput{FirewallRuleGroupId: ruleGroupID}, optFns...)
+		switch {
+		case errors.As(err, &notFound):
+		case err != nil:
+			return fmt.Errorf("unable to delete DNS Firewall rule group %s: %w", aws.ToString(ruleGroupID), err)
+		default:
+			deletedGroups.Add(1)
+		}
+		return nil
+	})
+	result.Rules, result.RuleGroups = int(rules.Load()), int(deletedGroups.Load())
+	if err != nil {
+		return result, err
+	}
+	domainLists, err := z.firewallDomainLists(ctx, prefix, optFns...)
+	if err != nil || len(domainLists) == 0 {
+		return result, err
+	}
+	slog.Info("🧹 Deleting DNS Firewall domain lists", "domainLists", len(domainLists))
+	var deletedLists atomic.Int64
+	err = paceCalls(ctx, len(domainLists), rate, func(ctx context.Context, i int) error {
+		_, err := z.R53Resolver.DeleteFirewallDomainList(ctx, &route53resolver.DeleteFirewallDomainListInput{FirewallDomainListId: domainLists[i].Id}, optFns...)
+		switch {
+		case errors.As(err, &notFound):
+		case err != nil:
+			return fmt.Errorf("unable to delete DNS Firewall domain list %s: %w", aws.ToString(domainLists[i].Name), err)
+		default:
+			deletedLists.Add(1)
+		}
+		return nil
+	})
+	result.DomainLists = int(deletedLists.Load())
+	if err != nil {
+		return result, err
+	}
+	slog.Info("✅ Successfully deleted the DNS Firewall resources", "ruleGroups", result.RuleGroups, "rules", result.Rules, "domainLists", result.DomainLists)
+	return result, nil
+}
+
+// firewallRuleGroups returns the DNS Firewall rule groups whose name starts with the prefix
+func (z Zone) firewallRuleGroups(ctx context.Context, prefix string, optFns ...func(*route53resolver.Options)) ([]resolvertypes.FirewallRuleGroupMetadata, error) {
+	var ruleGroups []resolvertypes.FirewallRuleGroupMetadata
+	input := &route53resolver.ListFirewallRuleGroupsInput{}
+	for {
+		out, err := z.R53Resolver.ListFirewallRuleGroups(ctx, input, optFns...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list DNS Firewall rule groups: %w", err)
+		}
+		for _, ruleGroup := range out.FirewallRuleGroups {
+			if strings.HasPrefix(aws.ToString(ruleGroup.Name), prefix) {
+				ruleGroups = append(ruleGroups, ruleGroup)
+			}
+		}
+		if out.NextToken == nil {
+			return ruleGroups, nil
+		}
+		input.NextToken = out.NextToken
+	}
+}
+
+// firewallDomainLists returns the DNS Firewall domain lists whose name starts with the prefix
+func (z Zone) firewallDomainLists(ctx context.Context, prefix string, optFns ...func(*route53resolver.Options)) ([]resolvertypes.FirewallDomainListMetadata, error) {
+	var domainLists []resolvertypes.FirewallDomainListMetadata
+	input := &route53resolver.ListFirewallDomainListsInput{}
+	for {
+		out, err := z.R53Resolver.ListFirewallDomainLists(ctx, input, optFns...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list DNS Firewall domain lists: %w", err)
+		}
+		for _, domainList := range out.FirewallDomainLists {
+			if strings.HasPrefix(aws.ToString(domainList.Name), prefix) {
+				domainLists = append(domainLists, domainList)
+			}
+		}
+		if out.NextToken == nil {
+			return domainLists, nil
+		}
+		input.NextToken = out.NextToken
+	}
+}
+
+// validateDNSFirewall validates the flags of the dns-firewall command
+func validateDNSFirewall(opts Options) error {
+	var errs []error
+	if opts.CreateRate <= 0 {
+		errs = append(errs, errors.New("--create-rate must be greater than 0"))
+	}
+	if opts.Delete {
+		return errors.Join(errs...)
+	}
+	if opts.FirewallDomainLists <= 0 {
+		errs = append(errs, errors.New("--domain-lists must be greater than 0"))
+	}
+	if opts.FirewallDomains <= 0 {
+		errs = append(errs, errors.New("--domains-per-list must be greater than 0"))
+	}
+	if opts.FirewallRuleGroups <= 0 {
+		errs = append(errs, errors.New("--rule-groups must be greater than 0"))
+	}
+	switch {
+	case opts.FirewallRulesPerGroup < 0 || opts.FirewallRulesPerGroup > opts.FirewallDomainLists:
+		errs = append(errs, errors.New("--rules-per-group must be between 0 and --domain-lists, since a rule group has a rule per domain list"))
+	case opts.FirewallRulesPerGroup == 0 && opts.FirewallRuleGroups > opts.FirewallDomainLists:
+		errs = append(errs, errors.New("--rule-groups must be at most --domain-lists without --rules-per-group, since every domain list gets a single rule"))
+	}
+	if opts.VPCIDs != "" {
+		if opts.FirewallPriorityStep <= 0 {
+			errs = append(errs, errors.New("--priority-step must be greater than 0"))
+		} else if last := firstFirewallAssociationPriority + (opts.FirewallRuleGroups-1)*opts.FirewallPriorityStep; last > maxFirewallAssociationPriority {
+			errs = append(errs, fmt.Errorf("--rule-groups %d --priority-step %d apart need priorities up to %d, Route 53 Resolver allows up to %d",
+				opts.FirewallRuleGroups, opts.FirewallPriorityStep, last, maxFirewallAssociationPriority))
+		}
+	}
+	actions := []string{string(resolvertypes.ActionAlert), string(resolvertypes.ActionBlock), string(resolvertypes.ActionAllow)}
+	if !slices.Contains(actions, opts.FirewallAction) {
+		errs = append(errs, fmt.Errorf("--firewall-action must be one of %s, got %q", strings.Join(actions, ", "), opts.FirewallAction))
+	}
+	errs = append(errs, validateManifestURI("--manifest", opts.Manifest))
+	if opts.FirewallDomainsURI != "" {
+		if bucket, _, ok := parseS3URI(opts.FirewallDomainsURI); !ok || bucket == "" {
+			errs = append(errs, fmt.Errorf("--domains-s3-uri must be an s3://bucket/prefix URI, got %q", opts.FirewallDomainsURI))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnssecSigning is the ServeSignature of a hosted zone that Route 53 signs
+const dnssecSigning = "SIGNING"
+
+// dnssecResult is how many of the queries for existing record sets a validating resolver answered as authenticated
+type dnssecResult struct {
+	Queries       int `json:"queries" yaml:"queries"`
+	Authenticated int `json:"authenticated" yaml:"authenticated"`
+	// Unauthenticated queries were answered without the AD bit, they're counted as failed
+	Unauthenticated int `json:"unauthenticated" yaml:"unauthenticated"`
+	// ServFail queries were answered with SERVFAIL, which is what a validating resolver answers when validation fails
+	ServFail int `json:"servFail" yaml:"servFail"`
+	// ValidationFailureRate is the percent of the queries that were answered unauthenticated or with SERVFAIL
+	ValidationFailureRate float64 `json:"validationFailureRate" yaml:"validationFailureRate"`
+}
+
+type dnssecContextKey struct{}
+
+// withDNSSEC returns a context whose DNS queries ask for DNSSEC records and authenticated answers, for resolvers from
+// newProtocolResolver, which trace whether the answers are authenticated, see withQueryTrace
+func withDNSSEC(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dnssecContextKey{}, true)
+}
+
+// requestDNSSEC returns the query with the AD bit set, which asks a validating resolver whether it authenticated the
+// answer (RFC 6840), and the DO bit of its OPT record set, which asks for the RRSIGs, adding the OPT record if it has none
+func requestDNSSEC(query []byte) ([]byte, error) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil {
+		return nil, fmt.Errorf("unable to parse DNS query to request DNSSEC: %w", err)
+	}
+	msg.Header.AuthenticData = true
+	for i, resource := range msg.Additionals {
+		if resource.Header.Type == dnsmessage.TypeOPT {
+			// the DO bit is the top bit of the extended flags in the TTL of the OPT record
+			msg.Additionals[i].Header.TTL |= 1 << 15
+			return msg.Pack()
+		}
+	}
+	var header dnsmessage.ResourceHeader
+	if err := header.SetEDNS0(ednsUDPSize, dnsmessage.RCodeSuccess, true); err != nil {
+		return nil, err
+	}
+	msg.Additionals = append(msg.Additionals, dnsmessage.Resource{Header: header, Body: &dnsmessage.OPTResource{}})
+	return msg.Pack()
+}
+
+// authenticated returns whether a DNS answer has the AD bit set by a validating resolver
+func authenticated(answer []byte) bool {
+	var p dnsmessage.Parser
+	header, err := p.Start(answer)
+	return err == nil && header.Response && header.AuthenticData
+}
+
+// warnUnsignedZone warns when Route 53 doesn't sign the hosted zone, since its answers can't be authenticated then
+func warnUnsignedZone(ctx context.Context, zone Zone, hostedZoneID string) error {
+	out, err := zone.R53.GetDNSSEC(ctx, &route53.GetDNSSECInput{HostedZoneId: &hostedZoneID})
+	if err != nil {
+		return fmt.Errorf("unable to get the DNSSEC signing status of the hosted zone: %w", err)
+	}
+	var status string
+	if out.Status != nil {
+		status = aws.ToString(out.Status.ServeSignature)
+	}
+	if status != dnssecSigning {
+		slog.Warn("The hosted zone isn't DNSSEC-signed, its answers won't be authenticated", "zone", hostedZoneID, "status", status)
+	}
+	return nil
+}
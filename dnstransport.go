@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// dnsProtocolUDP is plain DNS over UDP port 53, retried over TCP when the answer is truncated like real clients do
+	dnsProtocolUDP = "udp"
+	// dnsProtocolUDPOnly is plain DNS over UDP port 53, a truncated answer fails the query
+	dnsProtocolUDPOnly = "udp-only"
+	// dnsProtocolTCP is plain DNS over TCP port 53
+	dnsProtocolTCP = "tcp"
+	// dnsProtocolTLS is DNS-over-TLS (RFC 7858) on port 853
+	dnsProtocolTLS = "tls"
+	// dnsProtocolHTTPS is DNS-over-HTTPS (RFC 8484), POSTing the queries to a URL
+	dnsProtocolHTTPS = "https"
+	// maxDNSMessageSize is the largest DNS message, it has a 2 byte length
+	maxDNSMessageSize = 65535
+)
+
+// dnsProtocols are the values of --protocol
+var dnsProtocols = []string{dnsProtocolUDP, dnsProtocolUDPOnly, dnsProtocolTCP, dnsProtocolTLS, dnsProtocolHTTPS}
+
+// errTruncated fails a udp-only query whose answer didn't fit in a UDP message
+var errTruncated = errors.New("answer truncated over UDP")
+
+type queryTraceKey struct{}
+
+// queryTrace records what happened on the wire while a query was answered
+type queryTrace struct {
+	// truncated is set when the answer over UDP was truncated, which makes the resolver retry over TCP
+	truncated atomic.Bool
+	// authenticated is set when a query of withDNSSEC was answered with the AD bit of a validating resolver
+	authenticated atomic.Bool
+	// caseMismatch is set when a query of withRandomCase was answered without its name in the same case
+	caseMismatch atomic.Bool
+}
+
+// withQueryTrace returns a context whose query is traced by a resolver from newProtocolResolver
+func withQueryTrace(ctx context.Context) (context.Context, *queryTrace) {
+	trace := &queryTrace{}
+	return context.WithValue(ctx, queryTraceKey{}, trace), trace
+}
+
+// truncationDial wraps the dial of a UDP resolver to trace the TCP retries of truncated answers, which are refused when
+// udpOnly is set
+func truncationDial(dial func(ctx context.Context, network, address string) (net.Conn, error), udpOnly bool) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		// the Go resolver only dials TCP for a UDP query once the answer came back with the TC bit set
+		if strings.HasPrefix(network, "tcp") {
+			if trace, ok := ctx.Value(queryTraceKey{}).(*queryTrace); ok {
+				trace.truncated.Store(true)
+			}
+			if udpOnly {
+				return nil, errTruncated
+			}
+		}
+		return dial(ctx, network, address)
+	}
+}
+
+// queryDial wraps the conns of dial to rewrite the queries written to them with the EDNS client subnet, DNSSEC request,
+// and random case of the context, and to trace the answers read from them, if the context has any
+func queryDial(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		prefix, ecs := ctx.Value(ecsContextKey{}).(netip.Prefix)
+		dnssec := ctx.Value(dnssecContextKey{}) != nil
+		randomCase := ctx.Value(randomCaseContextKey{}) != nil
+		if !ecs && !dnssec && !randomCase {
+			return conn, nil
+		}
+		trace, _ := ctx.Value(queryTraceKey{}).(*queryTrace)
+		// the Go resolver sends a single query per conn
+		var sent string
+		rewrite := func(query []byte) ([]byte, error) {
+			var err error
+			if ecs {
+				if query, err = addECS(query, prefix); err != nil {
+					return nil, err
+				}
+			}
+			if dnssec {
+				if query, err = requestDNSSEC(query); err != nil {
+					return nil, err
+				}
+			}
+			if randomCase {
+				if query, sent, err = randomizeCase(query); err != nil {
+					return nil, err
+				}
+			}
+			return query, nil
+		}
+		inspect := func(answer []byte) {
+			if trace == nil {
+				return
+			}
+			if dnssec && authenticated(answer) {
+				trace.authenticated.Store(true)
+			}
+			// the Go resolver matches the answer to the query regardless of case, so the mismatch is only traced
+			if name, ok := questionName(answer); randomCase && ok && name != sent {
+				trace.caseMismatch.Store(true)
+			}
+		}
+		// the Go resolver frames the queries by whether the conn is a net.PacketConn, so a UDP conn has to stay one
+		if udp, ok := conn.(*net.UDPConn); ok {
+			return &rewritePacketConn{UDPConn: udp, rewrite: rewrite, inspect: inspect}, nil
+		}
+		return &rewriteStreamConn{Conn: conn, rewrite: rewrite, inspect: inspect}, nil
+	}
+}
+
+// rewritePacketConn rewrites every query written to a UDP conn and inspects every answer read from it
+type rewritePacketConn struct {
+	*net.UDPConn
+	rewrite func(query []byte) ([]byte, error)
+	inspect func(answer []byte)
+}
+
+func (c *rewritePacketConn) Write(b []byte) (int, error) {
+	query, err := c.rewrite(b)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := c.UDPConn.Write(query); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *rewritePacketConn) Read(b []byte) (int, error) {
+	n, err := c.UDPConn.Read(b)
+	if n > 0 {
+		c.inspect(b[:n])
+	}
+	return n, err
+}
+
+// rewriteStreamConn rewrites every query written to a conn with a 2 byte length in front of the messages, and inspects
+// every answer read from it
+type rewriteStreamConn struct {
+	net.Conn
+	rewrite func(query []byte) ([]byte, error)
+	inspect func(answer []byte)
+	pending []byte
+	answer  []byte
+}
+
+func (c *rewriteStreamConn) Write(b []byte) (int, error) {
+	c.pending = append(c.pending, b...)
+	for len(c.pending) >= 2 && len(c.pending) >= 2+int(binary.BigEndian.Uint16(c.pending)) {
+		size := int(binary.BigEndian.Uint16(c.pending))
+		query, err := c.rewrite(c.pending[2 : 2+size])
+		if err != nil {
+			return 0, err
+		}
+		c.pending = c.pending[2+size:]
+		framed := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(query)), uint16(len(query)))
+		if _, err := c.Conn.Write(append(framed, query...)); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (c *rewriteStreamConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.answer = append(c.answer, b[:n]...)
+	for len(c.answer) >= 2 && len(c.answer) >= 2+int(binary.BigEndian.Uint16(c.answer)) {
+		size := int(binary.BigEndian.Uint16(c.answer))
+		c.inspect(c.answer[2 : 2+size])
+		c.answer = c.answer[2+size:]
+	}
+	return n, err
+}
+
+// newProtocolResolver returns a resolver that sends the queries round robin over the protocol to the DNS servers at
+// addresses, and the servers as they're queried. The addresses of udp, tcp, and tls default to port 53, 53, and 853. The
+// addresses of https are URLs, and a bare host is queried at https://host/dns-query. No addresses uses the system's
+// resolvers over udp or udp-only. The queries carry the EDNS client subnet, DNSSEC request, and random case of their
+// context, see withECS, withDNSSEC, and withRandomCase, and their answers are traced, see withQueryTrace.
+func newProtocolResolver(protocol string, addresses ...string) (*net.Resolver, string) {
+	var servers []string
+	for _, address := range addresses {
+		if address == "" {
+			continue
+		}
+		servers = append(servers, dnsServer(protocol, address))
+	}
+	if len(servers) == 0 {
+		var d net.Dialer
+		return &net.Resolver{PreferGo: true, Dial: queryDial(truncationDial(d.DialContext, protocol == dnsProtocolUDPOnly))}, "system"
+	}
+	var next atomic.Uint64
+	nextServer := func() string {
+		return servers[(next.Add(1)-1)%uint64(len(servers))]
+	}
+	dial := func(ctx context.Context, network string, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, nextServer())
+	}
+	display := strings.Join(servers, ",")
+	switch protocol {
+	case dnsProtocolUDP, dnsProtocolUDPOnly:
+		dial = truncationDial(dial, protocol == dnsProtocolUDPOnly)
+	case dnsProtocolTCP:
+		// the resolver frames the messages with their length over any conn that isn't a net.PacketConn
+		dial = func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "tcp", nextServer())
+		}
+		display = "tcp://" + strings.Join(servers, ",tcp://")
+	case dnsProtocolTLS:
+		dial = func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+			server := nextServer()
+			host, _, _ := net.SplitHostPort(server)
+			d := tls.Dialer{Config: &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}}
+			return d.DialContext(ctx, "tcp", server)
+		}
+		display = "tls://" + strings.Join(servers, ",tls://")
+	case dnsProtocolHTTPS:
+		// one client for every query keeps the connections to the servers alive, like a browser or OS stub resolver does
+		client := &http.Client{}
+		dial = func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+			return &dohConn{ctx: ctx, client: client, url: nextServer()}, nil
+		}
+	}
+	return &net.Resolver{PreferGo: true, Dial: queryDial(dial)}, display
+}
+
+// dnsServer returns the address or URL to send the queries over the protocol to
+func dnsServer(protocol string, address string) string {
+	if protocol == dnsProtocolHTTPS {
+		if !strings.Contains(address, "://") {
+			return fmt.Sprintf("https://%s/dns-query", address)
+		}
+		return address
+	}
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+	if protocol == dnsProtocolTLS {
+		return net.JoinHostPort(address, "853")
+	}
+	return net.JoinHostPort(address, "53")
+}
+
+// dohConn is a net.Conn that sends DNS queries over HTTPS. The Go resolver writes every query to a conn that isn't a
+// net.PacketConn with a 2 byte length in front, like over TCP, so every query written is POSTed to the URL and its
+// answer is read back the same way.
+type dohConn struct {
+	ctx      context.Context
+	client   *http.Client
+	url      string
+	deadline time.Time
+	query    []byte
+	answer   bytes.Reader
+}
+
+func (c *dohConn) Write(b []byte) (int, error) {
+	c.query = append(c.query, b...)
+	if len(c.query) < 2 || len(c.query) < 2+int(binary.BigEndian.Uint16(c.query)) {
+		return len(b), nil
+	}
+	message := c.query[2 : 2+int(binary.BigEndian.Uint16(c.query))]
+	c.query = c.query[2+len(message):]
+	ctx := c.ctx
+	if !c.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(message))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("DNS-over-HTTPS query to %s failed: %s", c.url, resp.Status)
+	}
+	answer, err := io.ReadAll(io.LimitReader(resp.Body, maxDNSMessageSize+1))
+	if err != nil {
+		return 0, err
+	}
+	if len(answer) > maxDNSMessageSize {
+		return 0, fmt.Errorf("DNS-over-HTTPS answer from %s is too large", c.url)
+	}
+	framed := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(answer)), uint16(len(answer)))
+	c.answer.Reset(append(framed, answer...))
+	return len(b), nil
+}
+
+func (c *dohConn) Read(b []byte) (int, error) {
+	return c.answer.Read(b)
+}
+
+func (c *dohConn) Close() error                       { return nil }
+func (c *dohConn) LocalAddr() net.Addr                { return dohAddr(c.url) }
+func (c *dohConn) RemoteAddr() net.Addr               { return dohAddr(c.url) }
+func (c *dohConn) SetDeadline(t time.Time) error      { c.deadline = t; return nil }
+func (c *dohConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *dohConn) SetWriteDeadline(t time.Time) error { c.deadline = t; return nil }
+
+// dohAddr is the address of a dohConn, its URL
+type dohAddr string
+
+func (a dohAddr) Network() string { return dnsProtocolHTTPS }
+func (a dohAddr) String() string  { return string(a) }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// ecsOptionCode is the EDNS0 option code of Client Subnet (RFC 7871)
+	ecsOptionCode = 8
+	// ednsUDPSize is the UDP payload size advertised in the OPT record added to a query that has none
+	ednsUDPSize = 1232
+)
+
+// ednsSubnet is an EDNS client subnet to send queries from, and the answer the queries from it should get if any
+type ednsSubnet struct {
+	prefix netip.Prefix
+	expect string
+}
+
+// parseEDNSSubnets parses comma-separated CIDR[=ANSWER] EDNS client subnets, e.g. 203.0.113.0/24=192.0.2.10
+func parseEDNSSubnets(s string) ([]ednsSubnet, error) {
+	var subnets []ednsSubnet
+	for _, item := range splitList(s) {
+		cidr, expect, _ := strings.Cut(item, "=")
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("%q must be a CIDR like 203.0.113.0/24, optionally with =ANSWER", item)
+		}
+		subnets = append(subnets, ednsSubnet{prefix: prefix.Masked(), expect: normalizeAnswer(strings.TrimSpace(expect))})
+	}
+	return subnets, nil
+}
+
+type ecsContextKey struct{}
+
+// withECS returns a context whose DNS queries carry the client subnet, for resolvers from newProtocolResolver
+func withECS(ctx context.Context, prefix netip.Prefix) context.Context {
+	return context.WithValue(ctx, ecsContextKey{}, prefix)
+}
+
+// addECS returns the query with a client subnet option in its OPT record, adding the OPT record if it has none
+func addECS(query []byte, prefix netip.Prefix) ([]byte, error) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil {
+		return nil, fmt.Errorf("unable to parse DNS query to add the client subnet: %w", err)
+	}
+	option := dnsmessage.Option{Code: ecsOptionCode, Data: ecsOptionData(prefix)}
+	for i, resource := range msg.Additionals {
+		if opt, ok := resource.Body.(*dnsmessage.OPTResource); ok {
+			opt.Options = append(opt.Options, option)
+			msg.Additionals[i].Body = opt
+			return msg.Pack()
+		}
+	}
+	var header dnsmessage.ResourceHeader
+	if err := header.SetEDNS0(ednsUDPSize, dnsmessage.RCodeSuccess, false); err != nil {
+		return nil, err
+	}
+	msg.Additionals = append(msg.Additionals, dnsmessage.Resource{Header: header, Body: &dnsmessage.OPTResource{Options: []dnsmessage.Option{option}}})
+	return msg.Pack()
+}
+
+// ecsOptionData returns the data of a client subnet option: the address family, the source prefix length, a scope
+// prefix length of 0, and only as many bytes of the address as the prefix covers
+func ecsOptionData(prefix netip.Prefix) []byte {
+	family := uint16(1)
+	if prefix.Addr().Is6() {
+		family = 2
+	}
+	bits := prefix.Bits()
+	data := binary.BigEndian.AppendUint16(nil, family)
+	data = append(data, byte(bits), 0)
+	return append(data, prefix.Addr().AsSlice()[:(bits+7)/8]...)
+}
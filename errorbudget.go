@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// errorBudgetError is the cause of a run aborted by --on-error-budget abort. It wraps context.Canceled so the run is
+// reported as aborted.
+type errorBudgetError struct {
+	errors    int
+	maxErrors int
+}
+
+func (e *errorBudgetError) Error() string {
+	return fmt.Sprintf("%d change batch attempts were throttled or failed, reaching the --max-errors of %d", e.errors, e.maxErrors)
+}
+
+func (e *errorBudgetError) Unwrap() error {
+	return context.Canceled
+}
+
+// errorBudgetStatus is how many change batch attempts of the run were throttled or failed out of its budget
+type errorBudgetStatus struct {
+	Errors    int `json:"errors"`
+	MaxErrors int `json:"maxErrors"`
+}
+
+// ErrorBudget counts the throttled and failed attempts of the run's change batches, including the ones the SDK retried,
+// and publishes an error-budget event once they reach --max-errors so that an unattended run that's struggling pages
+// someone before it fails. With --on-error-budget abort it also stops the run. A nil ErrorBudget is a no-op.
+type ErrorBudget struct {
+	maxErrors int
+	abort     bool
+	command   string
+	runID     string
+	errors    atomic.Int64
+	notify    func(ctx context.Context, event runEvent)
+	cancel    context.CancelCauseFunc
+	once      sync.Once
+}
+
+func NewErrorBudget(command string, opts Options) *ErrorBudget {
+	return &ErrorBudget{maxErrors: opts.MaxErrors, abort: opts.OnErrorBudget == "abort", command: command, runID: opts.RunID}
+}
+
+// Watch returns a context that is canceled with an errorBudgetError once the run reaches its budget if it aborts on
+// it, the error-budget event is sent with notify
+func (b *ErrorBudget) Watch(ctx context.Context, notify func(ctx context.Context, event runEvent)) context.Context {
+	if b == nil {
+		return ctx
+	}
+	b.notify = notify
+	ctx, b.cancel = context.WithCancelCause(ctx)
+	return ctx
+}
+
+// add counts n more throttled or failed attempts, notifying and aborting the run once they reach the budget
+func (b *ErrorBudget) add(ctx context.Context, n int) {
+	count := int(b.errors.Add(int64(n)))
+	if n == 0 || count < b.maxErrors || b.cancel == nil {
+		return
+	}
+	b.once.Do(func() {
+		slog.Warn("🚨 The run reached its error budget", "errors", count, "maxErrors", b.maxErrors, "abort", b.abort)
+		event := newEvent(eventErrorBudget, b.command, b.runID)
+		event.ErrorBudget = &errorBudgetStatus{Errors: count, MaxErrors: b.maxErrors}
+		b.notify(context.WithoutCancel(ctx), event)
+		if b.abort {
+			b.cancel(&errorBudgetError{errors: count, maxErrors: b.maxErrors})
+		}
+	})
+}
+
+// route53Option adds a middleware to the Route 53 client that counts the throttled and failed attempts of every change
+// batch
+func (b *ErrorBudget) route53Option(o *route53.Options) {
+	if b == nil {
+		return
+	}
+	o.APIOptions = append(o.APIOptions, b.middleware)
+}
+
+func (b *ErrorBudget) middleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("FloodzoneErrorBudget", func(ctx context.Context, in middleware.InitializeInput,
+		next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		out, metadata, err := next.HandleInitialize(ctx, in)
+		// the change batch that was in flight when the run was stopped didn't fail on its own
+		if _, ok := in.Parameters.(*route53.ChangeResourceRecordSetsInput); !ok || ctx.Err() != nil {
+			return out, metadata, err
+		}
+		failed := 0
+		if results, ok := retry.GetAttemptResults(metadata); ok {
+			for _, result := range results.Results {
+				if result.Err != nil {
+					failed++
+				}
+			}
+		} else if err != nil {
+			failed++
+		}
+		b.add(ctx, failed)
+		return out, metadata, err
+	}), middleware.After)
+}
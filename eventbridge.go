@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+const (
+	// eventBridgeSource is the source of every event floodzone puts, for event patterns to match on
+	eventBridgeSource = "floodzone"
+	// eventBridgeFlushInterval is how often buffered batch events are put
+	eventBridgeFlushInterval = 5 * time.Second
+	// maxEventsPerCall is the most entries EventBridge accepts in one PutEvents call
+	maxEventsPerCall = 10
+)
+
+// eventBridgeDetailTypes are the detail types of the run events put on the bus, other run events aren't put
+var eventBridgeDetailTypes = map[string]string{
+	eventStarted:     "RunStarted",
+	eventCompleted:   "RunCompleted",
+	eventFailed:      "RunFailed",
+	eventAborted:     "RunAborted",
+	eventErrorBudget: "RunErrorBudgetReached",
+}
+
+// batchEvent is the detail of a BatchCompleted event and the payload of the batch webhook
+type batchEvent struct {
+	Command      string    `json:"command"`
+	RunID        string    `json:"runId"`
+	Time         time.Time `json:"time"`
+	HostedZoneID string    `json:"hostedZoneId"`
+	Action       string    `json:"action"`
+	Changes      int       `json:"changes"`
+	LatencyMs    float64   `json:"latencyMs"`
+	ChangeID     string    `json:"changeId"`
+	Status       string    `json:"status"`
+	// Error is set for a failed change batch
+	Error string `json:"error,omitempty"`
+}
+
+// newBatchEvent describes a change batch that was just answered, out is nil if it failed with err
+func newBatchEvent(command string, runID string, hostedZoneID string, changes []types.Change, latency time.Duration,
+	out *route53.ChangeResourceRecordSetsOutput, err error) batchEvent {
+	event := batchEvent{
+		Command:      command,
+		RunID:        runID,
+		Time:         time.Now().UTC(),
+		HostedZoneID: strings.TrimPrefix(hostedZoneID, "/hostedzone/"),
+		Action:       string(changes[0].Action),
+		Changes:      len(changes),
+		LatencyMs:    milliseconds(latency),
+	}
+	if out != nil && out.ChangeInfo != nil {
+		event.ChangeID = aws.ToString(out.ChangeInfo.Id)
+		event.Status = string(out.ChangeInfo.Status)
+	}
+	if err != nil {
+		event.Status = "FAILED"
+		event.Error = err.Error()
+	}
+	return event
+}
+
+// EventBridgePublisher puts run events and a BatchCompleted event per change batch on an event bus so that other
+// automation can react to runs. Batch events are buffered and put in the background, run events are put immediately.
+// A nil EventBridgePublisher is a no-op.
+type EventBridgePublisher struct {
+	mu      sync.Mutex
+	client  *eventbridge.Client
+	bus     string
+	command string
+	runID   string
+	entries []ebtypes.PutEventsRequestEntry
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// NewEventBridgePublisher starts putting batch events on the bus until Close is called
+func NewEventBridgePublisher(client *eventbridge.Client, bus string, command string, runID string) *EventBridgePublisher {
+	e := &EventBridgePublisher{
+		client:  client,
+		bus:     bus,
+		command: command,
+		runID:   runID,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go func() {
+		defer close(e.stopped)
+		ticker := time.NewTicker(eventBridgeFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				e.flush(context.Background())
+			case <-e.stop:
+				return
+			}
+		}
+	}()
+	return e
+}
+
+// RecordBatch buffers a BatchCompleted event for a successful change batch
+func (e *EventBridgePublisher) RecordBatch(hostedZoneID string, changes []types.Change, latency time.Duration, out *route53.ChangeResourceRecordSetsOutput) {
+	if e == nil || len(changes) == 0 {
+		return
+	}
+	entry, ok := e.entry("BatchCompleted", newBatchEvent(e.command, e.runID, hostedZoneID, changes, latency, out, nil))
+	if !ok {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.entries = append(e.entries, entry)
+}
+
+// Notify puts a run event on the bus along with any buffered batch events so they arrive in order
+func (e *EventBridgePublisher) Notify(ctx context.Context, event runEvent) {
+	if e == nil {
+		return
+	}
+	detailType, ok := eventBridgeDetailTypes[event.Event]
+	if !ok {
+		return
+	}
+	entry, ok := e.entry(detailType, event)
+	if !ok {
+		return
+	}
+	e.mu.Lock()
+	e.entries = append(e.entries, entry)
+	e.mu.Unlock()
+	e.flush(ctx)
+}
+
+// Close stops putting batch events in the background and puts whatever is still buffered
+func (e *EventBridgePublisher) Close(ctx context.Context) {
+	if e == nil {
+		return
+	}
+	close(e.stop)
+	<-e.stopped
+	e.flush(ctx)
+}
+
+func (e *EventBridgePublisher) entry(detailType string, detail any) (ebtypes.PutEventsRequestEntry, bool) {
+	data, err := json.Marshal(detail)
+	if err != nil {
+		slog.Warn("unable to marshal EventBridge event", "detailType", detailType, "error", err)
+		return ebtypes.PutEventsRequestEntry{}, false
+	}
+	return ebtypes.PutEventsRequestEntry{
+		EventBusName: aws.String(e.bus),
+		Source:       aws.String(eventBridgeSource),
+		DetailType:   aws.String(detailType),
+		Detail:       aws.String(string(data)),
+		Time:         aws.Time(time.Now()),
+	}, true
+}
+
+// flush puts the buffered events. Failures are only logged since events shouldn't fail the run.
+func (e *EventBridgePublisher) flush(ctx context.Context) {
+	e.mu.Lock()
+	entries := e.entries
+	e.entries = nil
+	e.mu.Unlock()
+	for len(entries) > 0 {
+		n := min(len(entries), maxEventsPerCall)
+		out, err := e.client.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: entries[:n]})
+		if err != nil {
+			slog.Warn("unable to put events on EventBridge", "bus", e.bus, "error", err)
+		} else if out.FailedEntryCount > 0 {
+			for _, result := range out.Entries {
+				if result.ErrorCode != nil {
+					slog.Warn("EventBridge rejected an event", "bus", e.bus, "code", aws.ToString(result.ErrorCode), "error", aws.ToString(result.ErrorMessage))
+				}
+			}
+		}
+		entries = entries[n:]
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/smithy-go"
+)
+
+// Exit codes so that orchestration scripts can branch on what went wrong. Invalid command line flags also exit with
+// exitConfig since that's what the flag package uses.
+const (
+	exitSuccess = 0
+	// exitError is any failure that doesn't fall into one of the other categories
+	exitError = 1
+	// exitConfig is an invalid flag, config file, environment variable, or AWS config
+	exitConfig = 2
+	// exitAuth is missing or invalid AWS credentials, or a role or permission that doesn't allow the call
+	exitAuth = 3
+	// exitThrottled is a run aborted because Route 53 kept throttling it after retries
+	exitThrottled = 4
+	// exitPartial is a run that failed after some of the changes were already made
+	exitPartial = 5
+	// exitRegression is a report --compare that found a metric regressed beyond the threshold
+	exitRegression = 6
+	// exitAssertions is a run that finished but failed some of the assertions of its config file
+	exitAssertions = 7
+)
+
+var (
+	authErrorCodes = map[string]bool{
+		"AccessDenied":                true,
+		"AccessDeniedException":       true,
+		"ExpiredToken":                true,
+		"ExpiredTokenException":       true,
+		"IncompleteSignature":         true,
+		"InvalidClientTokenId":        true,
+		"InvalidSignatureException":   true,
+		"MissingAuthenticationToken":  true,
+		"SignatureDoesNotMatch":       true,
+		"UnauthorizedOperation":       true,
+		"UnrecognizedClientException": true,
+	}
+	throttlingErrorCodes = map[string]bool{
+		"PriorRequestNotComplete":  true,
+		"RequestLimitExceeded":     true,
+		"Throttling":               true,
+		"ThrottlingException":      true,
+		"TooManyRequestsException": true,
+	}
+)
+
+// exitCode classifies the error a command failed with, given the outcome of the run so far
+func exitCode(err error, summary runSummary) int {
+	var regression *regressionError
+	if errors.As(err, &regression) {
+		return exitRegression
+	}
+	var assertionErr *assertionError
+	if errors.As(err, &assertionErr) {
+		return exitAssertions
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case authErrorCodes[apiErr.ErrorCode()]:
+			return exitAuth
+		case throttlingErrorCodes[apiErr.ErrorCode()]:
+			return exitThrottled
+		}
+	}
+	// the SDK doesn't return a typed error when no credentials can be resolved
+	if strings.Contains(err.Error(), "get credentials") {
+		return exitAuth
+	}
+	if summary.Batches > 0 {
+		return exitPartial
+	}
+	return exitError
+}
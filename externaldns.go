@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// externalDNSEndpointsPerObject and externalDNSHostsPerObject keep the objects well under the size limits of etcd
+	// and of the annotations of an object
+	externalDNSEndpointsPerObject = 1_000
+	externalDNSHostsPerObject     = 100
+	// the annotations the service and ingress sources of external-dns read the record sets of an object from
+	externalDNSHostnameAnnotation = "external-dns.alpha.kubernetes.io/hostname"
+	externalDNSTargetAnnotation   = "external-dns.alpha.kubernetes.io/target"
+	externalDNSTTLAnnotation      = "external-dns.alpha.kubernetes.io/ttl"
+)
+
+// externalDNSKinds are the kinds of objects --external-dns-kind can export the record sets as
+var externalDNSKinds = []string{"dnsendpoint", "service", "ingress"}
+
+// ExternalDNSExport collects the record sets a run created and writes them as the Kubernetes objects external-dns
+// reconciles when closed, so that external-dns can be tested against exactly the zone floodzone built. DNSEndpoint
+// objects of the crd source keep every record set. Service and Ingress objects only produce A, AAAA, and CNAME record
+// sets, with the values of their target annotation, so the record sets of other types are left out of them. A nil
+// ExternalDNSExport is a no-op.
+type ExternalDNSExport struct {
+	mu   sync.Mutex
+	path string
+	kind string
+	// zones are the record sets of the run by hosted zone, in the order they were first seen
+	zones map[string]map[writtenRecord]types.ResourceRecordSet
+	order []string
+}
+
+// NewExternalDNSExport returns an ExternalDNSExport of the kind written to path, as JSON if it ends with .json and as
+// YAML otherwise
+func NewExternalDNSExport(path string, kind string) *ExternalDNSExport {
+	return &ExternalDNSExport{path: path, kind: kind, zones: map[string]map[writtenRecord]types.ResourceRecordSet{}}
+}
+
+// RecordBatch records the record sets created or upserted by a successful change batch, and forgets the deleted ones
+func (e *ExternalDNSExport) RecordBatch(hostedZoneID string, changes []types.Change) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	hostedZoneID = strings.TrimPrefix(hostedZoneID, "/hostedzone/")
+	recordSets, ok := e.zones[hostedZoneID]
+	if !ok {
+		recordSets = map[writtenRecord]types.ResourceRecordSet{}
+		e.zones[hostedZoneID] = recordSets
+		e.order = append(e.order, hostedZoneID)
+	}
+	for _, change := range changes {
+		rr := change.ResourceRecordSet
+		if rr == nil {
+			continue
+		}
+		key := writtenKey(hostedZoneID, *rr)
+		if change.Action == types.ChangeActionDelete {
+			delete(recordSets, key)
+			continue
+		}
+		recordSets[key] = *rr
+	}
+}
+
+// Close writes the objects. Failures are only logged so that a failed run still reports its own error.
+func (e *ExternalDNSExport) Close(_ context.Context) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	objects := e.objects()
+	data, err := marshalK8sObjects(objects, strings.EqualFold(filepath.Ext(e.path), ".json"))
+	if err == nil {
+		err = os.WriteFile(e.path, data, 0o644)
+	}
+	if err != nil {
+		slog.Error("unable to write the external-dns export", "path", e.path, "error", err)
+		return
+	}
+	slog.Info("☸️ Wrote the external-dns export", "path", e.path, "kind", e.kind, "objects", len(objects))
+}
+
+// objects returns the objects of the record sets of every zone, named after the zone
+func (e *ExternalDNSExport) objects() []any {
+	var objects []any
+	for _, hostedZoneID := range e.order {
+		recordSets := make([]types.ResourceRecordSet, 0, len(e.zones[hostedZoneID]))
+		for _, rr := range e.zones[hostedZoneID] {
+			recordSets = append(recordSets, rr)
+		}
+		sort.Slice(recordSets, func(i, j int) bool {
+			if aws.ToString(recordSets[i].Name) != aws.ToString(recordSets[j].Name) {
+				return aws.ToString(recordSets[i].Name) < aws.ToString(recordSets[j].Name)
+			}
+			return recordSets[i].Type < recordSets[j].Type
+		})
+		name := "floodzone-" + strings.ToLower(hostedZoneID)
+		switch e.kind {
+		case "service", "ingress":
+			objects = append(objects, externalDNSSources(e.kind, name, recordSets)...)
+		default:
+			objects = append(objects, externalDNSEndpoints(name, recordSets)...)
+		}
+	}
+	return objects
+}
+
+type k8sList struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Items      []any  `json:"items"`
+}
+
+type k8sDNSEndpoint struct {
+	APIVersion string  `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string  `json:"kind" yaml:"kind"`
+	Metadata   k8sMeta `json:"metadata" yaml:"metadata"`
+	Spec       struct {
+		Endpoints []externalDNSEndpoint `json:"endpoints" yaml:"endpoints"`
+	} `json:"spec" yaml:"spec"`
+}
+
+type externalDNSEndpoint struct {
+	DNSName       string   `json:"dnsName" yaml:"dnsName"`
+	RecordType    string   `json:"recordType" yaml:"recordType"`
+	RecordTTL     int64    `json:"recordTTL,omitempty" yaml:"recordTTL,omitempty"`
+	Targets       []string `json:"targets" yaml:"targets"`
+	SetIdentifier string   `json:"setIdentifier,omitempty" yaml:"setIdentifier,omitempty"`
+}
+
+type k8sService struct {
+	APIVersion string  `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string  `json:"kind" yaml:"kind"`
+	Metadata   k8sMeta `json:"metadata" yaml:"metadata"`
+	Spec       struct {
+		Type      string `json:"type" yaml:"type"`
+		ClusterIP string `json:"clusterIP" yaml:"clusterIP"`
+	} `json:"spec" yaml:"spec"`
+}
+
+type k8sIngress struct {
+	APIVersion string  `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string  `json:"kind" yaml:"kind"`
+	Metadata   k8sMeta `json:"metadata" yaml:"metadata"`
+	Spec       struct {
+		Rules []k8sIngressRule `json:"rules" yaml:"rules"`
+	} `json:"spec" yaml:"spec"`
+}
+
+type k8sIngressRule struct {
+	Host string `json:"host" yaml:"host"`
+}
+
+// externalDNSEndpoints returns the DNSEndpoint objects of the crd source of external-dns with the record sets. Names
+// and targets are written without their trailing dot, the way external-dns reads them from Route 53.
+func externalDNSEndpoints(name string, recordSets []types.ResourceRecordSet) []any {
+	var objects []any
+	for i, chunk := range chunks(recordSets, externalDNSEndpointsPerObject) {
+		object := k8sDNSEndpoint{APIVersion: "externaldns.k8s.io/v1alpha1", Kind: "DNSEndpoint", Metadata: externalDNSMeta(name, i)}
+		for _, rr := range chunk {
+			object.Spec.Endpoints = append(object.Spec.Endpoints, externalDNSEndpoint{
+				DNSName:       externalDNSName(aws.ToString(rr.Name)),
+				RecordType:    string(rr.Type),
+				RecordTTL:     aws.ToInt64(rr.TTL),
+				Targets:       externalDNSTargets(rr),
+				SetIdentifier: aws.ToString(rr.SetIdentifier),
+			})
+		}
+		objects = append(objects, object)
+	}
+	return objects
+}
+
+// externalDNSSources returns the Service or Ingress objects that make external-dns create the A, AAAA, and CNAME record
+// sets. Record sets with the same values and TTL share an object, since external-dns infers their type from the values.
+// Services are headless without a selector, so that they don't route anything.
+func externalDNSSources(kind string, name string, recordSets []types.ResourceRecordSet) []any {
+	type source struct {
+		targets string
+		ttl     int64
+	}
+	hosts := map[source][]string{}
+	var order []source
+	for _, rr := range recordSets {
+		if !slices.Contains([]types.RRType{types.RRTypeA, types.RRTypeAaaa, types.RRTypeCname}, rr.Type) || rr.SetIdentifier != nil {
+			continue
+		}
+		key := source{targets: strings.Join(externalDNSTargets(rr), ","), ttl: aws.ToInt64(rr.TTL)}
+		if _, ok := hosts[key]; !ok {
+			order = append(order, key)
+		}
+		hosts[key] = append(hosts[key], externalDNSName(aws.ToString(rr.Name)))
+	}
+	var objects []any
+	for _, key := range order {
+		for _, chunk := range chunks(hosts[key], externalDNSHostsPerObject) {
+			meta := externalDNSMeta(name, len(objects))
+			meta.Annotations = map[string]string{externalDNSTargetAnnotation: key.targets}
+			if key.ttl != 0 {
+				meta.Annotations[externalDNSTTLAnnotation] = strconv.FormatInt(key.ttl, 10)
+			}
+			if kind == "service" {
+				meta.Annotations[externalDNSHostnameAnnotation] = strings.Join(chunk, ",")
+				object := k8sService{APIVersion: "v1", Kind: "Service", Metadata: meta}
+				object.Spec.Type, object.Spec.ClusterIP = "ClusterIP", "None"
+				objects = append(objects, object)
+				continue
+			}
+			object := k8sIngress{APIVersion: "networking.k8s.io/v1", Kind: "Ingress", Metadata: meta}
+			for _, host := range chunk {
+				object.Spec.Rules = append(object.Spec.Rules, k8sIngressRule{Host: host})
+			}
+			objects = append(objects, object)
+		}
+	}
+	return objects
+}
+
+func externalDNSMeta(name string, i int) k8sMeta {
+	name = fmt.Sprintf("%s-%d", name, i)
+	return k8sMeta{Name: name, Labels: map[string]string{"app.kubernetes.io/name": "floodzone", "app.kubernetes.io/instance": name}}
+}
+
+func externalDNSName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+func externalDNSTargets(rr types.ResourceRecordSet) []string {
+	targets := make([]string, 0, len(rr.ResourceRecords))
+	for _, value := range rr.ResourceRecords {
+		targets = append(targets, strings.TrimSuffix(aws.ToString(value.Value), "."))
+	}
+	return targets
+}
+
+// chunks splits s into chunks of up to size elements
+func chunks[T any](s []T, size int) [][]T {
+	var out [][]T
+	for len(s) > size {
+		out = append(out, s[:size])
+		s = s[size:]
+	}
+	if len(s) > 0 {
+		out = append(out, s)
+	}
+	return out
+}
+
+// marshalK8sObjects returns the objects as a YAML stream that kubectl apply -f takes, or as a JSON List
+func marshalK8sObjects(objects []any, asJSON bool) ([]byte, error) {
+	if asJSON {
+		data, err := json.MarshalIndent(k8sList{APIVersion: "v1", Kind: "List", Items: objects}, "", "    ")
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal objects: %w", err)
+		}
+		return append(data, '\n'), nil
+	}
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	for _, object := range objects {
+		if err := enc.Encode(object); err != nil {
+			return nil, fmt.Errorf("unable to marshal objects: %w", err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("unable to marshal objects: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// validateExternalDNS validates the kind of objects of --external-dns
+func validateExternalDNS(opts Options) error {
+	if !slices.Contains(externalDNSKinds, opts.ExternalDNSKind) {
+		return fmt.Errorf("--external-dns-kind must be one of %s, got %q", strings.Join(externalDNSKinds, ", "), opts.ExternalDNSKind)
+	}
+	return nil
+}
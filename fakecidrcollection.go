@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// defaultFakeCidrCollectionLimit is the default Route 53 quota of CIDR collections per account
+	defaultFakeCidrCollectionLimit = 5
+	// defaultFakeCidrBlockLimit is the default Route 53 quota of CIDR blocks per CIDR collection
+	defaultFakeCidrBlockLimit = 1000
+	// fakeMaxCidrChanges is the most locations a ChangeCidrCollection call can change, and the most CIDR blocks a
+	// location can be changed with at once, like Route 53
+	fakeMaxCidrChanges = 1000
+	// fakeMaxCidrItems is the most CIDR collections or blocks the fake server lists at once
+	fakeMaxCidrItems = 100
+)
+
+// fakeCidrLocationName matches the names Route 53 accepts for the locations of a CIDR collection
+var fakeCidrLocationName = regexp.MustCompile(`^[0-9A-Za-z_\-]{1,16}$`)
+
+// fakeCidrCollection is a CIDR collection of the fake server, whose version goes up with every change
+type fakeCidrCollection struct {
+	id      string
+	name    string
+	caller  string
+	version int64
+	// locations are the CIDR blocks of every location, a location existing as long as it has one
+	locations map[string][]string
+}
+
+func (c *fakeCidrCollection) summary() fakeCidrCollectionSummary {
+	return fakeCidrCollectionSummary{Arn: "arn:aws:route53:::cidrcollection/" + c.id, ID: c.id, Name: c.name, Version: c.version}
+}
+
+// blocks returns every CIDR block of the collection ordered by location and block
+func (c *fakeCidrCollection) blocks() []fakeCidrBlockSummary {
+	var blocks []fakeCidrBlockSummary
+	for location, cidrs := range c.locations {
+		for _, cidr := range cidrs {
+			blocks = append(blocks, fakeCidrBlockSummary{CidrBlock: cidr, LocationName: location})
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		if blocks[i].LocationName != blocks[j].LocationName {
+			return blocks[i].LocationName < blocks[j].LocationName
+		}
+		return blocks[i].CidrBlock < blocks[j].CidrBlock
+	})
+	return blocks
+}
+
+func (f *FakeRoute53) createCidrCollection(r *http.Request) (any, *fakeError) {
+	var req struct {
+		Name            string `xml:"Name"`
+		CallerReference string `xml:"CallerReference"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, invalidInput("unable to parse request: %v", err)
+	}
+	if req.Name == "" || req.CallerReference == "" {
+		return nil, invalidInput("Name and CallerReference are required")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, collection := range f.cidrCollections {
+		if collection.name == req.Name || collection.caller == req.CallerReference {
+			return nil, &fakeError{http.StatusConflict, "CidrCollectionAlreadyExistsException", fmt.Sprintf("A CIDR collection with the name %s or caller reference %s already exists", req.Name, req.CallerReference)}
+		}
+	}
+	if len(f.cidrCollections) >= f.collectionLimit {
+		return nil, &fakeError{http.StatusBadRequest, "LimitsExceeded", fmt.Sprintf("The maximum number of CIDR collections, %d, has been reached", f.collectionLimit)}
+	}
+	collection := &fakeCidrCollection{id: uuid.NewString(), name: req.Name, caller: req.CallerReference, version: 1, locations: map[string][]string{}}
+	f.cidrCollections[collection.id] = collection
+	return fakeCreateCidrCollectionResponse{XMLNS: fakeRoute53Namespace, Collection: collection.summary()}, nil
+}
+
+// changeCidrCollection applies the changes of the request to a copy of the locations of the collection, so that they're
+// applied entirely or not at all, and rejects them if the collection isn't at the version the request expects
+func (f *FakeRoute53) changeCidrCollection(id string, r *http.Request) (any, *fakeError) {
+	var req struct {
+		CollectionVersion *int64 `xml:"CollectionVersion"`
+		Changes           []struct {
+			LocationName string   `xml:"LocationName"`
+			Action       string   `xml:"Action"`
+			CidrList     []string `xml:"CidrList>Cidr"`
+		} `xml:"Changes>member"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, invalidInput("unable to parse request: %v", err)
+	}
+	if len(req.Changes) == 0 || len(req.Changes) > fakeMaxCidrChanges {
+		return nil, invalidInput("a request must have between 1 and %d changes", fakeMaxCidrChanges)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	collection, ferr := f.cidrCollection(id)
+	if ferr != nil {
+		return nil, ferr
+	}
+	if req.CollectionVersion != nil && *req.CollectionVersion != collection.version {
+		return nil, &fakeError{http.StatusConflict, "CidrCollectionVersionMismatchException", fmt.Sprintf("The CIDR collection is at version %d, not %d", collection.version, *req.CollectionVersion)}
+	}
+	locations := make(map[string][]string, len(collection.locations))
+	owners := map[string]string{}
+	for location, cidrs := range collection.locations {
+		locations[location] = slices.Clone(cidrs)
+		for _, cidr := range cidrs {
+			owners[cidr] = location
+		}
+	}
+	for _, change := range req.Changes {
+		if !fakeCidrLocationName.MatchString(change.LocationName) {
+			return nil, invalidInput("LocationName %q must be 1 to 16 letters, digits, hyphens, or underscores", change.LocationName)
+		}
+		if len(change.CidrList) == 0 || len(change.CidrList) > fakeMaxCidrChanges {
+			return nil, invalidInput("CidrList of location %s must have between 1 and %d CIDR blocks", change.LocationName, fakeMaxCidrChanges)
+		}
+		for _, cidr := range change.CidrList {
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil || prefix.Masked() != prefix {
+				return nil, invalidInput("%q is not a CIDR block", cidr)
+			}
+			switch change.Action {
+			case "PUT":
+				if owner, ok := owners[cidr]; ok {
+					if owner != change.LocationName {
+						return nil, invalidInput("CIDR block %s is already in location %s", cidr, owner)
+					}
+					continue
+				}
+				owners[cidr] = change.LocationName
+				locations[change.LocationName] = append(locations[change.LocationName], cidr)
+			case "DELETE_IF_EXISTS":
+				if owners[cidr] != change.LocationName {
+					continue
+				}
+				delete(owners, cidr)
+				locations[change.LocationName] = slices.DeleteFunc(locations[change.LocationName], func(c string) bool { return c == cidr })
+				if len(locations[change.LocationName]) == 0 {
+					delete(locations, change.LocationName)
+				}
+			default:
+				return nil, invalidInput("Invalid action %q", change.Action)
+			}
+		}
+	}
+	if len(owners) > f.blockLimit {
+		return nil, &fakeError{http.StatusBadRequest, "LimitsExceeded", fmt.Sprintf("The changes exceed the limit of %d CIDR blocks of CIDR collection %s", f.blockLimit, collection.id)}
+	}
+	collection.locations = locations
+	collection.version++
+	return fakeChangeCidrCollectionResponse{XMLNS: fakeRoute53Namespace, ID: collection.id}, nil
+}
+
+func (f *FakeRoute53) listCidrCollections(r *http.Request) (any, *fakeError) {
+	start, end, ferr := fakeCidrPage(r.URL.Query())
+	if ferr != nil {
+		return nil, ferr
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	summaries := make([]fakeCidrCollectionSummary, 0, len(f.cidrCollections))
+	for _, collection := range f.cidrCollections {
+		summaries = append(summaries, collection.summary())
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].ID < summaries[j].ID })
+	start, end = min(start, len(summaries)), min(end, len(summaries))
+	resp := fakeListCidrCollectionsResponse{XMLNS: fakeRoute53Namespace, CidrCollections: summaries[start:end]}
+	if end < len(summaries) {
+		resp.NextToken = strconv.Itoa(end)
+	}
+	return resp, nil
+}
+
+func (f *FakeRoute53) listCidrBlocks(id string, r *http.Request) (any, *fakeError) {
+	query := r.URL.Query()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	collection, ferr := f.cidrCollection(id)
+	if ferr != nil {
+		return nil, ferr
+	}
+	blocks := collection.blocks()
+	if location := query.Get("location"); location != "" {
+		if _, ok := collection.locations[location]; !ok {
+			return nil, &fakeError{http.StatusNotFound, "NoSuchCidrLocationException", fmt.Sprintf("No location %s exists in CIDR collection %s", location, id)}
+		}
+		blocks = slices.DeleteFunc(blocks, func(b fakeCidrBlockSummary) bool { return b.LocationName != location })
+	}
+	start, end, ferr := fakeCidrPage(query)
+	if ferr != nil {
+		return nil, ferr
+	}
+	start, end = min(start, len(blocks)), min(end, len(blocks))
+	resp := fakeListCidrBlocksResponse{XMLNS: fakeRoute53Namespace, CidrBlocks: blocks[start:end]}
+	if end < len(blocks) {
+		resp.NextToken = strconv.Itoa(end)
+	}
+	return resp, nil
+}
+
+func (f *FakeRoute53) deleteCidrCollection(id string) (any, *fakeError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	collection, ferr := f.cidrCollection(id)
+	if ferr != nil {
+		return nil, ferr
+	}
+	if len(collection.locations) > 0 {
+		return nil, &fakeError{http.StatusBadRequest, "CidrCollectionInUseException", fmt.Sprintf("The CIDR collection %s still has %d locations", id, len(collection.locations))}
+	}
+	delete(f.cidrCollections, id)
+	return fakeDeleteCidrCollectionResponse{XMLNS: fakeRoute53Namespace}, nil
+}
+
+func (f *FakeRoute53) cidrCollection(id string) (*fakeCidrCollection, *fakeError) {
+	collection, ok := f.cidrCollections[id]
+	if !ok {
+		return nil, &fakeError{http.StatusNotFound, "NoSuchCidrCollectionException", fmt.Sprintf("No CIDR collection exists with the specified ID %s", id)}
+	}
+	return collection, nil
+}
+
+// fakeCidrPage returns the range of items of the page the nexttoken and maxresults of the query ask for, the token
+// being the index of the first item of the page
+func fakeCidrPage(query url.Values) (int, int, *fakeError) {
+	maxResults := fakeMaxCidrItems
+	if s := query.Get("maxresults"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return 0, 0, invalidInput("maxresults must be a positive number, got %q", s)
+		}
+		maxResults = min(n, fakeMaxCidrItems)
+	}
+	start := 0
+	if token := query.Get("nexttoken"); token != "" {
+		n, err := strconv.Atoi(token)
+		if err != nil || n < 0 {
+			return 0, 0, invalidInput("invalid nexttoken %q", token)
+		}
+		start = n
+	}
+	return start, start + maxResults, nil
+}
+
+type fakeCidrCollectionSummary struct {
+	Arn     string `xml:"Arn"`
+	ID      string `xml:"Id"`
+	Name    string `xml:"Name"`
+	Version int64  `xml:"Version"`
+}
+
+type fakeCidrBlockSummary struct {
+	CidrBlock    string `xml:"CidrBlock"`
+	LocationName string `xml:"LocationName"`
+}
+
+type fakeCreateCidrCollectionResponse struct {
+	XMLName    xml.Name                  `xml:"CreateCidrCollectionResponse"`
+	XMLNS      string                    `xml:"xmlns,attr"`
+	Collection fakeCidrCollectionSummary `xml:"Collection"`
+}
+
+type fakeChangeCidrCollectionResponse struct {
+	XMLName xml.Name `xml:"ChangeCidrCollectionResponse"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	ID      string   `xml:"Id"`
+}
+
+type fakeListCidrCollectionsResponse struct {
+	XMLName         xml.Name                    `xml:"ListCidrCollectionsResponse"`
+	XMLNS           string                      `xml:"xmlns,attr"`
+	CidrCollections []fakeCidrCollectionSummary `xml:"CidrCollections>member"`
+	NextToken       string                      `xml:"NextToken,omitempty"`
+}
+
+type fakeListCidrBlocksResponse struct {
+	XMLName    xml.Name               `xml:"ListCidrBlocksResponse"`
+	XMLNS      string                 `xml:"xmlns,attr"`
+	CidrBlocks []fakeCidrBlockSummary `xml:"CidrBlocks>member"`
+	NextToken  string                 `xml:"NextToken,omitempty"`
+}
+
+type fakeDeleteCidrCollectionResponse struct {
+	XMLName xml.Name `xml:"DeleteCidrCollectionResponse"`
+	XMLNS   string   `xml:"xmlns,attr"`
+}
@@ -0,0 +1,1060 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/google/uuid"
+)
+
+const (
+	// fakeRoute53APIVersion prefixes every path of the Route 53 API
+	fakeRoute53APIVersion = "/2013-04-01"
+	// fakeRoute53Namespace is the XML namespace of the Route 53 API
+	fakeRoute53Namespace = "https://route53.amazonaws.com/doc/2013-04-01/"
+	// fakeAccountID owns the zones of the fake server
+	fakeAccountID = "123456789012"
+	// fakeMaxListItems is the most record sets the fake server lists at once, like Route 53
+	fakeMaxListItems = 300
+	// fakeMaxHealthCheckItems is the most health checks the fake server lists at once, like Route 53
+	fakeMaxHealthCheckItems = 1000
+	// fakeMaxChildHealthChecks is the most health checks a calculated health check can aggregate, like Route 53
+	fakeMaxChildHealthChecks = 255
+	// fakeMinHealthCheckRegions is the fewest regions a health check can check from, like Route 53
+	fakeMinHealthCheckRegions = 3
+	// defaultFakeHealthCheckLimit is the default Route 53 quota of health checks per account
+	defaultFakeHealthCheckLimit = 200
+	// fakeMaxSetIdentifiers is the most record sets with a routing policy a name and type can have, like Route 53
+	fakeMaxSetIdentifiers = 100
+	// fakeRoute53Header is set on every response of the fake server, so that floodzone knows what --endpoint is
+	fakeRoute53Header = "X-Floodzone-Fake-Route53"
+	// fakeRoute53ProbeTimeout is how long floodzone waits for --endpoint to answer whether it's the fake server
+	fakeRoute53ProbeTimeout = 2 * time.Second
+)
+
+func init() {
+	commands = append(commands, command{
+		name:        "fake-route53",
+		description: "Serve a fake Route 53 API in memory with realistic throttling, to run floodzone against with --endpoint without an AWS account. Only Route 53 is faked, so runs against it leave the VPCs and resolver endpoints of deleted zones alone",
+		flags: func(fs *flag.FlagSet, opts *Options) {
+			fs.StringVar(&opts.FakeAddr, "listen", "localhost:8053", "Address to serve the fake Route 53 API on")
+			fs.Float64Var(&opts.FakeRate, "rate", 5, "Requests per second across all operations before calls are throttled like Route 53 does, 0 never throttles")
+			fs.DurationVar(&opts.FakePropagation, "propagation", 10*time.Second, "How long changes stay PENDING before they're INSYNC")
+			fs.DurationVar(&opts.FakeLatency, "latency", 0, "Latency added to every ChangeResourceRecordSets, ChangeCidrCollection, AssociateVPCWithHostedZone, and DisassociateVPCFromHostedZone call")
+			fs.IntVar(&opts.FakeRecordLimit, "record-limit", defaultRecordSetLimit, "Record set quota of every hosted zone")
+			fs.IntVar(&opts.FakeHealthCheckLimit, "health-check-limit", defaultFakeHealthCheckLimit, "Health check quota of the account")
+			fs.IntVar(&opts.FakeTrafficPolicyLimit, "traffic-policy-limit", defaultFakeTrafficPolicyLimit, "Traffic policy quota of the account")
+			fs.IntVar(&opts.FakePolicyInstanceLimit, "traffic-policy-instance-limit", defaultFakeTrafficPolicyInstanceLimit, "Traffic policy instance quota of the account")
+			fs.IntVar(&opts.FakeCidrCollectionLimit, "cidr-collection-limit", defaultFakeCidrCollectionLimit, "CIDR collection quota of the account")
+			fs.IntVar(&opts.FakeCidrBlockLimit, "cidr-block-limit", defaultFakeCidrBlockLimit, "CIDR block quota of every CIDR collection")
+			fs.IntVar(&opts.FakeVPCAssociationLimit, "vpc-association-limit", defaultFakeVPCAssociationLimit, "Quota of VPCs associated with every private hosted zone")
+		},
+		runLocal: runFakeRoute53,
+	})
+}
+
+func runFakeRoute53(ctx context.Context, opts Options, _ []string) error {
+	if opts.FakeRate < 0 || opts.FakePropagation < 0 || opts.FakeLatency < 0 || opts.FakeRecordLimit < 1 || opts.FakeHealthCheckLimit < 0 || opts.FakeTrafficPolicyLimit < 0 || opts.FakePolicyInstanceLimit < 0 ||
+		opts.FakeCidrCollectionLimit < 0 || opts.FakeCidrBlockLimit < 0 || opts.FakeVPCAssociationLimit < 0 {
+		return errors.New("--rate, --propagation, --latency, and the --*-limit quotas must not be negative, and --record-limit must be at least 1")
+	}
+	listener, err := net.Listen("tcp", opts.FakeAddr)
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s: %w", opts.FakeAddr, err)
+	}
+	fake := NewFakeRoute53(opts.FakeRate, opts.FakePropagation, opts.FakeLatency, opts.FakeRecordLimit, opts.FakeHealthCheckLimit, opts.FakeTrafficPolicyLimit, opts.FakePolicyInstanceLimit,
+		opts.FakeCidrCollectionLimit, opts.FakeCidrBlockLimit, opts.FakeVPCAssociationLimit)
+	server := &http.Server{Handler: fake, ReadHeaderTimeout: 10 * time.Second}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errs := make(chan error, 1)
+	go func() { errs <- server.Serve(listener) }()
+	endpoint := "http://" + listener.Addr().String()
+	slog.Info("🚀 Serving a fake Route 53 API", "endpoint", endpoint, "rate", opts.FakeRate)
+	// the SDK signs every request, so it needs credentials even though the fake server doesn't check them
+	slog.Info(fmt.Sprintf("Run floodzone against it with: AWS_ACCESS_KEY_ID=fake AWS_SECRET_ACCESS_KEY=fake AWS_REGION=us-east-1 floodzone flood --endpoint %s --vpc-id vpc-fake", endpoint))
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+	}
+	if err := server.Shutdown(context.Background()); err != nil {
+		slog.Warn("unable to stop the fake Route 53 API", "error", err)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// isFakeRoute53Endpoint returns whether the endpoint is served by the fake-route53 command, false if it can't be reached
+func isFakeRoute53Endpoint(ctx context.Context, endpoint string) bool {
+	ctx, cancel := context.WithTimeout(ctx, fakeRoute53ProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(endpoint, "/")+fakeRoute53APIVersion+"/hostedzonecount", nil)
+	if err != nil {
+		return false
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		slog.Debug("unable to check whether --endpoint is fake-route53", "endpoint", endpoint, "error", err)
+		return false
+	}
+	resp.Body.Close()
+	return resp.Header.Get(fakeRoute53Header) != ""
+}
+
+// FakeRoute53 serves the Route 53 operations floodzone calls from memory, so that floodzone can be developed, demoed,
+// and run in CI without an AWS account. Like Route 53, it throttles the requests over a rate across all operations,
+// rejects change batches that conflict with the zone, exceed its quota, or put more than 100 record sets with a routing
+// policy under a name and type atomically, and reports changes PENDING until they propagated. Health checks count
+// towards the health check quota of the account, and can't be deleted while a record set refers to them. Traffic
+// policies count towards the traffic policy quota of the account until their last version is deleted, and their
+// versions can't be deleted while traffic policy instances use them. Only its traffic policy instance can change the
+// record set it created. CIDR collections count towards the CIDR collection quota of the account, and their CIDR blocks
+// towards the CIDR block quota of the collection. The VPCs associated with a private zone count towards its VPC
+// association quota, and a zone changes one association at a time.
+type FakeRoute53 struct {
+	mu                 sync.Mutex
+	zones              map[string]*fakeZone
+	changes            map[string]time.Time
+	healthChecks       map[string]fakeHealthCheck
+	trafficPolicies    map[string]*fakeTrafficPolicy
+	policyInstances    map[string]*fakeTrafficPolicyInstance
+	cidrCollections    map[string]*fakeCidrCollection
+	limiter            *fakeRateLimiter
+	propagation        time.Duration
+	latency            time.Duration
+	recordLimit        int
+	healthCheckLimit   int
+	trafficPolicyLimit int
+	instanceLimit      int
+	collectionLimit    int
+	blockLimit         int
+	vpcLimit           int
+}
+
+// fakeZone is a hosted zone of the fake server
+type fakeZone struct {
+	id         string
+	name       string
+	caller     string
+	comment    string
+	private    bool
+	vpcs       []fakeVPC
+	recordSets map[fakeRecordKey]fakeRecordSet
+	// vpcChanging is whether a VPC is being associated with the zone or disassociated from it
+	vpcChanging bool
+}
+
+// fakeRecordKey identifies a record set in a zone
+type fakeRecordKey struct {
+	name          string
+	rrType        string
+	setIdentifier string
+}
+
+// NewFakeRoute53 returns a fake Route 53 API that throttles over rate requests per second, or never if it's 0
+func NewFakeRoute53(rate float64, propagation time.Duration, latency time.Duration, recordLimit int, healthCheckLimit int, trafficPolicyLimit int, instanceLimit int,
+	collectionLimit int, blockLimit int, vpcLimit int) *FakeRoute53 {
+	return &FakeRoute53{
+		zones:              map[string]*fakeZone{},
+		changes:            map[string]time.Time{},
+		healthChecks:       map[string]fakeHealthCheck{},
+		trafficPolicies:    map[string]*fakeTrafficPolicy{},
+		policyInstances:    map[string]*fakeTrafficPolicyInstance{},
+		cidrCollections:    map[string]*fakeCidrCollection{},
+		limiter:            newFakeRateLimiter(rate),
+		propagation:        propagation,
+		latency:            latency,
+		recordLimit:        recordLimit,
+		healthCheckLimit:   healthCheckLimit,
+		trafficPolicyLimit: trafficPolicyLimit,
+		instanceLimit:      instanceLimit,
+		collectionLimit:    collectionLimit,
+		blockLimit:         blockLimit,
+		vpcLimit:           vpcLimit,
+	}
+}
+
+// ServeHTTP routes a Route 53 API call to its operation
+func (f *FakeRoute53) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	requestID := uuid.NewString()
+	rw.Header().Set("x-amzn-RequestId", requestID)
+	rw.Header().Set(fakeRoute53Header, "true")
+	if !f.limiter.allow() {
+		writeFakeError(rw, requestID, http.StatusBadRequest, "Throttling", "Rate exceeded")
+		return
+	}
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, fakeRoute53APIVersion), "/")
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	var result any
+	var err *fakeError
+	switch {
+	case r.Method == http.MethodPost && path == "/hostedzone":
+		result, err = f.createHostedZone(r)
+		if err == nil {
+			rw.Header().Set("Location", fakeRoute53APIVersion+result.(fakeCreateHostedZoneResponse).HostedZone.ID)
+		}
+	case len(parts) == 2 && parts[0] == "hostedzone" && r.Method == http.MethodGet:
+		result, err = f.getHostedZone(parts[1])
+	case len(parts) == 2 && parts[0] == "hostedzone" && r.Method == http.MethodDelete:
+		result, err = f.deleteHostedZone(parts[1])
+	case len(parts) == 3 && parts[0] == "hostedzone" && parts[2] == "rrset" && r.Method == http.MethodPost:
+		time.Sleep(f.latency)
+		result, err = f.changeResourceRecordSets(parts[1], r)
+	case len(parts) == 3 && parts[0] == "hostedzone" && parts[2] == "rrset" && r.Method == http.MethodGet:
+		result, err = f.listResourceRecordSets(parts[1], r)
+	case len(parts) == 3 && parts[0] == "hostedzone" && (parts[2] == "associatevpc" || parts[2] == "disassociatevpc") && r.Method == http.MethodPost:
+		result, err = f.changeVPCAssociation(parts[1], parts[2] == "associatevpc", r)
+	case len(parts) == 3 && parts[0] == "hostedzone" && parts[2] == "dnssec" && r.Method == http.MethodGet:
+		result, err = f.getDNSSEC(parts[1])
+	case len(parts) == 2 && parts[0] == "change" && r.Method == http.MethodGet:
+		result, err = f.getChange(parts[1])
+	case path == "/hostedzonesbyvpc" && r.Method == http.MethodGet:
+		result, err = f.listHostedZonesByVPC(r)
+	case len(parts) == 3 && parts[0] == "hostedzonelimit" && r.Method == http.MethodGet:
+		result, err = f.getHostedZoneLimit(parts[1], parts[2])
+	case path == "/queryloggingconfig" && r.Method == http.MethodGet:
+		result = fakeListQueryLoggingConfigsResponse{XMLNS: fakeRoute53Namespace}
+	case path == "/testdnsanswer" && r.Method == http.MethodGet:
+		result, err = f.testDNSAnswer(r)
+	case path == "/healthcheck" && r.Method == http.MethodPost:
+		result, err = f.createHealthCheck(r)
+		if err == nil {
+			rw.Header().Set("Location", fakeRoute53APIVersion+"/healthcheck/"+result.(fakeCreateHealthCheckResponse).HealthCheck.ID)
+		}
+	case path == "/healthcheck" && r.Method == http.MethodGet:
+		result, err = f.listHealthChecks(r)
+	case len(parts) == 2 && parts[0] == "healthcheck" && r.Method == http.MethodDelete:
+		result, err = f.deleteHealthCheck(parts[1])
+	case path == "/trafficpolicy" && r.Method == http.MethodPost:
+		result, err = f.createTrafficPolicy(r)
+		if err == nil {
+			policy := result.(fakeCreateTrafficPolicyResponse).TrafficPolicy
+			rw.Header().Set("Location", fmt.Sprintf("%s/trafficpolicy/%s/%d", fakeRoute53APIVersion, policy.ID, policy.Version))
+		}
+	case len(parts) == 2 && parts[0] == "trafficpolicy" && r.Method == http.MethodPost:
+		result, err = f.createTrafficPolicyVersion(parts[1], r)
+		if err == nil {
+			policy := result.(fakeCreateTrafficPolicyVersionResponse).TrafficPolicy
+			rw.Header().Set("Location", fmt.Sprintf("%s/trafficpolicy/%s/%d", fakeRoute53APIVersion, policy.ID, policy.Version))
+		}
+	case path == "/trafficpolicies" && r.Method == http.MethodGet:
+		result, err = f.listTrafficPolicies(r)
+	case len(parts) == 3 && parts[0] == "trafficpolicies" && parts[2] == "versions" && r.Method == http.MethodGet:
+		result, err = f.listTrafficPolicyVersions(parts[1], r)
+	case len(parts) == 3 && parts[0] == "trafficpolicy" && r.Method == http.MethodDelete:
+		result, err = f.deleteTrafficPolicy(parts[1], parts[2])
+	case path == "/trafficpolicyinstance" && r.Method == http.MethodPost:
+		result, err = f.createTrafficPolicyInstance(r)
+		if err == nil {
+			rw.Header().Set("Location", fakeRoute53APIVersion+"/trafficpolicyinstance/"+result.(fakeCreateTrafficPolicyInstanceResponse).TrafficPolicyInstance.ID)
+		}
+	case len(parts) == 2 && parts[0] == "trafficpolicyinstance" && r.Method == http.MethodDelete:
+		result, err = f.deleteTrafficPolicyInstance(parts[1])
+	case path == "/trafficpolicyinstances" && r.Method == http.MethodGet:
+		result, err = f.listTrafficPolicyInstances("", r)
+	case path == "/trafficpolicyinstances/hostedzone" && r.Method == http.MethodGet:
+		if r.URL.Query().Get("id") == "" {
+			err = invalidInput("id is required")
+			break
+		}
+		result, err = f.listTrafficPolicyInstances(r.URL.Query().Get("id"), r)
+	case path == "/cidrcollection" && r.Method == http.MethodPost:
+		result, err = f.createCidrCollection(r)
+		if err == nil {
+			rw.Header().Set("Location", fakeRoute53APIVersion+"/cidrcollection/"+result.(fakeCreateCidrCollectionResponse).Collection.ID)
+		}
+	case path == "/cidrcollection" && r.Method == http.MethodGet:
+		result, err = f.listCidrCollections(r)
+	case len(parts) == 2 && parts[0] == "cidrcollection" && r.Method == http.MethodPost:
+		time.Sleep(f.latency)
+		result, err = f.changeCidrCollection(parts[1], r)
+	case len(parts) == 2 && parts[0] == "cidrcollection" && r.Method == http.MethodDelete:
+		result, err = f.deleteCidrCollection(parts[1])
+	case len(parts) == 3 && parts[0] == "cidrcollection" && parts[2] == "cidrblocks" && r.Method == http.MethodGet:
+		result, err = f.listCidrBlocks(parts[1], r)
+	default:
+		err = &fakeError{http.StatusBadRequest, "InvalidAction", fmt.Sprintf("%s %s is not supported by the fake Route 53 API", r.Method, r.URL.Path)}
+	}
+	if err != nil {
+		slog.Debug("Fake Route 53 call failed", "method", r.Method, "path", r.URL.Path, "code", err.code, "error", err.message)
+		writeFakeError(rw, requestID, err.status, err.code, err.message)
+		return
+	}
+	status := http.StatusOK
+	if r.Method == http.MethodPost && (path == "/hostedzone" || path == "/healthcheck" || parts[0] == "trafficpolicy" || parts[0] == "trafficpolicyinstance" || path == "/cidrcollection") {
+		status = http.StatusCreated
+	}
+	slog.Debug("Fake Route 53 call", "method", r.Method, "path", r.URL.Path)
+	writeFakeResult(rw, status, result)
+}
+
+func (f *FakeRoute53) createHostedZone(r *http.Request) (any, *fakeError) {
+	var req struct {
+		Name             string `xml:"Name"`
+		CallerReference  string `xml:"CallerReference"`
+		HostedZoneConfig struct {
+			Comment     string `xml:"Comment"`
+			PrivateZone bool   `xml:"PrivateZone"`
+		} `xml:"HostedZoneConfig"`
+		VPC *fakeVPC `xml:"VPC"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, invalidInput("unable to parse request: %v", err)
+	}
+	if req.Name == "" || req.CallerReference == "" {
+		return nil, invalidInput("Name and CallerReference are required")
+	}
+	private := req.HostedZoneConfig.PrivateZone || req.VPC != nil
+	if private && req.VPC == nil {
+		return nil, invalidInput("a private hosted zone requires a VPC")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, zone := range f.zones {
+		if zone.caller == req.CallerReference {
+			return nil, &fakeError{http.StatusConflict, "HostedZoneAlreadyExists", fmt.Sprintf("A hosted zone has already been created with the specified caller reference %s", req.CallerReference)}
+		}
+	}
+	name := fakeNormalizeName(req.Name)
+	zone := &fakeZone{
+		id:         "Z" + fakeID(),
+		name:       name,
+		caller:     req.CallerReference,
+		comment:    req.HostedZoneConfig.Comment,
+		private:    private,
+		recordSets: map[fakeRecordKey]fakeRecordSet{},
+	}
+	if req.VPC != nil {
+		zone.vpcs = append(zone.vpcs, *req.VPC)
+	}
+	// like every hosted zone, it starts with its SOA and NS record sets
+	for _, rr := range []fakeRecordSet{
+		{Name: name, Type: "SOA", TTL: aws.Int64(900), ResourceRecords: []fakeRecord{{Value: "ns-1.fakeroute53.local. hostmaster.fakeroute53.local. 1 7200 900 1209600 86400"}}},
+		{Name: name, Type: "NS", TTL: aws.Int64(172800), ResourceRecords: []fakeRecord{{Value: "ns-1.fakeroute53.local."}, {Value: "ns-2.fakeroute53.local."}}},
+	} {
+		zone.recordSets[rr.key()] = rr
+	}
+	f.zones[zone.id] = zone
+	slog.Info("✅ Successfully Created fake hosted zone", "zone", zone.id, "name", name, "private", private)
+	resp := fakeCreateHostedZoneResponse{XMLNS: fakeRoute53Namespace, HostedZone: zone.hostedZone(), ChangeInfo: f.newChange(), VPC: req.VPC}
+	if !private {
+		resp.DelegationSet = &fakeDelegationSet{NameServers: []string{"ns-1.fakeroute53.local", "ns-2.fakeroute53.local"}}
+	}
+	return resp, nil
+}
+
+func (f *FakeRoute53) getHostedZone(id string) (any, *fakeError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	zone, err := f.zone(id)
+	if err != nil {
+		return nil, err
+	}
+	return fakeGetHostedZoneResponse{XMLNS: fakeRoute53Namespace, HostedZone: zone.hostedZone(), VPCs: zone.vpcs}, nil
+}
+
+func (f *FakeRoute53) deleteHostedZone(id string) (any, *fakeError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	zone, err := f.zone(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(zone.recordSets) > 2 {
+		return nil, &fakeError{http.StatusBadRequest, "HostedZoneNotEmpty", "The hosted zone contains resource record sets in addition to the default NS and SOA resource record sets."}
+	}
+	delete(f.zones, zone.id)
+	slog.Info("✅ Successfully Deleted fake hosted zone", "zone", zone.id)
+	return fakeChangeResponse{XMLName: xml.Name{Local: "DeleteHostedZoneResponse"}, XMLNS: fakeRoute53Namespace, ChangeInfo: f.newChange()}, nil
+}
+
+func (f *FakeRoute53) changeResourceRecordSets(id string, r *http.Request) (any, *fakeError) {
+	var req struct {
+		Changes []struct {
+			Action            string        `xml:"Action"`
+			ResourceRecordSet fakeRecordSet `xml:"ResourceRecordSet"`
+		} `xml:"ChangeBatch>Changes>Change"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, invalidInput("unable to parse request: %v", err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	zone, err := f.zone(id)
+	if err != nil {
+		return nil, err
+	}
+	// an UPSERT counts as a DELETE and a CREATE towards the changes in a batch
+	changes := 0
+	for _, change := range req.Changes {
+		changes++
+		if change.Action == "UPSERT" {
+			changes++
+		}
+	}
+	if changes == 0 || changes > maxChangesPerBatch {
+		return nil, invalidChangeBatch("Number of records limit of %d exceeded.", maxChangesPerBatch)
+	}
+	// the batch is checked against a copy of the record sets, so that it's applied entirely or not at all
+	recordSets := make(map[fakeRecordKey]fakeRecordSet, len(zone.recordSets))
+	for key, rr := range zone.recordSets {
+		recordSets[key] = rr
+	}
+	var problems []string
+	for _, change := range req.Changes {
+		rr := change.ResourceRecordSet
+		rr.Name = fakeNormalizeName(rr.Name)
+		key := rr.key()
+		if rr.Name != zone.name && !strings.HasSuffix(rr.Name, "."+zone.name) {
+			problems = append(problems, fmt.Sprintf("RRSet with DNS name %s is not permitted in zone %s", rr.Name, zone.name))
+			continue
+		}
+		existing, exists := recordSets[key]
+		if exists && existing.TrafficPolicyInstanceID != "" {
+			problems = append(problems, fmt.Sprintf("Tried to change resource record set [name='%s', type='%s'] but it was created by traffic policy instance %s", rr.Name, rr.Type, existing.TrafficPolicyInstanceID))
+			continue
+		}
+		switch change.Action {
+		case "CREATE":
+			if exists {
+				problems = append(problems, fmt.Sprintf("Tried to create resource record set [name='%s', type='%s'] but it already exists", rr.Name, rr.Type))
+				continue
+			}
+			recordSets[key] = rr
+		case "UPSERT":
+			recordSets[key] = rr
+		case "DELETE":
+			if !exists || !existing.equal(rr) {
+				problems = append(problems, fmt.Sprintf("Tried to delete resource record set [name='%s', type='%s'] but it was not found", rr.Name, rr.Type))
+				continue
+			}
+			delete(recordSets, key)
+		default:
+			problems = append(problems, fmt.Sprintf("Invalid action %q", change.Action))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, invalidChangeBatch("[%s]", strings.Join(problems, ", "))
+	}
+	for key, n := range fakeSetIdentifierCounts(recordSets) {
+		if n > fakeMaxSetIdentifiers {
+			return nil, invalidChangeBatch("Tried to create resource record sets [name='%s', type='%s'] that exceed the limit of %d record sets with a routing policy for the name and type", key.name, key.rrType, fakeMaxSetIdentifiers)
+		}
+	}
+	if len(recordSets) > f.recordLimit {
+		return nil, invalidChangeBatch("Tried to create resource record sets that exceed the limit of %d record sets for hosted zone %s", f.recordLimit, zone.id)
+	}
+	zone.recordSets = recordSets
+	return fakeChangeResponse{XMLName: xml.Name{Local: "ChangeResourceRecordSetsResponse"}, XMLNS: fakeRoute53Namespace, ChangeInfo: f.newChange()}, nil
+}
+
+func (f *FakeRoute53) listResourceRecordSets(id string, r *http.Request) (any, *fakeError) {
+	query := r.URL.Query()
+	maxItems := fakeMaxListItems
+	if s := query.Get("maxitems"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return nil, invalidInput("maxitems must be a positive number, got %q", s)
+		}
+		maxItems = min(n, fakeMaxListItems)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	zone, err := f.zone(id)
+	if err != nil {
+		return nil, err
+	}
+	recordSets := zone.sorted()
+	start := 0
+	if name := query.Get("name"); name != "" {
+		startKey := fakeRecordKey{name: fakeNormalizeName(name), rrType: query.Get("type"), setIdentifier: query.Get("identifier")}
+		start = sort.Search(len(recordSets), func(i int) bool { return !fakeRecordLess(recordSets[i].key(), startKey) })
+	}
+	end := min(start+maxItems, len(recordSets))
+	resp := fakeListResourceRecordSetsResponse{XMLNS: fakeRoute53Namespace, ResourceRecordSets: recordSets[start:end], MaxItems: strconv.Itoa(maxItems)}
+	if end < len(recordSets) {
+		next := recordSets[end]
+		resp.IsTruncated = true
+		resp.NextRecordName = next.Name
+		resp.NextRecordType = next.Type
+		resp.NextRecordIdentifier = next.SetIdentifier
+	}
+	return resp, nil
+}
+
+func (f *FakeRoute53) getDNSSEC(id string) (any, *fakeError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.zone(id); err != nil {
+		return nil, err
+	}
+	resp := fakeGetDNSSECResponse{XMLNS: fakeRoute53Namespace}
+	resp.Status.ServeSignature = "NOT_SIGNING"
+	return resp, nil
+}
+
+func (f *FakeRoute53) getChange(id string) (any, *fakeError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id = strings.TrimPrefix(id, "/change/")
+	submitted, ok := f.changes[id]
+	if !ok {
+		return nil, &fakeError{http.StatusNotFound, "NoSuchChange", fmt.Sprintf("A change with the specified change ID does not exist: %s", id)}
+	}
+	return fakeChangeResponse{XMLName: xml.Name{Local: "GetChangeResponse"}, XMLNS: fakeRoute53Namespace, ChangeInfo: f.changeInfo(id, submitted)}, nil
+}
+
+func (f *FakeRoute53) listHostedZonesByVPC(r *http.Request) (any, *fakeError) {
+	vpcID, region := r.URL.Query().Get("vpcid"), r.URL.Query().Get("vpcregion")
+	if vpcID == "" || region == "" {
+		return nil, invalidInput("vpcid and vpcregion are required")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := fakeListHostedZonesByVPCResponse{XMLNS: fakeRoute53Namespace, MaxItems: "100"}
+	for _, zone := range f.zones {
+		if slices.Contains(zone.vpcs, fakeVPC{ID: vpcID, Region: region}) {
+			summary := fakeHostedZoneSummary{HostedZoneID: zone.id, Name: zone.name}
+			summary.Owner.OwningAccount = fakeAccountID
+			resp.HostedZoneSummaries = append(resp.HostedZoneSummaries, summary)
+		}
+	}
+	sort.Slice(resp.HostedZoneSummaries, func(i, j int) bool {
+		return resp.HostedZoneSummaries[i].HostedZoneID < resp.HostedZoneSummaries[j].HostedZoneID
+	})
+	return resp, nil
+}
+
+func (f *FakeRoute53) getHostedZoneLimit(id string, limitType string) (any, *fakeError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	zone, err := f.zone(id)
+	if err != nil {
+		return nil, err
+	}
+	resp := fakeGetHostedZoneLimitResponse{XMLNS: fakeRoute53Namespace}
+	resp.Limit.Type = limitType
+	switch limitType {
+	case "MAX_RRSETS_BY_ZONE":
+		resp.Limit.Value, resp.Count = int64(f.recordLimit), int64(len(zone.recordSets))
+	case "MAX_VPCS_ASSOCIATED_BY_ZONE":
+		resp.Limit.Value, resp.Count = int64(f.vpcLimit), int64(len(zone.vpcs))
+	default:
+		return nil, invalidInput("unknown limit type %q", limitType)
+	}
+	return resp, nil
+}
+
+func (f *FakeRoute53) testDNSAnswer(r *http.Request) (any, *fakeError) {
+	query := r.URL.Query()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	zone, err := f.zone(query.Get("hostedzoneid"))
+	if err != nil {
+		return nil, err
+	}
+	name, rrType := fakeNormalizeName(query.Get("recordname")), query.Get("recordtype")
+	resp := fakeTestDNSAnswerResponse{XMLNS: fakeRoute53Namespace, Nameserver: "ns-1.fakeroute53.local", RecordName: name, RecordType: rrType,
+		ResponseCode: "NXDOMAIN", Protocol: "UDP", RecordData: []string{}}
+	for _, rr := range zone.recordSets {
+		if rr.Name != name {
+			continue
+		}
+		resp.ResponseCode = "NOERROR"
+		if rr.Type == rrType {
+			for _, record := range rr.ResourceRecords {
+				resp.RecordData = append(resp.RecordData, record.Value)
+			}
+		}
+	}
+	return resp, nil
+}
+
+func (f *FakeRoute53) createHealthCheck(r *http.Request) (any, *fakeError) {
+	var req struct {
+		CallerReference   string                `xml:"CallerReference"`
+		HealthCheckConfig fakeHealthCheckConfig `xml:"HealthCheckConfig"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, invalidInput("unable to parse request: %v", err)
+	}
+	if req.CallerReference == "" || req.HealthCheckConfig.Type == "" {
+		return nil, invalidInput("CallerReference and HealthCheckConfig.Type are required")
+	}
+	config := req.HealthCheckConfig
+	switch {
+	case config.Type == "CALCULATED" && (len(config.ChildHealthChecks) == 0 || len(config.ChildHealthChecks) > fakeMaxChildHealthChecks):
+		return nil, invalidInput("a calculated health check needs 1 to %d ChildHealthChecks", fakeMaxChildHealthChecks)
+	case config.Type == "CLOUDWATCH_METRIC" && (config.AlarmIdentifier == nil || config.AlarmIdentifier.Name == "" || config.AlarmIdentifier.Region == ""):
+		return nil, invalidInput("a CLOUDWATCH_METRIC health check needs an AlarmIdentifier")
+	case config.Type != "CALCULATED" && config.Type != "CLOUDWATCH_METRIC" && config.IPAddress == "" && config.FullyQualifiedDomainName == "":
+		return nil, invalidInput("IPAddress or FullyQualifiedDomainName is required")
+	case len(config.Regions) > 0 && len(config.Regions) < fakeMinHealthCheckRegions:
+		return nil, invalidInput("at least %d Regions are required", fakeMinHealthCheckRegions)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, child := range config.ChildHealthChecks {
+		if _, ok := f.healthChecks[child]; !ok {
+			return nil, &fakeError{http.StatusNotFound, "NoSuchHealthCheck", fmt.Sprintf("No health check exists with the specified ID %s", child)}
+		}
+	}
+	// like Route 53, creating the same health check again with its caller reference returns it
+	for _, hc := range f.healthChecks {
+		if hc.CallerReference != req.CallerReference {
+			continue
+		}
+		if !hc.HealthCheckConfig.equal(req.HealthCheckConfig) {
+			return nil, &fakeError{http.StatusConflict, "HealthCheckAlreadyExists", fmt.Sprintf("A health check has already been created with the specified caller reference %s", req.CallerReference)}
+		}
+		return fakeCreateHealthCheckResponse{XMLNS: fakeRoute53Namespace, HealthCheck: hc}, nil
+	}
+	if len(f.healthChecks) >= f.healthCheckLimit {
+		return nil, &fakeError{http.StatusBadRequest, "TooManyHealthChecks", fmt.Sprintf("The maximum number of health checks, %d, has been reached", f.healthCheckLimit)}
+	}
+	hc := fakeHealthCheck{ID: uuid.NewString(), CallerReference: req.CallerReference, HealthCheckConfig: req.HealthCheckConfig, HealthCheckVersion: 1}
+	f.healthChecks[hc.ID] = hc
+	return fakeCreateHealthCheckResponse{XMLNS: fakeRoute53Namespace, HealthCheck: hc}, nil
+}
+
+func (f *FakeRoute53) listHealthChecks(r *http.Request) (any, *fakeError) {
+	query := r.URL.Query()
+	maxItems := 100
+	if s := query.Get("maxitems"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return nil, invalidInput("maxitems must be a positive number, got %q", s)
+		}
+		maxItems = min(n, fakeMaxHealthCheckItems)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	healthChecks := make([]fakeHealthCheck, 0, len(f.healthChecks))
+	for _, hc := range f.healthChecks {
+		healthChecks = append(healthChecks, hc)
+	}
+	sort.Slice(healthChecks, func(i, j int) bool { return healthChecks[i].ID < healthChecks[j].ID })
+	start := 0
+	if marker := query.Get("marker"); marker != "" {
+		start = sort.Search(len(healthChecks), func(i int) bool { return healthChecks[i].ID >= marker })
+	}
+	end := min(start+maxItems, len(healthChecks))
+	resp := fakeListHealthChecksResponse{XMLNS: fakeRoute53Namespace, HealthChecks: healthChecks[start:end], Marker: query.Get("marker"), MaxItems: strconv.Itoa(maxItems)}
+	if end < len(healthChecks) {
+		resp.IsTruncated = true
+		resp.NextMarker = healthChecks[end].ID
+	}
+	return resp, nil
+}
+
+func (f *FakeRoute53) deleteHealthCheck(id string) (any, *fakeError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.healthChecks[id]; !ok {
+		return nil, &fakeError{http.StatusNotFound, "NoSuchHealthCheck", fmt.Sprintf("No health check exists with the specified ID %s", id)}
+	}
+	for _, hc := range f.healthChecks {
+		if slices.Contains(hc.HealthCheckConfig.ChildHealthChecks, id) {
+			return nil, &fakeError{http.StatusBadRequest, "HealthCheckInUse", fmt.Sprintf("The health check %s is a child of the calculated health check %s", id, hc.ID)}
+		}
+	}
+	for _, zone := range f.zones {
+		for _, rr := range zone.recordSets {
+			if rr.HealthCheckID == id {
+				return nil, &fakeError{http.StatusBadRequest, "HealthCheckInUse", fmt.Sprintf("The health check %s is still referenced from resource record set %s", id, rr.Name)}
+			}
+		}
+	}
+	delete(f.healthChecks, id)
+	return fakeDeleteHealthCheckResponse{XMLNS: fakeRoute53Namespace}, nil
+}
+
+// zone returns the zone of an ID with or without the /hostedzone/ prefix
+func (f *FakeRoute53) zone(id string) (*fakeZone, *fakeError) {
+	zone, ok := f.zones[strings.TrimPrefix(id, "/hostedzone/")]
+	if !ok {
+		return nil, &fakeError{http.StatusNotFound, "NoSuchHostedZone", fmt.Sprintf("No hosted zone found with ID: %s", id)}
+	}
+	return zone, nil
+}
+
+// newChange records a change that's PENDING until it propagated
+func (f *FakeRoute53) newChange() fakeChangeInfo {
+	id := "C" + fakeID()
+	submitted := time.Now()
+	f.changes[id] = submitted
+	return f.changeInfo(id, submitted)
+}
+
+func (f *FakeRoute53) changeInfo(id string, submitted time.Time) fakeChangeInfo {
+	status := "PENDING"
+	if time.Since(submitted) >= f.propagation {
+		status = "INSYNC"
+	}
+	return fakeChangeInfo{ID: "/change/" + id, Status: status, SubmittedAt: submitted.UTC().Format(time.RFC3339)}
+}
+
+func (z *fakeZone) hostedZone() fakeHostedZone {
+	hz := fakeHostedZone{ID: "/hostedzone/" + z.id, Name: z.name, CallerReference: z.caller, ResourceRecordSetCount: int64(len(z.recordSets))}
+	hz.Config.Comment = z.comment
+	hz.Config.PrivateZone = z.private
+	return hz
+}
+
+// sorted returns the record sets of the zone in the order Route 53 lists them in
+func (z *fakeZone) sorted() []fakeRecordSet {
+	recordSets := make([]fakeRecordSet, 0, len(z.recordSets))
+	for _, rr := range z.recordSets {
+		recordSets = append(recordSets, rr)
+	}
+	sort.Slice(recordSets, func(i, j int) bool { return fakeRecordLess(recordSets[i].key(), recordSets[j].key()) })
+	return recordSets
+}
+
+// fakeSetIdentifierCounts returns how many record sets with a set identifier every name and type has
+func fakeSetIdentifierCounts(recordSets map[fakeRecordKey]fakeRecordSet) map[fakeRecordKey]int {
+	counts := map[fakeRecordKey]int{}
+	for key := range recordSets {
+		if key.setIdentifier != "" {
+			counts[fakeRecordKey{name: key.name, rrType: key.rrType}]++
+		}
+	}
+	return counts
+}
+
+// fakeRecordLess orders record sets like Route 53 lists them: by name with its labels reversed, then type and set
+// identifier
+func fakeRecordLess(a, b fakeRecordKey) bool {
+	if a.name != b.name {
+		return fakeReversedName(a.name) < fakeReversedName(b.name)
+	}
+	if a.rrType != b.rrType {
+		return a.rrType < b.rrType
+	}
+	return a.setIdentifier < b.setIdentifier
+}
+
+func fakeReversedName(name string) string {
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	slices.Reverse(labels)
+	return strings.Join(labels, ".")
+}
+
+// fakeNormalizeName returns a DNS name in lowercase with a trailing dot, like Route 53 stores names
+func fakeNormalizeName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, ".")) + "."
+}
+
+// fakeID returns a random ID like the ones of Route 53 hosted zones and changes
+func fakeID() string {
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	id := make([]byte, 20)
+	for i := range id {
+		id[i] = alphabet[rand.Intn(len(alphabet))]
+	}
+	return string(id)
+}
+
+// fakeRateLimiter is a token bucket that allows rate requests per second with bursts of up to a second's worth, like
+// the Route 53 limit of 5 requests per second per account
+type fakeRateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newFakeRateLimiter(rate float64) *fakeRateLimiter {
+	return &fakeRateLimiter{rate: rate, tokens: rate, last: time.Now()}
+}
+
+// allow takes a token if one is left
+func (l *fakeRateLimiter) allow() bool {
+	if l.rate == 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.tokens = min(l.rate, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// fakeError is a Route 53 error response
+type fakeError struct {
+	status  int
+	code    string
+	message string
+}
+
+func invalidInput(format string, args ...any) *fakeError {
+	return &fakeError{http.StatusBadRequest, "InvalidInput", fmt.Sprintf(format, args...)}
+}
+
+func invalidChangeBatch(format string, args ...any) *fakeError {
+	return &fakeError{http.StatusBadRequest, "InvalidChangeBatch", fmt.Sprintf(format, args...)}
+}
+
+func writeFakeError(rw http.ResponseWriter, requestID string, status int, code string, message string) {
+	resp := fakeErrorResponse{XMLNS: fakeRoute53Namespace, RequestID: requestID}
+	resp.Error.Type, resp.Error.Code, resp.Error.Message = "Sender", code, message
+	writeFakeResult(rw, status, resp)
+}
+
+func writeFakeResult(rw http.ResponseWriter, status int, result any) {
+	rw.Header().Set("Content-Type", "text/xml")
+	rw.WriteHeader(status)
+	fmt.Fprint(rw, xml.Header)
+	if err := xml.NewEncoder(rw).Encode(result); err != nil {
+		slog.Debug("unable to write fake Route 53 response", "error", err)
+	}
+}
+
+// The XML documents of the Route 53 API the fake server reads and writes
+
+type fakeVPC struct {
+	Region string `xml:"VPCRegion"`
+	ID     string `xml:"VPCId"`
+}
+
+type fakeRecord struct {
+	Value string `xml:"Value"`
+}
+
+type fakeAliasTarget struct {
+	HostedZoneID         string `xml:"HostedZoneId"`
+	DNSName              string `xml:"DNSName"`
+	EvaluateTargetHealth bool   `xml:"EvaluateTargetHealth"`
+}
+
+type fakeRecordSet struct {
+	Name             string           `xml:"Name"`
+	Type             string           `xml:"Type"`
+	SetIdentifier    string           `xml:"SetIdentifier,omitempty"`
+	Weight           *int64           `xml:"Weight,omitempty"`
+	Region           string           `xml:"Region,omitempty"`
+	MultiValueAnswer *bool            `xml:"MultiValueAnswer,omitempty"`
+	TTL              *int64           `xml:"TTL,omitempty"`
+	ResourceRecords  []fakeRecord     `xml:"ResourceRecords>ResourceRecord,omitempty"`
+	AliasTarget      *fakeAliasTarget `xml:"AliasTarget,omitempty"`
+	HealthCheckID    string           `xml:"HealthCheckId,omitempty"`
+	// TrafficPolicyInstanceID is the traffic policy instance that created the record set, the only way to change it
+	TrafficPolicyInstanceID string `xml:"TrafficPolicyInstanceId,omitempty"`
+}
+
+func (rr fakeRecordSet) key() fakeRecordKey {
+	return fakeRecordKey{name: rr.Name, rrType: rr.Type, setIdentifier: rr.SetIdentifier}
+}
+
+// equal returns whether a DELETE of other matches the record set, which Route 53 requires of every value
+func (rr fakeRecordSet) equal(other fakeRecordSet) bool {
+	ttl := func(v *int64) int64 {
+		if v == nil {
+			return 0
+		}
+		return *v
+	}
+	return ttl(rr.TTL) == ttl(other.TTL) && slices.Equal(rr.ResourceRecords, other.ResourceRecords) && rr.HealthCheckID == other.HealthCheckID &&
+		(rr.AliasTarget == nil) == (other.AliasTarget == nil) && (rr.AliasTarget == nil || *rr.AliasTarget == *other.AliasTarget)
+}
+
+type fakeHostedZone struct {
+	ID              string `xml:"Id"`
+	Name            string `xml:"Name"`
+	CallerReference string `xml:"CallerReference"`
+	Config          struct {
+		Comment     string `xml:"Comment,omitempty"`
+		PrivateZone bool   `xml:"PrivateZone"`
+	} `xml:"Config"`
+	ResourceRecordSetCount int64 `xml:"ResourceRecordSetCount"`
+}
+
+type fakeChangeInfo struct {
+	ID          string `xml:"Id"`
+	Status      string `xml:"Status"`
+	SubmittedAt string `xml:"SubmittedAt"`
+}
+
+type fakeDelegationSet struct {
+	NameServers []string `xml:"NameServers>NameServer"`
+}
+
+type fakeCreateHostedZoneResponse struct {
+	XMLName       xml.Name           `xml:"CreateHostedZoneResponse"`
+	XMLNS         string             `xml:"xmlns,attr"`
+	HostedZone    fakeHostedZone     `xml:"HostedZone"`
+	ChangeInfo    fakeChangeInfo     `xml:"ChangeInfo"`
+	DelegationSet *fakeDelegationSet `xml:"DelegationSet,omitempty"`
+	VPC           *fakeVPC           `xml:"VPC,omitempty"`
+}
+
+type fakeGetHostedZoneResponse struct {
+	XMLName    xml.Name       `xml:"GetHostedZoneResponse"`
+	XMLNS      string         `xml:"xmlns,attr"`
+	HostedZone fakeHostedZone `xml:"HostedZone"`
+	VPCs       []fakeVPC      `xml:"VPCs>VPC,omitempty"`
+}
+
+// fakeChangeResponse is the response of the operations that only return the change they made
+type fakeChangeResponse struct {
+	XMLName    xml.Name
+	XMLNS      string         `xml:"xmlns,attr"`
+	ChangeInfo fakeChangeInfo `xml:"ChangeInfo"`
+}
+
+type fakeListResourceRecordSetsResponse struct {
+	XMLName              xml.Name        `xml:"ListResourceRecordSetsResponse"`
+	XMLNS                string          `xml:"xmlns,attr"`
+	ResourceRecordSets   []fakeRecordSet `xml:"ResourceRecordSets>ResourceRecordSet"`
+	IsTruncated          bool            `xml:"IsTruncated"`
+	NextRecordName       string          `xml:"NextRecordName,omitempty"`
+	NextRecordType       string          `xml:"NextRecordType,omitempty"`
+	NextRecordIdentifier string          `xml:"NextRecordIdentifier,omitempty"`
+	MaxItems             string          `xml:"MaxItems"`
+}
+
+type fakeGetDNSSECResponse struct {
+	XMLName xml.Name `xml:"GetDNSSECResponse"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	Status  struct {
+		ServeSignature string `xml:"ServeSignature"`
+	} `xml:"Status"`
+	KeySigningKeys struct{} `xml:"KeySigningKeys"`
+}
+
+type fakeHostedZoneSummary struct {
+	HostedZoneID string `xml:"HostedZoneId"`
+	Name         string `xml:"Name"`
+	Owner        struct {
+		OwningAccount string `xml:"OwningAccount"`
+	} `xml:"Owner"`
+}
+
+type fakeListHostedZonesByVPCResponse struct {
+	XMLName             xml.Name                `xml:"ListHostedZonesByVPCResponse"`
+	XMLNS               string                  `xml:"xmlns,attr"`
+	HostedZoneSummaries []fakeHostedZoneSummary `xml:"HostedZoneSummaries>HostedZoneSummary"`
+	MaxItems            string                  `xml:"MaxItems"`
+}
+
+type fakeGetHostedZoneLimitResponse struct {
+	XMLName xml.Name `xml:"GetHostedZoneLimitResponse"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	Limit   struct {
+		Type  string `xml:"Type"`
+		Value int64  `xml:"Value"`
+	} `xml:"Limit"`
+	Count int64 `xml:"Count"`
+}
+
+type fakeListQueryLoggingConfigsResponse struct {
+	XMLName             xml.Name `xml:"ListQueryLoggingConfigsResponse"`
+	XMLNS               string   `xml:"xmlns,attr"`
+	QueryLoggingConfigs struct{} `xml:"QueryLoggingConfigs"`
+}
+
+type fakeTestDNSAnswerResponse struct {
+	XMLName      xml.Name `xml:"TestDNSAnswerResponse"`
+	XMLNS        string   `xml:"xmlns,attr"`
+	Nameserver   string   `xml:"Nameserver"`
+	RecordName   string   `xml:"RecordName"`
+	RecordType   string   `xml:"RecordType"`
+	RecordData   []string `xml:"RecordData>RecordDataEntry"`
+	ResponseCode string   `xml:"ResponseCode"`
+	Protocol     string   `xml:"Protocol"`
+}
+
+type fakeHealthCheckConfig struct {
+	IPAddress                string   `xml:"IPAddress,omitempty"`
+	Port                     int32    `xml:"Port,omitempty"`
+	Type                     string   `xml:"Type"`
+	ResourcePath             string   `xml:"ResourcePath,omitempty"`
+	FullyQualifiedDomainName string   `xml:"FullyQualifiedDomainName,omitempty"`
+	SearchString             string   `xml:"SearchString,omitempty"`
+	RequestInterval          int32    `xml:"RequestInterval,omitempty"`
+	FailureThreshold         int32    `xml:"FailureThreshold,omitempty"`
+	MeasureLatency           bool     `xml:"MeasureLatency"`
+	EnableSNI                bool     `xml:"EnableSNI"`
+	ChildHealthChecks        []string `xml:"ChildHealthChecks>ChildHealthCheck,omitempty"`
+	HealthThreshold          int32    `xml:"HealthThreshold,omitempty"`
+	Regions                  []string `xml:"Regions>Region,omitempty"`
+	AlarmIdentifier          *struct {
+		Region string `xml:"Region"`
+		Name   string `xml:"Name"`
+	} `xml:"AlarmIdentifier,omitempty"`
+	InsufficientDataHealthStatus string `xml:"InsufficientDataHealthStatus,omitempty"`
+}
+
+// equal returns whether other is the same health check, which Route 53 requires when a caller reference is reused
+func (c fakeHealthCheckConfig) equal(other fakeHealthCheckConfig) bool {
+	return c.IPAddress == other.IPAddress && c.Port == other.Port && c.Type == other.Type && c.ResourcePath == other.ResourcePath &&
+		c.FullyQualifiedDomainName == other.FullyQualifiedDomainName && c.SearchString == other.SearchString &&
+		c.RequestInterval == other.RequestInterval && c.FailureThreshold == other.FailureThreshold &&
+		c.MeasureLatency == other.MeasureLatency && c.EnableSNI == other.EnableSNI &&
+		slices.Equal(c.ChildHealthChecks, other.ChildHealthChecks) && c.HealthThreshold == other.HealthThreshold &&
+		slices.Equal(c.Regions, other.Regions) && c.InsufficientDataHealthStatus == other.InsufficientDataHealthStatus &&
+		(c.AlarmIdentifier == nil) == (other.AlarmIdentifier == nil) && (c.AlarmIdentifier == nil || *c.AlarmIdentifier == *other.AlarmIdentifier)
+}
+
+type fakeHealthCheck struct {
+	ID                 string                `xml:"Id"`
+	CallerReference    string                `xml:"CallerReference"`
+	HealthCheckConfig  fakeHealthCheckConfig `xml:"HealthCheckConfig"`
+	HealthCheckVersion int64                 `xml:"HealthCheckVersion"`
+}
+
+type fakeCreateHealthCheckResponse struct {
+	XMLName     xml.Name        `xml:"CreateHealthCheckResponse"`
+	XMLNS       string          `xml:"xmlns,attr"`
+	HealthCheck fakeHealthCheck `xml:"HealthCheck"`
+}
+
+type fakeListHealthChecksResponse struct {
+	XMLName      xml.Name          `xml:"ListHealthChecksResponse"`
+	XMLNS        string            `xml:"xmlns,attr"`
+	HealthChecks []fakeHealthCheck `xml:"HealthChecks>HealthCheck"`
+	Marker       string            `xml:"Marker"`
+	IsTruncated  bool              `xml:"IsTruncated"`
+	NextMarker   string            `xml:"NextMarker,omitempty"`
+	MaxItems     string            `xml:"MaxItems"`
+}
+
+type fakeDeleteHealthCheckResponse struct {
+	XMLName xml.Name `xml:"DeleteHealthCheckResponse"`
+	XMLNS   string   `xml:"xmlns,attr"`
+}
+
+type fakeErrorResponse struct {
+	XMLName xml.Name `xml:"ErrorResponse"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	Error   struct {
+		Type    string `xml:"Type"`
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	} `xml:"Error"`
+	RequestID string `xml:"RequestId"`
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// defaultFakeTrafficPolicyLimit is the default Route 53 quota of traffic policies per account
+	defaultFakeTrafficPolicyLimit = 50
+	// fakeTrafficPolicyVersionLimit is the Route 53 quota of versions per traffic policy
+	fakeTrafficPolicyVersionLimit = 1000
+	// fakeMaxTrafficPolicyItems is the most traffic policies or versions the fake server lists at once, like Route 53
+	fakeMaxTrafficPolicyItems = 100
+	// defaultFakeTrafficPolicyInstanceLimit is the default Route 53 quota of traffic policy instances per account
+	defaultFakeTrafficPolicyInstanceLimit = 5
+)
+
+// fakeTrafficPolicy is a traffic policy of the fake server with its versions, which count towards the traffic policy
+// quota of the account until its last version is deleted
+type fakeTrafficPolicy struct {
+	id       string
+	name     string
+	rrType   string
+	versions map[int32]fakeTrafficPolicyVersion
+	// latest is the version of the last version created, which versions keep counting from even once it's deleted
+	latest int32
+}
+
+type fakeTrafficPolicyVersion struct {
+	ID       string `xml:"Id"`
+	Version  int32  `xml:"Version"`
+	Name     string `xml:"Name"`
+	Type     string `xml:"Type"`
+	Document string `xml:"Document"`
+	Comment  string `xml:"Comment,omitempty"`
+}
+
+func (f *FakeRoute53) createTrafficPolicy(r *http.Request) (any, *fakeError) {
+	var req struct {
+		Name     string `xml:"Name"`
+		Document string `xml:"Document"`
+		Comment  string `xml:"Comment"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, invalidInput("unable to parse request: %v", err)
+	}
+	if req.Name == "" {
+		return nil, invalidInput("Name is required")
+	}
+	rrType, ferr := fakeTrafficPolicyType(req.Document)
+	if ferr != nil {
+		return nil, ferr
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, policy := range f.trafficPolicies {
+		if policy.name == req.Name {
+			return nil, &fakeError{http.StatusConflict, "TrafficPolicyAlreadyExists", fmt.Sprintf("A traffic policy with the name %s already exists", req.Name)}
+		}
+	}
+	if len(f.trafficPolicies) >= f.trafficPolicyLimit {
+		return nil, &fakeError{http.StatusBadRequest, "TooManyTrafficPolicies", fmt.Sprintf("The maximum number of traffic policies, %d, has been reached", f.trafficPolicyLimit)}
+	}
+	policy := &fakeTrafficPolicy{id: uuid.NewString(), name: req.Name, rrType: rrType, versions: map[int32]fakeTrafficPolicyVersion{}}
+	f.trafficPolicies[policy.id] = policy
+	return fakeCreateTrafficPolicyResponse{XMLNS: fakeRoute53Namespace, TrafficPolicy: policy.addVersion(req.Document, req.Comment)}, nil
+}
+
+func (f *FakeRoute53) createTrafficPolicyVersion(id string, r *http.Request) (any, *fakeError) {
+	var req struct {
+		Document string `xml:"Document"`
+		Comment  string `xml:"Comment"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, invalidInput("unable to parse request: %v", err)
+	}
+	rrType, ferr := fakeTrafficPolicyType(req.Document)
+	if ferr != nil {
+		return nil, ferr
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	policy, ferr := f.trafficPolicy(id)
+	if ferr != nil {
+		return nil, ferr
+	}
+	if rrType != policy.rrType {
+		return nil, &fakeError{http.StatusBadRequest, "InvalidTrafficPolicyDocument", fmt.Sprintf("The RecordType of a new version must be %s, like the other versions", policy.rrType)}
+	}
+	if len(policy.versions) >= fakeTrafficPolicyVersionLimit {
+		return nil, &fakeError{http.StatusBadRequest, "TooManyTrafficPolicyVersionsForCurrentPolicy", fmt.Sprintf("The maximum number of versions of a traffic policy, %d, has been reached", fakeTrafficPolicyVersionLimit)}
+	}
+	return fakeCreateTrafficPolicyVersionResponse{XMLNS: fakeRoute53Namespace, TrafficPolicy: policy.addVersion(req.Document, req.Comment)}, nil
+}
+
+func (p *fakeTrafficPolicy) addVersion(document string, comment string) fakeTrafficPolicyVersion {
+	p.latest++
+	version := fakeTrafficPolicyVersion{ID: p.id, Version: p.latest, Name: p.name, Type: p.rrType, Document: document, Comment: comment}
+	p.versions[version.Version] = version
+	return version
+}
+
+func (f *FakeRoute53) listTrafficPolicies(r *http.Request) (any, *fakeError) {
+	query := r.URL.Query()
+	maxItems, ferr := fakeTrafficPolicyMaxItems(query)
+	if ferr != nil {
+		return nil, ferr
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	summaries := make([]fakeTrafficPolicySummary, 0, len(f.trafficPolicies))
+	for _, policy := range f.trafficPolicies {
+		summaries = append(summaries, fakeTrafficPolicySummary{ID: policy.id, Name: policy.name, Type: policy.rrType, LatestVersion: slices.Max(policy.versionNumbers()), TrafficPolicyCount: len(policy.versions)})
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].ID < summaries[j].ID })
+	start := 0
+	if marker := query.Get("trafficpolicyid"); marker != "" {
+		start = sort.Search(len(summaries), func(i int) bool { return summaries[i].ID >= marker })
+	}
+	end := min(start+maxItems, len(summaries))
+	resp := fakeListTrafficPoliciesResponse{XMLNS: fakeRoute53Namespace, TrafficPolicySummaries: summaries[start:end], MaxItems: strconv.Itoa(maxItems)}
+	if end < len(summaries) {
+		resp.IsTruncated = true
+		resp.TrafficPolicyIDMarker = summaries[end].ID
+	}
+	return resp, nil
+}
+
+func (f *FakeRoute53) listTrafficPolicyVersions(id string, r *http.Request) (any, *fakeError) {
+	query := r.URL.Query()
+	maxItems, ferr := fakeTrafficPolicyMaxItems(query)
+	if ferr != nil {
+		return nil, ferr
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	policy, ferr := f.trafficPolicy(id)
+	if ferr != nil {
+		return nil, ferr
+	}
+	numbers := policy.versionNumbers()
+	slices.Sort(numbers)
+	start := 0
+	if marker := query.Get("trafficpolicyversion"); marker != "" {
+		n, err := strconv.Atoi(marker)
+		if err != nil {
+			return nil, invalidInput("trafficpolicyversion must be a version, got %q", marker)
+		}
+		start, _ = slices.BinarySearch(numbers, int32(n))
+	}
+	end := min(start+maxItems, len(numbers))
+	resp := fakeListTrafficPolicyVersionsResponse{XMLNS: fakeRoute53Namespace, MaxItems: strconv.Itoa(maxItems)}
+	for _, n := range numbers[start:end] {
+		resp.TrafficPolicies = append(resp.TrafficPolicies, policy.versions[n])
+	}
+	if end < len(numbers) {
+		resp.IsTruncated = true
+		resp.TrafficPolicyVersionMarker = strconv.Itoa(int(numbers[end]))
+	}
+	return resp, nil
+}
+
+func (f *FakeRoute53) deleteTrafficPolicy(id string, version string) (any, *fakeError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	policy, ferr := f.trafficPolicy(id)
+	if ferr != nil {
+		return nil, ferr
+	}
+	n, err := strconv.Atoi(version)
+	if _, ok := policy.versions[int32(n)]; err != nil || !ok {
+		return nil, &fakeError{http.StatusNotFound, "NoSuchTrafficPolicy", fmt.Sprintf("No version %s of traffic policy %s exists", version, id)}
+	}
+	for _, instance := range f.policyInstances {
+		if instance.TrafficPolicyID == id && instance.TrafficPolicyVersion == int32(n) {
+			return nil, &fakeError{http.StatusBadRequest, "TrafficPolicyInUse", fmt.Sprintf("Version %s of traffic policy %s is used by traffic policy instance %s", version, id, instance.ID)}
+		}
+	}
+	delete(policy.versions, int32(n))
+	if len(policy.versions) == 0 {
+		delete(f.trafficPolicies, id)
+	}
+	return fakeDeleteTrafficPolicyResponse{XMLNS: fakeRoute53Namespace}, nil
+}
+
+func (f *FakeRoute53) trafficPolicy(id string) (*fakeTrafficPolicy, *fakeError) {
+	policy, ok := f.trafficPolicies[id]
+	if !ok {
+		return nil, &fakeError{http.StatusNotFound, "NoSuchTrafficPolicy", fmt.Sprintf("No traffic policy exists with the specified ID %s", id)}
+	}
+	return policy, nil
+}
+
+// versionNumbers returns the versions of the traffic policy that weren't deleted
+func (p *fakeTrafficPolicy) versionNumbers() []int32 {
+	numbers := make([]int32, 0, len(p.versions))
+	for n := range p.versions {
+		numbers = append(numbers, n)
+	}
+	return numbers
+}
+
+// fakeTrafficPolicyType returns the record type of a traffic policy document, the only part of it the fake server checks
+func fakeTrafficPolicyType(document string) (string, *fakeError) {
+	var doc struct {
+		AWSPolicyFormatVersion string `json:"AWSPolicyFormatVersion"`
+		RecordType             string `json:"RecordType"`
+	}
+	if err := json.Unmarshal([]byte(document), &doc); err != nil || doc.AWSPolicyFormatVersion == "" || doc.RecordType == "" {
+		return "", &fakeError{http.StatusBadRequest, "InvalidTrafficPolicyDocument", "The traffic policy document must be JSON with an AWSPolicyFormatVersion and a RecordType"}
+	}
+	return doc.RecordType, nil
+}
+
+func fakeTrafficPolicyMaxItems(query url.Values) (int, *fakeError) {
+	s := query.Get("maxitems")
+	if s == "" {
+		return fakeMaxTrafficPolicyItems, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, invalidInput("maxitems must be a positive number, got %q", s)
+	}
+	return min(n, fakeMaxTrafficPolicyItems), nil
+}
+
+func (f *FakeRoute53) createTrafficPolicyInstance(r *http.Request) (any, *fakeError) {
+	var req struct {
+		HostedZoneID         string `xml:"HostedZoneId"`
+		Name                 string `xml:"Name"`
+		TTL                  int64  `xml:"TTL"`
+		TrafficPolicyID      string `xml:"TrafficPolicyId"`
+		TrafficPolicyVersion int32  `xml:"TrafficPolicyVersion"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, invalidInput("unable to parse request: %v", err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	zone, ferr := f.zone(req.HostedZoneID)
+	if ferr != nil {
+		return nil, ferr
+	}
+	policy, ferr := f.trafficPolicy(req.TrafficPolicyID)
+	if ferr != nil {
+		return nil, ferr
+	}
+	if _, ok := policy.versions[req.TrafficPolicyVersion]; !ok {
+		return nil, &fakeError{http.StatusNotFound, "NoSuchTrafficPolicy", fmt.Sprintf("No version %d of traffic policy %s exists", req.TrafficPolicyVersion, policy.id)}
+	}
+	name := fakeNormalizeName(req.Name)
+	if name != zone.name && !strings.HasSuffix(name, "."+zone.name) {
+		return nil, invalidInput("The name %s is not in zone %s", name, zone.name)
+	}
+	// the instance creates its record set right away, which then only the instance can change
+	rr := fakeRecordSet{Name: name, Type: policy.rrType}
+	if _, exists := zone.recordSets[rr.key()]; exists {
+		return nil, &fakeError{http.StatusConflict, "TrafficPolicyInstanceAlreadyExists", fmt.Sprintf("A resource record set [name='%s', type='%s'] already exists", name, policy.rrType)}
+	}
+	if len(f.policyInstances) >= f.instanceLimit {
+		return nil, &fakeError{http.StatusBadRequest, "TooManyTrafficPolicyInstances", fmt.Sprintf("The maximum number of traffic policy instances, %d, has been reached", f.instanceLimit)}
+	}
+	if len(zone.recordSets) >= f.recordLimit {
+		return nil, invalidInput("Tried to create a resource record set that exceeds the limit of %d record sets for hosted zone %s", f.recordLimit, zone.id)
+	}
+	instance := &fakeTrafficPolicyInstance{
+		ID:                   uuid.NewString(),
+		HostedZoneID:         zone.id,
+		Name:                 name,
+		TTL:                  req.TTL,
+		TrafficPolicyID:      policy.id,
+		TrafficPolicyVersion: req.TrafficPolicyVersion,
+		TrafficPolicyType:    policy.rrType,
+		created:              time.Now(),
+	}
+	rr.TrafficPolicyInstanceID = instance.ID
+	zone.recordSets[rr.key()] = rr
+	f.policyInstances[instance.ID] = instance
+	return fakeCreateTrafficPolicyInstanceResponse{XMLNS: fakeRoute53Namespace, TrafficPolicyInstance: f.trafficPolicyInstanceState(*instance)}, nil
+}
+
+func (f *FakeRoute53) deleteTrafficPolicyInstance(id string) (any, *fakeError) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	instance, ok := f.policyInstances[id]
+	if !ok {
+		return nil, &fakeError{http.StatusNotFound, "NoSuchTrafficPolicyInstance", fmt.Sprintf("No traffic policy instance exists with the specified ID %s", id)}
+	}
+	if zone, ok := f.zones[instance.HostedZoneID]; ok {
+		delete(zone.recordSets, fakeRecordKey{name: instance.Name, rrType: instance.TrafficPolicyType})
+	}
+	delete(f.policyInstances, id)
+	return fakeDeleteTrafficPolicyInstanceResponse{XMLNS: fakeRoute53Namespace}, nil
+}
+
+// listTrafficPolicyInstances lists the traffic policy instances of the account, or of the zone of hostedZoneID if it's
+// set, ordered by zone, name, and type like Route 53 pages them
+func (f *FakeRoute53) listTrafficPolicyInstances(hostedZoneID string, r *http.Request) (any, *fakeError) {
+	query := r.URL.Query()
+	maxItems, ferr := fakeTrafficPolicyMaxItems(query)
+	if ferr != nil {
+		return nil, ferr
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if hostedZoneID != "" {
+		zone, ferr := f.zone(hostedZoneID)
+		if ferr != nil {
+			return nil, ferr
+		}
+		hostedZoneID = zone.id
+	}
+	var instances []fakeTrafficPolicyInstance
+	for _, instance := range f.policyInstances {
+		if hostedZoneID == "" || instance.HostedZoneID == hostedZoneID {
+			instances = append(instances, f.trafficPolicyInstanceState(*instance))
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].less(instances[j]) })
+	start := 0
+	if name := query.Get("trafficpolicyinstancename"); name != "" {
+		marker := fakeTrafficPolicyInstance{HostedZoneID: query.Get("hostedzoneid"), Name: fakeNormalizeName(name), TrafficPolicyType: query.Get("trafficpolicyinstancetype")}
+		if hostedZoneID != "" {
+			marker.HostedZoneID = hostedZoneID
+		}
+		start = sort.Search(len(instances), func(i int) bool { return !instances[i].less(marker) })
+	}
+	end := min(start+maxItems, len(instances))
+	resp := fakeListTrafficPolicyInstancesResponse{XMLNS: fakeRoute53Namespace, TrafficPolicyInstances: instances[start:end], MaxItems: strconv.Itoa(maxItems)}
+	resp.XMLName.Local = "ListTrafficPolicyInstancesResponse"
+	if hostedZoneID != "" {
+		resp.XMLName.Local = "ListTrafficPolicyInstancesByHostedZoneResponse"
+	}
+	if end < len(instances) {
+		next := instances[end]
+		resp.IsTruncated = true
+		resp.TrafficPolicyInstanceNameMarker, resp.TrafficPolicyInstanceTypeMarker = next.Name, next.TrafficPolicyType
+		if hostedZoneID == "" {
+			resp.HostedZoneIDMarker = next.HostedZoneID
+		}
+	}
+	return resp, nil
+}
+
+// trafficPolicyInstanceState returns the instance with its state, Creating until its record set propagated
+func (f *FakeRoute53) trafficPolicyInstanceState(instance fakeTrafficPolicyInstance) fakeTrafficPolicyInstance {
+	instance.State = "Creating"
+	if time.Since(instance.created) >= f.propagation {
+		instance.State = "Applied"
+	}
+	return instance
+}
+
+type fakeTrafficPolicySummary struct {
+	ID                 string `xml:"Id"`
+	Name               string `xml:"Name"`
+	Type               string `xml:"Type"`
+	LatestVersion      int32  `xml:"LatestVersion"`
+	TrafficPolicyCount int    `xml:"TrafficPolicyCount"`
+}
+
+type fakeCreateTrafficPolicyResponse struct {
+	XMLName       xml.Name                 `xml:"CreateTrafficPolicyResponse"`
+	XMLNS         string                   `xml:"xmlns,attr"`
+	TrafficPolicy fakeTrafficPolicyVersion `xml:"TrafficPolicy"`
+}
+
+type fakeCreateTrafficPolicyVersionResponse struct {
+	XMLName       xml.Name                 `xml:"CreateTrafficPolicyVersionResponse"`
+	XMLNS         string                   `xml:"xmlns,attr"`
+	TrafficPolicy fakeTrafficPolicyVersion `xml:"TrafficPolicy"`
+}
+
+type fakeListTrafficPoliciesResponse struct {
+	XMLName                xml.Name                   `xml:"ListTrafficPoliciesResponse"`
+	XMLNS                  string                     `xml:"xmlns,attr"`
+	TrafficPolicySummaries []fakeTrafficPolicySummary `xml:"TrafficPolicySummaries>TrafficPolicySummary"`
+	IsTruncated            bool                       `xml:"IsTruncated"`
+	TrafficPolicyIDMarker  string                     `xml:"TrafficPolicyIdMarker"`
+	MaxItems               string                     `xml:"MaxItems"`
+}
+
+type fakeListTrafficPolicyVersionsResponse struct {
+	XMLName                    xml.Name                   `xml:"ListTrafficPolicyVersionsResponse"`
+	XMLNS                      string                     `xml:"xmlns,attr"`
+	TrafficPolicies            []fakeTrafficPolicyVersion `xml:"TrafficPolicies>TrafficPolicy"`
+	IsTruncated                bool                       `xml:"IsTruncated"`
+	TrafficPolicyVersionMarker string                     `xml:"TrafficPolicyVersionMarker"`
+	MaxItems                   string                     `xml:"MaxItems"`
+}
+
+// fakeTrafficPolicyInstance is a traffic policy instance of the fake server, which owns the record set of its name
+type fakeTrafficPolicyInstance struct {
+	ID                   string `xml:"Id"`
+	HostedZoneID         string `xml:"HostedZoneId"`
+	Name                 string `xml:"Name"`
+	TTL                  int64  `xml:"TTL"`
+	State                string `xml:"State"`
+	Message              string `xml:"Message"`
+	TrafficPolicyID      string `xml:"TrafficPolicyId"`
+	TrafficPolicyVersion int32  `xml:"TrafficPolicyVersion"`
+	TrafficPolicyType    string `xml:"TrafficPolicyType"`
+
+	created time.Time
+}
+
+func (i fakeTrafficPolicyInstance) less(other fakeTrafficPolicyInstance) bool {
+	if i.HostedZoneID != other.HostedZoneID {
+		return i.HostedZoneID < other.HostedZoneID
+	}
+	if i.Name != other.Name {
+		return i.Name < other.Name
+	}
+	return i.TrafficPolicyType < other.TrafficPolicyType
+}
+
+type fakeCreateTrafficPolicyInstanceResponse struct {
+	XMLName               xml.Name                  `xml:"CreateTrafficPolicyInstanceResponse"`
+	XMLNS                 string                    `xml:"xmlns,attr"`
+	TrafficPolicyInstance fakeTrafficPolicyInstance `xml:"TrafficPolicyInstance"`
+}
+
+type fakeListTrafficPolicyInstancesResponse struct {
+	XMLName                         xml.Name
+	XMLNS                           string                      `xml:"xmlns,attr"`
+	TrafficPolicyInstances          []fakeTrafficPolicyInstance `xml:"TrafficPolicyInstances>TrafficPolicyInstance"`
+	IsTruncated                     bool                        `xml:"IsTruncated"`
+	HostedZoneIDMarker              string                      `xml:"HostedZoneIdMarker,omitempty"`
+	TrafficPolicyInstanceNameMarker string                      `xml:"TrafficPolicyInstanceNameMarker,omitempty"`
+	TrafficPolicyInstanceTypeMarker string                      `xml:"TrafficPolicyInstanceTypeMarker,omitempty"`
+	MaxItems                        string                      `xml:"MaxItems"`
+}
+
+type fakeDeleteTrafficPolicyInstanceResponse struct {
+	XMLName xml.Name `xml:"DeleteTrafficPolicyInstanceResponse"`
+	XMLNS   string   `xml:"xmlns,attr"`
+}
+
+type fakeDeleteTrafficPolicyResponse struct {
+	XMLName xml.Name `xml:"DeleteTrafficPolicyResponse"`
+	XMLNS   string   `xml:"xmlns,attr"`
+}
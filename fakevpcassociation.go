@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// defaultFakeVPCAssociationLimit is the default Route 53 quota of VPCs associated with a private hosted zone
+const defaultFakeVPCAssociationLimit = 300
+
+// changeVPCAssociation associates the VPC of the request with the private zone, or disassociates it from the zone.
+// Like Route 53, a zone changes one association at a time: the change takes --latency, and the zone rejects other
+// association changes with PriorRequestNotComplete until it's done.
+func (f *FakeRoute53) changeVPCAssociation(id string, associate bool, r *http.Request) (any, *fakeError) {
+	var req struct {
+		VPC *fakeVPC `xml:"VPC"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, invalidInput("unable to parse request: %v", err)
+	}
+	if req.VPC == nil || req.VPC.ID == "" || req.VPC.Region == "" {
+		return nil, invalidInput("VPC with VPCId and VPCRegion is required")
+	}
+	f.mu.Lock()
+	zone, err := f.zone(id)
+	if err == nil {
+		err = f.checkVPCAssociation(zone, *req.VPC, associate)
+	}
+	if err != nil {
+		f.mu.Unlock()
+		return nil, err
+	}
+	zone.vpcChanging = true
+	f.mu.Unlock()
+	time.Sleep(f.latency)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	zone.vpcChanging = false
+	if associate {
+		zone.vpcs = append(zone.vpcs, *req.VPC)
+		return fakeChangeResponse{XMLName: xml.Name{Local: "AssociateVPCWithHostedZoneResponse"}, XMLNS: fakeRoute53Namespace, ChangeInfo: f.newChange()}, nil
+	}
+	zone.vpcs = slices.DeleteFunc(zone.vpcs, func(vpc fakeVPC) bool { return vpc == *req.VPC })
+	return fakeChangeResponse{XMLName: xml.Name{Local: "DisassociateVPCFromHostedZoneResponse"}, XMLNS: fakeRoute53Namespace, ChangeInfo: f.newChange()}, nil
+}
+
+// checkVPCAssociation returns the error Route 53 rejects associating the VPC with the zone, or disassociating it, with
+func (f *FakeRoute53) checkVPCAssociation(zone *fakeZone, vpc fakeVPC, associate bool) *fakeError {
+	associated := slices.Contains(zone.vpcs, vpc)
+	switch {
+	case !zone.private:
+		return &fakeError{http.StatusBadRequest, "PublicZoneVPCAssociation", fmt.Sprintf("Hosted zone %s is a public hosted zone, it can't be associated with VPCs", zone.id)}
+	case zone.vpcChanging:
+		return &fakeError{http.StatusBadRequest, "PriorRequestNotComplete", fmt.Sprintf("Another VPC association of hosted zone %s is still in progress", zone.id)}
+	case associate && associated:
+		return invalidInput("VPC %s in %s is already associated with hosted zone %s", vpc.ID, vpc.Region, zone.id)
+	case associate && len(zone.vpcs) >= f.vpcLimit:
+		return &fakeError{http.StatusBadRequest, "LimitsExceeded", fmt.Sprintf("The maximum number of VPCs associated with hosted zone %s, %d, has been reached", zone.id, f.vpcLimit)}
+	case !associate && !associated:
+		return &fakeError{http.StatusNotFound, "VPCAssociationNotFound", fmt.Sprintf("VPC %s in %s is not associated with hosted zone %s", vpc.ID, vpc.Region, zone.id)}
+	case !associate && len(zone.vpcs) == 1:
+		return &fakeError{http.StatusBadRequest, "LastVPCAssociation", fmt.Sprintf("VPC %s is the last VPC associated with hosted zone %s, delete the zone instead", vpc.ID, zone.id)}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// minHealthCheckRegions is the fewest regions Route 53 accepts to check a health check from
+const minHealthCheckRegions = 3
+
+// healthCheckMatrix is every configuration the health-checks command creates health checks with. Health check i
+// takes its type and every parameter from i in mixed radix, so that every combination is created once there are as
+// many health checks as combinations.
+type healthCheckMatrix struct {
+	// types has every type of --health-check-types as many times as its weight
+	types             []types.HealthCheckType
+	intervals         []int32
+	failureThresholds []int32
+	// regions are the sets of regions of --health-check-regions, none to check from the Route 53 default regions
+	regions          [][]types.HealthCheckRegion
+	insufficientData []types.InsufficientDataHealthStatus
+	// alarmRegion is the region of the alarm of --alarm-name that CLOUDWATCH_METRIC health checks follow
+	alarmRegion string
+}
+
+// parseHealthCheckMatrix parses the configurations of the health checks from the flags of the health-checks command
+func parseHealthCheckMatrix(opts Options) (healthCheckMatrix, error) {
+	var errs []error
+	m := healthCheckMatrix{alarmRegion: opts.HealthCheckAlarmRegion}
+	checkTypes, err := parseHealthCheckTypes(opts.HealthCheckTypes)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	m.types = checkTypes
+	for _, s := range splitList(opts.HealthCheckIntervals) {
+		interval, err := strconv.Atoi(s)
+		if err != nil || (interval != 10 && interval != 30) {
+			errs = append(errs, fmt.Errorf("--request-intervals must be 10 or 30 seconds, got %q", s))
+			continue
+		}
+		m.intervals = append(m.intervals, int32(interval))
+	}
+	for _, s := range splitList(opts.HealthCheckThresholds) {
+		threshold, err := strconv.Atoi(s)
+		if err != nil || threshold < 1 || threshold > 10 {
+			errs = append(errs, fmt.Errorf("--failure-thresholds must be between 1 and 10, got %q", s))
+			continue
+		}
+		m.failureThresholds = append(m.failureThresholds, int32(threshold))
+	}
+	for _, set := range strings.Split(opts.HealthCheckRegions, ";") {
+		regions := splitList(set)
+		if len(regions) == 0 {
+			continue
+		}
+		if len(regions) < minHealthCheckRegions {
+			errs = append(errs, fmt.Errorf("every set of --health-check-regions must have at least %d regions, got %q", minHealthCheckRegions, set))
+		}
+		var regionSet []types.HealthCheckRegion
+		for _, region := range regions {
+			if !slices.Contains(types.HealthCheckRegion("").Values(), types.HealthCheckRegion(region)) {
+				errs = append(errs, fmt.Errorf("--health-check-regions has %q, which Route 53 doesn't check from", region))
+			}
+			regionSet = append(regionSet, types.HealthCheckRegion(region))
+		}
+		m.regions = append(m.regions, regionSet)
+	}
+	for _, s := range splitList(opts.HealthCheckInsufficientData) {
+		i := slices.IndexFunc(types.InsufficientDataHealthStatus("").Values(), func(status types.InsufficientDataHealthStatus) bool {
+			return strings.EqualFold(string(status), s)
+		})
+		if i < 0 {
+			errs = append(errs, fmt.Errorf("--insufficient-data-statuses must be some of Healthy, Unhealthy, LastKnownStatus, got %q", s))
+			continue
+		}
+		m.insufficientData = append(m.insufficientData, types.InsufficientDataHealthStatus("").Values()[i])
+	}
+	if len(splitList(opts.HealthCheckIntervals)) == 0 {
+		errs = append(errs, errors.New("--request-intervals is required"))
+	}
+	if len(splitList(opts.HealthCheckThresholds)) == 0 {
+		errs = append(errs, errors.New("--failure-thresholds is required"))
+	}
+	if slices.Contains(m.types, types.HealthCheckTypeCloudwatchMetric) {
+		if opts.HealthCheckAlarmName == "" {
+			errs = append(errs, errors.New("--alarm-name is required to create CLOUDWATCH_METRIC health checks"))
+		}
+		if len(splitList(opts.HealthCheckInsufficientData)) == 0 {
+			errs = append(errs, errors.New("--insufficient-data-statuses is required to create CLOUDWATCH_METRIC health checks"))
+		}
+	}
+	if slices.ContainsFunc(m.types, func(t types.HealthCheckType) bool { return t != types.HealthCheckTypeCloudwatchMetric }) && opts.HealthCheckTarget == "" {
+		errs = append(errs, errors.New("--health-check-target is required"))
+	}
+	return m, errors.Join(errs...)
+}
+
+// parseHealthCheckTypes parses --health-check-types, either types to create round robin or TYPE=WEIGHT pairs to create
+// them in proportion, and returns every type as many times as its weight
+func parseHealthCheckTypes(s string) ([]types.HealthCheckType, error) {
+	var checkTypes []types.HealthCheckType
+	for _, pair := range splitList(s) {
+		checkType, weight, weighted := strings.Cut(pair, "=")
+		checkType = strings.ToUpper(strings.TrimSpace(checkType))
+		if !slices.Contains(healthCheckTypes, checkType) {
+			return nil, fmt.Errorf("--health-check-types must be some of %s, got %q", strings.Join(healthCheckTypes, ", "), checkType)
+		}
+		n := 1
+		if weighted {
+			var err error
+			if n, err = strconv.Atoi(strings.TrimSpace(weight)); err != nil || n < 1 {
+				return nil, fmt.Errorf("weight of %s must be a positive number", checkType)
+			}
+		}
+		for range n {
+			checkTypes = append(checkTypes, types.HealthCheckType(checkType))
+		}
+	}
+	if len(checkTypes) == 0 {
+		return nil, errors.New("--health-check-types is required")
+	}
+	return checkTypes, nil
+}
+
+// config returns the config of health check i, measuring the latency of --measure-latency-percent of them
+func (m healthCheckMatrix) config(opts Options, i int) *types.HealthCheckConfig {
+	// every dimension takes the next digit of i, so consecutive health checks differ by type first
+	digits := i
+	next := func(n int) int {
+		digit := digits % n
+		digits /= n
+		return digit
+	}
+	checkType := m.types[next(len(m.types))]
+	if checkType == types.HealthCheckTypeCloudwatchMetric {
+		return &types.HealthCheckConfig{
+			Type:                         checkType,
+			AlarmIdentifier:              &types.AlarmIdentifier{Name: aws.String(opts.HealthCheckAlarmName), Region: types.CloudWatchRegion(m.alarmRegion)},
+			InsufficientDataHealthStatus: m.insufficientData[next(len(m.insufficientData))],
+		}
+	}
+	config := &types.HealthCheckConfig{
+		Type:             checkType,
+		RequestInterval:  aws.Int32(m.intervals[next(len(m.intervals))]),
+		FailureThreshold: aws.Int32(m.failureThresholds[next(len(m.failureThresholds))]),
+		MeasureLatency:   aws.Bool(float64(i%100) < opts.HealthCheckLatencyPercent),
+	}
+	if len(m.regions) > 0 {
+		config.Regions = m.regions[next(len(m.regions))]
+	}
+	if net.ParseIP(opts.HealthCheckTarget) != nil {
+		config.IPAddress = aws.String(opts.HealthCheckTarget)
+	} else {
+		config.FullyQualifiedDomainName = aws.String(opts.HealthCheckTarget)
+	}
+	port := opts.HealthCheckPort
+	if port == 0 {
+		port = 80
+		if checkType == types.HealthCheckTypeHttps || checkType == types.HealthCheckTypeHttpsStrMatch {
+			port = 443
+		}
+	}
+	config.Port = aws.Int32(int32(port))
+	switch checkType {
+	case types.HealthCheckTypeHttpStrMatch, types.HealthCheckTypeHttpsStrMatch:
+		config.SearchString = aws.String(opts.HealthCheckSearchString)
+		fallthrough
+	case types.HealthCheckTypeHttp, types.HealthCheckTypeHttps:
+		config.ResourcePath = aws.String("/")
+	}
+	if config.FullyQualifiedDomainName != nil && (checkType == types.HealthCheckTypeHttps || checkType == types.HealthCheckTypeHttpsStrMatch) {
+		config.EnableSNI = aws.Bool(true)
+	}
+	return config
+}
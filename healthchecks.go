@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/google/uuid"
+)
+
+const (
+	// healthCheckCallerPrefix prefixes the caller reference of every health check floodzone creates, which is how they're
+	// found to be deleted
+	healthCheckCallerPrefix = "floodzone-"
+	// defaultHealthCheckRate is how many health checks are created per second by default, and how many cleanup deletes per
+	// second, the Route 53 API rate limit of an account
+	defaultHealthCheckRate = 5
+	// healthCheckRecordsPerBatch is how many record sets referring to the health checks are created in one change batch
+	healthCheckRecordsPerBatch = 100
+	healthCheckTTL             = 60
+)
+
+// healthCheckTypes are the types of health checks --health-check-types can create
+var healthCheckTypes = []string{
+	string(types.HealthCheckTypeHttp), string(types.HealthCheckTypeHttps), string(types.HealthCheckTypeHttpStrMatch),
+	string(types.HealthCheckTypeHttpsStrMatch), string(types.HealthCheckTypeTcp), string(types.HealthCheckTypeCloudwatchMetric),
+}
+
+// healthChecksResult is the output of the health-checks command
+type healthChecksResult struct {
+	Action       string `json:"action" yaml:"action"`
+	HealthChecks int    `json:"healthChecks" yaml:"healthChecks"`
+	// InUse is how many health checks couldn't be deleted since record sets still refer to them
+	InUse      int `json:"inUse,omitempty" yaml:"inUse,omitempty"`
+	RecordSets int `json:"recordSets,omitempty" yaml:"recordSets,omitempty"`
+	// Throttled is how many attempts Route 53 throttled, which the SDK retried
+	Throttled int           `json:"throttled" yaml:"throttled"`
+	Duration  time.Duration `json:"duration" yaml:"duration"`
+	Rate      float64       `json:"rate" yaml:"rate"`
+	// Calculated is how many of the health checks are calculated health checks of the tree of --calculated-children
+	Calculated int `json:"calculated,omitempty" yaml:"calculated,omitempty"`
+	// Levels is how every level of the tree reported its status with --watch
+	Levels []healthCheckLevel `json:"levels,omitempty" yaml:"levels,omitempty"`
+}
+
+func (r healthChecksResult) writeTable(w io.Writer) {
+	fmt.Fprintln(w, "ACTION\tHEALTH CHECKS\tCALCULATED\tIN USE\tRECORD SETS\tTHROTTLED\tDURATION\tPER SECOND")
+	fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%s\t%.2f\n", r.Action, r.HealthChecks, r.Calculated, r.InUse, r.RecordSets, r.Throttled, r.Duration.Round(time.Millisecond), r.Rate)
+	if len(r.Levels) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "LEVEL\tHEALTH CHECKS\tREPORTING\tFIRST STATUS P50\tFIRST STATUS MAX\tFLAPS\tHEALTHY")
+	for _, l := range r.Levels {
+		fmt.Fprintf(w, "%d\t%d\t%d\t%.0fs\t%.0fs\t%d\t%d\n", l.Level, l.HealthChecks, l.Reporting, l.FirstStatusP50, l.FirstStatusMax, l.Flaps, l.Healthy)
+	}
+}
+
+// runHealthChecks creates health checks at a controlled rate to test how an account scales with them, since they have
+// their own quota and count against the Route 53 API rate limit of the account. With --hosted-zone-id, every health
+// check gets a MULTIVALUE record set in the zone, and cleanup of the zone deletes the health checks with it. With --delete,
+// it deletes the health checks floodzone created instead. With --calculated-children, it builds a tree of calculated
+// health checks over them, and --watch follows how their status propagates up the tree.
+func runHealthChecks(ctx context.Context, zone Zone, opts Options) error {
+	var throttles throttleCounter
+	throttled := func(o *route53.Options) { o.APIOptions = append(o.APIOptions, throttles.middleware) }
+	start := time.Now()
+	if opts.Delete {
+		deleted, inUse, err := zone.DeleteHealthChecks(ctx, healthCheckCallerPrefix, opts.CreateRate, throttled)
+		if err != nil {
+			return err
+		}
+		if inUse != 0 {
+			slog.Warn("some health checks are still in use by record sets, clean up their zones first", "inUse", inUse)
+		}
+		result := newHealthChecksResult("deleted", deleted, start)
+		result.InUse, result.Throttled = inUse, throttles.Count()
+		return printOutput(opts.Output, result)
+	}
+	prefix := healthCheckCallerPrefix + strings.Split(uuid.NewString(), "-")[0]
+	var hz *route53.GetHostedZoneOutput
+	if opts.HostedZoneID != "" {
+		if err := zone.Coordinator.Lock(ctx, opts.HostedZoneID); err != nil {
+			return err
+		}
+		var err error
+		if hz, err = describeZone(ctx, zone, opts); err != nil {
+			return err
+		}
+		// the health checks of a zone are found by its ID, so that cleanup deletes them with it
+		prefix = healthCheckZonePrefix(*hz.HostedZone.Id) + strings.Split(uuid.NewString(), "-")[0]
+	}
+	matrix, err := parseHealthCheckMatrix(opts)
+	if err != nil {
+		return err
+	}
+	if matrix.alarmRegion == "" {
+		matrix.alarmRegion = zone.Region
+	}
+	healthCheckIDs := make([]string, opts.HealthChecks)
+	created := make([]time.Time, opts.HealthChecks)
+	slog.Info("🩺 Creating health checks", "healthChecks", opts.HealthChecks, "types", opts.HealthCheckTypes, "rate", opts.CreateRate)
+	err = paceCalls(ctx, opts.HealthChecks, opts.CreateRate, func(ctx context.Context, i int) error {
+		out, err := zone.R53.CreateHealthCheck(ctx, &route53.CreateHealthCheckInput{
+			CallerReference:   aws.String(fmt.Sprintf("%s-%d", prefix, i)),
+			HealthCheckConfig: matrix.config(opts, i),
+		}, throttled)
+		if err != nil {
+			return fmt.Errorf("unable to create health check %d: %w", i, err)
+		}
+		healthCheckIDs[i], created[i] = *out.HealthCheck.Id, time.Now()
+		return nil
+	})
+	var nodes []healthCheckNode
+	for i, id := range healthCheckIDs {
+		if id != "" {
+			nodes = append(nodes, healthCheckNode{ID: id, Created: created[i]})
+		}
+	}
+	healthCheckIDs = slices.DeleteFunc(healthCheckIDs, func(id string) bool { return id == "" })
+	if err != nil {
+		if len(healthCheckIDs) != 0 {
+			slog.Error("some health checks were created before the run failed, delete them with health-checks --delete", "created", len(healthCheckIDs))
+		}
+		return err
+	}
+	slog.Info("✅ Successfully created health checks", "healthChecks", len(healthCheckIDs), "duration", time.Since(start))
+	result := newHealthChecksResult("created", len(healthCheckIDs), start)
+	if hz != nil {
+		if err := zone.createHealthCheckedRecordSets(ctx, hz.HostedZone, healthCheckIDs); err != nil {
+			return err
+		}
+		result.RecordSets = len(healthCheckIDs)
+	}
+	if opts.CalculatedChildren > 0 {
+		calculated, err := zone.createCalculatedHealthChecks(ctx, nodes, prefix, opts, throttled)
+		if err != nil {
+			if len(calculated) != 0 {
+				slog.Error("some calculated health checks were created before the run failed, delete them with health-checks --delete", "created", len(calculated))
+			}
+			return err
+		}
+		slog.Info("✅ Successfully created the tree of calculated health checks", "calculated", len(calculated), "levels", calculated[len(calculated)-1].Level)
+		nodes = append(nodes, calculated...)
+		recordSets := result.RecordSets
+		result = newHealthChecksResult("created", len(nodes), start)
+		result.Calculated, result.RecordSets = len(calculated), recordSets
+	}
+	result.Throttled = throttles.Count()
+	if opts.HealthCheckWatch > 0 {
+		if result.Levels, err = zone.watchHealthChecks(ctx, nodes, opts.HealthCheckWatch); err != nil {
+			return err
+		}
+	}
+	return printOutput(opts.Output, result)
+}
+
+// newHealthChecksResult returns the result of creating or deleting the health checks since start
+func newHealthChecksResult(action string, healthChecks int, start time.Time) healthChecksResult {
+	result := healthChecksResult{Action: action, HealthChecks: healthChecks, Duration: time.Since(start)}
+	if seconds := result.Duration.Seconds(); seconds > 0 {
+		result.Rate = float64(healthChecks) / seconds
+	}
+	return result
+}
+
+// createHealthCheckedRecordSets creates a MULTIVALUE A record set in the zone for every health check, which refers to it
+func (z Zone) createHealthCheckedRecordSets(ctx context.Context, hostedZone *types.HostedZone, healthCheckIDs []string) error {
+	changes := make([]types.Change, 0, len(healthCheckIDs))
+	for i, healthCheckID := range healthCheckIDs {
+		label := "hc-" + strings.Split(healthCheckID, "-")[0]
+		changes = append(changes, types.Change{
+			Action: types.ChangeActionCreate,
+			ResourceRecordSet: &types.ResourceRecordSet{
+				Name:             aws.String(fmt.Sprintf("%s.%s", label, aws.ToString(hostedZone.Name))),
+				Type:             types.RRTypeA,
+				SetIdentifier:    aws.String(healthCheckID),
+				MultiValueAnswer: aws.Bool(true),
+				TTL:              aws.Int64(healthCheckTTL),
+				ResourceRecords:  []types.ResourceRecord{{Value: aws.String(sequentialIPv4(i))}},
+				HealthCheckId:    aws.String(healthCheckID),
+			},
+		})
+	}
+	for _, batch := range chunks(changes, healthCheckRecordsPerBatch) {
+		if _, err := z.submitChangeBatch(ctx, hostedZone, batch); err != nil {
+			return fmt.Errorf("unable to create the record sets of the health checks: %w", err)
+		}
+	}
+	slog.Info("✅ Successfully created a record set for every health check", "zone", *hostedZone.Id, "recordSets", len(changes))
+	return nil
+}
+
+// DeleteHealthChecks deletes the health checks whose caller reference starts with the prefix at rate calls per second,
+// calculated health checks before their children, and returns how many it deleted and how many it couldn't since record
+// sets or calculated health checks still refer to them
+func (z Zone) DeleteHealthChecks(ctx context.Context, prefix string, rate float64, optFns ...func(*route53.Options)) (int, int, error) {
+	healthChecks, err := z.healthChecks(ctx, prefix)
+	if err != nil || len(healthChecks) == 0 {
+		return 0, 0, err
+	}
+	slog.Info("🧹 Deleting health checks", "healthChecks", len(healthChecks))
+	var deleted, inUse atomic.Int64
+	for _, healthCheckIDs := range deleteOrder(healthChecks) {
+		err = paceCalls(ctx, len(healthCheckIDs), rate, func(ctx context.Context, i int) error {
+			_, err := z.R53.DeleteHealthCheck(ctx, &route53.DeleteHealthCheckInput{HealthCheckId: &healthCheckIDs[i]}, optFns...)
+			var inUseErr *types.HealthCheckInUse
+			var notFound *types.NoSuchHealthCheck
+			switch {
+			case errors.As(err, &inUseErr):
+				inUse.Add(1)
+			case errors.As(err, &notFound):
+			case err != nil:
+				return fmt.Errorf("unable to delete health check %s: %w", healthCheckIDs[i], err)
+			default:
+				deleted.Add(1)
+			}
+			return nil
+		})
+		if err != nil {
+			return int(deleted.Load()), int(inUse.Load()), err
+		}
+	}
+	slog.Info("✅ Successfully deleted the health checks", "healthChecks", deleted.Load())
+	return int(deleted.Load()), int(inUse.Load()), nil
+}
+
+// healthChecks returns the health checks whose caller reference starts with the prefix
+func (z Zone) healthChecks(ctx context.Context, prefix string) ([]types.HealthCheck, error) {
+	var healthChecks []types.HealthCheck
+	input := &route53.ListHealthChecksInput{}
+	for {
+		out, err := z.R53.ListHealthChecks(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list health checks: %w", err)
+		}
+		for _, hc := range out.HealthChecks {
+			if strings.HasPrefix(aws.ToString(hc.CallerReference), prefix) {
+				healthChecks = append(healthChecks, hc)
+			}
+		}
+		if !out.IsTruncated {
+			return healthChecks, nil
+		}
+		input.Marker = out.NextMarker
+	}
+}
+
+// healthCheckZonePrefix returns the caller reference prefix of the health checks of a zone
+func healthCheckZonePrefix(hostedZoneID string) string {
+	return healthCheckCallerPrefix + strings.TrimPrefix(hostedZoneID, "/hostedzone/") + "-"
+}
+
+// validateHealthChecks validates the flags of the health-checks command
+func validateHealthChecks(opts Options) error {
+	var errs []error
+	if opts.CreateRate <= 0 {
+		errs = append(errs, errors.New("--create-rate must be greater than 0"))
+	}
+	if opts.Delete {
+		if opts.HostedZoneID != "" {
+			errs = append(errs, errors.New("--delete deletes the health checks of every run, clean up the zone of --hosted-zone-id to delete its health checks instead"))
+		}
+		return errors.Join(errs...)
+	}
+	if opts.HealthChecks <= 0 {
+		errs = append(errs, errors.New("--health-checks must be greater than 0"))
+	}
+	if _, err := parseHealthCheckMatrix(opts); err != nil {
+		errs = append(errs, err)
+	}
+	if opts.HealthCheckPort < 0 || opts.HealthCheckPort > 65535 {
+		errs = append(errs, fmt.Errorf("--health-check-port must be a port number, got %d", opts.HealthCheckPort))
+	}
+	if opts.HealthCheckLatencyPercent < 0 || opts.HealthCheckLatencyPercent > 100 {
+		errs = append(errs, errors.New("--measure-latency-percent must be between 0 and 100"))
+	}
+	errs = append(errs, validateCalculatedHealthChecks(opts))
+	return errors.Join(errs...)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+const (
+	// maxChildHealthChecks is the most health checks a calculated health check can aggregate
+	maxChildHealthChecks = 255
+	// healthCheckMetricsRegion is the region Route 53 publishes the metrics of every health check to
+	healthCheckMetricsRegion = "us-east-1"
+	// healthCheckWatchInterval is how often --watch gets the status of the health checks, the period of their metrics
+	healthCheckWatchInterval = time.Minute
+	// healthCheckQueriesPerRequest is the most metrics GetMetricData returns in one request
+	healthCheckQueriesPerRequest = 500
+)
+
+// healthCheckNode is a health check of the tree, level 0 being the health checks of --health-checks and every level
+// above aggregating the one below with calculated health checks
+type healthCheckNode struct {
+	ID      string
+	Level   int
+	Created time.Time
+}
+
+// healthCheckLevel is how the health checks of a level of the tree reported their status while they were watched
+type healthCheckLevel struct {
+	Level        int `json:"level" yaml:"level"`
+	HealthChecks int `json:"healthChecks" yaml:"healthChecks"`
+	// Reporting is how many health checks of the level had a status by the end of the watch
+	Reporting int `json:"reporting" yaml:"reporting"`
+	// FirstStatusP50 and FirstStatusMax are the time from creating a health check to its first status in seconds
+	FirstStatusP50 float64 `json:"firstStatusP50Seconds" yaml:"firstStatusP50Seconds"`
+	FirstStatusMax float64 `json:"firstStatusMaxSeconds" yaml:"firstStatusMaxSeconds"`
+	// Flaps is how many times the status of a health check of the level changed between healthy and unhealthy
+	Flaps int `json:"flaps" yaml:"flaps"`
+	// Healthy is how many health checks of the level were healthy at the end of the watch
+	Healthy int `json:"healthy" yaml:"healthy"`
+}
+
+// createCalculatedHealthChecks builds a tree of calculated health checks over the leaves, every one aggregating up to
+// children health checks of the level below, until a single calculated health check is the root
+func (z Zone) createCalculatedHealthChecks(ctx context.Context, leaves []healthCheckNode, prefix string, opts Options, optFns ...func(*route53.Options)) ([]healthCheckNode, error) {
+	var created []healthCheckNode
+	for level, below := 1, leaves; len(below) > 1; level++ {
+		groups := chunks(below, opts.CalculatedChildren)
+		nodes := make([]healthCheckNode, len(groups))
+		slog.Info("🌳 Creating calculated health checks", "level", level, "healthChecks", len(groups), "children", opts.CalculatedChildren)
+		err := paceCalls(ctx, len(groups), opts.CreateRate, func(ctx context.Context, i int) error {
+			children := make([]string, len(groups[i]))
+			for j, child := range groups[i] {
+				children[j] = child.ID
+			}
+			out, err := z.R53.CreateHealthCheck(ctx, &route53.CreateHealthCheckInput{
+				CallerReference: aws.String(fmt.Sprintf("%s-l%d-%d", prefix, level, i)),
+				HealthCheckConfig: &types.HealthCheckConfig{
+					Type:              types.HealthCheckTypeCalculated,
+					ChildHealthChecks: children,
+					HealthThreshold:   aws.Int32(healthThreshold(len(children), opts.HealthThresholdPercent)),
+				},
+			}, optFns...)
+			if err != nil {
+				return fmt.Errorf("unable to create calculated health check %d of level %d: %w", i, level, err)
+			}
+			nodes[i] = healthCheckNode{ID: *out.HealthCheck.Id, Level: level, Created: time.Now()}
+			return nil
+		})
+		created = append(created, slices.DeleteFunc(nodes, func(n healthCheckNode) bool { return n.ID == "" })...)
+		if err != nil {
+			return created, err
+		}
+		below = nodes
+	}
+	return created, nil
+}
+
+// healthThreshold returns how many of the children must be healthy for a calculated health check to be healthy
+func healthThreshold(children int, percent float64) int32 {
+	return int32(max(1, math.Ceil(percent*float64(children)/100)))
+}
+
+// watchHealthChecks gets the HealthCheckStatus metric of every health check of the tree every minute until the watch
+// ends, and returns how every level of the tree reported its status, to see how long statuses take to propagate up the
+// tree and how often they flap
+func (z Zone) watchHealthChecks(ctx context.Context, nodes []healthCheckNode, watch time.Duration) ([]healthCheckLevel, error) {
+	start := slices.MinFunc(nodes, func(a, b healthCheckNode) int { return a.Created.Compare(b.Created) }).Created
+	end := time.Now().Add(watch)
+	slog.Info("👀 Watching the status of the health checks", "healthChecks", len(nodes), "until", end.Format(time.TimeOnly))
+	var statuses map[string][]healthCheckStatus
+	for {
+		var err error
+		if statuses, err = z.healthCheckStatuses(ctx, nodes, start.Truncate(healthCheckWatchInterval)); err != nil {
+			return nil, err
+		}
+		slog.Info("🩺 Health check status", "reporting", len(statuses), "healthChecks", len(nodes))
+		if !time.Now().Before(end) {
+			break
+		}
+		if err := sleep(ctx, min(healthCheckWatchInterval, time.Until(end))); err != nil {
+			return nil, err
+		}
+	}
+	return healthCheckLevels(nodes, statuses), nil
+}
+
+// healthCheckStatus is the minimum HealthCheckStatus of a health check over a minute, 1 if it was healthy all along
+type healthCheckStatus struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// healthCheckStatuses returns the statuses of the health checks since start in chronological order, by ID
+func (z Zone) healthCheckStatuses(ctx context.Context, nodes []healthCheckNode, start time.Time) (map[string][]healthCheckStatus, error) {
+	statuses := map[string][]healthCheckStatus{}
+	for offset, batch := range chunks(nodes, healthCheckQueriesPerRequest) {
+		queries := make([]cwtypes.MetricDataQuery, len(batch))
+		for i, node := range batch {
+			queries[i] = cwtypes.MetricDataQuery{
+				Id: aws.String("hc" + strconv.Itoa(offset*healthCheckQueriesPerRequest+i)),
+				MetricStat: &cwtypes.MetricStat{
+					Metric: &cwtypes.Metric{
+						Namespace:  aws.String("AWS/Route53"),
+						MetricName: aws.String("HealthCheckStatus"),
+						Dimensions: []cwtypes.Dimension{{Name: aws.String("HealthCheckId"), Value: aws.String(node.ID)}},
+					},
+					Period: aws.Int32(int32(healthCheckWatchInterval.Seconds())),
+					Stat:   aws.String(string(cwtypes.StatisticMinimum)),
+				},
+			}
+		}
+		input := &cloudwatch.GetMetricDataInput{
+			MetricDataQueries: queries,
+			StartTime:         aws.Time(start),
+			EndTime:           aws.Time(time.Now()),
+			ScanBy:            cwtypes.ScanByTimestampAscending,
+		}
+		for {
+			out, err := z.HealthCheckMetrics.GetMetricData(ctx, input)
+			if err != nil {
+				return nil, fmt.Errorf("unable to get the status of the health checks: %w", err)
+			}
+			for _, result := range out.MetricDataResults {
+				i, err := strconv.Atoi(aws.ToString(result.Id)[len("hc"):])
+				if err != nil || i >= len(nodes) {
+					continue
+				}
+				for j, timestamp := range result.Timestamps {
+					statuses[nodes[i].ID] = append(statuses[nodes[i].ID], healthCheckStatus{Timestamp: timestamp, Value: result.Values[j]})
+				}
+			}
+			if out.NextToken == nil {
+				break
+			}
+			input.NextToken = out.NextToken
+		}
+	}
+	return statuses, nil
+}
+
+// healthCheckLevels summarizes the statuses of the health checks by level of the tree
+func healthCheckLevels(nodes []healthCheckNode, statuses map[string][]healthCheckStatus) []healthCheckLevel {
+	var levels []healthCheckLevel
+	firstStatus := map[int][]time.Duration{}
+	for _, node := range nodes {
+		for len(levels) <= node.Level {
+			levels = append(levels, healthCheckLevel{Level: len(levels)})
+		}
+		level := &levels[node.Level]
+		level.HealthChecks++
+		status := statuses[node.ID]
+		if len(status) == 0 {
+			continue
+		}
+		level.Reporting++
+		firstStatus[node.Level] = append(firstStatus[node.Level], max(0, status[0].Timestamp.Sub(node.Created)))
+		for i := 1; i < len(status); i++ {
+			if status[i].Value != status[i-1].Value {
+				level.Flaps++
+			}
+		}
+		if status[len(status)-1].Value == 1 {
+			level.Healthy++
+		}
+	}
+	for i := range levels {
+		if durations := firstStatus[i]; len(durations) > 0 {
+			sort.Slice(durations, func(a, b int) bool { return durations[a] < durations[b] })
+			levels[i].FirstStatusP50 = percentile(durations, 0.50) / 1000
+			levels[i].FirstStatusMax = durations[len(durations)-1].Seconds()
+		}
+	}
+	return levels
+}
+
+// deleteOrder returns the health checks in the order they can be deleted in, every round being the health checks no
+// other health check of a later round aggregates, since a calculated health check has to be deleted before its children
+func deleteOrder(healthChecks []types.HealthCheck) [][]string {
+	remaining := healthChecks
+	var rounds [][]string
+	for len(remaining) > 0 {
+		children := map[string]bool{}
+		for _, hc := range remaining {
+			if hc.HealthCheckConfig != nil {
+				for _, child := range hc.HealthCheckConfig.ChildHealthChecks {
+					children[child] = true
+				}
+			}
+		}
+		var round []string
+		var rest []types.HealthCheck
+		for _, hc := range remaining {
+			if children[*hc.Id] {
+				rest = append(rest, hc)
+			} else {
+				round = append(round, *hc.Id)
+			}
+		}
+		if len(round) == 0 {
+			// a cycle can't be created, but don't loop forever on one
+			for _, hc := range rest {
+				round = append(round, *hc.Id)
+			}
+			rest = nil
+		}
+		rounds = append(rounds, round)
+		remaining = rest
+	}
+	return rounds
+}
+
+// validateCalculatedHealthChecks validates the flags of the calculated health checks of the health-checks command
+func validateCalculatedHealthChecks(opts Options) error {
+	var errs []error
+	if opts.CalculatedChildren < 0 || opts.CalculatedChildren == 1 || opts.CalculatedChildren > maxChildHealthChecks {
+		errs = append(errs, fmt.Errorf("--calculated-children must be between 2 and %d, or 0 not to create calculated health checks", maxChildHealthChecks))
+	}
+	if opts.CalculatedChildren > 0 && opts.HealthChecks == 1 {
+		errs = append(errs, errors.New("--calculated-children needs more than one health check to aggregate"))
+	}
+	if opts.HealthThresholdPercent <= 0 || opts.HealthThresholdPercent > 100 {
+		errs = append(errs, errors.New("--health-threshold-percent must be greater than 0 and at most 100"))
+	}
+	if opts.HealthCheckWatch < 0 {
+		errs = append(errs, errors.New("--watch must not be negative"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	commands = append(commands, command{
+		name:        "history",
+		description: "List past runs, or inspect the configuration and summary of one with floodzone history <run ID>",
+		flags: func(fs *flag.FlagSet, opts *Options) {
+			historyDBFlag(fs, opts)
+			fs.IntVar(&opts.HistoryLimit, "limit", 20, "Most recent runs to list, 0 for all")
+			outputFlag(fs, opts)
+		},
+		runLocal: runHistory,
+	})
+}
+
+const historySchema = `CREATE TABLE IF NOT EXISTS runs (
+	run_id TEXT PRIMARY KEY,
+	command TEXT NOT NULL,
+	start_time TEXT NOT NULL,
+	end_time TEXT NOT NULL,
+	zones TEXT NOT NULL,
+	changes INTEGER NOT NULL,
+	batches INTEGER NOT NULL,
+	errors INTEGER NOT NULL,
+	duration_seconds REAL NOT NULL,
+	p50_ms REAL NOT NULL,
+	p99_ms REAL NOT NULL,
+	exit_code INTEGER NOT NULL,
+	error TEXT NOT NULL,
+	config TEXT NOT NULL,
+	summary TEXT NOT NULL
+)`
+
+func historyDBFlag(fs *flag.FlagSet, opts *Options) {
+	fs.StringVar(&opts.HistoryDB, "history-db", "", "Path to the SQLite database of past runs, defaults to floodzone/history.db in the user config directory, e.g. ~/.config")
+}
+
+// historyDB returns the path of the history database, defaulting to one in the user's config directory
+func historyDB(opts Options) (string, error) {
+	if opts.HistoryDB != "" {
+		return opts.HistoryDB, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find the history database, set --history-db: %w", err)
+	}
+	return filepath.Join(dir, "floodzone", "history.db"), nil
+}
+
+// History is a local SQLite database of past runs so that their numbers can be compared long after the terminal
+// scrollback is gone. Each run is a row with its configuration as YAML and its summary as JSON, along with columns of
+// the headline numbers for ad hoc queries.
+type History struct {
+	db *sql.DB
+}
+
+// OpenHistory opens the history database at path, creating it if it doesn't exist
+func OpenHistory(path string) (*History, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create history directory: %w", err)
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open history database %s: %w", path, err)
+	}
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to create history database %s: %w", path, err)
+	}
+	return &History{db: db}, nil
+}
+
+// Record stores the run, replacing an earlier run with the same run ID
+func (h *History) Record(summary runSummary, opts Options) error {
+	config, err := yaml.Marshal(opts)
+	if err != nil {
+		return fmt.Errorf("unable to marshal run configuration: %w", err)
+	}
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("unable to marshal run summary: %w", err)
+	}
+	_, err = h.db.Exec(`INSERT OR REPLACE INTO runs VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		summary.RunID, summary.Command, summary.StartTime.UTC().Format(time.RFC3339Nano), summary.EndTime.UTC().Format(time.RFC3339Nano),
+		strings.Join(summary.Zones, ","), summary.Created+summary.Deleted+summary.Upserted, summary.Batches, summary.Errors,
+		summary.DurationSeconds, summary.Latency.P50, summary.Latency.P99, summary.ExitCode, summary.Error, string(config), string(data))
+	if err != nil {
+		return fmt.Errorf("unable to record run: %w", err)
+	}
+	return nil
+}
+
+// List returns the summaries of the most recent runs, newest first. A limit of 0 returns every run.
+func (h *History) List(limit int) ([]runSummary, error) {
+	query := `SELECT summary FROM runs ORDER BY start_time DESC`
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	rows, err := h.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list runs: %w", err)
+	}
+	defer rows.Close()
+	summaries := []runSummary{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("unable to read run: %w", err)
+		}
+		var summary runSummary
+		if err := json.Unmarshal([]byte(data), &summary); err != nil {
+			return nil, fmt.Errorf("unable to parse run summary: %w", err)
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, rows.Err()
+}
+
+// Get returns the run with the run ID
+func (h *History) Get(runID string) (historyRun, error) {
+	var config, data string
+	err := h.db.QueryRow(`SELECT config, summary FROM runs WHERE run_id = ?`, runID).Scan(&config, &data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return historyRun{}, fmt.Errorf("no run with ID %q in the history", runID)
+	}
+	if err != nil {
+		return historyRun{}, fmt.Errorf("unable to read run %s: %w", runID, err)
+	}
+	run := historyRun{}
+	if err := json.Unmarshal([]byte(data), &run.Summary); err != nil {
+		return historyRun{}, fmt.Errorf("unable to parse run summary: %w", err)
+	}
+	if err := yaml.Unmarshal([]byte(config), &run.Config); err != nil {
+		return historyRun{}, fmt.Errorf("unable to parse run configuration: %w", err)
+	}
+	// options that were left empty only clutter the configuration
+	for key, value := range run.Config {
+		switch v := value.(type) {
+		case []any:
+			if len(v) == 0 {
+				delete(run.Config, key)
+			}
+		case map[string]any:
+			if len(v) == 0 {
+				delete(run.Config, key)
+			}
+		case string, bool, int, float64:
+			if v == "" || v == false || v == 0 || v == 0.0 || v == "0s" {
+				delete(run.Config, key)
+			}
+		}
+	}
+	return run, nil
+}
+
+func (h *History) Close() error {
+	return h.db.Close()
+}
+
+// recordHistory records the run in the history database if there is one. Failures are only logged since the history
+// shouldn't change the outcome of the run.
+func recordHistory(cmd command, opts Options, zone Zone, runErr error) {
+	if opts.NoHistory || !cmd.summary {
+		return
+	}
+	path, err := historyDB(opts)
+	if err != nil {
+		slog.Warn("unable to record the run in the history", "error", err)
+		return
+	}
+	history, err := OpenHistory(path)
+	if err != nil {
+		slog.Warn("unable to record the run in the history", "error", err)
+		return
+	}
+	defer history.Close()
+	if err := history.Record(runResult(cmd, zone, runErr), opts); err != nil {
+		slog.Warn("unable to record the run in the history", "error", err)
+	}
+}
+
+func runHistory(_ context.Context, opts Options, args []string) error {
+	if err := validOutputFormat(opts.Output); err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		return errors.New("at most one run ID can be inspected at a time")
+	}
+	path, err := historyDB(opts)
+	if err != nil {
+		return err
+	}
+	history, err := OpenHistory(path)
+	if err != nil {
+		return err
+	}
+	defer history.Close()
+	if len(args) == 1 {
+		run, err := history.Get(args[0])
+		if err != nil {
+			return err
+		}
+		return printOutput(opts.Output, run)
+	}
+	summaries, err := history.List(opts.HistoryLimit)
+	if err != nil {
+		return err
+	}
+	return printOutput(opts.Output, historyResult(summaries))
+}
+
+// historyResult is the output of the history command
+type historyResult []runSummary
+
+func (r historyResult) writeTable(w io.Writer) {
+	fmt.Fprintln(w, "RUN ID\tCOMMAND\tSTARTED\tDURATION\tCHANGES\tERRORS\tP50\tP99\tEXIT CODE")
+	for _, run := range r {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.1fs\t%d\t%d\t%.0fms\t%.0fms\t%d\n", run.RunID, run.Command,
+			run.StartTime.Local().Format(time.DateTime), run.DurationSeconds, run.Created+run.Deleted+run.Upserted,
+			run.Errors, run.Latency.P50, run.Latency.P99, run.ExitCode)
+	}
+}
+
+// historyRun is the output of the history command for a single run, Config is the configuration the run used in the
+// config file format
+type historyRun struct {
+	Summary runSummary     `json:"summary" yaml:"summary"`
+	Config  map[string]any `json:"config" yaml:"config"`
+}
+
+func (r historyRun) writeTable(w io.Writer) {
+	fmt.Fprintln(w, "RUN ID\tCOMMAND\tZONES\tSTARTED\tERROR")
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Summary.RunID, r.Summary.Command, strings.Join(r.Summary.Zones, ","),
+		r.Summary.StartTime.Local().Format(time.DateTime), r.Summary.Error)
+	fmt.Fprintln(w)
+	r.Summary.writeTable(w)
+	config, err := yaml.Marshal(r.Config)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "CONFIG")
+	fmt.Fprint(w, string(config))
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/bwagner5/floodzone/pkg/floodzone"
+)
+
+// Hook names, passed to the hook commands in FLOODZONE_HOOK
+const (
+	hookRunStart       = "run-start"
+	hookBatchSubmitted = "batch-submitted"
+	hookBatchComplete  = "batch-complete"
+	hookError          = "error"
+	hookRunComplete    = "run-complete"
+)
+
+// defaultHookTimeout bounds each hook command so that a stuck one can't stall the run
+const defaultHookTimeout = 30 * time.Second
+
+// ExecHooks runs a shell command at the points of the lifecycle of a run, so that external measurement tooling is in
+// sync with the flood without polling. The commands run synchronously with the JSON of the run or batch event on
+// stdin, and the run blocks until they exit. A nil ExecHooks is a no-op.
+type ExecHooks struct {
+	commands map[string]string
+	timeout  time.Duration
+	command  string
+	runID    string
+}
+
+// NewExecHooks returns the hooks of the --on-* flags, or nil if none is set
+func NewExecHooks(opts Options, command string) *ExecHooks {
+	commands := map[string]string{}
+	for hook, cmd := range map[string]string{
+		hookRunStart:       opts.OnRunStart,
+		hookBatchSubmitted: opts.OnBatchSubmitted,
+		hookBatchComplete:  opts.OnBatchComplete,
+		hookError:          opts.OnError,
+		hookRunComplete:    opts.OnRunComplete,
+	} {
+		if cmd != "" {
+			commands[hook] = cmd
+		}
+	}
+	if len(commands) == 0 {
+		return nil
+	}
+	return &ExecHooks{commands: commands, timeout: opts.HookTimeout, command: command, runID: opts.RunID}
+}
+
+// Notify runs the run start hook for a started event, and the error hook for a failed run and then the run complete
+// hook for a finished one
+func (h *ExecHooks) Notify(ctx context.Context, event runEvent) {
+	if h == nil {
+		return
+	}
+	env := []string{"FLOODZONE_EVENT=" + event.Event}
+	switch event.Event {
+	case eventStarted:
+		h.exec(ctx, hookRunStart, event, env)
+	case eventFailed:
+		h.exec(ctx, hookError, event, append(env, "FLOODZONE_ERROR="+event.Summary.Error))
+		h.exec(ctx, hookRunComplete, event, env)
+	case eventCompleted, eventAborted:
+		h.exec(ctx, hookRunComplete, event, env)
+	}
+}
+
+// library returns the batch hooks for the library Zone, the run hooks are run for the whole command by Notify instead
+// of for every operation
+func (h *ExecHooks) library() floodzone.Hooks {
+	if h == nil {
+		return floodzone.Hooks{}
+	}
+	return floodzone.Hooks{
+		OnBatchSubmitted: func(ctx context.Context, hostedZoneID string, changes []types.Change) {
+			event := newBatchEvent(h.command, h.runID, hostedZoneID, changes, 0, nil, nil)
+			event.Status = "SUBMITTED"
+			h.execBatch(ctx, hookBatchSubmitted, event)
+		},
+		OnBatchComplete: func(ctx context.Context, hostedZoneID string, changes []types.Change, out *route53.ChangeResourceRecordSetsOutput, latency time.Duration) {
+			h.execBatch(ctx, hookBatchComplete, newBatchEvent(h.command, h.runID, hostedZoneID, changes, latency, out, nil))
+		},
+		OnError: func(ctx context.Context, hostedZoneID string, changes []types.Change, err error) {
+			h.execBatch(ctx, hookError, newBatchEvent(h.command, h.runID, hostedZoneID, changes, 0, nil, err))
+		},
+	}
+}
+
+func (h *ExecHooks) execBatch(ctx context.Context, hook string, event batchEvent) {
+	env := []string{
+		"FLOODZONE_HOSTED_ZONE_ID=" + event.HostedZoneID,
+		"FLOODZONE_ACTION=" + event.Action,
+		fmt.Sprintf("FLOODZONE_CHANGES=%d", event.Changes),
+		"FLOODZONE_CHANGE_ID=" + event.ChangeID,
+	}
+	if event.Error != "" {
+		env = append(env, "FLOODZONE_ERROR="+event.Error)
+	}
+	h.exec(ctx, hook, event, env)
+}
+
+// exec runs the command of a hook with the event on stdin. Failures are only logged since a hook shouldn't change the
+// outcome of the run. The hook still runs when the run was interrupted, so that it can stop what it started.
+func (h *ExecHooks) exec(ctx context.Context, hook string, event any, env []string) {
+	command, ok := h.commands[hook]
+	if !ok {
+		return
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		slog.Warn("unable to marshal hook payload", "hook", hook, "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), h.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(), append([]string{
+		"FLOODZONE_HOOK=" + hook,
+		"FLOODZONE_COMMAND=" + h.command,
+		"FLOODZONE_RUN_ID=" + h.runID,
+	}, env...)...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	start := time.Now()
+	if err := cmd.Run(); err != nil {
+		slog.Warn("hook failed", "hook", hook, "error", err, "output", strings.TrimSpace(output.String()))
+		return
+	}
+	slog.Debug("Ran hook", "hook", hook, "duration", time.Since(start), "output", strings.TrimSpace(output.String()))
+}
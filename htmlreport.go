@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"math"
+	"net/url"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// chartBuckets is roughly how many bars the time series charts are split into
+	chartBuckets = 60
+	// latencyBuckets is how many bars the latency histogram is split into
+	latencyBuckets = 20
+	chartWidth     = 720
+	chartHeight    = 180
+)
+
+// htmlReport is what the HTML run report is rendered from
+type htmlReport struct {
+	Summary    runSummary
+	Config     string
+	Throughput svgChart
+	Latency    svgChart
+	Errors     svgChart
+}
+
+// svgChart is a bar chart with its bars already laid out in the chart's coordinates
+type svgChart struct {
+	Title  string
+	XLabel string
+	YLabel string
+	YMax   string
+	Width  int
+	Height int
+	Bars   []svgBar
+}
+
+type svgBar struct {
+	X, Y, Width, Height float64
+	// Label is shown when hovering over the bar
+	Label string
+}
+
+// writeHTMLReport writes a self-contained HTML report of the run to path with charts of the throughput, latency, and
+// errors of the change batches, so results can be shared without any other tooling
+func writeHTMLReport(path string, summary runSummary, timeline []batchOutcome, opts Options) error {
+	config, err := reportConfig(opts)
+	if err != nil {
+		return err
+	}
+	report := htmlReport{
+		Summary:    summary,
+		Config:     config,
+		Throughput: throughputChart(timeline, summary.EndTime.Sub(summary.StartTime)),
+		Latency:    latencyChart(timeline),
+		Errors:     errorsChart(timeline, summary.EndTime.Sub(summary.StartTime)),
+	}
+	var buf bytes.Buffer
+	if err := htmlReportTemplate.Execute(&buf, report); err != nil {
+		return fmt.Errorf("unable to render HTML report: %w", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("unable to write HTML report: %w", err)
+	}
+	return nil
+}
+
+// reportConfig renders the options of the run as YAML, redacting the password of the proxy URL
+func reportConfig(opts Options) (string, error) {
+	if u, err := url.Parse(opts.ProxyURL); err == nil && opts.ProxyURL != "" {
+		opts.ProxyURL = u.Redacted()
+	}
+	data, err := yaml.Marshal(opts)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal run configuration: %w", err)
+	}
+	return string(data), nil
+}
+
+// timeBucket returns the width of the buckets the run is split into for the time series charts, at least a second
+func timeBucket(duration time.Duration) time.Duration {
+	bucket := (duration / chartBuckets).Round(time.Second)
+	if bucket < time.Second {
+		return time.Second
+	}
+	return bucket
+}
+
+// bucketByTime splits the timeline into buckets by when each batch was submitted and sums value for each bucket
+func bucketByTime(timeline []batchOutcome, duration time.Duration, value func(batchOutcome) float64) ([]float64, time.Duration) {
+	bucket := timeBucket(duration)
+	values := make([]float64, int(duration/bucket)+1)
+	for _, batch := range timeline {
+		i := int(max(batch.at, 0) / bucket)
+		if i >= len(values) {
+			i = len(values) - 1
+		}
+		values[i] += value(batch)
+	}
+	return values, bucket
+}
+
+func throughputChart(timeline []batchOutcome, duration time.Duration) svgChart {
+	values, bucket := bucketByTime(timeline, duration, func(batch batchOutcome) float64 {
+		return float64(batch.changes)
+	})
+	labels := make([]string, len(values))
+	for i := range values {
+		values[i] /= bucket.Seconds()
+		labels[i] = fmt.Sprintf("%s: %.1f changes/s", time.Duration(i)*bucket, values[i])
+	}
+	return newBarChart("Throughput", "Time since the start of the run", "Changes/s", values, labels)
+}
+
+func errorsChart(timeline []batchOutcome, duration time.Duration) svgChart {
+	values, bucket := bucketByTime(timeline, duration, func(batch batchOutcome) float64 {
+		if batch.errorCode == "" {
+			return 0
+		}
+		return 1
+	})
+	labels := make([]string, len(values))
+	for i := range values {
+		labels[i] = fmt.Sprintf("%s: %.0f failed batches", time.Duration(i)*bucket, values[i])
+	}
+	return newBarChart("Errors", "Time since the start of the run", "Failed batches", values, labels)
+}
+
+func latencyChart(timeline []batchOutcome) svgChart {
+	var maxMs float64
+	for _, batch := range timeline {
+		maxMs = max(maxMs, milliseconds(batch.latency))
+	}
+	width := max(math.Ceil(maxMs/latencyBuckets), 1)
+	values := make([]float64, latencyBuckets)
+	for _, batch := range timeline {
+		i := min(int(milliseconds(batch.latency)/width), latencyBuckets-1)
+		values[i]++
+	}
+	labels := make([]string, len(values))
+	for i := range values {
+		labels[i] = fmt.Sprintf("%.0f-%.0fms: %.0f batches", float64(i)*width, float64(i+1)*width, values[i])
+	}
+	return newBarChart("ChangeResourceRecordSets Latency", fmt.Sprintf("Latency (0-%.0fms)", width*latencyBuckets), "Batches", values, labels)
+}
+
+// newBarChart lays out a bar per value, scaled so the largest value fills the height of the chart
+func newBarChart(title, xLabel, yLabel string, values []float64, labels []string) svgChart {
+	chart := svgChart{Title: title, XLabel: xLabel, YLabel: yLabel, Width: chartWidth, Height: chartHeight}
+	var yMax float64
+	for _, v := range values {
+		yMax = max(yMax, v)
+	}
+	chart.YMax = fmt.Sprintf("%.4g", yMax)
+	if len(values) == 0 || yMax == 0 {
+		return chart
+	}
+	barWidth := float64(chartWidth) / float64(len(values))
+	for i, v := range values {
+		height := v / yMax * chartHeight
+		chart.Bars = append(chart.Bars, svgBar{
+			X:      float64(i) * barWidth,
+			Y:      chartHeight - height,
+			Width:  max(barWidth-1, 1),
+			Height: height,
+			Label:  labels[i],
+		})
+	}
+	return chart
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>floodzone {{.Summary.Command}} {{.Summary.RunID}}</title>
+{{template "style"}}
+</head>
+<body>
+<h1>floodzone {{.Summary.Command}}</h1>
+<table>
+<tr><th>Run ID</th><td>{{.Summary.RunID}}</td></tr>
+<tr><th>Zones</th><td>{{range $i, $z := .Summary.Zones}}{{if $i}}, {{end}}{{$z}}{{end}}</td></tr>
+<tr><th>Start</th><td>{{.Summary.StartTime.UTC.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+<tr><th>Duration</th><td>{{printf "%.1f" .Summary.DurationSeconds}}s</td></tr>
+<tr><th>Exit Code</th><td>{{.Summary.ExitCode}}</td></tr>
+{{- if .Summary.Error}}
+<tr><th>Error</th><td class="error">{{.Summary.Error}}</td></tr>
+{{- end}}
+</table>
+<h2>Results</h2>
+<table>
+<tr><th>Created</th><th>Deleted</th><th>Upserted</th><th>Batches</th><th>Errors</th></tr>
+<tr><td>{{.Summary.Created}}</td><td>{{.Summary.Deleted}}</td><td>{{.Summary.Upserted}}</td><td>{{.Summary.Batches}}</td><td>{{.Summary.Errors}}</td></tr>
+</table>
+<table>
+<tr><th>Latency</th><th>Min</th><th>Mean</th><th>P50</th><th>P90</th><th>P99</th><th>Max</th></tr>
+<tr><td>ChangeResourceRecordSets</td>
+{{- with .Summary.Latency}}<td>{{printf "%.0f" .Min}}ms</td><td>{{printf "%.0f" .Mean}}ms</td><td>{{printf "%.0f" .P50}}ms</td><td>{{printf "%.0f" .P90}}ms</td><td>{{printf "%.0f" .P99}}ms</td><td>{{printf "%.0f" .Max}}ms</td>{{end}}</tr>
+</table>
+{{- if .Summary.ErrorsByCode}}
+<table>
+<tr><th>Error</th><th>Count</th></tr>
+{{- range $code, $count := .Summary.ErrorsByCode}}
+<tr><td>{{$code}}</td><td>{{$count}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{template "chart" .Throughput}}
+{{template "chart" .Latency}}
+{{template "chart" .Errors}}
+<h2>Configuration</h2>
+<pre>{{.Config}}</pre>
+</body>
+</html>
+{{define "style"}}<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 800px; color: #24292f; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #d0d7de; padding: 4px 10px; text-align: left; }
+th { background: #f6f8fa; }
+pre { background: #f6f8fa; padding: 1em; overflow-x: auto; }
+.error { color: #cf222e; }
+svg { overflow: visible; margin: 0 0 2.5em 4em; }
+svg rect.bar { fill: #0969da; }
+svg.errors rect.bar { fill: #cf222e; }
+svg line { stroke: #57606a; }
+svg text { font-size: 12px; fill: #57606a; }
+</style>
+{{- end}}
+{{define "chart"}}
+<h2>{{.Title}}</h2>
+<svg class="{{if eq .Title "Errors"}}errors{{end}}" width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}">
+<text x="-8" y="10" text-anchor="end">{{.YMax}}</text>
+<text x="-8" y="{{.Height}}" text-anchor="end">0</text>
+<text x="-40" y="{{.Height}}" transform="rotate(-90 -40 {{.Height}})">{{.YLabel}}</text>
+{{- range .Bars}}
+<rect class="bar" x="{{printf "%.2f" .X}}" y="{{printf "%.2f" .Y}}" width="{{printf "%.2f" .Width}}" height="{{printf "%.2f" .Height}}"><title>{{.Label}}</title></rect>
+{{- end}}
+<line x1="0" y1="{{.Height}}" x2="{{.Width}}" y2="{{.Height}}"/>
+<text x="{{.Width}}" y="{{.Height}}" dy="18" text-anchor="end">{{.XLabel}}</text>
+</svg>
+{{end}}
+`))
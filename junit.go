@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// junitTestSuites is the root of a JUnit XML report, in the format most CI test report ingestion understands
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// newJUnitReport reports the run as a test suite with a test case for the outcome of the run and one for each of its
+// assertions
+func newJUnitReport(summary runSummary) junitTestSuites {
+	className := "floodzone." + summary.Command
+	duration := fmt.Sprintf("%.3f", summary.DurationSeconds)
+	run := junitTestCase{
+		Name:      "run",
+		ClassName: className,
+		Time:      duration,
+		SystemOut: fmt.Sprintf("%d created, %d deleted, %d upserted, %d batches, %d errors, latency p50 %.0fms p99 %.0fms",
+			summary.Created, summary.Deleted, summary.Upserted, summary.Batches, summary.Errors, summary.Latency.P50, summary.Latency.P99),
+	}
+	// a run that only failed its assertions is reported by the assertion test cases
+	if summary.Error != "" && summary.ExitCode != exitAssertions {
+		run.Failure = &junitFailure{Message: summary.Error, Type: fmt.Sprintf("exit code %d", summary.ExitCode), Text: summary.Error}
+	}
+	suite := junitTestSuite{
+		Name:      fmt.Sprintf("floodzone %s %s", summary.Command, summary.RunID),
+		Time:      duration,
+		Timestamp: summary.StartTime.UTC().Format("2006-01-02T15:04:05"),
+		Properties: []junitProperty{
+			{Name: "runId", Value: summary.RunID},
+			{Name: "command", Value: summary.Command},
+			{Name: "zones", Value: strings.Join(summary.Zones, ",")},
+		},
+		Cases: []junitTestCase{run},
+	}
+	for _, a := range summary.Assertions {
+		testCase := junitTestCase{Name: "assertion " + a.Assertion, ClassName: className + ".assertions", Time: "0", SystemOut: "actual " + a.Actual}
+		if !a.Passed {
+			message := fmt.Sprintf("%s, actual %s", a.Assertion, a.Actual)
+			testCase.Failure = &junitFailure{Message: message, Type: "assertion", Text: message}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	for _, testCase := range suite.Cases {
+		suite.Tests++
+		if testCase.Failure != nil {
+			suite.Failures++
+		}
+	}
+	return junitTestSuites{Name: "floodzone", Tests: suite.Tests, Failures: suite.Failures, Time: duration, Suites: []junitTestSuite{suite}}
+}
+
+// writeJUnitReport writes the run as JUnit XML to path so CI test report ingestion picks it up alongside other tests
+func writeJUnitReport(path string, summary runSummary) error {
+	data, err := xml.MarshalIndent(newJUnitReport(summary), "", "    ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal JUnit report: %w", err)
+	}
+	if err := os.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0o644); err != nil {
+		return fmt.Errorf("unable to write JUnit report: %w", err)
+	}
+	return nil
+}
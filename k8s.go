@@ -0,0 +1,697 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// floodRunGroup and floodRunVersion are the API group and version of the FloodRun custom resource
+	floodRunGroup   = "floodzone.bwagner5.github.io"
+	floodRunVersion = "v1alpha1"
+	// k8sConfigDir is where the ConfigMap of a run's config file is mounted in its Job
+	k8sConfigDir  = "/etc/floodzone"
+	k8sConfigFile = "floodzone.yaml"
+	// serviceAccountDir holds the credentials of the pod's service account the controller calls the API server with
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// FloodRun phases, which follow the phase of the run's Job
+const (
+	floodRunPending   = "Pending"
+	floodRunRunning   = "Running"
+	floodRunSucceeded = "Succeeded"
+	floodRunFailed    = "Failed"
+)
+
+func init() {
+	commands = append(commands, command{
+		name:        "k8s",
+		description: "Run floodzone on Kubernetes: generate a Job for a config file, or install and run a controller of FloodRun resources (generate, install, controller)",
+		flags: func(fs *flag.FlagSet, opts *Options) {
+			fs.StringVar(&opts.K8sPlan, "plan", "", "Path to the config file of the run, for generate")
+			fs.StringVar(&opts.K8sCommand, "command", "flood", "floodzone command the Job runs, for generate")
+			fs.StringVar(&opts.K8sName, "name", "floodzone", "Name of the generated Job and ConfigMap, for generate")
+			fs.StringVar(&opts.K8sNamespace, "namespace", "default", "Namespace of the generated resources, or of the FloodRuns the controller reconciles")
+			fs.StringVar(&opts.K8sImage, "image", "", "Container image of floodzone to run the Jobs and the controller with")
+			fs.StringVar(&opts.K8sServiceAccount, "service-account", "floodzone", "Service account the Jobs run as, e.g. one with an IAM role for Route 53 through IRSA or EKS Pod Identity")
+			fs.StringVar(&opts.K8sAllowedImages, "allowed-images", "", "Comma-separated images a FloodRun may run with instead of --image, for install and controller")
+			fs.StringVar(&opts.K8sAllowedServiceAccounts, "allowed-service-accounts", "", "Comma-separated service accounts a FloodRun may run as instead of --service-account, for install and controller")
+			fs.DurationVar(&opts.K8sResync, "resync", 10*time.Second, "How often the controller reconciles the FloodRuns")
+		},
+		runLocal:    runK8s,
+		subcommands: []string{"generate", "install", "controller"},
+	})
+}
+
+func runK8s(ctx context.Context, opts Options, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected one of: generate, install, controller")
+	}
+	if opts.K8sImage == "" {
+		return errors.New("--image is required")
+	}
+	switch args[0] {
+	case "generate":
+		return runK8sGenerate(opts)
+	case "install":
+		return runK8sInstall(opts)
+	case "controller":
+		return runK8sController(ctx, opts)
+	default:
+		return fmt.Errorf("unknown k8s command %q, expected one of: generate, install, controller", args[0])
+	}
+}
+
+// runK8sGenerate prints a ConfigMap with the config file and a Job that runs the command with it, to kubectl apply or
+// commit to a GitOps repo
+func runK8sGenerate(opts Options) error {
+	if opts.K8sPlan == "" {
+		return errors.New("--plan is required")
+	}
+	config, err := os.ReadFile(opts.K8sPlan)
+	if err != nil {
+		return fmt.Errorf("unable to read plan: %w", err)
+	}
+	if _, err := validateRunConfig(opts.K8sCommand, config); err != nil {
+		return fmt.Errorf("invalid plan %s: %w", opts.K8sPlan, err)
+	}
+	configMap, job := k8sRunManifests(k8sMeta{Name: opts.K8sName, Namespace: opts.K8sNamespace}, opts.K8sImage, opts.K8sServiceAccount, opts.K8sCommand, config)
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	for _, manifest := range []any{configMap, job} {
+		if err := enc.Encode(manifest); err != nil {
+			return fmt.Errorf("unable to marshal manifests: %w", err)
+		}
+	}
+	return enc.Close()
+}
+
+// floodRunConfigKeys are the keys of the config file without a flag that a FloodRun may set on top of remoteRunFlags,
+// which only shape the record sets and zones of the run
+var floodRunConfigKeys = map[string]bool{
+	"type-mix":     true,
+	"load-profile": true,
+	"assertions":   true,
+	"zones":        true,
+}
+
+// validateFloodRunConfig checks that the config of a FloodRun only sets the keys of remoteRunFlags and
+// floodRunConfigKeys, since whoever can create a FloodRun could otherwise e.g. run a hook in the Job's pod with its AWS
+// credentials
+func validateFloodRunConfig(config []byte) error {
+	var keys map[string]any
+	if err := yaml.Unmarshal(config, &keys); err != nil {
+		return fmt.Errorf("unable to parse config: %w", err)
+	}
+	var rejected []string
+	for key := range keys {
+		if !remoteRunFlags[key] && !floodRunConfigKeys[key] {
+			rejected = append(rejected, key)
+		}
+	}
+	if len(rejected) > 0 {
+		slices.Sort(rejected)
+		return fmt.Errorf("a FloodRun's config can't set %s", strings.Join(rejected, ", "))
+	}
+	return nil
+}
+
+// validateRunConfig checks the config file is valid for the command, like the command would before calling AWS, so that
+// mistakes are caught before they're applied to a cluster or scheduled. It returns the options the command would run
+// with.
+func validateRunConfig(commandName string, config []byte) (Options, error) {
+	var opts Options
+	cmd, ok := lookupCommand(commandName)
+	if !ok || cmd.run == nil {
+		return opts, fmt.Errorf("command must be one of %s, got %q", strings.Join(k8sRunCommands(), ", "), commandName)
+	}
+	var global globalFlags
+	// the flag set fills in the defaults of the command that the config file overrides
+	newFlagSet(cmd, &opts, &global)
+	if err := parseConfig(config, &opts, &global); err != nil {
+		return opts, fmt.Errorf("unable to parse config: %w", err)
+	}
+	if cmd.validate != nil {
+		return opts, cmd.validate(opts)
+	}
+	return opts, nil
+}
+
+// k8sRunCommands returns the commands a Job can run, the ones that call AWS
+func k8sRunCommands() []string {
+	var names []string
+	for _, cmd := range commands {
+		if cmd.run != nil {
+			names = append(names, cmd.name)
+		}
+	}
+	return names
+}
+
+// k8sRunManifests returns the ConfigMap of the config file and the Job that runs the command with it, both named and
+// labeled after meta
+func k8sRunManifests(meta k8sMeta, image string, serviceAccount string, command string, config []byte) (k8sConfigMap, k8sJob) {
+	meta.Labels = map[string]string{"app.kubernetes.io/name": "floodzone", "app.kubernetes.io/instance": meta.Name}
+	configMap := k8sConfigMap{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Metadata:   meta,
+		Data:       map[string]string{k8sConfigFile: string(config)},
+	}
+	// a failed run isn't retried, the record sets it created are left for the next run or cleanup to deal with
+	backoffLimit := 0
+	job := k8sJob{APIVersion: "batch/v1", Kind: "Job", Metadata: meta}
+	job.Spec.BackoffLimit = &backoffLimit
+	job.Spec.Template.Metadata.Labels = meta.Labels
+	job.Spec.Template.Spec = k8sPodSpec{
+		ServiceAccountName: serviceAccount,
+		RestartPolicy:      "Never",
+		Containers: []k8sContainer{{
+			Name:         "floodzone",
+			Image:        image,
+			Args:         []string{command, "--config", filepath.Join(k8sConfigDir, k8sConfigFile)},
+			VolumeMounts: []k8sVolumeMount{{Name: "config", MountPath: k8sConfigDir, ReadOnly: true}},
+		}},
+		Volumes: []k8sVolume{{Name: "config", ConfigMap: k8sConfigMapVolume{Name: meta.Name}}},
+	}
+	return configMap, job
+}
+
+// k8sInstallManifests are the FloodRun custom resource definition and the controller that runs them in a namespace
+var k8sInstallManifests = template.Must(template.New("install").Parse(`apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: floodruns.{{ .Group }}
+spec:
+  group: {{ .Group }}
+  scope: Namespaced
+  names:
+    kind: FloodRun
+    listKind: FloodRunList
+    plural: floodruns
+    singular: floodrun
+  versions:
+    - name: {{ .Version }}
+      served: true
+      storage: true
+      subresources:
+        status: {}
+      additionalPrinterColumns:
+        - {name: Command, type: string, jsonPath: .spec.command}
+        - {name: Phase, type: string, jsonPath: .status.phase}
+        - {name: Job, type: string, jsonPath: .status.job}
+        - {name: Age, type: date, jsonPath: .metadata.creationTimestamp}
+      schema:
+        openAPIV3Schema:
+          type: object
+          properties:
+            spec:
+              type: object
+              required: [config]
+              properties:
+                command:
+                  type: string
+                  default: flood
+                  enum: [{{ .Commands }}]
+                image:
+                  description: The --image or one of the --allowed-images of the controller
+                  type: string
+                serviceAccountName:
+                  description: The --service-account or one of the --allowed-service-accounts of the controller
+                  type: string
+                config:
+                  description: The floodzone config file of the run
+                  type: object
+                  x-kubernetes-preserve-unknown-fields: true
+            status:
+              type: object
+              properties:
+                phase:
+                  type: string
+                job:
+                  type: string
+                message:
+                  type: string
+                startTime:
+                  type: string
+                  format: date-time
+                completionTime:
+                  type: string
+                  format: date-time
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: floodzone-controller
+  namespace: {{ .Namespace }}
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: floodzone-controller
+  namespace: {{ .Namespace }}
+rules:
+  - apiGroups: [{{ .Group }}]
+    resources: [floodruns]
+    verbs: [get, list, watch]
+  - apiGroups: [{{ .Group }}]
+    resources: [floodruns/status]
+    verbs: [get, patch, update]
+  - apiGroups: [batch]
+    resources: [jobs]
+    verbs: [get, list, create]
+  - apiGroups: [""]
+    resources: [configmaps]
+    verbs: [get, create]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: floodzone-controller
+  namespace: {{ .Namespace }}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: floodzone-controller
+subjects:
+  - kind: ServiceAccount
+    name: floodzone-controller
+    namespace: {{ .Namespace }}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: floodzone-controller
+  namespace: {{ .Namespace }}
+  labels:
+    app.kubernetes.io/name: floodzone-controller
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app.kubernetes.io/name: floodzone-controller
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/name: floodzone-controller
+    spec:
+      serviceAccountName: floodzone-controller
+      containers:
+        - name: controller
+          image: {{ .Image }}
+          args: [k8s, controller, --namespace, {{ .Namespace }}, --image, {{ .Image }}, --service-account, {{ .ServiceAccount }}, --resync, {{ .Resync }}
+{{- if .AllowedImages }}, --allowed-images, "{{ .AllowedImages }}"{{ end }}
+{{- if .AllowedServiceAccounts }}, --allowed-service-accounts, "{{ .AllowedServiceAccounts }}"{{ end }}]
+`))
+
+// runK8sInstall prints the FloodRun custom resource definition and the controller that runs them
+func runK8sInstall(opts Options) error {
+	return k8sInstallManifests.Execute(os.Stdout, map[string]any{
+		"Group":                  floodRunGroup,
+		"Version":                floodRunVersion,
+		"Commands":               strings.Join(k8sRunCommands(), ", "),
+		"Namespace":              opts.K8sNamespace,
+		"Image":                  opts.K8sImage,
+		"ServiceAccount":         opts.K8sServiceAccount,
+		"Resync":                 opts.K8sResync,
+		"AllowedImages":          strings.Join(splitList(opts.K8sAllowedImages), ","),
+		"AllowedServiceAccounts": strings.Join(splitList(opts.K8sAllowedServiceAccounts), ","),
+	})
+}
+
+// runK8sController reconciles the FloodRuns of the namespace until it's stopped: every FloodRun gets a Job that runs it
+// once, and its status follows the Job's. It runs in the cluster with the credentials of its service account.
+func runK8sController(ctx context.Context, opts Options) error {
+	client, err := newInClusterK8sClient()
+	if err != nil {
+		return err
+	}
+	controller := floodRunController{client: client, namespace: opts.K8sNamespace, image: opts.K8sImage, serviceAccount: opts.K8sServiceAccount,
+		allowedImages: splitList(opts.K8sAllowedImages), allowedServiceAccounts: splitList(opts.K8sAllowedServiceAccounts)}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	slog.Info("🚀 Reconciling FloodRuns", "namespace", opts.K8sNamespace, "resync", opts.K8sResync)
+	ticker := time.NewTicker(opts.K8sResync)
+	defer ticker.Stop()
+	for {
+		if err := controller.reconcileAll(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("unable to reconcile FloodRuns", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// floodRunController creates the Job of every FloodRun and copies the Job's progress to the FloodRun's status
+type floodRunController struct {
+	client         *k8sClient
+	namespace      string
+	image          string
+	serviceAccount string
+	// allowedImages and allowedServiceAccounts are what FloodRuns may run with instead of image and serviceAccount
+	allowedImages          []string
+	allowedServiceAccounts []string
+}
+
+func (c floodRunController) reconcileAll(ctx context.Context) error {
+	var runs struct {
+		Items []floodRun `json:"items"`
+	}
+	if err := c.client.do(ctx, http.MethodGet, c.floodRunsPath(""), nil, &runs); err != nil {
+		return fmt.Errorf("unable to list FloodRuns: %w", err)
+	}
+	var errs []error
+	for _, run := range runs.Items {
+		if err := c.reconcile(ctx, run); err != nil {
+			errs = append(errs, fmt.Errorf("FloodRun %s: %w", run.Metadata.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reconcile creates the Job of the FloodRun if it has none yet, and updates its status from the Job. FloodRuns that
+// finished are left alone, changing the spec of a FloodRun doesn't run it again.
+func (c floodRunController) reconcile(ctx context.Context, run floodRun) error {
+	if run.Status.Phase == floodRunSucceeded || run.Status.Phase == floodRunFailed {
+		return nil
+	}
+	var job k8sJob
+	err := c.client.do(ctx, http.MethodGet, c.jobsPath(run.Metadata.Name), nil, &job)
+	var statusErr *k8sStatusError
+	switch {
+	case errors.As(err, &statusErr) && statusErr.code == http.StatusNotFound:
+		return c.start(ctx, run)
+	case err != nil:
+		return fmt.Errorf("unable to get Job: %w", err)
+	}
+	status := floodRunStatus{Phase: floodRunPending, Job: job.Metadata.Name, StartTime: job.Status.StartTime, CompletionTime: job.Status.CompletionTime}
+	switch {
+	case job.Status.Succeeded > 0:
+		status.Phase = floodRunSucceeded
+	case job.Status.Failed > 0:
+		status.Phase = floodRunFailed
+		status.Message = "the run failed, see the logs of the Job's pod"
+		for _, condition := range job.Status.Conditions {
+			if condition.Type == "Failed" && condition.Status == "True" {
+				status.Message, status.CompletionTime = condition.Message, condition.LastTransitionTime
+			}
+		}
+	case job.Status.Active > 0:
+		status.Phase = floodRunRunning
+	}
+	return c.setStatus(ctx, run, status)
+}
+
+// start creates the ConfigMap and the Job of the FloodRun, owned by it so that they're deleted with it. A FloodRun
+// whose config is invalid, or that asks for an image or service account the controller doesn't allow, fails without a
+// Job.
+func (c floodRunController) start(ctx context.Context, run floodRun) error {
+	command := run.Spec.Command
+	if command == "" {
+		command = "flood"
+	}
+	// JSON is YAML, so the config is passed on as the API server returned it
+	config := []byte(run.Spec.Config)
+	if err := validateFloodRunConfig(config); err != nil {
+		return c.setStatus(ctx, run, floodRunStatus{Phase: floodRunFailed, Message: fmt.Sprintf("invalid config: %v", err)})
+	}
+	if _, err := validateRunConfig(command, config); err != nil {
+		return c.setStatus(ctx, run, floodRunStatus{Phase: floodRunFailed, Message: fmt.Sprintf("invalid config: %v", err)})
+	}
+	// whoever can create a FloodRun could otherwise run any image with the AWS credentials of any service account
+	image, serviceAccount := c.image, c.serviceAccount
+	if run.Spec.Image != "" && run.Spec.Image != image {
+		if !slices.Contains(c.allowedImages, run.Spec.Image) {
+			return c.setStatus(ctx, run, floodRunStatus{Phase: floodRunFailed, Message: fmt.Sprintf("the image %s isn't one of the --allowed-images of the controller", run.Spec.Image)})
+		}
+		image = run.Spec.Image
+	}
+	if run.Spec.ServiceAccountName != "" && run.Spec.ServiceAccountName != serviceAccount {
+		if !slices.Contains(c.allowedServiceAccounts, run.Spec.ServiceAccountName) {
+			return c.setStatus(ctx, run, floodRunStatus{Phase: floodRunFailed, Message: fmt.Sprintf("the service account %s isn't one of the --allowed-service-accounts of the controller", run.Spec.ServiceAccountName)})
+		}
+		serviceAccount = run.Spec.ServiceAccountName
+	}
+	meta := k8sMeta{
+		Name:      run.Metadata.Name,
+		Namespace: c.namespace,
+		OwnerReferences: []k8sOwnerReference{{
+			APIVersion: floodRunGroup + "/" + floodRunVersion,
+			Kind:       "FloodRun",
+			Name:       run.Metadata.Name,
+			UID:        run.Metadata.UID,
+			Controller: true,
+		}},
+	}
+	configMap, job := k8sRunManifests(meta, image, serviceAccount, command, config)
+	// the ConfigMap may be left over from an attempt that failed to create the Job
+	var statusErr *k8sStatusError
+	if err := c.client.do(ctx, http.MethodPost, c.configMapsPath(), configMap, nil); err != nil && !(errors.As(err, &statusErr) && statusErr.code == http.StatusConflict) {
+		return fmt.Errorf("unable to create ConfigMap: %w", err)
+	}
+	if err := c.client.do(ctx, http.MethodPost, c.jobsPath(""), job, nil); err != nil {
+		return fmt.Errorf("unable to create Job: %w", err)
+	}
+	slog.Info("✅ Successfully Created Job for FloodRun", "floodRun", run.Metadata.Name, "command", command)
+	return c.setStatus(ctx, run, floodRunStatus{Phase: floodRunPending, Job: job.Metadata.Name})
+}
+
+// setStatus updates the status of the FloodRun if it changed
+func (c floodRunController) setStatus(ctx context.Context, run floodRun, status floodRunStatus) error {
+	if status == run.Status {
+		return nil
+	}
+	patch := map[string]floodRunStatus{"status": status}
+	if err := c.client.do(ctx, http.MethodPatch, c.floodRunsPath(run.Metadata.Name)+"/status", patch, nil); err != nil {
+		return fmt.Errorf("unable to update status: %w", err)
+	}
+	if status.Phase != run.Status.Phase {
+		slog.Info("FloodRun changed phase", "floodRun", run.Metadata.Name, "phase", status.Phase, "message", status.Message)
+	}
+	return nil
+}
+
+func (c floodRunController) floodRunsPath(name string) string {
+	return strings.TrimSuffix(fmt.Sprintf("/apis/%s/%s/namespaces/%s/floodruns/%s", floodRunGroup, floodRunVersion, c.namespace, name), "/")
+}
+
+func (c floodRunController) jobsPath(name string) string {
+	return strings.TrimSuffix(fmt.Sprintf("/apis/batch/v1/namespaces/%s/jobs/%s", c.namespace, name), "/")
+}
+
+func (c floodRunController) configMapsPath() string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/configmaps", c.namespace)
+}
+
+// k8sClient calls the Kubernetes API server with the credentials of the pod's service account
+type k8sClient struct {
+	http *http.Client
+	host string
+}
+
+// k8sStatusError is an error response of the API server
+type k8sStatusError struct {
+	code    int
+	message string
+}
+
+func (e *k8sStatusError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.code, http.StatusText(e.code), e.message)
+}
+
+func newInClusterK8sClient() (*k8sClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("the controller must run in a Kubernetes pod, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT aren't set")
+	}
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the CA of the API server: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("unable to parse the CA of the API server")
+	}
+	return &k8sClient{
+		http: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}},
+		},
+		host: "https://" + net.JoinHostPort(host, port),
+	}, nil
+}
+
+// do sends body as JSON, or as a JSON merge patch for PATCH, and decodes the response into out if it's not nil
+func (c *k8sClient) do(ctx context.Context, method string, path string, body any, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.host+path, reqBody)
+	if err != nil {
+		return err
+	}
+	// the token is read for every request since the kubelet rotates it
+	token, err := os.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return fmt.Errorf("unable to read the service account token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	if method == http.MethodPatch {
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+	} else if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var status struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&status)
+		return &k8sStatusError{code: resp.StatusCode, message: status.Message}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// The Kubernetes resources floodzone reads and writes, only with the fields it uses
+
+type k8sMeta struct {
+	Name            string              `json:"name" yaml:"name"`
+	Namespace       string              `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	UID             string              `json:"uid,omitempty" yaml:"uid,omitempty"`
+	Labels          map[string]string   `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Annotations     map[string]string   `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+	OwnerReferences []k8sOwnerReference `json:"ownerReferences,omitempty" yaml:"ownerReferences,omitempty"`
+}
+
+type k8sOwnerReference struct {
+	APIVersion string `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string `json:"kind" yaml:"kind"`
+	Name       string `json:"name" yaml:"name"`
+	UID        string `json:"uid" yaml:"uid"`
+	Controller bool   `json:"controller" yaml:"controller"`
+}
+
+type k8sConfigMap struct {
+	APIVersion string            `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string            `json:"kind" yaml:"kind"`
+	Metadata   k8sMeta           `json:"metadata" yaml:"metadata"`
+	Data       map[string]string `json:"data" yaml:"data"`
+}
+
+type k8sJob struct {
+	APIVersion string  `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string  `json:"kind" yaml:"kind"`
+	Metadata   k8sMeta `json:"metadata" yaml:"metadata"`
+	Spec       struct {
+		BackoffLimit *int `json:"backoffLimit,omitempty" yaml:"backoffLimit,omitempty"`
+		Template     struct {
+			Metadata struct {
+				Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+			} `json:"metadata" yaml:"metadata"`
+			Spec k8sPodSpec `json:"spec" yaml:"spec"`
+		} `json:"template" yaml:"template"`
+	} `json:"spec" yaml:"spec"`
+	Status struct {
+		Active         int    `json:"active,omitempty"`
+		Succeeded      int    `json:"succeeded,omitempty"`
+		Failed         int    `json:"failed,omitempty"`
+		StartTime      string `json:"startTime,omitempty"`
+		CompletionTime string `json:"completionTime,omitempty"`
+		Conditions     []struct {
+			Type               string `json:"type"`
+			Status             string `json:"status"`
+			Message            string `json:"message"`
+			LastTransitionTime string `json:"lastTransitionTime"`
+		} `json:"conditions,omitempty"`
+	} `json:"status,omitempty" yaml:"-"`
+}
+
+type k8sPodSpec struct {
+	ServiceAccountName string         `json:"serviceAccountName,omitempty" yaml:"serviceAccountName,omitempty"`
+	RestartPolicy      string         `json:"restartPolicy" yaml:"restartPolicy"`
+	Containers         []k8sContainer `json:"containers" yaml:"containers"`
+	Volumes            []k8sVolume    `json:"volumes,omitempty" yaml:"volumes,omitempty"`
+}
+
+type k8sContainer struct {
+	Name         string           `json:"name" yaml:"name"`
+	Image        string           `json:"image" yaml:"image"`
+	Args         []string         `json:"args" yaml:"args"`
+	VolumeMounts []k8sVolumeMount `json:"volumeMounts,omitempty" yaml:"volumeMounts,omitempty"`
+}
+
+type k8sVolumeMount struct {
+	Name      string `json:"name" yaml:"name"`
+	MountPath string `json:"mountPath" yaml:"mountPath"`
+	ReadOnly  bool   `json:"readOnly,omitempty" yaml:"readOnly,omitempty"`
+}
+
+type k8sVolume struct {
+	Name      string             `json:"name" yaml:"name"`
+	ConfigMap k8sConfigMapVolume `json:"configMap" yaml:"configMap"`
+}
+
+type k8sConfigMapVolume struct {
+	Name string `json:"name" yaml:"name"`
+}
+
+// floodRun is a FloodRun custom resource, a run of a floodzone command declared in the cluster
+type floodRun struct {
+	Metadata k8sMeta `json:"metadata"`
+	Spec     struct {
+		// Command is the floodzone command to run, flood by default
+		Command string `json:"command"`
+		// Image and ServiceAccountName default to the controller's --image and --service-account, and can only be set
+		// to its --allowed-images and --allowed-service-accounts
+		Image              string `json:"image"`
+		ServiceAccountName string `json:"serviceAccountName"`
+		// Config is the config file of the run
+		Config json.RawMessage `json:"config"`
+	} `json:"spec"`
+	Status floodRunStatus `json:"status"`
+}
+
+type floodRunStatus struct {
+	Phase          string `json:"phase,omitempty"`
+	Job            string `json:"job,omitempty"`
+	Message        string `json:"message,omitempty"`
+	StartTime      string `json:"startTime,omitempty"`
+	CompletionTime string `json:"completionTime,omitempty"`
+}
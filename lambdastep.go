@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lambdaStepMargin is how long before the invocation times out a run step is interrupted, which leaves it the time to
+// summarize the run and flush its metrics and reports
+const lambdaStepMargin = 10 * time.Second
+
+// lambdaStepCommands are the commands a Lambda invocation can run a step of
+var lambdaStepCommands = []string{"flood", "churn", "delete", "cleanup"}
+
+// lambdaStepEvent is the part of the payload of a run step invocation that isn't in the config file. The rest of the
+// payload is the config file of the step, e.g. the constant input of an EventBridge schedule:
+//
+//	{"command": "churn", "hosted-zone-id": "Z0123456789ABCDEFGHIJ", "total-records": 500, "batch-delay-duration": "1s"}
+type lambdaStepEvent struct {
+	Command string `json:"command"`
+	RunID   string `json:"run-id"`
+	// Step is the state of the phase when the step is run by a Step Functions state machine
+	Step *stepFunctionsStep `json:"step"`
+}
+
+// isLambdaStep returns whether the payload of an invocation is a run step rather than a query worker request
+func isLambdaStep(payload []byte) bool {
+	var event lambdaStepEvent
+	return json.Unmarshal(payload, &event) == nil && event.Command != ""
+}
+
+// lambdaDeadline returns when the invocation times out, from the headers of the next invocation
+func lambdaDeadline(header http.Header) time.Time {
+	ms, err := strconv.ParseInt(header.Get("Lambda-Runtime-Deadline-Ms"), 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// handleLambdaStep runs one step of a flood, churn, delete, or cleanup and returns its run summary, so that scheduled
+// EventBridge rules can keep changes going without a long-lived host. The step runs as a child process of the same
+// binary with the payload as its config file, exactly like the command on the command line, and is interrupted before
+// the invocation times out. The run ID of the step is the invocation's request ID unless the payload sets one. A step
+// that failed is a failed invocation, which Lambda retries for asynchronous invocations unless retries are turned off.
+func handleLambdaStep(ctx context.Context, requestID string, deadline time.Time, payload []byte) ([]byte, error) {
+	var event lambdaStepEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("unable to parse run step: %w", err)
+	}
+	if event.Step != nil {
+		return handleStepFunctionsStep(ctx, requestID, deadline, event, payload)
+	}
+	if !slices.Contains(lambdaStepCommands, event.Command) {
+		return nil, fmt.Errorf("command must be one of %s, got %q", strings.Join(lambdaStepCommands, ", "), event.Command)
+	}
+	if _, err := validateRunConfig(event.Command, payload); err != nil {
+		return nil, fmt.Errorf("invalid run step: %w", err)
+	}
+	return runLambdaStep(ctx, requestID, deadline, event, payload)
+}
+
+// runLambdaStep runs the command of the step as a child process with the payload as its config file and the extra
+// flags, which override the config file, and returns its run summary. The summary is also returned with the error of
+// a step that failed, if the step got to write it.
+func runLambdaStep(ctx context.Context, requestID string, deadline time.Time, event lambdaStepEvent, payload []byte, flags ...string) ([]byte, error) {
+	binary, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("unable to find the floodzone binary: %w", err)
+	}
+	dir, err := os.MkdirTemp("", "floodzone-step-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	// JSON is YAML, so the payload is the config file as it is, the command field is ignored when it's read
+	config, summaryFile := filepath.Join(dir, "config.yaml"), filepath.Join(dir, "summary.json")
+	if err := os.WriteFile(config, payload, 0o600); err != nil {
+		return nil, fmt.Errorf("unable to write the config of the run step: %w", err)
+	}
+	// the history database wouldn't outlive the execution environment
+	args := []string{event.Command, "--config", config, "--summary-file", summaryFile, "--no-history"}
+	if event.RunID == "" {
+		args = append(args, "--run-id", requestID)
+	}
+	args = append(args, flags...)
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline.Add(-lambdaStepMargin))
+		defer cancel()
+	}
+	process := exec.CommandContext(ctx, binary, args...)
+	// an interrupt aborts the run the way it does on the command line, which still summarizes it
+	process.Cancel = func() error { return process.Process.Signal(os.Interrupt) }
+	process.WaitDelay = lambdaStepMargin / 2
+	process.Stdout, process.Stderr = os.Stdout, os.Stderr
+	// the step must run the command rather than serve invocations itself
+	process.Env = slices.DeleteFunc(os.Environ(), func(env string) bool { return strings.HasPrefix(env, lambdaRuntimeAPIEnv+"=") })
+	runErr := process.Run()
+	summary, err := os.ReadFile(summaryFile)
+	if err != nil {
+		if runErr != nil {
+			return nil, fmt.Errorf("%s step failed: %w", event.Command, runErr)
+		}
+		return nil, fmt.Errorf("unable to read the summary of the run step: %w", err)
+	}
+	if runErr != nil {
+		var result runSummary
+		if err := json.Unmarshal(summary, &result); err != nil || result.Error == "" {
+			return summary, fmt.Errorf("%s step failed: %w", event.Command, runErr)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return summary, fmt.Errorf("%s step was interrupted before the invocation timed out, give it fewer records or a longer timeout: %s", event.Command, result.Error)
+		}
+		return summary, fmt.Errorf("%s step failed with exit code %d: %s", event.Command, result.ExitCode, result.Error)
+	}
+	return summary, nil
+}
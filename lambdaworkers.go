@@ -0,0 +1,311 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+const (
+	// queryWorkerMemoryMB is the memory of a query worker, Lambda gives a function CPU in proportion to its memory
+	queryWorkerMemoryMB = 1024
+	// queryWorkerMaxTimeout is the longest a Lambda function can run for, and maxQueryWorkerDuration the longest a
+	// worker sends queries for within it
+	queryWorkerMaxTimeout  = 15 * time.Minute
+	maxQueryWorkerDuration = 13 * time.Minute
+	// queryWorkerMaxPayload is the largest payload of a synchronous Lambda invocation
+	queryWorkerMaxPayload = 6 * 1024 * 1024
+	// queryWorkerMaxCode is the largest zipped code a Lambda function can be created with directly
+	queryWorkerMaxCode = 50 * 1024 * 1024
+	// queryWorkerPollInterval and queryWorkerTimeout are how often and how long to wait for the role to be usable and
+	// the functions to become active
+	queryWorkerPollInterval = 3 * time.Second
+	queryWorkerTimeout      = 3 * time.Minute
+	// lambdaBasicExecutionPolicy lets the workers write their logs to CloudWatch Logs
+	lambdaBasicExecutionPolicy = "arn:%s:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+	lambdaAssumeRolePolicy     = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"lambda.amazonaws.com"},"Action":"sts:AssumeRole"}]}`
+)
+
+// LambdaQueryWorkers deploys the floodzone binary as query worker Lambda functions in several regions, invokes them to send
+// the queries of the query command from every region at once, and deletes them and their role when the run is done.
+// A worker serves its invocations with runLambdaWorker.
+type LambdaQueryWorkers struct {
+	cfg       aws.Config
+	iam       *iam.Client
+	regions   []string
+	perRegion int
+	binary    string
+	name      string
+	// partition is of the role, for the ARN of the policy attached to it
+	partition string
+}
+
+// NewLambdaQueryWorkers returns the query workers of the regions, perRegion in each, running the binary, which defaults to
+// the running floodzone binary. The role and functions are named after the run.
+func NewLambdaQueryWorkers(cfg aws.Config, regions []string, perRegion int, binary string, runID string) *LambdaQueryWorkers {
+	name := "floodzone-query-" + runID
+	// Lambda function and IAM role names are at most 64 characters
+	return &LambdaQueryWorkers{cfg: cfg, iam: iam.NewFromConfig(cfg), regions: regions, perRegion: perRegion, binary: binary, name: name[:min(len(name), 64)]}
+}
+
+// Run deploys the workers, has each of them send an even share of the queries of the flags to the targets, and returns
+// the results of every region
+func (w *LambdaQueryWorkers) Run(ctx context.Context, targets []queryTarget, opts Options, budget *CostBudget) (fanOutResult, error) {
+	workers := len(w.regions) * w.perRegion
+	request := newQueryWorkerRequest(targets, opts, max(1, opts.QPS/workers), max(1, (opts.Concurrency+workers-1)/workers))
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return fanOutResult{}, fmt.Errorf("unable to encode query worker request: %w", err)
+	}
+	if len(payload) > queryWorkerMaxPayload {
+		return fanOutResult{}, fmt.Errorf("the %d record sets to query are too many to send to a Lambda function, query fewer with --from-manifest", len(targets))
+	}
+	code, architecture, err := queryWorkerCode(w.binary)
+	if err != nil {
+		return fanOutResult{}, err
+	}
+	roleARN, err := w.createRole(ctx)
+	if roleARN != "" {
+		defer func() {
+			if err := w.deleteRole(context.WithoutCancel(ctx)); err != nil {
+				slog.Error("unable to clean up query worker role, it must be deleted manually", "role", w.name, "error", err)
+			}
+		}()
+	}
+	if err != nil {
+		return fanOutResult{}, err
+	}
+	// a worker answers once it's done querying, so the function times out a minute after the queries of every attempt
+	timeout := min(opts.QueryDuration+time.Duration(opts.QueryAttempts)*opts.QueryTimeout+time.Minute, queryWorkerMaxTimeout)
+	slog.Info("🚀 Deploying query workers", "regions", strings.Join(w.regions, ","), "workersPerRegion", w.perRegion, "architecture", architecture)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var errs []error
+	for _, region := range w.regions {
+		wg.Add(1)
+		go func(region string) {
+			defer wg.Done()
+			err := w.createFunction(ctx, region, roleARN, code, architecture, timeout)
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		}(region)
+	}
+	wg.Wait()
+	// the functions of every region are deleted, including those that failed to become active
+	defer func() {
+		for _, region := range w.regions {
+			if err := w.deleteFunction(context.WithoutCancel(ctx), region); err != nil {
+				slog.Error("unable to clean up query worker, it must be deleted manually", "function", w.name, "region", region, "error", err)
+			}
+		}
+	}()
+	if err := errors.Join(errs...); err != nil {
+		return fanOutResult{}, err
+	}
+
+	slog.Info("🔎 Starting distributed DNS query flood", "workers", workers, "recordSets", len(targets), "qps", opts.QPS, "duration", opts.QueryDuration)
+	responses := map[string][]queryWorkerResponse{}
+	errs = nil
+	for _, region := range w.regions {
+		for i := 0; i < w.perRegion; i++ {
+			wg.Add(1)
+			go func(region string) {
+				defer wg.Done()
+				response, err := w.invoke(ctx, region, payload)
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					errs = append(errs, err)
+					return
+				}
+				budget.AddQueries(response.Result.Queries + response.Result.Retries)
+				responses[region] = append(responses[region], response)
+			}(region)
+		}
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return fanOutResult{}, err
+	}
+
+	return newFanOutResult("region", w.regions, responses, len(targets)), nil
+}
+
+// queryWorkerCode returns the binary zipped as the bootstrap of a Lambda custom runtime and its architecture
+func queryWorkerCode(binary string) ([]byte, lambdatypes.Architecture, error) {
+	contents, architecture, err := readWorkerBinary(binary)
+	if err != nil {
+		return nil, "", err
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	header := &zip.FileHeader{Name: "bootstrap", Method: zip.Deflate}
+	header.SetMode(0o755)
+	file, err := zw.CreateHeader(header)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := file.Write(contents); err != nil {
+		return nil, "", err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, "", err
+	}
+	if buf.Len() > queryWorkerMaxCode {
+		return nil, "", fmt.Errorf("%s is %d bytes zipped, more than the %d bytes Lambda accepts", binary, buf.Len(), queryWorkerMaxCode)
+	}
+	return buf.Bytes(), lambdatypes.Architecture(architecture), nil
+}
+
+// createRole creates the role the workers run as and returns its ARN
+func (w *LambdaQueryWorkers) createRole(ctx context.Context) (string, error) {
+	out, err := w.iam.CreateRole(ctx, &iam.CreateRoleInput{
+		RoleName:                 &w.name,
+		AssumeRolePolicyDocument: aws.String(lambdaAssumeRolePolicy),
+		Description:              aws.String("floodzone query workers"),
+		Tags:                     []iamtypes.Tag{{Key: aws.String(ephemeralVPCTagKey), Value: aws.String("true")}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to create query worker role: %w", err)
+	}
+	roleARN := aws.ToString(out.Role.Arn)
+	w.partition = "aws"
+	if parsed, err := arn.Parse(roleARN); err == nil {
+		w.partition = parsed.Partition
+	}
+	if _, err := w.iam.AttachRolePolicy(ctx, &iam.AttachRolePolicyInput{
+		RoleName:  &w.name,
+		PolicyArn: aws.String(fmt.Sprintf(lambdaBasicExecutionPolicy, w.partition)),
+	}); err != nil {
+		return roleARN, fmt.Errorf("unable to attach the logging policy to the query worker role: %w", err)
+	}
+	return roleARN, nil
+}
+
+// deleteRole detaches the policy of the worker role and deletes it
+func (w *LambdaQueryWorkers) deleteRole(ctx context.Context) error {
+	if _, err := w.iam.DetachRolePolicy(ctx, &iam.DetachRolePolicyInput{
+		RoleName:  &w.name,
+		PolicyArn: aws.String(fmt.Sprintf(lambdaBasicExecutionPolicy, w.partition)),
+	}); err != nil {
+		return fmt.Errorf("unable to detach the logging policy from the query worker role: %w", err)
+	}
+	if _, err := w.iam.DeleteRole(ctx, &iam.DeleteRoleInput{RoleName: &w.name}); err != nil {
+		return fmt.Errorf("unable to delete query worker role: %w", err)
+	}
+	slog.Info("✅ Successfully deleted query worker role", "role", w.name)
+	return nil
+}
+
+// lambdaClient returns a Lambda client of the region whose calls wait for a synchronous invocation to be answered
+func (w *LambdaQueryWorkers) lambdaClient(region string) *lambda.Client {
+	return lambda.NewFromConfig(w.cfg, func(o *lambda.Options) {
+		o.Region = region
+		if client, ok := w.cfg.HTTPClient.(*awshttp.BuildableClient); ok {
+			o.HTTPClient = client.WithTimeout(0)
+		}
+	})
+}
+
+// createFunction creates the worker function of the region and waits for it to become active
+func (w *LambdaQueryWorkers) createFunction(ctx context.Context, region string, roleARN string, code []byte, architecture lambdatypes.Architecture, timeout time.Duration) error {
+	client := w.lambdaClient(region)
+	ctx, cancel := context.WithTimeout(ctx, queryWorkerTimeout)
+	defer cancel()
+	for {
+		_, err := client.CreateFunction(ctx, &lambda.CreateFunctionInput{
+			FunctionName:  &w.name,
+			Role:          &roleARN,
+			Runtime:       lambdatypes.RuntimeProvidedal2023,
+			Handler:       aws.String("bootstrap"),
+			Code:          &lambdatypes.FunctionCode{ZipFile: code},
+			Architectures: []lambdatypes.Architecture{architecture},
+			Timeout:       aws.Int32(int32(timeout.Seconds())),
+			MemorySize:    aws.Int32(queryWorkerMemoryMB),
+			Description:   aws.String("floodzone query worker"),
+			Tags:          map[string]string{ephemeralVPCTagKey: "true"},
+		})
+		// a new role can't be assumed by Lambda until IAM has propagated it
+		var invalid *lambdatypes.InvalidParameterValueException
+		if errors.As(err, &invalid) && strings.Contains(invalid.ErrorMessage(), "role") {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("timed out waiting for the query worker role to be usable in %s: %w", region, err)
+			case <-time.After(queryWorkerPollInterval):
+				continue
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("unable to create query worker in %s: %w", region, err)
+		}
+		break
+	}
+	for {
+		out, err := client.GetFunctionConfiguration(ctx, &lambda.GetFunctionConfigurationInput{FunctionName: &w.name})
+		if err != nil {
+			return fmt.Errorf("unable to describe query worker in %s: %w", region, err)
+		}
+		switch out.State {
+		case lambdatypes.StateActive:
+			slog.Info("✅ Successfully deployed query worker", "function", w.name, "region", region)
+			return nil
+		case lambdatypes.StateFailed:
+			return fmt.Errorf("query worker in %s failed to become active: %s", region, aws.ToString(out.StateReason))
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for the query worker in %s to become active", region)
+		case <-time.After(queryWorkerPollInterval):
+		}
+	}
+}
+
+// deleteFunction deletes the worker function of the region, if it was created
+func (w *LambdaQueryWorkers) deleteFunction(ctx context.Context, region string) error {
+	_, err := w.lambdaClient(region).DeleteFunction(ctx, &lambda.DeleteFunctionInput{FunctionName: &w.name})
+	var notFound *lambdatypes.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("✅ Successfully deleted query worker", "function", w.name, "region", region)
+	return nil
+}
+
+// invoke invokes a worker of the region synchronously and returns its response
+func (w *LambdaQueryWorkers) invoke(ctx context.Context, region string, payload []byte) (queryWorkerResponse, error) {
+	out, err := w.lambdaClient(region).Invoke(ctx, &lambda.InvokeInput{
+		FunctionName:   &w.name,
+		InvocationType: lambdatypes.InvocationTypeRequestResponse,
+		Payload:        payload,
+	})
+	if err != nil {
+		return queryWorkerResponse{}, fmt.Errorf("unable to invoke query worker in %s: %w", region, err)
+	}
+	if out.FunctionError != nil {
+		return queryWorkerResponse{}, fmt.Errorf("query worker in %s failed: %s", region, out.Payload)
+	}
+	var response queryWorkerResponse
+	if err := json.Unmarshal(out.Payload, &response); err != nil {
+		return queryWorkerResponse{}, fmt.Errorf("unable to parse the answer of the query worker in %s: %w", region, err)
+	}
+	return response, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+const (
+	// defaultLocalStackEndpoint is where LocalStack serves every AWS API by default
+	defaultLocalStackEndpoint = "http://localhost:4566"
+	localStackPort            = "4566"
+	// localStackRegion and localStackAccessKey are what LocalStack uses when nothing else is configured, the access key
+	// picks its default account 000000000000
+	localStackRegion    = "us-east-1"
+	localStackAccessKey = "test"
+)
+
+// isLocalStackEndpoint returns whether the endpoint is LocalStack's, on its default port or a host like
+// localhost.localstack.cloud or the localstack service of a Docker Compose file
+func isLocalStackEndpoint(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		host = u.Host
+	}
+	return port == localStackPort || strings.Contains(strings.ToLower(host), "localstack")
+}
+
+// detectLocalStack turns on LocalStack mode when the endpoint is LocalStack's, and defaults the endpoint of LocalStack
+// mode to LocalStack's default
+func (o *Options) detectLocalStack() {
+	if isLocalStackEndpoint(o.Endpoint) {
+		o.LocalStack = true
+	}
+	if o.LocalStack && o.Endpoint == "" {
+		o.Endpoint = defaultLocalStackEndpoint
+	}
+}
+
+// localStackCredentials returns the credentials LocalStack accepts, unless credentials are configured with the
+// environment or a profile, e.g. to pick another LocalStack account with a 12 digit access key
+func localStackCredentials(global globalFlags) aws.CredentialsProvider {
+	if global.profile != "" || os.Getenv("AWS_PROFILE") != "" || os.Getenv("AWS_ACCESS_KEY_ID") != "" {
+		return nil
+	}
+	return credentials.NewStaticCredentialsProvider(localStackAccessKey, localStackAccessKey, "")
+}
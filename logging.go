@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"unicode"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// setupLogger configures the default slog logger to write to w with the log level and format (text or json).
+// Quiet only logs errors, verbose logs at debug level, and emoji are stripped from messages with NoEmoji.
+func setupLogger(opts Options, w io.Writer) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(opts.LogLevel)); err != nil {
+		return fmt.Errorf("invalid log level %q, must be one of debug, info, warn, or error", opts.LogLevel)
+	}
+	if opts.Quiet && opts.Verbose {
+		return fmt.Errorf("quiet and verbose are mutually exclusive")
+	}
+	if opts.Quiet {
+		lvl = slog.LevelError
+	}
+	if opts.Verbose {
+		lvl = slog.LevelDebug
+	}
+	handlerOpts := &slog.HandlerOptions{Level: lvl}
+	if opts.NoEmoji {
+		handlerOpts.ReplaceAttr = func(_ []string, a slog.Attr) slog.Attr {
+			if a.Value.Kind() == slog.KindString {
+				a.Value = slog.StringValue(stripEmoji(a.Value.String()))
+			}
+			return a
+		}
+	}
+	var handler slog.Handler
+	switch opts.LogFormat {
+	case "text":
+		handler = slog.NewTextHandler(w, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	default:
+		return fmt.Errorf("invalid log format %q, must be text or json", opts.LogFormat)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// stripEmoji removes emoji and the whitespace left around them, e.g. "✅✅ DONE ✅✅" becomes "DONE"
+func stripEmoji(s string) string {
+	stripped := strings.Map(func(r rune) rune {
+		// emoji are "other symbols", and are followed by a variation selector or joined by a zero width joiner
+		if unicode.Is(unicode.So, r) || r == '\uFE0F' || r == '\u200D' {
+			return -1
+		}
+		return r
+	}, s)
+	if stripped == s {
+		return s
+	}
+	return strings.ReplaceAll(strings.Join(strings.Fields(stripped), " "), " !", "!")
+}
+
+// jsonValue defers marshaling v to JSON until the log record is actually handled, so that verbose request and
+// response logging doesn't cost anything at higher log levels
+type jsonValue struct{ v any }
+
+func (j jsonValue) LogValue() slog.Value {
+	data, err := json.Marshal(j.v)
+	if err != nil {
+		return slog.StringValue(fmt.Sprintf("unable to marshal: %s", err))
+	}
+	return slog.StringValue(string(data))
+}
+
+// fatal logs the message at error level and exits with the code
+func fatal(code int, msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(code)
+}
+
+// requestIDMiddleware logs the request ID of every failed AWS API call, and of every call when all is set, since
+// AWS Support asks for them when investigating a call
+func requestIDMiddleware(all bool) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("FloodzoneRequestIDs", func(ctx context.Context, in middleware.InitializeInput,
+			next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			out, metadata, err := next.HandleInitialize(ctx, in)
+			service, operation := awsmiddleware.GetServiceID(ctx), awsmiddleware.GetOperationName(ctx)
+			if results, ok := retry.GetAttemptResults(metadata); ok {
+				for _, result := range results.Results {
+					if result.Err != nil && result.Retried {
+						id, _ := awsmiddleware.GetRequestIDMetadata(result.ResponseMetadata)
+						slog.Debug("AWS API call attempt failed, retrying", "service", service, "operation", operation, "requestId", id, "error", result.Err)
+					}
+				}
+			}
+			requestID, _ := awsmiddleware.GetRequestIDMetadata(metadata)
+			if err != nil {
+				slog.Warn("AWS API call failed", "service", service, "operation", operation, "requestId", requestID, "error", err)
+			} else if all {
+				slog.Info("AWS API call", "service", service, "operation", operation, "requestId", requestID)
+			}
+			return out, metadata, err
+		}), middleware.After)
+	}
+}
@@ -2,238 +2,775 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"os/signal"
+	"slices"
+	"syscall"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
 	"github.com/aws/aws-sdk-go-v2/service/route53"
 	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53resolver"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/servicediscovery"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type Zone struct {
-	R53 *route53.Client
+type Options struct {
+	MaxBatchSize                int           `yaml:"max-batch-size"`
+	TotalRecords                int           `yaml:"total-records"`
+	Iterations                  int           `yaml:"iterations"`
+	HostedZoneID                string        `yaml:"hosted-zone-id"`
+	BatchDelay                  time.Duration `yaml:"batch-delay-duration"`
+	VPCID                       string        `yaml:"vpc-id"`
+	CreateVPC                   bool          `yaml:"create-vpc"`
+	Progress                    bool          `yaml:"progress"`
+	TUI                         bool          `yaml:"tui"`
+	WebDashboard                string        `yaml:"web-dashboard"`
+	CloudWatchMetrics           bool          `yaml:"cloudwatch-metrics"`
+	CloudWatchNamespace         string        `yaml:"cloudwatch-namespace"`
+	CloudWatchDashboard         bool          `yaml:"cloudwatch-dashboard"`
+	QueryLogGroup               string        `yaml:"query-log-group"`
+	QueryLogging                string        `yaml:"query-logging"`
+	AlarmThrottles              int           `yaml:"alarm-throttles"`
+	OnAlarm                     string        `yaml:"on-alarm"`
+	MaxErrors                   int           `yaml:"max-errors"`
+	OnErrorBudget               string        `yaml:"on-error-budget"`
+	LogLevel                    string        `yaml:"log-level"`
+	LogFormat                   string        `yaml:"log-format"`
+	Quiet                       bool          `yaml:"quiet"`
+	Verbose                     bool          `yaml:"verbose"`
+	Output                      string        `yaml:"output"`
+	NoColor                     bool          `yaml:"no-color"`
+	NoEmoji                     bool          `yaml:"no-emoji"`
+	SummaryFile                 string        `yaml:"summary-file"`
+	Artifacts                   string        `yaml:"artifacts"`
+	S3SSE                       string        `yaml:"s3-sse"`
+	S3KMSKeyID                  string        `yaml:"s3-kms-key-id"`
+	Checkpoint                  string        `yaml:"checkpoint"`
+	AuditLog                    string        `yaml:"audit-log"`
+	CoordinationTable           string        `yaml:"coordination-table"`
+	LockWait                    time.Duration `yaml:"lock-wait"`
+	SharedRateLimit             int           `yaml:"shared-rate-limit"`
+	Manifest                    string        `yaml:"manifest"`
+	ManifestInterval            time.Duration `yaml:"manifest-interval"`
+	Terraform                   string        `yaml:"terraform"`
+	ExternalDNS                 string        `yaml:"external-dns"`
+	ExternalDNSKind             string        `yaml:"external-dns-kind"`
+	VerifyResolver              string        `yaml:"verify-resolver"`
+	VerifySample                int           `yaml:"verify-sample"`
+	VerifyTimeout               time.Duration `yaml:"verify-timeout"`
+	VerifyTestDNSAnswer         bool          `yaml:"verify-test-dns-answer"`
+	VerifyEDNSSubnets           string        `yaml:"verify-edns-subnets"`
+	VerifyList                  bool          `yaml:"verify-list"`
+	LogRequestIDs               bool          `yaml:"log-request-ids"`
+	MeasurePropagation          bool          `yaml:"measure-propagation"`
+	PropagationInterval         time.Duration `yaml:"propagation-poll-interval"`
+	MeasureResolvable           bool          `yaml:"measure-resolvable"`
+	ResolvableResolver          string        `yaml:"resolvable-resolver"`
+	ResolvablePercent           float64       `yaml:"resolvable-sample-percent"`
+	ResolvableInterval          time.Duration `yaml:"resolvable-poll-interval"`
+	BatchCSV                    string        `yaml:"batch-csv"`
+	HTMLReport                  string        `yaml:"html-report"`
+	JUnitReport                 string        `yaml:"junit-report"`
+	SNSTopicARN                 string        `yaml:"sns-topic-arn"`
+	WebhookURL                  string        `yaml:"webhook-url"`
+	WebhookFormat               string        `yaml:"webhook-format"`
+	WebhookMilestone            int           `yaml:"webhook-milestone-percent"`
+	BatchWebhookURL             string        `yaml:"batch-webhook-url"`
+	RecordGenerator             string        `yaml:"record-generator"`
+	OnRunStart                  string        `yaml:"on-run-start"`
+	OnBatchSubmitted            string        `yaml:"on-batch-submitted"`
+	OnBatchComplete             string        `yaml:"on-batch-complete"`
+	OnError                     string        `yaml:"on-error"`
+	OnRunComplete               string        `yaml:"on-run-complete"`
+	HookTimeout                 time.Duration `yaml:"hook-timeout"`
+	EventBridgeBus              string        `yaml:"eventbridge-bus"`
+	Endpoint                    string        `yaml:"endpoint"`
+	LocalStack                  bool          `yaml:"localstack"`
+	OTLPEndpoint                string        `yaml:"otlp-endpoint"`
+	UseFIPS                     bool          `yaml:"use-fips"`
+	UseDualStack                bool          `yaml:"use-dualstack"`
+	HTTPTimeout                 time.Duration `yaml:"http-timeout"`
+	ProxyURL                    string        `yaml:"proxy-url"`
+	MaxIdleConns                int           `yaml:"max-idle-conns"`
+	AppID                       string        `yaml:"app-id"`
+	RunID                       string        `yaml:"run-id"`
+	DryRun                      bool          `yaml:"dry-run"`
+	CostLifetime                time.Duration `yaml:"cost-lifetime"`
+	MaxCost                     float64       `yaml:"max-cost"`
+	HistoryDB                   string        `yaml:"history-db"`
+	NoHistory                   bool          `yaml:"no-history"`
+	Compare                     string        `yaml:"compare"`
+	CompareRun                  string        `yaml:"compare-run"`
+	RegressionThreshold         float64       `yaml:"regression-threshold"`
+	FromManifest                string        `yaml:"from-manifest"`
+	Resolver                    string        `yaml:"resolver"`
+	QueryProtocol               string        `yaml:"protocol"`
+	ResolverEndpointID          string        `yaml:"resolver-endpoint-id"`
+	CreateEndpoint              bool          `yaml:"create-inbound-endpoint"`
+	EndpointSubnets             string        `yaml:"inbound-endpoint-subnet-ids"`
+	EndpointSecGroups           string        `yaml:"inbound-endpoint-security-group-ids"`
+	ForwardTargets              string        `yaml:"forward-targets"`
+	ForwardDomain               string        `yaml:"forward-domain"`
+	ForwardVPCIDs               string        `yaml:"forward-vpc-ids"`
+	OutboundEndpoint            string        `yaml:"outbound-endpoint-id"`
+	OutboundSubnets             string        `yaml:"outbound-endpoint-subnet-ids"`
+	OutboundSecGroups           string        `yaml:"outbound-endpoint-security-group-ids"`
+	CloudMapNamespace           string        `yaml:"namespace-id"`
+	CloudMapInstances           int           `yaml:"instances"`
+	CloudMapInstancesPerService int           `yaml:"instances-per-service"`
+	CloudMapRecordTypes         string        `yaml:"dns-record-types"`
+	CloudMapRegisterRate        float64       `yaml:"register-rate"`
+	CloudMapTimeout             time.Duration `yaml:"wait-timeout"`
+	HealthChecks                int           `yaml:"health-checks"`
+	HealthCheckTypes            string        `yaml:"health-check-types"`
+	HealthCheckTarget           string        `yaml:"health-check-target"`
+	HealthCheckPort             int           `yaml:"health-check-port"`
+	HealthCheckSearchString     string        `yaml:"search-string"`
+	HealthCheckLatencyPercent   float64       `yaml:"measure-latency-percent"`
+	CreateRate                  float64       `yaml:"create-rate"`
+	Delete                      bool          `yaml:"delete"`
+	HealthCheckIntervals        string        `yaml:"request-intervals"`
+	HealthCheckThresholds       string        `yaml:"failure-thresholds"`
+	HealthCheckRegions          string        `yaml:"health-check-regions"`
+	HealthCheckAlarmName        string        `yaml:"alarm-name"`
+	HealthCheckAlarmRegion      string        `yaml:"alarm-region"`
+	HealthCheckInsufficientData string        `yaml:"insufficient-data-statuses"`
+	CalculatedChildren          int           `yaml:"calculated-children"`
+	HealthThresholdPercent      float64       `yaml:"health-threshold-percent"`
+	HealthCheckWatch            time.Duration `yaml:"watch"`
+	TrafficPolicies             int           `yaml:"traffic-policies"`
+	TrafficPolicyVersions       int           `yaml:"versions"`
+	TrafficPolicyRules          int           `yaml:"rules"`
+	TrafficPolicyEndpoints      int           `yaml:"endpoints-per-rule"`
+	TrafficPolicyInstances      int           `yaml:"policy-instances"`
+	CidrCollections             int           `yaml:"collections"`
+	CidrLocations               int           `yaml:"locations"`
+	CidrBlocksPerLocation       int           `yaml:"blocks-per-location"`
+	CidrLocationsPerChange      int           `yaml:"locations-per-change"`
+	CidrCollectionVersion       bool          `yaml:"collection-version"`
+	VPCIDs                      string        `yaml:"vpc-ids"`
+	CreateVPCs                  int           `yaml:"create-vpcs"`
+	KeepAssociations            bool          `yaml:"keep-associations"`
+	RoutingPolicy               string        `yaml:"routing-policy"`
+	SetIdentifiers              int           `yaml:"set-identifiers"`
+	KeepRecordSets              bool          `yaml:"keep-record-sets"`
+	FirewallDomainLists         int           `yaml:"domain-lists"`
+	FirewallDomains             int           `yaml:"domains-per-list"`
+	FirewallRuleGroups          int           `yaml:"rule-groups"`
+	FirewallRulesPerGroup       int           `yaml:"rules-per-group"`
+	FirewallPriorityStep        int           `yaml:"priority-step"`
+	FirewallAction              string        `yaml:"firewall-action"`
+	FirewallDomainsURI          string        `yaml:"domains-s3-uri"`
+	QPS                         int           `yaml:"qps"`
+	Concurrency                 int           `yaml:"concurrency"`
+	QueryDuration               time.Duration `yaml:"duration"`
+	MissPercent                 float64       `yaml:"miss-percent"`
+	MissNames                   int           `yaml:"miss-names"`
+	QueryTypeMix                string        `yaml:"query-type-mix"`
+	Popularity                  string        `yaml:"popularity"`
+	ZipfExponent                float64       `yaml:"zipf-exponent"`
+	RampUp                      time.Duration `yaml:"ramp-up"`
+	EDNSSubnets                 string        `yaml:"edns-subnets"`
+	DNSSEC                      bool          `yaml:"dnssec"`
+	RandomizeCase               bool          `yaml:"randomize-case"`
+	QueryAttempts               int           `yaml:"attempts"`
+	QueryTimeout                time.Duration `yaml:"query-timeout"`
+	LambdaRegions               string        `yaml:"lambda-regions"`
+	LambdaWorkers               int           `yaml:"lambda-workers-per-region"`
+	WorkerBinary                string        `yaml:"worker-binary"`
+	SSMInstanceIDs              string        `yaml:"ssm-instance-ids"`
+	SSMInstanceTags             string        `yaml:"ssm-instance-tags"`
+	SSMS3URI                    string        `yaml:"ssm-s3-uri"`
+	LogsSince                   time.Duration `yaml:"since"`
+	LogsInterval                time.Duration `yaml:"interval"`
+	CheckAnswers                bool          `yaml:"check-answers"`
+	ManifestRefresh             time.Duration `yaml:"manifest-refresh"`
+	CacheBustPercent            float64       `yaml:"cache-bust-percent"`
+	CacheBustMode               string        `yaml:"cache-bust-mode"`
+	ListTypes                   string        `yaml:"types"`
+	ListName                    string        `yaml:"name"`
+	// ConfigOut is where the init command writes the generated config file
+	ConfigOut string `yaml:"-"`
+	// HistoryLimit is how many runs the history command lists
+	HistoryLimit int `yaml:"-"`
+	// GRPCAddr, HTTPAddr, TLSCert, TLSKey, and AuthTokenFile are where and how the serve command serves its APIs
+	GRPCAddr      string `yaml:"-"`
+	HTTPAddr      string `yaml:"-"`
+	TLSCert       string `yaml:"-"`
+	TLSKey        string `yaml:"-"`
+	AuthTokenFile string `yaml:"-"`
+	// FakeAddr, FakeRate, FakePropagation, FakeLatency, FakeRecordLimit, FakeHealthCheckLimit,
+	// FakeTrafficPolicyLimit, FakePolicyInstanceLimit, FakeCidrCollectionLimit, FakeCidrBlockLimit, and
+	// FakeVPCAssociationLimit are how the fake-route53 command serves its fake Route 53 API
+	FakeAddr                string        `yaml:"-"`
+	FakeRate                float64       `yaml:"-"`
+	FakePropagation         time.Duration `yaml:"-"`
+	FakeLatency             time.Duration `yaml:"-"`
+	FakeRecordLimit         int           `yaml:"-"`
+	FakeHealthCheckLimit    int           `yaml:"-"`
+	FakeTrafficPolicyLimit  int           `yaml:"-"`
+	FakePolicyInstanceLimit int           `yaml:"-"`
+	FakeCidrCollectionLimit int           `yaml:"-"`
+	FakeCidrBlockLimit      int           `yaml:"-"`
+	FakeVPCAssociationLimit int           `yaml:"-"`
+	// K8sPlan, K8sCommand, K8sName, K8sNamespace, K8sImage, K8sServiceAccount, K8sAllowedImages,
+	// K8sAllowedServiceAccounts, and K8sResync are the Kubernetes resources the k8s command generates and reconciles
+	K8sPlan                   string        `yaml:"-"`
+	K8sCommand                string        `yaml:"-"`
+	K8sName                   string        `yaml:"-"`
+	K8sNamespace              string        `yaml:"-"`
+	K8sImage                  string        `yaml:"-"`
+	K8sServiceAccount         string        `yaml:"-"`
+	K8sAllowedImages          string        `yaml:"-"`
+	K8sAllowedServiceAccounts string        `yaml:"-"`
+	K8sResync                 time.Duration `yaml:"-"`
+	// StepFunctionsPlan, StepFunctionsPhases, StepFunctionsFunction, StepRecords, and StepIterations are the state
+	// machine the step-functions command generates
+	StepFunctionsPlan     string `yaml:"-"`
+	StepFunctionsPhases   string `yaml:"-"`
+	StepFunctionsFunction string `yaml:"-"`
+	StepRecords           int    `yaml:"-"`
+	StepIterations        int    `yaml:"-"`
+
+	// The following options can only be set in a config file
+
+	// TypeMix is the relative weight of each record type to create, defaulting to only A records
+	TypeMix map[types.RRType]int `yaml:"type-mix"`
+	// LoadProfile is a sequence of stages to flood the zone with, each with its own pacing
+	LoadProfile []LoadStage `yaml:"load-profile"`
+	// Alarms are created for the duration of the run, see --on-alarm
+	Alarms []AlarmSpec `yaml:"alarms"`
+	// Assertions fail a run that finished when they don't hold, e.g. "latency-p99 < 2s"
+	Assertions []string `yaml:"assertions"`
+	// Zones runs the command once per zone, overriding the top-level options
+	Zones []ZoneOptions `yaml:"zones"`
 }
 
-type Options struct {
-	MaxBatchSize int
-	TotalRecords int
-	HostedZoneID string
-	BatchDelay   time.Duration
-	VPCID        string
-	Delete       bool
-	Endpoint     string
+// command is a floodzone subcommand with its own set of flags
+type command struct {
+	name        string
+	description string
+	// flags registers the command specific flags on the FlagSet
+	flags func(fs *flag.FlagSet, opts *Options)
+	run   func(ctx context.Context, zone Zone, opts Options) error
+	// plan returns what run would do for --dry-run, for commands that change resources
+	plan func(ctx context.Context, zone Zone, opts Options) (executionPlan, error)
+	// summary prints the run summary once the command finishes, for commands that change resource record sets
+	summary bool
+	// validate checks the options upfront, before any AWS calls are made
+	validate func(opts Options) error
+	// runLocal is used instead of run by commands that don't call AWS and receives the positional arguments
+	runLocal func(ctx context.Context, opts Options, args []string) error
+	// subcommands of a local command may come before its flags, and are passed to runLocal as the first argument
+	subcommands []string
+}
+
+// globalFlags are registered for every command that calls AWS
+type globalFlags struct {
+	// region, profile, and the role to assume should only be used in the client config, so don't add to Options struct
+	region          string
+	profile         string
+	assumeRoleARN   string
+	externalID      string
+	roleSessionName string
+	configPath      string
 }
 
 func main() {
 	ctx := context.Background()
+	// the floodzone binary is the handler of the query workers it deploys to Lambda
+	if os.Getenv(lambdaRuntimeAPIEnv) != "" {
+		if err := runLambdaWorker(ctx); err != nil {
+			fatal(exitError, "query worker failed", "error", err)
+		}
+		return
+	}
+	if len(os.Args) < 2 || os.Args[1] == "-h" || os.Args[1] == "--help" || os.Args[1] == "help" {
+		usage()
+		os.Exit(0)
+	}
+	cmd, ok := lookupCommand(os.Args[1])
+	if !ok {
+		fmt.Printf("Unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(1)
+	}
+
+	// a subcommand comes before the flags, e.g. floodzone k8s generate --plan plan.yaml
+	flagArgs := os.Args[2:]
+	var subcommand []string
+	if len(flagArgs) > 0 && slices.Contains(cmd.subcommands, flagArgs[0]) {
+		subcommand, flagArgs = flagArgs[:1], flagArgs[1:]
+	}
 	opts := Options{}
-	flag.IntVar(&opts.MaxBatchSize, "max-batch-size", 100, "Max batch size of resource record set creations in one API call (max is 1,000)")
-	flag.IntVar(&opts.TotalRecords, "total-records", 1_000, "Total resource record sets in the hosted zone (max is 10,000)")
-	flag.StringVar(&opts.HostedZoneID, "hosted-zone-id", "", "Hosted Zone ID")
-	flag.DurationVar(&opts.BatchDelay, "batch-delay-duration", 10*time.Second, "Duration of time between batch executions")
-	flag.StringVar(&opts.VPCID, "vpc-id", "", "VPC ID to associate the PHZ with if it doesn't already exist")
-	flag.BoolVar(&opts.Delete, "delete", false, "Delete records")
-	flag.StringVar(&opts.Endpoint, "endpoint", "", "Route 53 API endpoint to use")
-	// region should only be used in the client config, so don't add to Options struct
-	region := flag.String("region", "", "AWS Region")
-	flag.Parse()
-
-	cfg, err := config.LoadDefaultConfig(ctx)
-	if err != nil {
-		log.Fatal(err)
+	global := globalFlags{}
+	fs := newFlagSet(cmd, &opts, &global)
+	fs.Parse(flagArgs)
+	// precedence from lowest to highest is: defaults, config file, FLOODZONE_* environment variables, flags
+	if global.configPath == "" {
+		global.configPath = os.Getenv(envName("config"))
 	}
-	if opts.Endpoint != "" {
-		cfg.BaseEndpoint = &opts.Endpoint
+	if global.configPath != "" {
+		if err := loadConfig(global.configPath, &opts, &global); err != nil {
+			fatal(exitConfig, "unable to load config", "error", err)
+		}
 	}
-	if *region != "" {
-		cfg.Region = *region
+	if err := setFlagsFromEnv(fs); err != nil {
+		fatal(exitConfig, "unable to load environment variables", "error", err)
 	}
-	r53 := route53.NewFromConfig(cfg)
-	zone := Zone{R53: r53}
+	// parse the flags again so that flags explicitly set on the command line take precedence
+	fs.Parse(flagArgs)
+	opts.detectLocalStack()
 
-	// Create a hosted zone if no hosted zone ID passed in by user
-	if opts.HostedZoneID == "" {
-		if opts.VPCID == "" {
-			fmt.Println("--vpc-id is required when --hosted-zone-id is not provided.")
-			os.Exit(1)
+	// CI log viewers and syslog forwarding garble emoji and ANSI escape codes, so only use them on a terminal
+	if !isTerminal(os.Stdout) {
+		opts.NoEmoji = true
+		opts.NoColor = true
+	}
+	if err := setupLogger(opts, os.Stderr); err != nil {
+		fatal(exitConfig, "unable to configure logging", "error", err)
+	}
+	if cmd.run != nil {
+		if err := validOutputFormat(opts.Output); err != nil {
+			fatal(exitConfig, "invalid flags", "error", err)
 		}
-		zoneID, err := zone.CreatePrivateHostedZone(ctx, opts.VPCID, cfg.Region)
-		if err != nil {
-			log.Fatalf("unable to create hosted zone: %s", err)
+		if err := validateArtifacts(opts); err != nil {
+			fatal(exitConfig, "invalid flags", "error", err)
+		}
+		if err := validateCoordination(opts); err != nil {
+			fatal(exitConfig, "invalid flags", "error", err)
+		}
+		// the flags are only registered for the commands with a plan, but a config file can still set them
+		if opts.DryRun && cmd.plan == nil {
+			fatal(exitConfig, "invalid flags", "error", fmt.Errorf("--dry-run isn't supported by %s", cmd.name))
+		}
+		if opts.MaxCost > 0 && cmd.plan == nil {
+			fatal(exitConfig, "invalid flags", "error", fmt.Errorf("--max-cost isn't supported by %s", cmd.name))
+		}
+		if opts.CostLifetime < 0 || opts.MaxCost < 0 {
+			fatal(exitConfig, "invalid flags", "error", fmt.Errorf("--cost-lifetime and --max-cost must be 0 or more, got %s and %g", opts.CostLifetime, opts.MaxCost))
 		}
-		opts.HostedZoneID = zoneID
-		log.Printf("✅ Successfully Created Hosted Zone \"%s\" to flood 🌊!", zoneID)
 	}
 
-	// Describe and Pretty Print Hosted Zone to stdout
-	hz, err := r53.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: &opts.HostedZoneID})
-	if err != nil {
-		log.Fatalf("unable to describe hosted zone: %s", err)
+	if cmd.runLocal != nil {
+		if err := cmd.runLocal(ctx, opts, append(subcommand, fs.Args()...)); err != nil {
+			fatal(exitError, "Error when running command", "command", cmd.name, "error", err)
+		}
+		return
 	}
-	rrCount := int(*hz.HostedZone.ResourceRecordSetCount)
 
-	hzPretty, err := json.MarshalIndent(hz.HostedZone, "", "    ")
-	if err != nil {
-		log.Fatalf("unable to pretty print hosted zone: %s", err)
+	// the run ID names what the run creates, so every zone's copy of the options needs it
+	if opts.RunID == "" {
+		opts.RunID = uuid.NewString()
+	}
+	runs := []Options{opts}
+	if len(opts.Zones) != 0 && !flagSet(fs, "hosted-zone-id") {
+		runs = nil
+		for _, zoneOpts := range opts.Zones {
+			runs = append(runs, opts.forZone(zoneOpts))
+		}
+	}
+	if cmd.validate != nil {
+		for _, runOpts := range runs {
+			if err := cmd.validate(runOpts); err != nil {
+				fatal(exitConfig, "invalid flags", "command", cmd.name, "error", err)
+			}
+		}
 	}
-	fmt.Println(string(hzPretty))
 
-	// Create
-	if !opts.Delete {
-		if err := zone.CreateResourceRecordSets(ctx, hz.HostedZone, rrCount, opts.TotalRecords, opts.MaxBatchSize, opts.BatchDelay); err != nil {
-			log.Fatalf("Error when creating resource record sets: %s", err)
+	slog.Info("🌊 Starting run", "command", cmd.name, "runId", opts.RunID)
+	if err := opts.applyArtifacts(fs); err != nil {
+		fatal(exitConfig, "unable to set up the artifacts of the run", "error", err)
+	}
+	cfg, err := loadAWSConfig(ctx, opts, global)
+	if err != nil {
+		fatal(exitConfig, "unable to load AWS config", "error", err)
+	}
+	if global.assumeRoleARN != "" {
+		if err := assumeRole(ctx, &cfg, global.assumeRoleARN, global.externalID, global.roleSessionName); err != nil {
+			fatal(exitAuth, "unable to load AWS credentials", "error", err)
+		}
+	}
+	cfg.APIOptions = append(cfg.APIOptions, requestIDMiddleware(opts.LogRequestIDs))
+	// cleanups flush anything buffered for the run and are run in reverse before exiting, whether the run failed or not
+	var cleanups []func(ctx context.Context)
+	cleanup := func() {
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i](ctx)
 		}
-	} else {
-		remainingRRS, err := zone.DeleteResourceRecordSets(ctx, hz.HostedZone, opts.MaxBatchSize, opts.TotalRecords, opts.BatchDelay)
+	}
+	if tracingEnabled(opts) && !opts.DryRun {
+		shutdown, err := setupTracing(ctx, opts)
 		if err != nil {
-			log.Fatalf("Error when deleting resource record sets: %s", err)
+			fatal(exitConfig, "unable to set up tracing", "error", err)
 		}
-		// if there are no remaining resource record sets, delete the zone too
-		if remainingRRS == 0 {
-			if _, err := zone.R53.DeleteHostedZone(ctx, &route53.DeleteHostedZoneInput{Id: &opts.HostedZoneID}); err != nil {
-				log.Fatalf("Error when deleting the zone %s: %s", opts.HostedZoneID, err)
+		cfg.APIOptions = append(cfg.APIOptions, tracingMiddleware)
+		var span trace.Span
+		ctx, span = tracer().Start(ctx, "floodzone "+cmd.name)
+		cleanups = append(cleanups, func(ctx context.Context) {
+			span.End()
+			if err := shutdown(ctx); err != nil {
+				slog.Warn("unable to export traces", "error", err)
 			}
-			log.Printf("✅ Successfully deleted the private hosted zone %s since all record sets were deleted.", opts.HostedZoneID)
+		})
+	}
+	var auditLog *AuditLog
+	if opts.AuditLog != "" {
+		if auditLog, err = NewAuditLog(opts.AuditLog); err != nil {
+			fatal(exitConfig, "unable to set up the audit log", "error", err)
 		}
+		cleanups = append(cleanups, auditLog.Close)
+	}
+	var coordinator *Coordinator
+	if opts.CoordinationTable != "" && !opts.DryRun {
+		coordinator = NewCoordinator(dynamodb.NewFromConfig(cfg), opts.CoordinationTable, opts.RunID, cmd.name, opts.LockWait, opts.SharedRateLimit)
+		cleanups = append(cleanups, coordinator.Close)
+	}
+	// the dashboard and the throttling alarm use floodzone's metrics so they publish them too
+	var metrics *MetricsPublisher
+	if (opts.CloudWatchMetrics || opts.CloudWatchDashboard || opts.AlarmThrottles > 0) && !opts.DryRun {
+		metrics = NewMetricsPublisher(cloudwatch.NewFromConfig(cfg), opts.CloudWatchNamespace)
+		cleanups = append(cleanups, metrics.Close)
+	}
+	var errorBudget *ErrorBudget
+	if opts.MaxErrors > 0 && !opts.DryRun {
+		errorBudget = NewErrorBudget(cmd.name, opts)
+	}
+	stats := NewRunStats(opts.RunID)
+	zone := Zone{
+		R53: route53.NewFromConfig(cfg, route53Options(opts), stats.route53Option, auditLog.route53Option, metrics.route53Option, coordinator.route53Option,
+			errorBudget.route53Option),
+		EC2:         ec2.NewFromConfig(cfg),
+		S3:          s3.NewFromConfig(cfg, s3Options(opts)),
+		R53Resolver: route53resolver.NewFromConfig(cfg),
+		CloudMap:    servicediscovery.NewFromConfig(cfg),
+		Logs:        cloudwatchlogs.NewFromConfig(cfg),
+		Region:      cfg.Region,
+		Stats:       stats,
+		Metrics:     metrics,
+		Coordinator: coordinator,
+		ErrorBudget: errorBudget,
+		FakeRoute53: opts.Endpoint != "" && !opts.LocalStack && isFakeRoute53Endpoint(ctx, opts.Endpoint),
+	}
+	zone.Artifacts = NewArtifacts(zone.S3, opts.S3SSE, opts.S3KMSKeyID)
+	if opts.Progress {
+		zone.Progress = NewProgress(opts.NoEmoji, opts.NoColor)
+	}
+	if opts.TUI && !opts.DryRun {
+		if zone.TUI = NewTUI(cmd.name, opts, zone.Stats); zone.TUI != nil {
+			zone.Progress = zone.TUI.progress
+		}
+	}
+	if opts.WebDashboard != "" && !opts.DryRun {
+		if zone.Progress == nil {
+			zone.Progress = newTrackingProgress()
+		}
+		if zone.Web, err = NewWebDashboard(opts.WebDashboard, os.Getenv(webDashboardTokenEnv), cmd.name, opts.RunID, zone.Progress, zone.Stats); err != nil {
+			fatal(exitConfig, "unable to serve the web dashboard", "error", err)
+		}
+		cleanups = append(cleanups, zone.Web.Close)
+	}
+	if (len(opts.Alarms) > 0 || opts.AlarmThrottles > 0) && !opts.DryRun {
+		if zone.Alarms, err = NewRunAlarms(ctx, cloudwatch.NewFromConfig(cfg), opts); err != nil {
+			fatal(exitError, "unable to set up the run's alarms", "error", err)
+		}
+		cleanups = append(cleanups, zone.Alarms.Close)
+	}
+	if opts.HealthCheckWatch > 0 {
+		zone.HealthCheckMetrics = cloudwatch.NewFromConfig(cfg, func(o *cloudwatch.Options) { o.Region = healthCheckMetricsRegion })
+	}
+	if opts.CloudWatchDashboard && !opts.DryRun {
+		zone.Dashboard = NewDashboard(cloudwatch.NewFromConfig(cfg), opts.CloudWatchNamespace, cfg.Region, opts.QueryLogGroup, cmd.name, opts.RunID)
+		cleanups = append(cleanups, zone.Dashboard.Close)
+	}
+	if opts.BatchCSV != "" && !opts.DryRun {
+		if zone.BatchCSV, err = NewBatchCSV(opts.BatchCSV); err != nil {
+			fatal(exitConfig, "unable to set up the batch CSV", "error", err)
+		}
+		cleanups = append(cleanups, zone.BatchCSV.Close)
+	}
+	if opts.SNSTopicARN != "" && !opts.DryRun {
+		zone.SNS = NewSNSNotifier(sns.NewFromConfig(cfg), opts.SNSTopicARN)
+	}
+	if opts.WebhookURL != "" && !opts.DryRun {
+		zone.Webhook = NewWebhook(opts.WebhookURL, opts.WebhookFormat, opts.WebhookMilestone, cmd.name, opts.RunID)
+	}
+	if opts.BatchWebhookURL != "" && !opts.DryRun {
+		zone.BatchWebhook = NewBatchWebhook(opts.BatchWebhookURL, cmd.name, opts.RunID)
+		cleanups = append(cleanups, zone.BatchWebhook.Close)
+	}
+	if !opts.DryRun {
+		zone.Hooks = NewExecHooks(opts, cmd.name)
+	}
+	if opts.EventBridgeBus != "" && !opts.DryRun {
+		zone.EventBridge = NewEventBridgePublisher(eventbridge.NewFromConfig(cfg), opts.EventBridgeBus, cmd.name, opts.RunID)
+		cleanups = append(cleanups, zone.EventBridge.Close)
+	}
+	if opts.MeasurePropagation && !opts.DryRun {
+		zone.Propagation = NewPropagationTracker(zone.R53, zone.Stats, opts.PropagationInterval)
+		cleanups = append(cleanups, zone.Propagation.Close)
+	}
+	if opts.MeasureResolvable && !opts.DryRun {
+		zone.Resolvable = NewResolvableTracker(splitList(opts.ResolvableResolver), opts.ResolvablePercent, opts.ResolvableInterval, zone.Stats)
+		cleanups = append(cleanups, zone.Resolvable.Close)
+	}
+	if opts.VerifyResolver != "" && !opts.DryRun {
+		zone.Resolution = NewResolutionVerifier(opts.VerifyResolver, opts.VerifySample, opts.VerifyTimeout, zone.Stats)
+	}
+	if opts.VerifyTestDNSAnswer && !opts.DryRun {
+		zone.Resolution = NewTestDNSAnswerVerifier(zone.R53, splitList(opts.VerifyEDNSSubnets), opts.VerifySample, opts.VerifyTimeout, zone.Stats)
+	}
+	if opts.VerifyList && !opts.DryRun {
+		zone.Writes = NewWriteVerifier(zone.Stats)
+	}
+	if opts.LambdaRegions != "" && !opts.DryRun {
+		zone.LambdaWorkers = NewLambdaQueryWorkers(cfg, splitList(opts.LambdaRegions), opts.LambdaWorkers, opts.WorkerBinary, opts.RunID)
+	}
+	if (opts.SSMInstanceIDs != "" || opts.SSMInstanceTags != "") && !opts.DryRun {
+		zone.InstanceWorkers = NewInstanceQueryWorkers(ssm.NewFromConfig(cfg), zone.EC2, zone.S3, splitList(opts.SSMInstanceIDs),
+			splitList(opts.SSMInstanceTags), opts.WorkerBinary, opts.SSMS3URI, opts.RunID)
+	}
+	if opts.Manifest != "" && !opts.DryRun {
+		zone.Manifest = NewManifest(opts.Manifest, zone.Artifacts, cmd.name, opts.RunID, opts.ManifestInterval)
+		cleanups = append(cleanups, zone.Manifest.Close)
+	}
+	if opts.Checkpoint != "" && !opts.DryRun {
+		if zone.Checkpoint, err = LoadCheckpoint(ctx, zone.Artifacts, opts.Checkpoint, cmd.name, opts.RunID); err != nil {
+			fatal(exitConfig, "unable to load the checkpoint", "error", err)
+		}
+		cleanups = append(cleanups, zone.Checkpoint.Close)
+		if zone.Checkpoint.Resumed() {
+			if err := zone.Manifest.Resume(ctx); err != nil {
+				fatal(exitConfig, "unable to resume the record manifest", "error", err)
+			}
+		}
+	}
+	if opts.Terraform != "" && !opts.DryRun {
+		zone.Terraform = NewTerraformExport(opts.Terraform, opts.RunID)
+		cleanups = append(cleanups, zone.Terraform.Close)
+	}
+	if opts.ExternalDNS != "" && !opts.DryRun {
+		zone.ExternalDNS = NewExternalDNSExport(opts.ExternalDNS, opts.ExternalDNSKind)
+		cleanups = append(cleanups, zone.ExternalDNS.Close)
 	}
 
-	log.Printf("✅✅ DONE ✅✅")
-}
-
-// CreateHostedZone creates a private hosted zone with an unique name in the format: floodzone-test-<UUID>.aws
-// The hosted zone ID is returned.
-func (z Zone) CreatePrivateHostedZone(ctx context.Context, vpcID string, region string) (string, error) {
-	hzOut, err := z.R53.CreateHostedZone(ctx, &route53.CreateHostedZoneInput{
-		Name:            aws.String(fmt.Sprintf("floodzone-test-%s.aws", uuid.NewString())),
-		CallerReference: aws.String(fmt.Sprint(time.Now().Unix())),
-		HostedZoneConfig: &types.HostedZoneConfig{
-			PrivateZone: true,
-			Comment:     aws.String(fmt.Sprintf("Created by floodzone at %s", time.Now().UTC())),
-		},
-		VPC: &types.VPC{
-			VPCId:     aws.String(vpcID),
-			VPCRegion: types.VPCRegion(region),
-		},
-	})
+	if opts.MaxCost > 0 && !opts.DryRun {
+		var plans []executionPlan
+		for _, runOpts := range runs {
+			plan, err := cmd.plan(ctx, zone, runOpts)
+			if err != nil {
+				fatal(exitCode(err, runSummary{}), "unable to estimate the cost of the run", "command", cmd.name, "error", err)
+			}
+			plans = append(plans, plan)
+		}
+		if zone.Budget, err = NewCostBudget(opts.MaxCost, plans); err != nil {
+			fatal(exitConfig, "refusing to start the run", "command", cmd.name, "error", err)
+		}
+	}
+	if opts.DryRun {
+		for _, runOpts := range runs {
+			plan, err := cmd.plan(ctx, zone, runOpts)
+			if err != nil {
+				fatal(exitCode(err, runSummary{}), "unable to plan command", "command", cmd.name, "error", err)
+			}
+			if err := printOutput(opts.Output, plan); err != nil {
+				fatal(exitError, "unable to print plan", "error", err)
+			}
+		}
+		return
+	}
+	// an interrupt cancels the run so that it's still summarized and reported as aborted, a second one exits immediately
+	runCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-runCtx.Done()
+		stop()
+	}()
+	runCtx = zone.Alarms.Watch(runCtx)
+	runCtx = zone.Budget.Watch(runCtx)
+	runCtx = zone.ErrorBudget.Watch(runCtx, zone.notify)
+	runCtx = zone.TUI.Start(runCtx)
+	cleanups = append(cleanups, zone.TUI.Close)
+	runCtx = zone.Web.Start(runCtx)
+	zone.notify(ctx, newEvent(eventStarted, cmd.name, opts.RunID))
+	for _, runOpts := range runs {
+		if err := cmd.run(runCtx, zone, runOpts); err != nil {
+			// report the alarm or the budget that aborted the run rather than the canceled API call
+			var alarmErr *alarmError
+			var errorBudgetErr *errorBudgetError
+			if errors.As(context.Cause(runCtx), &alarmErr) {
+				err = alarmErr
+			} else if budgetErr := budgetCause(runCtx); budgetErr != nil {
+				err = budgetErr
+			} else if errors.As(context.Cause(runCtx), &errorBudgetErr) {
+				err = errorBudgetErr
+			}
+			cleanup()
+			// the run already failed, the assertions are only checked for the summary
+			_ = zone.Stats.CheckAssertions(opts.Assertions)
+			writeSummary(cmd, opts, zone, err)
+			recordHistory(cmd, opts, zone, err)
+			zone.notify(ctx, newRunEvent(runResult(cmd, zone, err), err))
+			fatal(exitCode(err, zone.Stats.Summary(cmd.name)), "Error when running command", "command", cmd.name, "error", err)
+		}
+	}
+	zone.Checkpoint.Complete()
+	cleanup()
+	err = zone.Stats.CheckAssertions(opts.Assertions)
+	if err == nil {
+		slog.Info("✅✅ DONE ✅✅")
+	}
+	if cmd.summary {
+		if err := printOutput(opts.Output, zone.Stats.Summary(cmd.name)); err != nil {
+			fatal(exitError, "unable to print run summary", "error", err)
+		}
+	}
+	writeSummary(cmd, opts, zone, err)
+	recordHistory(cmd, opts, zone, err)
+	zone.notify(ctx, newRunEvent(runResult(cmd, zone, err), err))
 	if err != nil {
-		return "", err
+		fatal(exitCode(err, zone.Stats.Summary(cmd.name)), "Run failed its assertions", "command", cmd.name, "error", err)
 	}
-	return *hzOut.HostedZone.Id, err
 }
 
-// DeleteResourceRecordSets deletes the desired number of Resource Record Sets in controlled batches and returns the
-// remaining resource record sets in the zone excluding SOA and NS records.
-func (z Zone) DeleteResourceRecordSets(ctx context.Context, hostedZone *types.HostedZone, maxBatchSize int, desiredDeletions int, batchDelay time.Duration) (int, error) {
-	rrs, err := z.ListResourceRecordSets(ctx, hostedZone, maxBatchSize)
-	if err != nil {
-		return 0, err
-	}
-	currentRRS := len(rrs)
-	deletedRecords := 0
-	totalRecordsToDelete := len(rrs)
-	if desiredDeletions < len(rrs) {
-		totalRecordsToDelete = desiredDeletions
-	}
-	for deletedRecords < totalRecordsToDelete {
-		var changes []types.Change
-		for i := 0; i < len(rrs) && i < maxBatchSize; i++ {
-			changes = append(changes, types.Change{
-				Action:            types.ChangeActionDelete,
-				ResourceRecordSet: &rrs[i],
-			})
-		}
-		_, err := z.R53.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
-			HostedZoneId: hostedZone.Id,
-			ChangeBatch: &types.ChangeBatch{
-				Changes: changes,
-			},
-		})
-		if err != nil {
-			return 0, err
-		}
-		rrs = rrs[len(changes):]
-		deletedRecords += len(changes)
-		log.Printf("✅ Executed batch of %d Delete Resource Record Sets on %s   %d/%d  - Sleeping for %s\n", len(changes), *hostedZone.Id, deletedRecords, totalRecordsToDelete, batchDelay)
-		if deletedRecords != totalRecordsToDelete {
-			time.Sleep(batchDelay)
-		}
+// runResult returns the summary of the run including the error the command failed with
+func runResult(cmd command, zone Zone, runErr error) runSummary {
+	summary := zone.Stats.Summary(cmd.name)
+	if runErr != nil {
+		summary.Error = runErr.Error()
+		summary.ExitCode = exitCode(runErr, summary)
 	}
-	return currentRRS - totalRecordsToDelete, nil
+	return summary
 }
 
-func (z Zone) ListResourceRecordSets(ctx context.Context, hostedZone *types.HostedZone, maxBatchSize int) ([]types.ResourceRecordSet, error) {
-	var rrs []types.ResourceRecordSet
-	var nextRecordName *string
-	for {
-		rrsOut, err := z.R53.ListResourceRecordSets(ctx, &route53.ListResourceRecordSetsInput{
-			HostedZoneId:    hostedZone.Id,
-			MaxItems:        aws.Int32(int32(maxBatchSize)),
-			StartRecordName: nextRecordName,
-		})
-		if err != nil {
-			return rrs, err
+// writeSummary writes the run summary file, HTML report, and JUnit report if they were requested, including the error
+// the command failed with
+func writeSummary(cmd command, opts Options, zone Zone, runErr error) {
+	if opts.SummaryFile == "" && opts.HTMLReport == "" && opts.JUnitReport == "" {
+		return
+	}
+	summary := runResult(cmd, zone, runErr)
+	if opts.SummaryFile != "" {
+		if err := writeSummaryFile(context.Background(), zone.Artifacts, opts.SummaryFile, summary); err != nil {
+			slog.Error("unable to write run summary file", "error", err)
 		}
-		for _, rr := range rrsOut.ResourceRecordSets {
-			if rr.Type == types.RRTypeSoa || rr.Type == types.RRTypeNs {
-				continue
-			}
-			rrs = append(rrs, rr)
+	}
+	if opts.HTMLReport != "" {
+		if err := writeHTMLReport(opts.HTMLReport, summary, zone.Stats.Timeline(), opts); err != nil {
+			slog.Error("unable to write HTML report", "error", err)
 		}
-		if !rrsOut.IsTruncated {
-			break
+	}
+	if opts.JUnitReport != "" {
+		if err := writeJUnitReport(opts.JUnitReport, summary); err != nil {
+			slog.Error("unable to write JUnit report", "error", err)
 		}
-		nextRecordName = rrsOut.NextRecordName
 	}
-	return rrs, nil
 }
 
-func (z Zone) CreateResourceRecordSets(ctx context.Context, hostedZone *types.HostedZone,
-	currentRRSetCount int, desiredRecords int, maxBatchSize int, batchDelay time.Duration) error {
-	for currentRRSetCount < desiredRecords {
-		batchSize := maxBatchSize
-		if (desiredRecords - currentRRSetCount) < maxBatchSize {
-			batchSize = desiredRecords - currentRRSetCount
-		}
-		_, err := z.R53.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
-			HostedZoneId: hostedZone.Id,
-			ChangeBatch: &types.ChangeBatch{
-				Changes: createChangeBatch(*hostedZone.Name, batchSize),
-			},
-		})
-		if err != nil {
-			return err
+// newFlagSet creates the FlagSet for a command, including the global flags if the command calls AWS
+func newFlagSet(cmd command, opts *Options, global *globalFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "%s\n\nUsage of floodzone %s:\n", cmd.description, cmd.name)
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\nEvery flag can also be set with a %s<FLAG> environment variable, e.g. %s\n", envPrefix, envName("hosted-zone-id"))
+	}
+	if cmd.flags != nil {
+		cmd.flags(fs, opts)
+	}
+	fs.StringVar(&opts.LogLevel, "log-level", "info", "Log level: debug, info, warn, or error")
+	fs.StringVar(&opts.LogFormat, "log-format", "text", "Log format: text or json")
+	for _, name := range []string{"q", "quiet"} {
+		fs.BoolVar(&opts.Quiet, name, false, "Only log errors and don't print zone descriptions")
+	}
+	for _, name := range []string{"v", "verbose"} {
+		fs.BoolVar(&opts.Verbose, name, false, "Log the full request and response of every batch")
+	}
+	fs.BoolVar(&opts.NoColor, "no-color", false, "Don't use ANSI escape codes in output (always on when stdout is not a terminal)")
+	fs.BoolVar(&opts.NoEmoji, "no-emoji", false, "Strip emoji from output (always on when stdout is not a terminal)")
+	if cmd.run != nil {
+		outputFlag(fs, opts)
+		if cmd.plan != nil {
+			fs.BoolVar(&opts.DryRun, "dry-run", false, "Print the batches, API calls, estimated duration, and estimated cost of the run without changing anything")
+			fs.DurationVar(&opts.CostLifetime, "cost-lifetime", defaultCostLifetime, "How long the zones, health checks, and traffic policy instances of the run are expected to exist until they're cleaned up, to prorate their monthly charges in the --dry-run cost estimate")
+			fs.Float64Var(&opts.MaxCost, "max-cost", 0, "Refuse to start the run when its estimated cost is over this many USD, and stop it once the queries it sends take its cost over, 0 for no budget")
 		}
-		currentRRSetCount += batchSize
-		log.Printf("✅ Executed batch of %d Create Resource Record Sets on %s. %d/%d  - Sleeping for %s\n", batchSize, *hostedZone.Id, currentRRSetCount, desiredRecords, batchDelay)
-		if currentRRSetCount != desiredRecords {
-			time.Sleep(batchDelay)
+		fs.StringVar(&opts.SummaryFile, "summary-file", "", "Local path or s3://bucket/key URI to write a JSON summary of the run to, even if the run fails")
+		fs.StringVar(&opts.Artifacts, "artifacts", "", "Local directory or s3://bucket/prefix URI to keep the summary, manifest, and checkpoint of the run in, in a folder per run ID")
+		fs.StringVar(&opts.S3SSE, "s3-sse", "", "Server-side encryption of the objects floodzone writes to S3: AES256, aws:kms, or aws:kms:dsse, defaults to the bucket's")
+		fs.StringVar(&opts.S3KMSKeyID, "s3-kms-key-id", "", "KMS key to encrypt the objects floodzone writes to S3 with, for --s3-sse aws:kms, defaults to the AWS managed key")
+		fs.BoolVar(&opts.LogRequestIDs, "log-request-ids", false, "Log the request ID of every AWS API call, not only the failed ones")
+		fs.StringVar(&opts.AuditLog, "audit-log", "", "Path to write a JSON line per Route 53 API call to, with its request ID, status, latency, and retries")
+		fs.StringVar(&opts.CoordinationTable, "coordination-table", "", "DynamoDB table to lock every zone the run changes in, so that two runs never change the same zone, with a string partition key named pk")
+		fs.DurationVar(&opts.LockWait, "lock-wait", 0, "How long to wait for a zone another run holds the lock of in --coordination-table before failing")
+		fs.IntVar(&opts.SharedRateLimit, "shared-rate-limit", 0, "Route 53 API calls per second that all the runs and workers sharing --coordination-table make together, 0 for no shared limit")
+		fs.StringVar(&opts.Endpoint, "endpoint", "", "Route 53 API endpoint to use")
+		fs.BoolVar(&opts.LocalStack, "localstack", false, fmt.Sprintf("Call every AWS API on LocalStack at --endpoint, defaulting to %s, turned on when --endpoint is on port %s or a localstack host", defaultLocalStackEndpoint, localStackPort))
+		fs.StringVar(&opts.OTLPEndpoint, "otlp-endpoint", "", "OTLP/HTTP endpoint to export traces of every AWS API call to, e.g. http://localhost:4318 (or set OTEL_EXPORTER_OTLP_ENDPOINT)")
+		fs.StringVar(&opts.AppID, "app-id", "floodzone", "App ID to add to the User-Agent of every AWS API call")
+		fs.StringVar(&opts.RunID, "run-id", "", "Run ID to add to the User-Agent of every AWS API call, defaults to a random UUID")
+		fs.BoolVar(&opts.UseFIPS, "use-fips", false, "Use FIPS endpoints, e.g. in GovCloud")
+		fs.BoolVar(&opts.UseDualStack, "use-dualstack", false, "Use dual-stack endpoints that are reachable over IPv6")
+		fs.DurationVar(&opts.HTTPTimeout, "http-timeout", 0, "Timeout of each HTTP request to AWS, 0 uses the SDK default of no timeout")
+		fs.StringVar(&opts.ProxyURL, "proxy-url", "", "HTTP proxy to send AWS API calls through, defaults to the HTTPS_PROXY environment variable")
+		fs.IntVar(&opts.MaxIdleConns, "max-idle-conns", 0, "Max idle connections to keep open to AWS, 0 uses the SDK default")
+		fs.StringVar(&global.region, "region", "", "AWS Region")
+		fs.StringVar(&global.profile, "profile", "", "AWS shared config profile to use instead of AWS_PROFILE")
+		fs.StringVar(&global.assumeRoleARN, "assume-role-arn", "", "ARN of an IAM role to assume before calling Route 53, e.g. for zones in another account")
+		fs.StringVar(&global.externalID, "external-id", "", "External ID to pass when assuming --assume-role-arn")
+		fs.StringVar(&global.roleSessionName, "role-session-name", defaultRoleSessionName, "Session name to use when assuming --assume-role-arn")
+		fs.StringVar(&global.configPath, "config", "", "Path to a YAML or JSON config file, flags override values in the file")
+	}
+	return fs
+}
+
+func lookupCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
 		}
 	}
-	return nil
+	return command{}, false
 }
 
-func createChangeBatch(hzName string, batchSize int) []types.Change {
-	var changes []types.Change
-	for i := 0; i < batchSize; i++ {
-		changes = append(changes, types.Change{
-			Action: types.ChangeActionCreate,
-			ResourceRecordSet: &types.ResourceRecordSet{
-				Name: aws.String(fmt.Sprintf("%s.%s", uuid.NewString(), hzName)),
-				Type: types.RRTypeA,
-				TTL:  aws.Int64(300),
-				ResourceRecords: []types.ResourceRecord{
-					{
-						Value: aws.String("127.0.0.1"),
-					},
-				},
-			},
-		})
+// flagSet returns true if the flag was explicitly set on the command line
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func usage() {
+	fmt.Println("floodzone creates and populates Route 53 Private Hosted Zones with resource record sets for testing purposes.")
+	fmt.Println()
+	fmt.Println("Usage: floodzone <command> [flags]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	width := 0
+	for _, cmd := range commands {
+		width = max(width, len(cmd.name))
+	}
+	for _, cmd := range commands {
+		fmt.Printf("  %-*s %s\n", width, cmd.name, cmd.description)
 	}
-	return changes
+	fmt.Println()
+	fmt.Println(`Run "floodzone <command> --help" for the flags of a command.`)
 }
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// recordManifest lists the record sets a run created or upserted
+type recordManifest struct {
+	RunID   string           `json:"runId"`
+	Command string           `json:"command"`
+	Records []manifestRecord `json:"records"`
+}
+
+type manifestRecord struct {
+	HostedZoneID string `json:"hostedZoneId"`
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	// Values are the values the record set was last written with, and WrittenAt is when, manifests written before
+	// values were recorded don't have them
+	Values    []string   `json:"values,omitempty"`
+	WrittenAt *time.Time `json:"writtenAt,omitempty"`
+	// Blocked record sets are blocked by a DNS Firewall rule, a query for one succeeds when it's answered NXDOMAIN
+	Blocked bool `json:"blocked,omitempty"`
+}
+
+// Manifest collects the record sets created or upserted during a run with the values they were last written with, and
+// writes them to a local file or an s3:// URI when closed, so later tools can operate on exactly those records instead
+// of listing the zone. With an interval it's also written while the run goes on, so that a query run can follow the
+// values a churn run writes. A nil Manifest is a no-op.
+type Manifest struct {
+	mu        sync.Mutex
+	dest      string
+	artifacts *Artifacts
+	manifest  recordManifest
+	// index is the position of every record set in the manifest
+	index map[writtenRecord]int
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewManifest returns a Manifest written to dest with the artifacts of the run, and every interval until it's closed
+// if interval isn't 0
+func NewManifest(dest string, artifacts *Artifacts, command string, runID string, interval time.Duration) *Manifest {
+	m := &Manifest{
+		dest:      dest,
+		artifacts: artifacts,
+		manifest:  recordManifest{RunID: runID, Command: command, Records: []manifestRecord{}},
+		index:     map[writtenRecord]int{},
+	}
+	if interval > 0 {
+		m.stop, m.done = make(chan struct{}), make(chan struct{})
+		go m.writeEvery(interval)
+	}
+	return m
+}
+
+// RecordBatch records the record sets created or upserted by a successful change batch with their values
+func (m *Manifest) RecordBatch(hostedZoneID string, changes []types.Change) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hostedZoneID = strings.TrimPrefix(hostedZoneID, "/hostedzone/")
+	now := time.Now()
+	for _, change := range changes {
+		rr := change.ResourceRecordSet
+		if change.Action == types.ChangeActionDelete || rr == nil {
+			continue
+		}
+		record := manifestRecord{HostedZoneID: hostedZoneID, Name: aws.ToString(rr.Name), Type: string(rr.Type), WrittenAt: &now}
+		for _, value := range rr.ResourceRecords {
+			record.Values = append(record.Values, aws.ToString(value.Value))
+		}
+		key := writtenKey(hostedZoneID, *rr)
+		if i, ok := m.index[key]; ok {
+			m.manifest.Records[i] = record
+			continue
+		}
+		m.index[key] = len(m.manifest.Records)
+		m.manifest.Records = append(m.manifest.Records, record)
+	}
+}
+
+// RecordFirewall records a record set of a zone DNS Firewall filters, blocked if a BLOCK rule's domain list has its
+// name, so that a query run from a VPC the rules are associated with can check the firewall filters it as expected
+func (m *Manifest) RecordFirewall(hostedZoneID string, rr types.ResourceRecordSet, blocked bool) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hostedZoneID = strings.TrimPrefix(hostedZoneID, "/hostedzone/")
+	record := manifestRecord{HostedZoneID: hostedZoneID, Name: aws.ToString(rr.Name), Type: string(rr.Type), Blocked: blocked}
+	for _, value := range rr.ResourceRecords {
+		record.Values = append(record.Values, aws.ToString(value.Value))
+	}
+	key := writtenKey(hostedZoneID, rr)
+	if i, ok := m.index[key]; ok {
+		m.manifest.Records[i] = record
+		return
+	}
+	m.index[key] = len(m.manifest.Records)
+	m.manifest.Records = append(m.manifest.Records, record)
+}
+
+// Resume keeps the record sets of the manifest already at its destination, so that the manifest of a run resumed from
+// a checkpoint lists the record sets written before it was restarted too
+func (m *Manifest) Resume(ctx context.Context) error {
+	if m == nil {
+		return nil
+	}
+	previous, err := readManifest(ctx, m.artifacts, m.dest)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, record := range previous.Records {
+		key := writtenKey(record.HostedZoneID, types.ResourceRecordSet{Name: aws.String(record.Name), Type: types.RRType(record.Type)})
+		if _, ok := m.index[key]; ok {
+			continue
+		}
+		m.index[key] = len(m.manifest.Records)
+		m.manifest.Records = append(m.manifest.Records, record)
+	}
+	return nil
+}
+
+// writeEvery writes the manifest every interval until the manifest is closed
+func (m *Manifest) writeEvery(interval time.Duration) {
+	defer close(m.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			if err := m.write(context.Background()); err != nil {
+				slog.Warn("unable to write the record manifest", "dest", m.dest, "error", err)
+			}
+		}
+	}
+}
+
+// Close writes the manifest. Failures are only logged so that a failed run still reports its own error.
+func (m *Manifest) Close(ctx context.Context) {
+	if m == nil {
+		return
+	}
+	if m.stop != nil {
+		close(m.stop)
+		<-m.done
+	}
+	if err := m.write(ctx); err != nil {
+		slog.Error("unable to write the record manifest", "dest", m.dest, "error", err)
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	slog.Info("📜 Wrote the record manifest", "dest", m.dest, "records", len(m.manifest.Records))
+}
+
+// write writes the manifest to its destination. A local file is replaced with a rename so that a query run reading
+// it while it's written never sees half of it.
+func (m *Manifest) write(ctx context.Context) error {
+	m.mu.Lock()
+	data, err := json.MarshalIndent(m.manifest, "", "    ")
+	m.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("unable to marshal the record manifest: %w", err)
+	}
+	if err := m.artifacts.Write(ctx, m.dest, append(data, '\n'), "application/json"); err != nil {
+		return fmt.Errorf("unable to write the record manifest: %w", err)
+	}
+	return nil
+}
+
+// readManifest reads a manifest written by --manifest from a local file or an s3:// URI
+func readManifest(ctx context.Context, artifacts *Artifacts, src string) (recordManifest, error) {
+	var manifest recordManifest
+	data, err := artifacts.Read(ctx, src)
+	if err != nil {
+		return manifest, fmt.Errorf("unable to read the record manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("unable to parse the record manifest %s: %w", src, err)
+	}
+	return manifest, nil
+}
+
+// parseS3URI returns the bucket and key of an s3://bucket/key URI, ok is false if uri isn't an s3:// URI
+func parseS3URI(uri string) (bucket string, key string, ok bool) {
+	if !strings.HasPrefix(uri, "s3://") {
+		return "", "", false
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", "", true
+	}
+	return u.Host, strings.TrimPrefix(u.Path, "/"), true
+}
+
+// validateManifest validates the destination of the record manifest and how often it's written
+func validateManifest(opts Options) error {
+	var errs []error
+	errs = append(errs, validateManifestURI("--manifest", opts.Manifest))
+	if opts.ManifestInterval < 0 {
+		errs = append(errs, fmt.Errorf("--manifest-interval must be at least 0, got %s", opts.ManifestInterval))
+	} else if opts.ManifestInterval > 0 && opts.Manifest == "" {
+		errs = append(errs, errors.New("--manifest-interval needs --manifest"))
+	}
+	return errors.Join(errs...)
+}
+
+// validateManifestURI validates the local path or s3://bucket/key URI of a manifest set by the flag name
+func validateManifestURI(name string, uri string) error {
+	if bucket, key, ok := parseS3URI(uri); ok && (bucket == "" || key == "" || strings.HasSuffix(key, "/")) {
+		return fmt.Errorf("%s must be a local path or an s3://bucket/key URI, got %q", name, uri)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/aws/smithy-go/middleware"
+)
+
+const (
+	defaultMetricsNamespace = "Floodzone"
+	// metricsFlushInterval is how often buffered metrics are published, well under the 1 minute CloudWatch period
+	metricsFlushInterval = 20 * time.Second
+	// maxMetricDataPerCall is the most metric data CloudWatch accepts in one PutMetricData call
+	maxMetricDataPerCall = 1_000
+)
+
+// MetricsPublisher buffers a datum per change batch and publishes them to CloudWatch in the background, so the flood
+// can be graphed next to the metrics of the services it stresses. A nil MetricsPublisher is a no-op.
+type MetricsPublisher struct {
+	mu        sync.Mutex
+	client    *cloudwatch.Client
+	namespace string
+	data      []cwtypes.MetricDatum
+	stop      chan struct{}
+	stopped   chan struct{}
+}
+
+// NewMetricsPublisher starts publishing metrics to the namespace until Close is called
+func NewMetricsPublisher(client *cloudwatch.Client, namespace string) *MetricsPublisher {
+	m := &MetricsPublisher{
+		client:    client,
+		namespace: namespace,
+		stop:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go func() {
+		defer close(m.stopped)
+		ticker := time.NewTicker(metricsFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.flush(context.Background())
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+	return m
+}
+
+// RecordBatch records the changes, latency, and error of a change batch. Errors is recorded as 0 or 1 for every batch
+// so its average is the error rate.
+func (m *MetricsPublisher) RecordBatch(hostedZoneID string, changes []types.Change, latency time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	now := time.Now()
+	zone := cwtypes.Dimension{Name: aws.String("HostedZoneId"), Value: aws.String(hostedZoneID)}
+	errors := 0.0
+	if err != nil {
+		errors = 1
+	}
+	data := []cwtypes.MetricDatum{
+		{
+			MetricName: aws.String("BatchLatency"),
+			Dimensions: []cwtypes.Dimension{zone},
+			Timestamp:  &now,
+			Unit:       cwtypes.StandardUnitMilliseconds,
+			Value:      aws.Float64(milliseconds(latency)),
+		},
+		{
+			MetricName: aws.String("Errors"),
+			Dimensions: []cwtypes.Dimension{zone},
+			Timestamp:  &now,
+			Unit:       cwtypes.StandardUnitCount,
+			Value:      aws.Float64(errors),
+		},
+	}
+	if err == nil && len(changes) > 0 {
+		// the sum of Changes per period is the change rate
+		data = append(data, cwtypes.MetricDatum{
+			MetricName: aws.String("Changes"),
+			Dimensions: []cwtypes.Dimension{zone, {Name: aws.String("Action"), Value: aws.String(string(changes[0].Action))}},
+			Timestamp:  &now,
+			Unit:       cwtypes.StandardUnitCount,
+			Value:      aws.Float64(float64(len(changes))),
+		})
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data = append(m.data, data...)
+}
+
+// route53Option adds a middleware to the Route 53 client that publishes the throttled attempts of every change batch,
+// including the ones that succeeded after retrying
+func (m *MetricsPublisher) route53Option(o *route53.Options) {
+	if m == nil {
+		return
+	}
+	o.APIOptions = append(o.APIOptions, m.throttlesMiddleware)
+}
+
+func (m *MetricsPublisher) throttlesMiddleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("FloodzoneThrottleMetrics", func(ctx context.Context, in middleware.InitializeInput,
+		next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		out, metadata, err := next.HandleInitialize(ctx, in)
+		input, ok := in.Parameters.(*route53.ChangeResourceRecordSetsInput)
+		if !ok {
+			return out, metadata, err
+		}
+		throttles := 0
+		if results, ok := retry.GetAttemptResults(metadata); ok {
+			for _, result := range results.Results {
+				if result.Err != nil && classifyError(result.Err) == errorClassThrottling {
+					throttles++
+				}
+			}
+		}
+		now := time.Now()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.data = append(m.data, cwtypes.MetricDatum{
+			MetricName: aws.String("Throttles"),
+			Dimensions: []cwtypes.Dimension{{Name: aws.String("HostedZoneId"), Value: input.HostedZoneId}},
+			Timestamp:  &now,
+			Unit:       cwtypes.StandardUnitCount,
+			Value:      aws.Float64(float64(throttles)),
+		})
+		return out, metadata, err
+	}), middleware.After)
+}
+
+// Close stops the background publishing and publishes whatever is still buffered
+func (m *MetricsPublisher) Close(ctx context.Context) {
+	if m == nil {
+		return
+	}
+	close(m.stop)
+	<-m.stopped
+	m.flush(ctx)
+}
+
+// flush publishes the buffered metrics. Failures are only logged since metrics shouldn't fail the run.
+func (m *MetricsPublisher) flush(ctx context.Context) {
+	m.mu.Lock()
+	data := m.data
+	m.data = nil
+	m.mu.Unlock()
+	for len(data) > 0 {
+		n := min(len(data), maxMetricDataPerCall)
+		if _, err := m.client.PutMetricData(ctx, &cloudwatch.PutMetricDataInput{
+			Namespace:  aws.String(m.namespace),
+			MetricData: data[:n],
+		}); err != nil {
+			slog.Warn("unable to publish metrics to CloudWatch", "namespace", m.namespace, "error", err)
+		}
+		data = data[n:]
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+// Run lifecycle event types
+const (
+	eventStarted   = "started"
+	eventMilestone = "milestone"
+	eventCompleted = "completed"
+	eventFailed    = "failed"
+	eventAborted   = "aborted"
+	// eventErrorBudget is sent once the throttled and failed change batch attempts of the run reach --max-errors
+	eventErrorBudget = "error-budget"
+)
+
+// maxSNSSubjectLength is the longest subject SNS accepts
+const maxSNSSubjectLength = 100
+
+// runEvent is a structured notification about the lifecycle of a run
+type runEvent struct {
+	Source  string    `json:"source"`
+	Event   string    `json:"event"`
+	Command string    `json:"command"`
+	RunID   string    `json:"runId"`
+	Time    time.Time `json:"time"`
+	// Milestone is the progress of the run for milestone events
+	Milestone *milestone `json:"milestone,omitempty"`
+	// ErrorBudget is how many change batch attempts were throttled or failed for error-budget events
+	ErrorBudget *errorBudgetStatus `json:"errorBudget,omitempty"`
+	// Summary is the outcome of the run once it finished
+	Summary *runSummary `json:"summary,omitempty"`
+}
+
+// milestone is how far an operation of the run has gotten
+type milestone struct {
+	Action  string `json:"action"`
+	Done    int    `json:"done"`
+	Total   int    `json:"total"`
+	Percent int    `json:"percent"`
+}
+
+func newEvent(event string, command string, runID string) runEvent {
+	return runEvent{
+		Source:  "floodzone",
+		Event:   event,
+		Command: command,
+		RunID:   runID,
+		Time:    time.Now().UTC(),
+	}
+}
+
+// newRunEvent returns the event for a run that finished with runErr, where a run cancelled by an interrupt is aborted
+func newRunEvent(summary runSummary, runErr error) runEvent {
+	event := eventCompleted
+	if errors.Is(runErr, context.Canceled) {
+		event = eventAborted
+	} else if runErr != nil {
+		event = eventFailed
+	}
+	e := newEvent(event, summary.Command, summary.RunID)
+	e.Summary = &summary
+	return e
+}
+
+// text describes the event in a single line for chat messages and email subjects
+func (e runEvent) text() string {
+	text := fmt.Sprintf("floodzone %s %s", e.Command, e.Event)
+	switch {
+	case e.Milestone != nil:
+		text = fmt.Sprintf("floodzone %s: %s %d%% (%d/%d)", e.Command, e.Milestone.Action, e.Milestone.Percent, e.Milestone.Done, e.Milestone.Total)
+	case e.ErrorBudget != nil:
+		text += fmt.Sprintf(": %d change batch attempts throttled or failed, reaching the --max-errors of %d", e.ErrorBudget.Errors, e.ErrorBudget.MaxErrors)
+	case e.Summary != nil && e.Summary.Error != "":
+		text += fmt.Sprintf(" after %.1fs: %s", e.Summary.DurationSeconds, e.Summary.Error)
+	case e.Summary != nil:
+		text += fmt.Sprintf(" in %.1fs: %d created, %d deleted, %d upserted, %d batches, %d errors",
+			e.Summary.DurationSeconds, e.Summary.Created, e.Summary.Deleted, e.Summary.Upserted, e.Summary.Batches, e.Summary.Errors)
+	}
+	return text
+}
+
+// notify sends a run event to every notifier that's set
+func (z Zone) notify(ctx context.Context, event runEvent) {
+	z.SNS.Notify(ctx, event)
+	z.Webhook.Notify(ctx, event)
+	z.EventBridge.Notify(ctx, event)
+	z.Hooks.Notify(ctx, event)
+}
+
+// SNSNotifier publishes run events to an SNS topic so that long unattended runs can page someone. A nil SNSNotifier
+// is a no-op.
+type SNSNotifier struct {
+	client   *sns.Client
+	topicARN string
+}
+
+func NewSNSNotifier(client *sns.Client, topicARN string) *SNSNotifier {
+	return &SNSNotifier{client: client, topicARN: topicARN}
+}
+
+// Notify publishes the event as JSON with an "event" message attribute for subscription filter policies. Failures are
+// only logged since a notification shouldn't change the outcome of the run.
+func (n *SNSNotifier) Notify(ctx context.Context, event runEvent) {
+	if n == nil {
+		return
+	}
+	message, err := json.MarshalIndent(event, "", "    ")
+	if err != nil {
+		slog.Warn("unable to marshal SNS notification", "error", err)
+		return
+	}
+	subject := fmt.Sprintf("floodzone %s %s", event.Command, event.Event)
+	if event.Summary != nil && event.Summary.Error != "" {
+		subject += ": " + event.Summary.Error
+	}
+	// subjects must be printable ASCII on a single line
+	subject = strings.Map(func(r rune) rune {
+		if r < ' ' || r > '~' {
+			return ' '
+		}
+		return r
+	}, subject)
+	if len(subject) > maxSNSSubjectLength {
+		subject = subject[:maxSNSSubjectLength-3] + "..."
+	}
+	if _, err := n.client.Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(n.topicARN),
+		Subject:  aws.String(subject),
+		Message:  aws.String(string(message)),
+		MessageAttributes: map[string]snstypes.MessageAttributeValue{
+			"event": {DataType: aws.String("String"), StringValue: aws.String(event.Event)},
+		},
+	}); err != nil {
+		slog.Warn("unable to publish SNS notification", "topic", n.topicARN, "error", err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53resolver"
+)
+
+// outboundEndpointResult is the output of the outbound-endpoint command
+type outboundEndpointResult struct {
+	Endpoint  string   `json:"endpoint" yaml:"endpoint"`
+	VPC       string   `json:"vpc" yaml:"vpc"`
+	Addresses []string `json:"addresses" yaml:"addresses"`
+}
+
+func (r outboundEndpointResult) writeTable(w io.Writer) {
+	fmt.Fprintln(w, "ENDPOINT\tVPC\tADDRESSES")
+	fmt.Fprintf(w, "%s\t%s\t%s\n", r.Endpoint, r.VPC, strings.Join(r.Addresses, ","))
+}
+
+// runOutboundEndpoint creates an outbound endpoint for the forwarding rules of query-path scenarios. It's left running
+// for the scenarios to use, and cleanup deletes it with the zone.
+func runOutboundEndpoint(ctx context.Context, zone Zone, opts Options) error {
+	hz, err := describeZone(ctx, zone, opts)
+	if err != nil {
+		return err
+	}
+	endpointID, err := zone.CreateOutboundEndpoint(ctx, splitList(opts.OutboundSubnets), splitList(opts.OutboundSecGroups))
+	if err != nil {
+		if endpointID != "" {
+			if err := zone.DeleteResolverEndpoint(context.WithoutCancel(ctx), endpointID); err != nil {
+				slog.Error("unable to clean up outbound endpoint, it must be deleted manually", "endpoint", endpointID, "error", err)
+			}
+		}
+		return err
+	}
+	out, err := zone.R53Resolver.GetResolverEndpoint(ctx, &route53resolver.GetResolverEndpointInput{ResolverEndpointId: &endpointID})
+	if err != nil {
+		return fmt.Errorf("unable to describe resolver endpoint %s: %w", endpointID, err)
+	}
+	vpcID := aws.ToString(out.ResolverEndpoint.HostVPCId)
+	associated := false
+	for _, vpc := range hz.VPCs {
+		if aws.ToString(vpc.VPCId) == vpcID && string(vpc.VPCRegion) == zone.Region {
+			associated = true
+		}
+	}
+	if !associated {
+		slog.Warn("the outbound endpoint's VPC isn't associated with the zone, cleanup won't delete it", "endpoint", endpointID, "vpc", vpcID)
+	}
+	addresses, err := zone.resolverEndpointAddresses(ctx, endpointID)
+	if err != nil {
+		return err
+	}
+	return printOutput(opts.Output, outboundEndpointResult{Endpoint: endpointID, VPC: vpcID, Addresses: addresses})
+}
+
+// validateOutboundEndpoint validates the flags of the outbound-endpoint command
+func validateOutboundEndpoint(opts Options) error {
+	var errs []error
+	errs = append(errs, requireZoneID(opts))
+	// Route 53 Resolver requires an IP address in at least two subnets for availability
+	if len(splitList(opts.OutboundSubnets)) < 2 {
+		errs = append(errs, errors.New("--outbound-endpoint-subnet-ids must list at least 2 subnets"))
+	}
+	if len(splitList(opts.OutboundSecGroups)) == 0 {
+		errs = append(errs, errors.New("--outbound-endpoint-security-group-ids is required"))
+	}
+	return errors.Join(errs...)
+}
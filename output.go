@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"gopkg.in/yaml.v3"
+)
+
+var outputFormats = []string{"table", "json", "yaml"}
+
+func outputFlag(fs *flag.FlagSet, opts *Options) {
+	fs.StringVar(&opts.Output, "output", "table", fmt.Sprintf("Output format of command results: %s", strings.Join(outputFormats, ", ")))
+}
+
+// tabular is implemented by command results to render themselves as a table for --output table
+type tabular interface {
+	writeTable(w io.Writer)
+}
+
+// printOutput writes a command result to stdout in the output format. Multiple results are written as a stream of JSON
+// values or YAML documents.
+func printOutput(format string, result tabular) error {
+	switch format {
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		result.writeTable(w)
+		return w.Flush()
+	case "json":
+		data, err := json.MarshalIndent(result, "", "    ")
+		if err != nil {
+			return fmt.Errorf("unable to marshal output: %w", err)
+		}
+		_, err = fmt.Println(string(data))
+		return err
+	case "yaml":
+		fmt.Println("---")
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		if err := enc.Encode(result); err != nil {
+			return fmt.Errorf("unable to marshal output: %w", err)
+		}
+		return enc.Close()
+	default:
+		return validOutputFormat(format)
+	}
+}
+
+func validOutputFormat(format string) error {
+	for _, f := range outputFormats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid output format %q, must be one of %s", format, strings.Join(outputFormats, ", "))
+}
+
+// zoneResult is the output of a hosted zone description
+type zoneResult struct {
+	ID         string      `json:"id" yaml:"id"`
+	Name       string      `json:"name" yaml:"name"`
+	Private    bool        `json:"private" yaml:"private"`
+	RecordSets int64       `json:"recordSets" yaml:"recordSets"`
+	VPCs       []vpcResult `json:"vpcs" yaml:"vpcs"`
+}
+
+type vpcResult struct {
+	ID     string `json:"id" yaml:"id"`
+	Region string `json:"region" yaml:"region"`
+}
+
+func newZoneResult(hz *route53.GetHostedZoneOutput) zoneResult {
+	result := zoneResult{
+		ID:         strings.TrimPrefix(aws.ToString(hz.HostedZone.Id), "/hostedzone/"),
+		Name:       aws.ToString(hz.HostedZone.Name),
+		RecordSets: aws.ToInt64(hz.HostedZone.ResourceRecordSetCount),
+		VPCs:       []vpcResult{},
+	}
+	if hz.HostedZone.Config != nil {
+		result.Private = hz.HostedZone.Config.PrivateZone
+	}
+	for _, vpc := range hz.VPCs {
+		result.VPCs = append(result.VPCs, vpcResult{ID: aws.ToString(vpc.VPCId), Region: string(vpc.VPCRegion)})
+	}
+	return result
+}
+
+func (r zoneResult) writeTable(w io.Writer) {
+	var vpcs []string
+	for _, vpc := range r.VPCs {
+		vpcs = append(vpcs, fmt.Sprintf("%s (%s)", vpc.ID, vpc.Region))
+	}
+	fmt.Fprintln(w, "ID\tNAME\tPRIVATE\tRECORD SETS\tVPCS")
+	fmt.Fprintf(w, "%s\t%s\t%t\t%d\t%s\n", r.ID, r.Name, r.Private, r.RecordSets, strings.Join(vpcs, ","))
+}
+
+// recordsResult is the output of the list command
+type recordsResult []recordResult
+
+type recordResult struct {
+	Name   string   `json:"name" yaml:"name"`
+	Type   string   `json:"type" yaml:"type"`
+	TTL    int64    `json:"ttl" yaml:"ttl"`
+	Values []string `json:"values" yaml:"values"`
+}
+
+func newRecordsResult(rrs []types.ResourceRecordSet) recordsResult {
+	result := recordsResult{}
+	for _, rr := range rrs {
+		result = append(result, newRecordResult(rr))
+	}
+	return result
+}
+
+func newRecordResult(rr types.ResourceRecordSet) recordResult {
+	values := []string{}
+	for _, r := range rr.ResourceRecords {
+		values = append(values, *r.Value)
+	}
+	if rr.AliasTarget != nil {
+		values = append(values, fmt.Sprintf("ALIAS %s", *rr.AliasTarget.DNSName))
+	}
+	return recordResult{Name: *rr.Name, Type: string(rr.Type), TTL: aws.ToInt64(rr.TTL), Values: values}
+}
+
+func (r recordsResult) writeTable(w io.Writer) {
+	fmt.Fprintln(w, "NAME\tTYPE\tTTL\tVALUES")
+	for _, rr := range r {
+		rr.writeRow(w)
+	}
+}
+
+func (r recordResult) writeRow(w io.Writer) {
+	fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", r.Name, r.Type, r.TTL, strings.Join(r.Values, ","))
+}
+
+// recordStream prints record sets as they're listed, in the same shape printOutput prints a recordsResult in, so that
+// the list command doesn't hold every record set of a large zone in memory. The table is flushed every flushEvery
+// rows, so its columns are aligned per page.
+type recordStream struct {
+	format     string
+	flushEvery int
+	rows       int
+	table      *tabwriter.Writer
+}
+
+func newRecordStream(format string, flushEvery int) *recordStream {
+	return &recordStream{format: format, flushEvery: flushEvery, table: tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)}
+}
+
+// Write prints a record set
+func (s *recordStream) Write(rr types.ResourceRecordSet) error {
+	record := newRecordResult(rr)
+	first := s.rows == 0
+	s.rows++
+	switch s.format {
+	case "table":
+		if first {
+			fmt.Fprintln(s.table, "NAME\tTYPE\tTTL\tVALUES")
+		}
+		record.writeRow(s.table)
+		if s.rows%s.flushEvery == 0 {
+			return s.table.Flush()
+		}
+		return nil
+	case "json":
+		data, err := json.MarshalIndent(record, "    ", "    ")
+		if err != nil {
+			return fmt.Errorf("unable to marshal output: %w", err)
+		}
+		separator := ",\n"
+		if first {
+			separator = "[\n"
+		}
+		_, err = fmt.Print(separator + "    " + string(data))
+		return err
+	case "yaml":
+		if first {
+			fmt.Println("---")
+		}
+		// a list of one record set at a time concatenates to the list of all of them
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		if err := enc.Encode([]recordResult{record}); err != nil {
+			return fmt.Errorf("unable to marshal output: %w", err)
+		}
+		return enc.Close()
+	default:
+		return validOutputFormat(s.format)
+	}
+}
+
+// Close finishes the output once every record set was written
+func (s *recordStream) Close() error {
+	switch {
+	case s.rows == 0:
+		return printOutput(s.format, recordsResult{})
+	case s.format == "table":
+		return s.table.Flush()
+	case s.format == "json":
+		_, err := fmt.Println("\n]")
+		return err
+	}
+	return nil
+}
+
+// reportResult is the output of the report command
+type reportResult struct {
+	Zone  string      `json:"zone" yaml:"zone"`
+	Types []typeCount `json:"types" yaml:"types"`
+	Total int         `json:"total" yaml:"total"`
+}
+
+type typeCount struct {
+	Type       string `json:"type" yaml:"type"`
+	RecordSets int    `json:"recordSets" yaml:"recordSets"`
+}
+
+func (r reportResult) writeTable(w io.Writer) {
+	fmt.Fprintln(w, "TYPE\tRECORD SETS")
+	for _, t := range r.Types {
+		fmt.Fprintf(w, "%s\t%d\n", t.Type, t.RecordSets)
+	}
+	fmt.Fprintf(w, "TOTAL\t%d\n", r.Total)
+}
+
+// runSummary is the outcome of all the change batches submitted by a command
+type runSummary struct {
+	Command         string         `json:"command" yaml:"command"`
+	RunID           string         `json:"runId" yaml:"runId"`
+	Zones           []string       `json:"zones" yaml:"zones"`
+	StartTime       time.Time      `json:"startTime" yaml:"startTime"`
+	EndTime         time.Time      `json:"endTime" yaml:"endTime"`
+	Created         int            `json:"created" yaml:"created"`
+	Deleted         int            `json:"deleted" yaml:"deleted"`
+	Upserted        int            `json:"upserted" yaml:"upserted"`
+	Batches         int            `json:"batches" yaml:"batches"`
+	Errors          int            `json:"errors" yaml:"errors"`
+	ErrorsByCode    map[string]int `json:"errorsByCode" yaml:"errorsByCode"`
+	DurationSeconds float64        `json:"durationSeconds" yaml:"durationSeconds"`
+	Latency         latencyStats   `json:"latency" yaml:"latency"`
+	// Propagation is how long the change batches took to be INSYNC, if it was measured
+	Propagation *latencyStats `json:"propagation,omitempty" yaml:"propagation,omitempty"`
+	// Resolvable is how long sampled record sets took to resolve to their new value, if it was measured
+	Resolvable *latencyStats `json:"resolvable,omitempty" yaml:"resolvable,omitempty"`
+	// ErrorClasses counts the errors of every API call attempt by class, including the ones the SDK retried
+	ErrorClasses map[string]errorClassStats `json:"errorClasses" yaml:"errorClasses"`
+	// FailedRequests are the most recent failed API call attempts with their request IDs
+	FailedRequests []failedRequest `json:"failedRequests" yaml:"failedRequests"`
+	// Resolution is how many of the created record sets resolved to their value, if they were verified
+	Resolution *resolutionStats `json:"resolution,omitempty" yaml:"resolution,omitempty"`
+	// Stale is how many of the upserted record sets are listed with their last written value, if they were verified
+	Stale *staleStats `json:"stale,omitempty" yaml:"stale,omitempty"`
+	// Assertions are the results of the assertions of the config file, if it has any
+	Assertions []assertionResult `json:"assertions,omitempty" yaml:"assertions,omitempty"`
+	// Error is the error the command failed with, if any
+	Error    string `json:"error,omitempty" yaml:"error,omitempty"`
+	ExitCode int    `json:"exitCode" yaml:"exitCode"`
+}
+
+func (r runSummary) writeTable(w io.Writer) {
+	fmt.Fprintln(w, "CREATED\tDELETED\tUPSERTED\tBATCHES\tERRORS\tDURATION")
+	fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%d\t%.1fs\n", r.Created, r.Deleted, r.Upserted, r.Batches, r.Errors, r.DurationSeconds)
+	if r.Batches+r.Errors == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "LATENCY\tMIN\tMEAN\tP50\tP90\tP99\tMAX")
+	fmt.Fprintf(w, "ChangeResourceRecordSets\t%.0fms\t%.0fms\t%.0fms\t%.0fms\t%.0fms\t%.0fms\n",
+		r.Latency.Min, r.Latency.Mean, r.Latency.P50, r.Latency.P90, r.Latency.P99, r.Latency.Max)
+	if p := r.Propagation; p != nil {
+		fmt.Fprintf(w, "Propagation (INSYNC)\t%.0fms\t%.0fms\t%.0fms\t%.0fms\t%.0fms\t%.0fms\n", p.Min, p.Mean, p.P50, p.P90, p.P99, p.Max)
+	}
+	if p := r.Resolvable; p != nil {
+		fmt.Fprintf(w, "Resolvable (DNS)\t%.0fms\t%.0fms\t%.0fms\t%.0fms\t%.0fms\t%.0fms\n", p.Min, p.Mean, p.P50, p.P90, p.P99, p.Max)
+	}
+	if res := r.Resolution; res != nil {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "RESOLVER\tCHECKED\tRESOLVED\tMISMATCHED\tUNRESOLVED")
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", res.Resolver, res.Checked, res.Resolved, res.Mismatched, res.Unresolved)
+		if len(res.Mismatches) > 0 {
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "UNRESOLVED RECORD SET\tTYPE\tSUBNET\tWANT\tANSWERS")
+			for _, m := range res.Mismatches {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", m.Name, m.Type, m.Subnet, m.Want, strings.Join(m.Answers, ","))
+			}
+		}
+	}
+	if st := r.Stale; st != nil {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "UPSERTED\tCURRENT\tSTALE\tMISSING")
+		fmt.Fprintf(w, "%d\t%d\t%d\t%d\n", st.Checked, st.Current, st.Stale, st.Missing)
+		if len(st.Records) > 0 {
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "STALE RECORD SET\tTYPE\tWANT\tGOT")
+			for _, rec := range st.Records {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", rec.Name, rec.Type, rec.Want, rec.Got)
+			}
+		}
+	}
+	if len(r.ErrorsByCode) != 0 {
+		codes := make([]string, 0, len(r.ErrorsByCode))
+		for code := range r.ErrorsByCode {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "ERROR\tCOUNT")
+		for _, code := range codes {
+			fmt.Fprintf(w, "%s\t%d\n", code, r.ErrorsByCode[code])
+		}
+	}
+	if len(r.ErrorClasses) != 0 {
+		classes := make([]string, 0, len(r.ErrorClasses))
+		for class := range r.ErrorClasses {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "ERROR CLASS\tATTEMPTS\tFIRST SEEN\tLAST SEEN")
+		for _, class := range classes {
+			stats := r.ErrorClasses[class]
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", class, stats.Count, stats.FirstSeen.Format(time.TimeOnly), stats.LastSeen.Format(time.TimeOnly))
+		}
+	}
+	if len(r.Assertions) != 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "ASSERTION\tACTUAL\tRESULT")
+		for _, a := range r.Assertions {
+			result := "FAIL"
+			if a.Passed {
+				result = "PASS"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", a.Assertion, a.Actual, result)
+		}
+	}
+	if len(r.FailedRequests) != 0 {
+		// only the most recent fit in a table, the summary file has all of them
+		failed := r.FailedRequests[max(len(r.FailedRequests)-maxFailedRequestsTable, 0):]
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "FAILED REQUEST\tOPERATION\tERROR\tTIME")
+		for _, req := range failed {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", req.RequestID, req.Operation, req.ErrorCode, req.Time.Format(time.TimeOnly))
+		}
+	}
+}
+
+// maxFailedRequestsTable is how many of the most recent failed requests the summary table shows
+const maxFailedRequestsTable = 5
+
+// writeSummaryFile writes the run summary as JSON to a local path or an s3:// URI so that CI pipelines can gate on the
+// outcome of a run
+func writeSummaryFile(ctx context.Context, artifacts *Artifacts, dest string, summary runSummary) error {
+	data, err := json.MarshalIndent(summary, "", "    ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal run summary: %w", err)
+	}
+	if err := artifacts.Write(ctx, dest, append(data, '\n'), "application/json"); err != nil {
+		return fmt.Errorf("unable to write run summary file: %w", err)
+	}
+	return nil
+}
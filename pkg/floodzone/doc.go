@@ -0,0 +1,21 @@
+// Package floodzone creates, churns, and deletes Route 53 resource record sets in paced batches, for load testing a
+// hosted zone from Go code, e.g. a test harness, instead of the floodzone command.
+//
+//	zone := floodzone.NewZone(route53.NewFromConfig(cfg))
+//	hz, err := zone.R53.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: aws.String(hostedZoneID)})
+//	if err != nil {
+//		return err
+//	}
+//	stages := []floodzone.LoadStage{{TotalRecords: 1000, MaxBatchSize: 100, BatchDelay: time.Second}}
+//	err = zone.GrowResourceRecordSets(ctx, hz.HostedZone, int(*hz.HostedZone.ResourceRecordSetCount), stages, nil)
+//
+// Every operation stops promptly when its context is done, including while it waits between two change batches, and
+// returns the context's error. The record sets of the batches that were already accepted are kept.
+//
+// A Plan builds and validates a flood step by step instead, and runs it in the background with a PlanRun to follow its
+// progress and metrics.
+//
+// A Zone only calls Route 53, through the Route53API interface so that tests can pass a fake client. Its options add a
+// rate limiter, a logger, a metrics sink, a retry policy, and hooks, or wrap every change batch with WithSubmit and
+// follow the progress of an operation with WithObserver.
+package floodzone
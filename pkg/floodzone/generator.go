@@ -0,0 +1,140 @@
+package floodzone
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// Names of the built-in record generators
+const (
+	// GeneratorUUID creates record sets with random UUID names, it's the default
+	GeneratorUUID = "uuid"
+	// GeneratorSequential creates record sets named record-<n>, counting up past the record-<n> record sets already in
+	// the zone, see Zone.SequentialStart
+	GeneratorSequential = "sequential"
+)
+
+// RecordGenerator generates the changes that create record sets. Next is called for every change batch with the
+// number of changes to generate, which must create record sets that don't exist yet.
+type RecordGenerator interface {
+	Next(n int) []types.Change
+}
+
+// GeneratorOptions are what a record generator is created for
+type GeneratorOptions struct {
+	// ZoneName is the name of the hosted zone with the trailing dot
+	ZoneName string
+	// TypeMix weighs the record types to create, an empty type mix only creates A records
+	TypeMix map[types.RRType]int
+	// Start is where the generator counts from, how many record sets the zone already has, or Zone.SequentialStart for
+	// the sequential generator
+	Start int
+}
+
+// GeneratorFactory creates a record generator for a zone
+type GeneratorFactory func(opts GeneratorOptions) RecordGenerator
+
+var (
+	generatorsMu sync.RWMutex
+	generators   = map[string]GeneratorFactory{
+		GeneratorUUID:       func(opts GeneratorOptions) RecordGenerator { return uuidGenerator{opts} },
+		GeneratorSequential: func(opts GeneratorOptions) RecordGenerator { return &sequentialGenerator{opts: opts, next: opts.Start} },
+	}
+)
+
+// RegisterGenerator registers a record generator under a name for NewGenerator, replacing the generator already
+// registered under it
+func RegisterGenerator(name string, factory GeneratorFactory) {
+	generatorsMu.Lock()
+	defer generatorsMu.Unlock()
+	generators[name] = factory
+}
+
+// NewGenerator returns the record generator registered under name for a zone
+func NewGenerator(name string, opts GeneratorOptions) (RecordGenerator, error) {
+	generatorsMu.RLock()
+	factory, ok := generators[name]
+	generatorsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown record generator %q", name)
+	}
+	return factory(opts), nil
+}
+
+// Generators returns the names of the registered record generators in order
+func Generators() []string {
+	generatorsMu.RLock()
+	defer generatorsMu.RUnlock()
+	names := make([]string, 0, len(generators))
+	for name := range generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// uuidGenerator creates record sets with random UUID names
+type uuidGenerator struct {
+	opts GeneratorOptions
+}
+
+func (g uuidGenerator) Next(n int) []types.Change {
+	return CreateChangeBatch(g.opts.ZoneName, n, g.opts.TypeMix)
+}
+
+// SequentialStart lists the zone and returns where the sequential generator counts from in it: past the highest
+// record-<n> record set, or from how many record sets the zone has if that's more. Record sets deleted since the zone
+// was flooded don't count towards its record sets, so counting from them would recreate names that still exist.
+func (z Zone) SequentialStart(ctx context.Context, hostedZone *types.HostedZone, maxBatchSize int) (int, error) {
+	start := int(aws.ToInt64(hostedZone.ResourceRecordSetCount))
+	suffix := "." + strings.ToLower(strings.TrimSuffix(aws.ToString(hostedZone.Name), ".")) + "."
+	err := z.WalkResourceRecordSets(ctx, hostedZone, maxBatchSize, RecordSetFilter{}, func(rr types.ResourceRecordSet) error {
+		label, ok := strings.CutSuffix(strings.ToLower(aws.ToString(rr.Name)), suffix)
+		if !ok {
+			return nil
+		}
+		if n, err := strconv.Atoi(strings.TrimPrefix(label, "record-")); err == nil && strings.HasPrefix(label, "record-") {
+			start = max(start, n+1)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return start, nil
+}
+
+// sequentialGenerator creates record sets named record-<n>, so that the names of a flood are predictable
+type sequentialGenerator struct {
+	opts GeneratorOptions
+	next int
+}
+
+func (g *sequentialGenerator) Next(n int) []types.Change {
+	var changes []types.Change
+	for i := 0; i < n; i++ {
+		rrType := PickRecordType(g.opts.TypeMix)
+		changes = append(changes, types.Change{
+			Action: types.ChangeActionCreate,
+			ResourceRecordSet: &types.ResourceRecordSet{
+				Name: aws.String(fmt.Sprintf("record-%d.%s", g.next, g.opts.ZoneName)),
+				Type: rrType,
+				TTL:  aws.Int64(300),
+				ResourceRecords: []types.ResourceRecord{
+					{
+						Value: aws.String(RecordValue(rrType, g.opts.ZoneName)),
+					},
+				},
+			},
+		})
+		g.next++
+	}
+	return changes
+}
@@ -0,0 +1,65 @@
+package floodzone
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// Run is an operation of a Zone, e.g. creating the record sets of a flood
+type Run struct {
+	// Action is the action of the operation, Create, Upsert, or Delete
+	Action       string
+	HostedZoneID string
+	// Done is how many record sets were already done when the operation started, and Total how many it will reach
+	Done  int
+	Total int
+}
+
+// Hooks are called at the points of the lifecycle of the operations of a Zone. They're called synchronously so that
+// external measurement tooling, e.g. a packet capture, is in sync with the flood without polling, and a slow hook
+// slows down the operation. Unset hooks are skipped.
+type Hooks struct {
+	// OnRunStart is called when an operation starts, before its first change batch
+	OnRunStart func(ctx context.Context, run Run)
+	// OnBatchSubmitted is called right before a change batch is submitted
+	OnBatchSubmitted func(ctx context.Context, hostedZoneID string, changes []types.Change)
+	// OnBatchComplete is called when a change batch was accepted, with how long the call took
+	OnBatchComplete func(ctx context.Context, hostedZoneID string, changes []types.Change, out *route53.ChangeResourceRecordSetsOutput, latency time.Duration)
+	// OnError is called when a change batch failed
+	OnError func(ctx context.Context, hostedZoneID string, changes []types.Change, err error)
+	// OnRunComplete is called when an operation returns, err is nil if it succeeded
+	OnRunComplete func(ctx context.Context, run Run, err error)
+}
+
+func (h Hooks) runStart(ctx context.Context, run Run) {
+	if h.OnRunStart != nil {
+		h.OnRunStart(ctx, run)
+	}
+}
+
+func (h Hooks) batchSubmitted(ctx context.Context, hostedZoneID string, changes []types.Change) {
+	if h.OnBatchSubmitted != nil {
+		h.OnBatchSubmitted(ctx, hostedZoneID, changes)
+	}
+}
+
+func (h Hooks) batchComplete(ctx context.Context, hostedZoneID string, changes []types.Change, out *route53.ChangeResourceRecordSetsOutput, latency time.Duration) {
+	if h.OnBatchComplete != nil {
+		h.OnBatchComplete(ctx, hostedZoneID, changes, out, latency)
+	}
+}
+
+func (h Hooks) error(ctx context.Context, hostedZoneID string, changes []types.Change, err error) {
+	if h.OnError != nil {
+		h.OnError(ctx, hostedZoneID, changes, err)
+	}
+}
+
+func (h Hooks) runComplete(ctx context.Context, run Run, err error) {
+	if h.OnRunComplete != nil {
+		h.OnRunComplete(ctx, run, err)
+	}
+}
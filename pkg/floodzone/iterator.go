@@ -0,0 +1,151 @@
+package floodzone
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// RecordSetFilter selects the record sets of a listing, the zero value selects all of them. SOA and NS record sets, and
+// the record sets of traffic policy instances that only their instance can change, are never listed.
+type RecordSetFilter struct {
+	// Types only selects record sets of these types when set
+	Types []types.RRType
+	// Name only selects record sets whose name matches the shell pattern when set, e.g. record-*.example.com. The
+	// trailing dot of the name is optional in the pattern.
+	Name string
+}
+
+// Validate returns an error if the Name pattern is malformed
+func (f RecordSetFilter) Validate() error {
+	if _, err := path.Match(f.Name, ""); err != nil {
+		return fmt.Errorf("invalid name pattern %q: %w", f.Name, err)
+	}
+	return nil
+}
+
+// Match returns whether the filter selects the record set
+func (f RecordSetFilter) Match(rr types.ResourceRecordSet) bool {
+	if rr.Type == types.RRTypeSoa || rr.Type == types.RRTypeNs || rr.TrafficPolicyInstanceId != nil {
+		return false
+	}
+	if len(f.Types) != 0 && !slices.Contains(f.Types, rr.Type) {
+		return false
+	}
+	if f.Name != "" {
+		name := aws.ToString(rr.Name)
+		pattern := f.Name
+		if !strings.HasSuffix(pattern, ".") {
+			name = strings.TrimSuffix(name, ".")
+		}
+		if ok, _ := path.Match(pattern, name); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// RecordSetIterator streams the record sets of a hosted zone one page at a time, so that only a page is held in memory
+// however many record sets the zone has:
+//
+//	it := zone.RecordSets(hostedZone, 300, floodzone.RecordSetFilter{Types: []types.RRType{types.RRTypeA}})
+//	for it.Next(ctx) {
+//		fmt.Println(*it.RecordSet().Name)
+//	}
+//	if err := it.Err(); err != nil {
+//		return err
+//	}
+type RecordSetIterator struct {
+	r53        Route53API
+	hostedZone *types.HostedZone
+	filter     RecordSetFilter
+
+	page      []types.ResourceRecordSet
+	current   types.ResourceRecordSet
+	next      *route53.ListResourceRecordSetsInput
+	pages     int
+	err       error
+	exhausted bool
+}
+
+// RecordSets returns an iterator over the record sets of the zone the filter selects, listing pageSize of them per
+// ListResourceRecordSets call
+func (z Zone) RecordSets(hostedZone *types.HostedZone, pageSize int, filter RecordSetFilter) *RecordSetIterator {
+	return &RecordSetIterator{
+		r53:        z.R53,
+		hostedZone: hostedZone,
+		filter:     filter,
+		next:       &route53.ListResourceRecordSetsInput{HostedZoneId: hostedZone.Id, MaxItems: aws.Int32(int32(pageSize))},
+	}
+}
+
+// Next advances to the next record set the filter selects, fetching the next page when the current one is used up. It
+// returns false when there are no more record sets or listing failed, which Err tells apart.
+func (it *RecordSetIterator) Next(ctx context.Context) bool {
+	for {
+		for len(it.page) > 0 {
+			rr := it.page[0]
+			it.page = it.page[1:]
+			if it.filter.Match(rr) {
+				it.current = rr
+				return true
+			}
+		}
+		if it.exhausted || it.err != nil {
+			return false
+		}
+		out, err := it.r53.ListResourceRecordSets(ctx, it.next)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.pages++
+		it.page = out.ResourceRecordSets
+		if !out.IsTruncated {
+			it.exhausted = true
+			continue
+		}
+		// record sets of the same name only differ by type and set identifier, so all three are needed to resume
+		it.next = &route53.ListResourceRecordSetsInput{
+			HostedZoneId:          it.hostedZone.Id,
+			MaxItems:              it.next.MaxItems,
+			StartRecordName:       out.NextRecordName,
+			StartRecordType:       out.NextRecordType,
+			StartRecordIdentifier: out.NextRecordIdentifier,
+		}
+	}
+}
+
+// RecordSet returns the record set Next advanced to
+func (it *RecordSetIterator) RecordSet() types.ResourceRecordSet {
+	return it.current
+}
+
+// Pages returns how many pages were listed so far
+func (it *RecordSetIterator) Pages() int {
+	return it.pages
+}
+
+// Err returns the error listing failed with, or nil
+func (it *RecordSetIterator) Err() error {
+	return it.err
+}
+
+// WalkResourceRecordSets calls fn for every record set of the zone the filter selects, listing maxBatchSize of them at
+// a time, until fn returns an error, which is returned
+func (z Zone) WalkResourceRecordSets(ctx context.Context, hostedZone *types.HostedZone, maxBatchSize int, filter RecordSetFilter,
+	fn func(rr types.ResourceRecordSet) error) error {
+	it := z.RecordSets(hostedZone, maxBatchSize, filter)
+	for it.Next(ctx) {
+		if err := fn(it.RecordSet()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
@@ -0,0 +1,119 @@
+package floodzone
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/aws/smithy-go"
+)
+
+// Option configures a Zone created by NewZone
+type Option func(*Zone)
+
+// NewZone returns a Zone that calls Route 53 through r53, configured by the options. Prefer it over a Zone literal,
+// options can be added without breaking callers.
+func NewZone(r53 Route53API, opts ...Option) Zone {
+	z := Zone{R53: r53}
+	for _, opt := range opts {
+		opt(&z)
+	}
+	return z
+}
+
+// WithSubmit submits every change batch with submit instead of calling ChangeResourceRecordSets directly
+func WithSubmit(submit SubmitFunc) Option {
+	return func(z *Zone) { z.Submit = submit }
+}
+
+// WithObserver notifies the observer of the progress of every operation
+func WithObserver(observer Observer) Option {
+	return func(z *Zone) { z.Observer = observer }
+}
+
+// WithHooks calls the hooks at the points of the lifecycle of every operation
+func WithHooks(hooks Hooks) Option {
+	return func(z *Zone) { z.Hooks = hooks }
+}
+
+// WithGenerator generates the record sets CreateResourceRecordSets creates with the generator
+func WithGenerator(generator RecordGenerator) Option {
+	return func(z *Zone) { z.Generator = generator }
+}
+
+// WithRateLimiter waits for the limiter before every change batch, on top of the batch delay
+func WithRateLimiter(limiter RateLimiter) Option {
+	return func(z *Zone) { z.Limiter = limiter }
+}
+
+// WithLogger logs every change batch at debug level and every retry at warn level to the logger
+func WithLogger(logger *slog.Logger) Option {
+	return func(z *Zone) { z.Logger = logger }
+}
+
+// WithMetrics records the outcome and latency of every ChangeResourceRecordSets call in the sink
+func WithMetrics(sink MetricsSink) Option {
+	return func(z *Zone) { z.Metrics = sink }
+}
+
+// WithRetryPolicy retries the change batches that failed according to the policy
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(z *Zone) { z.Retry = policy }
+}
+
+// RateLimiter paces the change batches of a Zone, e.g. a *rate.Limiter of golang.org/x/time/rate
+type RateLimiter interface {
+	// Wait blocks until the next change batch may be submitted, or returns an error if ctx is done first
+	Wait(ctx context.Context) error
+}
+
+// MetricsSink records every ChangeResourceRecordSets call of a Zone, including the attempts that are retried. err is
+// nil if the call succeeded.
+type MetricsSink interface {
+	RecordBatch(hostedZoneID string, changes []types.Change, latency time.Duration, err error)
+}
+
+// retryableErrorCodes are the Route 53 errors that succeed when the change batch is submitted again later
+var retryableErrorCodes = map[string]bool{
+	"PriorRequestNotComplete": true,
+	"Throttling":              true,
+	"ThrottlingException":     true,
+}
+
+// RetryPolicy is how a Zone retries the change batches that failed. The zero value doesn't retry.
+type RetryPolicy struct {
+	// MaxAttempts is how many times a change batch is submitted at most, including the first time
+	MaxAttempts int
+	// Backoff is the wait before the first retry, which doubles with every retry up to MaxBackoff if it's set
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retryable returns whether a failed change batch is retried, by default throttling and PriorRequestNotComplete
+	// errors are
+	Retryable func(err error) bool
+}
+
+// retry returns whether the change batch that failed its attempt with err is submitted again
+func (p RetryPolicy) retry(attempt int, err error) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && retryableErrorCodes[apiErr.ErrorCode()]
+}
+
+// backoff returns the wait before the retry of the change batch that failed its attempt
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := p.Backoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || backoff < p.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 {
+		return min(backoff, p.MaxBackoff)
+	}
+	return backoff
+}
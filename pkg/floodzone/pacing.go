@@ -0,0 +1,48 @@
+package floodzone
+
+import (
+	"context"
+	"time"
+)
+
+// LoadStage is one step of a load profile which grows the zone to TotalRecords with its own pacing
+type LoadStage struct {
+	TotalRecords int           `yaml:"total-records"`
+	MaxBatchSize int           `yaml:"max-batch-size"`
+	BatchDelay   time.Duration `yaml:"batch-delay-duration"`
+}
+
+// Batch is a change batch an operation submitted, for an Observer
+type Batch struct {
+	// Action is the action of the operation, Create, Upsert, or Delete
+	Action       string
+	HostedZoneID string
+	Size         int
+	// Done and Total are the record sets the operation changed so far and will change in total, in the current
+	// iteration for Upsert
+	Done  int
+	Total int
+	// Iteration and Iterations are the pass over the record sets an Upsert is in, they're zero for other actions
+	Iteration  int
+	Iterations int
+	// Delay is how long the operation waits before its next batch
+	Delay time.Duration
+}
+
+// BatchSize returns the size of the next batch of an operation that has remaining record sets to change, so that a
+// dry run plans the same batches the operations submit
+func BatchSize(remaining int, maxBatchSize int) int {
+	return min(remaining, maxBatchSize)
+}
+
+// pace waits for the batch delay between two batches, or until ctx is done
+func pace(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
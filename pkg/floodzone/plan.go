@@ -0,0 +1,329 @@
+package floodzone
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+const (
+	// maxChangesPerBatch is the most changes Route 53 accepts in one ChangeResourceRecordSets call
+	maxChangesPerBatch = 1_000
+	// defaultPlanBatchSize and defaultPlanBatchDelay are the pacing of a plan that doesn't set one, the defaults of the
+	// flood command
+	defaultPlanBatchSize  = 100
+	defaultPlanBatchDelay = 10 * time.Second
+)
+
+// Plan is a flood of a hosted zone built step by step, e.g.
+//
+//	run, err := floodzone.NewPlan(route53.NewFromConfig(cfg)).
+//		Zone(hostedZoneID).
+//		Records(10_000).
+//		TypeMix(map[types.RRType]int{types.RRTypeA: 3, types.RRTypeTxt: 1}).
+//		Rate(50).
+//		Run(ctx)
+//
+// The setters never fail, Validate and Run return every problem of the plan at once instead.
+type Plan struct {
+	r53          Route53API
+	hostedZoneID string
+	records      int
+	typeMix      map[types.RRType]int
+	batchSize    int
+	batchDelay   time.Duration
+	delaySet     bool
+	rate         float64
+	generator    string
+	hooks        Hooks
+}
+
+// NewPlan starts a plan that floods a hosted zone through the Route 53 client, with the pacing of the flood command
+// until it's changed
+func NewPlan(r53 Route53API) *Plan {
+	return &Plan{r53: r53, batchSize: defaultPlanBatchSize, batchDelay: defaultPlanBatchDelay, generator: GeneratorUUID}
+}
+
+// Zone sets the ID of the hosted zone to flood
+func (p *Plan) Zone(hostedZoneID string) *Plan {
+	p.hostedZoneID = hostedZoneID
+	return p
+}
+
+// Records sets how many record sets the zone has when the flood is done, like --total-records
+func (p *Plan) Records(total int) *Plan {
+	p.records = total
+	return p
+}
+
+// TypeMix sets the weights of the record types to create, by default only A records are created
+func (p *Plan) TypeMix(typeMix map[types.RRType]int) *Plan {
+	p.typeMix = typeMix
+	return p
+}
+
+// BatchSize sets the most record sets created in one change batch
+func (p *Plan) BatchSize(size int) *Plan {
+	p.batchSize = size
+	return p
+}
+
+// BatchDelay sets how long to wait between two change batches
+func (p *Plan) BatchDelay(delay time.Duration) *Plan {
+	p.batchDelay = delay
+	p.delaySet = true
+	return p
+}
+
+// Rate paces the flood at about recordsPerSecond record sets per second, by deriving the delay between two change
+// batches from the batch size. It can't be combined with BatchDelay.
+func (p *Plan) Rate(recordsPerSecond float64) *Plan {
+	p.rate = recordsPerSecond
+	return p
+}
+
+// Generator sets the name of the registered record generator that generates the record sets, uuid by default
+func (p *Plan) Generator(name string) *Plan {
+	p.generator = name
+	return p
+}
+
+// Hooks sets the hooks called at the points of the lifecycle of the flood
+func (p *Plan) Hooks(hooks Hooks) *Plan {
+	p.hooks = hooks
+	return p
+}
+
+// Validate returns every problem of the plan joined, or nil if it can be run
+func (p *Plan) Validate() error {
+	var errs []error
+	if p.r53 == nil {
+		errs = append(errs, errors.New("a Route 53 client is required"))
+	}
+	if p.hostedZoneID == "" {
+		errs = append(errs, errors.New("a hosted zone ID is required"))
+	}
+	if p.records < 1 {
+		errs = append(errs, fmt.Errorf("records must be at least 1, got %d", p.records))
+	}
+	for rrType, weight := range p.typeMix {
+		if !SupportedRecordType(rrType) {
+			errs = append(errs, fmt.Errorf("record type %q of the type mix isn't supported", rrType))
+		}
+		if weight < 0 {
+			errs = append(errs, fmt.Errorf("weight of record type %q must not be negative, got %d", rrType, weight))
+		}
+	}
+	if p.batchSize < 1 || p.batchSize > maxChangesPerBatch {
+		errs = append(errs, fmt.Errorf("batch size must be from 1 to %d, got %d", maxChangesPerBatch, p.batchSize))
+	}
+	if p.batchDelay < 0 {
+		errs = append(errs, fmt.Errorf("batch delay must not be negative, got %s", p.batchDelay))
+	}
+	if p.rate != 0 && p.delaySet {
+		errs = append(errs, errors.New("rate and batch delay are mutually exclusive"))
+	}
+	if p.rate < 0 {
+		errs = append(errs, fmt.Errorf("rate must be positive, got %g", p.rate))
+	}
+	if generators := Generators(); !slices.Contains(generators, p.generator) {
+		errs = append(errs, fmt.Errorf("record generator must be one of %s, got %q", strings.Join(generators, ", "), p.generator))
+	}
+	return errors.Join(errs...)
+}
+
+// delay returns the delay between two change batches, derived from the rate if it's set
+func (p *Plan) delay() time.Duration {
+	if p.rate > 0 {
+		return time.Duration(float64(p.batchSize) / p.rate * float64(time.Second))
+	}
+	return p.batchDelay
+}
+
+// Run validates the plan, looks up the hosted zone, and starts the flood in the background. The flood stops when ctx
+// is done or the run is canceled.
+func (p *Plan) Run(ctx context.Context) (*PlanRun, error) {
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid plan: %w", err)
+	}
+	hzOut, err := p.r53.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: aws.String(p.hostedZoneID)})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get hosted zone %s: %w", p.hostedZoneID, err)
+	}
+	hostedZone := hzOut.HostedZone
+	current := int(aws.ToInt64(hostedZone.ResourceRecordSetCount))
+	start := current
+	if p.generator == GeneratorSequential {
+		if start, err = NewZone(p.r53).SequentialStart(ctx, hostedZone, p.batchSize); err != nil {
+			return nil, fmt.Errorf("unable to find where the sequential generator starts: %w", err)
+		}
+	}
+	generator, err := NewGenerator(p.generator, GeneratorOptions{ZoneName: *hostedZone.Name, TypeMix: p.typeMix, Start: start})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	run := &PlanRun{
+		cancel: cancel,
+		done:   make(chan struct{}),
+		status: PlanStatus{State: PlanRunning, HostedZoneID: p.hostedZoneID, Done: current, Total: max(current, p.records)},
+		start:  time.Now(),
+	}
+	hooks := p.hooks
+	batchComplete := hooks.OnBatchComplete
+	hooks.OnBatchComplete = func(ctx context.Context, hostedZoneID string, changes []types.Change, out *route53.ChangeResourceRecordSetsOutput, latency time.Duration) {
+		run.observeLatency(latency)
+		if batchComplete != nil {
+			batchComplete(ctx, hostedZoneID, changes, out, latency)
+		}
+	}
+	zone := NewZone(p.r53, WithObserver(planObserver{run}), WithHooks(hooks), WithGenerator(generator))
+	batchDelay := p.delay()
+	go func() {
+		defer cancel()
+		run.finish(zone.CreateResourceRecordSets(ctx, hostedZone, current, p.records, p.batchSize, batchDelay, p.typeMix))
+	}()
+	return run, nil
+}
+
+// PlanState is the state of a PlanRun
+type PlanState string
+
+// States of a PlanRun
+const (
+	PlanRunning   PlanState = "running"
+	PlanSucceeded PlanState = "succeeded"
+	PlanFailed    PlanState = "failed"
+	PlanCanceled  PlanState = "canceled"
+)
+
+// PlanStatus is the progress of a PlanRun
+type PlanStatus struct {
+	State        PlanState
+	HostedZoneID string
+	// Done is how many record sets the zone has so far, and Total how many it will have when the flood is done
+	Done  int
+	Total int
+	// Err is why the flood failed or was canceled
+	Err error
+}
+
+// PlanMetrics are the measurements of a PlanRun so far
+type PlanMetrics struct {
+	// Batches and RecordSets are the change batches and record sets Route 53 accepted
+	Batches    int
+	RecordSets int
+	Elapsed    time.Duration
+	// RecordsPerSecond is the record sets created per second since the run started
+	RecordsPerSecond float64
+	// MeanBatchLatency and MaxBatchLatency are how long the ChangeResourceRecordSets calls took
+	MeanBatchLatency time.Duration
+	MaxBatchLatency  time.Duration
+}
+
+// PlanRun is a flood started by Plan.Run. Its methods are safe to call from any goroutine.
+type PlanRun struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	start  time.Time
+
+	mu           sync.Mutex
+	status       PlanStatus
+	metrics      PlanMetrics
+	totalLatency time.Duration
+	end          time.Time
+}
+
+// Status returns the progress of the run
+func (r *PlanRun) Status() PlanStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// Metrics returns the measurements of the run so far
+func (r *PlanRun) Metrics() PlanMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	metrics := r.metrics
+	end := r.end
+	if end.IsZero() {
+		end = time.Now()
+	}
+	metrics.Elapsed = end.Sub(r.start)
+	if metrics.Elapsed > 0 {
+		metrics.RecordsPerSecond = float64(metrics.RecordSets) / metrics.Elapsed.Seconds()
+	}
+	if metrics.Batches > 0 {
+		metrics.MeanBatchLatency = r.totalLatency / time.Duration(metrics.Batches)
+	}
+	return metrics
+}
+
+// Done returns a channel that's closed when the run finished
+func (r *PlanRun) Done() <-chan struct{} {
+	return r.done
+}
+
+// Wait waits for the run to finish and returns why it failed, or nil if it succeeded
+func (r *PlanRun) Wait() error {
+	<-r.done
+	return r.Status().Err
+}
+
+// Cancel stops the run after the change batch in flight, record sets already created are kept
+func (r *PlanRun) Cancel() {
+	r.cancel()
+}
+
+func (r *PlanRun) observeLatency(latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.totalLatency += latency
+	r.metrics.MaxBatchLatency = max(r.metrics.MaxBatchLatency, latency)
+}
+
+func (r *PlanRun) finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.end = time.Now()
+	r.status.Err = err
+	switch {
+	case err == nil:
+		r.status.State = PlanSucceeded
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		r.status.State = PlanCanceled
+	default:
+		r.status.State = PlanFailed
+	}
+	close(r.done)
+}
+
+// planObserver records the progress of a PlanRun, it's not on PlanRun so that the Observer methods aren't exported
+type planObserver struct {
+	run *PlanRun
+}
+
+func (o planObserver) Start(_ string, done int, total int) {
+	o.run.mu.Lock()
+	defer o.run.mu.Unlock()
+	o.run.status.Done, o.run.status.Total = done, total
+}
+
+func (o planObserver) Batched(_ context.Context, batch Batch) {
+	o.run.mu.Lock()
+	defer o.run.mu.Unlock()
+	o.run.status.Done = batch.Done
+	o.run.metrics.Batches++
+	o.run.metrics.RecordSets += batch.Size
+}
+
+func (o planObserver) Finish() {}
@@ -0,0 +1,103 @@
+package floodzone
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/google/uuid"
+)
+
+// recordValues are the values of created records for each supported record type
+var recordValues = map[types.RRType]string{
+	types.RRTypeA:     "127.0.0.1",
+	types.RRTypeAaaa:  "::1",
+	types.RRTypeCname: "target.%s",
+	types.RRTypeTxt:   `"floodzone"`,
+	types.RRTypeMx:    "10 mail.%s",
+	types.RRTypeSrv:   "10 5 443 target.%s",
+}
+
+// SupportedRecordType returns whether record sets of the type can be created, e.g. as part of a type mix
+func SupportedRecordType(rrType types.RRType) bool {
+	_, ok := recordValues[rrType]
+	return ok
+}
+
+// RecordValue returns the value created records of the type have in the zone hzName
+func RecordValue(rrType types.RRType, hzName string) string {
+	value := recordValues[rrType]
+	if strings.Contains(value, "%s") {
+		return fmt.Sprintf(value, hzName)
+	}
+	return value
+}
+
+// PickRecordType picks a record type randomly according to its weight in the type mix, an empty type mix always picks A
+func PickRecordType(typeMix map[types.RRType]int) types.RRType {
+	total := 0
+	for _, weight := range typeMix {
+		total += weight
+	}
+	if total <= 0 {
+		return types.RRTypeA
+	}
+	// iterate in a stable order so the mix doesn't depend on map iteration
+	rrTypes := make([]string, 0, len(typeMix))
+	for rrType := range typeMix {
+		rrTypes = append(rrTypes, string(rrType))
+	}
+	sort.Strings(rrTypes)
+	n := rand.Intn(total)
+	for _, rrType := range rrTypes {
+		n -= typeMix[types.RRType(rrType)]
+		if n < 0 {
+			return types.RRType(rrType)
+		}
+	}
+	return types.RRTypeA
+}
+
+// CreateChangeBatch generates batchSize record set creations with unique names. Record types are picked randomly
+// according to their weight in the type mix, an empty type mix only creates A records.
+func CreateChangeBatch(hzName string, batchSize int, typeMix map[types.RRType]int) []types.Change {
+	var changes []types.Change
+	for i := 0; i < batchSize; i++ {
+		rrType := PickRecordType(typeMix)
+		changes = append(changes, types.Change{
+			Action: types.ChangeActionCreate,
+			ResourceRecordSet: &types.ResourceRecordSet{
+				Name: aws.String(fmt.Sprintf("%s.%s", uuid.NewString(), hzName)),
+				Type: rrType,
+				TTL:  aws.Int64(300),
+				ResourceRecords: []types.ResourceRecord{
+					{
+						Value: aws.String(RecordValue(rrType, hzName)),
+					},
+				},
+			},
+		})
+	}
+	return changes
+}
+
+// UpsertChangeBatch generates UPSERTs of the A record sets with new random loopback values
+func UpsertChangeBatch(rrs []types.ResourceRecordSet) []types.Change {
+	var changes []types.Change
+	for i := range rrs {
+		rr := rrs[i]
+		rr.ResourceRecords = []types.ResourceRecord{
+			{
+				Value: aws.String(fmt.Sprintf("127.%d.%d.%d", rand.Intn(256), rand.Intn(256), rand.Intn(254)+1)),
+			},
+		}
+		changes = append(changes, types.Change{
+			Action:            types.ChangeActionUpsert,
+			ResourceRecordSet: &rr,
+		})
+	}
+	return changes
+}
@@ -0,0 +1,293 @@
+package floodzone
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/google/uuid"
+)
+
+// Route53API is the part of the Route 53 API a Zone calls, which *route53.Client implements. Tests and alternative
+// backends can pass a fake instead.
+type Route53API interface {
+	ChangeResourceRecordSets(ctx context.Context, params *route53.ChangeResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error)
+	CreateHostedZone(ctx context.Context, params *route53.CreateHostedZoneInput, optFns ...func(*route53.Options)) (*route53.CreateHostedZoneOutput, error)
+	GetHostedZone(ctx context.Context, params *route53.GetHostedZoneInput, optFns ...func(*route53.Options)) (*route53.GetHostedZoneOutput, error)
+	ListResourceRecordSets(ctx context.Context, params *route53.ListResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ListResourceRecordSetsOutput, error)
+}
+
+// SubmitFunc submits a batch of changes to the hosted zone
+type SubmitFunc func(ctx context.Context, hostedZone *types.HostedZone, changes []types.Change) (*route53.ChangeResourceRecordSetsOutput, error)
+
+// Observer follows the progress of the operations of a Zone, e.g. to show a progress bar or log every batch
+type Observer interface {
+	// Start is called when an operation starts, with the record sets already done and the total it will reach
+	Start(action string, done int, total int)
+	// Batched is called after every change batch the operation submitted successfully
+	Batched(ctx context.Context, batch Batch)
+	// Finish is called when the operation returns
+	Finish()
+}
+
+// Zone changes the resource record sets of Route 53 hosted zones in batches of a maximum size with a delay between
+// them, so that the load stays under the Route 53 API limits. Create it with NewZone.
+type Zone struct {
+	R53 Route53API
+	// Submit submits every change batch instead of calling ChangeResourceRecordSets directly when set
+	Submit SubmitFunc
+	// Observer is notified of the progress of every operation when set
+	Observer Observer
+	// Hooks are called at the points of the lifecycle of every operation
+	Hooks Hooks
+	// Generator generates the record sets CreateResourceRecordSets creates when set, instead of record sets with random
+	// UUID names of the type mix
+	Generator RecordGenerator
+	// Limiter is waited for before every change batch when set
+	Limiter RateLimiter
+	// Logger logs every change batch and retry when set
+	Logger *slog.Logger
+	// Metrics records every ChangeResourceRecordSets call when set
+	Metrics MetricsSink
+	// Retry is how change batches that failed are retried, they aren't by default
+	Retry RetryPolicy
+}
+
+// CreatePrivateHostedZone creates a private hosted zone with an unique name in the format: floodzone-test-<UUID>.aws
+// The hosted zone ID is returned.
+func (z Zone) CreatePrivateHostedZone(ctx context.Context, vpcID string, region string) (string, error) {
+	hzOut, err := z.R53.CreateHostedZone(ctx, &route53.CreateHostedZoneInput{
+		Name:            aws.String(fmt.Sprintf("floodzone-test-%s.aws", uuid.NewString())),
+		CallerReference: aws.String(fmt.Sprint(time.Now().Unix())),
+		HostedZoneConfig: &types.HostedZoneConfig{
+			PrivateZone: true,
+			Comment:     aws.String(fmt.Sprintf("Created by floodzone at %s", time.Now().UTC())),
+		},
+		VPC: &types.VPC{
+			VPCId:     aws.String(vpcID),
+			VPCRegion: types.VPCRegion(region),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return *hzOut.HostedZone.Id, err
+}
+
+// ListResourceRecordSets lists the resource record sets of the zone excluding SOA and NS records, maxBatchSize at a
+// time. Use RecordSets or WalkResourceRecordSets to stream the record sets of large zones instead.
+func (z Zone) ListResourceRecordSets(ctx context.Context, hostedZone *types.HostedZone, maxBatchSize int) ([]types.ResourceRecordSet, error) {
+	var rrs []types.ResourceRecordSet
+	err := z.WalkResourceRecordSets(ctx, hostedZone, maxBatchSize, RecordSetFilter{}, func(rr types.ResourceRecordSet) error {
+		rrs = append(rrs, rr)
+		return nil
+	})
+	return rrs, err
+}
+
+// GrowResourceRecordSets creates resource record sets through the stages of a load profile, each growing the zone to
+// its TotalRecords with its own pacing. Stages that don't grow the zone are skipped.
+func (z Zone) GrowResourceRecordSets(ctx context.Context, hostedZone *types.HostedZone, currentRRSetCount int, stages []LoadStage, typeMix map[types.RRType]int) error {
+	for _, stage := range stages {
+		if err := z.CreateResourceRecordSets(ctx, hostedZone, currentRRSetCount, stage.TotalRecords, stage.MaxBatchSize, stage.BatchDelay, typeMix); err != nil {
+			return err
+		}
+		currentRRSetCount = max(currentRRSetCount, stage.TotalRecords)
+	}
+	return nil
+}
+
+// CreateResourceRecordSets creates resource record sets with unique names in controlled batches until the zone has
+// desiredRecords of them. The record sets are generated by the Generator if it's set, and of the type mix otherwise.
+func (z Zone) CreateResourceRecordSets(ctx context.Context, hostedZone *types.HostedZone,
+	currentRRSetCount int, desiredRecords int, maxBatchSize int, batchDelay time.Duration, typeMix map[types.RRType]int) (err error) {
+	if currentRRSetCount >= desiredRecords {
+		return nil
+	}
+	run := Run{Action: "Create", HostedZoneID: *hostedZone.Id, Done: currentRRSetCount, Total: desiredRecords}
+	z.start(ctx, run)
+	defer func() { z.finish(ctx, run, err) }()
+	generator := z.Generator
+	if generator == nil {
+		generator = uuidGenerator{GeneratorOptions{ZoneName: *hostedZone.Name, TypeMix: typeMix}}
+	}
+	for currentRRSetCount < desiredRecords {
+		size := BatchSize(desiredRecords-currentRRSetCount, maxBatchSize)
+		if _, err := z.submit(ctx, hostedZone, generator.Next(size)); err != nil {
+			return err
+		}
+		currentRRSetCount += size
+		z.batched(ctx, Batch{Action: "Create", HostedZoneID: *hostedZone.Id, Size: size, Done: currentRRSetCount, Total: desiredRecords, Delay: batchDelay})
+		if currentRRSetCount != desiredRecords {
+			if err := pace(ctx, batchDelay); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ChurnResourceRecordSets UPSERTs the A record sets in the zone with new values in controlled batches. Up to
+// recordsPerIteration record sets are updated per iteration and the whole pass is repeated iterations times.
+func (z Zone) ChurnResourceRecordSets(ctx context.Context, hostedZone *types.HostedZone, recordsPerIteration int,
+	iterations int, maxBatchSize int, batchDelay time.Duration) (err error) {
+	rrs, err := z.ListResourceRecordSets(ctx, hostedZone, maxBatchSize)
+	if err != nil {
+		return err
+	}
+	var aRecords []types.ResourceRecordSet
+	for _, rr := range rrs {
+		// alias records and routing policies can't be churned by simply swapping the value
+		if rr.Type == types.RRTypeA && rr.AliasTarget == nil && rr.SetIdentifier == nil {
+			aRecords = append(aRecords, rr)
+		}
+	}
+	if len(aRecords) == 0 {
+		return fmt.Errorf("no A record sets to churn in %s", *hostedZone.Id)
+	}
+	recordsPerIteration = min(recordsPerIteration, len(aRecords))
+	run := Run{Action: "Upsert", HostedZoneID: *hostedZone.Id, Total: recordsPerIteration * iterations}
+	z.start(ctx, run)
+	defer func() { z.finish(ctx, run, err) }()
+	for iteration := 1; iteration <= iterations; iteration++ {
+		churned := 0
+		for churned < recordsPerIteration {
+			size := BatchSize(recordsPerIteration-churned, maxBatchSize)
+			if _, err := z.submit(ctx, hostedZone, UpsertChangeBatch(aRecords[churned:churned+size])); err != nil {
+				return err
+			}
+			churned += size
+			z.batched(ctx, Batch{Action: "Upsert", HostedZoneID: *hostedZone.Id, Size: size, Done: churned, Total: recordsPerIteration,
+				Iteration: iteration, Iterations: iterations, Delay: batchDelay})
+			if churned != recordsPerIteration || iteration != iterations {
+				if err := pace(ctx, batchDelay); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// DeleteResourceRecordSets deletes the desired number of Resource Record Sets in controlled batches and returns the
+// remaining resource record sets in the zone excluding SOA and NS records.
+func (z Zone) DeleteResourceRecordSets(ctx context.Context, hostedZone *types.HostedZone, maxBatchSize int, desiredDeletions int, batchDelay time.Duration) (remaining int, err error) {
+	rrs, err := z.ListResourceRecordSets(ctx, hostedZone, maxBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	currentRRS := len(rrs)
+	deletedRecords := 0
+	totalRecordsToDelete := min(desiredDeletions, len(rrs))
+	run := Run{Action: "Delete", HostedZoneID: *hostedZone.Id, Total: totalRecordsToDelete}
+	z.start(ctx, run)
+	defer func() { z.finish(ctx, run, err) }()
+	for deletedRecords < totalRecordsToDelete {
+		var changes []types.Change
+		size := BatchSize(totalRecordsToDelete-deletedRecords, maxBatchSize)
+		for i := 0; i < size; i++ {
+			changes = append(changes, types.Change{
+				Action:            types.ChangeActionDelete,
+				ResourceRecordSet: &rrs[i],
+			})
+		}
+		if _, err := z.submit(ctx, hostedZone, changes); err != nil {
+			return 0, err
+		}
+		rrs = rrs[len(changes):]
+		deletedRecords += len(changes)
+		z.batched(ctx, Batch{Action: "Delete", HostedZoneID: *hostedZone.Id, Size: len(changes), Done: deletedRecords, Total: totalRecordsToDelete, Delay: batchDelay})
+		if deletedRecords != totalRecordsToDelete {
+			if err := pace(ctx, batchDelay); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return currentRRS - totalRecordsToDelete, nil
+}
+
+// submit submits a change batch with Submit, or directly when it isn't set, calling the batch hooks around it. Every
+// attempt waits for the Limiter first, and failed attempts are retried according to the Retry policy.
+func (z Zone) submit(ctx context.Context, hostedZone *types.HostedZone, changes []types.Change) (*route53.ChangeResourceRecordSetsOutput, error) {
+	z.Hooks.batchSubmitted(ctx, *hostedZone.Id, changes)
+	start := time.Now()
+	var out *route53.ChangeResourceRecordSetsOutput
+	var err error
+	for attempt := 1; ; attempt++ {
+		out, err = z.attempt(ctx, hostedZone, changes)
+		if err == nil || !z.Retry.retry(attempt, err) || ctx.Err() != nil {
+			break
+		}
+		backoff := z.Retry.backoff(attempt)
+		z.log(ctx, slog.LevelWarn, "Retrying change batch", "zone", *hostedZone.Id, "attempt", attempt, "backoff", backoff, "error", err)
+		if err := pace(ctx, backoff); err != nil {
+			break
+		}
+	}
+	if err != nil {
+		z.Hooks.error(ctx, *hostedZone.Id, changes, err)
+		return nil, err
+	}
+	z.Hooks.batchComplete(ctx, *hostedZone.Id, changes, out, time.Since(start))
+	return out, nil
+}
+
+// attempt submits a change batch once
+func (z Zone) attempt(ctx context.Context, hostedZone *types.HostedZone, changes []types.Change) (*route53.ChangeResourceRecordSetsOutput, error) {
+	if z.Limiter != nil {
+		if err := z.Limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	start := time.Now()
+	var out *route53.ChangeResourceRecordSetsOutput
+	var err error
+	if z.Submit != nil {
+		out, err = z.Submit(ctx, hostedZone, changes)
+	} else {
+		out, err = z.R53.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
+			HostedZoneId: hostedZone.Id,
+			ChangeBatch:  &types.ChangeBatch{Changes: changes},
+		})
+	}
+	latency := time.Since(start)
+	if z.Metrics != nil {
+		z.Metrics.RecordBatch(*hostedZone.Id, changes, latency, err)
+	}
+	if err != nil {
+		z.log(ctx, slog.LevelDebug, "Change batch failed", "zone", *hostedZone.Id, "changes", len(changes), "latency", latency, "error", err)
+		return nil, err
+	}
+	z.log(ctx, slog.LevelDebug, "Submitted change batch", "zone", *hostedZone.Id, "changes", len(changes), "latency", latency)
+	return out, nil
+}
+
+func (z Zone) log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	if z.Logger != nil {
+		z.Logger.Log(ctx, level, msg, args...)
+	}
+}
+
+func (z Zone) start(ctx context.Context, run Run) {
+	if z.Observer != nil {
+		z.Observer.Start(run.Action, run.Done, run.Total)
+	}
+	z.Hooks.runStart(ctx, run)
+}
+
+func (z Zone) batched(ctx context.Context, batch Batch) {
+	if z.Observer != nil {
+		z.Observer.Batched(ctx, batch)
+	}
+}
+
+func (z Zone) finish(ctx context.Context, run Run, err error) {
+	if z.Observer != nil {
+		z.Observer.Finish()
+	}
+	z.Hooks.runComplete(ctx, run, err)
+}
@@ -0,0 +1,138 @@
+// Package floodzonetest provides helpers for integration tests that need a Route 53 hosted zone full of record sets:
+//
+//	func TestResolverUnderLoad(t *testing.T) {
+//		zoneID := floodzonetest.FloodedZone(t, floodzonetest.Config{
+//			Client:  route53.NewFromConfig(cfg),
+//			VPCID:   vpcID,
+//			Region:  "us-east-1",
+//			Records: 5_000,
+//		})
+//		...
+//	}
+//
+// The zone is deleted with its record sets when the test and its subtests finish.
+package floodzonetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/bwagner5/floodzone/pkg/floodzone"
+)
+
+const (
+	// defaultMaxBatchSize and defaultBatchDelay fill a zone of 10,000 record sets in about 20 seconds while staying
+	// well under the Route 53 limit of 5 requests per second
+	defaultMaxBatchSize = 500
+	defaultBatchDelay   = time.Second
+	// maxChangesPerBatch is the most changes Route 53 accepts in one ChangeResourceRecordSets call
+	maxChangesPerBatch = 1_000
+)
+
+// Client is the part of the Route 53 API the helpers call, which *route53.Client implements
+type Client interface {
+	floodzone.Route53API
+	DeleteHostedZone(ctx context.Context, params *route53.DeleteHostedZoneInput, optFns ...func(*route53.Options)) (*route53.DeleteHostedZoneOutput, error)
+}
+
+// Config is the zone FloodedZone creates
+type Config struct {
+	Client Client
+	// VPCID and Region are the VPC the private hosted zone is associated with
+	VPCID  string
+	Region string
+	// Records is how many record sets the zone is filled with
+	Records int
+	// TypeMix weighs the record types to create, an empty type mix only creates A records
+	TypeMix map[types.RRType]int
+	// Generator is the name of the registered record generator, uuid by default
+	Generator string
+	// MaxBatchSize and BatchDelay pace the flood, 500 record sets per second by default
+	MaxBatchSize int
+	BatchDelay   time.Duration
+}
+
+// validate returns every problem of the config joined, or nil if a zone can be created for it
+func (c Config) validate() error {
+	var errs []error
+	if c.Client == nil {
+		errs = append(errs, errors.New("a Route 53 client is required"))
+	}
+	if c.VPCID == "" || c.Region == "" {
+		errs = append(errs, errors.New("the VPC ID and region of the private hosted zone are required"))
+	}
+	if c.Records < 0 {
+		errs = append(errs, fmt.Errorf("records must not be negative, got %d", c.Records))
+	}
+	if c.MaxBatchSize < 0 || c.MaxBatchSize > maxChangesPerBatch {
+		errs = append(errs, fmt.Errorf("max batch size must be from 1 to %d, got %d", maxChangesPerBatch, c.MaxBatchSize))
+	}
+	if c.BatchDelay < 0 {
+		errs = append(errs, fmt.Errorf("batch delay must not be negative, got %s", c.BatchDelay))
+	}
+	return errors.Join(errs...)
+}
+
+// FloodedZone creates a private hosted zone, fills it with cfg.Records record sets, and returns its ID. The zone and
+// its record sets are deleted by tb.Cleanup, and the test fails if that doesn't succeed so that leaked zones are
+// noticed. The test is stopped with tb.Fatal if the zone can't be created or filled.
+func FloodedZone(tb testing.TB, cfg Config) string {
+	tb.Helper()
+	if err := cfg.validate(); err != nil {
+		tb.Fatalf("invalid floodzonetest config: %v", err)
+	}
+	if cfg.MaxBatchSize == 0 {
+		cfg.MaxBatchSize = defaultMaxBatchSize
+	}
+	if cfg.BatchDelay == 0 {
+		cfg.BatchDelay = defaultBatchDelay
+	}
+	if cfg.Generator == "" {
+		cfg.Generator = floodzone.GeneratorUUID
+	}
+	ctx := context.Background()
+	zone := floodzone.NewZone(cfg.Client)
+	zoneID, err := zone.CreatePrivateHostedZone(ctx, cfg.VPCID, cfg.Region)
+	if err != nil {
+		tb.Fatalf("unable to create hosted zone: %v", err)
+	}
+	tb.Cleanup(func() {
+		if err := deleteZone(ctx, cfg, zone, zoneID); err != nil {
+			tb.Errorf("unable to delete hosted zone %s, it must be deleted manually: %v", zoneID, err)
+		}
+	})
+	hz, err := cfg.Client.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: aws.String(zoneID)})
+	if err != nil {
+		tb.Fatalf("unable to get hosted zone %s: %v", zoneID, err)
+	}
+	current := int(aws.ToInt64(hz.HostedZone.ResourceRecordSetCount))
+	zone.Generator, err = floodzone.NewGenerator(cfg.Generator, floodzone.GeneratorOptions{ZoneName: *hz.HostedZone.Name, TypeMix: cfg.TypeMix, Start: current})
+	if err != nil {
+		tb.Fatalf("invalid floodzonetest config: %v", err)
+	}
+	// the SOA and NS record sets of the new zone count towards its record sets
+	if err := zone.CreateResourceRecordSets(ctx, hz.HostedZone, current, current+cfg.Records, cfg.MaxBatchSize, cfg.BatchDelay, cfg.TypeMix); err != nil {
+		tb.Fatalf("unable to fill hosted zone %s: %v", zoneID, err)
+	}
+	return zoneID
+}
+
+// deleteZone deletes the record sets of the zone, which Route 53 requires before deleting it, and then the zone
+func deleteZone(ctx context.Context, cfg Config, zone floodzone.Zone, zoneID string) error {
+	hz, err := cfg.Client.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: aws.String(zoneID)})
+	if err != nil {
+		return err
+	}
+	if _, err := zone.DeleteResourceRecordSets(ctx, hz.HostedZone, cfg.MaxBatchSize, math.MaxInt, cfg.BatchDelay); err != nil {
+		return fmt.Errorf("unable to delete resource record sets: %w", err)
+	}
+	_, err = cfg.Client.DeleteHostedZone(ctx, &route53.DeleteHostedZoneInput{Id: aws.String(zoneID)})
+	return err
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/bwagner5/floodzone/pkg/floodzone"
+)
+
+// newZoneRecordSets is the SOA and NS record sets every new hosted zone starts with
+const newZoneRecordSets = 2
+
+// executionPlan is the output of --dry-run, the steps a command would take without changing anything
+type executionPlan struct {
+	Command string     `json:"command" yaml:"command"`
+	Zone    string     `json:"zone" yaml:"zone"`
+	Steps   []planStep `json:"steps" yaml:"steps"`
+	// APICalls counts the calls that change resources, reads like listing the record sets aren't included
+	APICalls int `json:"apiCalls" yaml:"apiCalls"`
+	Batches  int `json:"batches" yaml:"batches"`
+	// EstimatedDurationSeconds is the time spent in batch delays, excluding the latency of the API calls
+	EstimatedDurationSeconds float64       `json:"estimatedDurationSeconds" yaml:"estimatedDurationSeconds"`
+	Cost                     *costEstimate `json:"cost" yaml:"cost"`
+}
+
+// planStep is a single API call, or a run of change batches with the same pacing
+type planStep struct {
+	Action          string  `json:"action" yaml:"action"`
+	Records         int     `json:"records,omitempty" yaml:"records,omitempty"`
+	Batches         int     `json:"batches,omitempty" yaml:"batches,omitempty"`
+	BatchSize       int     `json:"batchSize,omitempty" yaml:"batchSize,omitempty"`
+	LastBatchSize   int     `json:"lastBatchSize,omitempty" yaml:"lastBatchSize,omitempty"`
+	BatchDelay      string  `json:"batchDelay,omitempty" yaml:"batchDelay,omitempty"`
+	APICalls        int     `json:"apiCalls" yaml:"apiCalls"`
+	DurationSeconds float64 `json:"durationSeconds,omitempty" yaml:"durationSeconds,omitempty"`
+}
+
+// addCall adds a step for a single API call
+func (p *executionPlan) addCall(action string, apiCalls int) {
+	p.Steps = append(p.Steps, planStep{Action: action, APICalls: apiCalls})
+	p.APICalls += apiCalls
+}
+
+// addBatches adds a step for records changed in batches of up to maxBatchSize with batchDelay between them. repeat
+// is the number of passes over the records, with a delay between passes too.
+func (p *executionPlan) addBatches(action string, records int, repeat int, maxBatchSize int, batchDelay time.Duration) {
+	if records <= 0 || repeat <= 0 || maxBatchSize <= 0 {
+		return
+	}
+	// the batches are sized like the operations size them, each by the record sets left to change
+	batches, lastBatchSize := 0, 0
+	for remaining := records; remaining > 0; remaining -= lastBatchSize {
+		lastBatchSize = floodzone.BatchSize(remaining, maxBatchSize)
+		batches++
+	}
+	step := planStep{
+		Action:        action,
+		Records:       records * repeat,
+		Batches:       batches * repeat,
+		BatchSize:     floodzone.BatchSize(records, maxBatchSize),
+		LastBatchSize: lastBatchSize,
+		BatchDelay:    batchDelay.String(),
+		APICalls:      batches * repeat,
+	}
+	// there's no delay after the last batch
+	step.DurationSeconds = (time.Duration(step.Batches-1) * batchDelay).Seconds()
+	p.Steps = append(p.Steps, step)
+	p.APICalls += step.APICalls
+	p.Batches += step.Batches
+	p.EstimatedDurationSeconds += step.DurationSeconds
+}
+
+// addPacedCalls adds a step for calls made at rate calls per second
+func (p *executionPlan) addPacedCalls(action string, calls int, rate float64) {
+	if calls <= 0 {
+		return
+	}
+	step := planStep{Action: action, APICalls: calls, DurationSeconds: float64(calls-1) / rate}
+	p.Steps = append(p.Steps, step)
+	p.APICalls += calls
+	p.EstimatedDurationSeconds += step.DurationSeconds
+}
+
+// addWait adds a step that takes a while without calling the API, like sending queries
+func (p *executionPlan) addWait(action string, d time.Duration) {
+	p.Steps = append(p.Steps, planStep{Action: action, DurationSeconds: d.Seconds()})
+	p.EstimatedDurationSeconds += d.Seconds()
+}
+
+// currentRecordSets returns the number of record sets in the zone, or in a new zone if no zone ID is given
+func currentRecordSets(ctx context.Context, zone Zone, opts Options) (int, error) {
+	if opts.HostedZoneID == "" {
+		return newZoneRecordSets, nil
+	}
+	hz, err := zone.R53.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: &opts.HostedZoneID})
+	if err != nil {
+		return 0, fmt.Errorf("unable to describe hosted zone: %w", err)
+	}
+	return int(*hz.HostedZone.ResourceRecordSetCount), nil
+}
+
+// newPlan returns an empty plan of the command for the zone of --hosted-zone-id, or a new zone if there's none
+func newPlan(command string, opts Options) executionPlan {
+	plan := executionPlan{Command: command, Zone: opts.HostedZoneID, Steps: []planStep{}, Cost: newCostEstimate(opts)}
+	if plan.Zone == "" {
+		plan.Zone = "new"
+	}
+	return plan
+}
+
+// planZoneCreation adds the steps to create a zone, and its VPC if requested
+func (p *executionPlan) planZoneCreation(opts Options) error {
+	if err := validateZoneCreation(opts); err != nil {
+		return err
+	}
+	if opts.CreateVPC {
+		// CreateVpc and a ModifyVpcAttribute for each of DNS support and DNS hostnames
+		p.addCall("CreateVPC", 3)
+	}
+	p.addCall("CreateHostedZone", 1)
+	p.Cost.addHostedZones(1)
+	return nil
+}
+
+func planCreate(_ context.Context, _ Zone, opts Options) (executionPlan, error) {
+	plan := newPlan("create", opts)
+	return plan, plan.planZoneCreation(opts)
+}
+
+func planFlood(ctx context.Context, zone Zone, opts Options) (executionPlan, error) {
+	plan := newPlan("flood", opts)
+	if opts.HostedZoneID != "" {
+		if err := validateRecordSetLimit(ctx, zone, opts); err != nil {
+			return plan, err
+		}
+	} else {
+		if err := plan.planZoneCreation(opts); err != nil {
+			return plan, err
+		}
+	}
+	rrCount, err := currentRecordSets(ctx, zone, opts)
+	if err != nil {
+		return plan, err
+	}
+	for _, stage := range opts.loadStages() {
+		plan.addBatches("Create", stage.TotalRecords-rrCount, 1, stage.MaxBatchSize, stage.BatchDelay)
+		rrCount = max(rrCount, stage.TotalRecords)
+	}
+	return plan, nil
+}
+
+func planDelete(ctx context.Context, zone Zone, opts Options) (executionPlan, error) {
+	plan := newPlan("delete", opts)
+	if err := requireZoneID(opts); err != nil {
+		return plan, err
+	}
+	rrCount, err := currentRecordSets(ctx, zone, opts)
+	if err != nil {
+		return plan, err
+	}
+	deletable := rrCount - newZoneRecordSets
+	plan.addBatches("Delete", min(opts.TotalRecords, deletable), 1, opts.MaxBatchSize, opts.BatchDelay)
+	if opts.TotalRecords >= deletable {
+		plan.planZoneDeletion()
+	}
+	return plan, nil
+}
+
+func planChurn(ctx context.Context, zone Zone, opts Options) (executionPlan, error) {
+	plan := newPlan("churn", opts)
+	if err := requireZoneID(opts); err != nil {
+		return plan, err
+	}
+	rrCount, err := currentRecordSets(ctx, zone, opts)
+	if err != nil {
+		return plan, err
+	}
+	// assumes all the record sets are A records, churn only updates those
+	plan.addBatches("Upsert", min(opts.TotalRecords, rrCount-newZoneRecordSets), opts.Iterations, opts.MaxBatchSize, opts.BatchDelay)
+	return plan, nil
+}
+
+func planCleanup(ctx context.Context, zone Zone, opts Options) (executionPlan, error) {
+	plan := newPlan("cleanup", opts)
+	if err := requireZoneID(opts); err != nil {
+		return plan, err
+	}
+	rrCount, err := currentRecordSets(ctx, zone, opts)
+	if err != nil {
+		return plan, err
+	}
+	plan.addBatches("Delete", rrCount-newZoneRecordSets, 1, opts.MaxBatchSize, opts.BatchDelay)
+	plan.planZoneDeletion()
+	return plan, nil
+}
+
+func planQuery(_ context.Context, _ Zone, opts Options) (executionPlan, error) {
+	plan := newPlan("query", opts)
+	if opts.HostedZoneID == "" {
+		// the command doesn't create a zone
+		plan.Zone = "none"
+	}
+	if opts.ForwardTargets != "" {
+		plan.addCall("CreateResolverRule", 1)
+		plan.addCall("AssociateResolverRule", len(splitList(opts.ForwardVPCIDs)))
+	}
+	if opts.CreateEndpoint {
+		plan.addCall("CreateResolverEndpoint", 1)
+	}
+	plan.addWait("Query", opts.QueryDuration)
+	// the rate grows linearly to --qps over --ramp-up, so half as many queries are sent over it
+	plan.Cost.addQueries(int(float64(opts.QPS) * (opts.QueryDuration - opts.RampUp/2).Seconds()))
+	return plan, nil
+}
+
+func planHealthChecks(ctx context.Context, zone Zone, opts Options) (executionPlan, error) {
+	plan := newPlan("health-checks", opts)
+	if opts.HostedZoneID == "" {
+		// the command doesn't create a zone
+		plan.Zone = "none"
+	}
+	if opts.Delete {
+		healthChecks, err := zone.healthChecks(ctx, healthCheckCallerPrefix)
+		if err != nil {
+			return plan, err
+		}
+		plan.addPacedCalls("DeleteHealthCheck", len(healthChecks), opts.CreateRate)
+		return plan, nil
+	}
+	matrix, err := parseHealthCheckMatrix(opts)
+	if err != nil {
+		return plan, err
+	}
+	plan.addPacedCalls("CreateHealthCheck", opts.HealthChecks, opts.CreateRate)
+	if opts.HostedZoneID != "" {
+		plan.addBatches("Create", opts.HealthChecks, 1, healthCheckRecordsPerBatch, 0)
+	}
+	calculated := 0
+	if opts.CalculatedChildren > 0 {
+		for below := opts.HealthChecks; below > 1; {
+			below = (below + opts.CalculatedChildren - 1) / opts.CalculatedChildren
+			plan.addPacedCalls("CreateHealthCheck (calculated)", below, opts.CreateRate)
+			calculated += below
+		}
+	}
+	if opts.HealthCheckWatch > 0 {
+		plan.addWait("Watch", opts.HealthCheckWatch)
+	}
+	plan.Cost.addHealthChecks(matrix, opts, calculated)
+	return plan, nil
+}
+
+func planTrafficPolicies(ctx context.Context, zone Zone, opts Options) (executionPlan, error) {
+	plan := newPlan("traffic-policies", opts)
+	if opts.HostedZoneID == "" {
+		// the command doesn't create a zone
+		plan.Zone = "none"
+	}
+	if opts.Delete {
+		policies, err := zone.trafficPolicies(ctx, trafficPolicyPrefix)
+		if err != nil {
+			return plan, err
+		}
+		policyIDs := map[string]bool{}
+		versions := 0
+		for _, policy := range policies {
+			policyIDs[*policy.Id] = true
+			versions += int(aws.ToInt32(policy.TrafficPolicyCount))
+		}
+		instances, err := zone.trafficPolicyInstances(ctx, "")
+		if err != nil {
+			return plan, err
+		}
+		instances = slices.DeleteFunc(instances, func(instance types.TrafficPolicyInstance) bool {
+			return !policyIDs[aws.ToString(instance.TrafficPolicyId)]
+		})
+		plan.addPacedCalls("DeleteTrafficPolicyInstance", len(instances), opts.CreateRate)
+		plan.addPacedCalls("DeleteTrafficPolicy", versions, opts.CreateRate)
+		return plan, nil
+	}
+	plan.addPacedCalls("CreateTrafficPolicy", opts.TrafficPolicies, opts.CreateRate)
+	for range opts.TrafficPolicyVersions - 1 {
+		plan.addPacedCalls("CreateTrafficPolicyVersion", opts.TrafficPolicies, opts.CreateRate)
+	}
+	plan.addPacedCalls("CreateTrafficPolicyInstance", opts.TrafficPolicyInstances, opts.CreateRate)
+	plan.Cost.addTrafficPolicyRecords(opts.TrafficPolicyInstances)
+	return plan, nil
+}
+
+// planZoneDeletion adds the step to delete the zone. Ephemeral VPCs are deleted with it, but can't be known without
+// describing the VPCs so they aren't included.
+func (p *executionPlan) planZoneDeletion() {
+	p.addCall("DeleteHostedZone", 1)
+}
+
+func (p executionPlan) writeTable(w io.Writer) {
+	fmt.Fprintf(w, "Plan for %s of zone %s:\n\n", p.Command, p.Zone)
+	fmt.Fprintln(w, "STEP\tACTION\tRECORDS\tBATCHES\tBATCH SIZE\tBATCH DELAY\tAPI CALLS\tDURATION")
+	for i, step := range p.Steps {
+		batchSize, batchDelay := "-", "-"
+		if step.Batches > 0 {
+			batchSize = fmt.Sprint(step.BatchSize)
+			if step.LastBatchSize != step.BatchSize {
+				batchSize += fmt.Sprintf(" (last %d)", step.LastBatchSize)
+			}
+			batchDelay = step.BatchDelay
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%s\t%s\t%d\t%s\n", i+1, step.Action, step.Records, step.Batches, batchSize, batchDelay,
+			step.APICalls, secondsDuration(step.DurationSeconds))
+	}
+	fmt.Fprintf(w, "TOTAL\t\t\t%d\t\t\t%d\t%s\n", p.Batches, p.APICalls, secondsDuration(p.EstimatedDurationSeconds))
+	if len(p.Cost.Items) > 0 {
+		fmt.Fprintln(w)
+		p.Cost.writeTable(w)
+	}
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second)
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	progressBarWidth = 30
+	// progressRateWindow is how far back batches are considered when calculating the current rate
+	progressRateWindow = time.Minute
+)
+
+// Progress renders a continuously updating line with records done/total, the current record and request rates, the
+// batches in flight, error count, and ETA.
+// It replaces the per-batch log lines of long runs when attached to a terminal. A nil Progress is a no-op.
+type Progress struct {
+	mu      sync.Mutex
+	out     io.Writer
+	noEmoji bool
+	noColor bool
+	// hidden only tracks the operation for Snapshot, without rendering the line or replacing the per-batch logs
+	hidden bool
+	// width is the length of the last render, used to clear the line without ANSI escape codes
+	width   int
+	action  string
+	total   int
+	done    int
+	errors  int
+	samples []progressSample
+	// inFlight is the number of change batches submitted but not yet answered
+	inFlight int
+	// lastBatch is the size of the last change batch, to estimate how many are left
+	lastBatch int
+	// requests are when the change batches within the rate window were submitted
+	requests []time.Time
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+type progressSample struct {
+	at   time.Time
+	done int
+}
+
+// NewProgress returns a Progress writing to stderr, or nil if stderr is not a terminal so that callers fall back to
+// plain logs. noEmoji and noColor render the line without emoji and ANSI escape codes.
+func NewProgress(noEmoji bool, noColor bool) *Progress {
+	if !isTerminal(os.Stderr) {
+		return nil
+	}
+	return &Progress{out: os.Stderr, noEmoji: noEmoji, noColor: noColor}
+}
+
+// newTrackingProgress returns a hidden Progress for dashboards that render the progress themselves
+func newTrackingProgress() *Progress {
+	return &Progress{out: io.Discard, noEmoji: true, noColor: true, hidden: true}
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Start begins tracking a new operation and re-renders every second so the ETA keeps moving between batches
+func (p *Progress) Start(action string, done int, total int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.action = action
+	p.done = done
+	p.total = total
+	p.errors = 0
+	p.samples = []progressSample{{at: time.Now(), done: done}}
+	p.inFlight = 0
+	p.lastBatch = 0
+	p.requests = nil
+	p.stop = make(chan struct{})
+	p.stopped = make(chan struct{})
+	p.mu.Unlock()
+	go func() {
+		defer close(p.stopped)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.render()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+	p.render()
+}
+
+// Add records n more completed records
+func (p *Progress) Add(n int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.done += n
+	p.lastBatch = n
+	p.samples = append(p.samples, progressSample{at: time.Now(), done: p.done})
+	p.mu.Unlock()
+	p.render()
+}
+
+// BatchStarted records a change batch being submitted
+func (p *Progress) BatchStarted() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.inFlight++
+	p.requests = append(p.requests, time.Now())
+	p.mu.Unlock()
+	p.render()
+}
+
+// BatchFinished records the response to a change batch, counting it as an error if err is set
+func (p *Progress) BatchFinished(err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.inFlight--
+	if err != nil {
+		p.errors++
+	}
+	p.mu.Unlock()
+	p.render()
+}
+
+// Finish stops updating and leaves the final state of the line on the terminal
+func (p *Progress) Finish() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	<-p.stopped
+	if p.hidden {
+		return
+	}
+	p.render()
+	fmt.Fprintln(p.out)
+}
+
+// rate returns records per second over the recent rate window
+func (p *Progress) rate(now time.Time) float64 {
+	first := p.samples[0]
+	for _, s := range p.samples {
+		if now.Sub(s.at) <= progressRateWindow {
+			first = s
+			break
+		}
+	}
+	elapsed := now.Sub(first.at).Seconds()
+	if elapsed <= 0 || p.done == first.done {
+		// fall back to the whole run so the rate doesn't drop to 0 during a long batch delay
+		first = p.samples[0]
+		elapsed = now.Sub(first.at).Seconds()
+		if elapsed <= 0 {
+			return 0
+		}
+	}
+	return float64(p.done-first.done) / elapsed
+}
+
+// requestRate returns change batches submitted per second over the recent rate window
+func (p *Progress) requestRate(now time.Time) float64 {
+	for len(p.requests) > 0 && now.Sub(p.requests[0]) > progressRateWindow {
+		p.requests = p.requests[1:]
+	}
+	window := progressRateWindow
+	if elapsed := now.Sub(p.samples[0].at); elapsed < window {
+		window = elapsed
+	}
+	if window <= 0 {
+		return 0
+	}
+	return float64(len(p.requests)) / window.Seconds()
+}
+
+// progressSnapshot is the state of the current operation
+type progressSnapshot struct {
+	Action      string  `json:"action"`
+	Done        int     `json:"done"`
+	Total       int     `json:"total"`
+	Ratio       float64 `json:"ratio"`
+	Rate        float64 `json:"recordsPerSecond"`
+	RequestRate float64 `json:"requestsPerSecond"`
+	InFlight    int     `json:"inFlight"`
+	// Queued is the number of change batches left to submit, estimated from the size of the last batch
+	Queued int    `json:"queued"`
+	Errors int    `json:"errors"`
+	ETA    string `json:"eta"`
+}
+
+// Snapshot returns the state of the current operation for displays other than the progress line
+func (p *Progress) Snapshot() progressSnapshot {
+	if p == nil {
+		return progressSnapshot{}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.snapshot(time.Now())
+}
+
+func (p *Progress) snapshot(now time.Time) progressSnapshot {
+	snap := progressSnapshot{Action: p.action, Done: p.done, Total: p.total, Ratio: 1, InFlight: p.inFlight, Errors: p.errors, ETA: "--"}
+	if len(p.samples) == 0 {
+		return snap
+	}
+	if p.total > 0 {
+		snap.Ratio = float64(p.done) / float64(p.total)
+	}
+	snap.Rate = p.rate(now)
+	snap.RequestRate = p.requestRate(now)
+	remaining := p.total - p.done
+	if remaining <= 0 {
+		snap.ETA = "0s"
+	} else if snap.Rate > 0 {
+		snap.ETA = time.Duration(float64(remaining) / snap.Rate * float64(time.Second)).Round(time.Second).String()
+	}
+	if remaining > 0 && p.lastBatch > 0 {
+		snap.Queued = (remaining + p.lastBatch - 1) / p.lastBatch
+	}
+	return snap
+}
+
+func (p *Progress) render() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.hidden {
+		return
+	}
+	snap := p.snapshot(time.Now())
+	filled := int(snap.Ratio * progressBarWidth)
+	if filled > progressBarWidth {
+		filled = progressBarWidth
+	}
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+	line := fmt.Sprintf("%s [%s] %d/%d %3.0f%%  %.1f records/s  %.2f req/s  in-flight: %d  errors: %d  ETA: %s",
+		snap.Action, bar, snap.Done, snap.Total, snap.Ratio*100, snap.Rate, snap.RequestRate, snap.InFlight, snap.Errors, snap.ETA)
+	if !p.noEmoji {
+		line = "🌊 " + line
+	}
+	// \r returns to the start of the line and \033[K clears what's left of the previous render, or without ANSI
+	// escape codes pad with spaces over the previous render
+	if p.noColor {
+		width := len([]rune(line))
+		if pad := p.width - width; pad > 0 {
+			line += strings.Repeat(" ", pad)
+		}
+		p.width = width
+		fmt.Fprint(p.out, "\r"+line)
+		return
+	}
+	fmt.Fprint(p.out, "\r"+line+"\033[K")
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+const (
+	defaultPropagationPollInterval = 2 * time.Second
+	// propagationWaitTimeout bounds how long the end of a run waits for the last changes to propagate
+	propagationWaitTimeout = 5 * time.Minute
+)
+
+// pendingChange is a submitted change batch that isn't INSYNC yet
+type pendingChange struct {
+	id        string
+	submitted time.Time
+}
+
+// PropagationTracker polls GetChange for every submitted change batch in the background and records how long each
+// took to be INSYNC on all Route 53 DNS servers. Every pending change is polled once per interval, so the measurement
+// is accurate to the interval. A nil PropagationTracker is a no-op.
+type PropagationTracker struct {
+	mu       sync.Mutex
+	client   route53.GetChangeAPIClient
+	stats    *RunStats
+	interval time.Duration
+	pending  []pendingChange
+	// polling is canceled by Close, which stops polling including the GetChange calls in flight
+	polling     context.Context
+	stopPolling context.CancelFunc
+	stopped     chan struct{}
+}
+
+// NewPropagationTracker starts polling the changes passed to Track until Close is called
+func NewPropagationTracker(client route53.GetChangeAPIClient, stats *RunStats, interval time.Duration) *PropagationTracker {
+	p := &PropagationTracker{
+		client:   client,
+		stats:    stats,
+		interval: interval,
+		stopped:  make(chan struct{}),
+	}
+	p.polling, p.stopPolling = context.WithCancel(context.Background())
+	go func() {
+		defer close(p.stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.poll(p.polling)
+			case <-p.polling.Done():
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// Track starts measuring the propagation of a change batch submitted at submitted
+func (p *PropagationTracker) Track(changeInfo *types.ChangeInfo, submitted time.Time) {
+	if p == nil || changeInfo == nil {
+		return
+	}
+	if changeInfo.Status == types.ChangeStatusInsync {
+		p.stats.RecordPropagation(time.Since(submitted))
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = append(p.pending, pendingChange{id: aws.ToString(changeInfo.Id), submitted: submitted})
+}
+
+// Close waits for the pending changes to propagate, up to propagationWaitTimeout, and stops polling
+func (p *PropagationTracker) Close(ctx context.Context) {
+	if p == nil {
+		return
+	}
+	defer func() {
+		p.stopPolling()
+		<-p.stopped
+	}()
+	ctx, cancel := context.WithTimeout(ctx, propagationWaitTimeout)
+	defer cancel()
+	if pending := p.remaining(); pending > 0 {
+		slog.Info("⏳ Waiting for the last changes to propagate", "pending", pending)
+	}
+	for p.remaining() > 0 {
+		select {
+		case <-ctx.Done():
+			slog.Warn("gave up waiting for changes to propagate", "pending", p.remaining())
+			return
+		case <-time.After(p.interval):
+		}
+	}
+}
+
+func (p *PropagationTracker) remaining() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.pending)
+}
+
+// poll checks every pending change once, recording the ones that are INSYNC
+func (p *PropagationTracker) poll(ctx context.Context) {
+	p.mu.Lock()
+	pending := p.pending
+	p.mu.Unlock()
+	done := map[string]bool{}
+	for _, change := range pending {
+		if ctx.Err() != nil {
+			break
+		}
+		out, err := p.client.GetChange(ctx, &route53.GetChangeInput{Id: aws.String(change.id)})
+		if err != nil {
+			slog.Debug("unable to get change status", "changeId", change.id, "error", err)
+			continue
+		}
+		if out.ChangeInfo.Status != types.ChangeStatusInsync {
+			continue
+		}
+		propagation := time.Since(change.submitted)
+		slog.Debug("Change propagated", "changeId", change.id, "propagation", propagation)
+		p.stats.RecordPropagation(propagation)
+		done[change.id] = true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	remaining := p.pending[:0]
+	for _, change := range p.pending {
+		if !done[change.id] {
+			remaining = append(remaining, change)
+		}
+	}
+	p.pending = remaining
+}
@@ -0,0 +1,1000 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/google/uuid"
+)
+
+const (
+	// queryTimeout is how long a single DNS query waits for an answer before it fails, by default in the query command
+	queryTimeout = 5 * time.Second
+	// queryLogInterval is how often a query flood logs its progress
+	queryLogInterval = 10 * time.Second
+)
+
+// queryTarget is a record set to query
+type queryTarget struct {
+	name   string
+	rrType types.RRType
+	// blocked record sets are blocked by DNS Firewall, the queries for them succeed when they're answered NXDOMAIN
+	blocked bool
+}
+
+// queryResult is the output of the query command
+type queryResult struct {
+	Resolver        string  `json:"resolver" yaml:"resolver"`
+	RecordSets      int     `json:"recordSets" yaml:"recordSets"`
+	DurationSeconds float64 `json:"durationSeconds" yaml:"durationSeconds"`
+	Queries         int     `json:"queries" yaml:"queries"`
+	// Misses are the queries for names that don't exist, they succeed when they're answered with NXDOMAIN
+	Misses    int `json:"misses" yaml:"misses"`
+	Succeeded int `json:"succeeded" yaml:"succeeded"`
+	Failed    int `json:"failed" yaml:"failed"`
+	// Skipped queries weren't sent because every worker was still waiting for an answer
+	Skipped     int     `json:"skipped" yaml:"skipped"`
+	QPS         float64 `json:"qps" yaml:"qps"`
+	SuccessRate float64 `json:"successRate" yaml:"successRate"`
+	// Latency is of the queries for existing record sets, including the failed ones
+	Latency latencyStats `json:"latency" yaml:"latency"`
+	// MissLatency is of the queries for names that don't exist, if there were any
+	MissLatency *latencyStats `json:"missLatency,omitempty" yaml:"missLatency,omitempty"`
+	// Uncached are the queries for unique names with --cache-bust-percent, which resolvers can't answer from their
+	// cache, and UncachedLatency is their latency
+	Uncached        int           `json:"uncached" yaml:"uncached"`
+	UncachedLatency *latencyStats `json:"uncachedLatency,omitempty" yaml:"uncachedLatency,omitempty"`
+	// Failures counts the failed queries by reason, e.g. NXDOMAIN or timeout
+	Failures map[string]int `json:"failures,omitempty" yaml:"failures,omitempty"`
+	// Subnets break the queries for existing record sets down by their EDNS client subnet, if they carried one
+	Subnets []subnetResult `json:"subnets,omitempty" yaml:"subnets,omitempty"`
+	// Truncation breaks the queries for existing record sets down by type with how many were answered truncated over
+	// UDP, if they were sent over UDP
+	Truncation []truncationResult `json:"truncation,omitempty" yaml:"truncation,omitempty"`
+	// Retried queries were sent more than once with --attempts, Retries is how many times they were sent again, and the
+	// Recovered ones were answered in the end
+	Retried   int `json:"retried" yaml:"retried"`
+	Retries   int `json:"retries" yaml:"retries"`
+	Recovered int `json:"recovered" yaml:"recovered"`
+	// DNSSEC is how many of the queries for existing record sets were answered authenticated, with --dnssec
+	DNSSEC *dnssecResult `json:"dnssec,omitempty" yaml:"dnssec,omitempty"`
+	// Correctness is how many of the answers had the values of the manifest, with --check-answers
+	Correctness *correctnessResult `json:"correctness,omitempty" yaml:"correctness,omitempty"`
+	// latencies are of the queries for existing record sets, for query workers to send back a sample of
+	latencies []time.Duration
+}
+
+// truncationResult is how many of the queries for a type were answered truncated over UDP. With --protocol udp the
+// truncated queries were retried over TCP, with udp-only they failed.
+type truncationResult struct {
+	Type           string  `json:"type" yaml:"type"`
+	Queries        int     `json:"queries" yaml:"queries"`
+	Truncated      int     `json:"truncated" yaml:"truncated"`
+	TruncationRate float64 `json:"truncationRate" yaml:"truncationRate"`
+}
+
+// maxSubnetAnswers is how many of the most common answers to the queries from a subnet are listed
+const maxSubnetAnswers = 3
+
+// subnetResult is the outcome of the queries from an EDNS client subnet
+type subnetResult struct {
+	Subnet  string `json:"subnet" yaml:"subnet"`
+	Queries int    `json:"queries" yaml:"queries"`
+	Failed  int    `json:"failed" yaml:"failed"`
+	// Expect is the answer the queries from the subnet should get, if any
+	Expect string `json:"expect,omitempty" yaml:"expect,omitempty"`
+	// Unexpected queries were answered without the expected answer, they're counted as failed
+	Unexpected int `json:"unexpected" yaml:"unexpected"`
+	// TopAnswers are the most common answers to the queries from the subnet
+	TopAnswers []answerCount `json:"topAnswers" yaml:"topAnswers"`
+}
+
+// answerCount is how many queries got an answer
+type answerCount struct {
+	Answer  string `json:"answer" yaml:"answer"`
+	Queries int    `json:"queries" yaml:"queries"`
+}
+
+func (r queryResult) writeTable(w io.Writer) {
+	fmt.Fprintln(w, "RESOLVER\tRECORD SETS\tDURATION\tQUERIES\tMISSES\tSUCCEEDED\tFAILED\tSKIPPED\tQPS\tSUCCESS RATE")
+	fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%d\t%d\t%d\t%d\t%.1f\t%.2f%%\n", r.Resolver, r.RecordSets,
+		(time.Duration(r.DurationSeconds * float64(time.Second))).Round(time.Second), r.Queries, r.Misses, r.Succeeded, r.Failed, r.Skipped, r.QPS, r.SuccessRate)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "LATENCY\tMIN\tMEAN\tP50\tP90\tP99\tMAX")
+	fmt.Fprintf(w, "DNS query\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%.1fms\n",
+		r.Latency.Min, r.Latency.Mean, r.Latency.P50, r.Latency.P90, r.Latency.P99, r.Latency.Max)
+	if l := r.MissLatency; l != nil {
+		fmt.Fprintf(w, "DNS query (NXDOMAIN)\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%.1fms\n", l.Min, l.Mean, l.P50, l.P90, l.P99, l.Max)
+	}
+	if l := r.UncachedLatency; l != nil {
+		fmt.Fprintf(w, "DNS query (uncached)\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%.1fms\n", l.Min, l.Mean, l.P50, l.P90, l.P99, l.Max)
+	}
+	if len(r.Subnets) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "SUBNET\tQUERIES\tFAILED\tEXPECT\tUNEXPECTED\tTOP ANSWERS")
+		for _, s := range r.Subnets {
+			answers := make([]string, 0, len(s.TopAnswers))
+			for _, a := range s.TopAnswers {
+				answers = append(answers, fmt.Sprintf("%s (%d)", a.Answer, a.Queries))
+			}
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%d\t%s\n", s.Subnet, s.Queries, s.Failed, s.Expect, s.Unexpected, strings.Join(answers, ", "))
+		}
+	}
+	if r.Retried > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "RETRIED QUERIES\tRETRIES\tRECOVERED")
+		fmt.Fprintf(w, "%d\t%d\t%d\n", r.Retried, r.Retries, r.Recovered)
+	}
+	if d := r.DNSSEC; d != nil {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "DNSSEC QUERIES\tAUTHENTICATED\tUNAUTHENTICATED\tSERVFAIL\tVALIDATION FAILURE RATE")
+		fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%.2f%%\n", d.Queries, d.Authenticated, d.Unauthenticated, d.ServFail, d.ValidationFailureRate)
+	}
+	if c := r.Correctness; c != nil {
+		fmt.Fprintln(w)
+		c.writeTable(w)
+	}
+	if len(r.Truncation) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "TYPE\tQUERIES\tTRUNCATED\tTRUNCATION RATE")
+		for _, t := range r.Truncation {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%.2f%%\n", t.Type, t.Queries, t.Truncated, t.TruncationRate)
+		}
+	}
+	if len(r.Failures) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	writeFailures(w, r.Failures)
+}
+
+// writeFailures writes a table of the failed queries by reason
+func writeFailures(w io.Writer, failures map[string]int) {
+	reasons := make([]string, 0, len(failures))
+	for reason := range failures {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	fmt.Fprintln(w, "FAILURE\tQUERIES")
+	for _, reason := range reasons {
+		fmt.Fprintf(w, "%s\t%d\n", reason, failures[reason])
+	}
+}
+
+func runQuery(ctx context.Context, zone Zone, opts Options) error {
+	targets, err := queryTargets(ctx, zone, opts)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return errors.New("there are no A, AAAA, CNAME, TXT, MX, or SRV record sets to query")
+	}
+	if opts.ForwardTargets != "" {
+		rule, err := createForwardingRule(ctx, zone, opts)
+		if rule != nil {
+			defer func() {
+				if err := zone.DeleteForwardingRule(context.WithoutCancel(ctx), rule); err != nil {
+					slog.Error("unable to clean up forwarding rule, it must be deleted manually", "rule", rule.ID, "error", err)
+				}
+			}()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	addresses := splitList(opts.Resolver)
+	switch {
+	case opts.CreateEndpoint:
+		endpointID, err := zone.CreateInboundEndpoint(ctx, splitList(opts.EndpointSubnets), splitList(opts.EndpointSecGroups))
+		if endpointID != "" {
+			// the endpoint is billed by the hour, so it's deleted even when the run is interrupted
+			defer func() {
+				if err := zone.DeleteResolverEndpoint(context.WithoutCancel(ctx), endpointID); err != nil {
+					slog.Error("unable to clean up inbound endpoint, it must be deleted manually", "endpoint", endpointID, "error", err)
+				}
+			}()
+		}
+		if err != nil {
+			return err
+		}
+		if addresses, err = zone.InboundEndpointAddresses(ctx, endpointID); err != nil {
+			return err
+		}
+	case opts.ResolverEndpointID != "":
+		if addresses, err = zone.InboundEndpointAddresses(ctx, opts.ResolverEndpointID); err != nil {
+			return err
+		}
+	}
+	if opts.CacheBustPercent > 0 && opts.CacheBustMode == cacheBustWildcard && len(wildcardTargets(targets)) == 0 {
+		if opts.FromManifest != "" {
+			return errors.New("there are no wildcard record sets in the manifest to query random names under with --cache-bust-mode wildcard")
+		}
+		rr, err := zone.CreateCacheBustWildcard(ctx, opts.HostedZoneID, opts.RunID)
+		if rr != nil {
+			defer func() {
+				if err := zone.DeleteCacheBustWildcard(context.WithoutCancel(ctx), opts.HostedZoneID, rr); err != nil {
+					slog.Error("unable to clean up cache busting wildcard record set, it must be deleted manually", "name", aws.ToString(rr.Name), "error", err)
+				}
+			}()
+		}
+		if err != nil {
+			return err
+		}
+		targets = append(targets, queryTarget{name: aws.ToString(rr.Name), rrType: rr.Type})
+	}
+	if opts.DNSSEC && opts.FromManifest == "" {
+		if err := warnUnsignedZone(ctx, zone, opts.HostedZoneID); err != nil {
+			return err
+		}
+	}
+	if zone.LambdaWorkers != nil {
+		result, err := zone.LambdaWorkers.Run(ctx, targets, opts, zone.Budget)
+		if err != nil {
+			return err
+		}
+		if err := printOutput(opts.Output, result); err != nil {
+			return err
+		}
+		return budgetCause(ctx)
+	}
+	if zone.InstanceWorkers != nil {
+		// the instances are in the VPC, so they can query the addresses of an inbound endpoint too
+		opts.Resolver = strings.Join(addresses, ",")
+		result, err := zone.InstanceWorkers.Run(ctx, targets, opts, zone.Budget)
+		if err != nil {
+			return err
+		}
+		if err := printOutput(opts.Output, result); err != nil {
+			return err
+		}
+		return budgetCause(ctx)
+	}
+	load := newQueryLoad(opts)
+	load.budget = zone.Budget
+	if opts.CheckAnswers {
+		if load.answers, err = NewAnswerChecker(ctx, zone.Artifacts, opts.FromManifest); err != nil {
+			return err
+		}
+		followCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		go load.answers.Follow(followCtx, opts.ManifestRefresh)
+	}
+	resolver, address := newProtocolResolver(opts.QueryProtocol, addresses...)
+	result, err := floodQueries(ctx, resolver, address, targets, load)
+	if err != nil {
+		return err
+	}
+	if err := printOutput(opts.Output, result); err != nil {
+		return err
+	}
+	// the queries sent until the budget stopped the run are still reported, but the run failed
+	return budgetCause(ctx)
+}
+
+// newQueryLoad returns the query load of the flags, which were validated upfront
+func newQueryLoad(opts Options) queryLoad {
+	typeMix, _ := parseQueryTypeMix(opts.QueryTypeMix)
+	subnets, _ := parseEDNSSubnets(opts.EDNSSubnets)
+	return queryLoad{
+		qps:          opts.QPS,
+		concurrency:  opts.Concurrency,
+		duration:     opts.QueryDuration,
+		missPercent:  opts.MissPercent,
+		missNames:    opts.MissNames,
+		typeMix:      typeMix,
+		popularity:   opts.Popularity,
+		zipfExponent: opts.ZipfExponent,
+		rampUp:       opts.RampUp,
+		subnets:      subnets,
+		protocol:     opts.QueryProtocol,
+		dnssec:       opts.DNSSEC,
+		randomCase:   opts.RandomizeCase,
+		attempts:     opts.QueryAttempts,
+		timeout:      opts.QueryTimeout,
+
+		cacheBustPercent: opts.CacheBustPercent,
+		cacheBustMode:    opts.CacheBustMode,
+	}
+}
+
+// createForwardingRule creates the forwarding rule of --forward-targets for --forward-domain, defaulting to the name of
+// the zone, so that the queries from the associated VPCs take the forwarding path
+func createForwardingRule(ctx context.Context, zone Zone, opts Options) (*ForwardingRule, error) {
+	targets, err := parseForwardTargets(opts.ForwardTargets)
+	if err != nil {
+		return nil, err
+	}
+	domain := opts.ForwardDomain
+	if domain == "" {
+		hz, err := zone.R53.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: &opts.HostedZoneID})
+		if err != nil {
+			return nil, fmt.Errorf("unable to describe hosted zone: %w", err)
+		}
+		domain = aws.ToString(hz.HostedZone.Name)
+	}
+	return zone.CreateForwardingRule(ctx, domain, opts.OutboundEndpoint, targets, splitList(opts.ForwardVPCIDs))
+}
+
+// queryTargets returns the record sets of --from-manifest, or of the zone, that can be queried
+func queryTargets(ctx context.Context, zone Zone, opts Options) ([]queryTarget, error) {
+	var targets []queryTarget
+	if opts.FromManifest != "" {
+		manifest, err := readManifest(ctx, zone.Artifacts, opts.FromManifest)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range manifest.Records {
+			if rrType := types.RRType(record.Type); slices.Contains(resolvableTypes, rrType) {
+				targets = append(targets, queryTarget{name: record.Name, rrType: rrType, blocked: record.Blocked})
+			}
+		}
+		return targets, nil
+	}
+	if err := requireZoneID(opts); err != nil {
+		return nil, err
+	}
+	hz, err := zone.R53.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: &opts.HostedZoneID})
+	if err != nil {
+		return nil, fmt.Errorf("unable to describe hosted zone: %w", err)
+	}
+	rrs, err := zone.ListResourceRecordSets(ctx, hz.HostedZone, maxListItems)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list resource record sets: %w", err)
+	}
+	for _, rr := range rrs {
+		// alias records can point anywhere, only query the records the zone answers itself
+		if rr.AliasTarget == nil && slices.Contains(resolvableTypes, rr.Type) {
+			targets = append(targets, queryTarget{name: aws.ToString(rr.Name), rrType: rr.Type})
+		}
+	}
+	return targets, nil
+}
+
+// queryLoad is the rate and mix of the queries of a query flood
+type queryLoad struct {
+	qps         int
+	concurrency int
+	duration    time.Duration
+	// missPercent of the queries are for names next to the targets that don't exist
+	missPercent float64
+	// missNames is how many names that don't exist are queried over and over, 0 for a new one every query
+	missNames int
+	// typeMix is the relative weight of each record type to query, nil queries the types as often as they're in the zone
+	typeMix map[types.RRType]int
+	// popularity is how often each name is queried, uniform or zipf
+	popularity   string
+	zipfExponent float64
+	// rampUp is how long the rate grows for from 1 query per second to qps
+	rampUp time.Duration
+	// subnets are the EDNS client subnets the queries carry round robin, none for no client subnet
+	subnets []ednsSubnet
+	// protocol is the --protocol the queries are sent over, their truncation is measured over udp and udp-only
+	protocol string
+	// dnssec asks for authenticated answers, the queries for existing record sets fail without them
+	dnssec bool
+	// randomCase sends the names in random case, the queries fail when they're answered in another case
+	randomCase bool
+	// attempts is how many times a query is sent before it fails, timeout is how long each attempt waits for an answer
+	attempts int
+	timeout  time.Duration
+	// answers checks the answers against the values of the manifest, nil to not check them
+	answers *AnswerChecker
+	// cacheBustPercent of the queries are for unique names no resolver has cached, under the targets or their wildcards
+	// depending on cacheBustMode
+	cacheBustPercent float64
+	cacheBustMode    string
+	// budget is charged for every query sent, nil for no --max-cost
+	budget *CostBudget
+}
+
+// retriedFailures are the reasons a query is sent again if it has attempts left, like stub resolvers retry timeouts and
+// move on to the next server on SERVFAIL or a network error
+var retriedFailures = []string{"timeout", "SERVFAIL", "network error", "connection refused", "case mismatch"}
+
+const (
+	// popularityUniform queries the record sets round robin
+	popularityUniform = "uniform"
+	// popularityZipf queries a few record sets most of the time and the rest rarely, like production traffic
+	popularityZipf = "zipf"
+)
+
+// queryPicker picks the record set of each query by the type mix and popularity of a query load, it's safe to use
+// from multiple workers
+type queryPicker struct {
+	mu      sync.Mutex
+	rand    *rand.Rand
+	types   []types.RRType
+	weights []int
+	total   int
+	targets map[types.RRType][]queryTarget
+	next    map[types.RRType]int
+	zipf    map[types.RRType]*rand.Zipf
+}
+
+// newQueryPicker returns a picker of the targets. The types of the type mix that aren't in the targets are left out,
+// and an error is returned if that leaves none.
+func newQueryPicker(targets []queryTarget, load queryLoad) (*queryPicker, error) {
+	p := &queryPicker{
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		targets: map[types.RRType][]queryTarget{},
+		next:    map[types.RRType]int{},
+		zipf:    map[types.RRType]*rand.Zipf{},
+	}
+	for _, target := range targets {
+		p.targets[target.rrType] = append(p.targets[target.rrType], target)
+	}
+	mix := load.typeMix
+	if len(mix) == 0 {
+		// without a mix every record set is as likely to be queried as the others
+		mix = map[types.RRType]int{}
+		for rrType, byType := range p.targets {
+			mix[rrType] = len(byType)
+		}
+	}
+	for _, rrType := range resolvableTypes {
+		weight := mix[rrType]
+		if weight == 0 {
+			continue
+		}
+		byType := p.targets[rrType]
+		if len(byType) == 0 {
+			slog.Warn("there are no record sets of a type in the query type mix to query", "type", rrType)
+			continue
+		}
+		p.types = append(p.types, rrType)
+		p.weights = append(p.weights, weight)
+		p.total += weight
+		if load.popularity == popularityZipf {
+			// the most popular names are random rather than the first ones listed
+			p.rand.Shuffle(len(byType), func(i, j int) { byType[i], byType[j] = byType[j], byType[i] })
+			p.zipf[rrType] = rand.NewZipf(p.rand, load.zipfExponent, 1, uint64(len(byType)-1))
+		}
+	}
+	if len(p.types) == 0 {
+		return nil, errors.New("there are no record sets of the types in the query type mix to query")
+	}
+	return p, nil
+}
+
+// pick returns the record set to query next
+func (p *queryPicker) pick() queryTarget {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rrType := p.types[0]
+	for i, n := 0, p.rand.Intn(p.total); i < len(p.types); i++ {
+		if n < p.weights[i] {
+			rrType = p.types[i]
+			break
+		}
+		n -= p.weights[i]
+	}
+	byType := p.targets[rrType]
+	if zipf, ok := p.zipf[rrType]; ok {
+		return byType[zipf.Uint64()]
+	}
+	target := byType[p.next[rrType]%len(byType)]
+	p.next[rrType]++
+	return target
+}
+
+// rate returns the queries per second to send elapsed into a query flood, growing linearly over the ramp-up
+func (l queryLoad) rate(elapsed time.Duration) int {
+	if l.rampUp <= 0 || elapsed >= l.rampUp {
+		return l.qps
+	}
+	return max(1, int(float64(l.qps)*elapsed.Seconds()/l.rampUp.Seconds()))
+}
+
+// floodQueries queries the targets at the rate of the load from up to its concurrency workers for its duration, or until
+// ctx is done. The targets are picked by the type mix and popularity of the load. Some of the queries are for names
+// next to the targets that don't exist instead, to exercise the NXDOMAIN handling and negative caching of the resolver.
+func floodQueries(ctx context.Context, resolver *net.Resolver, address string, targets []queryTarget, load queryLoad) (queryResult, error) {
+	qps, concurrency, duration := load.qps, load.concurrency, load.duration
+	result := queryResult{Resolver: address, RecordSets: len(targets), Failures: map[string]int{}}
+	wildcards := wildcardTargets(targets)
+	picker, err := newQueryPicker(queriedWildcards(targets), load)
+	if err != nil {
+		return result, err
+	}
+	if load.cacheBustPercent > 0 && load.cacheBustMode == cacheBustWildcard && len(wildcards) == 0 {
+		return result, errors.New("there are no wildcard record sets to query random names under with --cache-bust-mode wildcard")
+	}
+	slog.Info("🔎 Starting DNS query flood", "resolver", address, "recordSets", len(targets), "qps", qps, "concurrency", concurrency,
+		"duration", duration, "rampUp", load.rampUp, "popularity", load.popularity, "missPercent", load.missPercent)
+	// a fixed set of missing names is answered from the negative cache of the resolver after the first query
+	var missNames []queryTarget
+	for i := 0; i < load.missNames; i++ {
+		missNames = append(missNames, missTarget(targets[i%len(targets)]))
+	}
+	floodCtx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	var mu sync.Mutex
+	var latencies, missLatencies, uncachedLatencies []time.Duration
+	var nextSubnet atomic.Int64
+	subnetAnswers := make([]map[string]int, len(load.subnets))
+	for i, subnet := range load.subnets {
+		subnetAnswers[i] = map[string]int{}
+		result.Subnets = append(result.Subnets, subnetResult{Subnet: subnet.prefix.String(), Expect: subnet.expect})
+	}
+	if load.dnssec {
+		result.DNSSEC = &dnssecResult{}
+	}
+	measureTruncation := load.protocol == dnsProtocolUDP || load.protocol == dnsProtocolUDPOnly
+	truncation := map[types.RRType]*truncationResult{}
+	// a worker takes a token per query, so the queries are paced by the ticker rather than by how fast they're answered
+	tokens := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range tokens {
+				target := picker.pick()
+				bust := rand.Float64()*100 < load.cacheBustPercent
+				miss := !bust && rand.Float64()*100 < load.missPercent
+				blocked := target.blocked && !bust && !miss
+				// the queries for existing record sets are the ones whose answers are checked
+				exists := !miss && !(bust && load.cacheBustMode == cacheBustNXDomain) && !blocked
+				switch {
+				case bust:
+					target = cacheBustTarget(target, load.cacheBustMode, wildcards)
+				case miss && len(missNames) > 0:
+					target = missNames[rand.Intn(len(missNames))]
+				case miss:
+					target = missTarget(target)
+				}
+				queryCtx := ctx
+				subnet := -1
+				if len(load.subnets) > 0 {
+					subnet = int(nextSubnet.Add(1)-1) % len(load.subnets)
+					queryCtx = withECS(queryCtx, load.subnets[subnet].prefix)
+				}
+				if load.dnssec {
+					queryCtx = withDNSSEC(queryCtx)
+				}
+				if load.randomCase {
+					queryCtx = withRandomCase(queryCtx)
+				}
+				var answers []string
+				var err error
+				var trace *queryTrace
+				var reason string
+				attempts := 0
+				start := time.Now()
+				// the query is retried like a stub resolver does, the latency is of every attempt together
+				for attempts < load.attempts {
+					attempts++
+					attemptCtx, cancel := context.WithTimeout(queryCtx, load.timeout)
+					attemptCtx, trace = withQueryTrace(attemptCtx)
+					answers, err = lookupRecord(attemptCtx, resolver, target.rrType, target.name)
+					cancel()
+					reason = queryFailure(answers, err)
+					if reason == "" && trace.caseMismatch.Load() {
+						reason = "case mismatch"
+					}
+					if !slices.Contains(retriedFailures, reason) || ctx.Err() != nil {
+						break
+					}
+				}
+				latency := time.Since(start)
+				load.budget.AddQueries(attempts)
+				// queries interrupted by the end of the run didn't fail
+				if ctx.Err() != nil {
+					continue
+				}
+				mu.Lock()
+				result.Queries++
+				if attempts > 1 {
+					result.Retried++
+					result.Retries += attempts - 1
+					if reason == "" {
+						result.Recovered++
+					}
+				}
+				switch {
+				case miss:
+					result.Misses++
+					missLatencies = append(missLatencies, latency)
+					reason = missFailure(reason)
+				case bust:
+					result.Uncached++
+					uncachedLatencies = append(uncachedLatencies, latency)
+					if !exists {
+						reason = missFailure(reason)
+					}
+				case blocked:
+					latencies = append(latencies, latency)
+					reason = blockedFailure(reason)
+				default:
+					latencies = append(latencies, latency)
+				}
+				if measureTruncation && exists {
+					t, ok := truncation[target.rrType]
+					if !ok {
+						t = &truncationResult{Type: string(target.rrType)}
+						truncation[target.rrType] = t
+					}
+					t.Queries++
+					if trace.truncated.Load() {
+						t.Truncated++
+					}
+				}
+				if d := result.DNSSEC; d != nil && exists {
+					d.Queries++
+					switch {
+					case reason == "SERVFAIL":
+						d.ServFail++
+					case reason != "":
+					case trace.authenticated.Load():
+						d.Authenticated++
+					default:
+						d.Unauthenticated++
+						reason = "not authenticated"
+					}
+				}
+				if reason == "" && exists {
+					reason = load.answers.Check(target, answers)
+				}
+				if subnet >= 0 && exists {
+					s := &result.Subnets[subnet]
+					s.Queries++
+					for _, answer := range answers {
+						subnetAnswers[subnet][normalizeAnswer(answer)]++
+					}
+					if reason == "" && s.Expect != "" && !slices.ContainsFunc(answers, func(a string) bool { return normalizeAnswer(a) == s.Expect }) {
+						s.Unexpected++
+						reason = "unexpected answer"
+					}
+					if reason != "" {
+						s.Failed++
+					}
+				}
+				if reason != "" {
+					result.Failed++
+					result.Failures[reason]++
+					slog.Debug("DNS query failed", "name", target.name, "type", target.rrType, "reason", reason, "error", err)
+				} else {
+					result.Succeeded++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	start := time.Now()
+	rate := load.rate(0)
+	ticker := time.NewTicker(time.Second / time.Duration(rate))
+	defer ticker.Stop()
+	logTicker := time.NewTicker(queryLogInterval)
+	defer logTicker.Stop()
+loop:
+	for {
+		select {
+		case <-floodCtx.Done():
+			break loop
+		case <-ticker.C:
+			select {
+			case tokens <- struct{}{}:
+			default:
+				mu.Lock()
+				result.Skipped++
+				mu.Unlock()
+			}
+			if r := load.rate(time.Since(start)); r != rate {
+				rate = r
+				ticker.Reset(time.Second / time.Duration(rate))
+			}
+		case <-logTicker.C:
+			mu.Lock()
+			slog.Info("🔎 Querying", "queries", result.Queries, "failed", result.Failed, "skipped", result.Skipped,
+				"qps", fmt.Sprintf("%.1f", float64(result.Queries)/time.Since(start).Seconds()))
+			mu.Unlock()
+		}
+	}
+	// the queries in flight are waited for, but the rate is of the time queries were sent in
+	elapsed := time.Since(start)
+	close(tokens)
+	wg.Wait()
+
+	result.DurationSeconds = elapsed.Seconds()
+	result.QPS = float64(result.Queries) / elapsed.Seconds()
+	if result.Queries > 0 {
+		result.SuccessRate = float64(result.Succeeded) / float64(result.Queries) * 100
+	}
+	for i, answers := range subnetAnswers {
+		result.Subnets[i].TopAnswers = topAnswers(answers)
+	}
+	if d := result.DNSSEC; d != nil && d.Queries > 0 {
+		d.ValidationFailureRate = float64(d.Unauthenticated+d.ServFail) / float64(d.Queries) * 100
+	}
+	for _, t := range truncation {
+		t.TruncationRate = float64(t.Truncated) / float64(t.Queries) * 100
+		result.Truncation = append(result.Truncation, *t)
+	}
+	sort.Slice(result.Truncation, func(i, j int) bool { return result.Truncation[i].Type < result.Truncation[j].Type })
+	result.Latency = newLatencyStats(latencies)
+	result.latencies = latencies
+	result.Correctness = load.answers.Result()
+	if len(missLatencies) > 0 {
+		missLatency := newLatencyStats(missLatencies)
+		result.MissLatency = &missLatency
+	}
+	if len(uncachedLatencies) > 0 {
+		uncachedLatency := newLatencyStats(uncachedLatencies)
+		result.UncachedLatency = &uncachedLatency
+	}
+	if result.Skipped > 0 {
+		slog.Warn("Some queries weren't sent because every worker was waiting for an answer, raise --concurrency to reach --qps", "skipped", result.Skipped)
+	}
+	return result, nil
+}
+
+// topAnswers returns the most common of the answers, most common first
+func topAnswers(answers map[string]int) []answerCount {
+	counts := make([]answerCount, 0, len(answers))
+	for answer, queries := range answers {
+		counts = append(counts, answerCount{Answer: answer, Queries: queries})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Queries != counts[j].Queries {
+			return counts[i].Queries > counts[j].Queries
+		}
+		return counts[i].Answer < counts[j].Answer
+	})
+	return counts[:min(len(counts), maxSubnetAnswers)]
+}
+
+// queryFailure returns why a query failed, or "" if it was answered. The reasons don't include addresses or ports so
+// that the failures can be counted by reason.
+func queryFailure(answers []string, err error) string {
+	var dnsErr *net.DNSError
+	switch {
+	case err == nil && len(answers) == 0:
+		return "no answer"
+	case err == nil:
+		return ""
+	case !errors.As(err, &dnsErr):
+		return "error"
+	case dnsErr.IsNotFound:
+		return "NXDOMAIN"
+	case dnsErr.IsTimeout:
+		return "timeout"
+	case dnsErr.Err == "server misbehaving":
+		return "SERVFAIL"
+	case dnsErr.Err == errTruncated.Error():
+		return "truncated"
+	case strings.Contains(dnsErr.Err, "connection refused"):
+		return "connection refused"
+	default:
+		return "network error"
+	}
+}
+
+// parseQueryTypeMix parses the TYPE=WEIGHT pairs of --query-type-mix, which can only have the types that are queried
+func parseQueryTypeMix(s string) (map[types.RRType]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	mix, err := parseTypeMix(s)
+	if err != nil {
+		return nil, err
+	}
+	for rrType := range mix {
+		if !slices.Contains(resolvableTypes, rrType) {
+			return nil, fmt.Errorf("%s record sets can't be queried", rrType)
+		}
+	}
+	return mix, nil
+}
+
+// missTarget returns a name next to the target that doesn't exist, so that it's in the same zone
+func missTarget(target queryTarget) queryTarget {
+	parent := target.name
+	if i := strings.Index(parent, "."); i >= 0 {
+		parent = parent[i+1:]
+	}
+	return queryTarget{name: fmt.Sprintf("floodzone-miss-%s.%s", uuid.NewString(), parent), rrType: types.RRTypeA}
+}
+
+// missFailure returns why a query for a name that doesn't exist failed given the reason it failed as a regular query,
+// only NXDOMAIN succeeds
+func missFailure(reason string) string {
+	switch reason {
+	case "NXDOMAIN":
+		return ""
+	case "":
+		return "miss answered"
+	default:
+		return "miss " + reason
+	}
+}
+
+// blockedFailure returns why a query for a record set DNS Firewall blocks failed given the reason it failed as a
+// regular query, only the NXDOMAIN of the block response succeeds
+func blockedFailure(reason string) string {
+	switch reason {
+	case "NXDOMAIN":
+		return ""
+	case "":
+		return "not blocked"
+	default:
+		return "blocked " + reason
+	}
+}
+
+// validateQuery validates the flags of the query command
+func validateQuery(opts Options) error {
+	var errs []error
+	if opts.FromManifest != "" && opts.HostedZoneID != "" {
+		errs = append(errs, errors.New("--from-manifest and --hosted-zone-id are mutually exclusive"))
+	} else if opts.FromManifest == "" && opts.HostedZoneID == "" {
+		errs = append(errs, errors.New("--hosted-zone-id or --from-manifest is required"))
+	}
+	resolvers := 0
+	for _, set := range []bool{opts.Resolver != "", opts.ResolverEndpointID != "", opts.CreateEndpoint} {
+		if set {
+			resolvers++
+		}
+	}
+	if resolvers > 1 {
+		errs = append(errs, errors.New("--resolver, --resolver-endpoint-id, and --create-inbound-endpoint are mutually exclusive"))
+	}
+	if opts.CreateEndpoint {
+		// Route 53 Resolver requires an IP address in at least two subnets for availability
+		if len(splitList(opts.EndpointSubnets)) < 2 {
+			errs = append(errs, errors.New("--inbound-endpoint-subnet-ids must list at least 2 subnets with --create-inbound-endpoint"))
+		}
+		if len(splitList(opts.EndpointSecGroups)) == 0 {
+			errs = append(errs, errors.New("--inbound-endpoint-security-group-ids is required with --create-inbound-endpoint"))
+		}
+	}
+	if !slices.Contains(dnsProtocols, opts.QueryProtocol) {
+		errs = append(errs, fmt.Errorf("--protocol must be one of %s, got %q", strings.Join(dnsProtocols, ", "), opts.QueryProtocol))
+	}
+	if opts.QueryProtocol != dnsProtocolUDP && opts.QueryProtocol != dnsProtocolUDPOnly && resolvers == 0 {
+		errs = append(errs, fmt.Errorf("--protocol %s needs --resolver, --resolver-endpoint-id, or --create-inbound-endpoint", opts.QueryProtocol))
+	}
+	switch {
+	case opts.QueryProtocol == dnsProtocolTLS && (opts.ResolverEndpointID != "" || opts.CreateEndpoint):
+		errs = append(errs, errors.New("Route 53 Resolver endpoints don't support DNS-over-TLS, use --protocol https"))
+	case opts.QueryProtocol == dnsProtocolHTTPS && opts.CreateEndpoint:
+		errs = append(errs, errors.New("--create-inbound-endpoint only creates Do53 endpoints, pass a DoH endpoint with --resolver-endpoint-id to use --protocol https"))
+	}
+	if opts.ForwardTargets != "" {
+		if _, err := parseForwardTargets(opts.ForwardTargets); err != nil {
+			errs = append(errs, fmt.Errorf("--forward-targets is invalid: %w", err))
+		}
+		if opts.OutboundEndpoint == "" {
+			errs = append(errs, errors.New("--outbound-endpoint-id is required with --forward-targets"))
+		}
+		if len(splitList(opts.ForwardVPCIDs)) == 0 {
+			errs = append(errs, errors.New("--forward-vpc-ids is required with --forward-targets"))
+		}
+		if opts.ForwardDomain == "" && opts.HostedZoneID == "" {
+			errs = append(errs, errors.New("--forward-domain is required with --forward-targets and --from-manifest"))
+		}
+	} else if opts.OutboundEndpoint != "" || opts.ForwardVPCIDs != "" || opts.ForwardDomain != "" {
+		errs = append(errs, errors.New("--outbound-endpoint-id, --forward-vpc-ids, and --forward-domain need --forward-targets"))
+	}
+	if opts.QPS < 1 {
+		errs = append(errs, errors.New("--qps must be at least 1"))
+	}
+	if opts.Concurrency < 1 {
+		errs = append(errs, errors.New("--concurrency must be at least 1"))
+	}
+	if opts.MissPercent < 0 || opts.MissPercent > 100 {
+		errs = append(errs, fmt.Errorf("--miss-percent must be from 0 to 100, got %g", opts.MissPercent))
+	}
+	if opts.MissNames < 0 {
+		errs = append(errs, errors.New("--miss-names must not be negative"))
+	}
+	if opts.QueryDuration <= 0 {
+		errs = append(errs, errors.New("--duration must be positive"))
+	}
+	if opts.RampUp < 0 || opts.RampUp > opts.QueryDuration {
+		errs = append(errs, errors.New("--ramp-up must be from 0 to --duration"))
+	}
+	if _, err := parseEDNSSubnets(opts.EDNSSubnets); err != nil {
+		errs = append(errs, fmt.Errorf("--edns-subnets is invalid: %w", err))
+	}
+	if _, err := parseQueryTypeMix(opts.QueryTypeMix); err != nil {
+		errs = append(errs, fmt.Errorf("--query-type-mix is invalid: %w", err))
+	}
+	switch opts.Popularity {
+	case popularityUniform:
+	case popularityZipf:
+		// rand.Zipf needs an exponent above 1
+		if opts.ZipfExponent <= 1 {
+			errs = append(errs, fmt.Errorf("--zipf-exponent must be greater than 1, got %g", opts.ZipfExponent))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("--popularity must be %s or %s, got %q", popularityUniform, popularityZipf, opts.Popularity))
+	}
+	if regions := len(splitList(opts.LambdaRegions)); regions > 0 {
+		if opts.LambdaWorkers < 1 {
+			errs = append(errs, fmt.Errorf("--lambda-workers-per-region must be at least 1, got %d", opts.LambdaWorkers))
+		} else if opts.QPS < regions*opts.LambdaWorkers {
+			errs = append(errs, fmt.Errorf("--qps must be at least the %d --lambda-regions workers", regions*opts.LambdaWorkers))
+		}
+		// Lambda stops a function after 15 minutes, which has to include the queries in flight
+		if opts.QueryDuration > maxQueryWorkerDuration {
+			errs = append(errs, fmt.Errorf("--duration must be at most %s with --lambda-regions", maxQueryWorkerDuration))
+		}
+		if opts.ResolverEndpointID != "" || opts.CreateEndpoint || opts.ForwardTargets != "" {
+			errs = append(errs, errors.New("--lambda-regions workers don't run in a VPC, they can't query through Route 53 Resolver endpoints or forwarding rules"))
+		}
+	}
+	if opts.SSMInstanceIDs != "" || opts.SSMInstanceTags != "" {
+		if opts.LambdaRegions != "" {
+			errs = append(errs, errors.New("--lambda-regions and --ssm-instance-ids or --ssm-instance-tags are mutually exclusive"))
+		}
+		if opts.SSMInstanceIDs != "" && opts.SSMInstanceTags != "" {
+			errs = append(errs, errors.New("--ssm-instance-ids and --ssm-instance-tags are mutually exclusive"))
+		}
+		for _, tag := range splitList(opts.SSMInstanceTags) {
+			if key, _, ok := strings.Cut(tag, "="); !ok || key == "" {
+				errs = append(errs, fmt.Errorf("--ssm-instance-tags must be Key=Value pairs, got %q", tag))
+			}
+		}
+		// the prefix is optional, the files go in a folder of the run under it
+		if bucket, _, ok := parseS3URI(opts.SSMS3URI); !ok || bucket == "" {
+			errs = append(errs, fmt.Errorf("--ssm-s3-uri must be an s3://bucket/prefix URI, got %q", opts.SSMS3URI))
+		}
+	} else if opts.SSMS3URI != "" {
+		errs = append(errs, errors.New("--ssm-s3-uri needs --ssm-instance-ids or --ssm-instance-tags"))
+	}
+	if opts.WorkerBinary != "" && opts.LambdaRegions == "" && opts.SSMInstanceIDs == "" && opts.SSMInstanceTags == "" {
+		errs = append(errs, errors.New("--worker-binary needs --lambda-regions, --ssm-instance-ids, or --ssm-instance-tags"))
+	}
+	if opts.CacheBustPercent < 0 || opts.CacheBustPercent > 100 {
+		errs = append(errs, fmt.Errorf("--cache-bust-percent must be from 0 to 100, got %g", opts.CacheBustPercent))
+	}
+	if opts.CacheBustMode != cacheBustNXDomain && opts.CacheBustMode != cacheBustWildcard {
+		errs = append(errs, fmt.Errorf("--cache-bust-mode must be %s or %s, got %q", cacheBustNXDomain, cacheBustWildcard, opts.CacheBustMode))
+	}
+	if opts.CheckAnswers {
+		if opts.FromManifest == "" {
+			errs = append(errs, errors.New("--check-answers needs --from-manifest"))
+		}
+		if opts.LambdaRegions != "" || opts.SSMInstanceIDs != "" || opts.SSMInstanceTags != "" {
+			errs = append(errs, errors.New("--check-answers can't check the answers of query workers"))
+		}
+		if opts.ManifestRefresh <= 0 {
+			errs = append(errs, fmt.Errorf("--manifest-refresh must be positive, got %s", opts.ManifestRefresh))
+		}
+	}
+	if opts.QueryAttempts < 1 {
+		errs = append(errs, fmt.Errorf("--attempts must be at least 1, got %d", opts.QueryAttempts))
+	}
+	if opts.QueryTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("--query-timeout must be positive, got %s", opts.QueryTimeout))
+	}
+	errs = append(errs, validateManifestURI("--from-manifest", opts.FromManifest))
+	return errors.Join(errs...)
+}
+
+// splitList splits a comma-separated flag value, ignoring empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
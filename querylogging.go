@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	logstypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+const (
+	// queryLoggingLogGroupPrefix prefixes the CloudWatch Logs groups floodzone creates for the query logging configs of
+	// zones, which is how cleanup finds the query logging configs floodzone created
+	queryLoggingLogGroupPrefix = "/aws/route53/floodzone/"
+	// queryLoggingRegion is the only region Route 53 writes query logs to
+	queryLoggingRegion = "us-east-1"
+	// queryLoggingPolicyName is the CloudWatch Logs resource policy that lets Route 53 write to the log groups floodzone
+	// creates, a single one covers all of them since CloudWatch Logs allows 10 resource policies per region
+	queryLoggingPolicyName = "floodzone-route53-query-logging"
+	// queryLoggingPolicyAttempts is how many times a query logging config is created while CloudWatch Logs is still
+	// propagating the resource policy, queryLoggingPolicyWait apart
+	queryLoggingPolicyAttempts = 6
+	queryLoggingPolicyWait     = 5 * time.Second
+
+	// queryLoggingPerZone logs the queries of every zone to its own log group
+	queryLoggingPerZone = "per-zone"
+	// queryLoggingShared logs the queries of every zone of the run to the same log group
+	queryLoggingShared = "shared"
+)
+
+// queryLoggingModes are the values of --query-logging
+var queryLoggingModes = []string{queryLoggingPerZone, queryLoggingShared}
+
+// EnableQueryLogging creates a query logging config for the zone, logging to a log group of its own or, with
+// --query-logging shared, to one log group every zone of the run shares, to test the account's query logging quotas
+// and how Route 53 fans the logs of many zones out. The log group and the resource policy letting Route 53 write to it
+// are created if they don't exist. Route 53 only logs the queries of public zones, so private zones are skipped.
+func (z Zone) EnableQueryLogging(ctx context.Context, hostedZone *types.HostedZone, opts Options) error {
+	hostedZoneID := strings.TrimPrefix(aws.ToString(hostedZone.Id), "/hostedzone/")
+	if hostedZone.Config != nil && hostedZone.Config.PrivateZone {
+		slog.Warn("Route 53 doesn't log the queries of private zones, skipping its query logging config", "hostedZone", hostedZoneID)
+		return nil
+	}
+	logGroup := queryLoggingLogGroupPrefix + strings.TrimSuffix(aws.ToString(hostedZone.Name), ".")
+	if opts.QueryLogging == queryLoggingShared {
+		// without a run ID, the zones of every shared run would log to the same log group
+		if opts.RunID == "" {
+			return errors.New("the shared query logging log group needs the ID of the run")
+		}
+		logGroup = queryLoggingLogGroupPrefix + opts.RunID
+	}
+	inRegion := func(o *cloudwatchlogs.Options) { o.Region = queryLoggingRegion }
+	_, err := z.Logs.CreateLogGroup(ctx, &cloudwatchlogs.CreateLogGroupInput{LogGroupName: &logGroup, Tags: map[string]string{ephemeralVPCTagKey: "true"}}, inRegion)
+	var exists *logstypes.ResourceAlreadyExistsException
+	if err != nil && !errors.As(err, &exists) {
+		return fmt.Errorf("unable to create log group %s: %w", logGroup, err)
+	}
+	out, err := z.Logs.DescribeLogGroups(ctx, &cloudwatchlogs.DescribeLogGroupsInput{LogGroupNamePrefix: &logGroup}, inRegion)
+	if err != nil {
+		return fmt.Errorf("unable to describe log group %s: %w", logGroup, err)
+	}
+	i := slices.IndexFunc(out.LogGroups, func(g logstypes.LogGroup) bool { return aws.ToString(g.LogGroupName) == logGroup })
+	if i < 0 {
+		return fmt.Errorf("log group %s doesn't exist after it was created", logGroup)
+	}
+	// arn:aws:logs:us-east-1:123456789012:log-group:/aws/route53/floodzone/example.com:*
+	arn := strings.TrimSuffix(aws.ToString(out.LogGroups[i].Arn), ":*")
+	parts := strings.SplitN(arn, ":", 7)
+	if len(parts) < 7 {
+		return fmt.Errorf("unable to parse the ARN %q of log group %s", arn, logGroup)
+	}
+	policy := fmt.Sprintf(`{"Version":"2012-10-17","Statement":[{"Sid":"Route53QueryLogging","Effect":"Allow","Principal":{"Service":"route53.amazonaws.com"},`+
+		`"Action":["logs:CreateLogStream","logs:PutLogEvents"],"Resource":"arn:%s:logs:%s:%s:log-group:%s*"}]}`, parts[1], queryLoggingRegion, parts[4], queryLoggingLogGroupPrefix)
+	if _, err := z.Logs.PutResourcePolicy(ctx, &cloudwatchlogs.PutResourcePolicyInput{PolicyName: aws.String(queryLoggingPolicyName), PolicyDocument: &policy}, inRegion); err != nil {
+		return fmt.Errorf("unable to let Route 53 write to the log groups: %w", err)
+	}
+	for attempt := 1; ; attempt++ {
+		_, err = z.R53.CreateQueryLoggingConfig(ctx, &route53.CreateQueryLoggingConfigInput{HostedZoneId: &hostedZoneID, CloudWatchLogsLogGroupArn: &arn})
+		var insufficient *types.InsufficientCloudWatchLogsResourcePolicy
+		if !errors.As(err, &insufficient) || attempt == queryLoggingPolicyAttempts {
+			break
+		}
+		if err := sleep(ctx, queryLoggingPolicyWait); err != nil {
+			return err
+		}
+	}
+	var alreadyExists *types.QueryLoggingConfigAlreadyExists
+	switch {
+	case errors.As(err, &alreadyExists):
+		slog.Info("The zone already has a query logging config", "hostedZone", hostedZoneID)
+		return nil
+	case err != nil:
+		return fmt.Errorf("unable to create the query logging config of hosted zone %s: %w", hostedZoneID, err)
+	}
+	configs, err := z.queryLoggingConfigs(ctx, nil)
+	if err != nil {
+		return err
+	}
+	logGroups := map[string]bool{}
+	for _, config := range configs {
+		logGroups[aws.ToString(config.CloudWatchLogsLogGroupArn)] = true
+	}
+	slog.Info("📜 Created the query logging config of the zone", "hostedZone", hostedZoneID, "logGroup", logGroup, "accountConfigs", len(configs),
+		"accountLogGroups", len(logGroups))
+	return nil
+}
+
+// DeleteQueryLogging deletes the query logging configs floodzone created for the zone, then the log groups that no
+// other query logging config logs to, and the resource policy once no log group floodzone created is left
+func (z Zone) DeleteQueryLogging(ctx context.Context, hostedZoneID string) error {
+	configs, err := z.queryLoggingConfigs(ctx, &hostedZoneID)
+	if err != nil {
+		return err
+	}
+	configs = slices.DeleteFunc(configs, func(c types.QueryLoggingConfig) bool { return queryLoggingLogGroup(c) == "" })
+	if len(configs) == 0 {
+		return nil
+	}
+	var logGroups []string
+	for _, config := range configs {
+		_, err := z.R53.DeleteQueryLoggingConfig(ctx, &route53.DeleteQueryLoggingConfigInput{Id: config.Id})
+		var notFound *types.NoSuchQueryLoggingConfig
+		if err != nil && !errors.As(err, &notFound) {
+			return fmt.Errorf("unable to delete query logging config %s: %w", aws.ToString(config.Id), err)
+		}
+		logGroups = append(logGroups, queryLoggingLogGroup(config))
+	}
+	// the log group of a shared run is deleted with the query logging config of the last of its zones
+	remaining, err := z.queryLoggingConfigs(ctx, nil)
+	if err != nil {
+		return err
+	}
+	inRegion := func(o *cloudwatchlogs.Options) { o.Region = queryLoggingRegion }
+	var notFound *logstypes.ResourceNotFoundException
+	for _, logGroup := range logGroups {
+		if slices.ContainsFunc(remaining, func(c types.QueryLoggingConfig) bool { return queryLoggingLogGroup(c) == logGroup }) {
+			continue
+		}
+		if _, err := z.Logs.DeleteLogGroup(ctx, &cloudwatchlogs.DeleteLogGroupInput{LogGroupName: &logGroup}, inRegion); err != nil && !errors.As(err, &notFound) {
+			return fmt.Errorf("unable to delete log group %s: %w", logGroup, err)
+		}
+	}
+	out, err := z.Logs.DescribeLogGroups(ctx, &cloudwatchlogs.DescribeLogGroupsInput{LogGroupNamePrefix: aws.String(queryLoggingLogGroupPrefix)}, inRegion)
+	if err != nil {
+		return fmt.Errorf("unable to list the query logging log groups: %w", err)
+	}
+	if len(out.LogGroups) == 0 {
+		_, err := z.Logs.DeleteResourcePolicy(ctx, &cloudwatchlogs.DeleteResourcePolicyInput{PolicyName: aws.String(queryLoggingPolicyName)}, inRegion)
+		if err != nil && !errors.As(err, &notFound) {
+			return fmt.Errorf("unable to delete resource policy %s: %w", queryLoggingPolicyName, err)
+		}
+	}
+	slog.Info("✅ Successfully deleted the query logging configs of the zone", "hostedZone", hostedZoneID, "configs", len(configs))
+	return nil
+}
+
+// queryLoggingConfigs returns the query logging configs of the account, only those of the zone if hostedZoneID isn't nil
+func (z Zone) queryLoggingConfigs(ctx context.Context, hostedZoneID *string) ([]types.QueryLoggingConfig, error) {
+	var configs []types.QueryLoggingConfig
+	input := &route53.ListQueryLoggingConfigsInput{HostedZoneId: hostedZoneID}
+	for {
+		out, err := z.R53.ListQueryLoggingConfigs(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list query logging configs: %w", err)
+		}
+		configs = append(configs, out.QueryLoggingConfigs...)
+		if out.NextToken == nil {
+			return configs, nil
+		}
+		input.NextToken = out.NextToken
+	}
+}
+
+// queryLoggingLogGroup returns the log group of the query logging config if floodzone created it, "" otherwise
+func queryLoggingLogGroup(config types.QueryLoggingConfig) string {
+	// arn:aws:logs:us-east-1:123456789012:log-group:/aws/route53/floodzone/example.com
+	_, name, ok := strings.Cut(strings.TrimSuffix(aws.ToString(config.CloudWatchLogsLogGroupArn), ":*"), ":log-group:")
+	if !ok || !strings.HasPrefix(name, queryLoggingLogGroupPrefix) {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// queryLogResult is the output of the analyze-query-logs command
+type queryLogResult struct {
+	LogGroup string    `json:"logGroup" yaml:"logGroup"`
+	Start    time.Time `json:"start" yaml:"start"`
+	End      time.Time `json:"end" yaml:"end"`
+	// Queries are the logged queries for names in the zone
+	Queries   int              `json:"queries" yaml:"queries"`
+	QPS       float64          `json:"qps" yaml:"qps"`
+	PeakQPS   float64          `json:"peakQps" yaml:"peakQps"`
+	Intervals []queryLogBucket `json:"intervals" yaml:"intervals"`
+	// ResponseCodes are the queries by the response code they were answered with, most frequent first
+	ResponseCodes []responseCodeCount `json:"responseCodes" yaml:"responseCodes"`
+	// RecordSets are the record sets of the zone or --from-manifest that could have been queried
+	RecordSets int `json:"recordSets" yaml:"recordSets"`
+	// QueriedRecordSets are the RecordSets that were queried at least once by name and type
+	QueriedRecordSets int     `json:"queriedRecordSets" yaml:"queriedRecordSets"`
+	CoveragePercent   float64 `json:"coveragePercent" yaml:"coveragePercent"`
+}
+
+// queryLogBucket is how many queries were logged in an --interval
+type queryLogBucket struct {
+	Start   time.Time `json:"start" yaml:"start"`
+	Queries int       `json:"queries" yaml:"queries"`
+	QPS     float64   `json:"qps" yaml:"qps"`
+}
+
+// responseCodeCount is how many queries were answered with a response code, e.g. NOERROR or NXDOMAIN
+type responseCodeCount struct {
+	Code    string  `json:"code" yaml:"code"`
+	Queries int     `json:"queries" yaml:"queries"`
+	Percent float64 `json:"percent" yaml:"percent"`
+}
+
+func (r queryLogResult) writeTable(w io.Writer) {
+	fmt.Fprintln(w, "LOG GROUP\tSTART\tEND\tQUERIES\tQPS\tPEAK QPS\tRECORD SETS\tQUERIED\tCOVERAGE")
+	fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%.1f\t%.1f\t%d\t%d\t%.2f%%\n", r.LogGroup, r.Start.Local().Format(time.DateTime),
+		r.End.Local().Format(time.DateTime), r.Queries, r.QPS, r.PeakQPS, r.RecordSets, r.QueriedRecordSets, r.CoveragePercent)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "INTERVAL\tQUERIES\tQPS")
+	for _, interval := range r.Intervals {
+		fmt.Fprintf(w, "%s\t%d\t%.1f\n", interval.Start.Local().Format(time.DateTime), interval.Queries, interval.QPS)
+	}
+	if len(r.ResponseCodes) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "RCODE\tQUERIES\tPERCENT")
+	for _, code := range r.ResponseCodes {
+		fmt.Fprintf(w, "%s\t%d\t%.2f%%\n", code.Code, code.Queries, code.Percent)
+	}
+}
+
+// queryLogEntry is a query logged by Route 53 query logging or Resolver query logging
+type queryLogEntry struct {
+	name   string
+	rrType string
+	rcode  string
+}
+
+// resolverQueryLog is the JSON a Resolver query logging config logs a query as
+type resolverQueryLog struct {
+	QueryName string `json:"query_name"`
+	QueryType string `json:"query_type"`
+	RCode     string `json:"rcode"`
+}
+
+// parseQueryLog parses a query log event. Route 53 logs the queries of public zones as space separated fields: the log
+// format version, the timestamp, the hosted zone ID, the query name, the query type, the response code, and then where
+// the query came from. Resolver query logging, which logs the queries of private zones, logs JSON objects.
+func parseQueryLog(message string) (queryLogEntry, bool) {
+	if strings.HasPrefix(message, "{") {
+		var log resolverQueryLog
+		if err := json.Unmarshal([]byte(message), &log); err != nil || log.QueryName == "" {
+			return queryLogEntry{}, false
+		}
+		return queryLogEntry{name: normalizeName(log.QueryName), rrType: log.QueryType, rcode: log.RCode}, true
+	}
+	fields := strings.Fields(message)
+	if len(fields) < 6 {
+		return queryLogEntry{}, false
+	}
+	return queryLogEntry{name: normalizeName(fields[3]), rrType: fields[4], rcode: fields[5]}, true
+}
+
+// normalizeName returns the fully qualified, lower case form of a DNS name, since the logs have the names in the case
+// they were queried in and Route 53 logs them without the trailing dot
+func normalizeName(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name
+}
+
+// queryLogGroup returns the log group and region of the zone's query logging config, or the --query-log-group in the
+// region of the run. Route 53 query logging only logs the queries of public zones, to log groups in us-east-1.
+func queryLogGroup(ctx context.Context, zone Zone, opts Options, private bool) (string, string, error) {
+	if opts.QueryLogGroup != "" {
+		return opts.QueryLogGroup, zone.Region, nil
+	}
+	if private {
+		return "", "", errors.New("Route 53 doesn't log the queries of private zones, set --query-log-group to the log group of a Resolver query logging config of a VPC associated with the zone")
+	}
+	out, err := zone.R53.ListQueryLoggingConfigs(ctx, &route53.ListQueryLoggingConfigsInput{HostedZoneId: &opts.HostedZoneID})
+	if err != nil {
+		return "", "", fmt.Errorf("unable to list the query logging configs of the hosted zone: %w", err)
+	}
+	if len(out.QueryLoggingConfigs) == 0 {
+		return "", "", errors.New("the hosted zone has no query logging config, create one or set --query-log-group")
+	}
+	// arn:aws:logs:us-east-1:123456789012:log-group:/aws/route53/example.com:*
+	arn := aws.ToString(out.QueryLoggingConfigs[0].CloudWatchLogsLogGroupArn)
+	parts := strings.SplitN(arn, ":", 7)
+	if len(parts) < 7 || parts[5] != "log-group" {
+		return "", "", fmt.Errorf("unable to parse the log group ARN %q of the query logging config", arn)
+	}
+	return strings.TrimSuffix(parts[6], ":*"), parts[3], nil
+}
+
+func runAnalyzeQueryLogs(ctx context.Context, zone Zone, opts Options) error {
+	hz, err := zone.R53.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: &opts.HostedZoneID})
+	if err != nil {
+		return fmt.Errorf("unable to describe hosted zone: %w", err)
+	}
+	private := hz.HostedZone.Config != nil && hz.HostedZone.Config.PrivateZone
+	logGroup, region, err := queryLogGroup(ctx, zone, opts, private)
+	if err != nil {
+		return err
+	}
+	targets, err := queryTargets(ctx, zone, opts)
+	if err != nil {
+		return err
+	}
+	end := time.Now()
+	start := end.Add(-opts.LogsSince)
+	slog.Info("🔎 Reading query logs", "logGroup", logGroup, "region", region, "since", start.Format(time.RFC3339))
+	result, err := analyzeQueryLogs(ctx, zone, logGroup, region, normalizeName(aws.ToString(hz.HostedZone.Name)), targets, start, end, opts.LogsInterval)
+	if err != nil {
+		return err
+	}
+	return printOutput(opts.Output, result)
+}
+
+// analyzeQueryLogs reads the queries for names in the domain logged to the log group between start and end, and counts
+// them by interval, by response code, and by the targets they queried
+func analyzeQueryLogs(ctx context.Context, zone Zone, logGroup string, region string, domain string, targets []queryTarget, start time.Time, end time.Time, interval time.Duration) (queryLogResult, error) {
+	result := queryLogResult{LogGroup: logGroup, Start: start, End: end, Intervals: []queryLogBucket{}, ResponseCodes: []responseCodeCount{}}
+	buckets := make([]int, int((end.Sub(start)+interval-1)/interval))
+	rcodes := map[string]int{}
+	queried := map[queryTarget]bool{}
+	for _, target := range targets {
+		queried[queryTarget{name: normalizeName(target.name), rrType: target.rrType}] = false
+	}
+	result.RecordSets = len(queried)
+	input := &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName: &logGroup,
+		StartTime:    aws.Int64(start.UnixMilli()),
+		EndTime:      aws.Int64(end.UnixMilli()),
+	}
+	inRegion := func(o *cloudwatchlogs.Options) { o.Region = region }
+	for {
+		out, err := zone.Logs.FilterLogEvents(ctx, input, inRegion)
+		if err != nil {
+			return result, fmt.Errorf("unable to read the query logs: %w", err)
+		}
+		for _, event := range out.Events {
+			entry, ok := parseQueryLog(aws.ToString(event.Message))
+			// Resolver query logs have the queries of every domain the VPC resolves
+			if !ok || (entry.name != domain && !strings.HasSuffix(entry.name, "."+domain)) {
+				continue
+			}
+			result.Queries++
+			rcodes[entry.rcode]++
+			if i := int(time.UnixMilli(aws.ToInt64(event.Timestamp)).Sub(start) / interval); i >= 0 && i < len(buckets) {
+				buckets[i]++
+			}
+			target := queryTarget{name: entry.name, rrType: types.RRType(entry.rrType)}
+			if _, ok := queried[target]; ok {
+				queried[target] = true
+			}
+		}
+		if out.NextToken == nil {
+			break
+		}
+		input.NextToken = out.NextToken
+		slog.Debug("Read a page of query logs", "queries", result.Queries)
+	}
+
+	for i, queries := range buckets {
+		bucketStart := start.Add(time.Duration(i) * interval)
+		// the last interval is cut short by the end of the logs
+		length := min(interval, end.Sub(bucketStart))
+		qps := float64(queries) / length.Seconds()
+		result.Intervals = append(result.Intervals, queryLogBucket{Start: bucketStart, Queries: queries, QPS: qps})
+		result.PeakQPS = max(result.PeakQPS, qps)
+	}
+	result.QPS = float64(result.Queries) / end.Sub(start).Seconds()
+	for code, queries := range rcodes {
+		result.ResponseCodes = append(result.ResponseCodes, responseCodeCount{Code: code, Queries: queries, Percent: float64(queries) / float64(result.Queries) * 100})
+	}
+	sort.Slice(result.ResponseCodes, func(i, j int) bool {
+		if result.ResponseCodes[i].Queries != result.ResponseCodes[j].Queries {
+			return result.ResponseCodes[i].Queries > result.ResponseCodes[j].Queries
+		}
+		return result.ResponseCodes[i].Code < result.ResponseCodes[j].Code
+	})
+	for _, wasQueried := range queried {
+		if wasQueried {
+			result.QueriedRecordSets++
+		}
+	}
+	if result.RecordSets > 0 {
+		result.CoveragePercent = float64(result.QueriedRecordSets) / float64(result.RecordSets) * 100
+	}
+	return result, nil
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+const (
+	// lambdaRuntimeAPIEnv is set by Lambda to the host of its runtime API, floodzone runs as a Lambda handler when it is
+	lambdaRuntimeAPIEnv = "AWS_LAMBDA_RUNTIME_API"
+	// queryWorkerLatencySample is the most query latencies a worker sends back, its payload is limited to 6MB
+	queryWorkerLatencySample = 10000
+)
+
+func init() {
+	commands = append(commands, command{
+		name:        "query-worker",
+		description: "Send the queries of a query worker request file and print the response, run on the instances of query --ssm-instance-ids",
+		runLocal:    runQueryWorker,
+	})
+}
+
+// queryWorkerRequest is the payload of a query worker invocation: the record sets to query and the flags of the query
+// command that shape the load
+type queryWorkerRequest struct {
+	Targets       []queryWorkerTarget `json:"targets"`
+	Resolver      string              `json:"resolver,omitempty"`
+	Protocol      string              `json:"protocol"`
+	QPS           int                 `json:"qps"`
+	Concurrency   int                 `json:"concurrency"`
+	Duration      time.Duration       `json:"duration"`
+	RampUp        time.Duration       `json:"rampUp"`
+	MissPercent   float64             `json:"missPercent"`
+	MissNames     int                 `json:"missNames"`
+	QueryTypeMix  string              `json:"queryTypeMix,omitempty"`
+	Popularity    string              `json:"popularity"`
+	ZipfExponent  float64             `json:"zipfExponent"`
+	EDNSSubnets   string              `json:"ednsSubnets,omitempty"`
+	DNSSEC        bool                `json:"dnssec"`
+	RandomizeCase bool                `json:"randomizeCase"`
+	Attempts      int                 `json:"attempts"`
+	QueryTimeout  time.Duration       `json:"queryTimeout"`
+	CacheBust     float64             `json:"cacheBust"`
+	CacheBustMode string              `json:"cacheBustMode,omitempty"`
+}
+
+// queryWorkerTarget is a record set for a query worker to query
+type queryWorkerTarget struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Blocked bool   `json:"blocked,omitempty"`
+}
+
+// queryWorkerResponse is the payload a query worker answers with
+type queryWorkerResponse struct {
+	Result queryResult `json:"result"`
+	// Latencies are a random sample of the latencies of the queries for existing record sets, so that the percentiles
+	// of every worker together can be estimated
+	Latencies []time.Duration `json:"latencies"`
+}
+
+// newQueryWorkerRequest returns the request for a worker to send qps of the queries of the flags with concurrency
+func newQueryWorkerRequest(targets []queryTarget, opts Options, qps int, concurrency int) queryWorkerRequest {
+	req := queryWorkerRequest{
+		Resolver:      opts.Resolver,
+		Protocol:      opts.QueryProtocol,
+		QPS:           qps,
+		Concurrency:   concurrency,
+		Duration:      opts.QueryDuration,
+		RampUp:        opts.RampUp,
+		MissPercent:   opts.MissPercent,
+		MissNames:     opts.MissNames,
+		QueryTypeMix:  opts.QueryTypeMix,
+		Popularity:    opts.Popularity,
+		ZipfExponent:  opts.ZipfExponent,
+		EDNSSubnets:   opts.EDNSSubnets,
+		DNSSEC:        opts.DNSSEC,
+		RandomizeCase: opts.RandomizeCase,
+		Attempts:      opts.QueryAttempts,
+		QueryTimeout:  opts.QueryTimeout,
+		CacheBust:     opts.CacheBustPercent,
+		CacheBustMode: opts.CacheBustMode,
+	}
+	for _, target := range targets {
+		req.Targets = append(req.Targets, queryWorkerTarget{Name: target.name, Type: string(target.rrType), Blocked: target.blocked})
+	}
+	return req
+}
+
+// options returns the flags of the query command the request was made from
+func (r queryWorkerRequest) options() Options {
+	return Options{
+		Resolver:      r.Resolver,
+		QueryProtocol: r.Protocol,
+		QPS:           r.QPS,
+		Concurrency:   r.Concurrency,
+		QueryDuration: r.Duration,
+		RampUp:        r.RampUp,
+		MissPercent:   r.MissPercent,
+		MissNames:     r.MissNames,
+		QueryTypeMix:  r.QueryTypeMix,
+		Popularity:    r.Popularity,
+		ZipfExponent:  r.ZipfExponent,
+		EDNSSubnets:   r.EDNSSubnets,
+		DNSSEC:        r.DNSSEC,
+		RandomizeCase: r.RandomizeCase,
+		QueryAttempts: r.Attempts,
+		QueryTimeout:  r.QueryTimeout,
+
+		CacheBustPercent: r.CacheBust,
+		CacheBustMode:    r.CacheBustMode,
+	}
+}
+
+// runLambdaWorker serves query worker, run step, and CloudFormation custom resource invocations over the Lambda runtime
+// API until Lambda shuts the worker down. The floodzone binary is its own Lambda handler, see LambdaQueryWorkers,
+// handleLambdaStep, and handleCustomResource.
+func runLambdaWorker(ctx context.Context) error {
+	api := fmt.Sprintf("http://%s/2018-06-01/runtime/invocation/", os.Getenv(lambdaRuntimeAPIEnv))
+	// Lambda sends SIGTERM before it shuts the worker down, which stops the queries of the invocation in flight
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM)
+	defer stop()
+	client := &http.Client{}
+	for ctx.Err() == nil {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, api+"next", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("unable to get the next invocation: %w", err)
+		}
+		payload, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("unable to read the next invocation: %w", err)
+		}
+		requestID := resp.Header.Get("Lambda-Runtime-Aws-Request-Id")
+		path := api + requestID + "/response"
+		var answer []byte
+		errorType := "QueryWorkerError"
+		switch {
+		case isCustomResourceEvent(payload):
+			errorType = "CustomResourceError"
+			answer, err = handleCustomResource(ctx, requestID, lambdaDeadline(resp.Header), payload)
+		case isLambdaStep(payload):
+			errorType = "RunStepError"
+			answer, err = handleLambdaStep(ctx, requestID, lambdaDeadline(resp.Header), payload)
+		default:
+			answer, err = handleQueryWorker(ctx, payload)
+		}
+		if err != nil {
+			slog.Error("Lambda invocation failed", "requestId", requestID, "error", err)
+			path = api + requestID + "/error"
+			answer, _ = json.Marshal(map[string]string{"errorMessage": err.Error(), "errorType": errorType})
+		}
+		// the answer is still sent when the worker is shutting down, so that the invocation doesn't time out
+		req, err = http.NewRequestWithContext(context.WithoutCancel(ctx), http.MethodPost, path, bytes.NewReader(answer))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err = client.Do(req)
+		if err != nil {
+			return fmt.Errorf("unable to answer invocation %s: %w", requestID, err)
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+// runQueryWorker sends the queries of the request file of the positional argument and writes the response to stdout
+func runQueryWorker(ctx context.Context, _ Options, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected the path of a query worker request file")
+	}
+	payload, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("unable to read query worker request: %w", err)
+	}
+	// SSM interrupts the worker when the query command is canceled, which stops the queries and still writes the result
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	answer, err := handleQueryWorker(ctx, payload)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(answer)
+	return err
+}
+
+// handleQueryWorker sends the queries of a query worker request and returns the response to it
+func handleQueryWorker(ctx context.Context, payload []byte) ([]byte, error) {
+	var req queryWorkerRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, fmt.Errorf("unable to parse query worker request: %w", err)
+	}
+	// the flags were validated by the query command that invoked the worker
+	opts := req.options()
+	targets := make([]queryTarget, 0, len(req.Targets))
+	for _, target := range req.Targets {
+		targets = append(targets, queryTarget{name: target.Name, rrType: types.RRType(target.Type), blocked: target.Blocked})
+	}
+	resolver, address := newProtocolResolver(opts.QueryProtocol, splitList(opts.Resolver)...)
+	result, err := floodQueries(ctx, resolver, address, targets, newQueryLoad(opts))
+	if err != nil {
+		return nil, err
+	}
+	latencies := result.latencies
+	if len(latencies) > queryWorkerLatencySample {
+		rand.Shuffle(len(latencies), func(i, j int) { latencies[i], latencies[j] = latencies[j], latencies[i] })
+		latencies = latencies[:queryWorkerLatencySample]
+	}
+	return json.Marshal(queryWorkerResponse{Result: result, Latencies: latencies})
+}
+
+// readWorkerBinary returns the floodzone binary to run as query workers, the running one by default, and its
+// architecture as Lambda and EC2 name it. The binary must be built for Linux.
+func readWorkerBinary(binary string) ([]byte, string, error) {
+	if binary == "" {
+		executable, err := os.Executable()
+		if err != nil {
+			return nil, "", fmt.Errorf("unable to find the floodzone binary to run as query workers: %w", err)
+		}
+		binary = executable
+	}
+	f, err := elf.Open(binary)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s isn't a Linux binary, build floodzone with GOOS=linux and pass it as the worker binary: %w", binary, err)
+	}
+	machine := f.Machine
+	f.Close()
+	var architecture string
+	switch machine {
+	case elf.EM_X86_64:
+		architecture = "x86_64"
+	case elf.EM_AARCH64:
+		architecture = "arm64"
+	default:
+		return nil, "", fmt.Errorf("%s is built for %s, query workers only run amd64 and arm64 binaries", binary, machine)
+	}
+	contents, err := os.ReadFile(binary)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to read %s: %w", binary, err)
+	}
+	return contents, architecture, nil
+}
+
+// fanOutResult is the output of the query command with query workers, see LambdaQueryWorkers and InstanceQueryWorkers
+type fanOutResult struct {
+	Resolver        string  `json:"resolver" yaml:"resolver"`
+	RecordSets      int     `json:"recordSets" yaml:"recordSets"`
+	DurationSeconds float64 `json:"durationSeconds" yaml:"durationSeconds"`
+	// GroupBy is what the workers are grouped by, region or instance
+	GroupBy string `json:"groupBy" yaml:"groupBy"`
+	// Groups are the queries from the workers of each group, and Total from every worker together
+	Groups []queryGroupResult `json:"groups" yaml:"groups"`
+	Total  queryGroupResult   `json:"total" yaml:"total"`
+	// Failures counts the failed queries of every worker by reason
+	Failures map[string]int `json:"failures,omitempty" yaml:"failures,omitempty"`
+}
+
+// queryGroupResult is the outcome of the queries from a group of workers. The latency percentiles are estimated from a
+// sample of the latencies of each worker.
+type queryGroupResult struct {
+	Name        string       `json:"name" yaml:"name"`
+	Workers     int          `json:"workers" yaml:"workers"`
+	Queries     int          `json:"queries" yaml:"queries"`
+	Succeeded   int          `json:"succeeded" yaml:"succeeded"`
+	Failed      int          `json:"failed" yaml:"failed"`
+	Skipped     int          `json:"skipped" yaml:"skipped"`
+	QPS         float64      `json:"qps" yaml:"qps"`
+	SuccessRate float64      `json:"successRate" yaml:"successRate"`
+	Latency     latencyStats `json:"latency" yaml:"latency"`
+}
+
+func (r fanOutResult) writeTable(w io.Writer) {
+	fmt.Fprintf(w, "%s\tWORKERS\tQUERIES\tSUCCEEDED\tFAILED\tSKIPPED\tQPS\tSUCCESS RATE\tP50\tP90\tP99\tMAX\n", strings.ToUpper(r.GroupBy))
+	for _, group := range append(slices.Clip(r.Groups), r.Total) {
+		l := group.Latency
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%.1f\t%.2f%%\t%.1fms\t%.1fms\t%.1fms\t%.1fms\n", group.Name, group.Workers, group.Queries,
+			group.Succeeded, group.Failed, group.Skipped, group.QPS, group.SuccessRate, l.P50, l.P90, l.P99, l.Max)
+	}
+	if len(r.Failures) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	writeFailures(w, r.Failures)
+}
+
+// newFanOutResult returns the results of the workers of each group, in the order of the groups
+func newFanOutResult(groupBy string, groups []string, responses map[string][]queryWorkerResponse, recordSets int) fanOutResult {
+	result := fanOutResult{RecordSets: recordSets, GroupBy: groupBy, Failures: map[string]int{}}
+	var all []queryWorkerResponse
+	for _, group := range groups {
+		result.Groups = append(result.Groups, mergeQueryWorkers(group, responses[group]))
+		all = append(all, responses[group]...)
+	}
+	result.Total = mergeQueryWorkers("total", all)
+	for _, response := range all {
+		result.Resolver = response.Result.Resolver
+		result.DurationSeconds = max(result.DurationSeconds, response.Result.DurationSeconds)
+		for reason, queries := range response.Result.Failures {
+			result.Failures[reason] += queries
+		}
+	}
+	return result
+}
+
+// mergeQueryWorkers adds up the results of a group of workers. The latency percentiles are of the latency samples of
+// every worker together, while the min, mean, and max are exact.
+func mergeQueryWorkers(name string, responses []queryWorkerResponse) queryGroupResult {
+	merged := queryGroupResult{Name: name, Workers: len(responses)}
+	var sample []time.Duration
+	var answered int
+	var total float64
+	for _, response := range responses {
+		r := response.Result
+		merged.Queries += r.Queries
+		merged.Succeeded += r.Succeeded
+		merged.Failed += r.Failed
+		merged.Skipped += r.Skipped
+		merged.QPS += r.QPS
+		sample = append(sample, response.Latencies...)
+		if n := r.Queries - r.Misses - r.Uncached; n > 0 {
+			if answered == 0 || r.Latency.Min < merged.Latency.Min {
+				merged.Latency.Min = r.Latency.Min
+			}
+			merged.Latency.Max = max(merged.Latency.Max, r.Latency.Max)
+			answered += n
+			total += r.Latency.Mean * float64(n)
+		}
+	}
+	if merged.Queries > 0 {
+		merged.SuccessRate = float64(merged.Succeeded) / float64(merged.Queries) * 100
+	}
+	if answered > 0 {
+		min, max := merged.Latency.Min, merged.Latency.Max
+		merged.Latency = newLatencyStats(sample)
+		merged.Latency.Min, merged.Latency.Mean, merged.Latency.Max = min, total/float64(answered), max
+	}
+	return merged
+}
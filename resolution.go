@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+const (
+	defaultVerifySample  = 100
+	defaultVerifyTimeout = 2 * time.Minute
+	// verifyRetryInterval is how long a record that doesn't resolve to its value yet waits before it's queried again
+	verifyRetryInterval = 5 * time.Second
+	// verifyConcurrency is how many records are queried at the same time
+	verifyConcurrency = 10
+)
+
+// maxResolutionMismatches is how many of the record sets that didn't resolve to their value the summary lists
+const maxResolutionMismatches = 20
+
+// resolutionStats is how many of the verified record sets resolved to the value they were last written with
+type resolutionStats struct {
+	Resolver string `json:"resolver" yaml:"resolver"`
+	Checked  int    `json:"checked" yaml:"checked"`
+	Resolved int    `json:"resolved" yaml:"resolved"`
+	// Mismatched record sets resolved, but not to the value they were last written with
+	Mismatched int `json:"mismatched" yaml:"mismatched"`
+	// Unresolved record sets didn't resolve before the timeout
+	Unresolved int `json:"unresolved" yaml:"unresolved"`
+	// Mismatches are the first record sets that didn't resolve to their value
+	Mismatches []resolutionMismatch `json:"mismatches,omitempty" yaml:"mismatches,omitempty"`
+}
+
+// resolutionMismatch is a verified record set that didn't resolve to the value it was last written with
+type resolutionMismatch struct {
+	Name string `json:"name" yaml:"name"`
+	Type string `json:"type" yaml:"type"`
+	// Subnet is the EDNS client subnet the record set was resolved from, if any
+	Subnet  string   `json:"subnet,omitempty" yaml:"subnet,omitempty"`
+	Want    string   `json:"want" yaml:"want"`
+	Answers []string `json:"answers" yaml:"answers"`
+}
+
+// sampledRecord is a written record set in the sample and the zone it was written in
+type sampledRecord struct {
+	hostedZoneID string
+	rr           types.ResourceRecordSet
+}
+
+// ResolutionVerifier resolves a sample of the record sets a run created or upserted once they're written, so a run shows
+// whether the zone is actually serving the records rather than only that Route 53 accepted them. They're resolved
+// either against a DNS resolver or with the TestDNSAnswer API. For a private hosted zone the resolver has to be one the
+// zone's VPCs use, e.g. the VPC's Route 53 Resolver at the VPC CIDR base +2. A nil ResolutionVerifier is a no-op.
+type ResolutionVerifier struct {
+	mu      sync.Mutex
+	address string
+	sample  int
+	timeout time.Duration
+	stats   *RunStats
+	// subnets are the EDNS client subnets every record set is resolved from, a single empty one for none
+	subnets []string
+	// interval paces the lookups of all the workers when set, for lookups that count towards an API request rate
+	interval time.Duration
+	// lookup returns the answers for the record set from the subnet in the same format as Route 53 record values
+	lookup func(ctx context.Context, record sampledRecord, subnet string) ([]string, error)
+	// seen is how many written record sets were offered to the sample
+	seen    int
+	records []sampledRecord
+	// index is the position in the sample of every record set offered to it, -1 if it isn't in the sample, so that a
+	// record set written again is verified with its last value and only offered once
+	index map[writtenRecord]int
+}
+
+// NewResolutionVerifier verifies up to sample record sets, or all of them when sample is 0, against the resolver at
+// address, which defaults to port 53
+func NewResolutionVerifier(address string, sample int, timeout time.Duration, stats *RunStats) *ResolutionVerifier {
+	resolver, address := newResolver(address)
+	return &ResolutionVerifier{
+		address: address,
+		sample:  sample,
+		timeout: timeout,
+		stats:   stats,
+		subnets: []string{""},
+		lookup: func(ctx context.Context, record sampledRecord, _ string) ([]string, error) {
+			return lookupRecord(ctx, resolver, record.rr.Type, aws.ToString(record.rr.Name))
+		},
+	}
+}
+
+// NewTestDNSAnswerVerifier verifies up to sample record sets, or all of them when sample is 0, with the TestDNSAnswer
+// API, which returns the answer of the zone's authoritative name servers from each of the EDNS client subnets, e.g.
+// to check the answers of geolocation and latency records. TestDNSAnswer only supports public hosted zones.
+func NewTestDNSAnswerVerifier(client route53API, subnets []string, sample int, timeout time.Duration, stats *RunStats) *ResolutionVerifier {
+	if len(subnets) == 0 {
+		subnets = []string{""}
+	}
+	return &ResolutionVerifier{
+		address: "TestDNSAnswer",
+		sample:  sample,
+		timeout: timeout,
+		stats:   stats,
+		subnets: subnets,
+		// TestDNSAnswer counts towards the Route 53 request rate that the change batches are paced for
+		interval: minBatchDelay,
+		lookup: func(ctx context.Context, record sampledRecord, subnet string) ([]string, error) {
+			input := &route53.TestDNSAnswerInput{
+				HostedZoneId: aws.String(record.hostedZoneID),
+				RecordName:   record.rr.Name,
+				RecordType:   record.rr.Type,
+			}
+			if subnet != "" {
+				ip, network, err := net.ParseCIDR(subnet)
+				if err != nil {
+					return nil, err
+				}
+				ones, _ := network.Mask.Size()
+				input.EDNS0ClientSubnetIP = aws.String(ip.String())
+				input.EDNS0ClientSubnetMask = aws.String(strconv.Itoa(ones))
+			}
+			out, err := client.TestDNSAnswer(ctx, input)
+			if err != nil {
+				return nil, err
+			}
+			if code := aws.ToString(out.ResponseCode); code != "NOERROR" {
+				return nil, fmt.Errorf("%s answered %s", aws.ToString(out.Nameserver), code)
+			}
+			return out.RecordData, nil
+		},
+	}
+}
+
+// newResolver returns a resolver that sends the queries round robin to the DNS servers at addresses, which default to
+// port 53, and the addresses with their ports. No addresses uses the system's resolvers.
+func newResolver(addresses ...string) (*net.Resolver, string) {
+	return newProtocolResolver(dnsProtocolUDP, addresses...)
+}
+
+// RecordBatch offers the record sets created or upserted by a successful change batch to the sample. A record set that's
+// already in the sample is verified with the value it was written with last.
+func (v *ResolutionVerifier) RecordBatch(hostedZoneID string, changes []types.Change) {
+	if v == nil {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.index == nil {
+		v.index = map[writtenRecord]int{}
+	}
+	hostedZoneID = strings.TrimPrefix(hostedZoneID, "/hostedzone/")
+	for _, change := range changes {
+		if change.Action == types.ChangeActionDelete || change.ResourceRecordSet == nil || len(change.ResourceRecordSet.ResourceRecords) == 0 {
+			continue
+		}
+		record := sampledRecord{hostedZoneID: hostedZoneID, rr: *change.ResourceRecordSet}
+		key := writtenKey(hostedZoneID, record.rr)
+		if i, ok := v.index[key]; ok {
+			if i >= 0 {
+				v.records[i] = record
+			}
+			continue
+		}
+		v.seen++
+		v.index[key] = -1
+		// reservoir sampling keeps a uniform sample without knowing how many record sets the run writes
+		switch {
+		case v.sample == 0 || len(v.records) < v.sample:
+			v.index[key] = len(v.records)
+			v.records = append(v.records, record)
+		default:
+			if i := rand.Intn(v.seen); i < v.sample {
+				v.index[writtenKey(v.records[i].hostedZoneID, v.records[i].rr)] = -1
+				v.index[key] = i
+				v.records[i] = record
+			}
+		}
+	}
+}
+
+// resolutionCheck is a sampled record set resolved from a subnet
+type resolutionCheck struct {
+	record sampledRecord
+	subnet string
+}
+
+// Verify resolves the sampled record sets, retrying the ones that don't resolve to their value yet until the timeout,
+// and records how many did in the run stats
+func (v *ResolutionVerifier) Verify(ctx context.Context) {
+	if v == nil {
+		return
+	}
+	v.mu.Lock()
+	records := v.records
+	v.records, v.seen, v.index = nil, 0, nil
+	v.mu.Unlock()
+	if len(records) == 0 {
+		return
+	}
+	slog.Info("🔎 Verifying the written record sets resolve", "resolver", v.address, "recordSets", len(records), "subnets", len(v.subnets), "timeout", v.timeout)
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+	var pace <-chan time.Time
+	if v.interval > 0 {
+		ticker := time.NewTicker(v.interval)
+		defer ticker.Stop()
+		pace = ticker.C
+	}
+	stats := resolutionStats{Resolver: v.address, Checked: len(records) * len(v.subnets)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan resolutionCheck)
+	for i := 0; i < verifyConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for check := range queue {
+				outcome, mismatch := v.verify(ctx, check, pace)
+				mu.Lock()
+				switch outcome {
+				case resolved:
+					stats.Resolved++
+				case mismatched:
+					stats.Mismatched++
+				default:
+					stats.Unresolved++
+				}
+				if outcome != resolved && len(stats.Mismatches) < maxResolutionMismatches {
+					stats.Mismatches = append(stats.Mismatches, mismatch)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, record := range records {
+		for _, subnet := range v.subnets {
+			queue <- resolutionCheck{record: record, subnet: subnet}
+		}
+	}
+	close(queue)
+	wg.Wait()
+	v.stats.RecordResolution(stats)
+	log := slog.Info
+	if stats.Resolved != stats.Checked {
+		log = slog.Warn
+	}
+	log("🔎 Verified the written record sets", "resolver", v.address, "checked", stats.Checked, "resolved", stats.Resolved,
+		"mismatched", stats.Mismatched, "unresolved", stats.Unresolved)
+}
+
+type resolutionOutcome int
+
+const (
+	unresolved resolutionOutcome = iota
+	mismatched
+	resolved
+)
+
+// verify resolves the record set until it resolves to the value it was last written with or ctx is done, waiting for pace
+// before every lookup when it's set. The answers are returned as a mismatch if it didn't resolve to its value.
+func (v *ResolutionVerifier) verify(ctx context.Context, check resolutionCheck, pace <-chan time.Time) (resolutionOutcome, resolutionMismatch) {
+	rr := check.record.rr
+	want := normalizeAnswer(aws.ToString(rr.ResourceRecords[0].Value))
+	mismatch := resolutionMismatch{Name: aws.ToString(rr.Name), Type: string(rr.Type), Subnet: check.subnet, Want: want, Answers: []string{}}
+	outcome := unresolved
+	for {
+		if pace != nil {
+			select {
+			case <-ctx.Done():
+				return outcome, mismatch
+			case <-pace:
+			}
+		}
+		answers, err := v.lookup(ctx, check.record, check.subnet)
+		if err == nil && len(answers) > 0 {
+			outcome = mismatched
+			mismatch.Answers = answers
+			for _, answer := range answers {
+				if normalizeAnswer(answer) == want {
+					return resolved, mismatch
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			slog.Debug("record set didn't resolve to its value", "name", mismatch.Name, "type", rr.Type, "subnet", check.subnet, "want", want, "answers", answers, "error", err)
+			return outcome, mismatch
+		case <-time.After(verifyRetryInterval):
+		}
+	}
+}
+
+// resolvableTypes are the record types lookupRecord can query
+var resolvableTypes = []types.RRType{types.RRTypeA, types.RRTypeAaaa, types.RRTypeCname, types.RRTypeTxt, types.RRTypeMx, types.RRTypeSrv}
+
+// lookupRecord returns the answers for the name in the same format as Route 53 record values
+func lookupRecord(ctx context.Context, resolver *net.Resolver, rrType types.RRType, name string) ([]string, error) {
+	var answers []string
+	switch rrType {
+	case types.RRTypeA, types.RRTypeAaaa:
+		network := "ip4"
+		if rrType == types.RRTypeAaaa {
+			network = "ip6"
+		}
+		ips, err := resolver.LookupIP(ctx, network, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			answers = append(answers, ip.String())
+		}
+	case types.RRTypeCname:
+		cname, err := resolver.LookupCNAME(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, cname)
+	case types.RRTypeTxt:
+		txts, err := resolver.LookupTXT(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, txt := range txts {
+			answers = append(answers, fmt.Sprintf("%q", txt))
+		}
+	case types.RRTypeMx:
+		mxs, err := resolver.LookupMX(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, mx := range mxs {
+			answers = append(answers, fmt.Sprintf("%d %s", mx.Pref, mx.Host))
+		}
+	case types.RRTypeSrv:
+		_, srvs, err := resolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range srvs {
+			answers = append(answers, fmt.Sprintf("%d %d %d %s", srv.Priority, srv.Weight, srv.Port, srv.Target))
+		}
+	default:
+		return nil, fmt.Errorf("resolving %s record sets isn't supported", rrType)
+	}
+	return answers, nil
+}
+
+// normalizeAnswer makes an answer comparable to a record value regardless of case and the trailing dot of names
+func normalizeAnswer(answer string) string {
+	return strings.TrimSuffix(strings.ToLower(answer), ".")
+}
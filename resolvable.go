@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+const (
+	defaultResolvableSamplePercent = 1
+	defaultResolvablePollInterval  = time.Second
+)
+
+// pendingRecord is a sampled record set that doesn't resolve to its new value yet
+type pendingRecord struct {
+	name      string
+	rrType    types.RRType
+	want      string
+	submitted time.Time
+}
+
+// ResolvableTracker resolves a sample of the created and updated record sets in the background from the moment their
+// change batch is submitted, and records how long each took to resolve to its new value. Unlike INSYNC, which is
+// when Route 53 says every DNS server has the change, this is when a client sees it. Every pending record set is
+// resolved once per interval, so the measurement is accurate to the interval. A nil ResolvableTracker is a no-op.
+type ResolvableTracker struct {
+	mu       sync.Mutex
+	resolver *net.Resolver
+	percent  float64
+	stats    *RunStats
+	interval time.Duration
+	pending  []pendingRecord
+	// polling is canceled by Close, which stops resolving including the lookups in flight
+	polling     context.Context
+	stopPolling context.CancelFunc
+	stopped     chan struct{}
+}
+
+// NewResolvableTracker starts resolving percent of the record sets passed to Track against the resolvers at addresses,
+// or the system's resolvers if there are none, until Close is called
+func NewResolvableTracker(addresses []string, percent float64, interval time.Duration, stats *RunStats) *ResolvableTracker {
+	resolver, _ := newResolver(addresses...)
+	r := &ResolvableTracker{
+		resolver: resolver,
+		percent:  percent,
+		stats:    stats,
+		interval: interval,
+		stopped:  make(chan struct{}),
+	}
+	r.polling, r.stopPolling = context.WithCancel(context.Background())
+	go func() {
+		defer close(r.stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.poll(r.polling)
+			case <-r.polling.Done():
+				return
+			}
+		}
+	}()
+	return r
+}
+
+// Track samples the record sets created or updated by a change batch submitted at submitted
+func (r *ResolvableTracker) Track(changes []types.Change, submitted time.Time) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, change := range changes {
+		rr := change.ResourceRecordSet
+		if change.Action == types.ChangeActionDelete || rr == nil || len(rr.ResourceRecords) == 0 || !slices.Contains(resolvableTypes, rr.Type) {
+			continue
+		}
+		if rand.Float64()*100 >= r.percent {
+			continue
+		}
+		r.pending = append(r.pending, pendingRecord{
+			name:      aws.ToString(rr.Name),
+			rrType:    rr.Type,
+			want:      normalizeAnswer(aws.ToString(rr.ResourceRecords[0].Value)),
+			submitted: submitted,
+		})
+	}
+}
+
+// Close waits for the pending record sets to resolve, up to propagationWaitTimeout, and stops resolving
+func (r *ResolvableTracker) Close(ctx context.Context) {
+	if r == nil {
+		return
+	}
+	defer func() {
+		r.stopPolling()
+		<-r.stopped
+	}()
+	ctx, cancel := context.WithTimeout(ctx, propagationWaitTimeout)
+	defer cancel()
+	if pending := r.remaining(); pending > 0 {
+		slog.Info("⏳ Waiting for the last record sets to resolve", "pending", pending)
+	}
+	for r.remaining() > 0 {
+		select {
+		case <-ctx.Done():
+			slog.Warn("gave up waiting for record sets to resolve", "pending", r.remaining())
+			return
+		case <-time.After(r.interval):
+		}
+	}
+}
+
+func (r *ResolvableTracker) remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.pending)
+}
+
+// poll resolves every pending record set once, recording the ones that resolve to their new value
+func (r *ResolvableTracker) poll(ctx context.Context) {
+	r.mu.Lock()
+	pending := r.pending
+	r.mu.Unlock()
+	var mu sync.Mutex
+	done := map[pendingRecord]bool{}
+	var wg sync.WaitGroup
+	queue := make(chan pendingRecord)
+	for i := 0; i < verifyConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for record := range queue {
+				queryCtx, cancel := context.WithTimeout(ctx, queryTimeout)
+				answers, err := lookupRecord(queryCtx, r.resolver, record.rrType, record.name)
+				cancel()
+				if err != nil {
+					continue
+				}
+				for _, answer := range answers {
+					if normalizeAnswer(answer) != record.want {
+						continue
+					}
+					resolvable := time.Since(record.submitted)
+					slog.Debug("Record set resolved", "name", record.name, "type", record.rrType, "resolvable", resolvable)
+					r.stats.RecordResolvable(resolvable)
+					mu.Lock()
+					done[record] = true
+					mu.Unlock()
+					break
+				}
+			}
+		}()
+	}
+	for _, record := range pending {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- record
+	}
+	close(queue)
+	wg.Wait()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	remaining := r.pending[:0]
+	for _, record := range r.pending {
+		if !done[record] {
+			remaining = append(remaining, record)
+		}
+	}
+	r.pending = remaining
+}
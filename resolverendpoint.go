@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53resolver"
+	resolvertypes "github.com/aws/aws-sdk-go-v2/service/route53resolver/types"
+	"github.com/aws/smithy-go"
+	"github.com/google/uuid"
+)
+
+const (
+	// resolverEndpointPollInterval is how often a new resolver endpoint is described until it's operational
+	resolverEndpointPollInterval = 10 * time.Second
+	// resolverEndpointTimeout is how long a new resolver endpoint has to become operational
+	resolverEndpointTimeout = 10 * time.Minute
+)
+
+// InboundEndpointAddresses returns the IP addresses of a Route 53 Resolver inbound endpoint, so that queries sent to them
+// take the same path as the queries on-premises DNS servers forward to the VPC
+func (z Zone) InboundEndpointAddresses(ctx context.Context, endpointID string) ([]string, error) {
+	out, err := z.R53Resolver.GetResolverEndpoint(ctx, &route53resolver.GetResolverEndpointInput{ResolverEndpointId: &endpointID})
+	if err != nil {
+		return nil, fmt.Errorf("unable to describe resolver endpoint %s: %w", endpointID, err)
+	}
+	if out.ResolverEndpoint.Direction != resolvertypes.ResolverEndpointDirectionInbound {
+		return nil, fmt.Errorf("resolver endpoint %s is %s, only an INBOUND endpoint answers queries", endpointID, out.ResolverEndpoint.Direction)
+	}
+	return z.resolverEndpointAddresses(ctx, endpointID)
+}
+
+// resolverEndpointAddresses returns the IPv4 addresses of a Route 53 Resolver endpoint
+func (z Zone) resolverEndpointAddresses(ctx context.Context, endpointID string) ([]string, error) {
+	var addresses []string
+	var nextToken *string
+	for {
+		ipsOut, err := z.R53Resolver.ListResolverEndpointIpAddresses(ctx, &route53resolver.ListResolverEndpointIpAddressesInput{
+			ResolverEndpointId: &endpointID,
+			NextToken:          nextToken,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list the IP addresses of resolver endpoint %s: %w", endpointID, err)
+		}
+		for _, ip := range ipsOut.IpAddresses {
+			if ip.Ip != nil {
+				addresses = append(addresses, *ip.Ip)
+			}
+		}
+		if ipsOut.NextToken == nil {
+			break
+		}
+		nextToken = ipsOut.NextToken
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("resolver endpoint %s has no IPv4 addresses", endpointID)
+	}
+	return addresses, nil
+}
+
+// CreateInboundEndpoint creates a Route 53 Resolver inbound endpoint with an IP address in each of the subnets and waits
+// until it's operational. The endpoint ID is returned, also when the endpoint didn't become operational, so that it
+// can be deleted.
+func (z Zone) CreateInboundEndpoint(ctx context.Context, subnetIDs []string, securityGroupIDs []string) (string, error) {
+	return z.createResolverEndpoint(ctx, resolvertypes.ResolverEndpointDirectionInbound, subnetIDs, securityGroupIDs)
+}
+
+// CreateOutboundEndpoint creates a Route 53 Resolver outbound endpoint with an IP address in each of the subnets and waits
+// until it's operational. It's tagged so that cleanup deletes it with the zone when it's in one of the zone's VPCs. The
+// endpoint ID is returned, also when the endpoint didn't become operational, so that it can be deleted.
+func (z Zone) CreateOutboundEndpoint(ctx context.Context, subnetIDs []string, securityGroupIDs []string) (string, error) {
+	return z.createResolverEndpoint(ctx, resolvertypes.ResolverEndpointDirectionOutbound, subnetIDs, securityGroupIDs)
+}
+
+func (z Zone) createResolverEndpoint(ctx context.Context, direction resolvertypes.ResolverEndpointDirection, subnetIDs []string, securityGroupIDs []string) (string, error) {
+	kind := strings.ToLower(string(direction))
+	ipAddresses := make([]resolvertypes.IpAddressRequest, 0, len(subnetIDs))
+	for _, subnetID := range subnetIDs {
+		ipAddresses = append(ipAddresses, resolvertypes.IpAddressRequest{SubnetId: aws.String(subnetID)})
+	}
+	out, err := z.R53Resolver.CreateResolverEndpoint(ctx, &route53resolver.CreateResolverEndpointInput{
+		CreatorRequestId: aws.String(uuid.NewString()),
+		Direction:        direction,
+		IpAddresses:      ipAddresses,
+		SecurityGroupIds: securityGroupIDs,
+		Name:             aws.String(fmt.Sprintf("floodzone-test-%s", uuid.NewString())),
+		Tags:             []resolvertypes.Tag{{Key: aws.String(ephemeralVPCTagKey), Value: aws.String("true")}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to create %s endpoint: %w", kind, err)
+	}
+	endpointID := *out.ResolverEndpoint.Id
+	slog.Info(fmt.Sprintf("⏳ Waiting for the %s endpoint to be operational", kind), "endpoint", endpointID)
+	ctx, cancel := context.WithTimeout(ctx, resolverEndpointTimeout)
+	defer cancel()
+	for {
+		select {
+		case <-ctx.Done():
+			return endpointID, fmt.Errorf("%s endpoint %s didn't become operational: %w", kind, endpointID, ctx.Err())
+		case <-time.After(resolverEndpointPollInterval):
+		}
+		endpointOut, err := z.R53Resolver.GetResolverEndpoint(ctx, &route53resolver.GetResolverEndpointInput{ResolverEndpointId: &endpointID})
+		if err != nil {
+			return endpointID, fmt.Errorf("unable to describe resolver endpoint %s: %w", endpointID, err)
+		}
+		switch endpointOut.ResolverEndpoint.Status {
+		case resolvertypes.ResolverEndpointStatusOperational:
+			slog.Info(fmt.Sprintf("✅ Successfully created %s endpoint", kind), "endpoint", endpointID)
+			return endpointID, nil
+		case resolvertypes.ResolverEndpointStatusActionNeeded:
+			return endpointID, fmt.Errorf("%s endpoint %s needs action: %s", kind, endpointID, aws.ToString(endpointOut.ResolverEndpoint.StatusMessage))
+		}
+	}
+}
+
+// DeleteResolverEndpoint deletes an endpoint created by CreateInboundEndpoint or CreateOutboundEndpoint, it's deleted in
+// the background
+func (z Zone) DeleteResolverEndpoint(ctx context.Context, endpointID string) error {
+	if _, err := z.R53Resolver.DeleteResolverEndpoint(ctx, &route53resolver.DeleteResolverEndpointInput{ResolverEndpointId: &endpointID}); err != nil {
+		var notFound *resolvertypes.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			return nil
+		}
+		return fmt.Errorf("unable to delete resolver endpoint %s: %w", endpointID, err)
+	}
+	slog.Info("✅ Successfully deleted resolver endpoint", "endpoint", endpointID)
+	return nil
+}
+
+// DeleteEphemeralEndpoints deletes the resolver endpoints floodzone created in the VPCs of the zone in the current region
+// and waits until they're gone, since a VPC can't be deleted while an endpoint still has an IP address in it. Endpoints
+// without the floodzone ephemeral tag are left untouched.
+func (z Zone) DeleteEphemeralEndpoints(ctx context.Context, vpcs []types.VPC, region string) error {
+	var deleting []string
+	for _, vpc := range vpcs {
+		if string(vpc.VPCRegion) != region {
+			continue
+		}
+		endpoints, err := z.ephemeralEndpoints(ctx, *vpc.VPCId)
+		// runs without Route 53 Resolver permissions can't have created endpoints either
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && authErrorCodes[apiErr.ErrorCode()] {
+			slog.Warn("not allowed to list the resolver endpoints of the VPC, assuming floodzone created none", "vpc", *vpc.VPCId, "error", apiErr.ErrorCode())
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to list the resolver endpoints of VPC %s: %w", *vpc.VPCId, err)
+		}
+		for _, endpointID := range endpoints {
+			if err := z.DeleteResolverEndpoint(ctx, endpointID); err != nil {
+				return err
+			}
+			deleting = append(deleting, endpointID)
+		}
+	}
+	if len(deleting) == 0 {
+		return nil
+	}
+	slog.Info("⏳ Waiting for the resolver endpoints to be deleted", "endpoints", len(deleting))
+	ctx, cancel := context.WithTimeout(ctx, resolverEndpointTimeout)
+	defer cancel()
+	for _, endpointID := range deleting {
+		for {
+			_, err := z.R53Resolver.GetResolverEndpoint(ctx, &route53resolver.GetResolverEndpointInput{ResolverEndpointId: &endpointID})
+			var notFound *resolvertypes.ResourceNotFoundException
+			if errors.As(err, &notFound) {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("unable to describe resolver endpoint %s: %w", endpointID, err)
+			}
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("resolver endpoint %s wasn't deleted: %w", endpointID, ctx.Err())
+			case <-time.After(resolverEndpointPollInterval):
+			}
+		}
+	}
+	return nil
+}
+
+// ephemeralEndpoints returns the IDs of the resolver endpoints in the VPC that have the floodzone ephemeral tag
+func (z Zone) ephemeralEndpoints(ctx context.Context, vpcID string) ([]string, error) {
+	var endpointIDs []string
+	var nextToken *string
+	for {
+		out, err := z.R53Resolver.ListResolverEndpoints(ctx, &route53resolver.ListResolverEndpointsInput{
+			Filters:   []resolvertypes.Filter{{Name: aws.String("HostVPCId"), Values: []string{vpcID}}},
+			NextToken: nextToken,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, endpoint := range out.ResolverEndpoints {
+			tagsOut, err := z.R53Resolver.ListTagsForResource(ctx, &route53resolver.ListTagsForResourceInput{ResourceArn: endpoint.Arn})
+			if err != nil {
+				return nil, fmt.Errorf("unable to list the tags of resolver endpoint %s: %w", aws.ToString(endpoint.Id), err)
+			}
+			for _, tag := range tagsOut.Tags {
+				if aws.ToString(tag.Key) == ephemeralVPCTagKey && aws.ToString(tag.Value) == "true" {
+					endpointIDs = append(endpointIDs, aws.ToString(endpoint.Id))
+					break
+				}
+			}
+		}
+		if out.NextToken == nil {
+			return endpointIDs, nil
+		}
+		nextToken = out.NextToken
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53resolver"
+	resolvertypes "github.com/aws/aws-sdk-go-v2/service/route53resolver/types"
+	"github.com/google/uuid"
+)
+
+// ForwardingRule is a Route 53 Resolver forwarding rule created by CreateForwardingRule and the VPCs it's associated with
+type ForwardingRule struct {
+	ID string
+	// associations are the IDs of the rule's VPC associations by VPC ID
+	associations map[string]string
+}
+
+// parseForwardTargets parses comma-separated ip[:port] forwarding targets, the port defaults to 53
+func parseForwardTargets(s string) ([]resolvertypes.TargetAddress, error) {
+	var targets []resolvertypes.TargetAddress
+	for _, target := range splitList(s) {
+		host, port := target, "53"
+		if h, p, err := net.SplitHostPort(target); err == nil {
+			host, port = h, p
+		}
+		if net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("forwarding target %q is not an IP address", target)
+		}
+		portNum, err := strconv.ParseInt(port, 10, 32)
+		if err != nil || portNum < 1 || portNum > 65535 {
+			return nil, fmt.Errorf("forwarding target %q has an invalid port", target)
+		}
+		targets = append(targets, resolvertypes.TargetAddress{Ip: aws.String(host), Port: aws.Int32(int32(portNum))})
+	}
+	return targets, nil
+}
+
+// CreateForwardingRule creates a Route 53 Resolver rule that forwards the queries for domain through the outbound endpoint
+// to the targets, associates it with the VPCs, and waits until the associations are complete. The rule is returned, also
+// when an association failed, so that it can be deleted.
+func (z Zone) CreateForwardingRule(ctx context.Context, domain string, outboundEndpointID string, targets []resolvertypes.TargetAddress, vpcIDs []string) (*ForwardingRule, error) {
+	out, err := z.R53Resolver.CreateResolverRule(ctx, &route53resolver.CreateResolverRuleInput{
+		CreatorRequestId:   aws.String(uuid.NewString()),
+		DomainName:         aws.String(domain),
+		RuleType:           resolvertypes.RuleTypeOptionForward,
+		Name:               aws.String(fmt.Sprintf("floodzone-test-%s", uuid.NewString())),
+		ResolverEndpointId: aws.String(outboundEndpointID),
+		TargetIps:          targets,
+		Tags:               []resolvertypes.Tag{{Key: aws.String(ephemeralVPCTagKey), Value: aws.String("true")}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create forwarding rule for %s: %w", domain, err)
+	}
+	rule := &ForwardingRule{ID: *out.ResolverRule.Id, associations: map[string]string{}}
+	for _, vpcID := range vpcIDs {
+		assocOut, err := z.R53Resolver.AssociateResolverRule(ctx, &route53resolver.AssociateResolverRuleInput{
+			ResolverRuleId: aws.String(rule.ID),
+			VPCId:          aws.String(vpcID),
+		})
+		if err != nil {
+			return rule, fmt.Errorf("unable to associate forwarding rule %s with VPC %s: %w", rule.ID, vpcID, err)
+		}
+		rule.associations[vpcID] = *assocOut.ResolverRuleAssociation.Id
+	}
+	slog.Info("⏳ Waiting for the forwarding rule to be associated", "rule", rule.ID, "vpcs", len(vpcIDs))
+	ctx, cancel := context.WithTimeout(ctx, resolverEndpointTimeout)
+	defer cancel()
+	for vpcID, associationID := range rule.associations {
+		if err := z.waitForRuleAssociation(ctx, associationID); err != nil {
+			return rule, fmt.Errorf("forwarding rule %s wasn't associated with VPC %s: %w", rule.ID, vpcID, err)
+		}
+	}
+	slog.Info("✅ Successfully created forwarding rule", "rule", rule.ID, "domain", domain)
+	return rule, nil
+}
+
+func (z Zone) waitForRuleAssociation(ctx context.Context, associationID string) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(resolverEndpointPollInterval):
+		}
+		out, err := z.R53Resolver.GetResolverRuleAssociation(ctx, &route53resolver.GetResolverRuleAssociationInput{ResolverRuleAssociationId: &associationID})
+		if err != nil {
+			return fmt.Errorf("unable to describe resolver rule association %s: %w", associationID, err)
+		}
+		switch out.ResolverRuleAssociation.Status {
+		case resolvertypes.ResolverRuleAssociationStatusComplete:
+			return nil
+		case resolvertypes.ResolverRuleAssociationStatusFailed, resolvertypes.ResolverRuleAssociationStatusOverridden:
+			return fmt.Errorf("association is %s: %s", out.ResolverRuleAssociation.Status, aws.ToString(out.ResolverRuleAssociation.StatusMessage))
+		}
+	}
+}
+
+// DeleteForwardingRule disassociates a forwarding rule created by CreateForwardingRule from its VPCs and deletes it. A rule
+// can't be deleted until it's disassociated, which happens in the background, so the delete is retried until then.
+func (z Zone) DeleteForwardingRule(ctx context.Context, rule *ForwardingRule) error {
+	var notFound *resolvertypes.ResourceNotFoundException
+	for vpcID := range rule.associations {
+		_, err := z.R53Resolver.DisassociateResolverRule(ctx, &route53resolver.DisassociateResolverRuleInput{
+			ResolverRuleId: aws.String(rule.ID),
+			VPCId:          aws.String(vpcID),
+		})
+		if err != nil && !errors.As(err, &notFound) {
+			return fmt.Errorf("unable to disassociate forwarding rule %s from VPC %s: %w", rule.ID, vpcID, err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, resolverEndpointTimeout)
+	defer cancel()
+	for {
+		_, err := z.R53Resolver.DeleteResolverRule(ctx, &route53resolver.DeleteResolverRuleInput{ResolverRuleId: aws.String(rule.ID)})
+		var inUse *resolvertypes.ResourceInUseException
+		switch {
+		case err == nil:
+			slog.Info("✅ Successfully deleted forwarding rule", "rule", rule.ID)
+			return nil
+		case errors.As(err, &notFound):
+			return nil
+		case !errors.As(err, &inUse):
+			return fmt.Errorf("unable to delete forwarding rule %s: %w", rule.ID, err)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("forwarding rule %s is still associated: %w", rule.ID, ctx.Err())
+		case <-time.After(resolverEndpointPollInterval):
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// httpStatusCodes maps the gRPC status codes of the ControlServer's errors to the HTTP status codes of the REST API
+var httpStatusCodes = map[codes.Code]int{
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.FailedPrecondition: http.StatusConflict,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+}
+
+// restError is the body of a failed REST API call
+type restError struct {
+	Error string `json:"error"`
+}
+
+// restHandler serves the REST API of the serve command to the callers with its bearer token:
+//
+//	GET    /runs              lists the runs, most recently started first
+//	POST   /runs              starts a run, {"command": "flood", "args": [...], "runId": "..."}
+//	GET    /runs/{id}         returns the status of a run
+//	DELETE /runs/{id}         aborts a run
+//	POST   /runs/{id}/pause   pauses a run
+//	POST   /runs/{id}/resume  resumes a run
+//	GET    /runs/{id}/events  streams the events of a run as JSON lines until it exited
+func (s *ControlServer) restHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if !s.authorized(r.Header.Get("Authorization")) {
+			rw.Header().Set("WWW-Authenticate", "Bearer")
+			writeRESTError(rw, status.Error(codes.Unauthenticated, "the call needs the bearer token of the server in its Authorization header"))
+			return
+		}
+		path := strings.Trim(r.URL.Path, "/")
+		if path == "runs" {
+			switch r.Method {
+			case http.MethodGet:
+				writeREST(rw, http.StatusOK, s.list())
+			case http.MethodPost:
+				s.handleStartRun(rw, r)
+			default:
+				methodNotAllowed(rw, http.MethodGet, http.MethodPost)
+			}
+			return
+		}
+		runID, action, _ := strings.Cut(strings.TrimPrefix(path, "runs/"), "/")
+		if !strings.HasPrefix(path, "runs/") || runID == "" {
+			writeRESTError(rw, status.Error(codes.NotFound, "not found"))
+			return
+		}
+		run, err := s.lookup(runID)
+		if err != nil {
+			writeRESTError(rw, err)
+			return
+		}
+		switch {
+		case action == "" && r.Method == http.MethodGet:
+			writeREST(rw, http.StatusOK, s.status(run))
+		case action == "" && r.Method == http.MethodDelete:
+			result, err := s.abort(r.Context(), run)
+			writeRESTResult(rw, http.StatusAccepted, result, err)
+		case action == "":
+			methodNotAllowed(rw, http.MethodGet, http.MethodDelete)
+		case (action == "pause" || action == "resume") && r.Method == http.MethodPost:
+			result, err := s.control(r.Context(), run, action)
+			writeRESTResult(rw, http.StatusOK, result, err)
+		case action == "pause" || action == "resume":
+			methodNotAllowed(rw, http.MethodPost)
+		case action == "events" && r.Method == http.MethodGet:
+			s.handleEvents(rw, r, run)
+		case action == "events":
+			methodNotAllowed(rw, http.MethodGet)
+		default:
+			writeRESTError(rw, status.Error(codes.NotFound, "not found"))
+		}
+	})
+}
+
+func (s *ControlServer) handleStartRun(rw http.ResponseWriter, r *http.Request) {
+	var req startRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeRESTError(rw, status.Errorf(codes.InvalidArgument, "unable to parse request: %v", err))
+		return
+	}
+	result, err := s.startRun(req)
+	if err == nil {
+		rw.Header().Set("Location", "/runs/"+result.RunID)
+	}
+	writeRESTResult(rw, http.StatusCreated, result, err)
+}
+
+// handleEvents streams the events of a run as JSON lines, flushing every event as soon as it's received
+func (s *ControlServer) handleEvents(rw http.ResponseWriter, r *http.Request, run *controlledRun) {
+	rw.Header().Set("Content-Type", "application/x-ndjson")
+	rw.WriteHeader(http.StatusOK)
+	flusher, _ := rw.(http.Flusher)
+	encoder := json.NewEncoder(rw)
+	err := s.follow(r.Context(), run, func(event controlEvent) error {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil && r.Context().Err() == nil {
+		slog.Debug("unable to stream the events of a run", "runId", run.id, "error", err)
+	}
+}
+
+func writeRESTResult(rw http.ResponseWriter, code int, v any, err error) {
+	if err != nil {
+		writeRESTError(rw, err)
+		return
+	}
+	writeREST(rw, code, v)
+}
+
+func writeRESTError(rw http.ResponseWriter, err error) {
+	code, ok := httpStatusCodes[status.Code(err)]
+	if !ok {
+		code = http.StatusInternalServerError
+	}
+	writeREST(rw, code, restError{Error: status.Convert(err).Message()})
+}
+
+func writeREST(rw http.ResponseWriter, code int, v any) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	if err := json.NewEncoder(rw).Encode(v); err != nil {
+		slog.Debug("unable to write REST API response", "error", err)
+	}
+}
+
+func methodNotAllowed(rw http.ResponseWriter, allowed ...string) {
+	rw.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeREST(rw, http.StatusMethodNotAllowed, restError{Error: "method not allowed"})
+}
@@ -0,0 +1,743 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// grpcServiceName is the gRPC service of the serve command, see proto/floodzone/v1/floodzone.proto
+const grpcServiceName = "floodzone.v1.Floodzone"
+
+const (
+	// controlTimeout bounds the calls to the web dashboard of a run
+	controlTimeout = 10 * time.Second
+	// exitedRunRetention is how long the status and events of a run are kept after it exited, and maxExitedRuns how
+	// many exited runs are kept at most, so that a long-lived serve command doesn't grow without bound
+	exitedRunRetention = 24 * time.Hour
+	maxExitedRuns      = 100
+)
+
+// validRunID is what the run ID of a started run must look like, since it names the files, AWS resources, and event
+// URLs of the run
+var validRunID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// remoteRunFlags are the flags that the args of a started run and the config of a FloodRun may set. The others could
+// run commands, write files, send the events of the run elsewhere, or change its credentials on the runner host or in
+// the Job's pod, so only the operator of the host or the controller sets them.
+var remoteRunFlags = map[string]bool{
+	"hosted-zone-id":            true,
+	"vpc-id":                    true,
+	"create-vpc":                true,
+	"total-records":             true,
+	"iterations":                true,
+	"max-batch-size":            true,
+	"batch-delay-duration":      true,
+	"record-generator":          true,
+	"query-logging":             true,
+	"verify-resolver":           true,
+	"verify-test-dns-answer":    true,
+	"verify-edns-subnets":       true,
+	"verify-sample":             true,
+	"verify-timeout":            true,
+	"verify-list":               true,
+	"measure-propagation":       true,
+	"propagation-poll-interval": true,
+	"measure-resolvable":        true,
+	"resolvable-resolver":       true,
+	"resolvable-sample-percent": true,
+	"resolvable-poll-interval":  true,
+	"max-cost":                  true,
+	"max-errors":                true,
+	"on-error-budget":           true,
+	"cost-lifetime":             true,
+	"region":                    true,
+	"log-level":                 true,
+	"log-format":                true,
+	"q":                         true,
+	"quiet":                     true,
+	"v":                         true,
+	"verbose":                   true,
+	"no-color":                  true,
+	"no-emoji":                  true,
+	"output":                    true,
+}
+
+func init() {
+	commands = append(commands, command{
+		name:        "serve",
+		description: "Serve a gRPC or REST API to start runs on this host and to follow, pause, resume, and abort them",
+		flags: func(fs *flag.FlagSet, opts *Options) {
+			fs.StringVar(&opts.GRPCAddr, "grpc", "", "Address to serve the gRPC API on, e.g. localhost:50051")
+			fs.StringVar(&opts.HTTPAddr, "http", "", "Address to serve the REST API on, e.g. localhost:8080")
+			fs.StringVar(&opts.TLSCert, "tls-cert", "", "PEM certificate to serve the APIs with over TLS, along with --tls-key")
+			fs.StringVar(&opts.TLSKey, "tls-key", "", "PEM private key of --tls-cert")
+			fs.StringVar(&opts.AuthTokenFile, "auth-token-file", "", "File holding the bearer token the callers of the APIs must send in the authorization header")
+		},
+		runLocal: runServe,
+	})
+}
+
+// startRunRequest starts a run of a command with the arguments it's run with on the command line
+type startRunRequest struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	// RunID is the --run-id of the run, 1 to 64 letters, digits, hyphens, or underscores, defaults to a random UUID
+	RunID string `json:"runId"`
+}
+
+// runRequest identifies the run of a GetStatus, Pause, Resume, Abort, or StreamEvents call
+type runRequest struct {
+	RunID string `json:"runId"`
+}
+
+// controlStatus is the state of a run started by the serve command
+type controlStatus struct {
+	RunID   string   `json:"runId"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	// State is starting until the run serves its dashboard, then running, paused, or aborting, and exited once the
+	// process exited
+	State    string `json:"state"`
+	ExitCode *int   `json:"exitCode,omitempty"`
+	// Run is the live status of the run from its web dashboard while it's serving it
+	Run *webStatus `json:"run,omitempty"`
+}
+
+// controlEvent is an event streamed by StreamEvents: a run event, a batch event, or the exit of the process
+type controlEvent struct {
+	RunID string `json:"runId"`
+	// Type is run, batch, or exit
+	Type     string          `json:"type"`
+	Event    json.RawMessage `json:"event,omitempty"`
+	ExitCode *int            `json:"exitCode,omitempty"`
+}
+
+// controlledRun is a floodzone process started by the serve command. The process serves its web dashboard on a local
+// address, which the serve command pauses, resumes, and aborts it through, and posts its run and batch events to the
+// serve command's event listener.
+type controlledRun struct {
+	mu        sync.Mutex
+	id        string
+	command   string
+	args      []string
+	dashboard string
+	// token is what the control requests to the dashboard of the run need
+	token    string
+	started  time.Time
+	process  *exec.Cmd
+	exitCode *int
+	// exited is when the process exited, zero while it's running
+	exited time.Time
+	events []controlEvent
+	// changed is closed and replaced whenever an event is added or the process exits
+	changed chan struct{}
+}
+
+// ControlServer starts floodzone runs as child processes of the serve command and controls them over gRPC and REST.
+// Its errors are gRPC status errors, which the REST API maps to HTTP status codes.
+type ControlServer struct {
+	mu     sync.Mutex
+	runs   map[string]*controlledRun
+	binary string
+	// eventsURL is the base URL of the listener the runs post their events to
+	eventsURL string
+	client    *http.Client
+	// token is the bearer token the callers of the APIs authenticate with
+	token string
+}
+
+func runServe(ctx context.Context, opts Options, _ []string) error {
+	if opts.GRPCAddr == "" && opts.HTTPAddr == "" {
+		return errors.New("--grpc or --http is required")
+	}
+	if (opts.TLSCert == "") != (opts.TLSKey == "") {
+		return errors.New("--tls-cert and --tls-key must be set together")
+	}
+	// the APIs start processes with the credentials of the host, so nobody can call them without the token
+	if opts.AuthTokenFile == "" {
+		return errors.New("--auth-token-file is required")
+	}
+	token, err := os.ReadFile(opts.AuthTokenFile)
+	if err != nil {
+		return fmt.Errorf("unable to read the auth token: %w", err)
+	}
+	if len(bytes.TrimSpace(token)) == 0 {
+		return fmt.Errorf("the auth token file %s is empty", opts.AuthTokenFile)
+	}
+	binary, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("unable to find the floodzone binary to start runs with: %w", err)
+	}
+	events, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("unable to listen for the events of the runs: %w", err)
+	}
+	s := &ControlServer{
+		runs:      map[string]*controlledRun{},
+		binary:    binary,
+		eventsURL: "http://" + events.Addr().String(),
+		client:    &http.Client{Timeout: controlTimeout},
+		token:     string(bytes.TrimSpace(token)),
+	}
+	eventServer := &http.Server{Handler: http.HandlerFunc(s.handleEvent), ReadHeaderTimeout: 10 * time.Second}
+	go eventServer.Serve(events)
+	defer eventServer.Close()
+
+	// both APIs are listened on before serving either, so that a busy port fails before any run can start
+	var grpcListener, httpListener net.Listener
+	if opts.GRPCAddr != "" {
+		if grpcListener, err = net.Listen("tcp", opts.GRPCAddr); err != nil {
+			return fmt.Errorf("unable to listen on %s: %w", opts.GRPCAddr, err)
+		}
+	}
+	if opts.HTTPAddr != "" {
+		if httpListener, err = net.Listen("tcp", opts.HTTPAddr); err != nil {
+			return fmt.Errorf("unable to listen on %s: %w", opts.HTTPAddr, err)
+		}
+	}
+	serverOpts := []grpc.ServerOption{grpc.UnaryInterceptor(s.authenticateUnary), grpc.StreamInterceptor(s.authenticateStream)}
+	if opts.TLSCert != "" {
+		creds, err := credentials.NewServerTLSFromFile(opts.TLSCert, opts.TLSKey)
+		if err != nil {
+			return fmt.Errorf("unable to load the TLS certificate: %w", err)
+		}
+		serverOpts = append(serverOpts, grpc.Creds(creds))
+	}
+	grpcServer := grpc.NewServer(serverOpts...)
+	grpcServer.RegisterService(&controlServiceDesc, s)
+	httpServer := &http.Server{Handler: s.restHandler(), ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errs := make(chan error, 2)
+	if grpcListener != nil {
+		slog.Info("🚀 Serving the floodzone gRPC API", "addr", grpcListener.Addr().String(), "tls", opts.TLSCert != "")
+		go func() { errs <- grpcServer.Serve(grpcListener) }()
+	}
+	if httpListener != nil {
+		slog.Info("🚀 Serving the floodzone REST API", "addr", httpListener.Addr().String(), "tls", opts.TLSCert != "")
+		go func() {
+			if opts.TLSCert != "" {
+				errs <- httpServer.ServeTLS(httpListener, opts.TLSCert, opts.TLSKey)
+			} else {
+				errs <- httpServer.Serve(httpListener)
+			}
+		}()
+	}
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+	}
+	// abort the runs so that they clean up and report, the event streams end once they exited
+	slog.Info("⏳ Aborting the runs and waiting for them to exit")
+	s.abortAll()
+	s.waitAll()
+	grpcServer.GracefulStop()
+	if err := httpServer.Shutdown(context.Background()); err != nil {
+		slog.Warn("unable to stop the REST API", "error", err)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// StartRun starts a run of a command that changes record sets in a child process
+func (s *ControlServer) StartRun(_ context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	var req startRunRequest
+	if err := fromStruct(in, &req); err != nil {
+		return nil, err
+	}
+	return toStruct(s.startRun(req))
+}
+
+// startRun starts the process of a run, registering it before it starts so that its first events aren't dropped
+func (s *ControlServer) startRun(req startRunRequest) (controlStatus, error) {
+	cmd, ok := lookupCommand(req.Command)
+	// only the commands with a web dashboard can be paused and aborted
+	if !ok || cmd.run == nil || newFlagSet(cmd, &Options{}, &globalFlags{}).Lookup("web-dashboard") == nil {
+		return controlStatus{}, status.Errorf(codes.InvalidArgument, "%q isn't a command that can be started, e.g. flood, churn, or delete", req.Command)
+	}
+	if err := validateStartRunArgs(cmd, req.Args); err != nil {
+		return controlStatus{}, err
+	}
+	if req.RunID == "" {
+		req.RunID = uuid.NewString()
+	}
+	if !validRunID.MatchString(req.RunID) {
+		return controlStatus{}, status.Errorf(codes.InvalidArgument, "the run ID must be 1 to 64 letters, digits, hyphens, or underscores, got %q", req.RunID)
+	}
+	// pick a free port for the dashboard of the run
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return controlStatus{}, status.Errorf(codes.Internal, "unable to find a port for the run's dashboard: %v", err)
+	}
+	dashboard := l.Addr().String()
+	l.Close()
+	// the flags of the serve command come last so that they take precedence over the same flags in args
+	args := append([]string{req.Command}, req.Args...)
+	args = append(args,
+		"--run-id", req.RunID,
+		"--web-dashboard", dashboard,
+		"--webhook-url", fmt.Sprintf("%s/run/%s", s.eventsURL, req.RunID),
+		"--webhook-format", "json",
+		"--batch-webhook-url", fmt.Sprintf("%s/batch/%s", s.eventsURL, req.RunID),
+	)
+	// the token is passed in the environment rather than the args, which other users of the host can see
+	token := uuid.NewString()
+	process := exec.Command(s.binary, args...)
+	process.Env = append(os.Environ(), webDashboardTokenEnv+"="+token)
+	process.Stdout = os.Stdout
+	process.Stderr = os.Stderr
+	run := &controlledRun{id: req.RunID, command: req.Command, args: req.Args, dashboard: dashboard, token: token, started: time.Now(), process: process, changed: make(chan struct{})}
+	s.mu.Lock()
+	s.pruneLocked(time.Now())
+	if _, ok := s.runs[req.RunID]; ok {
+		s.mu.Unlock()
+		return controlStatus{}, status.Errorf(codes.AlreadyExists, "run %s already exists", req.RunID)
+	}
+	s.runs[req.RunID] = run
+	s.mu.Unlock()
+
+	run.mu.Lock()
+	err = process.Start()
+	run.mu.Unlock()
+	if err != nil {
+		s.mu.Lock()
+		delete(s.runs, req.RunID)
+		s.mu.Unlock()
+		return controlStatus{}, status.Errorf(codes.Internal, "unable to start the run: %v", err)
+	}
+	slog.Info("🚀 Started run", "runId", req.RunID, "command", req.Command, "args", strings.Join(req.Args, " "))
+	go func() {
+		_ = run.process.Wait()
+		exitCode := run.process.ProcessState.ExitCode()
+		slog.Info("Run exited", "runId", req.RunID, "exitCode", exitCode)
+		run.mu.Lock()
+		run.exitCode = &exitCode
+		run.exited = time.Now()
+		run.events = append(run.events, controlEvent{RunID: run.id, Type: "exit", ExitCode: &exitCode})
+		close(run.changed)
+		run.changed = make(chan struct{})
+		run.mu.Unlock()
+	}()
+	return s.status(run), nil
+}
+
+// pruneLocked forgets the runs that exited more than exitedRunRetention ago, and the oldest exited runs over
+// maxExitedRuns. The caller holds s.mu.
+func (s *ControlServer) pruneLocked(now time.Time) {
+	var exited []*controlledRun
+	for id, run := range s.runs {
+		run.mu.Lock()
+		exitedAt := run.exited
+		run.mu.Unlock()
+		switch {
+		case exitedAt.IsZero():
+		case now.Sub(exitedAt) > exitedRunRetention:
+			delete(s.runs, id)
+		default:
+			exited = append(exited, run)
+		}
+	}
+	if len(exited) <= maxExitedRuns {
+		return
+	}
+	sort.Slice(exited, func(i, j int) bool { return exited[i].exited.Before(exited[j].exited) })
+	for _, run := range exited[:len(exited)-maxExitedRuns] {
+		delete(s.runs, run.id)
+	}
+}
+
+// validateStartRunArgs checks that the args of a run only have flags of remoteRunFlags, the same way the command parses
+// them so that e.g. --flag=value and -flag can't get around it
+func validateStartRunArgs(cmd command, args []string) error {
+	fs := newFlagSet(cmd, &Options{}, &globalFlags{})
+	fs.Init(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid args: %v", err)
+	}
+	if fs.NArg() > 0 {
+		return status.Errorf(codes.InvalidArgument, "args can only have flags, got %q", fs.Args())
+	}
+	var rejected []string
+	fs.Visit(func(f *flag.Flag) {
+		if !remoteRunFlags[f.Name] {
+			rejected = append(rejected, "--"+f.Name)
+		}
+	})
+	if len(rejected) > 0 {
+		return status.Errorf(codes.PermissionDenied, "args can't set %s", strings.Join(rejected, ", "))
+	}
+	return nil
+}
+
+// authorized returns whether the authorization header of a call has the bearer token of the server
+func (s *ControlServer) authorized(header string) bool {
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// authenticate returns an Unauthenticated error unless the gRPC call has the bearer token of the server
+func (s *ControlServer) authenticate(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, header := range md.Get("authorization") {
+		if s.authorized(header) {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "the call needs the bearer token of the server in its authorization header")
+}
+
+func (s *ControlServer) authenticateUnary(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := s.authenticate(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *ControlServer) authenticateStream(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.authenticate(stream.Context()); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// GetStatus returns the state of a run
+func (s *ControlServer) GetStatus(_ context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	run, err := s.lookupStruct(in)
+	if err != nil {
+		return nil, err
+	}
+	return toStruct(s.status(run), nil)
+}
+
+// Pause holds the next change batch of a run until it's resumed
+func (s *ControlServer) Pause(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	run, err := s.lookupStruct(in)
+	if err != nil {
+		return nil, err
+	}
+	return toStruct(s.control(ctx, run, "pause"))
+}
+
+// Resume resumes a paused run
+func (s *ControlServer) Resume(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	run, err := s.lookupStruct(in)
+	if err != nil {
+		return nil, err
+	}
+	return toStruct(s.control(ctx, run, "resume"))
+}
+
+// Abort stops a run the way an interrupt does, so that it still cleans up and reports
+func (s *ControlServer) Abort(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	run, err := s.lookupStruct(in)
+	if err != nil {
+		return nil, err
+	}
+	return toStruct(s.abort(ctx, run))
+}
+
+// StreamEvents streams the run and batch events of a run from its start, ending with its exit
+func (s *ControlServer) StreamEvents(in *structpb.Struct, stream grpc.ServerStream) error {
+	run, err := s.lookupStruct(in)
+	if err != nil {
+		return err
+	}
+	return s.follow(stream.Context(), run, func(event controlEvent) error {
+		msg, err := toStruct(event, nil)
+		if err != nil {
+			return err
+		}
+		return stream.SendMsg(msg)
+	})
+}
+
+// abort aborts a run through its web dashboard, or interrupts it if it isn't serving its dashboard yet
+func (s *ControlServer) abort(ctx context.Context, run *controlledRun) (controlStatus, error) {
+	if _, err := s.post(ctx, run, "abort"); err != nil {
+		if err := run.interrupt(); err != nil {
+			return controlStatus{}, status.Errorf(codes.Internal, "unable to interrupt the run: %v", err)
+		}
+	}
+	return s.status(run), nil
+}
+
+// follow sends the events of a run from its start until it exited or ctx is done
+func (s *ControlServer) follow(ctx context.Context, run *controlledRun, send func(controlEvent) error) error {
+	for sent := 0; ; {
+		run.mu.Lock()
+		events := run.events[sent:]
+		exited := run.exitCode != nil
+		changed := run.changed
+		run.mu.Unlock()
+		for _, event := range events {
+			if err := send(event); err != nil {
+				return err
+			}
+			sent++
+		}
+		if exited {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// handleEvent receives the run and batch events a run posts to /run/<run ID> and /batch/<run ID>
+func (s *ControlServer) handleEvent(rw http.ResponseWriter, r *http.Request) {
+	eventType, runID, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	s.mu.Lock()
+	run, ok := s.runs[runID]
+	s.mu.Unlock()
+	if !ok || (eventType != "run" && eventType != "batch") {
+		http.NotFound(rw, r)
+		return
+	}
+	var event json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	run.mu.Lock()
+	run.events = append(run.events, controlEvent{RunID: runID, Type: eventType, Event: event})
+	close(run.changed)
+	run.changed = make(chan struct{})
+	run.mu.Unlock()
+}
+
+// lookupStruct returns the run of a gRPC request
+func (s *ControlServer) lookupStruct(in *structpb.Struct) (*controlledRun, error) {
+	var req runRequest
+	if err := fromStruct(in, &req); err != nil {
+		return nil, err
+	}
+	return s.lookup(req.RunID)
+}
+
+func (s *ControlServer) lookup(runID string) (*controlledRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[runID]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "run %q not found", runID)
+	}
+	return run, nil
+}
+
+// list returns the status of every run, most recently started first
+func (s *ControlServer) list() []controlStatus {
+	s.mu.Lock()
+	runs := make([]*controlledRun, 0, len(s.runs))
+	for _, run := range s.runs {
+		runs = append(runs, run)
+	}
+	s.mu.Unlock()
+	sort.Slice(runs, func(i, j int) bool { return runs[i].started.After(runs[j].started) })
+	statuses := []controlStatus{}
+	for _, run := range runs {
+		statuses = append(statuses, s.status(run))
+	}
+	return statuses
+}
+
+// control pauses or resumes a run through its web dashboard
+func (s *ControlServer) control(ctx context.Context, run *controlledRun, action string) (controlStatus, error) {
+	run.mu.Lock()
+	exited := run.exitCode != nil
+	run.mu.Unlock()
+	if exited {
+		return controlStatus{}, status.Errorf(codes.FailedPrecondition, "run %s already exited", run.id)
+	}
+	if _, err := s.post(ctx, run, action); err != nil {
+		return controlStatus{}, status.Errorf(codes.Unavailable, "unable to %s the run, it may not be serving its dashboard yet: %v", action, err)
+	}
+	return s.status(run), nil
+}
+
+// post calls a control endpoint of the web dashboard of a run
+func (s *ControlServer) post(ctx context.Context, run *controlledRun, action string) (*webStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s/%s", run.dashboard, action), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(webTokenHeader, run.token)
+	return s.do(req)
+}
+
+func (s *ControlServer) do(req *http.Request) (*webStatus, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the run's dashboard returned %s", resp.Status)
+	}
+	var live webStatus
+	if err := json.NewDecoder(resp.Body).Decode(&live); err != nil {
+		return nil, fmt.Errorf("unable to parse the run's status: %w", err)
+	}
+	return &live, nil
+}
+
+// status returns the state of a run, with its live status if it's serving its dashboard
+func (s *ControlServer) status(run *controlledRun) controlStatus {
+	run.mu.Lock()
+	result := controlStatus{RunID: run.id, Command: run.command, Args: run.args, State: "starting", ExitCode: run.exitCode}
+	run.mu.Unlock()
+	if result.ExitCode != nil {
+		result.State = "exited"
+		return result
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s/status", run.dashboard), nil)
+	if err != nil {
+		return result
+	}
+	if live, err := s.do(req); err == nil {
+		result.State = live.State
+		result.Run = live
+	}
+	return result
+}
+
+// abortAll interrupts every run that's still running
+func (s *ControlServer) abortAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, run := range s.runs {
+		_ = run.interrupt()
+	}
+}
+
+// waitAll waits until every run exited
+func (s *ControlServer) waitAll() {
+	s.mu.Lock()
+	runs := make([]*controlledRun, 0, len(s.runs))
+	for _, run := range s.runs {
+		runs = append(runs, run)
+	}
+	s.mu.Unlock()
+	for _, run := range runs {
+		_ = s.follow(context.Background(), run, func(controlEvent) error { return nil })
+	}
+}
+
+// interrupt interrupts the process of the run if it's still running
+func (r *controlledRun) interrupt() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.exitCode != nil || r.process.Process == nil {
+		return nil
+	}
+	if err := r.process.Process.Signal(os.Interrupt); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	return nil
+}
+
+// toStruct converts the result of a call to the JSON object the gRPC API sends it as
+func toStruct(v any, err error) (*structpb.Struct, error) {
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unable to marshal response: %v", err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, status.Errorf(codes.Internal, "unable to marshal response: %v", err)
+	}
+	return structpb.NewStruct(m)
+}
+
+// fromStruct converts the JSON object of a gRPC request to v
+func fromStruct(in *structpb.Struct, v any) error {
+	data, err := json.Marshal(in.AsMap())
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "unable to parse request: %v", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return status.Errorf(codes.InvalidArgument, "unable to parse request: %v", err)
+	}
+	return nil
+}
+
+// unaryHandler adapts a method of the ControlServer to a gRPC method handler
+func unaryHandler(method string, handle func(*ControlServer, context.Context, *structpb.Struct) (*structpb.Struct, error)) func(any, context.Context, func(any) error, grpc.UnaryServerInterceptor) (any, error) {
+	return func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		in := new(structpb.Struct)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		s := srv.(*ControlServer)
+		if interceptor == nil {
+			return handle(s, ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fmt.Sprintf("/%s/%s", grpcServiceName, method)}
+		return interceptor(ctx, in, info, func(ctx context.Context, req any) (any, error) {
+			return handle(s, ctx, req.(*structpb.Struct))
+		})
+	}
+}
+
+// controlServiceDesc describes the gRPC service of proto/floodzone/v1/floodzone.proto. Its messages are
+// google.protobuf.Struct JSON objects, so the service is written out here instead of generated.
+var controlServiceDesc = grpc.ServiceDesc{
+	ServiceName: grpcServiceName,
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "StartRun", Handler: unaryHandler("StartRun", (*ControlServer).StartRun)},
+		{MethodName: "GetStatus", Handler: unaryHandler("GetStatus", (*ControlServer).GetStatus)},
+		{MethodName: "Pause", Handler: unaryHandler("Pause", (*ControlServer).Pause)},
+		{MethodName: "Resume", Handler: unaryHandler("Resume", (*ControlServer).Resume)},
+		{MethodName: "Abort", Handler: unaryHandler("Abort", (*ControlServer).Abort)},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "StreamEvents",
+			Handler: func(srv any, stream grpc.ServerStream) error {
+				in := new(structpb.Struct)
+				if err := stream.RecvMsg(in); err != nil {
+					return err
+				}
+				return srv.(*ControlServer).StreamEvents(in, stream)
+			},
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proto/floodzone/v1/floodzone.proto",
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/aws/smithy-go"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxSetIdentifiers is the most record sets with a routing policy Route 53 allows under a name and type
+	maxSetIdentifiers = 100
+	// defaultSetIdentifierRate is how many record sets are created per second by default, the Route 53 API rate limit of
+	// an account
+	defaultSetIdentifierRate = 5
+	// setIdentifierTTL is the TTL of the record sets of the set-identifiers command
+	setIdentifierTTL = 60
+	// setIdentifierDeletesPerBatch is how many record sets are deleted in one change batch once the limit was probed
+	setIdentifierDeletesPerBatch = 100
+)
+
+// routingPolicies are the routing policies of the record sets the set-identifiers command can create
+var routingPolicies = []string{"weighted", "latency", "multivalue"}
+
+// setIdentifiersResult is the output of the set-identifiers command
+type setIdentifiersResult struct {
+	Name          string `json:"name" yaml:"name"`
+	RoutingPolicy string `json:"routingPolicy" yaml:"routingPolicy"`
+	Attempted     int    `json:"attempted" yaml:"attempted"`
+	Created       int    `json:"created" yaml:"created"`
+	Failed        int    `json:"failed" yaml:"failed"`
+	// FirstFailure is the number of the first set identifier Route 53 rejected, 0 if it accepted them all, and FirstError
+	// why it rejected it
+	FirstFailure int           `json:"firstFailure,omitempty" yaml:"firstFailure,omitempty"`
+	FirstError   string        `json:"firstError,omitempty" yaml:"firstError,omitempty"`
+	Deleted      int           `json:"deleted" yaml:"deleted"`
+	Duration     time.Duration `json:"duration" yaml:"duration"`
+}
+
+func (r setIdentifiersResult) writeTable(w io.Writer) {
+	fmt.Fprintln(w, "NAME\tROUTING POLICY\tATTEMPTED\tCREATED\tFAILED\tFIRST FAILURE\tDELETED\tDURATION")
+	fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%s\n", r.Name, r.RoutingPolicy, r.Attempted, r.Created, r.Failed, r.FirstFailure, r.Deleted, r.Duration.Round(time.Millisecond))
+	if r.FirstError != "" {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "FIRST ERROR")
+		fmt.Fprintln(w, r.FirstError)
+	}
+}
+
+// runSetIdentifiers creates --set-identifiers A record sets of the --routing-policy under a single name of the zone, one
+// per change batch at --create-rate batches per second, to find where Route 53 starts rejecting them. The record sets
+// are deleted once every set identifier was tried unless --keep-record-sets is set.
+func runSetIdentifiers(ctx context.Context, zone Zone, opts Options) error {
+	start := time.Now()
+	out, err := zone.R53.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: &opts.HostedZoneID})
+	if err != nil {
+		return fmt.Errorf("unable to get hosted zone %s: %w", opts.HostedZoneID, err)
+	}
+	hostedZone := out.HostedZone
+	result := setIdentifiersResult{
+		Name:          fmt.Sprintf("sets-%s.%s", strings.Split(uuid.NewString(), "-")[0], aws.ToString(hostedZone.Name)),
+		RoutingPolicy: opts.RoutingPolicy,
+	}
+	if opts.SetIdentifiers > maxSetIdentifiers {
+		slog.Info("🎯 Trying more set identifiers than Route 53 allows under a name and type", "setIdentifiers", opts.SetIdentifiers, "limit", maxSetIdentifiers)
+	}
+	slog.Info("🔀 Creating record sets under a single name", "name", result.Name, "routingPolicy", opts.RoutingPolicy, "setIdentifiers", opts.SetIdentifiers, "rate", opts.CreateRate)
+	regions := types.ResourceRecordSetRegion("").Values()
+	var created []types.ResourceRecordSet
+	for i := 0; i < opts.SetIdentifiers; i++ {
+		if i > 0 {
+			if err := sleep(ctx, time.Duration(float64(time.Second)/opts.CreateRate)); err != nil {
+				return err
+			}
+		}
+		rr := types.ResourceRecordSet{
+			Name:            aws.String(result.Name),
+			Type:            types.RRTypeA,
+			SetIdentifier:   aws.String(fmt.Sprintf("set-%d", i+1)),
+			TTL:             aws.Int64(setIdentifierTTL),
+			ResourceRecords: []types.ResourceRecord{{Value: aws.String(sequentialIPv4(i))}},
+		}
+		switch opts.RoutingPolicy {
+		case "weighted":
+			rr.Weight = aws.Int64(1)
+		case "latency":
+			rr.Region = regions[i%len(regions)]
+		case "multivalue":
+			rr.MultiValueAnswer = aws.Bool(true)
+		}
+		result.Attempted++
+		_, err := zone.submitChangeBatch(ctx, hostedZone, []types.Change{{Action: types.ChangeActionCreate, ResourceRecordSet: &rr}})
+		var apiErr smithy.APIError
+		switch {
+		case err == nil:
+			created = append(created, rr)
+			result.Created++
+			continue
+		case !errors.As(err, &apiErr) || apiErr.ErrorCode() != "InvalidChangeBatch":
+			slog.Error("the run failed before every set identifier was tried", "created", result.Created)
+			result.Deleted = zone.deleteSetIdentifiers(ctx, hostedZone, created, opts)
+			return fmt.Errorf("unable to create record set %s of %s: %w", aws.ToString(rr.SetIdentifier), result.Name, err)
+		}
+		result.Failed++
+		if result.FirstFailure == 0 {
+			result.FirstFailure, result.FirstError = i+1, apiErr.ErrorMessage()
+			slog.Warn("🚧 Route 53 rejected the first record set", "setIdentifier", aws.ToString(rr.SetIdentifier), "created", result.Created, "error", apiErr.ErrorMessage())
+		}
+	}
+	slog.Info("✅ Tried every set identifier", "name", result.Name, "created", result.Created, "failed", result.Failed, "firstFailure", result.FirstFailure)
+	result.Deleted = zone.deleteSetIdentifiers(ctx, hostedZone, created, opts)
+	result.Duration = time.Since(start)
+	return printOutput(opts.Output, result)
+}
+
+// deleteSetIdentifiers deletes the record sets the run created unless --keep-record-sets is set, and returns how many
+// it deleted
+func (z Zone) deleteSetIdentifiers(ctx context.Context, hostedZone *types.HostedZone, recordSets []types.ResourceRecordSet, opts Options) int {
+	if opts.KeepRecordSets || len(recordSets) == 0 {
+		return 0
+	}
+	deleted := 0
+	for _, batch := range chunks(recordSets, setIdentifierDeletesPerBatch) {
+		changes := make([]types.Change, len(batch))
+		for i := range batch {
+			changes[i] = types.Change{Action: types.ChangeActionDelete, ResourceRecordSet: &batch[i]}
+		}
+		if _, err := z.submitChangeBatch(ctx, hostedZone, changes); err != nil {
+			slog.Error("unable to delete the record sets of the set identifiers, clean up the zone to delete them", "name", aws.ToString(batch[0].Name), "error", err)
+			return deleted
+		}
+		deleted += len(batch)
+	}
+	slog.Info("✅ Successfully deleted the record sets of the set identifiers", "recordSets", deleted)
+	return deleted
+}
+
+// validateSetIdentifiers validates the flags of the set-identifiers command
+func validateSetIdentifiers(opts Options) error {
+	var errs []error
+	if err := requireZoneID(opts); err != nil {
+		errs = append(errs, err)
+	}
+	if !slices.Contains(routingPolicies, opts.RoutingPolicy) {
+		errs = append(errs, fmt.Errorf("--routing-policy must be one of %s, got %q", strings.Join(routingPolicies, ", "), opts.RoutingPolicy))
+	}
+	if opts.SetIdentifiers <= 0 {
+		errs = append(errs, errors.New("--set-identifiers must be greater than 0"))
+	}
+	if opts.CreateRate <= 0 {
+		errs = append(errs, errors.New("--create-rate must be greater than 0"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+const (
+	// instanceWorkerPollInterval is how often the commands running the workers are checked on
+	instanceWorkerPollInterval = 5 * time.Second
+	// instanceWorkerDeliveryTimeout is how long SSM tries to deliver the command to an instance that isn't reachable
+	instanceWorkerDeliveryTimeout = 10 * time.Minute
+	// instanceWorkerSetupTimeout is how long an instance has to download floodzone on top of the queries
+	instanceWorkerSetupTimeout = 5 * time.Minute
+	// runShellScriptDocument is the SSM document that runs a shell script on Linux instances
+	runShellScriptDocument = "AWS-RunShellScript"
+)
+
+// InstanceQueryWorkers runs the queries of the query command on EC2 instances with SSM Run Command, so that the
+// queries of a private hosted zone come from inside the VPCs associated with it. The floodzone binary and the worker
+// request are uploaded to S3 for the instances to download with presigned URLs, and the instances upload their
+// responses the same way, so the instances only need the SSM agent, curl, and a route to S3.
+type InstanceQueryWorkers struct {
+	ssm         *ssm.Client
+	ec2         *ec2.Client
+	s3          *s3.Client
+	instanceIDs []string
+	tags        []string
+	binary      string
+	bucket      string
+	prefix      string
+}
+
+// NewInstanceQueryWorkers returns the query workers of the instances, or of the running instances with the Key=Value
+// tags, that run the binary, which defaults to the running floodzone binary. The files the workers exchange are
+// written under the s3://bucket/prefix URI, in a folder of the run.
+func NewInstanceQueryWorkers(ssmClient *ssm.Client, ec2Client *ec2.Client, s3Client *s3.Client, instanceIDs []string, tags []string, binary string, uri string, runID string) *InstanceQueryWorkers {
+	bucket, prefix, _ := parseS3URI(uri)
+	return &InstanceQueryWorkers{
+		ssm:         ssmClient,
+		ec2:         ec2Client,
+		s3:          s3Client,
+		instanceIDs: instanceIDs,
+		tags:        tags,
+		binary:      binary,
+		bucket:      bucket,
+		prefix:      path.Join(prefix, "floodzone-query-"+runID),
+	}
+}
+
+// Run has each instance send an even share of the queries of the flags to the targets, and returns the results of
+// every instance
+func (w *InstanceQueryWorkers) Run(ctx context.Context, targets []queryTarget, opts Options, budget *CostBudget) (fanOutResult, error) {
+	contents, architecture, err := readWorkerBinary(w.binary)
+	if err != nil {
+		return fanOutResult{}, err
+	}
+	instances, err := w.instances(ctx, architecture)
+	if err != nil {
+		return fanOutResult{}, err
+	}
+	workers := len(instances)
+	request := newQueryWorkerRequest(targets, opts, max(1, opts.QPS/workers), max(1, (opts.Concurrency+workers-1)/workers))
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return fanOutResult{}, fmt.Errorf("unable to encode query worker request: %w", err)
+	}
+
+	// the files are deleted once the run is done, including the responses of the workers
+	keys := []string{path.Join(w.prefix, "floodzone"), path.Join(w.prefix, "request.json")}
+	for _, instanceID := range instances {
+		keys = append(keys, path.Join(w.prefix, instanceID+".json"))
+	}
+	defer func() {
+		for _, key := range keys {
+			if _, err := w.s3.DeleteObject(context.WithoutCancel(ctx), &s3.DeleteObjectInput{Bucket: &w.bucket, Key: aws.String(key)}); err != nil {
+				slog.Error("unable to clean up query worker file, it must be deleted manually", "bucket", w.bucket, "key", key, "error", err)
+			}
+		}
+	}()
+	slog.Info("📤 Uploading floodzone for the query workers", "bucket", w.bucket, "prefix", w.prefix, "instances", workers)
+	for i, body := range [][]byte{contents, payload} {
+		if _, err := w.s3.PutObject(ctx, &s3.PutObjectInput{Bucket: &w.bucket, Key: &keys[i], Body: bytes.NewReader(body)}); err != nil {
+			return fanOutResult{}, fmt.Errorf("unable to upload s3://%s/%s: %w", w.bucket, keys[i], err)
+		}
+	}
+
+	// the instances get the same amount of time to run the queries as the run, with time to download floodzone and for
+	// the queries in flight, and the URLs last as long as the command can run
+	timeout := opts.QueryDuration + time.Duration(opts.QueryAttempts)*opts.QueryTimeout + instanceWorkerSetupTimeout
+	presign := s3.NewPresignClient(w.s3, s3.WithPresignExpires(instanceWorkerDeliveryTimeout+timeout))
+	var urls []string
+	for _, key := range keys[:2] {
+		req, err := presign.PresignGetObject(ctx, &s3.GetObjectInput{Bucket: &w.bucket, Key: aws.String(key)})
+		if err != nil {
+			return fanOutResult{}, fmt.Errorf("unable to presign s3://%s/%s: %w", w.bucket, key, err)
+		}
+		urls = append(urls, req.URL)
+	}
+
+	slog.Info("🔎 Starting DNS query flood from the instances", "instances", workers, "recordSets", len(targets), "qps", opts.QPS, "duration", opts.QueryDuration)
+	responses := map[string][]queryWorkerResponse{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var errs []error
+	for i, instanceID := range instances {
+		wg.Add(1)
+		go func(instanceID string, responseKey string) {
+			defer wg.Done()
+			response, err := w.runWorker(ctx, presign, instanceID, urls[0], urls[1], responseKey, timeout)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			budget.AddQueries(response.Result.Queries + response.Result.Retries)
+			responses[instanceID] = append(responses[instanceID], response)
+		}(instanceID, keys[2+i])
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return fanOutResult{}, err
+	}
+	return newFanOutResult("instance", instances, responses, len(targets)), nil
+}
+
+// instances returns the IDs of the instances to run the workers on, which must be running on the architecture of the
+// binary
+func (w *InstanceQueryWorkers) instances(ctx context.Context, architecture string) ([]string, error) {
+	input := &ec2.DescribeInstancesInput{InstanceIds: w.instanceIDs}
+	for _, tag := range w.tags {
+		key, value, _ := strings.Cut(tag, "=")
+		input.Filters = append(input.Filters, ec2types.Filter{Name: aws.String("tag:" + key), Values: []string{value}})
+	}
+	var instances []string
+	var errs []error
+	for {
+		out, err := w.ec2.DescribeInstances(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("unable to describe the query worker instances: %w", err)
+		}
+		for _, reservation := range out.Reservations {
+			for _, instance := range reservation.Instances {
+				id := aws.ToString(instance.InstanceId)
+				switch {
+				case instance.State == nil || instance.State.Name != ec2types.InstanceStateNameRunning:
+					// only the instances listed explicitly have to be running, tags can match stopped instances too
+					if len(w.instanceIDs) > 0 {
+						errs = append(errs, fmt.Errorf("instance %s isn't running", id))
+					}
+				case string(instance.Architecture) != architecture:
+					errs = append(errs, fmt.Errorf("instance %s is %s, but the worker binary is built for %s", id, instance.Architecture, architecture))
+				default:
+					instances = append(instances, id)
+				}
+			}
+		}
+		if out.NextToken == nil {
+			break
+		}
+		input.NextToken = out.NextToken
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("no running instances are tagged %s", strings.Join(w.tags, ","))
+	}
+	return instances, nil
+}
+
+// runWorker runs a worker on the instance with Run Command and returns the response it uploaded
+func (w *InstanceQueryWorkers) runWorker(ctx context.Context, presign *s3.PresignClient, instanceID string, binaryURL string, requestURL string, responseKey string, timeout time.Duration) (queryWorkerResponse, error) {
+	upload, err := presign.PresignPutObject(ctx, &s3.PutObjectInput{Bucket: &w.bucket, Key: &responseKey})
+	if err != nil {
+		return queryWorkerResponse{}, fmt.Errorf("unable to presign s3://%s/%s: %w", w.bucket, responseKey, err)
+	}
+	out, err := w.ssm.SendCommand(ctx, &ssm.SendCommandInput{
+		DocumentName:   aws.String(runShellScriptDocument),
+		InstanceIds:    []string{instanceID},
+		Comment:        aws.String("floodzone query worker"),
+		TimeoutSeconds: aws.Int32(int32(instanceWorkerDeliveryTimeout.Seconds())),
+		Parameters: map[string][]string{
+			"commands":         instanceWorkerScript(binaryURL, requestURL, upload.URL),
+			"executionTimeout": {strconv.Itoa(int(timeout.Seconds()))},
+		},
+	})
+	if err != nil {
+		return queryWorkerResponse{}, fmt.Errorf("unable to run the query worker on %s: %w", instanceID, err)
+	}
+	commandID := aws.ToString(out.Command.CommandId)
+	slog.Debug("Sent query worker command", "instance", instanceID, "command", commandID)
+	for {
+		select {
+		case <-ctx.Done():
+			// the worker would otherwise keep querying after the run was stopped, e.g. by its budget
+			if _, err := w.ssm.CancelCommand(context.WithoutCancel(ctx), &ssm.CancelCommandInput{CommandId: &commandID, InstanceIds: []string{instanceID}}); err != nil {
+				slog.Warn("unable to stop the query worker", "instance", instanceID, "command", commandID, "error", err)
+			}
+			return queryWorkerResponse{}, ctx.Err()
+		case <-time.After(instanceWorkerPollInterval):
+		}
+		invocation, err := w.ssm.GetCommandInvocation(ctx, &ssm.GetCommandInvocationInput{CommandId: &commandID, InstanceId: &instanceID})
+		// the invocation isn't there until SSM has dispatched the command
+		var notYet *ssmtypes.InvocationDoesNotExist
+		if errors.As(err, &notYet) {
+			continue
+		}
+		if err != nil {
+			return queryWorkerResponse{}, fmt.Errorf("unable to get the query worker command on %s: %w", instanceID, err)
+		}
+		switch invocation.Status {
+		case ssmtypes.CommandInvocationStatusSuccess:
+			return w.response(ctx, instanceID, responseKey)
+		case ssmtypes.CommandInvocationStatusFailed, ssmtypes.CommandInvocationStatusTimedOut, ssmtypes.CommandInvocationStatusCancelled:
+			return queryWorkerResponse{}, fmt.Errorf("query worker on %s %s: %s", instanceID, strings.ToLower(string(invocation.Status)),
+				strings.TrimSpace(aws.ToString(invocation.StandardErrorContent)))
+		}
+	}
+}
+
+// response reads the response a worker uploaded
+func (w *InstanceQueryWorkers) response(ctx context.Context, instanceID string, key string) (queryWorkerResponse, error) {
+	out, err := w.s3.GetObject(ctx, &s3.GetObjectInput{Bucket: &w.bucket, Key: &key})
+	if err != nil {
+		return queryWorkerResponse{}, fmt.Errorf("unable to download the answer of the query worker on %s: %w", instanceID, err)
+	}
+	defer out.Body.Close()
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return queryWorkerResponse{}, fmt.Errorf("unable to download the answer of the query worker on %s: %w", instanceID, err)
+	}
+	var response queryWorkerResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return queryWorkerResponse{}, fmt.Errorf("unable to parse the answer of the query worker on %s: %w", instanceID, err)
+	}
+	return response, nil
+}
+
+// instanceWorkerScript returns the lines of the shell script that downloads floodzone and the request, runs the
+// worker, and uploads its response
+func instanceWorkerScript(binaryURL string, requestURL string, responseURL string) []string {
+	return []string{
+		"set -eu",
+		`dir=$(mktemp -d)`,
+		`trap 'rm -rf "$dir"' EXIT`,
+		fmt.Sprintf(`curl -fsS -o "$dir/floodzone" '%s'`, binaryURL),
+		`chmod +x "$dir/floodzone"`,
+		fmt.Sprintf(`curl -fsS -o "$dir/request.json" '%s'`, requestURL),
+		`"$dir/floodzone" query-worker "$dir/request.json" > "$dir/response.json"`,
+		fmt.Sprintf(`curl -fsS -X PUT -T "$dir/response.json" '%s'`, responseURL),
+	}
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// RunStats accumulates the outcome of every change batch in a run. A nil RunStats is a no-op.
+type RunStats struct {
+	mu           sync.Mutex
+	runID        string
+	start        time.Time
+	zones        []string
+	created      int
+	deleted      int
+	upserted     int
+	batches      int
+	errors       int
+	errorsByCode map[string]int
+	timeline     []batchOutcome
+	// errorClasses counts the errors of every API call attempt, including the ones the SDK retried
+	errorClasses map[string]errorClassStats
+	// failedRequests are the most recent failed API call attempts
+	failedRequests []failedRequest
+	// propagations are how long change batches took to be INSYNC when propagation is measured
+	propagations []time.Duration
+	// resolvables are how long sampled record sets took to resolve to their new value when it's measured
+	resolvables []time.Duration
+	// resolution is how many of the created record sets resolved when they're verified
+	resolution *resolutionStats
+	// stale is how many of the upserted record sets are listed with their last written value when it's verified
+	stale *staleStats
+	// assertions are the results of the run's assertions once they're checked
+	assertions []assertionResult
+}
+
+// errorClassStats counts a class of API errors and when they were first and last seen
+type errorClassStats struct {
+	Count     int       `json:"count" yaml:"count"`
+	FirstSeen time.Time `json:"firstSeen" yaml:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen" yaml:"lastSeen"`
+}
+
+// maxFailedRequests is how many of the most recent failed API call attempts are kept for the summary
+const maxFailedRequests = 100
+
+// failedRequest is a failed API call attempt with the request ID AWS Support needs to look into it
+type failedRequest struct {
+	Time      time.Time `json:"time" yaml:"time"`
+	Operation string    `json:"operation" yaml:"operation"`
+	RequestID string    `json:"requestId" yaml:"requestId"`
+	ErrorCode string    `json:"errorCode" yaml:"errorCode"`
+}
+
+// Error classes to tell rate limiting apart from problems with the changes or with Route 53 itself
+const (
+	errorClassThrottling    = "Throttling"
+	errorClassPriorRequest  = "PriorRequestNotComplete"
+	errorClassInvalidChange = "InvalidChangeBatch"
+	errorClassServerError   = "ServerError"
+	errorClassOther         = "Other"
+)
+
+// batchOutcome is the outcome of a single change batch
+type batchOutcome struct {
+	// at is when the batch was submitted relative to the start of the run
+	at      time.Duration
+	changes int
+	latency time.Duration
+	// errorCode is the API error code of a failed batch, empty if it succeeded
+	errorCode string
+}
+
+func NewRunStats(runID string) *RunStats {
+	return &RunStats{runID: runID, start: time.Now(), errorsByCode: map[string]int{}, errorClasses: map[string]errorClassStats{}}
+}
+
+// RecordZone records a hosted zone the run operated on
+func (s *RunStats) RecordZone(hostedZoneID string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hostedZoneID = strings.TrimPrefix(hostedZoneID, "/hostedzone/")
+	for _, zone := range s.zones {
+		if zone == hostedZoneID {
+			return
+		}
+	}
+	s.zones = append(s.zones, hostedZoneID)
+}
+
+// RecordBatch records a successfully submitted change batch and how long the API call took
+func (s *RunStats) RecordBatch(changes []types.Change, latency time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches++
+	s.timeline = append(s.timeline, batchOutcome{at: s.sinceStart(latency), changes: len(changes), latency: latency})
+	for _, change := range changes {
+		switch change.Action {
+		case types.ChangeActionCreate:
+			s.created++
+		case types.ChangeActionDelete:
+			s.deleted++
+		case types.ChangeActionUpsert:
+			s.upserted++
+		}
+	}
+}
+
+// Submitted returns the number of change batches submitted so far, successful or not
+func (s *RunStats) Submitted() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.batches + s.errors
+}
+
+// RecordError records a failed change batch by its API error code
+func (s *RunStats) RecordError(err error, latency time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors++
+	code := "Unknown"
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		code = apiErr.ErrorCode()
+	}
+	s.errorsByCode[code]++
+	s.timeline = append(s.timeline, batchOutcome{at: s.sinceStart(latency), latency: latency, errorCode: code})
+}
+
+// sinceStart returns when a batch that just finished after latency was submitted, relative to the start of the run
+func (s *RunStats) sinceStart(latency time.Duration) time.Duration {
+	return time.Since(s.start) - latency
+}
+
+// Timeline returns the outcome of every change batch so far in the order they finished
+func (s *RunStats) Timeline() []batchOutcome {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]batchOutcome{}, s.timeline...)
+}
+
+// RecordPropagation records how long a change batch took to be INSYNC
+func (s *RunStats) RecordPropagation(propagation time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.propagations = append(s.propagations, propagation)
+}
+
+// RecordResolvable records how long a record set took to resolve to its new value
+func (s *RunStats) RecordResolvable(resolvable time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resolvables = append(s.resolvables, resolvable)
+}
+
+// RecordResolution records how many of the created record sets resolved, adding to the ones verified before
+func (s *RunStats) RecordResolution(stats resolutionStats) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resolution != nil {
+		stats.Checked += s.resolution.Checked
+		stats.Resolved += s.resolution.Resolved
+		stats.Mismatched += s.resolution.Mismatched
+		stats.Unresolved += s.resolution.Unresolved
+		stats.Mismatches = append(s.resolution.Mismatches, stats.Mismatches...)
+		if len(stats.Mismatches) > maxResolutionMismatches {
+			stats.Mismatches = stats.Mismatches[:maxResolutionMismatches]
+		}
+	}
+	s.resolution = &stats
+}
+
+// RecordStale records how many of the upserted record sets have their last written value, adding to the zones verified
+// before
+func (s *RunStats) RecordStale(stats staleStats) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stale != nil {
+		stats.Checked += s.stale.Checked
+		stats.Current += s.stale.Current
+		stats.Stale += s.stale.Stale
+		stats.Missing += s.stale.Missing
+		stats.Records = append(s.stale.Records, stats.Records...)
+		if len(stats.Records) > maxResolutionMismatches {
+			stats.Records = stats.Records[:maxResolutionMismatches]
+		}
+	}
+	s.stale = &stats
+}
+
+// classifyError returns the class of an API error
+func classifyError(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch code := apiErr.ErrorCode(); {
+		case code == "PriorRequestNotComplete":
+			return errorClassPriorRequest
+		case throttlingErrorCodes[code]:
+			return errorClassThrottling
+		case code == "InvalidChangeBatch":
+			return errorClassInvalidChange
+		}
+	}
+	var respErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &respErr) && respErr.HTTPStatusCode() >= 500 {
+		return errorClassServerError
+	}
+	return errorClassOther
+}
+
+// throttleCounter counts the throttled attempts of the calls its middleware is added to, which the SDK retried
+type throttleCounter struct {
+	count atomic.Int64
+}
+
+// Count returns how many attempts were throttled
+func (t *throttleCounter) Count() int {
+	return int(t.count.Load())
+}
+
+func (t *throttleCounter) middleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("FloodzoneThrottles", func(ctx context.Context, in middleware.InitializeInput,
+		next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		out, metadata, err := next.HandleInitialize(ctx, in)
+		if results, ok := retry.GetAttemptResults(metadata); ok {
+			for _, result := range results.Results {
+				if result.Err != nil && classifyError(result.Err) == errorClassThrottling {
+					t.count.Add(1)
+				}
+			}
+		}
+		return out, metadata, err
+	}), middleware.After)
+}
+
+// RecordAttemptError records the error of a single API call attempt by its class, along with its request ID
+func (s *RunStats) RecordAttemptError(operation string, requestID string, err error, at time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failed := failedRequest{Time: at, Operation: operation, RequestID: requestID, ErrorCode: "Unknown"}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		failed.ErrorCode = apiErr.ErrorCode()
+	}
+	s.failedRequests = append(s.failedRequests, failed)
+	if len(s.failedRequests) > maxFailedRequests {
+		s.failedRequests = s.failedRequests[1:]
+	}
+	class := classifyError(err)
+	stats := s.errorClasses[class]
+	if stats.Count == 0 {
+		stats.FirstSeen = at
+	}
+	stats.Count++
+	stats.LastSeen = at
+	s.errorClasses[class] = stats
+}
+
+// route53Option adds a middleware to the Route 53 client that records the error of every attempt of every call
+func (s *RunStats) route53Option(o *route53.Options) {
+	if s == nil {
+		return
+	}
+	o.APIOptions = append(o.APIOptions, s.attemptErrorsMiddleware)
+}
+
+func (s *RunStats) attemptErrorsMiddleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("FloodzoneAttemptErrors", func(ctx context.Context, in middleware.InitializeInput,
+		next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		out, metadata, err := next.HandleInitialize(ctx, in)
+		operation := awsmiddleware.GetOperationName(ctx)
+		results, ok := retry.GetAttemptResults(metadata)
+		if !ok {
+			// the call failed before any attempt was made, e.g. while resolving credentials
+			if err != nil {
+				s.RecordAttemptError(operation, "", err, time.Now())
+			}
+			return out, metadata, err
+		}
+		for _, result := range results.Results {
+			if result.Err == nil {
+				continue
+			}
+			at, ok := awsmiddleware.GetResponseAt(result.ResponseMetadata)
+			if !ok {
+				at = time.Now()
+			}
+			requestID, _ := awsmiddleware.GetRequestIDMetadata(result.ResponseMetadata)
+			s.RecordAttemptError(operation, requestID, result.Err, at)
+		}
+		return out, metadata, err
+	}), middleware.After)
+}
+
+// Summary returns the outcome of the command's run so far
+func (s *RunStats) Summary(command string) runSummary {
+	if s == nil {
+		return runSummary{Command: command}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	errorsByCode := map[string]int{}
+	for code, count := range s.errorsByCode {
+		errorsByCode[code] = count
+	}
+	errorClasses := map[string]errorClassStats{}
+	for class, stats := range s.errorClasses {
+		errorClasses[class] = stats
+	}
+	var propagation *latencyStats
+	if len(s.propagations) > 0 {
+		stats := newLatencyStats(s.propagations)
+		propagation = &stats
+	}
+	var resolvable *latencyStats
+	if len(s.resolvables) > 0 {
+		stats := newLatencyStats(s.resolvables)
+		resolvable = &stats
+	}
+	var resolution *resolutionStats
+	if s.resolution != nil {
+		stats := *s.resolution
+		resolution = &stats
+	}
+	var stale *staleStats
+	if s.stale != nil {
+		stats := *s.stale
+		stale = &stats
+	}
+	return runSummary{
+		Command:         command,
+		RunID:           s.runID,
+		Zones:           append([]string{}, s.zones...),
+		StartTime:       s.start,
+		EndTime:         now,
+		Created:         s.created,
+		Deleted:         s.deleted,
+		Upserted:        s.upserted,
+		Batches:         s.batches,
+		Errors:          s.errors,
+		ErrorsByCode:    errorsByCode,
+		ErrorClasses:    errorClasses,
+		FailedRequests:  append([]failedRequest{}, s.failedRequests...),
+		DurationSeconds: now.Sub(s.start).Seconds(),
+		Latency:         newLatencyStats(latencies(s.timeline)),
+		Propagation:     propagation,
+		Resolvable:      resolvable,
+		Resolution:      resolution,
+		Stale:           stale,
+		Assertions:      append([]assertionResult{}, s.assertions...),
+	}
+}
+
+// latencyStats summarizes the latency of the ChangeResourceRecordSets calls in milliseconds
+type latencyStats struct {
+	Min  float64 `json:"minMs" yaml:"minMs"`
+	Mean float64 `json:"meanMs" yaml:"meanMs"`
+	P50  float64 `json:"p50Ms" yaml:"p50Ms"`
+	P90  float64 `json:"p90Ms" yaml:"p90Ms"`
+	P99  float64 `json:"p99Ms" yaml:"p99Ms"`
+	Max  float64 `json:"maxMs" yaml:"maxMs"`
+}
+
+func latencies(timeline []batchOutcome) []time.Duration {
+	latencies := make([]time.Duration, 0, len(timeline))
+	for _, batch := range timeline {
+		latencies = append(latencies, batch.latency)
+	}
+	return latencies
+}
+
+func newLatencyStats(latencies []time.Duration) latencyStats {
+	if len(latencies) == 0 {
+		return latencyStats{}
+	}
+	sorted := append([]time.Duration{}, latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, l := range sorted {
+		total += l
+	}
+	return latencyStats{
+		Min:  milliseconds(sorted[0]),
+		Mean: milliseconds(total / time.Duration(len(sorted))),
+		P50:  percentile(sorted, 0.50),
+		P90:  percentile(sorted, 0.90),
+		P99:  percentile(sorted, 0.99),
+		Max:  milliseconds(sorted[len(sorted)-1]),
+	}
+}
+
+// percentile returns the nearest-rank percentile p of the sorted durations in milliseconds
+func percentile(sorted []time.Duration, p float64) float64 {
+	rank := int(p*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return milliseconds(sorted[rank])
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
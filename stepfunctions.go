@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// stepFunctionsPhases are the commands a state machine can run as phases. Their steps are idempotent, so that a step
+// Step Functions retries after its worker was lost doesn't change more than the step should have: flood steps fill
+// the zone up to a number of record sets, churn steps UPSERT, and cleanup deletes whatever is left.
+var stepFunctionsPhases = []string{"flood", "churn", "cleanup"}
+
+// stepFunctionsRetryErrors are the errors a state machine retries a step on, a failed step and losing its Lambda worker
+var stepFunctionsRetryErrors = []string{
+	"RunStepError", "Lambda.Unknown", "Lambda.ServiceException", "Lambda.AWSLambdaException", "Lambda.SdkClientException", "Lambda.TooManyRequestsException",
+}
+
+func init() {
+	commands = append(commands, command{
+		name:        "step-functions",
+		description: "Print an AWS Step Functions state machine that runs a config file as flood, churn, and cleanup phases of Lambda steps",
+		flags: func(fs *flag.FlagSet, opts *Options) {
+			fs.StringVar(&opts.StepFunctionsPlan, "plan", "", "Path to the config file of the run, it must set hosted-zone-id")
+			fs.StringVar(&opts.StepFunctionsPhases, "phases", "flood", fmt.Sprintf("Comma-separated phases the state machine runs in order: %s", strings.Join(stepFunctionsPhases, ", ")))
+			fs.StringVar(&opts.StepFunctionsFunction, "function-arn", "", "ARN of the Lambda function of the floodzone binary that runs the steps")
+			fs.IntVar(&opts.StepRecords, "step-records", 1_000, "Record sets a flood step adds to the zone, keep it small enough for a step to finish within the Lambda timeout")
+			fs.IntVar(&opts.StepIterations, "step-iterations", 1, "Iterations a churn step does")
+		},
+		runLocal: runStepFunctions,
+	})
+}
+
+// stepFunctionsStep is the state of a phase that a Step Functions execution keeps between its steps, so that the
+// steps themselves are stateless and any Lambda worker can run the next one
+type stepFunctionsStep struct {
+	StepRecords    int `json:"step-records"`
+	StepIterations int `json:"step-iterations"`
+	// Records is the number of record sets the flood steps filled the zone up to so far
+	Records int `json:"records"`
+	// Iterations is the number of churn iterations done so far
+	Iterations int  `json:"iterations"`
+	Steps      int  `json:"steps"`
+	Done       bool `json:"done"`
+	// Summary is the run summary of the last step
+	Summary json.RawMessage `json:"summary,omitempty"`
+}
+
+// stateMachine is an Amazon States Language definition
+type stateMachine struct {
+	Comment string                       `json:"Comment"`
+	StartAt string                       `json:"StartAt"`
+	States  map[string]stateMachineState `json:"States"`
+}
+
+type stateMachineState struct {
+	Type       string              `json:"Type"`
+	Resource   string              `json:"Resource,omitempty"`
+	Parameters map[string]any      `json:"Parameters,omitempty"`
+	Result     any                 `json:"Result,omitempty"`
+	ResultPath string              `json:"ResultPath,omitempty"`
+	Retry      []stateMachineRetry `json:"Retry,omitempty"`
+	Choices    []stateMachineRule  `json:"Choices,omitempty"`
+	Default    string              `json:"Default,omitempty"`
+	Next       string              `json:"Next,omitempty"`
+}
+
+type stateMachineRetry struct {
+	ErrorEquals     []string `json:"ErrorEquals"`
+	IntervalSeconds int      `json:"IntervalSeconds"`
+	MaxAttempts     int      `json:"MaxAttempts"`
+	BackoffRate     float64  `json:"BackoffRate"`
+}
+
+type stateMachineRule struct {
+	Variable      string `json:"Variable"`
+	BooleanEquals bool   `json:"BooleanEquals"`
+	Next          string `json:"Next"`
+}
+
+// runStepFunctions prints the state machine of the plan, to create with the AWS CLI or a template
+func runStepFunctions(_ context.Context, opts Options, _ []string) error {
+	var errs []error
+	if opts.StepFunctionsPlan == "" {
+		errs = append(errs, errors.New("--plan is required"))
+	}
+	if opts.StepFunctionsFunction == "" {
+		errs = append(errs, errors.New("--function-arn is required"))
+	}
+	if opts.StepRecords < 1 {
+		errs = append(errs, errors.New("--step-records must be at least 1"))
+	}
+	if opts.StepIterations < 1 {
+		errs = append(errs, errors.New("--step-iterations must be at least 1"))
+	}
+	phases := strings.Split(opts.StepFunctionsPhases, ",")
+	for i, phase := range phases {
+		if !slices.Contains(stepFunctionsPhases, phase) {
+			errs = append(errs, fmt.Errorf("--phases must be of %s, got %q", strings.Join(stepFunctionsPhases, ", "), phase))
+		} else if slices.Contains(phases[:i], phase) {
+			errs = append(errs, fmt.Errorf("--phases has %s more than once", phase))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(opts.StepFunctionsPlan)
+	if err != nil {
+		return fmt.Errorf("unable to read plan: %w", err)
+	}
+	for _, phase := range phases {
+		if _, err := validateStepFunctionsPhase(phase, data); err != nil {
+			return fmt.Errorf("invalid plan %s for %s: %w", opts.StepFunctionsPlan, phase, err)
+		}
+	}
+	var config map[string]any
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("unable to parse plan: %w", err)
+	}
+	definition := stepFunctionsDefinition(opts, phases, config)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	return enc.Encode(definition)
+}
+
+// validateStepFunctionsPhase checks the config file can run as steps of the phase, and returns the options the steps
+// run with
+func validateStepFunctionsPhase(phase string, config []byte) (Options, error) {
+	if !slices.Contains(stepFunctionsPhases, phase) {
+		return Options{}, fmt.Errorf("command must be one of %s, got %q", strings.Join(stepFunctionsPhases, ", "), phase)
+	}
+	opts, err := validateRunConfig(phase, config)
+	if err != nil {
+		return opts, err
+	}
+	// a step that created a zone and was retried would create another one
+	if err := requireZoneID(opts); err != nil {
+		return opts, errors.New("hosted-zone-id is required, create the zone before the state machine runs")
+	}
+	if phase == "flood" && len(opts.LoadProfile) != 0 {
+		return opts, errors.New("load-profile isn't supported, the steps fill the zone up to total-records")
+	}
+	return opts, nil
+}
+
+// stepFunctionsDefinition returns a state machine that runs the phases in order. Every phase starts with a Pass state
+// that initializes its state, then loops over a Task that invokes the function with the config and the state, until
+// the function returns that the phase is done. The steps of an execution share its name as their run ID.
+func stepFunctionsDefinition(opts Options, phases []string, config map[string]any) stateMachine {
+	definition := stateMachine{
+		Comment: fmt.Sprintf("floodzone %s of %s", strings.Join(phases, ", "), opts.StepFunctionsPlan),
+		StartAt: stepFunctionsStateName("Start", phases[0]),
+		States:  map[string]stateMachineState{"Done": {Type: "Succeed"}},
+	}
+	for i, phase := range phases {
+		start, task, check := stepFunctionsStateName("Start", phase), stepFunctionsStateName("", phase), stepFunctionsStateName("", phase)+" done?"
+		next := "Done"
+		if i+1 < len(phases) {
+			next = stepFunctionsStateName("Start", phases[i+1])
+		}
+		payload := map[string]any{}
+		for key, value := range config {
+			payload[key] = value
+		}
+		payload["command"] = phase
+		payload["step.$"] = "$." + phase
+		if _, ok := config["run-id"]; !ok {
+			payload["run-id.$"] = "$$.Execution.Name"
+		}
+		definition.States[start] = stateMachineState{
+			Type:       "Pass",
+			Result:     stepFunctionsStep{StepRecords: opts.StepRecords, StepIterations: opts.StepIterations},
+			ResultPath: "$." + phase,
+			Next:       task,
+		}
+		definition.States[task] = stateMachineState{
+			Type:       "Task",
+			Resource:   opts.StepFunctionsFunction,
+			Parameters: payload,
+			ResultPath: "$." + phase,
+			Retry:      []stateMachineRetry{{ErrorEquals: stepFunctionsRetryErrors, IntervalSeconds: 30, MaxAttempts: 3, BackoffRate: 2}},
+			Next:       check,
+		}
+		definition.States[check] = stateMachineState{
+			Type:    "Choice",
+			Choices: []stateMachineRule{{Variable: "$." + phase + ".done", BooleanEquals: true, Next: next}},
+			Default: task,
+		}
+	}
+	return definition
+}
+
+// stepFunctionsStateName returns the name of a state of the phase, e.g. "Start flood" or "Flood"
+func stepFunctionsStateName(prefix string, phase string) string {
+	if prefix == "" {
+		return strings.ToUpper(phase[:1]) + phase[1:]
+	}
+	return prefix + " " + phase
+}
+
+// handleStepFunctionsStep runs the next step of the phase of a Step Functions execution and returns the new state of
+// the phase, with the run summary of the step. A flood step fills the zone up to --step-records more record sets than
+// the last one, a churn step does --step-iterations more iterations, and cleanup is done in one step.
+func handleStepFunctionsStep(ctx context.Context, requestID string, deadline time.Time, event lambdaStepEvent, payload []byte) ([]byte, error) {
+	opts, err := validateStepFunctionsPhase(event.Command, payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid run step: %w", err)
+	}
+	step := *event.Step
+	if step.Done {
+		return json.Marshal(step)
+	}
+	var flags []string
+	next := step
+	switch event.Command {
+	case "flood":
+		if step.StepRecords < 1 {
+			return nil, errors.New("step-records of the step must be at least 1")
+		}
+		// the target of a step only depends on the previous step, so a retried step doesn't add more record sets
+		next.Records = min(step.Records+step.StepRecords, opts.TotalRecords)
+		next.Done = next.Records >= opts.TotalRecords
+		flags = append(flags, "--total-records", strconv.Itoa(next.Records))
+	case "churn":
+		if step.StepIterations < 1 {
+			return nil, errors.New("step-iterations of the step must be at least 1")
+		}
+		iterations := min(step.StepIterations, opts.Iterations-step.Iterations)
+		next.Iterations += iterations
+		next.Done = next.Iterations >= opts.Iterations
+		flags = append(flags, "--iterations", strconv.Itoa(iterations))
+	case "cleanup":
+		next.Done = true
+	}
+	summary, err := runLambdaStep(ctx, requestID, deadline, event, payload, flags...)
+	if err != nil {
+		return nil, err
+	}
+	next.Steps++
+	next.Summary = summary
+	return json.Marshal(next)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// TerraformExport collects the hosted zone and the record sets a run created, and writes them as Terraform resource and
+// import blocks when closed, so that a zone floodzone filled can be adopted into Terraform for a longer-lived test
+// environment. A nil TerraformExport is a no-op.
+type TerraformExport struct {
+	mu    sync.Mutex
+	path  string
+	runID string
+	// zones are the hosted zones of the run by ID, in the order they were first seen
+	zones map[string]*terraformZone
+	order []string
+}
+
+// terraformZone is a hosted zone to export with the record sets the run wrote to it
+type terraformZone struct {
+	id string
+	// hostedZone and vpcs are only set for zones the run created, which are exported too
+	hostedZone *types.HostedZone
+	vpcs       []types.VPC
+	recordSets map[writtenRecord]types.ResourceRecordSet
+}
+
+// NewTerraformExport returns a TerraformExport written to path
+func NewTerraformExport(path string, runID string) *TerraformExport {
+	return &TerraformExport{path: path, runID: runID, zones: map[string]*terraformZone{}}
+}
+
+// AdoptZone exports the hosted zone along with its record sets, for zones the run created
+func (t *TerraformExport) AdoptZone(hostedZone *types.HostedZone, vpcs []types.VPC) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	zone := t.zone(aws.ToString(hostedZone.Id))
+	zone.hostedZone, zone.vpcs = hostedZone, vpcs
+}
+
+// RecordBatch records the record sets created or upserted by a successful change batch, and forgets the deleted ones
+func (t *TerraformExport) RecordBatch(hostedZoneID string, changes []types.Change) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	zone := t.zone(hostedZoneID)
+	for _, change := range changes {
+		rr := change.ResourceRecordSet
+		if rr == nil {
+			continue
+		}
+		key := writtenKey(zone.id, *rr)
+		if change.Action == types.ChangeActionDelete {
+			delete(zone.recordSets, key)
+			continue
+		}
+		zone.recordSets[key] = *rr
+	}
+}
+
+func (t *TerraformExport) zone(hostedZoneID string) *terraformZone {
+	id := strings.TrimPrefix(hostedZoneID, "/hostedzone/")
+	zone, ok := t.zones[id]
+	if !ok {
+		zone = &terraformZone{id: id, recordSets: map[writtenRecord]types.ResourceRecordSet{}}
+		t.zones[id] = zone
+		t.order = append(t.order, id)
+	}
+	return zone
+}
+
+// Close writes the Terraform file. Failures are only logged so that a failed run still reports its own error.
+func (t *TerraformExport) Close(_ context.Context) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := os.WriteFile(t.path, t.hcl(), 0o644); err != nil {
+		slog.Error("unable to write the Terraform export", "path", t.path, "error", err)
+		return
+	}
+	recordSets := 0
+	for _, zone := range t.zones {
+		recordSets += len(zone.recordSets)
+	}
+	slog.Info("📜 Wrote the Terraform export", "path", t.path, "zones", len(t.zones), "recordSets", recordSets)
+}
+
+// hcl renders the zones as Terraform. The record sets of a zone are a local map that one aws_route53_record resource
+// and one import block iterate over, which keeps the file readable with thousands of record sets. Import blocks with
+// for_each need Terraform 1.7 or later.
+func (t *TerraformExport) hcl() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Generated by floodzone for run %s.\n", t.runID)
+	b.WriteString("# Review it with terraform plan, which imports the resources below instead of creating them, then terraform apply.\n")
+	for _, id := range t.order {
+		zone := t.zones[id]
+		name := "floodzone"
+		if len(t.order) > 1 {
+			name = "floodzone_" + strings.ToLower(id)
+		}
+		zoneID := hclString(id)
+		if zone.hostedZone != nil {
+			zoneID = fmt.Sprintf("aws_route53_zone.%s.zone_id", name)
+			fmt.Fprintf(&b, "\nimport {\n  to = aws_route53_zone.%s\n  id = %s\n}\n", name, hclString(id))
+			fmt.Fprintf(&b, "\nresource \"aws_route53_zone\" %q {\n", name)
+			zoneName := hclString(strings.TrimSuffix(aws.ToString(zone.hostedZone.Name), "."))
+			if zone.hostedZone.Config != nil && aws.ToString(zone.hostedZone.Config.Comment) != "" {
+				fmt.Fprintf(&b, "  name    = %s\n  comment = %s\n", zoneName, hclString(aws.ToString(zone.hostedZone.Config.Comment)))
+			} else {
+				fmt.Fprintf(&b, "  name = %s\n", zoneName)
+			}
+			for _, vpc := range zone.vpcs {
+				fmt.Fprintf(&b, "\n  vpc {\n    vpc_id     = %s\n    vpc_region = %s\n  }\n", hclString(aws.ToString(vpc.VPCId)), hclString(string(vpc.VPCRegion)))
+			}
+			b.WriteString("}\n")
+		}
+		if len(zone.recordSets) == 0 {
+			continue
+		}
+		recordSets := make([]types.ResourceRecordSet, 0, len(zone.recordSets))
+		for _, rr := range zone.recordSets {
+			recordSets = append(recordSets, rr)
+		}
+		sort.Slice(recordSets, func(i, j int) bool {
+			if aws.ToString(recordSets[i].Name) != aws.ToString(recordSets[j].Name) {
+				return aws.ToString(recordSets[i].Name) < aws.ToString(recordSets[j].Name)
+			}
+			return recordSets[i].Type < recordSets[j].Type
+		})
+		fmt.Fprintf(&b, "\nlocals {\n  %s_record_sets = {\n", name)
+		for _, rr := range recordSets {
+			rrName := strings.TrimSuffix(strings.ToLower(aws.ToString(rr.Name)), ".")
+			values := make([]string, 0, len(rr.ResourceRecords))
+			for _, value := range rr.ResourceRecords {
+				values = append(values, hclString(terraformValue(rr.Type, aws.ToString(value.Value))))
+			}
+			fmt.Fprintf(&b, "    %s = { name = %s, type = %q, ttl = %d, records = [%s] }\n",
+				hclString(rrName+" "+string(rr.Type)), hclString(rrName), rr.Type, aws.ToInt64(rr.TTL), strings.Join(values, ", "))
+		}
+		b.WriteString("  }\n}\n")
+		fmt.Fprintf(&b, "\nimport {\n  for_each = local.%s_record_sets\n  to       = aws_route53_record.%s[each.key]\n  id       = \"%s_${each.value.name}_${each.value.type}\"\n}\n", name, name, id)
+		fmt.Fprintf(&b, "\nresource \"aws_route53_record\" %q {\n  for_each = local.%s_record_sets\n  zone_id  = %s\n  name     = each.value.name\n  type     = each.value.type\n  ttl      = each.value.ttl\n  records  = each.value.records\n}\n", name, name, zoneID)
+	}
+	return b.Bytes()
+}
+
+// terraformValue returns a record value the way the AWS provider expects it. TXT and SPF values are written without
+// the quotes Route 53 needs, and the strings of a value longer than 255 characters are joined with "".
+func terraformValue(rrType types.RRType, value string) string {
+	if rrType != types.RRTypeTxt && rrType != types.RRTypeSpf {
+		return value
+	}
+	var strs []string
+	var current strings.Builder
+	quoted, escaped := false, false
+	for _, r := range value {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quoted:
+			escaped = true
+		case r == '"':
+			if quoted {
+				strs = append(strs, current.String())
+				current.Reset()
+			}
+			quoted = !quoted
+		case quoted:
+			current.WriteRune(r)
+		}
+	}
+	if len(strs) == 0 {
+		return value
+	}
+	return strings.Join(strs, `""`)
+}
+
+// hclString quotes s as an HCL string literal, escaping template sequences so that they're taken literally
+func hclString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`, "${", "$${", "%{", "%%{")
+	return `"` + r.Replace(s) + `"`
+}
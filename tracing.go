@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/bwagner5/floodzone"
+
+// tracer is a no-op until setupTracing registers an exporting tracer provider
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// tracingEnabled returns true if an OTLP endpoint was passed or is configured with the standard OTEL environment variables
+func tracingEnabled(opts Options) bool {
+	return opts.OTLPEndpoint != "" || os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// setupTracing registers a tracer provider that exports spans over OTLP/HTTP. The returned shutdown func flushes the
+// remaining spans.
+func setupTracing(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	var exporterOpts []otlptracehttp.Option
+	if opts.OTLPEndpoint != "" {
+		u, err := url.Parse(opts.OTLPEndpoint)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid OTLP endpoint %q, expected e.g. http://localhost:4318", opts.OTLPEndpoint)
+		}
+		exporterOpts = append(exporterOpts, otlptracehttp.WithEndpoint(u.Host))
+		if u.Scheme == "http" {
+			exporterOpts = append(exporterOpts, otlptracehttp.WithInsecure())
+		}
+		if u.Path != "" && u.Path != "/" {
+			exporterOpts = append(exporterOpts, otlptracehttp.WithURLPath(u.Path))
+		}
+	}
+	exporter, err := otlptracehttp.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create OTLP exporter: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName("floodzone"),
+		attribute.String("floodzone.run_id", opts.RunID),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create OTel resource: %w", err)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// tracingMiddleware starts a client span around every AWS API call, including its retries
+func tracingMiddleware(stack *middleware.Stack) error {
+	// added after the service metadata is registered on the context by the SDK's own initialize middleware
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("FloodzoneTracing", func(ctx context.Context, in middleware.InitializeInput,
+		next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		service, operation := awsmiddleware.GetServiceID(ctx), awsmiddleware.GetOperationName(ctx)
+		ctx, span := tracer().Start(ctx, fmt.Sprintf("%s.%s", service, operation),
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.RPCSystemKey.String("aws-api"),
+				semconv.RPCService(service),
+				semconv.RPCMethod(operation),
+				attribute.String("aws.region", awsmiddleware.GetRegion(ctx)),
+			),
+		)
+		defer span.End()
+		out, metadata, err := next.HandleInitialize(ctx, in)
+		if requestID, ok := awsmiddleware.GetRequestIDMetadata(metadata); ok {
+			span.SetAttributes(attribute.String("aws.request_id", requestID))
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return out, metadata, err
+	}), middleware.After)
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/google/uuid"
+)
+
+const (
+	// trafficPolicyPrefix prefixes the name of every traffic policy floodzone creates, which is how they're found to be
+	// deleted
+	trafficPolicyPrefix = "floodzone-"
+	// defaultTrafficPolicyRate is how many traffic policies or versions are created per second by default, the Route 53
+	// API rate limit of an account
+	defaultTrafficPolicyRate = 5
+	// trafficPolicyFormatVersion is the only version of the traffic policy document format
+	trafficPolicyFormatVersion = "2015-10-01"
+	// maxTrafficPolicyDocument is the longest traffic policy document Route 53 accepts
+	maxTrafficPolicyDocument = 102400
+)
+
+// trafficPoliciesResult is the output of the traffic-policies command
+type trafficPoliciesResult struct {
+	Action          string `json:"action" yaml:"action"`
+	TrafficPolicies int    `json:"trafficPolicies" yaml:"trafficPolicies"`
+	// Versions is how many versions were created or deleted across the traffic policies
+	Versions int `json:"versions" yaml:"versions"`
+	// InUse is how many versions couldn't be deleted since traffic policy instances still use them
+	InUse int `json:"inUse,omitempty" yaml:"inUse,omitempty"`
+	// DocumentBytes is the size of the document of every version
+	DocumentBytes int `json:"documentBytes,omitempty" yaml:"documentBytes,omitempty"`
+	// Instances is how many traffic policy instances were created or deleted, Failed how many Route 53 failed to apply,
+	// and ApplyDuration how long Route 53 took to apply all of them
+	Instances     int           `json:"instances,omitempty" yaml:"instances,omitempty"`
+	Failed        int           `json:"failed,omitempty" yaml:"failed,omitempty"`
+	ApplyDuration time.Duration `json:"applyDuration,omitempty" yaml:"applyDuration,omitempty"`
+	// InstanceRecordSets is how many record sets of the zones the traffic policy instances created
+	InstanceRecordSets int `json:"instanceRecordSets,omitempty" yaml:"instanceRecordSets,omitempty"`
+	// Throttled is how many attempts Route 53 throttled, which the SDK retried
+	Throttled int           `json:"throttled" yaml:"throttled"`
+	Duration  time.Duration `json:"duration" yaml:"duration"`
+	Rate      float64       `json:"rate" yaml:"rate"`
+}
+
+func (r trafficPoliciesResult) writeTable(w io.Writer) {
+	fmt.Fprintln(w, "ACTION\tTRAFFIC POLICIES\tVERSIONS\tIN USE\tDOCUMENT BYTES\tTHROTTLED\tDURATION\tPER SECOND")
+	fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%s\t%.2f\n", r.Action, r.TrafficPolicies, r.Versions, r.InUse, r.DocumentBytes, r.Throttled, r.Duration.Round(time.Millisecond), r.Rate)
+	switch {
+	case r.Instances == 0:
+	case r.Action == "deleted":
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "INSTANCES")
+		fmt.Fprintf(w, "%d\n", r.Instances)
+	default:
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "INSTANCES\tFAILED\tAPPLY DURATION\tINSTANCE RECORD SETS")
+		fmt.Fprintf(w, "%d\t%d\t%s\t%d\n", r.Instances, r.Failed, r.ApplyDuration.Round(time.Second), r.InstanceRecordSets)
+	}
+}
+
+// runTrafficPolicies creates traffic policies with generated documents of --rules weighted rules and their versions at a
+// controlled rate, to test the traffic policy quotas of the account and the tools that list them. With
+// --policy-instances, it also creates traffic policy instances of them in the zones of --hosted-zone-id. With --delete,
+// it deletes the traffic policy instances and every version of the traffic policies floodzone created instead.
+func runTrafficPolicies(ctx context.Context, zone Zone, opts Options) error {
+	var throttles throttleCounter
+	throttled := func(o *route53.Options) { o.APIOptions = append(o.APIOptions, throttles.middleware) }
+	start := time.Now()
+	if opts.Delete {
+		policies, err := zone.trafficPolicies(ctx, trafficPolicyPrefix, throttled)
+		if err != nil {
+			return err
+		}
+		// the versions of the traffic policies can't be deleted while instances use them
+		policyIDs := map[string]bool{}
+		for _, policy := range policies {
+			policyIDs[*policy.Id] = true
+		}
+		instances, err := zone.DeleteTrafficPolicyInstances(ctx, "", opts.CreateRate, func(instance types.TrafficPolicyInstance) bool {
+			return policyIDs[aws.ToString(instance.TrafficPolicyId)]
+		}, throttled)
+		if err != nil {
+			return err
+		}
+		deleted, versions, inUse, err := zone.DeleteTrafficPolicies(ctx, trafficPolicyPrefix, opts.CreateRate, throttled)
+		if err != nil {
+			return err
+		}
+		if inUse != 0 {
+			slog.Warn("some traffic policy versions are still in use by traffic policy instances, delete the instances first", "inUse", inUse)
+		}
+		result := newTrafficPoliciesResult("deleted", deleted, versions, start)
+		result.InUse, result.Instances, result.Throttled = inUse, instances, throttles.Count()
+		return printOutput(opts.Output, result)
+	}
+	var hostedZones []*types.HostedZone
+	for _, hostedZoneID := range splitList(opts.HostedZoneID) {
+		if err := zone.Coordinator.Lock(ctx, hostedZoneID); err != nil {
+			return err
+		}
+		hz, err := zone.R53.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: aws.String(hostedZoneID)})
+		if err != nil {
+			return fmt.Errorf("unable to describe hosted zone %s: %w", hostedZoneID, err)
+		}
+		hostedZones = append(hostedZones, hz.HostedZone)
+	}
+	prefix := trafficPolicyPrefix + strings.Split(uuid.NewString(), "-")[0]
+	policyIDs := make([]string, opts.TrafficPolicies)
+	slog.Info("🚦 Creating traffic policies", "trafficPolicies", opts.TrafficPolicies, "versions", opts.TrafficPolicyVersions, "rules", opts.TrafficPolicyRules, "rate", opts.CreateRate)
+	err := paceCalls(ctx, opts.TrafficPolicies, opts.CreateRate, func(ctx context.Context, i int) error {
+		out, err := zone.R53.CreateTrafficPolicy(ctx, &route53.CreateTrafficPolicyInput{
+			Name:     aws.String(fmt.Sprintf("%s-%d", prefix, i)),
+			Document: aws.String(trafficPolicyDocument(opts, 1)),
+			Comment:  aws.String("floodzone version 1"),
+		}, throttled)
+		if err != nil {
+			return fmt.Errorf("unable to create traffic policy %d: %w", i, err)
+		}
+		policyIDs[i] = *out.TrafficPolicy.Id
+		return nil
+	})
+	versions := 0
+	for _, id := range policyIDs {
+		if id != "" {
+			versions++
+		}
+	}
+	// a traffic policy gets its versions one at a time, so every round creates the next version of all of them
+	for version := 2; err == nil && version <= opts.TrafficPolicyVersions; version++ {
+		var created atomic.Int64
+		err = paceCalls(ctx, len(policyIDs), opts.CreateRate, func(ctx context.Context, i int) error {
+			_, err := zone.R53.CreateTrafficPolicyVersion(ctx, &route53.CreateTrafficPolicyVersionInput{
+				Id:       &policyIDs[i],
+				Document: aws.String(trafficPolicyDocument(opts, version)),
+				Comment:  aws.String(fmt.Sprintf("floodzone version %d", version)),
+			}, throttled)
+			if err != nil {
+				return fmt.Errorf("unable to create version %d of traffic policy %s: %w", version, policyIDs[i], err)
+			}
+			created.Add(1)
+			return nil
+		})
+		versions += int(created.Load())
+		slog.Info("✅ Created a version of every traffic policy", "version", version, "versions", versions)
+	}
+	if err != nil {
+		if versions != 0 {
+			slog.Error("some traffic policies were created before the run failed, delete them with traffic-policies --delete", "versions", versions)
+		}
+		return err
+	}
+	slog.Info("✅ Successfully created traffic policies", "trafficPolicies", len(policyIDs), "versions", versions, "duration", time.Since(start))
+	result := newTrafficPoliciesResult("created", len(policyIDs), versions, start)
+	result.DocumentBytes = len(trafficPolicyDocument(opts, 1))
+	if opts.TrafficPolicyInstances > 0 {
+		if err := zone.createTrafficPolicyInstances(ctx, hostedZones, policyIDs, opts, &result, throttled); err != nil {
+			if result.Instances != 0 {
+				slog.Error("some traffic policy instances were created before the run failed, delete them with traffic-policies --delete", "instances", result.Instances)
+			}
+			return err
+		}
+	}
+	result.Throttled = throttles.Count()
+	return printOutput(opts.Output, result)
+}
+
+// newTrafficPoliciesResult returns the result of creating or deleting the versions of the traffic policies since start
+func newTrafficPoliciesResult(action string, policies int, versions int, start time.Time) trafficPoliciesResult {
+	result := trafficPoliciesResult{Action: action, TrafficPolicies: policies, Versions: versions, Duration: time.Since(start)}
+	if seconds := result.Duration.Seconds(); seconds > 0 {
+		result.Rate = float64(versions) / seconds
+	}
+	return result
+}
+
+// trafficPolicyDocument returns the document of a version of the traffic policies, a tree of --rules weighted rules
+// whose every rule also weighs --endpoints-per-rule endpoints. Every version answers with different addresses so that
+// it's a different document.
+func trafficPolicyDocument(opts Options, version int) string {
+	type item struct {
+		EndpointReference string `json:"EndpointReference,omitempty"`
+		RuleReference     string `json:"RuleReference,omitempty"`
+		Weight            string `json:"Weight"`
+	}
+	type rule struct {
+		RuleType string `json:"RuleType"`
+		Items    []item `json:"Items"`
+	}
+	type endpoint struct {
+		Type  string `json:"Type"`
+		Value string `json:"Value"`
+	}
+	document := struct {
+		AWSPolicyFormatVersion string              `json:"AWSPolicyFormatVersion"`
+		RecordType             string              `json:"RecordType"`
+		StartRule              string              `json:"StartRule"`
+		Endpoints              map[string]endpoint `json:"Endpoints"`
+		Rules                  map[string]rule     `json:"Rules"`
+	}{
+		AWSPolicyFormatVersion: trafficPolicyFormatVersion,
+		RecordType:             string(types.RRTypeA),
+		StartRule:              "rule-0",
+		Endpoints:              map[string]endpoint{},
+		Rules:                  map[string]rule{},
+	}
+	endpoints := opts.TrafficPolicyRules * opts.TrafficPolicyEndpoints
+	for i := range opts.TrafficPolicyRules {
+		r := rule{RuleType: "weighted"}
+		// the rules are a binary tree, rule i weighing rules 2i+1 and 2i+2
+		for _, child := range []int{2*i + 1, 2*i + 2} {
+			if child < opts.TrafficPolicyRules {
+				r.Items = append(r.Items, item{RuleReference: "rule-" + strconv.Itoa(child), Weight: "1"})
+			}
+		}
+		for j := range opts.TrafficPolicyEndpoints {
+			name := fmt.Sprintf("endpoint-%d-%d", i, j)
+			document.Endpoints[name] = endpoint{Type: "value", Value: sequentialIPv4((version-1)*endpoints + i*opts.TrafficPolicyEndpoints + j)}
+			r.Items = append(r.Items, item{EndpointReference: name, Weight: "1"})
+		}
+		document.Rules["rule-"+strconv.Itoa(i)] = r
+	}
+	b, _ := json.Marshal(document)
+	return string(b)
+}
+
+// DeleteTrafficPolicies deletes every version of the traffic policies whose name starts with the prefix at rate calls
+// per second, and returns how many traffic policies and versions it deleted and how many versions it couldn't since
+// traffic policy instances still use them
+func (z Zone) DeleteTrafficPolicies(ctx context.Context, prefix string, rate float64, optFns ...func(*route53.Options)) (int, int, int, error) {
+	policies, err := z.trafficPolicies(ctx, prefix, optFns...)
+	if err != nil || len(policies) == 0 {
+		return 0, 0, 0, err
+	}
+	versions := make([][]types.TrafficPolicy, len(policies))
+	err = paceCalls(ctx, len(policies), rate, func(ctx context.Context, i int) error {
+		policyVersions, err := z.trafficPolicyVersions(ctx, *policies[i].Id, optFns...)
+		versions[i] = policyVersions
+		return err
+	})
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	var all []types.TrafficPolicy
+	for _, v := range versions {
+		all = append(all, v...)
+	}
+	slog.Info("🧹 Deleting traffic policies", "trafficPolicies", len(policies), "versions", len(all))
+	var deleted, inUse atomic.Int64
+	remaining := make([]atomic.Int64, len(policies))
+	index := map[string]int{}
+	for i, policy := range policies {
+		index[*policy.Id] = i
+		remaining[i].Store(int64(len(versions[i])))
+	}
+	var policiesDeleted atomic.Int64
+	err = paceCalls(ctx, len(all), rate, func(ctx context.Context, i int) error {
+		_, err := z.R53.DeleteTrafficPolicy(ctx, &route53.DeleteTrafficPolicyInput{Id: all[i].Id, Version: all[i].Version}, optFns...)
+		var inUseErr *types.TrafficPolicyInUse
+		var notFound *types.NoSuchTrafficPolicy
+		switch {
+		case errors.As(err, &inUseErr):
+			inUse.Add(1)
+			return nil
+		case errors.As(err, &notFound):
+		case err != nil:
+			return fmt.Errorf("unable to delete version %d of traffic policy %s: %w", aws.ToInt32(all[i].Version), *all[i].Id, err)
+		default:
+			deleted.Add(1)
+		}
+		if remaining[index[*all[i].Id]].Add(-1) == 0 {
+			policiesDeleted.Add(1)
+		}
+		return nil
+	})
+	if err != nil {
+		return int(policiesDeleted.Load()), int(deleted.Load()), int(inUse.Load()), err
+	}
+	slog.Info("✅ Successfully deleted the traffic policies", "trafficPolicies", policiesDeleted.Load(), "versions", deleted.Load())
+	return int(policiesDeleted.Load()), int(deleted.Load()), int(inUse.Load()), nil
+}
+
+// trafficPolicies returns the latest version of the traffic policies whose name starts with the prefix
+func (z Zone) trafficPolicies(ctx context.Context, prefix string, optFns ...func(*route53.Options)) ([]types.TrafficPolicySummary, error) {
+	var policies []types.TrafficPolicySummary
+	input := &route53.ListTrafficPoliciesInput{}
+	for {
+		out, err := z.R53.ListTrafficPolicies(ctx, input, optFns...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list traffic policies: %w", err)
+		}
+		for _, policy := range out.TrafficPolicySummaries {
+			if strings.HasPrefix(aws.ToString(policy.Name), prefix) {
+				policies = append(policies, policy)
+			}
+		}
+		if !out.IsTruncated {
+			return policies, nil
+		}
+		input.TrafficPolicyIdMarker = out.TrafficPolicyIdMarker
+	}
+}
+
+// trafficPolicyVersions returns every version of a traffic policy
+func (z Zone) trafficPolicyVersions(ctx context.Context, id string, optFns ...func(*route53.Options)) ([]types.TrafficPolicy, error) {
+	var versions []types.TrafficPolicy
+	input := &route53.ListTrafficPolicyVersionsInput{Id: &id}
+	for {
+		out, err := z.R53.ListTrafficPolicyVersions(ctx, input, optFns...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list the versions of traffic policy %s: %w", id, err)
+		}
+		versions = append(versions, out.TrafficPolicies...)
+		if !out.IsTruncated {
+			return versions, nil
+		}
+		input.TrafficPolicyVersionMarker = out.TrafficPolicyVersionMarker
+	}
+}
+
+// validateTrafficPolicies validates the flags of the traffic-policies command
+func validateTrafficPolicies(opts Options) error {
+	var errs []error
+	if opts.CreateRate <= 0 {
+		errs = append(errs, errors.New("--create-rate must be greater than 0"))
+	}
+	if opts.Delete {
+		if opts.HostedZoneID != "" {
+			errs = append(errs, errors.New("--delete deletes the traffic policy instances of every zone, clean up the zones of --hosted-zone-id to only delete their instances"))
+		}
+		return errors.Join(errs...)
+	}
+	if opts.TrafficPolicyInstances < 0 {
+		errs = append(errs, errors.New("--policy-instances must not be negative"))
+	}
+	if opts.TrafficPolicyInstances > 0 && len(splitList(opts.HostedZoneID)) == 0 {
+		errs = append(errs, errors.New("--hosted-zone-id is required to create traffic policy instances"))
+	}
+	if opts.TrafficPolicies <= 0 {
+		errs = append(errs, errors.New("--traffic-policies must be greater than 0"))
+	}
+	if opts.TrafficPolicyVersions <= 0 {
+		errs = append(errs, errors.New("--versions must be greater than 0"))
+	}
+	if opts.TrafficPolicyRules <= 0 {
+		errs = append(errs, errors.New("--rules must be greater than 0"))
+	}
+	if opts.TrafficPolicyEndpoints <= 0 {
+		errs = append(errs, errors.New("--endpoints-per-rule must be greater than 0"))
+	}
+	if len(errs) == 0 {
+		if n := len(trafficPolicyDocument(opts, opts.TrafficPolicyVersions)); n > maxTrafficPolicyDocument {
+			errs = append(errs, fmt.Errorf("the traffic policy document of --rules and --endpoints-per-rule is %d bytes, Route 53 accepts at most %d", n, maxTrafficPolicyDocument))
+		}
+	}
+	return errors.Join(errs...)
+}
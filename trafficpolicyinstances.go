@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/google/uuid"
+)
+
+const (
+	// trafficPolicyInstancePrefix prefixes the first label of the name of every traffic policy instance floodzone creates
+	trafficPolicyInstancePrefix = "tp-"
+	// trafficPolicyInstanceTTL is the TTL of the record sets of the traffic policy instances
+	trafficPolicyInstanceTTL = 60
+	// trafficPolicyInstancePollInterval is how often the traffic policy instances of a zone are listed until they're
+	// applied or deleted
+	trafficPolicyInstancePollInterval = 5 * time.Second
+	// trafficPolicyInstanceTimeout is how long the traffic policy instances have to be applied or deleted
+	trafficPolicyInstanceTimeout = 10 * time.Minute
+	// trafficPolicyInstanceStateApplied and trafficPolicyInstanceStateFailed are the final states of a traffic policy
+	// instance Route 53 created the record sets of, or failed to
+	trafficPolicyInstanceStateApplied = "Applied"
+	trafficPolicyInstanceStateFailed  = "Failed"
+)
+
+// createTrafficPolicyInstances creates --policy-instances traffic policy instances of the latest version of the traffic
+// policies round robin, spread across the zones, waits for Route 53 to apply them, and counts the record sets they
+// created in the zones
+func (z Zone) createTrafficPolicyInstances(ctx context.Context, hostedZones []*types.HostedZone, policyIDs []string, opts Options, result *trafficPoliciesResult,
+	optFns ...func(*route53.Options)) error {
+	// every instance is billed for as long as it exists, unlike the traffic policies
+	slog.Warn("💸 Traffic policy instances are billed monthly for as long as they exist, delete them with traffic-policies --delete or cleanup of their zones",
+		"instances", opts.TrafficPolicyInstances)
+	prefix := trafficPolicyInstancePrefix + strings.Split(uuid.NewString(), "-")[0]
+	var created atomic.Int64
+	start := time.Now()
+	err := paceCalls(ctx, opts.TrafficPolicyInstances, opts.CreateRate, func(ctx context.Context, i int) error {
+		hostedZone := hostedZones[i%len(hostedZones)]
+		_, err := z.R53.CreateTrafficPolicyInstance(ctx, &route53.CreateTrafficPolicyInstanceInput{
+			HostedZoneId:         hostedZone.Id,
+			Name:                 aws.String(fmt.Sprintf("%s-%d.%s", prefix, i, aws.ToString(hostedZone.Name))),
+			TTL:                  aws.Int64(trafficPolicyInstanceTTL),
+			TrafficPolicyId:      &policyIDs[i%len(policyIDs)],
+			TrafficPolicyVersion: aws.Int32(int32(opts.TrafficPolicyVersions)),
+		}, optFns...)
+		if err != nil {
+			return fmt.Errorf("unable to create traffic policy instance %d in zone %s: %w", i, *hostedZone.Id, err)
+		}
+		created.Add(1)
+		return nil
+	})
+	result.Instances = int(created.Load())
+	if err != nil {
+		return err
+	}
+	slog.Info("⏳ Waiting for Route 53 to apply the traffic policy instances", "instances", result.Instances)
+	ctx, cancel := context.WithTimeout(ctx, trafficPolicyInstanceTimeout)
+	defer cancel()
+	for {
+		applied, failed := 0, 0
+		for _, hostedZone := range hostedZones {
+			instances, err := z.trafficPolicyInstances(ctx, *hostedZone.Id)
+			if err != nil {
+				return err
+			}
+			for _, instance := range instances {
+				if !strings.HasPrefix(aws.ToString(instance.Name), prefix+"-") {
+					continue
+				}
+				switch aws.ToString(instance.State) {
+				case trafficPolicyInstanceStateApplied:
+					applied++
+				case trafficPolicyInstanceStateFailed:
+					failed++
+					slog.Warn("Route 53 failed to apply a traffic policy instance", "instance", aws.ToString(instance.Name), "message", aws.ToString(instance.Message))
+				}
+			}
+		}
+		if applied+failed == result.Instances {
+			result.Failed, result.ApplyDuration = failed, time.Since(start)
+			break
+		}
+		slog.Info("Traffic policy instances are still being applied", "applied", applied, "failed", failed, "instances", result.Instances)
+		if err := sleep(ctx, trafficPolicyInstancePollInterval); err != nil {
+			return fmt.Errorf("traffic policy instances weren't applied within %s: %w", trafficPolicyInstanceTimeout, err)
+		}
+	}
+	slog.Info("✅ Route 53 applied the traffic policy instances", "instances", result.Instances, "failed", result.Failed, "duration", result.ApplyDuration)
+	// the record sets of the instances are listed like the others and count towards the quota of the zone, but only
+	// their instance can change them, so the filters of the other commands skip them
+	for _, hostedZone := range hostedZones {
+		input := &route53.ListResourceRecordSetsInput{HostedZoneId: hostedZone.Id, MaxItems: aws.Int32(maxListItems)}
+		for {
+			out, err := z.R53.ListResourceRecordSets(ctx, input, optFns...)
+			if err != nil {
+				return fmt.Errorf("unable to list the record sets of zone %s: %w", *hostedZone.Id, err)
+			}
+			for _, rr := range out.ResourceRecordSets {
+				if rr.TrafficPolicyInstanceId != nil {
+					result.InstanceRecordSets++
+				}
+			}
+			if !out.IsTruncated {
+				break
+			}
+			input.StartRecordName, input.StartRecordType, input.StartRecordIdentifier = out.NextRecordName, out.NextRecordType, out.NextRecordIdentifier
+		}
+	}
+	return nil
+}
+
+// DeleteTrafficPolicyInstances deletes the traffic policy instances the keep function selects, of the zone or of the
+// whole account if hostedZoneID is empty, and waits for Route 53 to delete their record sets. It returns how many it
+// deleted.
+func (z Zone) DeleteTrafficPolicyInstances(ctx context.Context, hostedZoneID string, rate float64, keep func(types.TrafficPolicyInstance) bool,
+	optFns ...func(*route53.Options)) (int, error) {
+	list := func() ([]types.TrafficPolicyInstance, error) {
+		instances, err := z.trafficPolicyInstances(ctx, hostedZoneID, optFns...)
+		var selected []types.TrafficPolicyInstance
+		for _, instance := range instances {
+			if keep(instance) {
+				selected = append(selected, instance)
+			}
+		}
+		return selected, err
+	}
+	instances, err := list()
+	if err != nil || len(instances) == 0 {
+		return 0, err
+	}
+	slog.Info("🧹 Deleting traffic policy instances", "instances", len(instances))
+	var deleted atomic.Int64
+	err = paceCalls(ctx, len(instances), rate, func(ctx context.Context, i int) error {
+		_, err := z.R53.DeleteTrafficPolicyInstance(ctx, &route53.DeleteTrafficPolicyInstanceInput{Id: instances[i].Id}, optFns...)
+		var notFound *types.NoSuchTrafficPolicyInstance
+		switch {
+		case errors.As(err, &notFound):
+		case err != nil:
+			return fmt.Errorf("unable to delete traffic policy instance %s: %w", aws.ToString(instances[i].Name), err)
+		default:
+			deleted.Add(1)
+		}
+		return nil
+	})
+	if err != nil {
+		return int(deleted.Load()), err
+	}
+	// the record sets of an instance are deleted with it asynchronously, and they can't be deleted any other way
+	ctx, cancel := context.WithTimeout(ctx, trafficPolicyInstanceTimeout)
+	defer cancel()
+	for {
+		remaining, err := list()
+		if err != nil {
+			return int(deleted.Load()), err
+		}
+		if len(remaining) == 0 {
+			break
+		}
+		if err := sleep(ctx, trafficPolicyInstancePollInterval); err != nil {
+			return int(deleted.Load()), fmt.Errorf("traffic policy instances weren't deleted within %s: %w", trafficPolicyInstanceTimeout, err)
+		}
+	}
+	slog.Info("✅ Successfully deleted the traffic policy instances", "instances", deleted.Load())
+	return int(deleted.Load()), nil
+}
+
+// trafficPolicyInstances returns the traffic policy instances of the zone, or of the whole account if hostedZoneID is
+// empty
+func (z Zone) trafficPolicyInstances(ctx context.Context, hostedZoneID string, optFns ...func(*route53.Options)) ([]types.TrafficPolicyInstance, error) {
+	var instances []types.TrafficPolicyInstance
+	if hostedZoneID != "" {
+		input := &route53.ListTrafficPolicyInstancesByHostedZoneInput{HostedZoneId: &hostedZoneID}
+		for {
+			out, err := z.R53.ListTrafficPolicyInstancesByHostedZone(ctx, input, optFns...)
+			if err != nil {
+				return nil, fmt.Errorf("unable to list the traffic policy instances of zone %s: %w", hostedZoneID, err)
+			}
+			instances = append(instances, out.TrafficPolicyInstances...)
+			if !out.IsTruncated {
+				return instances, nil
+			}
+			input.TrafficPolicyInstanceNameMarker, input.TrafficPolicyInstanceTypeMarker = out.TrafficPolicyInstanceNameMarker, out.TrafficPolicyInstanceTypeMarker
+		}
+	}
+	input := &route53.ListTrafficPolicyInstancesInput{}
+	for {
+		out, err := z.R53.ListTrafficPolicyInstances(ctx, input, optFns...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list traffic policy instances: %w", err)
+		}
+		instances = append(instances, out.TrafficPolicyInstances...)
+		if !out.IsTruncated {
+			return instances, nil
+		}
+		input.HostedZoneIdMarker = out.HostedZoneIdMarker
+		input.TrafficPolicyInstanceNameMarker, input.TrafficPolicyInstanceTypeMarker = out.TrafficPolicyInstanceNameMarker, out.TrafficPolicyInstanceTypeMarker
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	tuiRefreshInterval = 500 * time.Millisecond
+	tuiGraphHeight     = 8
+	tuiRecentErrors    = 6
+	tuiLogLines        = 6
+	// tuiMaxLogLines is how many log lines are kept to print once the dashboard exits
+	tuiMaxLogLines = 1_000
+)
+
+// graphBlocks are the eighths of a cell used to draw bars
+var graphBlocks = []rune(" ▁▂▃▄▅▆▇█")
+
+// TUI is a full-screen terminal dashboard of a run with a throughput graph, the batches in flight and left to submit,
+// the zones and their stats, the most recent errors, and the log. Logs are kept while it's shown and printed once it
+// exits. Pressing q or ctrl+c aborts the run, pressing it again exits the dashboard without waiting for the run to
+// wind down. A nil TUI is a no-op.
+type TUI struct {
+	mu       sync.Mutex
+	opts     Options
+	command  string
+	progress *Progress
+	stats    *RunStats
+	zones    []types.HostedZone
+	logs     *logLines
+	program  *tea.Program
+	cancel   context.CancelCauseFunc
+	exited   chan struct{}
+}
+
+// NewTUI returns a TUI of the run, or nil if stdin or stdout is not a terminal so that callers fall back to plain logs
+func NewTUI(command string, opts Options, stats *RunStats) *TUI {
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		slog.Warn("--tui needs a terminal, falling back to logs")
+		return nil
+	}
+	return &TUI{
+		opts:     opts,
+		command:  command,
+		progress: newTrackingProgress(),
+		stats:    stats,
+		logs:     &logLines{},
+	}
+}
+
+// AddZone shows a zone the run changes
+func (t *TUI) AddZone(hostedZone *types.HostedZone) {
+	if t == nil || hostedZone == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.zones = append(t.zones, *hostedZone)
+}
+
+// Start shows the dashboard until Close is called. The returned context is canceled when the run is aborted from the
+// dashboard.
+func (t *TUI) Start(ctx context.Context) context.Context {
+	if t == nil {
+		return ctx
+	}
+	ctx, t.cancel = context.WithCancelCause(ctx)
+	// logs written to the terminal would tear through the dashboard
+	if err := setupLogger(t.opts, t.logs); err != nil {
+		slog.Warn("unable to redirect logs to the dashboard", "error", err)
+	}
+	t.program = tea.NewProgram(tuiModel{tui: t}, tea.WithAltScreen(), tea.WithoutSignalHandler())
+	t.exited = make(chan struct{})
+	go func() {
+		defer close(t.exited)
+		if _, err := t.program.Run(); err != nil {
+			slog.Warn("unable to show the dashboard", "error", err)
+		}
+	}()
+	return ctx
+}
+
+// Close exits the dashboard and prints the logs written while it was shown
+func (t *TUI) Close(_ context.Context) {
+	if t == nil || t.program == nil {
+		return
+	}
+	t.program.Quit()
+	<-t.exited
+	t.cancel(nil)
+	if err := setupLogger(t.opts, os.Stderr); err != nil {
+		slog.Warn("unable to restore logging", "error", err)
+	}
+	os.Stderr.Write(t.logs.Bytes())
+}
+
+type tuiTick time.Time
+
+func tuiTickCmd() tea.Cmd {
+	return tea.Tick(tuiRefreshInterval, func(at time.Time) tea.Msg { return tuiTick(at) })
+}
+
+type tuiModel struct {
+	tui      *TUI
+	width    int
+	height   int
+	aborting bool
+}
+
+func (m tuiModel) Init() tea.Cmd {
+	return tuiTickCmd()
+}
+
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c", "esc":
+			if m.aborting {
+				return m, tea.Quit
+			}
+			m.aborting = true
+			slog.Warn("Aborting the run from the dashboard")
+			m.tui.cancel(context.Canceled)
+		}
+	case tuiTick:
+		return m, tuiTickCmd()
+	}
+	return m, nil
+}
+
+func (m tuiModel) View() string {
+	if m.width == 0 {
+		return ""
+	}
+	t := m.tui
+	summary := t.stats.Summary(t.command)
+	snap := t.progress.Snapshot()
+	elapsed := t.stats.sinceStart(0).Round(time.Second)
+
+	title := fmt.Sprintf("floodzone %s  run %s  %s", t.command, t.opts.RunID, elapsed)
+	if !t.opts.NoEmoji {
+		title = "🌊 " + title
+	}
+	help := "q: abort"
+	if m.aborting {
+		help = "aborting, q: exit now"
+	}
+	header := title + strings.Repeat(" ", max(1, m.width-lipgloss.Width(title)-lipgloss.Width(help))) + help
+	if !t.opts.NoColor {
+		header = lipgloss.NewStyle().Bold(true).Render(header)
+	}
+
+	wide := m.width
+	left := wide * 2 / 3
+	half := wide / 2
+	progress := m.panel("Progress", wide, fmt.Sprintf("%s %s %d/%d %3.0f%%\n%.1f records/s  %.2f req/s  ETA %s",
+		snap.Action, progressBar(snap.Ratio, wide-30), snap.Done, snap.Total, snap.Ratio*100, snap.Rate, snap.RequestRate, snap.ETA))
+	graph := m.panel("Throughput (changes/s)", left, throughputGraph(t.stats.Timeline(), t.stats.sinceStart(0), left-4, tuiGraphHeight))
+	queue := m.panel("Batches", wide-left, fmt.Sprintf("in flight   %d\nqueued      %d\nsubmitted   %d\nerrors      %d",
+		snap.InFlight, snap.Queued, summary.Batches+summary.Errors, summary.Errors))
+	zones := m.panel("Zones", half, t.zoneStats(summary))
+	errs := m.panel("Recent errors", wide-half, recentErrors(summary.FailedRequests, wide-half-4))
+	logs := m.panel("Log", wide, t.logs.Tail(tuiLogLines, wide-4))
+
+	return lipgloss.JoinVertical(lipgloss.Left,
+		header,
+		progress,
+		lipgloss.JoinHorizontal(lipgloss.Top, graph, queue),
+		lipgloss.JoinHorizontal(lipgloss.Top, zones, errs),
+		logs,
+	)
+}
+
+// panel draws a bordered box of the total width with the title on its first line
+func (m tuiModel) panel(title string, width int, content string) string {
+	if !m.tui.opts.NoColor {
+		title = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("6")).Render(title)
+	}
+	return lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		Padding(0, 1).
+		Width(max(width-2, 1)).
+		Render(title + "\n" + content)
+}
+
+func (t *TUI) zoneStats(summary runSummary) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var b strings.Builder
+	for _, zone := range t.zones {
+		kind := "public"
+		if zone.Config != nil && zone.Config.PrivateZone {
+			kind = "private"
+		}
+		fmt.Fprintf(&b, "%s %s (%s)\n", strings.TrimPrefix(aws.ToString(zone.Id), "/hostedzone/"), aws.ToString(zone.Name), kind)
+	}
+	fmt.Fprintf(&b, "created %d  deleted %d  upserted %d\n", summary.Created, summary.Deleted, summary.Upserted)
+	fmt.Fprintf(&b, "latency p50 %.0fms  p99 %.0fms  max %.0fms", summary.Latency.P50, summary.Latency.P99, summary.Latency.Max)
+	if p := summary.Propagation; p != nil {
+		fmt.Fprintf(&b, "\npropagation p50 %.0fms  p99 %.0fms", p.P50, p.P99)
+	}
+	return b.String()
+}
+
+func progressBar(ratio float64, width int) string {
+	width = max(width, 10)
+	filled := min(int(ratio*float64(width)), width)
+	return "[" + strings.Repeat("=", filled) + strings.Repeat(" ", width-filled) + "]"
+}
+
+// throughputGraph draws the successful changes per second over the whole run as bars, each column a slice of the
+// elapsed time rounded up to whole seconds
+func throughputGraph(timeline []batchOutcome, elapsed time.Duration, width int, height int) string {
+	width = max(width, 1)
+	bucket := max(time.Second, (elapsed/time.Duration(width)).Truncate(time.Second)+time.Second)
+	values := make([]float64, width)
+	for _, batch := range timeline {
+		if i := int(batch.at / bucket); batch.errorCode == "" && i >= 0 && i < width {
+			values[i] += float64(batch.changes) / bucket.Seconds()
+		}
+	}
+	peak := 0.0
+	for _, v := range values {
+		peak = max(peak, v)
+	}
+	lines := []string{fmt.Sprintf("peak %.1f/s, %s per column", peak, bucket)}
+	for row := height - 1; row >= 0; row-- {
+		line := make([]rune, width)
+		for i, v := range values {
+			level := 0
+			if peak > 0 {
+				level = int(v/peak*float64(height*8)) - row*8
+			}
+			line[i] = graphBlocks[min(max(level, 0), 8)]
+		}
+		lines = append(lines, string(line))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// recentErrors lists the most recent failed requests, newest first
+func recentErrors(failed []failedRequest, width int) string {
+	if len(failed) == 0 {
+		return "none"
+	}
+	var lines []string
+	for i := len(failed) - 1; i >= 0 && len(lines) < tuiRecentErrors; i-- {
+		r := failed[i]
+		lines = append(lines, truncate(fmt.Sprintf("%s %s %s %s", r.Time.Format(time.TimeOnly), r.Operation, r.ErrorCode, r.RequestID), width))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func truncate(s string, width int) string {
+	if runes := []rune(s); len(runes) > width && width > 0 {
+		return string(runes[:width])
+	}
+	return s
+}
+
+// logLines keeps the lines written to it, up to tuiMaxLogLines
+type logLines struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *logLines) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		l.lines = append(l.lines, line)
+	}
+	if over := len(l.lines) - tuiMaxLogLines; over > 0 {
+		l.lines = l.lines[over:]
+	}
+	return len(p), nil
+}
+
+// Tail returns the last n lines, each truncated to width
+func (l *logLines) Tail(n int, width int) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	tail := l.lines[max(len(l.lines)-n, 0):]
+	out := make([]string, 0, n)
+	for _, line := range tail {
+		out = append(out, truncate(line, width))
+	}
+	for len(out) < n {
+		out = append(out, "")
+	}
+	return strings.Join(out, "\n")
+}
+
+// Bytes returns every line kept
+func (l *logLines) Bytes() []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var b bytes.Buffer
+	for _, line := range l.lines {
+		b.WriteString(line + "\n")
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/bwagner5/floodzone/pkg/floodzone"
+)
+
+const (
+	// maxChangesPerBatch is the most changes Route 53 accepts in one ChangeResourceRecordSets call, UPSERTs count twice
+	maxChangesPerBatch = 1_000
+	// maxListItems is the most record sets Route 53 returns in one ListResourceRecordSets call
+	maxListItems = 300
+	// defaultRecordSetLimit is the default quota of record sets per hosted zone
+	defaultRecordSetLimit = 10_000
+	// minBatchDelay keeps the default pacing under the Route 53 limit of 5 requests per second per account
+	minBatchDelay = 200 * time.Millisecond
+)
+
+// validateFlood validates the flags of the flood command
+func validateFlood(opts Options) error {
+	var errs []error
+	if opts.HostedZoneID == "" {
+		errs = append(errs, validateZoneCreation(opts))
+	}
+	for i, stage := range opts.loadStages() {
+		name := "--total-records"
+		if len(opts.LoadProfile) != 0 {
+			name = fmt.Sprintf("total-records of load-profile stage %d", i+1)
+		}
+		if stage.TotalRecords < 1 || (stage.TotalRecords > defaultRecordSetLimit && opts.HostedZoneID == "") {
+			errs = append(errs, fmt.Errorf("%s must be from 1 to %d, the record set quota of a new hosted zone", name, defaultRecordSetLimit))
+		}
+		errs = append(errs, validateBatch(stage.MaxBatchSize, stage.BatchDelay, maxChangesPerBatch))
+	}
+	if !slices.Contains(floodzone.Generators(), opts.RecordGenerator) {
+		errs = append(errs, fmt.Errorf("--record-generator must be one of %s, got %q", strings.Join(floodzone.Generators(), ", "), opts.RecordGenerator))
+	}
+	if opts.QueryLogging != "" && !slices.Contains(queryLoggingModes, opts.QueryLogging) {
+		errs = append(errs, fmt.Errorf("--query-logging must be one of %s, got %q", strings.Join(queryLoggingModes, ", "), opts.QueryLogging))
+	}
+	errs = append(errs, validateVerify(opts), validateExternalDNS(opts))
+	errs = append(errs, validateNotifications(opts), validatePropagation(opts), validateAlarms(opts), validateAssertions(opts), validateManifest(opts))
+	return errors.Join(errs...)
+}
+
+// validateVerify validates the flags to resolve the record sets a run wrote
+func validateVerify(opts Options) error {
+	var errs []error
+	if opts.VerifyResolver != "" && opts.VerifyTestDNSAnswer {
+		errs = append(errs, errors.New("--verify-resolver and --verify-test-dns-answer are mutually exclusive"))
+	}
+	if opts.VerifyTestDNSAnswer && opts.HostedZoneID == "" {
+		errs = append(errs, errors.New("--verify-test-dns-answer needs the --hosted-zone-id of a public zone, the zones floodzone creates are private"))
+	}
+	if opts.VerifyEDNSSubnets != "" && !opts.VerifyTestDNSAnswer {
+		errs = append(errs, errors.New("--verify-edns-subnets needs --verify-test-dns-answer"))
+	}
+	for _, subnet := range splitList(opts.VerifyEDNSSubnets) {
+		if _, _, err := net.ParseCIDR(subnet); err != nil {
+			errs = append(errs, fmt.Errorf("--verify-edns-subnets must be CIDRs like 203.0.113.0/24, got %q", subnet))
+		}
+	}
+	if opts.VerifyResolver != "" || opts.VerifyTestDNSAnswer {
+		if opts.VerifySample < 0 {
+			errs = append(errs, errors.New("--verify-sample must not be negative"))
+		}
+		if opts.VerifyTimeout <= 0 {
+			errs = append(errs, errors.New("--verify-timeout must be positive"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateDelete validates the flags of the delete command
+func validateDelete(opts Options) error {
+	var errs []error
+	errs = append(errs, requireZoneID(opts))
+	if opts.TotalRecords < 1 {
+		errs = append(errs, errors.New("--total-records must be at least 1"))
+	}
+	errs = append(errs, validateBatch(opts.MaxBatchSize, opts.BatchDelay, maxChangesPerBatch))
+	errs = append(errs, validateNotifications(opts), validatePropagation(opts), validateAlarms(opts), validateAssertions(opts))
+	return errors.Join(errs...)
+}
+
+// validateChurn validates the flags of the churn command
+func validateChurn(opts Options) error {
+	var errs []error
+	errs = append(errs, requireZoneID(opts))
+	if opts.TotalRecords < 1 {
+		errs = append(errs, errors.New("--total-records must be at least 1"))
+	}
+	if opts.Iterations < 1 {
+		errs = append(errs, errors.New("--iterations must be at least 1"))
+	}
+	// an UPSERT counts as a DELETE and a CREATE towards the changes in a batch
+	errs = append(errs, validateBatch(opts.MaxBatchSize, opts.BatchDelay, maxChangesPerBatch/2), validateVerify(opts))
+	errs = append(errs, validateNotifications(opts), validatePropagation(opts), validateAlarms(opts), validateAssertions(opts), validateManifest(opts))
+	return errors.Join(errs...)
+}
+
+// validateCleanup validates the flags of the cleanup command
+func validateCleanup(opts Options) error {
+	return errors.Join(requireZoneID(opts), validateBatch(opts.MaxBatchSize, opts.BatchDelay, maxChangesPerBatch),
+		validateNotifications(opts), validatePropagation(opts), validateAlarms(opts), validateAssertions(opts))
+}
+
+// validateList validates the flags of commands that only list the record sets of a zone
+func validateList(opts Options) error {
+	var errs []error
+	errs = append(errs, requireZoneID(opts))
+	if opts.MaxBatchSize < 1 || opts.MaxBatchSize > maxListItems {
+		errs = append(errs, fmt.Errorf("--max-batch-size must be from 1 to %d, the most record sets Route 53 lists in one call", maxListItems))
+	}
+	return errors.Join(errs...)
+}
+
+// validateListRecords validates the flags of the list command
+func validateListRecords(opts Options) error {
+	filter := listFilter(opts)
+	errs := []error{validateList(opts)}
+	if err := filter.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("--name must be a shell pattern: %w", err))
+	}
+	for _, rrType := range filter.Types {
+		if !slices.Contains(types.RRType("").Values(), rrType) {
+			errs = append(errs, fmt.Errorf("--types must be record types like A or TXT, got %q", rrType))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateAnalyzeQueryLogs validates the flags of the analyze-query-logs command
+func validateAnalyzeQueryLogs(opts Options) error {
+	var errs []error
+	errs = append(errs, requireZoneID(opts))
+	if opts.LogsSince <= 0 {
+		errs = append(errs, fmt.Errorf("--since must be positive, got %s", opts.LogsSince))
+	}
+	if opts.LogsInterval < time.Second {
+		errs = append(errs, fmt.Errorf("--interval must be at least 1s, got %s", opts.LogsInterval))
+	}
+	if opts.FromManifest != "" {
+		errs = append(errs, validateManifestURI("--from-manifest", opts.FromManifest))
+	}
+	return errors.Join(errs...)
+}
+
+// validateReport validates the flags of the report command, which doesn't need a zone to compare runs
+func validateReport(opts Options) error {
+	if opts.Compare == "" {
+		return validateList(opts)
+	}
+	if opts.RegressionThreshold < 0 {
+		return errors.New("--regression-threshold must be at least 0")
+	}
+	return nil
+}
+
+// validateBatch validates the batch size and delay, warning about delays that are likely to be throttled
+func validateBatch(maxBatchSize int, batchDelay time.Duration, maxAllowed int) error {
+	var errs []error
+	if maxBatchSize < 1 || maxBatchSize > maxAllowed {
+		errs = append(errs, fmt.Errorf("--max-batch-size must be from 1 to %d, the most changes Route 53 accepts in one batch", maxAllowed))
+	}
+	if batchDelay < 0 {
+		errs = append(errs, fmt.Errorf("--batch-delay-duration must not be negative, got %s", batchDelay))
+	} else if batchDelay < minBatchDelay {
+		slog.Warn("--batch-delay-duration is short enough that Route 53 is likely to throttle the run", "batchDelay", batchDelay, "recommended", minBatchDelay)
+	}
+	return errors.Join(errs...)
+}
+
+// validateNotifications validates where run events are sent, so a typo doesn't only show up once a long run finished
+func validateNotifications(opts Options) error {
+	var errs []error
+	if opts.SNSTopicARN != "" && !arn.IsARN(opts.SNSTopicARN) {
+		errs = append(errs, fmt.Errorf("--sns-topic-arn must be an ARN, got %q", opts.SNSTopicARN))
+	}
+	if opts.WebhookURL != "" {
+		if u, err := url.Parse(opts.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("--webhook-url must be an http or https URL, got %q", opts.WebhookURL))
+		}
+	}
+	if opts.BatchWebhookURL != "" {
+		if u, err := url.Parse(opts.BatchWebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("--batch-webhook-url must be an http or https URL, got %q", opts.BatchWebhookURL))
+		}
+	}
+	if !slices.Contains(webhookFormats, opts.WebhookFormat) {
+		errs = append(errs, fmt.Errorf("--webhook-format must be one of %s, got %q", strings.Join(webhookFormats, ", "), opts.WebhookFormat))
+	}
+	if opts.WebhookMilestone < 0 || opts.WebhookMilestone > 100 {
+		errs = append(errs, fmt.Errorf("--webhook-milestone-percent must be from 0 to 100, got %d", opts.WebhookMilestone))
+	}
+	if opts.HookTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("--hook-timeout must be positive, got %s", opts.HookTimeout))
+	}
+	if opts.MaxErrors < 0 {
+		errs = append(errs, fmt.Errorf("--max-errors must not be negative, got %d", opts.MaxErrors))
+	}
+	if !slices.Contains(onAlarmActions, opts.OnErrorBudget) {
+		errs = append(errs, fmt.Errorf("--on-error-budget must be one of %s, got %q", strings.Join(onAlarmActions, ", "), opts.OnErrorBudget))
+	}
+	return errors.Join(errs...)
+}
+
+// validatePropagation validates how often pending changes are polled, which adds to the Route 53 request rate, and
+// how record sets are sampled to measure when they're resolvable
+func validatePropagation(opts Options) error {
+	var errs []error
+	if opts.MeasurePropagation && opts.PropagationInterval < minBatchDelay {
+		errs = append(errs, fmt.Errorf("--propagation-poll-interval must be at least %s", minBatchDelay))
+	}
+	if opts.MeasureResolvable {
+		if opts.ResolvablePercent <= 0 || opts.ResolvablePercent > 100 {
+			errs = append(errs, fmt.Errorf("--resolvable-sample-percent must be more than 0 and at most 100, got %g", opts.ResolvablePercent))
+		}
+		if opts.ResolvableInterval <= 0 {
+			errs = append(errs, errors.New("--resolvable-poll-interval must be positive"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RecordSetLimit returns the quota of record sets in the hosted zone
+func (z Zone) RecordSetLimit(ctx context.Context, hostedZoneID string) (int, error) {
+	out, err := z.R53.GetHostedZoneLimit(ctx, &route53.GetHostedZoneLimitInput{
+		HostedZoneId: &hostedZoneID,
+		Type:         types.HostedZoneLimitTypeMaxRrsetsByZone,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("unable to get the record set limit of %s: %w", hostedZoneID, err)
+	}
+	return int(aws.ToInt64(out.Limit.Value)), nil
+}
+
+// validateRecordSetLimit checks the load stages fit in the record set quota of an existing zone before any records
+// are created
+func validateRecordSetLimit(ctx context.Context, zone Zone, opts Options) error {
+	limit, err := zone.RecordSetLimit(ctx, opts.HostedZoneID)
+	if err != nil {
+		if !opts.LocalStack {
+			return err
+		}
+		// LocalStack doesn't implement every Route 53 API, so its zones are assumed to have the default quota
+		slog.Debug("unable to get the record set limit from LocalStack, assuming the default", "limit", defaultRecordSetLimit, "error", err)
+		limit = defaultRecordSetLimit
+	}
+	for _, stage := range opts.loadStages() {
+		if stage.TotalRecords > limit {
+			return fmt.Errorf("total-records of %d is more than the record set quota of %d for %s, request a quota increase or lower it", stage.TotalRecords, limit, opts.HostedZoneID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// set at build time with -ldflags "-X main.version=... -X main.commit=... -X main.date=...", otherwise filled in from
+// the build info that go embeds in the binary
+var (
+	version = ""
+	commit  = ""
+	date    = ""
+)
+
+func init() {
+	commands = append(commands, command{
+		name:        "version",
+		description: "Print the floodzone version and build metadata",
+		flags: func(fs *flag.FlagSet, opts *Options) {
+			outputFlag(fs, opts)
+		},
+		runLocal: runVersion,
+	})
+}
+
+// versionResult is the output of the version command
+type versionResult struct {
+	Version           string `json:"version" yaml:"version"`
+	Commit            string `json:"commit" yaml:"commit"`
+	Date              string `json:"date" yaml:"date"`
+	GoVersion         string `json:"goVersion" yaml:"goVersion"`
+	AWSSDKVersion     string `json:"awsSdkVersion" yaml:"awsSdkVersion"`
+	Route53SDKVersion string `json:"route53SdkVersion" yaml:"route53SdkVersion"`
+}
+
+func runVersion(_ context.Context, opts Options, _ []string) error {
+	return printOutput(opts.Output, buildVersion())
+}
+
+// buildVersion returns the version metadata from the ldflags, falling back to the module version and VCS info
+func buildVersion() versionResult {
+	result := versionResult{
+		Version:       version,
+		Commit:        commit,
+		Date:          date,
+		GoVersion:     runtime.Version(),
+		AWSSDKVersion: aws.SDKVersion,
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return withUnknowns(result)
+	}
+	if result.Version == "" {
+		result.Version = info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && result.Commit == "":
+			result.Commit = setting.Value
+		case setting.Key == "vcs.time" && result.Date == "":
+			result.Date = setting.Value
+		}
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == "github.com/aws/aws-sdk-go-v2/service/route53" {
+			result.Route53SDKVersion = dep.Version
+		}
+	}
+	return withUnknowns(result)
+}
+
+func withUnknowns(result versionResult) versionResult {
+	for _, field := range []*string{&result.Version, &result.Commit, &result.Date, &result.Route53SDKVersion} {
+		if *field == "" || *field == "(devel)" {
+			*field = "unknown"
+		}
+	}
+	return result
+}
+
+func (r versionResult) writeTable(w io.Writer) {
+	fmt.Fprintf(w, "Version:\t%s\n", r.Version)
+	fmt.Fprintf(w, "Commit:\t%s\n", r.Commit)
+	fmt.Fprintf(w, "Build Date:\t%s\n", r.Date)
+	fmt.Fprintf(w, "Go Version:\t%s\n", r.GoVersion)
+	fmt.Fprintf(w, "AWS SDK Version:\t%s\n", r.AWSSDKVersion)
+	fmt.Fprintf(w, "Route 53 SDK Version:\t%s\n", r.Route53SDKVersion)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/google/uuid"
+)
+
+const (
+	// ephemeralVPCTagKey marks VPCs created by floodzone so that cleanup only ever deletes VPCs floodzone owns
+	ephemeralVPCTagKey = "floodzone:ephemeral"
+	ephemeralVPCCIDR   = "10.0.0.0/16"
+)
+
+// CreateEphemeralVPC creates a throwaway VPC with DNS support and DNS hostnames enabled, which is required to
+// associate it with a private hosted zone. The VPC is tagged so that DeleteEphemeralVPC can clean it up later.
+// The VPC ID is returned.
+func (z Zone) CreateEphemeralVPC(ctx context.Context) (string, error) {
+	vpcOut, err := z.EC2.CreateVpc(ctx, &ec2.CreateVpcInput{
+		CidrBlock: aws.String(ephemeralVPCCIDR),
+		TagSpecifications: []ec2types.TagSpecification{
+			{
+				ResourceType: ec2types.ResourceTypeVpc,
+				Tags: []ec2types.Tag{
+					{Key: aws.String("Name"), Value: aws.String(fmt.Sprintf("floodzone-test-%s", uuid.NewString()))},
+					{Key: aws.String(ephemeralVPCTagKey), Value: aws.String("true")},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	vpcID := *vpcOut.Vpc.VpcId
+	// ModifyVpcAttribute only accepts one attribute per call
+	for _, input := range []*ec2.ModifyVpcAttributeInput{
+		{VpcId: &vpcID, EnableDnsSupport: &ec2types.AttributeBooleanValue{Value: aws.Bool(true)}},
+		{VpcId: &vpcID, EnableDnsHostnames: &ec2types.AttributeBooleanValue{Value: aws.Bool(true)}},
+	} {
+		if _, err := z.EC2.ModifyVpcAttribute(ctx, input); err != nil {
+			return vpcID, fmt.Errorf("unable to enable DNS attributes on VPC %s: %w", vpcID, err)
+		}
+	}
+	return vpcID, nil
+}
+
+// DeleteEphemeralVPC deletes the VPC if it was created by floodzone. VPCs without the floodzone ephemeral tag are
+// left untouched. Returns true if the VPC was deleted.
+func (z Zone) DeleteEphemeralVPC(ctx context.Context, vpcID string) (bool, error) {
+	vpcsOut, err := z.EC2.DescribeVpcs(ctx, &ec2.DescribeVpcsInput{
+		VpcIds: []string{vpcID},
+		Filters: []ec2types.Filter{
+			{Name: aws.String(fmt.Sprintf("tag:%s", ephemeralVPCTagKey)), Values: []string{"true"}},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	if len(vpcsOut.Vpcs) == 0 {
+		return false, nil
+	}
+	if _, err := z.EC2.DeleteVpc(ctx, &ec2.DeleteVpcInput{VpcId: &vpcID}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteEphemeralVPCs deletes all floodzone-created VPCs in the current region that were associated with the hosted zone.
+func (z Zone) DeleteEphemeralVPCs(ctx context.Context, vpcs []types.VPC, region string) error {
+	for _, vpc := range vpcs {
+		if string(vpc.VPCRegion) != region {
+			continue
+		}
+		deleted, err := z.DeleteEphemeralVPC(ctx, *vpc.VPCId)
+		if err != nil {
+			return fmt.Errorf("unable to delete VPC %s: %w", *vpc.VPCId, err)
+		}
+		if deleted {
+			slog.Info("✅ Successfully deleted the ephemeral VPC", "vpc", *vpc.VPCId)
+		}
+	}
+	return nil
+}
+
+// cleanupEphemeralVPC is a best-effort deletion of a VPC created earlier in the same run that is no longer needed
+// because a later step failed.
+func (z Zone) cleanupEphemeralVPC(ctx context.Context, vpcID string) {
+	if _, err := z.DeleteEphemeralVPC(ctx, vpcID); err != nil {
+		slog.Error("unable to clean up ephemeral VPC, it must be deleted manually", "vpc", vpcID, "error", err)
+	}
+}
+
+// VerifyVPCAssociations checks that the hosted zone shows up in ListHostedZonesByVPC for every VPC it's associated with
+// and logs the result for each VPC. An error is returned listing the VPCs the zone could not be found in.
+func (z Zone) VerifyVPCAssociations(ctx context.Context, hostedZone *types.HostedZone, vpcs []types.VPC) error {
+	var missing []string
+	for _, vpc := range vpcs {
+		associated, err := z.isAssociatedWithVPC(ctx, *hostedZone.Id, vpc)
+		if err != nil {
+			return fmt.Errorf("unable to list hosted zones for VPC %s: %w", *vpc.VPCId, err)
+		}
+		if !associated {
+			slog.Error("❌ Hosted zone is NOT visible from VPC", "zone", *hostedZone.Id, "vpc", *vpc.VPCId, "vpcRegion", vpc.VPCRegion)
+			missing = append(missing, *vpc.VPCId)
+			continue
+		}
+		slog.Info("✅ Verified hosted zone is associated with VPC", "zone", *hostedZone.Id, "vpc", *vpc.VPCId, "vpcRegion", vpc.VPCRegion)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("hosted zone %s is not associated with VPCs %s", *hostedZone.Id, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func (z Zone) isAssociatedWithVPC(ctx context.Context, hostedZoneID string, vpc types.VPC) (bool, error) {
+	// ListHostedZonesByVPC returns bare IDs while GetHostedZone returns IDs prefixed with /hostedzone/
+	hostedZoneID = strings.TrimPrefix(hostedZoneID, "/hostedzone/")
+	var nextToken *string
+	for {
+		hzOut, err := z.R53.ListHostedZonesByVPC(ctx, &route53.ListHostedZonesByVPCInput{
+			VPCId:     vpc.VPCId,
+			VPCRegion: vpc.VPCRegion,
+			NextToken: nextToken,
+		})
+		if err != nil {
+			return false, err
+		}
+		for _, hz := range hzOut.HostedZoneSummaries {
+			if strings.TrimPrefix(*hz.HostedZoneId, "/hostedzone/") == hostedZoneID {
+				return true, nil
+			}
+		}
+		if hzOut.NextToken == nil {
+			return false, nil
+		}
+		nextToken = hzOut.NextToken
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+const (
+	// defaultVPCAssociationRate is how many VPCs are created, associated, or disassociated per second by default, below
+	// the Route 53 API rate limit of an account since a zone changes one association at a time
+	defaultVPCAssociationRate = 2
+	// maxVPCAssociationAttempts is how many times a VPC is associated or disassociated while another association of the
+	// zone is in progress before giving up
+	maxVPCAssociationAttempts = 20
+	// vpcAssociationComment is the comment of every association floodzone makes
+	vpcAssociationComment = "floodzone vpc-associations"
+)
+
+// errVPCAssociationLimit stops the associations once the zone reached its VPC association quota
+var errVPCAssociationLimit = errors.New("the zone reached its VPC association quota")
+
+// vpcAssociationsResult is the output of the vpc-associations command
+type vpcAssociationsResult struct {
+	HostedZoneID string `json:"hostedZoneId" yaml:"hostedZoneId"`
+	// VPCs is how many VPCs the run tried to associate with the zone, CreatedVPCs of them created by the run
+	VPCs        int `json:"vpcs" yaml:"vpcs"`
+	CreatedVPCs int `json:"createdVpcs" yaml:"createdVpcs"`
+	// Existing is how many VPCs were associated with the zone before the run, and Limit its VPC association quota
+	Existing int `json:"existing" yaml:"existing"`
+	Limit    int `json:"limit" yaml:"limit"`
+	// Associated is how many VPCs the run associated with the zone, and LimitReached whether it stopped at the quota
+	Associated   int  `json:"associated" yaml:"associated"`
+	LimitReached bool `json:"limitReached" yaml:"limitReached"`
+	// Conflicts is how many calls failed with PriorRequestNotComplete since another association of the zone was still
+	// in progress after the SDK's retries, which were tried again
+	Conflicts     int `json:"conflicts" yaml:"conflicts"`
+	Disassociated int `json:"disassociated" yaml:"disassociated"`
+	DeletedVPCs   int `json:"deletedVpcs" yaml:"deletedVpcs"`
+	// AssociateLatency and DisassociateLatency summarize the latency of the calls that succeeded, SDK retries included
+	AssociateLatency    latencyStats `json:"associateLatency" yaml:"associateLatency"`
+	DisassociateLatency latencyStats `json:"disassociateLatency" yaml:"disassociateLatency"`
+	// Throttled is how many attempts Route 53 throttled, which the SDK retried
+	Throttled int           `json:"throttled" yaml:"throttled"`
+	Duration  time.Duration `json:"duration" yaml:"duration"`
+}
+
+func (r vpcAssociationsResult) writeTable(w io.Writer) {
+	fmt.Fprintln(w, "ZONE\tVPCS\tCREATED VPCS\tEXISTING\tLIMIT\tASSOCIATED\tLIMIT REACHED\tDISASSOCIATED\tDELETED VPCS\tCONFLICTS\tTHROTTLED\tDURATION")
+	fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%t\t%d\t%d\t%d\t%d\t%s\n", r.HostedZoneID, r.VPCs, r.CreatedVPCs, r.Existing, r.Limit, r.Associated, r.LimitReached,
+		r.Disassociated, r.DeletedVPCs, r.Conflicts, r.Throttled, r.Duration.Round(time.Millisecond))
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "CALL\tMIN\tMEAN\tP50\tP90\tP99\tMAX")
+	for _, call := range []struct {
+		name    string
+		calls   int
+		latency latencyStats
+	}{{"AssociateVPCWithHostedZone", r.Associated, r.AssociateLatency}, {"DisassociateVPCFromHostedZone", r.Disassociated, r.DisassociateLatency}} {
+		if l := call.latency; call.calls != 0 {
+			fmt.Fprintf(w, "%s\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%.1fms\n", call.name, l.Min, l.Mean, l.P50, l.P90, l.P99, l.Max)
+		}
+	}
+}
+
+// runVPCAssociations associates the private zone with the VPCs of --vpc-ids and --create-vpcs new VPCs at a controlled
+// rate, to probe its VPC association quota and the latency of AssociateVPCWithHostedZone as the associations add up,
+// then disassociates them and deletes the VPCs it created unless --keep-associations is set.
+func runVPCAssociations(ctx context.Context, zone Zone, opts Options) error {
+	var throttles throttleCounter
+	throttled := func(o *route53.Options) { o.APIOptions = append(o.APIOptions, throttles.middleware) }
+	start := time.Now()
+	if err := zone.Coordinator.Lock(ctx, opts.HostedZoneID); err != nil {
+		return err
+	}
+	hz, err := zone.R53.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: &opts.HostedZoneID}, throttled)
+	if err != nil {
+		return fmt.Errorf("unable to get hosted zone %s: %w", opts.HostedZoneID, err)
+	}
+	if !hz.HostedZone.Config.PrivateZone {
+		return fmt.Errorf("zone %s is public, only private zones can be associated with VPCs", opts.HostedZoneID)
+	}
+	hostedZoneID := *hz.HostedZone.Id
+	limit, err := zone.R53.GetHostedZoneLimit(ctx, &route53.GetHostedZoneLimitInput{HostedZoneId: &hostedZoneID, Type: types.HostedZoneLimitTypeMaxVpcsAssociatedByZone}, throttled)
+	if err != nil {
+		return fmt.Errorf("unable to get the VPC association limit of %s: %w", hostedZoneID, err)
+	}
+	result := vpcAssociationsResult{HostedZoneID: hostedZoneID, Existing: int(limit.Count), Limit: int(aws.ToInt64(limit.Limit.Value))}
+	var vpcs []types.VPC
+	for _, vpc := range parseVPCs(opts.VPCIDs, zone.Region) {
+		if vpcAssociated(hz.VPCs, vpc) {
+			slog.Info("Skipping a VPC already associated with the zone", "vpc", *vpc.VPCId, "vpcRegion", vpc.VPCRegion)
+			continue
+		}
+		vpcs = append(vpcs, vpc)
+	}
+	created, err := zone.createEphemeralVPCs(ctx, opts.CreateVPCs, opts.CreateRate)
+	for _, vpcID := range created {
+		vpcs = append(vpcs, types.VPC{VPCId: aws.String(vpcID), VPCRegion: types.VPCRegion(zone.Region)})
+	}
+	if err != nil {
+		zone.deleteEphemeralVPCs(ctx, created, opts.CreateRate)
+		return err
+	}
+	result.VPCs, result.CreatedVPCs = len(vpcs), len(created)
+	if result.Existing+len(vpcs) > result.Limit {
+		slog.Warn("🚧 The zone can't be associated with all the VPCs, the run stops associating them at its quota", "existing", result.Existing, "vpcs", len(vpcs), "limit", result.Limit)
+	}
+	slog.Info("🔗 Associating VPCs with the zone", "zone", hostedZoneID, "vpcs", len(vpcs), "existing", result.Existing, "rate", opts.CreateRate)
+	var conflicts atomic.Int64
+	latencies := make([]time.Duration, len(vpcs))
+	associateErr := paceCalls(ctx, len(vpcs), opts.CreateRate, func(ctx context.Context, i int) error {
+		latency, err := vpcAssociationCall(ctx, opts.CreateRate, &conflicts, func() error {
+			_, err := zone.R53.AssociateVPCWithHostedZone(ctx, &route53.AssociateVPCWithHostedZoneInput{
+				HostedZoneId: &hostedZoneID,
+				VPC:          &vpcs[i],
+				Comment:      aws.String(vpcAssociationComment),
+			}, throttled)
+			return err
+		})
+		var limitsExceeded *types.LimitsExceeded
+		switch {
+		case errors.As(err, &limitsExceeded):
+			return errVPCAssociationLimit
+		case err != nil:
+			return fmt.Errorf("unable to associate VPC %s with zone %s: %w", *vpcs[i].VPCId, hostedZoneID, err)
+		}
+		latencies[i] = latency
+		return nil
+	})
+	if errors.Is(associateErr, errVPCAssociationLimit) {
+		result.LimitReached, associateErr = true, nil
+	}
+	result.AssociateLatency = newLatencyStats(succeeded(latencies))
+	// calls cut short by a failure may have associated their VPC anyway, so the zone tells which VPCs the run associated
+	associated, err := zone.associatedVPCs(ctx, hostedZoneID, vpcs, throttled)
+	if err != nil {
+		return errors.Join(associateErr, err)
+	}
+	result.Associated = len(associated)
+	slog.Info("✅ Associated VPCs with the zone", "associated", result.Associated, "limitReached", result.LimitReached, "conflicts", conflicts.Load(),
+		"p50", fmt.Sprintf("%.0fms", result.AssociateLatency.P50), "max", fmt.Sprintf("%.0fms", result.AssociateLatency.Max))
+	if opts.KeepAssociations {
+		if len(created) != 0 {
+			slog.Info("Keeping the associations, cleaning up the zone deletes the VPCs the run created", "vpcs", len(created))
+		}
+	} else {
+		latencies = make([]time.Duration, len(associated))
+		var disassociated atomic.Int64
+		err = paceCalls(ctx, len(associated), opts.CreateRate, func(ctx context.Context, i int) error {
+			latency, err := vpcAssociationCall(ctx, opts.CreateRate, &conflicts, func() error {
+				_, err := zone.R53.DisassociateVPCFromHostedZone(ctx, &route53.DisassociateVPCFromHostedZoneInput{
+					HostedZoneId: &hostedZoneID,
+					VPC:          &associated[i],
+					Comment:      aws.String(vpcAssociationComment),
+				}, throttled)
+				return err
+			})
+			var notFound *types.VPCAssociationNotFound
+			switch {
+			case errors.As(err, &notFound):
+				return nil
+			case err != nil:
+				return fmt.Errorf("unable to disassociate VPC %s from zone %s: %w", *associated[i].VPCId, hostedZoneID, err)
+			}
+			latencies[i] = latency
+			disassociated.Add(1)
+			return nil
+		})
+		result.Disassociated, result.DisassociateLatency = int(disassociated.Load()), newLatencyStats(succeeded(latencies))
+		if err != nil {
+			slog.Error("some VPCs are still associated with the zone, cleaning up the zone deletes the ones the run created", "vpcs", result.Associated-result.Disassociated)
+			return errors.Join(associateErr, err)
+		}
+		slog.Info("✅ Disassociated the VPCs from the zone", "disassociated", result.Disassociated)
+		result.DeletedVPCs = zone.deleteEphemeralVPCs(ctx, created, opts.CreateRate)
+	}
+	if associateErr != nil {
+		return associateErr
+	}
+	result.Conflicts, result.Throttled, result.Duration = int(conflicts.Load()), throttles.Count(), time.Since(start)
+	return printOutput(opts.Output, result)
+}
+
+// vpcAssociationCall calls an association call, trying it again after a random wait that grows with every attempt
+// while another association of the zone is in progress, and returns the latency of the attempt that didn't conflict
+func vpcAssociationCall(ctx context.Context, rate float64, conflicts *atomic.Int64, call func() error) (time.Duration, error) {
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		err := call()
+		// the error code is checked since DisassociateVPCFromHostedZone doesn't model PriorRequestNotComplete
+		if err != nil && classifyError(err) == errorClassPriorRequest && attempt < maxVPCAssociationAttempts {
+			conflicts.Add(1)
+			if err := sleep(ctx, time.Duration(rand.Int63n(int64(attempt)*int64(float64(time.Second)/rate)))); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		return time.Since(start), err
+	}
+}
+
+// succeeded returns the latencies of the calls that succeeded, which are the ones that aren't 0
+func succeeded(latencies []time.Duration) []time.Duration {
+	var nonZero []time.Duration
+	for _, latency := range latencies {
+		if latency != 0 {
+			nonZero = append(nonZero, latency)
+		}
+	}
+	return nonZero
+}
+
+// associatedVPCs returns the VPCs that are associated with the zone
+func (z Zone) associatedVPCs(ctx context.Context, hostedZoneID string, vpcs []types.VPC, optFns ...func(*route53.Options)) ([]types.VPC, error) {
+	out, err := z.R53.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: &hostedZoneID}, optFns...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get hosted zone %s: %w", hostedZoneID, err)
+	}
+	var associated []types.VPC
+	for _, vpc := range vpcs {
+		if vpcAssociated(out.VPCs, vpc) {
+			associated = append(associated, vpc)
+		}
+	}
+	return associated, nil
+}
+
+// vpcAssociated returns whether the VPC is one of the VPCs of a zone
+func vpcAssociated(vpcs []types.VPC, vpc types.VPC) bool {
+	for _, v := range vpcs {
+		if aws.ToString(v.VPCId) == aws.ToString(vpc.VPCId) && v.VPCRegion == vpc.VPCRegion {
+			return true
+		}
+	}
+	return false
+}
+
+// createEphemeralVPCs creates n ephemeral VPCs at rate VPCs per second and returns the IDs of the ones it created, even
+// when it failed to create the others
+func (z Zone) createEphemeralVPCs(ctx context.Context, n int, rate float64) ([]string, error) {
+	if n == 0 {
+		return nil, nil
+	}
+	slog.Info("🏗️ Creating ephemeral VPCs to associate with the zone", "vpcs", n, "rate", rate)
+	vpcIDs := make([]string, n)
+	err := paceCalls(ctx, n, rate, func(ctx context.Context, i int) error {
+		vpcID, err := z.CreateEphemeralVPC(ctx)
+		vpcIDs[i] = vpcID
+		if err != nil {
+			return fmt.Errorf("unable to create VPC %d: %w", i, err)
+		}
+		return nil
+	})
+	var created []string
+	for _, vpcID := range vpcIDs {
+		if vpcID != "" {
+			created = append(created, vpcID)
+		}
+	}
+	if err == nil {
+		slog.Info("✅ Successfully Created ephemeral VPCs", "vpcs", len(created))
+	}
+	return created, err
+}
+
+// deleteEphemeralVPCs is a best-effort deletion of the VPCs created earlier in the same run at rate VPCs per second. It
+// returns how many it deleted.
+func (z Zone) deleteEphemeralVPCs(ctx context.Context, vpcIDs []string, rate float64) int {
+	var deleted atomic.Int64
+	_ = paceCalls(ctx, len(vpcIDs), rate, func(ctx context.Context, i int) error {
+		ok, err := z.DeleteEphemeralVPC(ctx, vpcIDs[i])
+		if err != nil {
+			slog.Error("unable to clean up ephemeral VPC, it must be deleted manually", "vpc", vpcIDs[i], "error", err)
+			return nil
+		}
+		if ok {
+			deleted.Add(1)
+		}
+		return nil
+	})
+	if len(vpcIDs) != 0 {
+		slog.Info("✅ Successfully deleted the ephemeral VPCs", "vpcs", deleted.Load())
+	}
+	return int(deleted.Load())
+}
+
+// parseVPCs parses the comma-separated VPC IDs of --vpc-ids, every one in the region after its colon or in the region
+// of the run
+func parseVPCs(s string, region string) []types.VPC {
+	var vpcs []types.VPC
+	for _, item := range splitList(s) {
+		vpcID, vpcRegion, ok := strings.Cut(item, ":")
+		if !ok {
+			vpcRegion = region
+		}
+		vpcs = append(vpcs, types.VPC{VPCId: aws.String(vpcID), VPCRegion: types.VPCRegion(vpcRegion)})
+	}
+	return vpcs
+}
+
+// validateVPCAssociations validates the flags of the vpc-associations command
+func validateVPCAssociations(opts Options) error {
+	var errs []error
+	if err := requireZoneID(opts); err != nil {
+		errs = append(errs, err)
+	}
+	if opts.CreateRate <= 0 {
+		errs = append(errs, errors.New("--create-rate must be greater than 0"))
+	}
+	if opts.CreateVPCs < 0 {
+		errs = append(errs, errors.New("--create-vpcs must not be negative"))
+	}
+	if opts.CreateVPCs == 0 && len(splitList(opts.VPCIDs)) == 0 {
+		errs = append(errs, errors.New("--vpc-ids or --create-vpcs is required"))
+	}
+	for _, item := range splitList(opts.VPCIDs) {
+		if vpcID, vpcRegion, ok := strings.Cut(item, ":"); !strings.HasPrefix(vpcID, "vpc-") || ok && vpcRegion == "" {
+			errs = append(errs, fmt.Errorf("--vpc-ids must be VPC IDs with an optional :region, got %q", item))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// webShutdownTimeout bounds how long the end of a run waits for open dashboard requests
+	webShutdownTimeout = 5 * time.Second
+	// webTokenHeader carries the token of the dashboard on the requests that control the run
+	webTokenHeader = "X-Floodzone-Token"
+	// webDashboardTokenEnv sets the token of the dashboard rather than a random one, for the serve command to control
+	// the runs it starts
+	webDashboardTokenEnv = envPrefix + "WEB_DASHBOARD_TOKEN"
+)
+
+// webStatus is the live state of the run served as JSON by the web dashboard
+type webStatus struct {
+	Command        string           `json:"command"`
+	RunID          string           `json:"runId"`
+	State          string           `json:"state"`
+	ElapsedSeconds float64          `json:"elapsedSeconds"`
+	Progress       progressSnapshot `json:"progress"`
+	Summary        runSummary       `json:"summary"`
+}
+
+// webLive is what the live part of the dashboard page is rendered from
+type webLive struct {
+	webStatus
+	// Token is what the page sends to control the run
+	Token      string
+	Elapsed    time.Duration
+	Throughput svgChart
+	Latency    svgChart
+	Errors     svgChart
+}
+
+// WebDashboard serves a page with the live status and charts of the run on a local address, with controls to pause,
+// resume, and abort it, for runs on a remote host that's only reachable through a browser tunnel. Pausing holds the
+// next change batch until the run is resumed. The controls need the token of the page, and the dashboard only answers
+// requests for its own address, so that other web pages open in the browser can't control the run. A nil WebDashboard
+// is a no-op.
+type WebDashboard struct {
+	mu       sync.Mutex
+	listener net.Listener
+	server   *http.Server
+	// host is the host name the dashboard was asked to listen on, which its requests may be addressed to
+	host     string
+	token    string
+	command  string
+	runID    string
+	progress *Progress
+	stats    *RunStats
+	// resumed is closed when a paused run is resumed, it's nil while the run isn't paused
+	resumed  chan struct{}
+	aborting bool
+	cancel   context.CancelCauseFunc
+}
+
+// NewWebDashboard listens on addr so that a busy port fails the run before it starts. The page is served once Start
+// is called. The controls need the token, a random one if it's empty.
+func NewWebDashboard(addr string, token string, command string, runID string, progress *Progress, stats *RunStats) (*WebDashboard, error) {
+	if token == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("unable to generate the token of the web dashboard: %w", err)
+		}
+		token = hex.EncodeToString(b)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on %s: %w", addr, err)
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	return &WebDashboard{listener: listener, host: host, token: token, command: command, runID: runID, progress: progress, stats: stats}, nil
+}
+
+// Start serves the dashboard until Close is called. The returned context is canceled when the run is aborted from the
+// dashboard.
+func (w *WebDashboard) Start(ctx context.Context) context.Context {
+	if w == nil {
+		return ctx
+	}
+	ctx, w.cancel = context.WithCancelCause(ctx)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", w.handlePage)
+	mux.HandleFunc("/live", w.handleLive)
+	mux.HandleFunc("/status", w.handleStatus)
+	mux.HandleFunc("/pause", w.control(w.pause))
+	mux.HandleFunc("/resume", w.control(w.resume))
+	mux.HandleFunc("/abort", w.control(w.abort))
+	w.server = &http.Server{Handler: w.sameOrigin(mux), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := w.server.Serve(w.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Warn("web dashboard stopped", "error", err)
+		}
+	}()
+	slog.Info("🖥️ Serving the run's dashboard", "url", "http://"+w.listener.Addr().String())
+	return ctx
+}
+
+// WaitWhilePaused blocks while the run is paused
+func (w *WebDashboard) WaitWhilePaused(ctx context.Context) error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	resumed := w.resumed
+	w.mu.Unlock()
+	if resumed == nil {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops serving the dashboard
+func (w *WebDashboard) Close(ctx context.Context) {
+	if w == nil {
+		return
+	}
+	if w.server == nil {
+		w.listener.Close()
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, webShutdownTimeout)
+	defer cancel()
+	if err := w.server.Shutdown(ctx); err != nil {
+		slog.Warn("unable to stop the web dashboard", "error", err)
+	}
+	w.cancel(nil)
+}
+
+func (w *WebDashboard) pause() {
+	if w.resumed == nil && !w.aborting {
+		w.resumed = make(chan struct{})
+		slog.Info("⏸️ Paused the run from the web dashboard")
+	}
+}
+
+func (w *WebDashboard) resume() {
+	if w.resumed != nil {
+		close(w.resumed)
+		w.resumed = nil
+		slog.Info("▶️ Resumed the run from the web dashboard")
+	}
+}
+
+func (w *WebDashboard) abort() {
+	if !w.aborting {
+		w.aborting = true
+		slog.Warn("Aborting the run from the web dashboard")
+		w.cancel(context.Canceled)
+	}
+}
+
+// sameOrigin rejects the requests addressed to another host than the dashboard's, e.g. a name that an attacker's DNS
+// rebinds to it, and those sent by the pages of other origins
+func (w *WebDashboard) sameOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		// a browser tunnel forwards another port, so only the host name has to match
+		if net.ParseIP(strings.Trim(host, "[]")) == nil && !strings.EqualFold(host, "localhost") && !strings.EqualFold(host, w.host) {
+			http.Error(rw, "the dashboard only answers requests for its own address", http.StatusForbidden)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				http.Error(rw, "the dashboard only answers requests from its own page", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// control handles a POST with the token of the dashboard that changes the state of the run
+func (w *WebDashboard) control(action func()) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			rw.Header().Set("Allow", http.MethodPost)
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(webTokenHeader)), []byte(w.token)) != 1 {
+			http.Error(rw, "the request needs the token of the dashboard", http.StatusForbidden)
+			return
+		}
+		w.mu.Lock()
+		action()
+		w.mu.Unlock()
+		w.writeJSON(rw, w.status())
+	}
+}
+
+func (w *WebDashboard) status() webStatus {
+	w.mu.Lock()
+	state := "running"
+	switch {
+	case w.aborting:
+		state = "aborting"
+	case w.resumed != nil:
+		state = "paused"
+	}
+	w.mu.Unlock()
+	return webStatus{
+		Command:        w.command,
+		RunID:          w.runID,
+		State:          state,
+		ElapsedSeconds: w.stats.sinceStart(0).Seconds(),
+		Progress:       w.progress.Snapshot(),
+		Summary:        w.stats.Summary(w.command),
+	}
+}
+
+func (w *WebDashboard) handleStatus(rw http.ResponseWriter, _ *http.Request) {
+	w.writeJSON(rw, w.status())
+}
+
+func (w *WebDashboard) writeJSON(rw http.ResponseWriter, v any) {
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(v); err != nil {
+		slog.Debug("unable to write web dashboard response", "error", err)
+	}
+}
+
+func (w *WebDashboard) handlePage(rw http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(rw, r)
+		return
+	}
+	w.render(rw, "page")
+}
+
+func (w *WebDashboard) handleLive(rw http.ResponseWriter, _ *http.Request) {
+	w.render(rw, "live")
+}
+
+func (w *WebDashboard) render(rw http.ResponseWriter, name string) {
+	status := w.status()
+	elapsed := w.stats.sinceStart(0)
+	timeline := w.stats.Timeline()
+	live := webLive{
+		webStatus:  status,
+		Token:      w.token,
+		Elapsed:    elapsed.Round(time.Second),
+		Throughput: throughputChart(timeline, elapsed),
+		Latency:    latencyChart(timeline),
+		Errors:     errorsChart(timeline, elapsed),
+	}
+	var buf bytes.Buffer
+	if err := webDashboardTemplate.ExecuteTemplate(&buf, name, live); err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.Write(buf.Bytes())
+}
+
+// webDashboardTemplate reuses the style and charts of the HTML report, the page refreshes its live part every 2 seconds
+var webDashboardTemplate = template.Must(template.Must(htmlReportTemplate.Clone()).New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>floodzone {{.Command}} {{.RunID}}</title>
+<meta name="floodzone-token" content="{{.Token}}">
+{{template "style"}}
+</head>
+<body>
+<h1>floodzone {{.Command}}</h1>
+<p>
+<button onclick="control('pause')">Pause</button>
+<button onclick="control('resume')">Resume</button>
+<button onclick="if (confirm('Abort the run?')) control('abort')">Abort</button>
+<span id="connection"></span>
+</p>
+<div id="live">{{template "live" .}}</div>
+<script>
+async function refresh() {
+  try {
+    const resp = await fetch('live');
+    document.getElementById('live').innerHTML = await resp.text();
+    document.getElementById('connection').textContent = '';
+  } catch (e) {
+    document.getElementById('connection').textContent = 'Disconnected, the run has finished or floodzone exited';
+  }
+}
+async function control(action) {
+  const token = document.querySelector('meta[name="floodzone-token"]').content;
+  await fetch(action, {method: 'POST', headers: {'X-Floodzone-Token': token}});
+  refresh();
+}
+setInterval(refresh, 2000);
+</script>
+</body>
+</html>
+{{define "live"}}
+<table>
+<tr><th>Run ID</th><td>{{.RunID}}</td></tr>
+<tr><th>State</th><td{{if ne .State "running"}} class="error"{{end}}>{{.State}}</td></tr>
+<tr><th>Elapsed</th><td>{{.Elapsed}}</td></tr>
+<tr><th>Zones</th><td>{{range $i, $z := .Summary.Zones}}{{if $i}}, {{end}}{{$z}}{{end}}</td></tr>
+</table>
+{{- with .Progress}}
+<h2>{{.Action}} {{.Done}}/{{.Total}}</h2>
+<p><progress value="{{.Done}}" max="{{.Total}}"></progress>
+{{printf "%.1f" .Rate}} records/s, {{printf "%.2f" .RequestRate}} req/s, {{.InFlight}} in flight, {{.Queued}} queued, ETA {{.ETA}}</p>
+{{- end}}
+<table>
+<tr><th>Created</th><th>Deleted</th><th>Upserted</th><th>Batches</th><th>Errors</th></tr>
+<tr><td>{{.Summary.Created}}</td><td>{{.Summary.Deleted}}</td><td>{{.Summary.Upserted}}</td><td>{{.Summary.Batches}}</td><td>{{.Summary.Errors}}</td></tr>
+</table>
+{{- if .Summary.FailedRequests}}
+<table>
+<tr><th>Failed Request</th><th>Operation</th><th>Error</th><th>Time</th></tr>
+{{- range .Summary.FailedRequests}}
+<tr><td>{{.RequestID}}</td><td>{{.Operation}}</td><td class="error">{{.ErrorCode}}</td><td>{{.Time.Format "15:04:05"}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{template "chart" .Throughput}}
+{{template "chart" .Latency}}
+{{template "chart" .Errors}}
+{{end}}
+`))
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+var webhookFormats = []string{"json", "slack"}
+
+const (
+	// webhookTimeout bounds each webhook call so a slow endpoint can't stall the run
+	webhookTimeout = 10 * time.Second
+	// batchWebhookQueue is how many batch events can wait to be posted before new ones are dropped
+	batchWebhookQueue = 1_000
+)
+
+// Webhook posts run lifecycle events to a URL, either as the JSON event or as a Slack message. Milestone events are
+// posted every milestonePercent of an operation. A nil Webhook is a no-op.
+type Webhook struct {
+	mu               sync.Mutex
+	client           *http.Client
+	url              string
+	format           string
+	milestonePercent int
+	command          string
+	runID            string
+	action           string
+	done             int
+	total            int
+	// nextMilestone is the percent of the operation that triggers the next milestone event
+	nextMilestone int
+}
+
+func NewWebhook(url string, format string, milestonePercent int, command string, runID string) *Webhook {
+	return &Webhook{
+		client:           &http.Client{Timeout: webhookTimeout},
+		url:              url,
+		format:           format,
+		milestonePercent: milestonePercent,
+		command:          command,
+		runID:            runID,
+	}
+}
+
+// Start begins tracking the milestones of a new operation that already has done out of total records done
+func (w *Webhook) Start(action string, done int, total int) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.action = action
+	w.done = done
+	w.total = total
+	w.nextMilestone = w.milestonePercent
+	// skip the milestones an operation resuming part way through has already passed
+	for w.milestonePercent > 0 && w.nextMilestone <= w.percent() {
+		w.nextMilestone += w.milestonePercent
+	}
+}
+
+// Add records n more completed records, posting a milestone event if the operation passed the next milestone
+func (w *Webhook) Add(ctx context.Context, n int) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	w.done += n
+	percent := w.percent()
+	if w.milestonePercent <= 0 || percent < w.nextMilestone || w.total <= 0 {
+		w.mu.Unlock()
+		return
+	}
+	for w.nextMilestone <= percent {
+		w.nextMilestone += w.milestonePercent
+	}
+	event := newEvent(eventMilestone, w.command, w.runID)
+	event.Milestone = &milestone{Action: w.action, Done: w.done, Total: w.total, Percent: percent}
+	w.mu.Unlock()
+	w.Notify(ctx, event)
+}
+
+func (w *Webhook) percent() int {
+	if w.total <= 0 {
+		return 100
+	}
+	return w.done * 100 / w.total
+}
+
+// Notify posts the event. Failures are only logged since a notification shouldn't change the outcome of the run.
+func (w *Webhook) Notify(ctx context.Context, event runEvent) {
+	if w == nil {
+		return
+	}
+	var payload any = event
+	if w.format == "slack" {
+		payload = slackMessage{Text: slackText(event)}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Warn("unable to marshal webhook payload", "error", err)
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		slog.Warn("unable to create webhook request", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		slog.Warn("unable to post webhook", "event", event.Event, "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		slog.Warn("webhook returned an error", "event", event.Event, "status", resp.Status)
+	}
+}
+
+// BatchWebhook posts a JSON payload for every change batch as soon as it's answered, so a measurement harness can
+// start capturing exactly when changes land. Payloads are posted in order in the background so a slow endpoint
+// doesn't slow down the flood. A nil BatchWebhook is a no-op.
+type BatchWebhook struct {
+	client  *http.Client
+	url     string
+	command string
+	runID   string
+	queue   chan batchEvent
+	stopped chan struct{}
+}
+
+// NewBatchWebhook starts posting batch events to url until Close is called
+func NewBatchWebhook(url string, command string, runID string) *BatchWebhook {
+	w := &BatchWebhook{
+		client:  &http.Client{Timeout: webhookTimeout},
+		url:     url,
+		command: command,
+		runID:   runID,
+		queue:   make(chan batchEvent, batchWebhookQueue),
+		stopped: make(chan struct{}),
+	}
+	go func() {
+		defer close(w.stopped)
+		for event := range w.queue {
+			w.post(event)
+		}
+	}()
+	return w
+}
+
+// RecordBatch queues the payload of a change batch, out is nil if it failed with err
+func (w *BatchWebhook) RecordBatch(hostedZoneID string, changes []types.Change, latency time.Duration, out *route53.ChangeResourceRecordSetsOutput, err error) {
+	if w == nil || len(changes) == 0 {
+		return
+	}
+	select {
+	case w.queue <- newBatchEvent(w.command, w.runID, hostedZoneID, changes, latency, out, err):
+	default:
+		slog.Warn("batch webhook is falling behind, dropped a batch event", "url", w.url)
+	}
+}
+
+// Close posts the queued batch events and stops
+func (w *BatchWebhook) Close(_ context.Context) {
+	if w == nil {
+		return
+	}
+	close(w.queue)
+	<-w.stopped
+}
+
+// post posts a batch event. Failures are only logged since the harness shouldn't change the outcome of the run.
+func (w *BatchWebhook) post(event batchEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Warn("unable to marshal batch webhook payload", "error", err)
+		return
+	}
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		slog.Warn("unable to post batch webhook", "changeId", event.ChangeID, "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		slog.Warn("batch webhook returned an error", "changeId", event.ChangeID, "status", resp.Status)
+	}
+}
+
+// slackMessage is the payload of a Slack incoming webhook
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+var slackEmoji = map[string]string{
+	eventStarted:     ":ocean:",
+	eventMilestone:   ":hourglass_flowing_sand:",
+	eventCompleted:   ":white_check_mark:",
+	eventFailed:      ":x:",
+	eventAborted:     ":octagonal_sign:",
+	eventErrorBudget: ":rotating_light:",
+}
+
+func slackText(event runEvent) string {
+	return fmt.Sprintf("%s %s (run `%s`)", slackEmoji[event.Event], event.text(), event.RunID)
+}
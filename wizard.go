@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/bwagner5/floodzone/pkg/floodzone"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	commands = append(commands, command{
+		name:        "init",
+		description: "Interactively build a config file and the equivalent flood command line",
+		flags: func(fs *flag.FlagSet, opts *Options) {
+			fs.StringVar(&opts.ConfigOut, "config-out", "floodzone.yaml", "Path to write the generated config file to, or - for stdout")
+		},
+		runLocal: runInit,
+	})
+}
+
+// wizardConfig is the subset of the config file the init wizard asks about, omitting anything left at its default
+type wizardConfig struct {
+	Profile      string               `yaml:"profile,omitempty"`
+	Region       string               `yaml:"region,omitempty"`
+	HostedZoneID string               `yaml:"hosted-zone-id,omitempty"`
+	VPCID        string               `yaml:"vpc-id,omitempty"`
+	CreateVPC    bool                 `yaml:"create-vpc,omitempty"`
+	TotalRecords int                  `yaml:"total-records"`
+	MaxBatchSize int                  `yaml:"max-batch-size"`
+	BatchDelay   string               `yaml:"batch-delay-duration"`
+	TypeMix      map[types.RRType]int `yaml:"type-mix,omitempty"`
+}
+
+// prompter asks questions on out and reads the answers from in
+type prompter struct {
+	in  *bufio.Scanner
+	out io.Writer
+}
+
+// ask prompts until a valid answer is given, using the default when the answer is empty
+func (p prompter) ask(question string, defaultValue string, validate func(string) error) (string, error) {
+	for {
+		if defaultValue != "" {
+			fmt.Fprintf(p.out, "%s [%s]: ", question, defaultValue)
+		} else {
+			fmt.Fprintf(p.out, "%s: ", question)
+		}
+		if !p.in.Scan() {
+			if err := p.in.Err(); err != nil {
+				return "", err
+			}
+			return "", errors.New("unexpected end of input")
+		}
+		answer := strings.TrimSpace(p.in.Text())
+		if answer == "" {
+			answer = defaultValue
+		}
+		if validate == nil {
+			return answer, nil
+		}
+		if err := validate(answer); err != nil {
+			fmt.Fprintf(p.out, "  %s\n", err)
+			continue
+		}
+		return answer, nil
+	}
+}
+
+func (p prompter) askInt(question string, defaultValue int, min int, max int) (int, error) {
+	answer, err := p.ask(question, strconv.Itoa(defaultValue), func(s string) error {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return fmt.Errorf("must be a number from %d to %d", min, max)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(answer)
+}
+
+func (p prompter) askChoice(question string, choices []string, defaultValue string) (string, error) {
+	return p.ask(fmt.Sprintf("%s (%s)", question, strings.Join(choices, "/")), defaultValue, func(s string) error {
+		for _, choice := range choices {
+			if s == choice {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(choices, ", "))
+	})
+}
+
+func runInit(_ context.Context, opts Options, _ []string) error {
+	p := prompter{in: bufio.NewScanner(os.Stdin), out: os.Stderr}
+	cfg, err := runWizard(p)
+	if err != nil {
+		return err
+	}
+	var data bytes.Buffer
+	enc := yaml.NewEncoder(&data)
+	enc.SetIndent(2)
+	if err := enc.Encode(cfg); err != nil {
+		return fmt.Errorf("unable to marshal config: %w", err)
+	}
+	if opts.ConfigOut == "-" {
+		fmt.Print(data.String())
+	} else {
+		if err := os.WriteFile(opts.ConfigOut, data.Bytes(), 0o644); err != nil {
+			return fmt.Errorf("unable to write config file: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "\nWrote %s, run it with:\n\n", opts.ConfigOut)
+		fmt.Printf("floodzone flood --config %s\n", opts.ConfigOut)
+	}
+	if len(cfg.TypeMix) != 0 {
+		fmt.Fprintln(os.Stderr, "\nThe record type mix can only be set in a config file, so there's no equivalent command line.")
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "\nOr with flags:\n\n")
+	fmt.Println(wizardCommandLine(cfg))
+	return nil
+}
+
+// runWizard asks for every option of a flood run
+func runWizard(p prompter) (wizardConfig, error) {
+	var cfg wizardConfig
+	var err error
+	fmt.Fprintln(p.out, "This walks through setting up a floodzone run. Press enter to accept the [default].")
+	fmt.Fprintln(p.out)
+	if cfg.Profile, err = p.ask("AWS shared config profile for the test account (empty for the default credentials)", "", nil); err != nil {
+		return cfg, err
+	}
+	if cfg.Region, err = p.ask("AWS Region (empty for the profile's region)", "", nil); err != nil {
+		return cfg, err
+	}
+	zoneChoice, err := p.askChoice("Flood an existing hosted zone or create a new one?", []string{"existing", "new"}, "new")
+	if err != nil {
+		return cfg, err
+	}
+	if zoneChoice == "existing" {
+		if cfg.HostedZoneID, err = p.ask("Hosted zone ID", "", required); err != nil {
+			return cfg, err
+		}
+	} else {
+		vpcChoice, err := p.askChoice("Associate the new zone with an existing VPC or create a throwaway VPC?", []string{"existing", "throwaway"}, "throwaway")
+		if err != nil {
+			return cfg, err
+		}
+		if vpcChoice == "existing" {
+			if cfg.VPCID, err = p.ask("VPC ID", "", required); err != nil {
+				return cfg, err
+			}
+		} else {
+			cfg.CreateVPC = true
+		}
+	}
+	typeMix, err := p.ask("Record type mix as TYPE=WEIGHT pairs, e.g. A=80,TXT=20", "A=100", validTypeMix)
+	if err != nil {
+		return cfg, err
+	}
+	if mix, _ := parseTypeMix(typeMix); !(len(mix) == 1 && mix[types.RRTypeA] != 0) {
+		cfg.TypeMix = mix
+	}
+	if cfg.TotalRecords, err = p.askInt("Total resource record sets in the zone", 1_000, 1, 10_000); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxBatchSize, err = p.askInt("Resource record sets per batch", 100, 1, 1_000); err != nil {
+		return cfg, err
+	}
+	if cfg.BatchDelay, err = p.ask("Delay between batches", "10s", func(s string) error {
+		_, err := time.ParseDuration(s)
+		return err
+	}); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func required(s string) error {
+	if s == "" {
+		return errors.New("a value is required")
+	}
+	return nil
+}
+
+func validTypeMix(s string) error {
+	_, err := parseTypeMix(s)
+	return err
+}
+
+// parseTypeMix parses a comma separated list of TYPE=WEIGHT pairs
+func parseTypeMix(s string) (map[types.RRType]int, error) {
+	mix := map[types.RRType]int{}
+	for _, pair := range strings.Split(s, ",") {
+		rrType, weight, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("%q must be TYPE=WEIGHT", pair)
+		}
+		rrType = strings.ToUpper(strings.TrimSpace(rrType))
+		if !floodzone.SupportedRecordType(types.RRType(rrType)) {
+			return nil, fmt.Errorf("unsupported record type %q", rrType)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(weight))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("weight of %s must be a positive number", rrType)
+		}
+		mix[types.RRType(rrType)] = n
+	}
+	return mix, nil
+}
+
+// wizardCommandLine returns the flood command line equivalent to the config
+func wizardCommandLine(cfg wizardConfig) string {
+	args := []string{"floodzone", "flood"}
+	flags := map[string]string{
+		"profile":              cfg.Profile,
+		"region":               cfg.Region,
+		"hosted-zone-id":       cfg.HostedZoneID,
+		"vpc-id":               cfg.VPCID,
+		"total-records":        strconv.Itoa(cfg.TotalRecords),
+		"max-batch-size":       strconv.Itoa(cfg.MaxBatchSize),
+		"batch-delay-duration": cfg.BatchDelay,
+	}
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if flags[name] != "" {
+			args = append(args, "--"+name, flags[name])
+		}
+	}
+	if cfg.CreateVPC {
+		args = append(args, "--create-vpc")
+	}
+	return strings.Join(args, " ")
+}
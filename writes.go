@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// staleStats is how many of the upserted record sets Route 53 lists with the value they were last written with
+type staleStats struct {
+	Checked int `json:"checked" yaml:"checked"`
+	Current int `json:"current" yaml:"current"`
+	// Stale record sets are listed with a value other than the last one written, e.g. because an update was lost
+	Stale int `json:"stale" yaml:"stale"`
+	// Missing record sets aren't listed at all
+	Missing int `json:"missing" yaml:"missing"`
+	// Records are the first stale and missing record sets
+	Records []staleRecord `json:"records,omitempty" yaml:"records,omitempty"`
+}
+
+// staleRecord is an upserted record set that isn't listed with the value it was last written with
+type staleRecord struct {
+	Name string `json:"name" yaml:"name"`
+	Type string `json:"type" yaml:"type"`
+	Want string `json:"want" yaml:"want"`
+	// Got is empty for a missing record set
+	Got string `json:"got" yaml:"got"`
+}
+
+// writtenRecord identifies a record set a run wrote
+type writtenRecord struct {
+	hostedZoneID  string
+	name          string
+	rrType        types.RRType
+	setIdentifier string
+}
+
+// WriteVerifier remembers the value every record set a run upserted was last written with, and lists the zone once the
+// run is done to check that Route 53 has those values, catching updates that were lost under heavy concurrent change.
+// A nil WriteVerifier is a no-op.
+type WriteVerifier struct {
+	mu      sync.Mutex
+	stats   *RunStats
+	written map[writtenRecord]string
+}
+
+// NewWriteVerifier returns a WriteVerifier that records the outcome of Verify in the run stats
+func NewWriteVerifier(stats *RunStats) *WriteVerifier {
+	return &WriteVerifier{stats: stats, written: map[writtenRecord]string{}}
+}
+
+// RecordBatch remembers the values of the record sets upserted by a successful change batch, replacing the values they
+// were written with before
+func (v *WriteVerifier) RecordBatch(hostedZoneID string, changes []types.Change) {
+	if v == nil {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, change := range changes {
+		rr := change.ResourceRecordSet
+		if change.Action != types.ChangeActionUpsert || rr == nil || rr.AliasTarget != nil {
+			continue
+		}
+		v.written[writtenKey(hostedZoneID, *rr)] = writtenValues(*rr)
+	}
+}
+
+// Verify lists the record sets of the zone and records how many of the upserted ones have the value they were last
+// written with in the run stats
+func (v *WriteVerifier) Verify(ctx context.Context, z Zone, hostedZone *types.HostedZone) error {
+	if v == nil {
+		return nil
+	}
+	v.mu.Lock()
+	written := map[writtenRecord]string{}
+	for key, want := range v.written {
+		if key.hostedZoneID == aws.ToString(hostedZone.Id) {
+			written[key] = want
+		}
+	}
+	v.mu.Unlock()
+	if len(written) == 0 {
+		return nil
+	}
+	slog.Info("🔎 Verifying the upserted record sets have their last written value", "zone", *hostedZone.Id, "recordSets", len(written))
+	rrs, err := z.ListResourceRecordSets(ctx, hostedZone, maxListItems)
+	if err != nil {
+		return fmt.Errorf("unable to list resource record sets to verify the upserted values: %w", err)
+	}
+	listed := map[writtenRecord]string{}
+	for _, rr := range rrs {
+		listed[writtenKey(aws.ToString(hostedZone.Id), rr)] = writtenValues(rr)
+	}
+	stats := staleStats{Checked: len(written)}
+	keys := make([]writtenRecord, 0, len(written))
+	for key := range written {
+		keys = append(keys, key)
+	}
+	// the first stale record sets in name order are listed, so that reruns are easy to compare
+	slices.SortFunc(keys, func(a, b writtenRecord) int {
+		return strings.Compare(a.name+string(a.rrType)+a.setIdentifier, b.name+string(b.rrType)+b.setIdentifier)
+	})
+	for _, key := range keys {
+		got, ok := listed[key]
+		switch {
+		case !ok:
+			stats.Missing++
+		case got == written[key]:
+			stats.Current++
+			continue
+		default:
+			stats.Stale++
+		}
+		slog.Debug("record set doesn't have its last written value", "name", key.name, "type", key.rrType, "want", written[key], "got", got)
+		if len(stats.Records) < maxResolutionMismatches {
+			stats.Records = append(stats.Records, staleRecord{Name: key.name, Type: string(key.rrType), Want: written[key], Got: got})
+		}
+	}
+	v.stats.RecordStale(stats)
+	log := slog.Info
+	if stats.Current != stats.Checked {
+		log = slog.Warn
+	}
+	log("🔎 Verified the upserted record sets", "zone", *hostedZone.Id, "checked", stats.Checked, "current", stats.Current,
+		"stale", stats.Stale, "missing", stats.Missing)
+	return nil
+}
+
+func writtenKey(hostedZoneID string, rr types.ResourceRecordSet) writtenRecord {
+	return writtenRecord{
+		hostedZoneID:  hostedZoneID,
+		name:          strings.ToLower(aws.ToString(rr.Name)),
+		rrType:        rr.Type,
+		setIdentifier: aws.ToString(rr.SetIdentifier),
+	}
+}
+
+// writtenValues returns the sorted values of a record set joined by commas, so that they compare regardless of order
+func writtenValues(rr types.ResourceRecordSet) string {
+	values := make([]string, 0, len(rr.ResourceRecords))
+	for _, record := range rr.ResourceRecords {
+		values = append(values, normalizeAnswer(aws.ToString(record.Value)))
+	}
+	slices.Sort(values)
+	return strings.Join(values, ",")
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53resolver"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/servicediscovery"
+	"github.com/bwagner5/floodzone/pkg/floodzone"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// route53API is the part of the Route 53 API the commands call, which *route53.Client implements
+type route53API interface {
+	floodzone.Route53API
+	route53.GetChangeAPIClient
+	AssociateVPCWithHostedZone(ctx context.Context, params *route53.AssociateVPCWithHostedZoneInput, optFns ...func(*route53.Options)) (*route53.AssociateVPCWithHostedZoneOutput, error)
+	ChangeCidrCollection(ctx context.Context, params *route53.ChangeCidrCollectionInput, optFns ...func(*route53.Options)) (*route53.ChangeCidrCollectionOutput, error)
+	CreateCidrCollection(ctx context.Context, params *route53.CreateCidrCollectionInput, optFns ...func(*route53.Options)) (*route53.CreateCidrCollectionOutput, error)
+	CreateHealthCheck(ctx context.Context, params *route53.CreateHealthCheckInput, optFns ...func(*route53.Options)) (*route53.CreateHealthCheckOutput, error)
+	CreateQueryLoggingConfig(ctx context.Context, params *route53.CreateQueryLoggingConfigInput, optFns ...func(*route53.Options)) (*route53.CreateQueryLoggingConfigOutput, error)
+	CreateTrafficPolicyInstance(ctx context.Context, params *route53.CreateTrafficPolicyInstanceInput, optFns ...func(*route53.Options)) (*route53.CreateTrafficPolicyInstanceOutput, error)
+	CreateTrafficPolicy(ctx context.Context, params *route53.CreateTrafficPolicyInput, optFns ...func(*route53.Options)) (*route53.CreateTrafficPolicyOutput, error)
+	CreateTrafficPolicyVersion(ctx context.Context, params *route53.CreateTrafficPolicyVersionInput, optFns ...func(*route53.Options)) (*route53.CreateTrafficPolicyVersionOutput, error)
+	DeleteCidrCollection(ctx context.Context, params *route53.DeleteCidrCollectionInput, optFns ...func(*route53.Options)) (*route53.DeleteCidrCollectionOutput, error)
+	DeleteHealthCheck(ctx context.Context, params *route53.DeleteHealthCheckInput, optFns ...func(*route53.Options)) (*route53.DeleteHealthCheckOutput, error)
+	DeleteHostedZone(ctx context.Context, params *route53.DeleteHostedZoneInput, optFns ...func(*route53.Options)) (*route53.DeleteHostedZoneOutput, error)
+	DeleteQueryLoggingConfig(ctx context.Context, params *route53.DeleteQueryLoggingConfigInput, optFns ...func(*route53.Options)) (*route53.DeleteQueryLoggingConfigOutput, error)
+	DeleteTrafficPolicy(ctx context.Context, params *route53.DeleteTrafficPolicyInput, optFns ...func(*route53.Options)) (*route53.DeleteTrafficPolicyOutput, error)
+	DeleteTrafficPolicyInstance(ctx context.Context, params *route53.DeleteTrafficPolicyInstanceInput, optFns ...func(*route53.Options)) (*route53.DeleteTrafficPolicyInstanceOutput, error)
+	DisassociateVPCFromHostedZone(ctx context.Context, params *route53.DisassociateVPCFromHostedZoneInput, optFns ...func(*route53.Options)) (*route53.DisassociateVPCFromHostedZoneOutput, error)
+	GetDNSSEC(ctx context.Context, params *route53.GetDNSSECInput, optFns ...func(*route53.Options)) (*route53.GetDNSSECOutput, error)
+	GetHostedZoneLimit(ctx context.Context, params *route53.GetHostedZoneLimitInput, optFns ...func(*route53.Options)) (*route53.GetHostedZoneLimitOutput, error)
+	ListCidrBlocks(ctx context.Context, params *route53.ListCidrBlocksInput, optFns ...func(*route53.Options)) (*route53.ListCidrBlocksOutput, error)
+	ListCidrCollections(ctx context.Context, params *route53.ListCidrCollectionsInput, optFns ...func(*route53.Options)) (*route53.ListCidrCollectionsOutput, error)
+	ListHealthChecks(ctx context.Context, params *route53.ListHealthChecksInput, optFns ...func(*route53.Options)) (*route53.ListHealthChecksOutput, error)
+	ListHostedZonesByVPC(ctx context.Context, params *route53.ListHostedZonesByVPCInput, optFns ...func(*route53.Options)) (*route53.ListHostedZonesByVPCOutput, error)
+	ListQueryLoggingConfigs(ctx context.Context, params *route53.ListQueryLoggingConfigsInput, optFns ...func(*route53.Options)) (*route53.ListQueryLoggingConfigsOutput, error)
+	ListTrafficPolicies(ctx context.Context, params *route53.ListTrafficPoliciesInput, optFns ...func(*route53.Options)) (*route53.ListTrafficPoliciesOutput, error)
+	ListTrafficPolicyInstances(ctx context.Context, params *route53.ListTrafficPolicyInstancesInput, optFns ...func(*route53.Options)) (*route53.ListTrafficPolicyInstancesOutput, error)
+	ListTrafficPolicyInstancesByHostedZone(ctx context.Context, params *route53.ListTrafficPolicyInstancesByHostedZoneInput, optFns ...func(*route53.Options)) (*route53.ListTrafficPolicyInstancesByHostedZoneOutput, error)
+	ListTrafficPolicyVersions(ctx context.Context, params *route53.ListTrafficPolicyVersionsInput, optFns ...func(*route53.Options)) (*route53.ListTrafficPolicyVersionsOutput, error)
+	TestDNSAnswer(ctx context.Context, params *route53.TestDNSAnswerInput, optFns ...func(*route53.Options)) (*route53.TestDNSAnswerOutput, error)
+}
+
+type Zone struct {
+	R53 route53API
+	EC2 *ec2.Client
+	S3  *s3.Client
+	// Artifacts reads and writes the summary, manifest, and checkpoint of the run
+	Artifacts *Artifacts
+	// R53Resolver manages the Route 53 Resolver endpoints of the query command
+	R53Resolver *route53resolver.Client
+	// CloudMap manages the namespaces, services, and instances of the cloud-map command
+	CloudMap *servicediscovery.Client
+	// HealthCheckMetrics reads the status of the health checks of the health-checks command from us-east-1 when set
+	HealthCheckMetrics *cloudwatch.Client
+	// Logs reads the query logs of the analyze-query-logs command and manages the log groups of flood --query-logging
+	Logs   *cloudwatchlogs.Client
+	Region string
+	// Progress replaces the per-batch log lines when set
+	Progress *Progress
+	// TUI shows a full-screen dashboard of the run when set
+	TUI *TUI
+	// Web serves a dashboard of the run that can pause it when set
+	Web *WebDashboard
+	// Stats accumulates the outcome of every change batch when set
+	Stats *RunStats
+	// Metrics publishes the outcome of every change batch to CloudWatch when set
+	Metrics *MetricsPublisher
+	// BatchCSV records a row per change batch when set
+	BatchCSV *BatchCSV
+	// SNS publishes run events when set
+	SNS *SNSNotifier
+	// Webhook posts run events and milestones when set
+	Webhook *Webhook
+	// BatchWebhook posts every change batch when set
+	BatchWebhook *BatchWebhook
+	// Hooks runs commands at the start and end of the run and around every change batch when set
+	Hooks *ExecHooks
+	// Generator generates the record sets of the flood command when set, see --record-generator
+	Generator floodzone.RecordGenerator
+	// EventBridge puts run events and an event per change batch on an event bus when set
+	EventBridge *EventBridgePublisher
+	// Manifest collects the record sets created by the run when set
+	Manifest *Manifest
+	// Terraform collects the zone and the record sets created by the run to export them as Terraform when set
+	Terraform *TerraformExport
+	// ExternalDNS collects the record sets created by the run to export them as external-dns objects when set
+	ExternalDNS *ExternalDNSExport
+	// Checkpoint keeps the progress of the run to resume it when set
+	Checkpoint *Checkpoint
+	// Propagation measures how long every change batch takes to be INSYNC when set
+	Propagation *PropagationTracker
+	// Resolvable measures how long a sample of the changed record sets takes to resolve to their new value when set
+	Resolvable *ResolvableTracker
+	// Resolution resolves a sample of the created record sets once the run created them when set
+	Resolution *ResolutionVerifier
+	// Writes lists the upserted record sets once the run upserted them to check their last written value when set
+	Writes *WriteVerifier
+	// LambdaWorkers send the queries of the query command from Lambda functions in several regions when set
+	LambdaWorkers *LambdaQueryWorkers
+	// InstanceWorkers send the queries of the query command from EC2 instances with SSM Run Command when set
+	InstanceWorkers *InstanceQueryWorkers
+	// Dashboard graphs the run in CloudWatch when set
+	Dashboard *Dashboard
+	// Coordinator locks the zones the run changes and paces its calls with the other runs sharing its table when set
+	Coordinator *Coordinator
+	// Alarms stop or notify about the run when something it stresses can't keep up when set
+	Alarms *RunAlarms
+	// Budget stops the run once it costs more than --max-cost when set
+	Budget *CostBudget
+	// ErrorBudget notifies, and stops the run with --on-error-budget abort, once its change batches were throttled or
+	// failed --max-errors times when set
+	ErrorBudget *ErrorBudget
+	// FakeRoute53 is whether R53 calls the fake-route53 command, whose zones have no VPCs or resolver endpoints in AWS
+	FakeRoute53 bool
+}
+
+// library returns the floodzone library Zone that the operations of the commands run on, submitting its change batches
+// with submitChangeBatch, reporting them to the progress display, the webhook, and the log, and running the batch hooks
+func (z Zone) library() floodzone.Zone {
+	return floodzone.NewZone(z.R53, floodzone.WithSubmit(z.submitChangeBatch), floodzone.WithObserver(zoneObserver{z}),
+		floodzone.WithHooks(z.Hooks.library()), floodzone.WithGenerator(z.Generator))
+}
+
+// CreatePrivateHostedZone creates a private hosted zone with an unique name in the format: floodzone-test-<UUID>.aws
+// The hosted zone ID is returned.
+func (z Zone) CreatePrivateHostedZone(ctx context.Context, vpcID string, region string) (string, error) {
+	return z.library().CreatePrivateHostedZone(ctx, vpcID, region)
+}
+
+// DeleteResourceRecordSets deletes the desired number of Resource Record Sets in controlled batches and returns the
+// remaining resource record sets in the zone excluding SOA and NS records.
+func (z Zone) DeleteResourceRecordSets(ctx context.Context, hostedZone *types.HostedZone, maxBatchSize int, desiredDeletions int, batchDelay time.Duration) (int, error) {
+	return z.library().DeleteResourceRecordSets(ctx, hostedZone, maxBatchSize, desiredDeletions, batchDelay)
+}
+
+// SequentialStart returns where the sequential generator counts from in the zone
+func (z Zone) SequentialStart(ctx context.Context, hostedZone *types.HostedZone, maxBatchSize int) (int, error) {
+	return z.library().SequentialStart(ctx, hostedZone, maxBatchSize)
+}
+
+func (z Zone) ListResourceRecordSets(ctx context.Context, hostedZone *types.HostedZone, maxBatchSize int) ([]types.ResourceRecordSet, error) {
+	return z.library().ListResourceRecordSets(ctx, hostedZone, maxBatchSize)
+}
+
+// WalkResourceRecordSets calls fn for every record set of the zone the filter selects, a page at a time
+func (z Zone) WalkResourceRecordSets(ctx context.Context, hostedZone *types.HostedZone, maxBatchSize int, filter floodzone.RecordSetFilter,
+	fn func(rr types.ResourceRecordSet) error) error {
+	return z.library().WalkResourceRecordSets(ctx, hostedZone, maxBatchSize, filter, fn)
+}
+
+// GrowResourceRecordSets creates resource record sets through the stages of a load profile
+func (z Zone) GrowResourceRecordSets(ctx context.Context, hostedZone *types.HostedZone, currentRRSetCount int, stages []LoadStage, typeMix map[types.RRType]int) error {
+	return z.library().GrowResourceRecordSets(ctx, hostedZone, currentRRSetCount, stages, typeMix)
+}
+
+// ChurnResourceRecordSets UPSERTs the A record sets in the zone with new values in controlled batches. Up to
+// recordsPerIteration record sets are updated per iteration and the whole pass is repeated iterations times.
+func (z Zone) ChurnResourceRecordSets(ctx context.Context, hostedZone *types.HostedZone, recordsPerIteration int,
+	iterations int, maxBatchSize int, batchDelay time.Duration) error {
+	return z.library().ChurnResourceRecordSets(ctx, hostedZone, recordsPerIteration, iterations, maxBatchSize, batchDelay)
+}
+
+// DeleteHostedZone deletes an empty hosted zone along with any ephemeral VPCs floodzone created for it.
+func (z Zone) DeleteHostedZone(ctx context.Context, hostedZone *types.HostedZone, vpcs []types.VPC) error {
+	if err := z.Coordinator.Lock(ctx, *hostedZone.Id); err != nil {
+		return err
+	}
+	if _, err := z.R53.DeleteHostedZone(ctx, &route53.DeleteHostedZoneInput{Id: hostedZone.Id}); err != nil {
+		return fmt.Errorf("unable to delete the zone %s: %w", *hostedZone.Id, err)
+	}
+	slog.Info("✅ Successfully deleted the private hosted zone since all record sets were deleted", "zone", *hostedZone.Id)
+	// the fake only serves Route 53, so the VPCs associated with its zones aren't in the AWS account of the credentials
+	if z.FakeRoute53 {
+		slog.Debug("skipping the cleanup of the VPCs and resolver endpoints of a zone of fake-route53", "zone", *hostedZone.Id)
+		return nil
+	}
+	// endpoints created by the outbound-endpoint command and VPCs created with --create-vpc are only useful for the zone,
+	// so clean them up with it. The endpoints go first since a VPC can't be deleted while they have IP addresses in it.
+	// The VPCs are still deleted when the endpoints couldn't be, those without endpoints in them don't leak.
+	endpointsErr := z.DeleteEphemeralEndpoints(ctx, vpcs, z.Region)
+	return errors.Join(endpointsErr, z.DeleteEphemeralVPCs(ctx, vpcs, z.Region))
+}
+
+// submitChangeBatch submits a batch of changes to the hosted zone, logging the full request and response at debug level
+// and recording the outcome in the run stats, progress display, metrics, batch CSV, and event bus.
+func (z Zone) submitChangeBatch(ctx context.Context, hostedZone *types.HostedZone, changes []types.Change) (*route53.ChangeResourceRecordSetsOutput, error) {
+	if err := z.Web.WaitWhilePaused(ctx); err != nil {
+		return nil, err
+	}
+	if err := z.Coordinator.Lock(ctx, *hostedZone.Id); err != nil {
+		return nil, err
+	}
+	ctx, span := tracer().Start(ctx, "ChangeBatch", trace.WithAttributes(
+		attribute.Int("floodzone.batch.index", z.Stats.Submitted()+1),
+		attribute.Int("floodzone.batch.changes", len(changes)),
+		attribute.String("floodzone.batch.action", string(changes[0].Action)),
+		attribute.String("floodzone.zone.id", *hostedZone.Id),
+	))
+	defer span.End()
+	input := &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: hostedZone.Id,
+		ChangeBatch: &types.ChangeBatch{
+			Changes: changes,
+		},
+	}
+	slog.Debug("ChangeResourceRecordSets request", "zone", *hostedZone.Id, "request", jsonValue{input})
+	z.Stats.RecordZone(*hostedZone.Id)
+	z.Progress.BatchStarted()
+	start := time.Now()
+	out, err := z.R53.ChangeResourceRecordSets(ctx, input)
+	latency := time.Since(start)
+	z.Progress.BatchFinished(err)
+	if err != nil {
+		slog.Debug("ChangeResourceRecordSets failed", "zone", *hostedZone.Id, "latency", latency, "error", err)
+		z.Stats.RecordError(err, latency)
+		z.Metrics.RecordBatch(*hostedZone.Id, changes, latency, err)
+		z.BatchCSV.RecordBatch(start, *hostedZone.Id, changes, latency, nil, err)
+		z.BatchWebhook.RecordBatch(*hostedZone.Id, changes, latency, nil, err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	slog.Debug("ChangeResourceRecordSets response", "zone", *hostedZone.Id, "latency", latency, "response", jsonValue{out.ChangeInfo})
+	z.Stats.RecordBatch(changes, latency)
+	z.Metrics.RecordBatch(*hostedZone.Id, changes, latency, nil)
+	z.BatchCSV.RecordBatch(start, *hostedZone.Id, changes, latency, out, nil)
+	z.BatchWebhook.RecordBatch(*hostedZone.Id, changes, latency, out, nil)
+	z.EventBridge.RecordBatch(*hostedZone.Id, changes, latency, out)
+	z.Manifest.RecordBatch(*hostedZone.Id, changes)
+	z.Terraform.RecordBatch(*hostedZone.Id, changes)
+	z.ExternalDNS.RecordBatch(*hostedZone.Id, changes)
+	z.Resolution.RecordBatch(*hostedZone.Id, changes)
+	z.Writes.RecordBatch(*hostedZone.Id, changes)
+	z.Propagation.Track(out.ChangeInfo, start)
+	z.Resolvable.Track(changes, start)
+	return out, nil
+}
+
+// zoneObserver reports the batches of the library's operations to the progress display, the webhook, and the log
+type zoneObserver struct {
+	z Zone
+}
+
+func (o zoneObserver) Start(action string, done int, total int) {
+	o.z.Progress.Start(action, done, total)
+	o.z.Webhook.Start(action, done, total)
+}
+
+func (o zoneObserver) Batched(ctx context.Context, batch floodzone.Batch) {
+	o.z.Progress.Add(batch.Size)
+	o.z.Webhook.Add(ctx, batch.Size)
+	o.z.Checkpoint.Batched(batch)
+	args := []any{"batchSize", batch.Size, "zone", batch.HostedZoneID, "done", batch.Done, "total", batch.Total}
+	if batch.Iterations > 0 {
+		args = append(args, "iteration", batch.Iteration, "iterations", batch.Iterations)
+	}
+	o.z.logBatch(fmt.Sprintf("✅ Executed batch of %s Resource Record Sets", batch.Action), append(args, "sleep", batch.Delay)...)
+}
+
+func (o zoneObserver) Finish() {
+	o.z.Progress.Finish()
+}
+
+// logBatch logs a completed batch unless the progress display is reporting it instead
+func (z Zone) logBatch(msg string, args ...any) {
+	if z.Progress == nil || z.Progress.hidden {
+		slog.Info(msg, args...)
+	}
+}